@@ -0,0 +1,247 @@
+// Command ecs-agent-status-lambda runs the agent check as an AWS Lambda function, e.g. on an EventBridge
+// schedule. Each agent is written to CloudWatch Logs as a JSON line, followed by a summary, and the
+// unhealthy agents are published to an SNS topic if one is configured
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+	"github.com/natemarks/ecs-agent-status/version"
+	"github.com/rs/zerolog"
+)
+
+// defaultConcurrency is the number of clusters checked in parallel in each region unless CONCURRENCY is set
+const defaultConcurrency = 4
+
+var logger = zerolog.New(os.Stderr).With().Timestamp().Str("version", version.Version).Logger()
+
+// Request selects the clusters to check. Its fields default to the function's environment variables and
+// can be overridden per invocation by the constant input of the EventBridge rule, e.g.
+// {"patterns": ["production"], "regions": ["us-east-1"]}
+type Request struct {
+	// Patterns are the cluster name patterns (CLUSTER_PATTERNS, comma-separated)
+	Patterns []string `json:"patterns"`
+	// Match is how the patterns are matched: substring, exact or regex (MATCH)
+	Match string `json:"match"`
+	// Regions are the regions to scan (REGIONS, comma-separated). Empty scans the function's region
+	Regions []string `json:"regions"`
+	// FailOn selects what makes an agent unhealthy: status, disconnected or both (FAIL_ON)
+	FailOn string `json:"failOn"`
+	// SNSTopicArn, when set, receives a summary of the unhealthy agents (SNS_TOPIC_ARN)
+	SNSTopicArn string `json:"snsTopicArn"`
+	// Concurrency is the number of clusters checked in parallel in each region (CONCURRENCY)
+	Concurrency int `json:"concurrency"`
+}
+
+// Response is the result of an invocation
+type Response struct {
+	Summary   agentstatus.Summary `json:"summary"`
+	Unhealthy []agentstatus.Agent `json:"unhealthy"`
+}
+
+// splitList splits a comma-separated environment variable, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// RequestFromEnv returns the request configured by the environment variables, looked up with getenv
+func RequestFromEnv(getenv func(string) string) (Request, error) {
+	req := Request{
+		Patterns:    splitList(getenv("CLUSTER_PATTERNS")),
+		Match:       "substring",
+		Regions:     splitList(getenv("REGIONS")),
+		FailOn:      getenv("FAIL_ON"),
+		SNSTopicArn: getenv("SNS_TOPIC_ARN"),
+		Concurrency: defaultConcurrency,
+	}
+	if value := getenv("MATCH"); value != "" {
+		req.Match = value
+	}
+	if value := getenv("CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil || concurrency < 1 {
+			return req, fmt.Errorf("invalid CONCURRENCY %q: must be a positive integer", value)
+		}
+		req.Concurrency = concurrency
+	}
+	return req, nil
+}
+
+// Merge returns r with the fields set in override replacing its own
+func (r Request) Merge(override Request) Request {
+	if len(override.Patterns) > 0 {
+		r.Patterns = override.Patterns
+	}
+	if override.Match != "" {
+		r.Match = override.Match
+	}
+	if len(override.Regions) > 0 {
+		r.Regions = override.Regions
+	}
+	if override.FailOn != "" {
+		r.FailOn = override.FailOn
+	}
+	if override.SNSTopicArn != "" {
+		r.SNSTopicArn = override.SNSTopicArn
+	}
+	if override.Concurrency > 0 {
+		r.Concurrency = override.Concurrency
+	}
+	return r
+}
+
+// ParseRequest decodes the invocation event over the environment defaults. Events that are not a Request,
+// such as the default payload of a scheduled EventBridge rule, leave the defaults unchanged
+func ParseRequest(event json.RawMessage, defaults Request) (Request, error) {
+	var override Request
+	if len(event) > 0 {
+		if err := json.Unmarshal(event, &override); err != nil {
+			logger.Debug().Err(err).Msg("event is not a request, using the environment")
+			override = Request{}
+		}
+	}
+	req := defaults.Merge(override)
+	if len(req.Patterns) == 0 {
+		return req, errors.New("no cluster patterns: set CLUSTER_PATTERNS or patterns in the event")
+	}
+	return req, nil
+}
+
+// Scan checks the clusters matching the request in every region and returns their agents sorted by region
+// and cluster. Regions and clusters that fail are logged and reported in the returned error, after the agents
+// of the others
+func Scan(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, req Request, mode agentstatus.MatchMode) ([]agentstatus.Agent, error) {
+	var agents []agentstatus.Agent
+	var errs []error
+	for region, checker := range checkers {
+		refs, err := checker.ListClustersMatchingAny(ctx, req.Patterns, mode)
+		if errors.Is(err, agentstatus.ErrNoClustersMatched) {
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("region", region).Msg("error getting clusters")
+			errs = append(errs, fmt.Errorf("region %v: %w", region, err))
+			continue
+		}
+		clusters := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			clusters = append(clusters, ref.Name)
+		}
+		if active, err := checker.PrecheckClusters(ctx, clusters); err == nil {
+			clusters = active
+		}
+		for result := range checker.ScanClusters(ctx, clusters, req.Concurrency) {
+			if result.Err != nil {
+				logger.Error().Err(result.Err).Str("region", region).Str("cluster", result.Cluster).Msg("error getting agents")
+				errs = append(errs, fmt.Errorf("region %v cluster %v: %w", region, result.Cluster, result.Err))
+				continue
+			}
+			agents = append(agents, result.Agents...)
+		}
+	}
+	sort.SliceStable(agents, func(i, j int) bool {
+		if agents[i].Region != agents[j].Region {
+			return agents[i].Region < agents[j].Region
+		}
+		return agents[i].Cluster < agents[j].Cluster
+	})
+	return agents, errors.Join(errs...)
+}
+
+// WriteAgents writes each agent to w as a compact JSON line, so every agent is a CloudWatch Logs event
+func WriteAgents(w io.Writer, agents []agentstatus.Agent) error {
+	encoder := json.NewEncoder(w)
+	for _, agent := range agents {
+		if err := encoder.Encode(agent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notify publishes the response to the SNS topic as a JSON message, loading the AWS config of the topic's
+// region
+func Notify(ctx context.Context, topicArn string, response Response) error {
+	topic, err := arn.Parse(topicArn)
+	if err != nil {
+		return fmt.Errorf("invalid SNS topic ARN: %w", err)
+	}
+	cfgs, err := agentstatus.LoadAWSConfigs(ctx, []string{topic.Region}, "")
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("ecs-agent-status: %v unhealthy agents in %v clusters", response.Summary.Unhealthy, response.Summary.Clusters)
+	return agentstatus.PublishSNS(ctx, sns.NewFromConfig(cfgs[topic.Region]), topicArn, subject, response)
+}
+
+// Handle runs one check. It returns an error when the request is invalid or a region or cluster could not
+// be checked, so failed checks show in the function's error metrics
+func Handle(ctx context.Context, event json.RawMessage) (Response, error) {
+	defaults, err := RequestFromEnv(os.Getenv)
+	if err != nil {
+		return Response{}, err
+	}
+	req, err := ParseRequest(event, defaults)
+	if err != nil {
+		return Response{}, err
+	}
+	mode, err := agentstatus.ParseMatchMode(req.Match)
+	if err != nil {
+		return Response{}, err
+	}
+	policy := agentstatus.DefaultHealthPolicy
+	if req.FailOn != "" {
+		if policy, err = agentstatus.ParseHealthPolicy(req.FailOn); err != nil {
+			return Response{}, fmt.Errorf("invalid failOn %q: %w", req.FailOn, err)
+		}
+	}
+
+	cfgs, err := agentstatus.LoadAWSConfigs(ctx, req.Regions, "")
+	if err != nil {
+		return Response{}, err
+	}
+	checkers := make(map[string]*agentstatus.StatusChecker)
+	for region, cfg := range cfgs {
+		checkers[region] = agentstatus.NewStatusCheckerFromConfig(agentstatus.WithRetries(cfg, agentstatus.RetryOptions{}))
+	}
+	agents, scanErr := Scan(ctx, checkers, req, mode)
+	if err := WriteAgents(os.Stdout, agents); err != nil {
+		return Response{}, err
+	}
+
+	response := Response{Summary: agentstatus.Summarize(agents, policy), Unhealthy: policy.UnhealthyAgents(agents)}
+	if response.Unhealthy == nil {
+		response.Unhealthy = []agentstatus.Agent{}
+	}
+	logger.Info().Interface("summary", response.Summary).Msgf("summary: %v", response.Summary)
+	if req.SNSTopicArn != "" && len(response.Unhealthy) > 0 {
+		// Notifications are best-effort and never fail the invocation
+		if err := Notify(ctx, req.SNSTopicArn, response); err != nil {
+			logger.Error().Err(err).Msg("error publishing SNS notification")
+		}
+	}
+	return response, scanErr
+}
+
+func main() {
+	agentstatus.SetLogger(logger)
+	lambda.Start(Handle)
+}
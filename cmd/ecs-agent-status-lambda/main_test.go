@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	env := map[string]string{
+		"CLUSTER_PATTERNS": "production, staging",
+		"REGIONS":          "us-east-1",
+		"CONCURRENCY":      "8",
+	}
+	defaults, err := RequestFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("RequestFromEnv() error = %v", err)
+	}
+	want := Request{Patterns: []string{"production", "staging"}, Match: "substring", Regions: []string{"us-east-1"}, Concurrency: 8}
+	if !reflect.DeepEqual(defaults, want) {
+		t.Errorf("RequestFromEnv() = %+v, want %+v", defaults, want)
+	}
+
+	tests := []struct {
+		name  string
+		event string
+		want  Request
+	}{
+		{
+			name:  "scheduled event",
+			event: `{"version": "0", "detail-type": "Scheduled Event", "source": "aws.events", "detail": {}}`,
+			want:  want,
+		},
+		{
+			name:  "constant input",
+			event: `{"patterns": ["^prod-"], "match": "regex"}`,
+			want:  Request{Patterns: []string{"^prod-"}, Match: "regex", Regions: []string{"us-east-1"}, Concurrency: 8},
+		},
+		{
+			name:  "not an object",
+			event: `"run"`,
+			want:  want,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRequest(json.RawMessage(tt.event), defaults)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRequest() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseRequest(nil, Request{}); err == nil {
+		t.Error("ParseRequest() without patterns returned no error")
+	}
+	if _, err := RequestFromEnv(func(key string) string { return map[string]string{"CONCURRENCY": "0"}[key] }); err == nil {
+		t.Error("RequestFromEnv() with CONCURRENCY=0 returned no error")
+	}
+}
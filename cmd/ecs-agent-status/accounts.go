@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// AccountConfig is an entry of the accounts section of the config file: an AWS account scanned by
+// --all-accounts through a role assumed in it
+type AccountConfig struct {
+	ID         string   `yaml:"id"`
+	RoleARN    string   `yaml:"role-arn"`
+	ExternalID string   `yaml:"external-id"`
+	Regions    []string `yaml:"regions"`
+}
+
+// Validate checks that the account has an ID and a role to assume
+func (a AccountConfig) Validate() error {
+	switch {
+	case a.ID == "":
+		return errors.New("account without an id")
+	case a.RoleARN == "":
+		return fmt.Errorf("account %v has no role-arn", a.ID)
+	}
+	return nil
+}
+
+// ScopeKey returns the key of the AWS config and StatusChecker maps for a region of an account: the region
+// alone when the account is not known, so single-account runs are keyed by region
+func ScopeKey(account, region string) string {
+	if account == "" {
+		return region
+	}
+	return account + "/" + region
+}
+
+// scopeAccount returns the account of a ScopeKey, or an empty string if the key is only a region
+func scopeAccount(key string) string {
+	account, _, found := strings.Cut(key, "/")
+	if !found {
+		return ""
+	}
+	return account
+}
+
+// scopeIn returns the key of a region of an account in scopes, which are keyed by ScopeKey. Agents record
+// their account even in single-account runs, whose scopes are keyed by the region alone
+func scopeIn[V any](scopes map[string]V, account, region string) string {
+	if key := ScopeKey(account, region); account != "" {
+		if _, ok := scopes[key]; ok {
+			return key
+		}
+	}
+	return region
+}
+
+// LoadAccountConfigs loads the AWS config of every region of every account in opts.Accounts, assuming the
+// account's role with the --profile credentials, keyed by ScopeKey. Accounts without regions use the
+// regions given on the command line
+func LoadAccountConfigs(ctx context.Context, opts Options) (map[string]aws.Config, error) {
+	cfgs := make(map[string]aws.Config)
+	for _, account := range opts.Accounts {
+		accountOpts := opts
+		accountOpts.AssumeRole = agentstatus.AssumeRole{
+			RoleARN:     account.RoleARN,
+			ExternalID:  account.ExternalID,
+			SessionName: opts.AssumeRole.SessionName,
+		}
+		if len(account.Regions) > 0 {
+			accountOpts.Regions, accountOpts.AllRegions = account.Regions, false
+		}
+		regions, err := ResolveRegions(ctx, accountOpts)
+		if err != nil {
+			return nil, fmt.Errorf("account %v: list enabled regions: %w", account.ID, err)
+		}
+		loaded, err := LoadAWSConfigs(ctx, regions, accountOpts)
+		if err != nil {
+			return nil, fmt.Errorf("account %v: %w", account.ID, err)
+		}
+		for region, cfg := range loaded {
+			cfgs[ScopeKey(account.ID, region)] = cfg
+		}
+	}
+	return cfgs, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScopeKey(t *testing.T) {
+	if got := ScopeKey("", "us-east-1"); got != "us-east-1" || scopeAccount(got) != "" {
+		t.Errorf("ScopeKey() without an account = %q, account %q", got, scopeAccount(got))
+	}
+	if got := ScopeKey("123456789012", "us-east-1"); got != "123456789012/us-east-1" || scopeAccount(got) != "123456789012" {
+		t.Errorf("ScopeKey() = %q, account %q", got, scopeAccount(got))
+	}
+}
+
+func TestScopeIn(t *testing.T) {
+	single := map[string]bool{"us-east-1": true}
+	if got := scopeIn(single, "123456789012", "us-east-1"); got != "us-east-1" {
+		t.Errorf("scopeIn() of a single-account run = %q, want the region", got)
+	}
+	accounts := map[string]bool{"123456789012/us-east-1": true}
+	if got := scopeIn(accounts, "123456789012", "us-east-1"); got != "123456789012/us-east-1" {
+		t.Errorf("scopeIn() = %q, want the account and region", got)
+	}
+}
+
+func TestLoadConfigFileAccounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `accounts:
+  - id: "111111111111"
+    role-arn: arn:aws:iam::111111111111:role/ecs-agent-status
+    regions: [us-east-1, eu-west-1]
+  - id: "222222222222"
+    role-arn: arn:aws:iam::222222222222:role/ecs-agent-status
+    external-id: tooling
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfigFile(path, true)
+	if err != nil {
+		t.Fatalf("LoadConfigFile() error = %v", err)
+	}
+	if len(config.Accounts) != 2 || len(config.Accounts[0].Regions) != 2 || config.Accounts[1].ExternalID != "tooling" {
+		t.Errorf("LoadConfigFile() accounts = %+v", config.Accounts)
+	}
+	if _, ok := config.Values["accounts"]; ok {
+		t.Error("LoadConfigFile() kept the accounts section as a flag value")
+	}
+
+	if err := os.WriteFile(path, []byte("accounts:\n  - id: \"111111111111\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFile(path, true); err == nil {
+		t.Error("LoadConfigFile() with an account without a role returned no error")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// defaultAgentLogGroup is the log group the CloudWatch agent configuration of the ECS documentation ships
+// /var/log/ecs/ecs-agent.log to, with a log stream per instance named after its instance ID
+const defaultAgentLogGroup = "/var/log/ecs/ecs-agent.log"
+
+// LogEventsGetter is the subset of the CloudWatch Logs API used to read the ECS agent log
+type LogEventsGetter interface {
+	GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error)
+}
+
+// AgentLogTail returns the last lines of the ECS agent log of an instance, read from the log stream named
+// after the instance ID in logGroup. An instance without a log stream has no lines
+func AgentLogTail(ctx context.Context, client LogEventsGetter, logGroup, instanceID string, lines int) ([]string, error) {
+	output, err := client.GetLogEvents(ctx, &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(logGroup),
+		LogStreamName: aws.String(instanceID),
+		Limit:         aws.Int32(int32(lines)),
+		StartFromHead: aws.Bool(false),
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get log events of %v: %w", instanceID, err)
+	}
+	tail := make([]string, 0, len(output.Events))
+	for _, event := range output.Events {
+		tail = append(tail, strings.TrimRight(aws.ToString(event.Message), "\n"))
+	}
+	return tail, nil
+}
+
+// FetchAgentLogs sets the AgentLog of every disconnected agent to the last --agent-log-lines lines of its
+// ECS agent log in --agent-log-group, read in the region, and account, of the agent. Agents whose log could
+// not be read are logged and left without one
+func FetchAgentLogs(ctx context.Context, cfgs map[string]aws.Config, agents []agentstatus.Agent, opts Options) {
+	clients := make(map[string]LogEventsGetter)
+	for i, agent := range agents {
+		if agent.AgentConnected || agent.AgentStatus == "UNKNOWN" || agent.InstanceID() == "" {
+			continue
+		}
+		scope := scopeIn(cfgs, agent.AccountID, agent.Region)
+		if clients[scope] == nil {
+			clients[scope] = cloudwatchlogs.NewFromConfig(cfgs[scope])
+		}
+		tail, err := AgentLogTail(ctx, clients[scope], opts.AgentLogGroup, agent.InstanceID(), opts.AgentLogLines)
+		if err != nil {
+			logger.Warn().Err(err).Str("instanceId", agent.InstanceID()).Msgf("error reading the ECS agent log of %v: %v", agent.InstanceID(), err)
+			continue
+		}
+		if len(tail) == 0 {
+			logger.Info().Str("instanceId", agent.InstanceID()).Str("logGroup", opts.AgentLogGroup).
+				Msgf("no ECS agent log for %v in %v", agent.InstanceID(), opts.AgentLogGroup)
+		}
+		agents[i].AgentLog = tail
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// mockLogs answers GetLogEvents with the messages of the stream, or ResourceNotFoundException
+type mockLogs struct {
+	streams map[string][]string
+	input   *cloudwatchlogs.GetLogEventsInput
+}
+
+func (m *mockLogs) GetLogEvents(_ context.Context, params *cloudwatchlogs.GetLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	m.input = params
+	messages, ok := m.streams[aws.ToString(params.LogStreamName)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("The specified log stream does not exist.")}
+	}
+	output := &cloudwatchlogs.GetLogEventsOutput{}
+	for _, message := range messages {
+		output.Events = append(output.Events, types.OutputLogEvent{Message: aws.String(message)})
+	}
+	return output, nil
+}
+
+func TestAgentLogTail(t *testing.T) {
+	client := &mockLogs{streams: map[string][]string{"i-aaaa": {
+		"level=error msg=\"Error connecting to ACS\"\n",
+		"level=info msg=\"Reconnecting to ACS\"",
+	}}}
+	tail, err := AgentLogTail(context.Background(), client, defaultAgentLogGroup, "i-aaaa", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"level=error msg=\"Error connecting to ACS\"", "level=info msg=\"Reconnecting to ACS\""}; !reflect.DeepEqual(tail, want) {
+		t.Errorf("AgentLogTail() = %q, want %q", tail, want)
+	}
+	if aws.ToInt32(client.input.Limit) != 20 || aws.ToBool(client.input.StartFromHead) || aws.ToString(client.input.LogGroupName) != defaultAgentLogGroup {
+		t.Errorf("AgentLogTail() called GetLogEvents with %+v", client.input)
+	}
+	if tail, err := AgentLogTail(context.Background(), client, defaultAgentLogGroup, "i-bbbb", 20); err != nil || tail != nil {
+		t.Errorf("AgentLogTail() without a log stream = %q, %v, want no lines and no error", tail, err)
+	}
+}
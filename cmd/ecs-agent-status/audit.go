@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Actions of the audit records
+const (
+	AuditDrain        = "drain"
+	AuditTerminate    = "terminate"
+	AuditASGReplace   = "asg-replace"
+	AuditRestartAgent = "restart-agent"
+	AuditUpdateAgent  = "update-agent"
+	AuditDeregister   = "deregister"
+)
+
+// auditSecretFlags are the flags whose values are credentials, masked in the command of audit records
+var auditSecretFlags = map[string]bool{
+	"webhook-url":           true,
+	"slack-webhook-url":     true,
+	"pagerduty-routing-key": true,
+	"redact-key":            true,
+}
+
+// auditMask replaces the values of auditSecretFlags in the command of audit records
+const auditMask = "***"
+
+// auditCommand returns the command line args for audit records, with the values of auditSecretFlags
+// masked, whether given as --flag value or --flag=value
+func auditCommand(args []string) string {
+	masked := make([]string, len(args))
+	copy(masked, args)
+	for i := 1; i < len(masked); i++ {
+		arg := masked[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !auditSecretFlags[name] {
+			continue
+		}
+		if hasValue {
+			masked[i] = arg[:strings.Index(arg, "=")+1] + auditMask
+		} else if i+1 < len(masked) {
+			i++
+			masked[i] = auditMask
+		}
+	}
+	return strings.Join(masked, " ")
+}
+
+// CallerIdentifier is the subset of the STS API used to find who runs the mutating actions
+type CallerIdentifier interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// LogEventsPutter is the subset of the CloudWatch Logs API used to write the audit records
+type LogEventsPutter interface {
+	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+// AuditActor is the AWS identity an action was taken with, as returned by STS GetCallerIdentity
+type AuditActor struct {
+	ARN       string `json:"arn"`
+	AccountID string `json:"accountId"`
+	UserID    string `json:"userId"`
+}
+
+// AuditState is the state of a container instance before or after an action. Only the fields the action
+// reads or changes are set
+type AuditState struct {
+	AgentStatus       string `json:"agentStatus,omitempty"`
+	AgentConnected    *bool  `json:"agentConnected,omitempty"`
+	AgentVersion      string `json:"agentVersion,omitempty"`
+	AgentUpdateStatus string `json:"agentUpdateStatus,omitempty"`
+	RunningTasks      *int   `json:"runningTasks,omitempty"`
+	// InstanceState is the state of the EC2 instance, e.g. shutting-down after a termination
+	InstanceState string `json:"instanceState,omitempty"`
+	// HealthStatus is the health of the instance in its Auto Scaling group
+	HealthStatus string `json:"healthStatus,omitempty"`
+}
+
+// agentAuditState returns the state of the container instance of agent
+func agentAuditState(agent agentstatus.Agent) *AuditState {
+	return &AuditState{
+		AgentStatus:       agent.AgentStatus,
+		AgentConnected:    aws.Bool(agent.AgentConnected),
+		AgentVersion:      agent.AgentVersion,
+		AgentUpdateStatus: agent.AgentUpdateStatus,
+		RunningTasks:      aws.Int(agent.RunningTasks),
+	}
+}
+
+// AuditRecord is a line of the audit log: a mutating action taken on a container instance, who took it and
+// the state of the instance before and after it. Error is set when the action failed
+type AuditRecord struct {
+	Time                 time.Time   `json:"time"`
+	Actor                *AuditActor `json:"actor,omitempty"`
+	Command              string      `json:"command"`
+	Action               string      `json:"action"`
+	AccountID            string      `json:"accountId,omitempty"`
+	Region               string      `json:"region"`
+	Cluster              string      `json:"cluster"`
+	ContainerInstanceARN string      `json:"containerInstanceArn"`
+	EC2InstanceID        string      `json:"ec2InstanceId,omitempty"`
+	AutoScalingGroup     string      `json:"autoScalingGroup,omitempty"`
+	Before               *AuditState `json:"before,omitempty"`
+	After                *AuditState `json:"after,omitempty"`
+	Error                string      `json:"error,omitempty"`
+}
+
+// NewAuditRecord returns the record of an action on the container instance of agent, with its state before
+// the action. The error of a failed action is recorded, and after is only kept when it succeeded
+func NewAuditRecord(action string, agent agentstatus.Agent, after *AuditState, err error) AuditRecord {
+	record := AuditRecord{
+		Action:               action,
+		AccountID:            agent.AccountID,
+		Region:               agent.Region,
+		Cluster:              agent.Cluster,
+		ContainerInstanceARN: agent.ContainerInstanceARN,
+		EC2InstanceID:        agent.EC2InstanceID,
+		AutoScalingGroup:     agent.AutoScalingGroup,
+		Before:               agentAuditState(agent),
+		After:                after,
+	}
+	if err != nil {
+		record.After = nil
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// AuditLog records the mutating actions of the run as JSON lines appended to --audit-log and sent to a
+// log stream of --audit-log-group. A nil AuditLog records nothing
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is the --audit-log file, closed by Close
+	file *os.File
+	// logs writes to stream in group when --audit-log-group is set
+	logs          LogEventsPutter
+	group, stream string
+	// callers are the STS clients of each ScopeKey, and actors their identities once looked up
+	callers map[string]CallerIdentifier
+	actors  map[string]*AuditActor
+	command string
+	now     func() time.Time
+}
+
+// auditLog records the mutating actions of the run when --audit-log or --audit-log-group is set
+var auditLog *AuditLog
+
+// NewAuditLog returns an audit log writing to w and, when logs is not nil, to stream in group, which must
+// exist. The actors are looked up with the callers of each ScopeKey
+func NewAuditLog(w io.Writer, logs LogEventsPutter, group, stream string, callers map[string]CallerIdentifier, command string) *AuditLog {
+	return &AuditLog{w: w, logs: logs, group: group, stream: stream, callers: callers, actors: make(map[string]*AuditActor), command: command, now: time.Now}
+}
+
+// OpenAuditLog returns the audit log of --audit-log and --audit-log-group, or nil when neither is set. The
+// file is appended to, and a log stream named after the host, time and process is created in the log group,
+// in the region of the AWS config. The actors are looked up with the AWS config of each scanned region
+func OpenAuditLog(ctx context.Context, cfgs map[string]aws.Config, opts Options) (*AuditLog, error) {
+	if opts.AuditLog == "" && opts.AuditLogGroup == "" {
+		return nil, nil
+	}
+	var w io.Writer = io.Discard
+	var file *os.File
+	if opts.AuditLog != "" {
+		var err error
+		if file, err = os.OpenFile(opts.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600); err != nil {
+			return nil, fmt.Errorf("open audit log: %w", err)
+		}
+		w = file
+	}
+	// closeFile closes the file when the log group cannot be written to
+	closeFile := func() {
+		if file != nil {
+			file.Close()
+		}
+	}
+	var logs LogEventsPutter
+	var stream string
+	if opts.AuditLogGroup != "" {
+		loaded, err := agentstatus.LoadAWSConfigs(ctx, nil, opts.Profile)
+		if err != nil {
+			closeFile()
+			return nil, err
+		}
+		var cfg aws.Config
+		for _, c := range loaded {
+			cfg = agentstatus.WithRetries(agentstatus.WithEndpoint(c, opts.EndpointURL), opts.Retry)
+		}
+		client := cloudwatchlogs.NewFromConfig(cfg)
+		host, _ := os.Hostname()
+		stream = fmt.Sprintf("%v/%v-%v", valueOr(host, "unknown"), time.Now().UTC().Format("20060102T150405Z"), os.Getpid())
+		_, err = client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{LogGroupName: aws.String(opts.AuditLogGroup), LogStreamName: aws.String(stream)})
+		if err != nil {
+			closeFile()
+			return nil, fmt.Errorf("create log stream %v in audit log group %v: %w", stream, opts.AuditLogGroup, err)
+		}
+		logs = client
+	}
+	callers := make(map[string]CallerIdentifier, len(cfgs))
+	for scope, cfg := range cfgs {
+		callers[scope] = sts.NewFromConfig(cfg)
+	}
+	log := NewAuditLog(w, logs, opts.AuditLogGroup, stream, callers, auditCommand(os.Args))
+	log.file = file
+	return log, nil
+}
+
+// Close closes the --audit-log file
+func (l *AuditLog) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// actor returns the identity the actions in scope are taken with, looked up once per scope. Identities
+// that cannot be looked up are logged and left out of the records
+func (l *AuditLog) actor(ctx context.Context, scope string) *AuditActor {
+	if actor, ok := l.actors[scope]; ok {
+		return actor
+	}
+	var actor *AuditActor
+	if caller := l.callers[scope]; caller != nil {
+		output, err := caller.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			logger.Warn().Err(err).Str("scope", scope).Msgf("error looking up the caller identity for the audit log: %v", err)
+		} else {
+			actor = &AuditActor{ARN: aws.ToString(output.Arn), AccountID: aws.ToString(output.Account), UserID: aws.ToString(output.UserId)}
+		}
+	}
+	l.actors[scope] = actor
+	return actor
+}
+
+// Record writes a record with its time, actor and command set. The action has already been taken, so
+// errors writing the record are logged rather than returned
+func (l *AuditLog) Record(ctx context.Context, record AuditRecord) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record.Time = l.now().UTC()
+	record.Actor = l.actor(ctx, scopeIn(l.callers, record.AccountID, record.Region))
+	record.Command = l.command
+	line, err := json.Marshal(record)
+	if err != nil {
+		logger.Error().Err(err).Msg("error encoding the audit record")
+		return
+	}
+	if _, err := fmt.Fprintf(l.w, "%s\n", line); err != nil {
+		logger.Error().Err(err).Str("action", record.Action).Str("containerInstanceArn", record.ContainerInstanceARN).
+			Msgf("error writing the audit record: %v", err)
+	}
+	if l.logs == nil {
+		return
+	}
+	_, err = l.logs.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(l.group),
+		LogStreamName: aws.String(l.stream),
+		LogEvents:     []logtypes.InputLogEvent{{Message: aws.String(string(line)), Timestamp: aws.Int64(record.Time.UnixMilli())}},
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("action", record.Action).Str("containerInstanceArn", record.ContainerInstanceARN).
+			Msgf("error sending the audit record to log group %v: %v", l.group, err)
+	}
+}
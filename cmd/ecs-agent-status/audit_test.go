@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+type fakeCallerIdentifier struct {
+	calls int
+	err   error
+}
+
+func (f *fakeCallerIdentifier) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.GetCallerIdentityOutput{Arn: aws.String("arn:aws:sts::123456789012:assumed-role/ops/jane"), Account: aws.String("123456789012"), UserId: aws.String("AROAEXAMPLE:jane")}, nil
+}
+
+type fakeLogEventsPutter struct {
+	inputs []*cloudwatchlogs.PutLogEventsInput
+}
+
+func (f *fakeLogEventsPutter) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (f *fakeLogEventsPutter) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+func TestAuditLogRecord(t *testing.T) {
+	var buf bytes.Buffer
+	caller := &fakeCallerIdentifier{}
+	logs := &fakeLogEventsPutter{}
+	log := NewAuditLog(&buf, logs, "audit", "host/stream", map[string]CallerIdentifier{ScopeKey("", "us-east-1"): caller}, "ecs-agent-status drain prod i-0abc")
+	log.now = func() time.Time { return time.Date(2024, 5, 4, 10, 12, 40, 0, time.UTC) }
+	agent := agentstatus.Agent{Region: "us-east-1", Cluster: "prod", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/prod/1",
+		EC2InstanceID: "i-0abc", AgentStatus: "ACTIVE", RunningTasks: 2}
+	log.Record(context.Background(), NewAuditRecord(AuditDrain, agent, &AuditState{AgentStatus: "DRAINING"}, nil))
+	log.Record(context.Background(), NewAuditRecord(AuditDrain, agent, &AuditState{AgentStatus: "DRAINING"}, errors.New("access denied")))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Record() wrote %v lines, want 2: %s", len(lines), buf.String())
+	}
+	var first, second AuditRecord
+	if err := json.Unmarshal(lines[0], &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(lines[1], &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.Actor == nil || first.Actor.ARN != "arn:aws:sts::123456789012:assumed-role/ops/jane" || first.Command != "ecs-agent-status drain prod i-0abc" {
+		t.Errorf("Record() actor = %+v, command = %q", first.Actor, first.Command)
+	}
+	if first.Before == nil || first.Before.AgentStatus != "ACTIVE" || *first.Before.RunningTasks != 2 || first.After == nil || first.After.AgentStatus != "DRAINING" {
+		t.Errorf("Record() before = %+v, after = %+v", first.Before, first.After)
+	}
+	if second.Error != "access denied" || second.After != nil {
+		t.Errorf("Record() of a failed action: error = %q, after = %+v", second.Error, second.After)
+	}
+	if caller.calls != 1 {
+		t.Errorf("GetCallerIdentity called %v times, want once per scope", caller.calls)
+	}
+	if len(logs.inputs) != 2 || aws.ToString(logs.inputs[0].LogStreamName) != "host/stream" || aws.ToString(logs.inputs[0].LogEvents[0].Message) != string(lines[0]) {
+		t.Errorf("PutLogEvents inputs = %+v", logs.inputs)
+	}
+}
+
+func TestAuditLogRecordWithoutIdentity(t *testing.T) {
+	var buf bytes.Buffer
+	caller := &fakeCallerIdentifier{err: errors.New("expired token")}
+	log := NewAuditLog(&buf, nil, "", "", map[string]CallerIdentifier{ScopeKey("", "us-east-1"): caller}, "ecs-agent-status")
+	agent := agentstatus.Agent{Region: "us-east-1", Cluster: "prod", ContainerInstanceARN: "arn:1"}
+	log.Record(context.Background(), NewAuditRecord(AuditUpdateAgent, agent, &AuditState{AgentUpdateStatus: "UPDATED"}, nil))
+	log.Record(context.Background(), NewAuditRecord(AuditUpdateAgent, agent, &AuditState{AgentUpdateStatus: "UPDATED"}, nil))
+	var record AuditRecord
+	if err := json.Unmarshal(bytes.Split(buf.Bytes(), []byte("\n"))[0], &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Actor != nil || record.After.AgentUpdateStatus != "UPDATED" {
+		t.Errorf("Record() = %+v, want no actor", record)
+	}
+	if caller.calls != 1 {
+		t.Errorf("GetCallerIdentity called %v times, want the failure cached", caller.calls)
+	}
+
+	// A nil audit log, without --audit-log, records nothing
+	var none *AuditLog
+	none.Record(context.Background(), NewAuditRecord(AuditDrain, agent, nil, nil))
+}
+
+func TestAuditCommand(t *testing.T) {
+	args := []string{"ecs-agent-status", "check", "--remediate", "drain", "--pagerduty-routing-key", "R0UT1NG", "-slack-webhook-url=https://hooks.slack.com/services/T/B/X",
+		"--redact-key=s3cret", "--region", "us-east-1", "prod"}
+	want := "ecs-agent-status check --remediate drain --pagerduty-routing-key *** -slack-webhook-url=*** --redact-key=*** --region us-east-1 prod"
+	if got := auditCommand(args); got != want {
+		t.Errorf("auditCommand() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// InstanceCapacity is the registered and remaining CPU units and memory (MiB) of a container instance
+type InstanceCapacity struct {
+	ContainerInstanceARN string `json:"containerInstanceArn"`
+	InstanceID           string `json:"instanceId"`
+	AgentStatus          string `json:"agentStatus"`
+	RegisteredCPU        int32  `json:"registeredCpu"`
+	RemainingCPU         int32  `json:"remainingCpu"`
+	RegisteredMemory     int32  `json:"registeredMemory"`
+	RemainingMemory      int32  `json:"remainingMemory"`
+}
+
+// ClusterCapacity is the capacity of a cluster: the sums over its ACTIVE container instances, since tasks
+// are not placed on the others, and the remaining share of each as headroom
+type ClusterCapacity struct {
+	ClusterRef
+	Instances             int                `json:"instances"`
+	ActiveInstances       int                `json:"activeInstances"`
+	RegisteredCPU         int64              `json:"registeredCpu"`
+	RemainingCPU          int64              `json:"remainingCpu"`
+	RegisteredMemory      int64              `json:"registeredMemory"`
+	RemainingMemory       int64              `json:"remainingMemory"`
+	CPUHeadroomPercent    float64            `json:"cpuHeadroomPercent"`
+	MemoryHeadroomPercent float64            `json:"memoryHeadroomPercent"`
+	LowHeadroom           bool               `json:"lowHeadroom"`
+	ContainerInstances    []InstanceCapacity `json:"containerInstances"`
+}
+
+// headroomPercent returns remaining as a percentage of registered, or 0 without registered capacity
+func headroomPercent(remaining, registered int64) float64 {
+	if registered == 0 {
+		return 0
+	}
+	return float64(remaining) * 100 / float64(registered)
+}
+
+// ClusterCapacities returns the capacity of each checked cluster, in the order of checked. A cluster has
+// low headroom when less than minHeadroom percent of its CPU or memory remains; clusters without ACTIVE
+// container instances, e.g. Fargate-only ones, have no capacity to run short of and never do
+func ClusterCapacities(agents []agentstatus.Agent, checked []ClusterRef, minHeadroom float64) []ClusterCapacity {
+	byCluster := make(map[ClusterRef][]agentstatus.Agent)
+	for _, agent := range agents {
+		ref := ClusterRef{AccountID: agent.AccountID, Region: agent.Region, Cluster: agent.Cluster}
+		byCluster[ref] = append(byCluster[ref], agent)
+	}
+	capacities := make([]ClusterCapacity, 0, len(checked))
+	for _, ref := range checked {
+		capacity := ClusterCapacity{ClusterRef: ref, ContainerInstances: []InstanceCapacity{}}
+		for _, agent := range byCluster[ref] {
+			capacity.Instances++
+			capacity.ContainerInstances = append(capacity.ContainerInstances, InstanceCapacity{
+				ContainerInstanceARN: agent.ContainerInstanceARN,
+				InstanceID:           agent.InstanceID(),
+				AgentStatus:          agent.AgentStatus,
+				RegisteredCPU:        agent.RegisteredCPU,
+				RemainingCPU:         agent.RemainingCPU,
+				RegisteredMemory:     agent.RegisteredMemory,
+				RemainingMemory:      agent.RemainingMemory,
+			})
+			if agent.AgentStatus != "ACTIVE" {
+				continue
+			}
+			capacity.ActiveInstances++
+			capacity.RegisteredCPU += int64(agent.RegisteredCPU)
+			capacity.RemainingCPU += int64(agent.RemainingCPU)
+			capacity.RegisteredMemory += int64(agent.RegisteredMemory)
+			capacity.RemainingMemory += int64(agent.RemainingMemory)
+		}
+		capacity.CPUHeadroomPercent = headroomPercent(capacity.RemainingCPU, capacity.RegisteredCPU)
+		capacity.MemoryHeadroomPercent = headroomPercent(capacity.RemainingMemory, capacity.RegisteredMemory)
+		capacity.LowHeadroom = capacity.ActiveInstances > 0 &&
+			(capacity.CPUHeadroomPercent < minHeadroom || capacity.MemoryHeadroomPercent < minHeadroom)
+		capacities = append(capacities, capacity)
+	}
+	return capacities
+}
+
+// FormatClusterCapacity returns the text output line of a cluster's capacity
+func FormatClusterCapacity(capacity ClusterCapacity) string {
+	line := fmt.Sprintf("Region: %v, Cluster: %v, Instances: %v (%v ACTIVE), CPU: %v/%v remaining (%.1f%%), Memory: %v/%v remaining (%.1f%%)",
+		capacity.Region, capacity.Cluster, capacity.Instances, capacity.ActiveInstances, capacity.RemainingCPU, capacity.RegisteredCPU,
+		capacity.CPUHeadroomPercent, capacity.RemainingMemory, capacity.RegisteredMemory, capacity.MemoryHeadroomPercent)
+	if capacity.AccountID != "" {
+		line += fmt.Sprintf(", Account: %v", capacity.AccountID)
+	}
+	if capacity.LowHeadroom {
+		line += ", LOW HEADROOM"
+	}
+	return line
+}
+
+// WriteCapacity writes the capacity of the clusters to w in the --output format: text, with a line per
+// container instance under each cluster, table, with a row per cluster, or json
+func WriteCapacity(w io.Writer, capacities []ClusterCapacity, opts Options) error {
+	switch opts.Output {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "REGION\tCLUSTER\tINSTANCES\tACTIVE\tCPU REMAINING\tCPU REGISTERED\tCPU HEADROOM\tMEMORY REMAINING\tMEMORY REGISTERED\tMEMORY HEADROOM\tLOW")
+		for _, c := range capacities {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%.1f%%\t%v\t%v\t%.1f%%\t%v\n", c.Region, c.Cluster, c.Instances, c.ActiveInstances,
+				c.RemainingCPU, c.RegisteredCPU, c.CPUHeadroomPercent, c.RemainingMemory, c.RegisteredMemory, c.MemoryHeadroomPercent, c.LowHeadroom)
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(capacities)
+	}
+	for _, capacity := range capacities {
+		if _, err := fmt.Fprintln(w, FormatClusterCapacity(capacity)); err != nil {
+			return err
+		}
+		for _, instance := range capacity.ContainerInstances {
+			arn := instance.ContainerInstanceARN
+			if opts.FormatArn == "short" {
+				arn = shortArn(arn)
+			}
+			if _, err := fmt.Fprintf(w, "  ContainerInstanceARN: %v, InstanceID: %v, AgentStatus: %v, CPU: %v/%v, Memory: %v/%v\n", arn, instance.InstanceID,
+				instance.AgentStatus, instance.RemainingCPU, instance.RegisteredCPU, instance.RemainingMemory, instance.RegisteredMemory); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runCapacity prints the capacity of the matching clusters and returns the exit code: ExitUnhealthy when a
+// cluster has less than --min-headroom left
+func runCapacity(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	agents, checked, scanErrs, err := Scan(ctx, checkers, opts, nil)
+	if err != nil {
+		return scanErrorExitCode(ctx, err, opts)
+	}
+	capacities := ClusterCapacities(agents, checked, opts.MinHeadroom)
+	if err := WriteCapacity(os.Stdout, capacities, opts); err != nil {
+		logger.Error().Err(err).Msg("error writing output")
+		return ExitError
+	}
+	low := 0
+	for _, capacity := range capacities {
+		if capacity.LowHeadroom {
+			low++
+			logger.Warn().Str("region", capacity.Region).Str("cluster", capacity.Cluster).Float64("cpuHeadroomPercent", capacity.CPUHeadroomPercent).
+				Float64("memoryHeadroomPercent", capacity.MemoryHeadroomPercent).
+				Msgf("cluster %v has %.1f%% of its CPU and %.1f%% of its memory left, less than %v%%", capacity.Cluster, capacity.CPUHeadroomPercent, capacity.MemoryHeadroomPercent, opts.MinHeadroom)
+		}
+	}
+	switch {
+	case ctx.Err() != nil:
+		return cancelledExitCode(ctx, opts, fmt.Sprintf("after reporting the capacity of %v clusters", len(capacities)))
+	case low > 0:
+		return ExitUnhealthy
+	case len(scanErrs) > 0:
+		logger.Error().Int("errors", len(scanErrs)).Msgf("%v regions or clusters could not be checked", len(scanErrs))
+		return ExitPartial
+	}
+	return ExitHealthy
+}
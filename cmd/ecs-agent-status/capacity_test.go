@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestClusterCapacities(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", EC2InstanceID: "i-aaaa",
+			AgentStatus: "ACTIVE", RegisteredCPU: 2048, RemainingCPU: 256, RegisteredMemory: 4000, RemainingMemory: 2000},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb", EC2InstanceID: "i-bbbb",
+			AgentStatus: "DRAINING", RegisteredCPU: 2048, RemainingCPU: 2048, RegisteredMemory: 4000, RemainingMemory: 4000},
+		{Region: "us-east-1", Cluster: "api", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/api/cccc", EC2InstanceID: "i-cccc",
+			AgentStatus: "ACTIVE", RegisteredCPU: 1024, RemainingCPU: 512, RegisteredMemory: 2000, RemainingMemory: 1000},
+	}
+	checked := []ClusterRef{{Region: "us-east-1", Cluster: "api"}, {Region: "us-east-1", Cluster: "fargate"}, {Region: "us-east-1", Cluster: "web"}}
+	capacities := ClusterCapacities(agents, checked, 20)
+	if len(capacities) != 3 {
+		t.Fatalf("ClusterCapacities() = %+v, want a capacity per checked cluster", capacities)
+	}
+	api, fargate, web := capacities[0], capacities[1], capacities[2]
+	if api.CPUHeadroomPercent != 50 || api.MemoryHeadroomPercent != 50 || api.LowHeadroom {
+		t.Errorf("api = %+v, want 50%% headroom, not low", api)
+	}
+	if fargate.Instances != 0 || fargate.LowHeadroom {
+		t.Errorf("fargate = %+v, want no instances and no low headroom", fargate)
+	}
+	// The DRAINING instance is listed but its capacity is not counted
+	if web.Instances != 2 || web.ActiveInstances != 1 || web.RegisteredCPU != 2048 || web.CPUHeadroomPercent != 12.5 || !web.LowHeadroom {
+		t.Errorf("web = %+v, want the capacity of its ACTIVE instance only, with low CPU headroom", web)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCapacity(&buf, capacities[2:], Options{Output: "text", FormatArn: "short"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Region: us-east-1, Cluster: web, Instances: 2 (1 ACTIVE), CPU: 256/2048 remaining (12.5%), Memory: 2000/4000 remaining (50.0%), LOW HEADROOM\n" +
+		"  ContainerInstanceARN: aaaa, InstanceID: i-aaaa, AgentStatus: ACTIVE, CPU: 256/2048, Memory: 2000/4000\n" +
+		"  ContainerInstanceARN: bbbb, InstanceID: i-bbbb, AgentStatus: DRAINING, CPU: 2048/2048, Memory: 4000/4000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteCapacity() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// containerInstanceIDPattern matches the ID of a container instance: 32 hex digits, or a UUID for
+// container instances registered before the long ARN format
+var containerInstanceIDPattern = regexp.MustCompile(`^([0-9a-f]{32}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// isInstanceRef reports whether token names a container instance: a container instance ARN or ID, or an
+// EC2 or SSM managed instance ID
+func isInstanceRef(token string) bool {
+	if arn.IsARN(token) {
+		return strings.Contains(token, ":container-instance/")
+	}
+	return strings.HasPrefix(token, "i-") || strings.HasPrefix(token, "mi-") || containerInstanceIDPattern.MatchString(token)
+}
+
+// ReadInstanceIDs returns the container instance ARNs and IDs and the EC2 and SSM managed instance IDs in
+// r, in order and without duplicates. The input is split on whitespace, commas, quotes and brackets and
+// anything else is ignored, so the JSON and text output of aws ecs list-container-instances can be piped
+// in as well as one ARN per line
+func ReadInstanceIDs(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens := strings.FieldsFunc(string(data), func(c rune) bool {
+		return strings.ContainsRune(" \t\r\n,\"'[]{}", c)
+	})
+	var ids []string
+	for _, token := range tokens {
+		if isInstanceRef(token) && !slices.Contains(ids, token) {
+			ids = append(ids, token)
+		}
+	}
+	return ids, nil
+}
+
+// LoadInstanceIDs returns the container instances given to check-instances, reading them from stdin for
+// the argument -
+func LoadInstanceIDs(args []string) ([]string, error) {
+	var ids []string
+	for _, value := range args {
+		if value != "-" {
+			ids = append(ids, value)
+			continue
+		}
+		read, err := ReadInstanceIDs(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading stdin: %w", err)
+		}
+		if len(read) == 0 {
+			return nil, fmt.Errorf("no container instance ARNs or IDs on stdin")
+		}
+		ids = append(ids, read...)
+	}
+	return ids, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadInstanceIDs(t *testing.T) {
+	arn1 := "arn:aws:ecs:us-east-1:111111111111:container-instance/web/0123456789abcdef0123456789abcdef"
+	arn2 := "arn:aws:ecs:us-east-1:111111111111:container-instance/web/fedcba9876543210fedcba9876543210"
+	for name, input := range map[string]string{
+		"lines": arn1 + "\n" + arn2 + "\n" + arn1 + "\n",
+		"json":  `{"containerInstanceArns": ["` + arn1 + `", "` + arn2 + `"]}`,
+		"text":  "CONTAINERINSTANCEARNS\t" + arn1 + "\nCONTAINERINSTANCEARNS\t" + arn2 + "\n",
+	} {
+		got, err := ReadInstanceIDs(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{arn1, arn2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadInstanceIDs() of %v = %v, want %v", name, got, want)
+		}
+	}
+
+	got, err := ReadInstanceIDs(strings.NewReader("i-0abc, mi-0def 0123456789abcdef0123456789abcdef web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"i-0abc", "mi-0def", "0123456789abcdef0123456789abcdef"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadInstanceIDs() of IDs = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,822 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/mattn/go-isatty"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+	"github.com/rs/zerolog"
+)
+
+// scanCommands are the subcommands that scan clusters, or with instance, drain and prune look up container
+// instances, and install-events, which sets up the AWS account for them. Running the binary without a
+// subcommand runs check
+var scanCommands = []string{"check", "check-instances", "watch", "serve", "tui", "services", "update-agents", "instance", "drain", "prune", "clusters", "capacity", "install-events"}
+
+// commands are all the subcommands, in the order they are listed in the usage and completions
+var commands = append(append([]string{}, scanCommands...), "diff", "version", "completion")
+
+// platforms are the values of --platform
+var platforms = []string{"all", agentstatus.OSTypeLinux, agentstatus.OSTypeWindows}
+
+// completionShells are the shells the completion subcommand generates scripts for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// rawFlags holds the flag values that are converted or validated into Options after parsing
+type rawFlags struct {
+	region                      string
+	cluster                     string
+	regions                     string
+	instances                   string
+	logLevel                    string
+	configPath                  string
+	preset                      string
+	match                       string
+	clustersFile                string
+	failOn                      string
+	minDisconnect               time.Duration
+	policy                      string
+	schedule                    string
+	deepSchedule                string
+	redactKey                   string
+	tags                        stringList
+	clusterTags                 stringList
+	expectCount                 stringList
+	suppressWindow              stringList
+	noColor                     bool
+	noEC2Details                bool
+	groupByCluster              bool
+	redact                      bool
+	includeLifecycleTransitions bool
+}
+
+// notificationFlags adds the flags of the notifications sent by check and watch when agents are unhealthy
+func notificationFlags(fs *flag.FlagSet, opts *Options, raw *rawFlags) {
+	fs.StringVar(&opts.WebhookURL, "webhook-url", "", "POST a JSON summary of unhealthy agents to this URL, e.g. a Slack incoming webhook")
+	fs.StringVar(&opts.SlackWebhookURL, "slack-webhook-url", os.Getenv("SLACK_WEBHOOK_URL"), "post a summary of unhealthy agents to this Slack incoming webhook (default: $SLACK_WEBHOOK_URL)")
+	fs.StringVar(&opts.SNSTopicArn, "sns-topic-arn", "", "when unhealthy agents are found, publish a JSON summary of them to this SNS topic")
+	fs.StringVar(&opts.PagerDutyRoutingKey, "pagerduty-routing-key", os.Getenv("PAGERDUTY_ROUTING_KEY"), "trigger a PagerDuty alert per disconnected agent with this Events API v2 routing key, resolving it once the agent reconnects when --state-file is set (default: $PAGERDUTY_ROUTING_KEY)")
+	fs.Var(&raw.suppressWindow, "suppress-window", "maintenance window as [day] HH:MM-HH:MM [time zone], e.g. 'Sat 02:00-04:00 UTC', during which unhealthy agents are still reported but send no notifications and, with check, exit 0. Without a day it recurs daily. Repeat to set several")
+}
+
+// auditFlags adds the flags of the audit log of the commands that drain, terminate, replace, restart,
+// update or deregister container instances
+func auditFlags(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.AuditLog, "audit-log", "", "append a JSON line per drain, termination, replacement, agent restart, agent update or deregistration to this file, with the time, the command, the AWS identity that took the action and the state of the container instance before and after it")
+	fs.StringVar(&opts.AuditLogGroup, "audit-log-group", "", "also send the --audit-log records to a new log stream of this CloudWatch Logs group, in the region of the AWS config")
+}
+
+// recheckFlags adds the flags re-describing disconnected agents before they are reported, of the commands
+// that report or alert on unhealthy agents
+func recheckFlags(fs *flag.FlagSet, opts *Options) {
+	fs.IntVar(&opts.Recheck, "recheck", 0, "describe the container instances of disconnected agents again up to this many times before reporting them, so agents that reconnect, e.g. after an agent restart, are not reported unhealthy")
+	fs.DurationVar(&opts.RecheckInterval, "recheck-interval", 20*time.Second, "with --recheck, how long to wait before the first recheck, doubling before each next one")
+}
+
+// scheduleFlags adds the flags polling on cron schedules instead of every --interval, of serve and the
+// check daemon
+func scheduleFlags(fs *flag.FlagSet, raw *rawFlags, polls string) {
+	fs.StringVar(&raw.schedule, "schedule", "", "scan on this cron schedule, minute hour day-of-month month day-of-week in UTC or after CRON_TZ=<zone>, e.g. '*/5 * * * *', instead of every --interval"+polls)
+	fs.StringVar(&raw.deepSchedule, "deep-schedule", "", "with --schedule, only run full scans on this cron schedule, e.g. '0 * * * *'. The scans on --schedule in between describe the container instances found by the last full scan again, without listing the clusters or looking up the EC2 instances")
+}
+
+// NewFlagSet returns the flags of a scan command bound to opts and raw. The cluster selection and AWS flags
+// are shared by every scan command, and the instance selection and agent health flags by those checking
+// agents; the rest are specific to the command
+func NewFlagSet(command string, opts *Options, raw *rawFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.StringVar(&raw.match, "match", "substring", "how cluster name patterns are matched: substring, exact or regex")
+	fs.Var((*stringList)(&opts.Exclude), "exclude", "skip clusters matching this pattern, matched like the cluster name patterns with --match. Repeat or separate with commas to exclude several")
+	fs.StringVar(&raw.clustersFile, "clusters-file", "", "read the names or ARNs of the clusters to check from this file, one per line, or from stdin with -, instead of matching cluster name patterns")
+	fs.IntVar(&opts.MaxClusters, "max-clusters", 50, "abort if more than this many clusters match (0 = unlimited)")
+	fs.StringVar(&opts.ClusterCacheFile, "cluster-cache", "", "keep the ARNs of every cluster of each region in this JSON file, e.g. ~/.cache/ecs-agent-status/clusters.json, and match the cluster name patterns against it instead of listing the clusters again within --cluster-cache-ttl")
+	fs.DurationVar(&opts.ClusterCacheTTL, "cluster-cache-ttl", time.Hour, "how long the clusters in --cluster-cache are used before they are listed again")
+	fs.BoolVar(&opts.RefreshClusters, "refresh-clusters", false, "list the clusters again and rewrite --cluster-cache, however recently they were listed")
+	fs.Var(&raw.clusterTags, "cluster-tag", "only check clusters with this ECS tag, as key=value, found with DescribeClusters. Repeat or separate with commas to require several tags. Without cluster name patterns, every cluster with the tags is checked")
+	fs.BoolVar(&opts.IncludeInactive, "include-inactive", false, "also check and list the matched clusters that are not ACTIVE, e.g. INACTIVE or DEPROVISIONING ones, which are skipped by default")
+	fs.StringVar(&raw.region, "region", "", "AWS region to scan (default: $AWS_REGION or the region from the AWS config)")
+	fs.StringVar(&raw.regions, "regions", "", "comma-separated list of regions to scan, overriding --region")
+	fs.BoolVar(&opts.AllRegions, "all-regions", false, "scan every region enabled for the account (found with EC2 DescribeRegions), overriding --region and --regions")
+	fs.BoolVar(&opts.AllAccounts, "all-accounts", false, "scan every account in the accounts section of the config file concurrently, assuming each account's role")
+	fs.StringVar(&opts.Profile, "profile", "", "AWS shared config profile to use (default: $AWS_PROFILE or the default profile)")
+	fs.StringVar(&opts.EndpointURL, "endpoint-url", "", "call this endpoint for every AWS service instead of the AWS endpoints, e.g. http://localhost:4566 for LocalStack. AWS_ENDPOINT_URL_ECS and the other per-service variables take precedence")
+	fs.StringVar(&opts.AssumeRole.RoleARN, "role-arn", "", "IAM role to assume with STS before calling AWS, e.g. to check another account")
+	fs.StringVar(&opts.AssumeRole.ExternalID, "external-id", "", "external ID to pass when assuming --role-arn")
+	fs.StringVar(&opts.AssumeRole.SessionName, "session-name", agentstatus.DefaultRoleSessionName, "session name to use when assuming --role-arn")
+	fs.StringVar(&raw.configPath, "config", "", "YAML or JSON file of default flag values keyed by flag name (default ~/.ecs-agent-status.yaml)")
+	fs.StringVar(&raw.preset, "preset", "", "named preset from the presets section of the config file, supplying flag values and cluster name patterns")
+	fs.StringVar(&raw.logLevel, "log-level", "info", "log level: trace, debug, info, warn, error")
+	fs.BoolVar(&opts.Quiet, "quiet", false, "only report problems: print only unhealthy agents and log only warnings and errors, leaving the exit code to tell a healthy run")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "log at debug level, including every AWS API call with its duration and each page of clusters and container instances listed")
+	fs.BoolVar(&opts.ProfileAPIs, "profile-apis", false, "on exit, print the number of calls and the average, 95th percentile, maximum and total duration of each AWS API operation on stderr")
+	fs.BoolVar(&opts.Preflight, "preflight", false, "before the scan, log the AWS identity of the calls and check with the IAM policy simulator that it may call every operation the command needs, exiting 2 with the missing permissions listed instead of failing partway through")
+	fs.StringVar(&opts.LogFormat, "log-format", "", "log format: json or console (default: console when stderr is a terminal, json otherwise)")
+	fs.IntVar(&opts.Retry.MaxAttempts, "max-attempts", 10, "attempts per AWS API call, including the first, before a throttling or transient error fails it")
+	fs.DurationVar(&opts.Retry.MaxBackoff, "max-backoff", 20*time.Second, "maximum delay between attempts of an AWS API call; delays grow exponentially with jitter up to it")
+	fs.Float64Var(&opts.MaxAPIRate, "max-api-rate", 0, "maximum Describe API calls per second in each region, including retries (0 = unlimited)")
+	fs.StringVar(&opts.RecordFixtures, "record-fixtures", "", "write the raw response of every ECS, EC2 and Auto Scaling API call to a JSON fixture in this directory, for --replay-fixtures and regression tests")
+	fs.StringVar(&opts.ReplayFixtures, "replay-fixtures", "", "answer every API call with the fixture recorded in this directory by --record-fixtures instead of calling AWS")
+	fs.IntVar(&opts.Concurrency, "concurrency", 4, "number of clusters to check in parallel, across all regions and accounts")
+	fs.IntVar(&opts.ClusterWorkers, "cluster-workers", 2, "number of DescribeContainerInstances calls of a cluster, each of up to 100 container instances, made in parallel")
+	fs.IntVar(&opts.MaxInFlight, "max-in-flight", 8, "maximum Describe API calls in progress at once in each region, whatever --concurrency and --cluster-workers allow (0 = unlimited)")
+	fs.Int64Var(&opts.MaxAPICalls, "max-api-calls", 0, "maximum AWS API calls of the run, including retries, or of each poll of watch, serve, tui and --daemon. Calls beyond it fail, and the clusters they were for are reported as not checked (0 = unlimited)")
+	fs.DurationVar(&opts.Timeout, "timeout", 0, "abort the run after this long, e.g. 5m, reporting the agents gathered so far (0 = no limit). With watch, serve or tui it bounds each poll")
+	fs.StringVar(&opts.FormatArn, "format-arn", "short", "print container instance ARNs in text output as 'short' (last segment) or 'long' (full ARN)")
+	fs.BoolVar(&raw.noColor, "no-color", false, "disable colorized agent status and connectivity in text output (also disabled by NO_COLOR or when stdout is not a terminal)")
+	// The instance selection and agent health flags do not apply to services, given instances, pruning, the
+	// cluster inventory or installing the event rule
+	if !slices.Contains([]string{"services", "instance", "drain", "prune", "clusters", "install-events"}, command) {
+		fs.DurationVar(&opts.Since, "since", 0, "only report instances registered within this duration, e.g. 2h. ECS only exposes the registration time; instances without one are always included")
+		fs.DurationVar(&opts.MinAge, "min-age", 0, "leave out instances registered less than this long ago, e.g. 10m, which may still be bootstrapping. Instances without a registration time are always included")
+		fs.StringVar(&raw.instances, "instances", "", "comma-separated list of EC2 or SSM managed instance IDs, or container instance ARNs or IDs, to report (default: all instances)")
+		fs.StringVar(&opts.Filter, "filter", "", "cluster query language expression selecting the container instances to check, e.g. 'attribute:ecs.instance-type == c5.large'")
+		fs.StringVar(&opts.Platform, "platform", "all", "only check container instances of this operating system: linux, windows or all, from their ecs.os-type attribute")
+		fs.Var(&raw.tags, "tag", "only check instances whose EC2 instance has this tag, as key=value. Repeat or separate with commas to require several tags")
+		fs.BoolVar(&opts.ExcludeExternal, "exclude-external", false, "leave out external (ECS Anywhere) container instances, from the output and the health evaluation")
+		fs.Var(invertedBool{&opts.ExcludeExternal}, "include-external", "include external (ECS Anywhere) container instances (the default); --include-external=false is --exclude-external")
+		fs.BoolVar(&raw.noEC2Details, "no-ec2-details", false, "do not look up the instance type, availability zone, launch time, private IP, Auto Scaling group and lifecycle state of each EC2 instance")
+		fs.BoolVar(&raw.includeLifecycleTransitions, "include-lifecycle-transitions", false, "also fail the run on instances in an Auto Scaling warm pool or waiting in a Pending:Wait or Terminating:Wait lifecycle hook, whose agents are otherwise never unhealthy")
+		fs.StringVar(&opts.MinAgentVersion, "min-agent-version", "", "exit non-zero if any instance runs an ECS agent older than this version, e.g. 1.75.0")
+		fs.StringVar(&raw.failOn, "fail-on", "status", "comma-separated conditions that fail the run: status (not ACTIVE), disconnected (agent not connected), both, draining (DRAINING), stale-agent (older than --min-agent-version or drifting with --detect-version-drift) or below-capacity (fewer ACTIVE instances than --expect-count)")
+		fs.BoolVar(&opts.FailOnEmpty, "fail-on-empty", false, "report the matched clusters without container instances as clusters that could not be checked, including Fargate-only clusters, which are otherwise reported as N/A with no EC2 capacity")
+		fs.BoolVar(&opts.IncludeResources, "include-resources", false, "include remaining/registered CPU and memory in text output")
+	}
+
+	if command == "check-instances" {
+		fs.StringVar(&raw.cluster, "cluster", "", "name or ARN of the cluster of the container instances")
+	}
+
+	switch command {
+	case "services":
+		fs.StringVar(&opts.Output, "output", "text", "output format: text, table (aligned columns) or json (an array of services)")
+		fs.StringVar(&opts.OutputFile, "output-file", "", "write results to this path instead of stdout, creating parent directories and replacing the file atomically")
+		fs.BoolVar(&opts.AllowEmpty, "allow-empty", false, "exit 0 with a warning instead of failing when no clusters match")
+	case "clusters":
+		fs.StringVar(&opts.Output, "output", "text", "output format: text, table (aligned columns) or json (an array of clusters)")
+		fs.BoolVar(&opts.AllowEmpty, "allow-empty", false, "exit 0 with a warning instead of failing when no clusters match")
+	case "capacity":
+		fs.StringVar(&opts.Output, "output", "text", "output format: text (a line per cluster followed by a line per container instance), table (a row per cluster) or json (an array of clusters with their container instances)")
+		fs.Float64Var(&opts.MinHeadroom, "min-headroom", 10, "exit non-zero when a cluster has less than this percentage of the CPU or memory of its ACTIVE container instances remaining")
+		fs.BoolVar(&opts.AllowEmpty, "allow-empty", false, "exit 0 with a warning instead of failing when no clusters match")
+	case "instance":
+		fs.StringVar(&opts.Output, "output", "text", "output format: text (a line per field) or json (the agent object)")
+	case "drain":
+		fs.BoolVar(&opts.Wait, "wait", false, "after setting the instances to DRAINING, poll until none of them has running tasks, printing the progress. Exits non-zero if tasks are still running after --wait-timeout")
+		fs.DurationVar(&opts.WaitTimeout, "wait-timeout", 30*time.Minute, "with --wait, how long to wait for the tasks of the instances to stop")
+		auditFlags(fs, opts)
+	case "prune":
+		fs.BoolVar(&opts.DryRun, "dry-run", false, "log the container instances that would be deregistered without deregistering them")
+		fs.BoolVar(&opts.Yes, "yes", false, "deregister the container instances without asking for confirmation, e.g. in automation")
+		auditFlags(fs, opts)
+	case "install-events":
+		fs.StringVar(&opts.EventBus, "bus", "default", "name or ARN of the event bus receiving the ECS events")
+		fs.StringVar(&opts.EventTarget, "target", "", "ARN of the SNS topic or SQS queue to send the container instance state changes to, in the region of the rule")
+		fs.StringVar(&opts.EventRuleName, "rule-name", DefaultEventRuleName, "name of the EventBridge rule, created or updated")
+		fs.BoolVar(&opts.DryRun, "dry-run", false, "print the rule and its target as JSON without creating them")
+	case "update-agents":
+		fs.IntVar(&opts.BatchSize, "batch-size", 0, "update this many agents of a cluster at a time, waiting for each batch to be UPDATED before starting the next (0 = a whole cluster at once)")
+		fs.DurationVar(&opts.UpdateTimeout, "update-timeout", 15*time.Minute, "how long to wait for each batch of agent updates to finish before stopping the rollout")
+		auditFlags(fs, opts)
+		fs.BoolVar(&opts.DryRun, "dry-run", false, "log the agents that would be updated without updating them")
+		fs.BoolVar(&opts.AllowEmpty, "allow-empty", false, "exit 0 with a warning instead of failing when no clusters match")
+	case "watch":
+		fs.StringVar(&opts.Output, "output", "text", "output format: text or jsonl")
+		fs.BoolVar(&opts.LogAgents, "log-agents", false, "also log each new or changed agent as a structured event on stderr")
+		fs.DurationVar(&opts.Interval, "interval", 30*time.Second, "polling interval")
+		fs.Float64Var(&opts.Jitter, "jitter", 0.1, "wait up to this fraction of --interval longer before each poll, chosen at random, so that several watchers do not poll in step (0 = poll exactly every --interval)")
+		fs.DurationVar(&opts.MaxPollBackoff, "max-poll-backoff", 10*time.Minute, "after a failed poll, double the wait before the next one, up to this long, until a poll succeeds")
+		fs.BoolVar(&opts.NotifyOnChange, "notify-on-change", false, "only send the webhook, Slack, SNS and PagerDuty notifications after a poll on which an agent became unhealthy or recovered, instead of after every poll finding unhealthy agents")
+		notificationFlags(fs, opts, raw)
+		fs.DurationVar(&opts.ClusterRefreshInterval, "cluster-refresh-interval", 0, "list and match the clusters again only after this long, e.g. 10m, checking the same clusters on the polls in between (0 = list on every poll)")
+		recheckFlags(fs, opts)
+	case "serve":
+		fs.StringVar(&opts.Serve, "listen", ":9090", "address to serve Prometheus metrics, /status, /healthz and /readyz on")
+		fs.DurationVar(&opts.Interval, "interval", 30*time.Second, "how often the metrics are refreshed")
+		fs.DurationVar(&opts.ClusterRefreshInterval, "cluster-refresh-interval", 0, "list and match the clusters again only after this long, e.g. 10m, checking the same clusters on the polls in between (0 = list on every poll)")
+		recheckFlags(fs, opts)
+		scheduleFlags(fs, raw, "")
+		fs.StringVar(&opts.EventsQueue, "events-queue", "", "URL of an SQS queue receiving the container instance state changes of install-events, applied to the metrics as they arrive instead of at the next poll. The messages are deleted once read")
+	case "tui":
+		fs.DurationVar(&opts.Interval, "interval", 30*time.Second, "how often the dashboard is refreshed")
+		fs.DurationVar(&opts.ClusterRefreshInterval, "cluster-refresh-interval", 0, "list and match the clusters again only after this long, e.g. 10m, checking the same clusters on the refreshes in between (0 = list on every refresh)")
+		auditFlags(fs, opts)
+	default:
+		fs.StringVar(&opts.Output, "output", "text", "output format: text, table (aligned columns), csv (a header and a row per agent), tsv (a header and a tab-separated line per agent, in columns that do not change between minor versions, for scripts), json (an array of agents), yaml (the json output as YAML), jsonl (one JSON object per line, streamed per cluster), nagios (a Nagios/Icinga plugin status line with performance data, exiting 0 OK, 1 WARNING, 2 CRITICAL or 3 UNKNOWN), html (a standalone report with sortable tables) github (GitHub Actions error and warning annotations, and a job summary in $GITHUB_STEP_SUMMARY) or junit (a JUnit XML report with a test case per container instance), or a format registered with agentstatus.RegisterRenderer")
+		fs.StringVar(&opts.OutputFile, "output-file", "", "write results to this path instead of stdout, creating parent directories and replacing the file atomically")
+		fs.StringVar(&opts.OutputFile, "out", "", "same as --output-file")
+		fs.BoolVar(&opts.Daemon, "daemon", false, "keep running, scanning every --interval and atomically rewriting --output-file with the agents and their summary as JSON and --prom-file with their Prometheus metrics, e.g. for the node exporter's textfile collector")
+		fs.StringVar(&opts.PromFile, "prom-file", "", "with --daemon, the Prometheus textfile to write (default: --output-file with a .prom extension)")
+		fs.BoolVar(&opts.LogAgents, "log-agents", false, "also log each agent as a structured event on stderr, with its cluster, instance, status and connectivity")
+		fs.BoolVar(&opts.Progress, "progress", false, "draw a progress bar of the clusters checked, the instances described and the time left on stderr when it is a terminal, instead of logging the progress every 10s")
+		fs.BoolVar(&opts.ShowTasks, "show-tasks", false, "list the tasks placed on each container instance that is not ACTIVE or not connected, to see what draining it would affect")
+		fs.BoolVar(&opts.Summary, "summary", false, "print a line per cluster with its instance, ACTIVE, DRAINING and disconnected counts and agent versions instead of a line per agent. With --output json, add these as a summaries array")
+		fs.BoolVar(&opts.Report, "report", false, "with --output json or yaml, write a versioned report object with the schema and tool versions, generation time, accounts, regions, summary counts, a section per cluster, the agents and the errors instead of an array of agents")
+		fs.BoolVar(&opts.IncludeRaw, "include-raw", false, "with --output json, yaml or jsonl, embed the full DescribeContainerInstances item of each agent, with its attributes, resources and attachments, as raw")
+		fs.BoolVar(&opts.OnlyUnhealthy, "only-unhealthy", false, "only print agents that are not ACTIVE or not connected. The exit code and notifications still consider every agent")
+		fs.BoolVar(&raw.redact, "redact", false, "replace the account IDs, instance IDs and ARNs of the output with hashes of them, the same for the same value throughout the run, and leave out private IPs, so it can be shared, e.g. in a public issue. Logs and notifications are not redacted")
+		fs.StringVar(&raw.redactKey, "redact-key", "", "with --redact, hash with this secret instead of a random one, so the redacted output of runs using the same key can be diffed (implies --redact)")
+		fs.StringVar(&opts.StateFile, "state-file", "", "JSON file keeping the state of every container instance between runs, to report instances that disconnected, recovered, registered or deregistered since the previous run")
+		fs.DurationVar(&raw.minDisconnect, "min-disconnect-duration", 0, "with --state-file, only treat agents disconnected for at least this long, e.g. 5m, as unhealthy, ignoring blips such as agent updates. Agents count from the first run that saw them disconnected")
+		recheckFlags(fs, opts)
+		fs.StringVar(&raw.policy, "policy", "", "YAML file of named health rules, e.g. a minimum agent version, a maximum disconnect duration or a maximum percentage of DRAINING instances per cluster, each applying to every cluster or to those matching its patterns. The rules that fail are reported and fail the run")
+		fs.BoolVar(&opts.AllowEmpty, "allow-empty", false, "exit 0 with a warning instead of failing when no clusters match")
+		fs.Float64Var(&opts.FailThreshold, "fail-threshold", 0, "only exit non-zero when the percentage of unhealthy agents exceeds this value (default: any unhealthy agent fails)")
+		fs.Float64Var(&opts.FailThreshold, "max-unhealthy-percent", 0, "same as --fail-threshold")
+		fs.Var(&raw.expectCount, "expect-count", "exit non-zero when a checked cluster has fewer ACTIVE container instances than this, e.g. 3, or than the count given for it as cluster=count, e.g. web=6. Repeat or separate with commas to set several")
+		fs.IntVar(&opts.MaxUnhealthy, "max-unhealthy", 0, "only exit non-zero when more than this many agents are unhealthy. With --fail-threshold, both must be exceeded (default: any unhealthy agent fails)")
+		fs.StringVar(&opts.GroupBy, "group-by", "", "group output by cluster, az, capacity-provider, asg, os or a container instance attribute as attribute:<name>, e.g. attribute:stack: a header line per group in text mode, an object keyed by group name in json and jsonl modes. With --summary, the clusters of each group are summarized apart")
+		fs.Var((*stringList)(&opts.ShowAttributes), "show-attributes", "print these container instance attributes of each agent, e.g. custom attributes such as stack or built-in ones such as ecs.ami-id or ecs.availability-zone. Repeat or separate with commas")
+		fs.StringVar(&opts.Sort, "sort", "", "order the agents in the output by status (unhealthy first), cluster, instance-id or agent-version (oldest first). Groups of --group-by are ordered by their first agent (default: by account, region, cluster and instance ID)")
+		fs.Var((*stringList)(&opts.Fields), "fields", "with --output table, csv, json, yaml or jsonl, only write these agent fields, in this order, named as in the json output, e.g. cluster,ec2InstanceId,agentStatus,agentVersion. Repeat or separate with commas (default: all fields)")
+		fs.BoolVar(&raw.groupByCluster, "group-by-cluster", false, "same as --group-by cluster")
+		fs.BoolVar(&opts.DetectVersionDrift, "detect-version-drift", false, "mark instances whose ECS agent or Docker version differs from the fleet majority")
+		fs.BoolVar(&opts.FailOnVersionDrift, "fail-on-version-drift", false, "exit non-zero if any instance's ECS agent version differs from the fleet majority (implies --detect-version-drift)")
+		fs.BoolVar(&opts.FailOnDockerDrift, "fail-on-docker-drift", false, "exit non-zero if any instance's Docker version differs from the fleet majority (implies --detect-version-drift)")
+		fs.BoolVar(&opts.DetectLaunchTemplateDrift, "detect-launch-template-drift", false, "mark instances not launched from the current launch template version of their Auto Scaling group, e.g. left behind by a failed instance refresh")
+		fs.BoolVar(&opts.FailOnLaunchTemplateDrift, "fail-on-launch-template-drift", false, "exit non-zero if any instance does not run the current launch template version of its Auto Scaling group (implies --detect-launch-template-drift)")
+		fs.BoolVar(&opts.DetectDuplicates, "detect-duplicates", false, "mark instances registered as more than one container instance, in one cluster or across the scanned clusters, e.g. a stale registration left behind by user data registering the instance again")
+		fs.BoolVar(&opts.FailOnDuplicates, "fail-on-duplicates", false, "exit non-zero if any instance is registered as more than one container instance (implies --detect-duplicates)")
+		notificationFlags(fs, opts, raw)
+		fs.BoolVar(&opts.NotifyAlways, "notify-always", false, "send notifications after every run, including a summary when all agents are healthy")
+		fs.Var((*stringList)(&opts.EmailTo), "email-to", "after every run, email the summary and the unhealthy agents to this address through SES. Repeat or separate with commas to send to several")
+		fs.StringVar(&opts.SESFrom, "ses-from", "", "sender address of --email-to, a verified SES identity")
+		fs.StringVar(&opts.SESRegion, "ses-region", "", "region of the SES identity of --ses-from (default: the region from the AWS config)")
+		fs.BoolVar(&opts.EmailAttachHTML, "email-attach-html", false, "attach the --output html report to the --email-to email")
+		fs.Var((*stringList)(&opts.Sinks), "sink", "after the run, write a JSON record per cluster to s3://bucket/prefix/ or dynamodb://table, optionally with ?region=. Repeat to write to several")
+		fs.BoolVar(&opts.PublishCloudWatch, "publish-cloudwatch", false, "publish per-cluster counts of ACTIVE, DRAINING and disconnected agents to CloudWatch after the run")
+		fs.StringVar(&opts.Namespace, "namespace", "ECS/AgentStatus", "CloudWatch namespace for --publish-cloudwatch")
+		fs.StringVar(&opts.Remediate, "remediate", "", "remediate container instances with disconnected agents: drain (set to DRAINING), terminate (drain, then terminate the EC2 instance once its tasks have stopped) or asg-replace (drain, then mark the instance unhealthy so its Auto Scaling group replaces it, after asking for confirmation)")
+		fs.BoolVar(&opts.Yes, "yes", false, "with --remediate asg-replace, replace the instances without asking for confirmation, e.g. in automation")
+		fs.BoolVar(&opts.DryRun, "dry-run", false, "print the clusters, regions and accounts that would be scanned and the AWS API operations that would be called, without describing any cluster. With --remediate, scan and log the actions that would be taken without taking them")
+		fs.DurationVar(&opts.DrainTimeout, "drain-timeout", 10*time.Minute, "with --remediate terminate, how long to wait for each cluster's instances to drain")
+		fs.BoolVar(&opts.Wait, "wait", false, "poll until every matched container instance's agent is ACTIVE and connected, logging the progress, then report them. Exits non-zero if they are not by --wait-timeout")
+		fs.DurationVar(&opts.WaitTimeout, "wait-timeout", 10*time.Minute, "with --wait, how long to wait for every agent to be ACTIVE and connected")
+		fs.BoolVar(&opts.CheckSSM, "check-ssm", false, "look up the ping status of each instance in SSM (Online, ConnectionLost, Inactive or NotRegistered), to tell an ECS agent that disconnected on a running instance from an instance that is unreachable")
+		fs.BoolVar(&opts.FetchAgentLogs, "fetch-agent-logs", false, "read the last lines of the ECS agent log of each disconnected agent from CloudWatch Logs and print them under the agent")
+		fs.StringVar(&opts.AgentLogGroup, "agent-log-group", defaultAgentLogGroup, "with --fetch-agent-logs, the log group the instances ship /var/log/ecs/ecs-agent.log to, with a log stream per instance named after its instance ID")
+		fs.IntVar(&opts.AgentLogLines, "agent-log-lines", 20, "with --fetch-agent-logs, how many lines of each agent log to read (at most 10000)")
+		fs.BoolVar(&opts.RestartAgent, "restart-agent", false, "restart disconnected ECS agents with SSM Run Command (systemctl restart ecs, or Restart-Service AmazonECS on Windows), wait for the command and re-check the agents before reporting")
+		auditFlags(fs, opts)
+		fs.DurationVar(&opts.Interval, "interval", 30*time.Second, "with --daemon, how often the clusters are scanned")
+		scheduleFlags(fs, raw, ", with --daemon")
+		fs.StringVar(&opts.EventsQueue, "events-queue", "", "with --daemon, URL of an SQS queue receiving the container instance state changes of install-events, applied to the files as they arrive instead of at the next scan. The messages are deleted once read")
+		// Kept so invocations from before the watch and serve subcommands keep working
+		fs.BoolVar(&opts.Watch, "watch", false, "deprecated: use the watch command")
+		fs.StringVar(&opts.Serve, "serve", "", "deprecated: use the serve command")
+	}
+	fs.Usage = func() {
+		if command == "instance" {
+			fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status instance [flags] <cluster> <container instance ARN or ID | EC2 instance ID>")
+			fs.PrintDefaults()
+			return
+		}
+		if command == "drain" {
+			fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status drain [flags] <cluster> <container instance ARN or ID | EC2 instance ID>...")
+			fs.PrintDefaults()
+			return
+		}
+		if command == "prune" {
+			fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status prune [flags] <cluster>")
+			fs.PrintDefaults()
+			return
+		}
+		if command == "check-instances" {
+			fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status check-instances [flags] --cluster <cluster> <container instance ARN or ID | EC2 instance ID>... | -")
+			fs.PrintDefaults()
+			return
+		}
+		if command == "clusters" {
+			fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status clusters [flags] [cluster name pattern]...")
+			fs.PrintDefaults()
+			return
+		}
+		if command == "install-events" {
+			fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status install-events [flags] --target <SNS topic or SQS queue ARN>")
+			fs.PrintDefaults()
+			return
+		}
+		fmt.Fprintf(fs.Output(), "Usage: ecs-agent-status %v [flags] <cluster name pattern>...\n", command)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// stringList is a flag that can be repeated, and whose values are also split on commas
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, strings.Split(value, ",")...)
+	return nil
+}
+
+// ParseTags parses key=value tag filters into a map
+func ParseTags(tags []string) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string)
+	for _, tag := range tags {
+		key, value, found := strings.Cut(tag, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid tag filter %q: must be key=value", tag)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// invertedBool is a boolean flag that sets the negation of its value, for flags that have an opposite
+type invertedBool struct{ p *bool }
+
+func (b invertedBool) String() string {
+	if b.p == nil {
+		return "true"
+	}
+	return strconv.FormatBool(!*b.p)
+}
+
+func (b invertedBool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*b.p = !v
+	return nil
+}
+
+func (b invertedBool) IsBoolFlag() bool { return true }
+
+// flagNames returns the sorted names of the flags of a scan command
+func flagNames(command string) []string {
+	var names []string
+	NewFlagSet(command, &Options{}, &rawFlags{}).VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	sort.Strings(names)
+	return names
+}
+
+// usage prints the commands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ecs-agent-status <command> [flags] <cluster name pattern>...")
+	fmt.Fprintln(w, "\nCommands:")
+	fmt.Fprintln(w, "  check            check the agents once and exit non-zero if any are unhealthy (the default)")
+	fmt.Fprintln(w, "  check-instances  check the given container instances of one cluster, read from stdin with -")
+	fmt.Fprintln(w, "  watch            keep polling and print agents whose state changed")
+	fmt.Fprintln(w, "  serve            serve the agent status as Prometheus metrics")
+	fmt.Fprintln(w, "  tui              show a live dashboard of the clusters and instances, to drill into, drain or copy instances")
+	fmt.Fprintln(w, "  services         check that the services in the clusters run their desired number of tasks")
+	fmt.Fprintln(w, "  update-agents    update the outdated ECS agents of the clusters, a batch at a time")
+	fmt.Fprintln(w, "  clusters         list the clusters with their instance, task and service counts and capacity providers")
+	fmt.Fprintln(w, "  capacity         report the registered and remaining CPU and memory of the clusters and their instances")
+	fmt.Fprintln(w, "  instance         show the details of one container instance, by ARN or EC2 instance ID")
+	fmt.Fprintln(w, "  drain            set container instances to DRAINING and optionally wait for their tasks to stop")
+	fmt.Fprintln(w, "  prune            deregister the container instances of a cluster whose EC2 instance no longer exists")
+	fmt.Fprintln(w, "  install-events   create the EventBridge rule sending container instance state changes, e.g. disconnects, to SNS or SQS")
+	fmt.Fprintln(w, "  diff             compare two JSON outputs and print the instances added, removed or changed")
+	fmt.Fprintln(w, "  version          print the version, commit, build date and Go and AWS SDK versions")
+	fmt.Fprintln(w, "  completion       print a shell completion script: bash, zsh or fish")
+	fmt.Fprintln(w, "\nRun 'ecs-agent-status <command> -h' for the flags of a command.")
+}
+
+// GetInput parses the subcommand and its flags and returns them with the positional arguments to be used as
+// the patterns to match cluster names. The diff, version and completion commands print their output and exit
+func GetInput() Options {
+	args := os.Args[1:]
+	command := "check"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		for _, name := range commands {
+			if args[0] == name {
+				command, args = name, args[1:]
+				break
+			}
+		}
+	}
+	if len(args) > 0 && command == "check" && len(os.Args) == len(args)+1 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		usage(os.Stdout)
+		os.Exit(ExitHealthy)
+	}
+
+	switch command {
+	case "diff":
+		os.Exit(RunDiff(os.Stdout, args))
+	case "version":
+		os.Exit(RunVersion(os.Stdout, args))
+	case "completion":
+		if len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "Usage: ecs-agent-status completion <%v>\n", strings.Join(completionShells, "|"))
+			os.Exit(ExitError)
+		}
+		if err := WriteCompletion(os.Stdout, args[0]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(ExitError)
+		}
+		os.Exit(ExitHealthy)
+	}
+
+	opts, err := ParseScanArgs(command, args)
+	if errors.Is(err, errNoPatterns) {
+		usage(os.Stderr)
+		os.Exit(ExitError)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitError)
+	}
+	return opts
+}
+
+// errNoPatterns is returned when no cluster name pattern is given
+var errNoPatterns = errors.New("no cluster name pattern given")
+
+// ParseScanArgs parses the flags and patterns of a scan command, fills in the flags that were not given from
+// the config file and validates the result
+func ParseScanArgs(command string, args []string) (Options, error) {
+	var opts Options
+	var raw rawFlags
+	fs := NewFlagSet(command, &opts, &raw)
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	// Fill in the flags that were not given on the command line from the preset and the config file. Keys
+	// for the flags of the other commands are expected in a shared file, so only keys unknown to every
+	// command are reported
+	path, required := raw.configPath, true
+	if path == "" {
+		path, required = DefaultConfigPath(), raw.preset != ""
+	}
+	var presetPatterns []string
+	if path != "" {
+		config, err := LoadConfigFile(path, required)
+		if err != nil {
+			return opts, fmt.Errorf("error reading config file: %w", err)
+		}
+		known := make(map[string]bool)
+		for _, name := range scanCommands {
+			for _, flagName := range flagNames(name) {
+				known[flagName] = true
+			}
+		}
+		patterns, warnings, err := config.Apply(fs, raw.preset, known)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", warning)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("error reading config file: %w", err)
+		}
+		presetPatterns = patterns
+		opts.Accounts = config.Accounts
+		opts.Notifiers = config.Notifiers
+	} else if raw.preset != "" {
+		return opts, fmt.Errorf("--preset %q needs a config file: the home directory is unknown, use --config", raw.preset)
+	}
+
+	// Every positional argument is a cluster name pattern, replacing the preset's patterns. --clusters-file
+	// replaces both with the exact clusters to check
+	opts.ClusterPatterns = fs.Args()
+	if len(opts.ClusterPatterns) == 0 {
+		opts.ClusterPatterns = presetPatterns
+	}
+	if command == "check-instances" {
+		// The cluster is checked by its exact name, like a --clusters-file entry, and the arguments are the
+		// container instances to report
+		if raw.cluster == "" || len(fs.Args()) == 0 {
+			return opts, errors.New("check-instances needs --cluster and container instance ARNs or IDs, or - to read them from stdin")
+		}
+		if raw.clustersFile != "" || raw.instances != "" {
+			return opts, errors.New("check-instances takes the cluster from --cluster and the instances as arguments, not --clusters-file or --instances")
+		}
+		ids, err := LoadInstanceIDs(fs.Args())
+		if err != nil {
+			return opts, err
+		}
+		opts.ClusterNames, opts.ClusterPatterns, opts.Instances = []string{raw.cluster}, []string{raw.cluster}, ids
+	}
+	if raw.clustersFile != "" && command != "instance" && command != "drain" && command != "prune" && command != "check-instances" {
+		if len(fs.Args()) > 0 || len(opts.Exclude) > 0 {
+			return opts, errors.New("--clusters-file lists the clusters to check and cannot be combined with cluster name patterns or --exclude")
+		}
+		names, err := LoadClusterNames(raw.clustersFile)
+		if err != nil {
+			return opts, fmt.Errorf("error reading --clusters-file %v: %w", raw.clustersFile, err)
+		}
+		opts.ClusterNames, opts.ClusterPatterns = names, names
+	}
+	if len(opts.ClusterPatterns) == 0 && (command == "clusters" || (len(raw.clusterTags) > 0 && command != "instance" && command != "drain" && command != "prune")) {
+		// The inventory lists every cluster by default, and --cluster-tag selects the clusters by tag; the
+		// empty substring matches every name
+		opts.ClusterPatterns = []string{""}
+	}
+	if command == "install-events" {
+		// The rule covers every cluster of the region
+		if len(fs.Args()) > 0 {
+			return opts, errors.New("install-events takes no cluster name patterns: its rule covers every cluster of the region")
+		}
+		opts.ClusterPatterns, opts.InstallEvents = []string{""}, true
+	}
+	if len(opts.ClusterPatterns) == 0 {
+		return opts, errNoPatterns
+	}
+	if command == "instance" {
+		// The cluster is a name, not a pattern, and the second argument is the instance to look up
+		if len(fs.Args()) != 2 {
+			return opts, errors.New("instance needs a cluster and a container instance ARN, ID or EC2 instance ID")
+		}
+		opts.ClusterPatterns, opts.ContainerInstance = fs.Args()[:1], fs.Args()[1]
+	}
+	if command == "drain" {
+		if len(fs.Args()) < 2 {
+			return opts, errors.New("drain needs a cluster and at least one container instance ARN, ID or EC2 instance ID")
+		}
+		opts.ClusterPatterns, opts.DrainInstances = fs.Args()[:1], fs.Args()[1:]
+	}
+	if command == "prune" {
+		// The cluster is a name, not a pattern
+		if len(fs.Args()) != 1 {
+			return opts, errors.New("prune needs exactly one cluster")
+		}
+		opts.Prune = true
+	}
+	switch command {
+	case "watch":
+		opts.Watch = true
+	case "services":
+		opts.Services = true
+	case "update-agents":
+		opts.UpdateAgents = true
+	case "clusters":
+		opts.ListClusters = true
+	case "capacity":
+		opts.Capacity = true
+	case "tui":
+		opts.TUI = true
+	}
+	if opts.FailOnVersionDrift || opts.FailOnDockerDrift {
+		opts.DetectVersionDrift = true
+	}
+	if opts.FailOnLaunchTemplateDrift {
+		opts.DetectLaunchTemplateDrift = true
+	}
+	if opts.FailOnDuplicates {
+		opts.DetectDuplicates = true
+	}
+	if opts.LogFormat == "" {
+		opts.LogFormat = "json"
+		if isatty.IsTerminal(os.Stderr.Fd()) {
+			opts.LogFormat = "console"
+		}
+	}
+	var err error
+	if opts.LogLevel, err = zerolog.ParseLevel(raw.logLevel); err != nil {
+		return opts, fmt.Errorf("invalid --log-level %q: %w", raw.logLevel, err)
+	}
+	if opts.Quiet {
+		opts.LogLevel = max(opts.LogLevel, zerolog.WarnLevel)
+		opts.OnlyUnhealthy = true
+	}
+	if opts.Verbose {
+		opts.LogLevel = min(opts.LogLevel, zerolog.DebugLevel)
+	}
+	if opts.Match, err = agentstatus.ParseMatchMode(raw.match); err != nil {
+		return opts, fmt.Errorf("invalid --match: %w", err)
+	}
+	if !opts.Services && !opts.ListClusters && opts.ContainerInstance == "" && len(opts.DrainInstances) == 0 && !opts.Prune && !opts.InstallEvents {
+		if opts.HealthPolicy, opts.FailOnBelowCapacity, err = ParseFailOn(raw.failOn); err != nil {
+			return opts, fmt.Errorf("invalid --fail-on %q: %w", raw.failOn, err)
+		}
+		opts.HealthPolicy.MinDisconnectDuration = raw.minDisconnect
+		opts.HealthPolicy.IncludeLifecycleTransitions = raw.includeLifecycleTransitions
+		// Without --fail-on, outdated agents and capacity shortfalls fail the run as they did before it
+		// listed them
+		failOnSet := false
+		fs.Visit(func(f *flag.Flag) { failOnSet = failOnSet || f.Name == "fail-on" })
+		if !failOnSet {
+			opts.FailOnOutdated, opts.FailOnBelowCapacity = true, true
+		}
+	}
+	if opts.SuppressWindows, err = ParseSuppressWindows(raw.suppressWindow); err != nil {
+		return opts, fmt.Errorf("invalid --suppress-window: %w", err)
+	}
+	if opts.ExpectCount, err = ParseExpectedCounts(raw.expectCount); err != nil {
+		return opts, fmt.Errorf("invalid --expect-count: %w", err)
+	}
+	if raw.policy != "" {
+		if opts.Policy, err = LoadPolicy(raw.policy); err != nil {
+			return opts, fmt.Errorf("invalid --policy %v: %w", raw.policy, err)
+		}
+	}
+	if raw.schedule != "" {
+		if opts.Schedule, err = ParseCronSchedule(raw.schedule); err != nil {
+			return opts, fmt.Errorf("invalid --schedule: %w", err)
+		}
+	}
+	if raw.deepSchedule != "" {
+		if opts.DeepSchedule, err = ParseCronSchedule(raw.deepSchedule); err != nil {
+			return opts, fmt.Errorf("invalid --deep-schedule: %w", err)
+		}
+	}
+	if raw.redact || raw.redactKey != "" {
+		opts.Redactor = NewRedactor(raw.redactKey)
+	}
+	if opts.Tags, err = ParseTags(raw.tags); err != nil {
+		return opts, fmt.Errorf("invalid --tag: %w", err)
+	}
+	if opts.ClusterTags, err = ParseTags(raw.clusterTags); err != nil {
+		return opts, fmt.Errorf("invalid --cluster-tag: %w", err)
+	}
+	opts.Color = UseColor(raw.noColor) && opts.OutputFile == ""
+	if opts.Daemon && opts.PromFile == "" && opts.OutputFile != "" {
+		opts.PromFile = DefaultPromFile(opts.OutputFile)
+	}
+	opts.EC2Details = !raw.noEC2Details
+	if raw.groupByCluster {
+		if opts.GroupBy != "" && opts.GroupBy != "cluster" {
+			return opts, fmt.Errorf("--group-by-cluster cannot be combined with --group-by %v", opts.GroupBy)
+		}
+		opts.GroupBy = "cluster"
+	}
+	if name, ok := strings.CutPrefix(opts.GroupBy, groupByAttribute); ok && name != "" && !slices.Contains(opts.ShowAttributes, name) {
+		opts.ShowAttributes = append(opts.ShowAttributes, name)
+	}
+	if raw.instances != "" {
+		opts.Instances = strings.Split(raw.instances, ",")
+	}
+	switch {
+	case raw.regions != "":
+		opts.Regions = strings.Split(raw.regions, ",")
+	case raw.region != "":
+		opts.Regions = []string{raw.region}
+	}
+
+	return opts, ValidateOptions(opts)
+}
+
+// ValidateOptions checks the values and combinations of options that the flag types cannot
+func ValidateOptions(opts Options) error {
+	switch {
+	case opts.FormatArn != "short" && opts.FormatArn != "long":
+		return fmt.Errorf("invalid --format-arn %q: must be short or long", opts.FormatArn)
+	case opts.Serve == "" && !opts.UpdateAgents && len(opts.DrainInstances) == 0 && !opts.Prune && !opts.InstallEvents && !slices.Contains(outputFormats(), opts.Output):
+		return fmt.Errorf("invalid --output %q: must be %v", opts.Output, strings.Join(outputFormats(), ", "))
+	case opts.LogFormat != "json" && opts.LogFormat != "console":
+		return fmt.Errorf("invalid --log-format %q: must be json or console", opts.LogFormat)
+	case opts.GroupBy != "" && groupByLabel(opts.GroupBy) == "":
+		return fmt.Errorf("invalid --group-by %q: must be cluster, az, capacity-provider, asg, os or attribute:<name>", opts.GroupBy)
+	case opts.Platform != "" && !slices.Contains(platforms, opts.Platform):
+		return fmt.Errorf("invalid --platform %q: must be %v", opts.Platform, strings.Join(platforms, ", "))
+	case opts.FetchAgentLogs && (opts.AgentLogLines < 1 || opts.AgentLogLines > 10000):
+		return fmt.Errorf("invalid --agent-log-lines %v: must be from 1 to 10000", opts.AgentLogLines)
+	case opts.EndpointURL != "" && !isHTTPURL(opts.EndpointURL):
+		return fmt.Errorf("invalid --endpoint-url %q: must be an http or https URL", opts.EndpointURL)
+	case opts.HealthPolicy.MinDisconnectDuration < 0:
+		return fmt.Errorf("invalid --min-disconnect-duration %v: must not be negative", opts.HealthPolicy.MinDisconnectDuration)
+	case opts.HealthPolicy.MinDisconnectDuration > 0 && opts.StateFile == "":
+		return errors.New("--min-disconnect-duration needs --state-file to know how long agents have been disconnected")
+	case opts.Policy.DisconnectDurations() && opts.StateFile == "":
+		return errors.New("the max-disconnect-duration rules of --policy need --state-file to know how long agents have been disconnected")
+	case opts.Recheck < 0:
+		return fmt.Errorf("invalid --recheck %v: must not be negative", opts.Recheck)
+	case opts.Recheck > 0 && opts.RecheckInterval <= 0:
+		return fmt.Errorf("invalid --recheck-interval %v: must be positive", opts.RecheckInterval)
+	case opts.RecordFixtures != "" && opts.ReplayFixtures != "":
+		return errors.New("--record-fixtures cannot be combined with --replay-fixtures")
+	case opts.RefreshClusters && opts.ClusterCacheFile == "":
+		return errors.New("--refresh-clusters needs --cluster-cache")
+	case opts.ClusterCacheFile != "" && opts.ClusterCacheTTL <= 0:
+		return fmt.Errorf("invalid --cluster-cache-ttl %v: must be positive", opts.ClusterCacheTTL)
+	case opts.Sort != "" && !slices.Contains(sortKeys, opts.Sort):
+		return fmt.Errorf("invalid --sort %q: must be %v", opts.Sort, strings.Join(sortKeys, ", "))
+	case opts.Services && opts.Output != "text" && opts.Output != "table" && opts.Output != "json":
+		return fmt.Errorf("invalid --output %q: services supports text, table or json", opts.Output)
+	case opts.ListClusters && opts.Output != "text" && opts.Output != "table" && opts.Output != "json":
+		return fmt.Errorf("invalid --output %q: clusters supports text, table or json", opts.Output)
+	case opts.Capacity && opts.Output != "text" && opts.Output != "table" && opts.Output != "json":
+		return fmt.Errorf("invalid --output %q: capacity supports text, table or json", opts.Output)
+	case opts.Capacity && (opts.MinHeadroom < 0 || opts.MinHeadroom > 100):
+		return fmt.Errorf("invalid --min-headroom %v: must be from 0 to 100", opts.MinHeadroom)
+	case opts.ContainerInstance != "" && opts.Output != "text" && opts.Output != "json":
+		return fmt.Errorf("invalid --output %q: instance supports text or json", opts.Output)
+	case opts.Summary && opts.Output != "text" && opts.Output != "table" && opts.Output != "json" && opts.Output != "yaml":
+		return fmt.Errorf("--summary supports --output text, table, json or yaml, not %v", opts.Output)
+	case opts.Report && opts.Output != "json" && opts.Output != "yaml":
+		return fmt.Errorf("--report supports --output json or yaml, not %v", opts.Output)
+	case opts.IncludeRaw && opts.Output != "json" && opts.Output != "yaml" && opts.Output != "jsonl":
+		return fmt.Errorf("--include-raw supports --output json, yaml or jsonl, not %v", opts.Output)
+	case len(opts.Fields) > 0 && !slices.Contains([]string{"table", "csv", "json", "yaml", "jsonl"}, opts.Output):
+		return fmt.Errorf("--fields supports --output table, csv, json, yaml or jsonl, not %v", opts.Output)
+	case len(opts.Fields) > 0 && opts.Report:
+		return errors.New("--report has a fixed schema and cannot be used with --fields")
+	case ValidateFields(opts.Fields) != nil:
+		return ValidateFields(opts.Fields)
+	case opts.Report && opts.Summary:
+		return errors.New("--report already has the per-cluster counts and cannot be used with --summary")
+	case opts.Remediate != "" && opts.Remediate != "drain" && opts.Remediate != "terminate" && opts.Remediate != "asg-replace":
+		return fmt.Errorf("invalid --remediate %q: must be drain, terminate or asg-replace", opts.Remediate)
+	case (opts.Remediate != "" || opts.RestartAgent) && (opts.Watch || opts.Serve != "" || opts.Daemon):
+		return errors.New("--remediate and --restart-agent cannot be used with --watch, --serve or --daemon")
+	case opts.AssumeRole.RoleARN != "" && !arn.IsARN(opts.AssumeRole.RoleARN):
+		return fmt.Errorf("invalid --role-arn %q: must be an IAM role ARN", opts.AssumeRole.RoleARN)
+	case len(opts.Tags) > 0 && !opts.EC2Details:
+		return errors.New("--tag needs the EC2 instance details and cannot be used with --no-ec2-details")
+	case opts.Retry.MaxAttempts < 1:
+		return fmt.Errorf("invalid --max-attempts %v: must be at least 1", opts.Retry.MaxAttempts)
+	case opts.MaxAPIRate < 0:
+		return fmt.Errorf("invalid --max-api-rate %v: must not be negative", opts.MaxAPIRate)
+	case opts.MaxInFlight < 0:
+		return fmt.Errorf("invalid --max-in-flight %v: must not be negative", opts.MaxInFlight)
+	case opts.ClusterWorkers < 0:
+		return fmt.Errorf("invalid --cluster-workers %v: must not be negative", opts.ClusterWorkers)
+	case opts.MaxAPICalls < 0:
+		return fmt.Errorf("invalid --max-api-calls %v: must not be negative", opts.MaxAPICalls)
+	case opts.AllAccounts && len(opts.Accounts) == 0:
+		return errors.New("--all-accounts needs an accounts section in the config file")
+	case opts.AllAccounts && opts.AssumeRole.RoleARN != "":
+		return errors.New("--all-accounts assumes the role of each account and cannot be used with --role-arn")
+	case opts.AssumeRole.RoleARN == "" && opts.AssumeRole.ExternalID != "":
+		return errors.New("--external-id requires --role-arn")
+	case len(opts.EmailTo) > 0 && opts.SESFrom == "":
+		return errors.New("--email-to needs --ses-from")
+	case len(opts.EmailTo) == 0 && (opts.SESFrom != "" || opts.EmailAttachHTML):
+		return errors.New("--ses-from and --email-attach-html need --email-to")
+	case opts.SNSTopicArn != "" && !arn.IsARN(opts.SNSTopicArn):
+		return fmt.Errorf("invalid --sns-topic-arn %q: must be an SNS topic ARN", opts.SNSTopicArn)
+	case firstSinkError(opts.Sinks) != nil:
+		return fmt.Errorf("invalid --sink: %w", firstSinkError(opts.Sinks))
+	case opts.MinAgentVersion != "" && !agentstatus.ValidVersion(opts.MinAgentVersion):
+		return fmt.Errorf("invalid --min-agent-version %q: must be a version such as 1.75.0", opts.MinAgentVersion)
+	case opts.Watch && opts.Serve != "":
+		return errors.New("--watch and --serve cannot be used together")
+	case opts.MaxUnhealthy < 0:
+		return fmt.Errorf("invalid --max-unhealthy %v: must not be negative", opts.MaxUnhealthy)
+	case opts.FailThreshold < 0 || opts.FailThreshold > 100:
+		return fmt.Errorf("invalid --fail-threshold %v: must be a percentage from 0 to 100", opts.FailThreshold)
+	case opts.Quiet && opts.Verbose:
+		return errors.New("--quiet and --verbose cannot be used together")
+	case opts.MinAge < 0:
+		return fmt.Errorf("invalid --min-age %v: must not be negative", opts.MinAge)
+	case opts.BatchSize < 0:
+		return fmt.Errorf("invalid --batch-size %v: must not be negative", opts.BatchSize)
+	case opts.UpdateAgents && opts.UpdateTimeout <= 0:
+		return fmt.Errorf("invalid --update-timeout %v: must be positive", opts.UpdateTimeout)
+	case opts.DryRun && opts.Remediate == "" && !opts.UpdateAgents && (opts.Watch || opts.Serve != "" || opts.Daemon):
+		return errors.New("--dry-run cannot be used with --watch, --serve or --daemon")
+	case opts.DryRun && opts.Remediate == "" && !opts.UpdateAgents && !opts.Prune && !opts.InstallEvents && opts.Output != "text" && opts.Output != "json":
+		return fmt.Errorf("invalid --output %q: --dry-run supports text or json", opts.Output)
+	case opts.Wait && (opts.Watch || opts.Serve != "" || opts.Daemon):
+		return errors.New("--wait cannot be used with --watch, --serve or --daemon")
+	case opts.Wait && opts.WaitTimeout <= 0:
+		return fmt.Errorf("invalid --wait-timeout %v: must be positive", opts.WaitTimeout)
+	case opts.ClusterRefreshInterval < 0:
+		return errors.New("--cluster-refresh-interval must not be negative")
+	case opts.Daemon && opts.OutputFile == "":
+		return errors.New("--daemon needs --output-file, e.g. --out /var/lib/ecs-agent-status/latest.json")
+	case opts.Daemon && opts.Output != "text" && opts.Output != "json":
+		return fmt.Errorf("--daemon always writes JSON, not --output %v", opts.Output)
+	case opts.Daemon && filepath.Clean(opts.PromFile) == filepath.Clean(opts.OutputFile):
+		return errors.New("--prom-file must differ from --output-file")
+	case opts.InstallEvents && opts.EventTarget == "":
+		return errors.New("install-events needs --target, the ARN of an SNS topic or SQS queue")
+	case opts.InstallEvents && !arn.IsARN(opts.EventTarget):
+		return fmt.Errorf("invalid --target %q: must be an SNS topic or SQS queue ARN", opts.EventTarget)
+	case opts.EventsQueue != "" && opts.Serve == "" && !opts.Daemon:
+		return errors.New("--events-queue needs serve or --daemon, which keep the state the events update")
+	case opts.EventsQueue != "" && !isHTTPURL(opts.EventsQueue):
+		return fmt.Errorf("invalid --events-queue %q: must be an SQS queue URL", opts.EventsQueue)
+	case opts.Daemon && opts.Redactor != nil:
+		return errors.New("--redact cannot be used with --daemon, whose output is read by other programs")
+	case (opts.Watch || opts.Serve != "" || opts.Daemon || opts.TUI) && opts.Interval <= 0:
+		return fmt.Errorf("invalid --interval %v: must be positive", opts.Interval)
+	case opts.Watch && ((opts.Output != "text" && opts.Output != "jsonl") || opts.OutputFile != ""):
+		return errors.New("watch prints changes as they happen: use --output text or jsonl, without --output-file")
+	case opts.Schedule != nil && !opts.Daemon && opts.Serve == "":
+		return errors.New("--schedule is only used by serve and --daemon")
+	case opts.DeepSchedule != nil && opts.Schedule == nil:
+		return errors.New("--deep-schedule needs --schedule, the scans between the full scans")
+	case opts.Jitter < 0 || opts.Jitter > 1:
+		return fmt.Errorf("invalid --jitter %v: must be between 0 and 1", opts.Jitter)
+	case opts.MaxPollBackoff < 0:
+		return fmt.Errorf("invalid --max-poll-backoff %v: must not be negative", opts.MaxPollBackoff)
+	}
+	return nil
+}
+
+// isHTTPURL reports whether value is an absolute http or https URL with a host
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseScanArgs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	opts, err := ParseScanArgs("watch", []string{"--interval", "1m", "--output", "jsonl", "prod", "staging"})
+	if err != nil {
+		t.Fatalf("ParseScanArgs(watch) error = %v", err)
+	}
+	if !opts.Watch || opts.Interval != time.Minute || opts.Output != "jsonl" {
+		t.Errorf("ParseScanArgs(watch) = watch %v, interval %v, output %q", opts.Watch, opts.Interval, opts.Output)
+	}
+	if strings.Join(opts.ClusterPatterns, ",") != "prod,staging" {
+		t.Errorf("ParseScanArgs(watch) patterns = %v, want [prod staging]", opts.ClusterPatterns)
+	}
+
+	opts, err = ParseScanArgs("serve", []string{"prod"})
+	if err != nil {
+		t.Fatalf("ParseScanArgs(serve) error = %v", err)
+	}
+	if opts.Serve != ":9090" || opts.Watch {
+		t.Errorf("ParseScanArgs(serve) = serve %q, watch %v, want :9090 and false", opts.Serve, opts.Watch)
+	}
+
+	opts, err = ParseScanArgs("check", []string{"--include-external=false", "prod"})
+	if err != nil || !opts.ExcludeExternal {
+		t.Errorf("ParseScanArgs(check) with --include-external=false = exclude external %v, error %v, want true", opts.ExcludeExternal, err)
+	}
+
+	opts, err = ParseScanArgs("services", []string{"--output", "table", "prod"})
+	if err != nil || !opts.Services || opts.Output != "table" {
+		t.Errorf("ParseScanArgs(services) = services %v, output %q, error %v", opts.Services, opts.Output, err)
+	}
+	opts, err = ParseScanArgs("update-agents", []string{"--batch-size", "2", "--min-agent-version", "1.75.0", "prod"})
+	if err != nil || !opts.UpdateAgents || opts.BatchSize != 2 || opts.UpdateTimeout != 15*time.Minute {
+		t.Errorf("ParseScanArgs(update-agents) = update %v, batch size %v, timeout %v, error %v", opts.UpdateAgents, opts.BatchSize, opts.UpdateTimeout, err)
+	}
+	if _, err := ParseScanArgs("services", []string{"--output", "csv", "prod"}); err == nil {
+		t.Error("ParseScanArgs(services) with --output csv returned no error")
+	}
+	opts, err = ParseScanArgs("clusters", []string{"--output", "table"})
+	if err != nil || !opts.ListClusters || opts.Output != "table" || len(opts.ClusterPatterns) != 1 || opts.ClusterPatterns[0] != "" {
+		t.Errorf("ParseScanArgs(clusters) = list %v, patterns %q, output %q, error %v", opts.ListClusters, opts.ClusterPatterns, opts.Output, err)
+	}
+	opts, err = ParseScanArgs("instance", []string{"--output", "json", "prod", "i-0abc"})
+	if err != nil || opts.ContainerInstance != "i-0abc" || strings.Join(opts.ClusterPatterns, ",") != "prod" || opts.Output != "json" {
+		t.Errorf("ParseScanArgs(instance) = cluster %v, instance %q, output %q, error %v", opts.ClusterPatterns, opts.ContainerInstance, opts.Output, err)
+	}
+	if _, err := ParseScanArgs("instance", []string{"prod"}); err == nil {
+		t.Error("ParseScanArgs(instance) without an instance returned no error")
+	}
+	opts, err = ParseScanArgs("drain", []string{"--wait", "prod", "i-0abc", "i-0def"})
+	if err != nil || strings.Join(opts.DrainInstances, ",") != "i-0abc,i-0def" || strings.Join(opts.ClusterPatterns, ",") != "prod" || !opts.Wait || opts.WaitTimeout != 30*time.Minute {
+		t.Errorf("ParseScanArgs(drain) = cluster %v, instances %q, wait %v %v, error %v", opts.ClusterPatterns, opts.DrainInstances, opts.Wait, opts.WaitTimeout, err)
+	}
+	if _, err := ParseScanArgs("drain", []string{"prod"}); err == nil {
+		t.Error("ParseScanArgs(drain) without an instance returned no error")
+	}
+	opts, err = ParseScanArgs("serve", []string{"--schedule", "*/5 * * * *", "--deep-schedule", "@hourly", "prod"})
+	if err != nil || opts.Schedule.String() != "*/5 * * * *" || opts.DeepSchedule.String() != "@hourly" {
+		t.Errorf("ParseScanArgs(serve) with schedules = %v, %v, error %v", opts.Schedule, opts.DeepSchedule, err)
+	}
+	if _, err := ParseScanArgs("check", []string{"--schedule", "*/5 * * * *", "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with --schedule and without --daemon returned no error")
+	}
+	if _, err := ParseScanArgs("serve", []string{"--deep-schedule", "@hourly", "prod"}); err == nil {
+		t.Error("ParseScanArgs(serve) with --deep-schedule and without --schedule returned no error")
+	}
+	opts, err = ParseScanArgs("check", []string{"--show-attributes", "stack", "--group-by", "attribute:cohort", "prod"})
+	if err != nil || !reflect.DeepEqual(opts.ShowAttributes, []string{"stack", "cohort"}) {
+		t.Errorf("ParseScanArgs(check) grouped by an attribute = attributes %q, error %v", opts.ShowAttributes, err)
+	}
+	if _, err := ParseScanArgs("check", []string{"--group-by", "attribute:", "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with --group-by attribute: and no name returned no error")
+	}
+	opts, err = ParseScanArgs("check", []string{"--redact-key", "secret", "prod"})
+	if err != nil || opts.Redactor == nil {
+		t.Errorf("ParseScanArgs(check) with --redact-key = redactor %v, error %v", opts.Redactor, err)
+	}
+	if _, err := ParseScanArgs("check", []string{"--redact", "--daemon", "--out", "latest.json", "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with --redact and --daemon returned no error")
+	}
+	opts, err = ParseScanArgs("prune", []string{"--dry-run", "prod"})
+	if err != nil || !opts.Prune || !opts.DryRun || strings.Join(opts.ClusterPatterns, ",") != "prod" {
+		t.Errorf("ParseScanArgs(prune) = prune %v, cluster %v, dry run %v, error %v", opts.Prune, opts.ClusterPatterns, opts.DryRun, err)
+	}
+	if _, err := ParseScanArgs("prune", []string{"prod", "staging"}); err == nil {
+		t.Error("ParseScanArgs(prune) with two clusters returned no error")
+	}
+	opts, err = ParseScanArgs("install-events", []string{"--target", "arn:aws:sns:us-east-1:123456789012:ecs-agent-events"})
+	if err != nil || !opts.InstallEvents || opts.EventBus != "default" || opts.EventRuleName != DefaultEventRuleName {
+		t.Errorf("ParseScanArgs(install-events) = install %v, bus %q, rule %q, error %v", opts.InstallEvents, opts.EventBus, opts.EventRuleName, err)
+	}
+	if _, err := ParseScanArgs("install-events", nil); err == nil {
+		t.Error("ParseScanArgs(install-events) without --target returned no error")
+	}
+	if _, err := ParseScanArgs("install-events", []string{"--target", "arn:aws:sns:us-east-1:123456789012:ecs-agent-events", "prod"}); err == nil {
+		t.Error("ParseScanArgs(install-events) with a cluster pattern returned no error")
+	}
+	opts, err = ParseScanArgs("serve", []string{"--events-queue", "https://sqs.us-east-1.amazonaws.com/123456789012/events", "prod"})
+	if err != nil || opts.EventsQueue == "" {
+		t.Errorf("ParseScanArgs(serve) with --events-queue = %q, error %v", opts.EventsQueue, err)
+	}
+	if _, err := ParseScanArgs("check", []string{"--events-queue", "https://sqs.us-east-1.amazonaws.com/123456789012/events", "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with --events-queue and without --daemon returned no error")
+	}
+
+	opts, err = ParseScanArgs("check", []string{"--include-lifecycle-transitions", "--fail-on", "both", "prod"})
+	if err != nil || !opts.HealthPolicy.IncludeLifecycleTransitions || !opts.HealthPolicy.FailOnDisconnected {
+		t.Errorf("ParseScanArgs(check) with --include-lifecycle-transitions = %+v, error %v", opts.HealthPolicy, err)
+	}
+	opts, err = ParseScanArgs("check", []string{"--max-in-flight", "4", "--cluster-workers", "1", "--max-api-calls", "500", "prod"})
+	if err != nil || opts.MaxInFlight != 4 || opts.ClusterWorkers != 1 || opts.MaxAPICalls != 500 {
+		t.Errorf("ParseScanArgs(check) with API limits = in flight %v, workers %v, calls %v, error %v", opts.MaxInFlight, opts.ClusterWorkers, opts.MaxAPICalls, err)
+	}
+	if _, err := ParseScanArgs("check", []string{"--max-api-calls", "-1", "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with a negative --max-api-calls returned no error")
+	}
+
+	opts, err = ParseScanArgs("check", []string{"--exclude", "prod-sandbox", "--exclude", "prod-canary,prod-test", "prod"})
+	if err != nil || strings.Join(opts.Exclude, ",") != "prod-sandbox,prod-canary,prod-test" {
+		t.Errorf("ParseScanArgs(check) with --exclude = %v, error %v", opts.Exclude, err)
+	}
+
+	opts, err = ParseScanArgs("check", []string{"--cluster-tag", "env=prod,team=payments"})
+	if err != nil || len(opts.ClusterTags) != 2 || opts.ClusterTags["team"] != "payments" || len(opts.ClusterPatterns) != 1 || opts.ClusterPatterns[0] != "" {
+		t.Errorf("ParseScanArgs(check) with --cluster-tag = tags %v, patterns %q, error %v", opts.ClusterTags, opts.ClusterPatterns, err)
+	}
+
+	clustersFile := filepath.Join(t.TempDir(), "clusters.txt")
+	if err := os.WriteFile(clustersFile, []byte("prod-web\nprod-api\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts, err = ParseScanArgs("check", []string{"--clusters-file", clustersFile})
+	if err != nil || strings.Join(opts.ClusterNames, ",") != "prod-web,prod-api" {
+		t.Errorf("ParseScanArgs(check) with --clusters-file = %v, error %v", opts.ClusterNames, err)
+	}
+	if _, err := ParseScanArgs("check", []string{"--clusters-file", clustersFile, "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with --clusters-file and a pattern returned no error")
+	}
+
+	opts, err = ParseScanArgs("check", []string{"--quiet", "prod"})
+	if err != nil || !opts.OnlyUnhealthy || opts.LogLevel != zerolog.WarnLevel {
+		t.Errorf("ParseScanArgs(check) with --quiet = only unhealthy %v, log level %v, error %v", opts.OnlyUnhealthy, opts.LogLevel, err)
+	}
+	opts, err = ParseScanArgs("check", []string{"--verbose", "--log-level", "trace", "prod"})
+	if err != nil || opts.LogLevel != zerolog.TraceLevel {
+		t.Errorf("ParseScanArgs(check) with --verbose --log-level trace = log level %v, error %v", opts.LogLevel, err)
+	}
+	if _, err := ParseScanArgs("check", []string{"--quiet", "--verbose", "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with --quiet and --verbose returned no error")
+	}
+
+	if _, err := ParseScanArgs("check", nil); err != errNoPatterns {
+		t.Errorf("ParseScanArgs(check) without patterns error = %v, want %v", err, errNoPatterns)
+	}
+	if _, err := ParseScanArgs("check", []string{"--remediate", "drain", "--watch", "prod"}); err == nil {
+		t.Error("ParseScanArgs(check) with --remediate and --watch returned no error")
+	}
+
+	opts, err = ParseScanArgs("check-instances", []string{"--cluster", "web", "i-aaaa", "0123456789abcdef0123456789abcdef"})
+	if err != nil || !reflect.DeepEqual(opts.ClusterNames, []string{"web"}) || !reflect.DeepEqual(opts.Instances, []string{"i-aaaa", "0123456789abcdef0123456789abcdef"}) {
+		t.Errorf("ParseScanArgs(check-instances) = %v, %v, %v", opts.ClusterNames, opts.Instances, err)
+	}
+	if _, err := ParseScanArgs("check-instances", []string{"i-aaaa"}); err == nil {
+		t.Error("ParseScanArgs(check-instances) without --cluster returned no error")
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		var buf bytes.Buffer
+		if err := WriteCompletion(&buf, shell); err != nil {
+			t.Fatalf("WriteCompletion(%v) error = %v", shell, err)
+		}
+		if !strings.Contains(buf.String(), "listen") || !strings.Contains(buf.String(), "restart-agent") {
+			t.Errorf("WriteCompletion(%v) does not complete the flags of every command:\n%v", shell, buf.String())
+		}
+	}
+	if err := WriteCompletion(&bytes.Buffer{}, "powershell"); err == nil {
+		t.Error("WriteCompletion(powershell) returned no error")
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	var tags stringList
+	for _, value := range []string{"team=payments", "env=prod,tier="} {
+		if err := tags.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ParseTags(tags)
+	if err != nil {
+		t.Fatalf("ParseTags() error = %v", err)
+	}
+	if len(got) != 3 || got["team"] != "payments" || got["env"] != "prod" || got["tier"] != "" {
+		t.Errorf("ParseTags() = %v", got)
+	}
+	if _, err := ParseTags([]string{"team"}); err == nil {
+		t.Error("ParseTags() without a value returned no error")
+	}
+}
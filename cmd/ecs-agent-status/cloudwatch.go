@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// putMetricDataBatchSize is the maximum number of metrics in a single PutMetricData call
+const putMetricDataBatchSize = 1000
+
+// CloudWatchPutter is the subset of the CloudWatch API used to publish metrics
+type CloudWatchPutter interface {
+	PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+// ClusterMetricData returns the per-cluster agent counts as CloudWatch metrics, keyed by ScopeKey: the number
+// of ACTIVE, DRAINING, disconnected and all agents, each with a ClusterName dimension
+func ClusterMetricData(agents []agentstatus.Agent, timestamp time.Time) map[string][]types.MetricDatum {
+	type counts struct{ active, draining, disconnected, total int }
+	type key struct{ scope, cluster string }
+	var keys []key
+	byCluster := make(map[key]*counts)
+	for _, agent := range agents {
+		k := key{ScopeKey(agent.AccountID, agent.Region), agent.Cluster}
+		c, ok := byCluster[k]
+		if !ok {
+			c = &counts{}
+			byCluster[k] = c
+			keys = append(keys, k)
+		}
+		c.total++
+		switch agent.AgentStatus {
+		case "ACTIVE":
+			c.active++
+		case "DRAINING":
+			c.draining++
+		}
+		if !agent.AgentConnected {
+			c.disconnected++
+		}
+	}
+
+	data := make(map[string][]types.MetricDatum)
+	for _, k := range keys {
+		c := byCluster[k]
+		dimensions := []types.Dimension{{Name: aws.String("ClusterName"), Value: aws.String(k.cluster)}}
+		for _, metric := range []struct {
+			name  string
+			value int
+		}{
+			{"ActiveAgents", c.active},
+			{"DrainingAgents", c.draining},
+			{"DisconnectedAgents", c.disconnected},
+			{"TotalAgents", c.total},
+		} {
+			data[k.scope] = append(data[k.scope], types.MetricDatum{
+				MetricName: aws.String(metric.name),
+				Dimensions: dimensions,
+				Timestamp:  aws.Time(timestamp),
+				Unit:       types.StandardUnitCount,
+				Value:      aws.Float64(float64(metric.value)),
+			})
+		}
+	}
+	return data
+}
+
+// PublishMetrics puts the metrics into namespace in batches of putMetricDataBatchSize
+func PublishMetrics(ctx context.Context, client CloudWatchPutter, namespace string, data []types.MetricDatum) error {
+	for start := 0; start < len(data); start += putMetricDataBatchSize {
+		end := min(start+putMetricDataBatchSize, len(data))
+		_, err := client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(namespace),
+			MetricData: data[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("put metric data: %w", err)
+		}
+	}
+	return nil
+}
+
+// PublishCloudWatch publishes the per-cluster metrics of the agents to CloudWatch in each cluster's account
+// and region
+func PublishCloudWatch(ctx context.Context, cfgs map[string]aws.Config, namespace string, agents []agentstatus.Agent) error {
+	for scope, data := range ClusterMetricData(agents, time.Now()) {
+		cfg, ok := cfgs[scope]
+		if !ok {
+			return fmt.Errorf("no AWS config for region %q", scope)
+		}
+		if err := PublishMetrics(ctx, cloudwatch.NewFromConfig(cfg), namespace, data); err != nil {
+			return fmt.Errorf("region %v: %w", scope, err)
+		}
+		logger.Info().Str("region", scope).Msgf("published %v metrics to CloudWatch namespace %v", len(data), namespace)
+	}
+	return nil
+}
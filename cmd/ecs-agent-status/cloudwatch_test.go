@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+type mockCloudWatch struct {
+	inputs []*cloudwatch.PutMetricDataInput
+}
+
+func (m *mockCloudWatch) PutMetricData(_ context.Context, params *cloudwatch.PutMetricDataInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	m.inputs = append(m.inputs, params)
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
+
+func TestClusterMetricData(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "DRAINING", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE"},
+		{Region: "eu-west-1", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true},
+	}
+	data := ClusterMetricData(agents, time.Now())
+	got := make(map[string]float64)
+	for _, datum := range data["us-east-1"] {
+		if aws.ToString(datum.Dimensions[0].Value) != "web" {
+			t.Errorf("ClusterMetricData() dimension = %v, want web", aws.ToString(datum.Dimensions[0].Value))
+		}
+		got[aws.ToString(datum.MetricName)] = aws.ToFloat64(datum.Value)
+	}
+	want := map[string]float64{"ActiveAgents": 2, "DrainingAgents": 1, "DisconnectedAgents": 1, "TotalAgents": 3}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("ClusterMetricData() %v = %v, want %v", name, got[name], value)
+		}
+	}
+	if len(data["eu-west-1"]) != 4 {
+		t.Errorf("ClusterMetricData() eu-west-1 has %v metrics, want 4", len(data["eu-west-1"]))
+	}
+}
+
+func TestPublishMetricsBatches(t *testing.T) {
+	client := &mockCloudWatch{}
+	data := make([]types.MetricDatum, 2500)
+	if err := PublishMetrics(context.Background(), client, "ECS/AgentStatus", data); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.inputs) != 3 || len(client.inputs[2].MetricData) != 500 {
+		t.Errorf("PublishMetrics() made %v calls, want 3 with 500 metrics in the last", len(client.inputs))
+	}
+	if aws.ToString(client.inputs[0].Namespace) != "ECS/AgentStatus" {
+		t.Errorf("PublishMetrics() namespace = %v", aws.ToString(client.inputs[0].Namespace))
+	}
+}
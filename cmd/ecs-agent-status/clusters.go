@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// ScanClusters lists the clusters matching the patterns in every region and returns their inventory, sorted
+// by account, region and name, without looking at their container instances. ErrNoClustersMatched is
+// returned when nothing matches
+func ScanClusters(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) ([]agentstatus.ClusterInfo, error) {
+	clustersByRegion, listErrs := listClusters(ctx, checkers, opts)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var inventory []agentstatus.ClusterInfo
+	for _, region := range SortedRegions(checkers) {
+		if err, ok := listErrs[region]; ok {
+			if len(checkers) == 1 {
+				return nil, err
+			}
+			logger.Warn().Err(err).Str("region", region).Msgf("error getting clusters in region %v: %v", region, err)
+			continue
+		}
+		if len(clustersByRegion[region]) == 0 {
+			continue
+		}
+		clusters, err := checkers[region].DescribeClusterInventory(ctx, clustersByRegion[region])
+		if err != nil {
+			if len(checkers) == 1 {
+				return nil, err
+			}
+			logger.Warn().Err(err).Str("region", region).Msgf("error describing clusters in region %v: %v", region, err)
+			continue
+		}
+		inventory = append(inventory, clusters...)
+	}
+	if len(inventory) == 0 {
+		return nil, agentstatus.ErrNoClustersMatched
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		a, b := inventory[i], inventory[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Name < b.Name
+	})
+	return inventory, nil
+}
+
+// FormatClusterInfo returns the text output line of a cluster
+func FormatClusterInfo(cluster agentstatus.ClusterInfo) string {
+	line := fmt.Sprintf("Region: %v, Cluster: %v, Status: %v, ContainerInstances: %v, RunningTasks: %v, PendingTasks: %v, Services: %v, CapacityProviders: %v",
+		cluster.Region, cluster.Name, cluster.Status, cluster.ContainerInstances, cluster.RunningTasks, cluster.PendingTasks,
+		cluster.ActiveServices, strings.Join(cluster.CapacityProviders, " "))
+	if cluster.AccountID != "" {
+		line += fmt.Sprintf(", Account: %v", cluster.AccountID)
+	}
+	return line
+}
+
+// WriteClusters writes the cluster inventory to w in the --output format: text, table or json
+func WriteClusters(w io.Writer, inventory []agentstatus.ClusterInfo, opts Options) error {
+	switch opts.Output {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "REGION\tCLUSTER\tSTATUS\tINSTANCES\tRUNNING\tPENDING\tSERVICES\tCAPACITY PROVIDERS")
+		for _, cluster := range inventory {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", cluster.Region, cluster.Name, cluster.Status, cluster.ContainerInstances,
+				cluster.RunningTasks, cluster.PendingTasks, cluster.ActiveServices, strings.Join(cluster.CapacityProviders, ","))
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if inventory == nil {
+			inventory = []agentstatus.ClusterInfo{}
+		}
+		return encoder.Encode(inventory)
+	}
+	for _, cluster := range inventory {
+		if _, err := fmt.Fprintln(w, FormatClusterInfo(cluster)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runClusters prints the inventory of the matching clusters and returns the exit code
+func runClusters(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	inventory, err := ScanClusters(ctx, checkers, opts)
+	if err != nil {
+		return scanErrorExitCode(ctx, err, opts)
+	}
+	if err := WriteClusters(os.Stdout, inventory, opts); err != nil {
+		logger.Error().Err(err).Msg("error writing output")
+		return ExitError
+	}
+	logger.Info().Int("clusters", len(inventory)).Int64("apiCalls", apiStats.Attempts()).Int64("throttles", apiStats.Throttles()).
+		Msgf("found %v matching clusters", len(inventory))
+	return ExitHealthy
+}
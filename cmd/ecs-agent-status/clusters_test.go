@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteClusters(t *testing.T) {
+	inventory := []agentstatus.ClusterInfo{{Region: "us-east-1", Name: "prod", Status: "ACTIVE", ContainerInstances: 3,
+		RunningTasks: 12, ActiveServices: 4, CapacityProviders: []string{"prod-asg", "FARGATE"}}}
+	var buf bytes.Buffer
+	if err := WriteClusters(&buf, inventory, Options{Output: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Region: us-east-1, Cluster: prod, Status: ACTIVE, ContainerInstances: 3, RunningTasks: 12, PendingTasks: 0, Services: 4, CapacityProviders: prod-asg FARGATE\n"
+	if buf.String() != want {
+		t.Errorf("WriteClusters(text) = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteClusters(&buf, inventory, Options{Output: "table"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "REGION") || !strings.Contains(lines[1], "prod-asg,FARGATE") {
+		t.Errorf("WriteClusters(table) =\n%v", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteClusters(&buf, nil, Options{Output: "json"}); err != nil || strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("WriteClusters(json) with no clusters = %q, error %v, want []", buf.String(), err)
+	}
+}
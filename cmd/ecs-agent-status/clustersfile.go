@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// ReadClusterNames reads the clusters listed by --clusters-file, one cluster name or ARN per line. Blank
+// lines and lines starting with # are skipped
+func ReadClusterNames(r io.Reader) ([]string, error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, agentstatus.ErrNoClustersMatched
+	}
+	return names, nil
+}
+
+// LoadClusterNames reads the clusters listed in path, or on stdin if path is -
+func LoadClusterNames(path string) ([]string, error) {
+	if path == "-" {
+		return ReadClusterNames(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadClusterNames(f)
+}
+
+// RegionClusterNames assigns the clusters of --clusters-file to the regions to check, without calling
+// ListClusters. A cluster ARN goes to the region, and with --all-accounts the account, it names; it is
+// left out with a warning if that region is not being checked. A plain name goes to every region
+func RegionClusterNames(checkers map[string]*agentstatus.StatusChecker, names []string) map[string][]string {
+	clustersByRegion := make(map[string][]string)
+	for _, name := range names {
+		parsed, err := arn.Parse(name)
+		if err != nil {
+			for region := range checkers {
+				clustersByRegion[region] = append(clustersByRegion[region], name)
+			}
+			continue
+		}
+		key := ScopeKey(parsed.AccountID, parsed.Region)
+		if _, ok := checkers[key]; !ok {
+			key = parsed.Region
+		}
+		if _, ok := checkers[key]; !ok {
+			logger.Warn().Str("cluster", name).Msgf("skipping cluster %v outside the regions being checked", name)
+			continue
+		}
+		clustersByRegion[key] = append(clustersByRegion[key], agentstatus.ClusterNameFromArn(name))
+	}
+	return clustersByRegion
+}
+
+// listClusters returns the clusters to check in every region: those listed by --clusters-file, or those
+// matching the cluster name patterns, from the --cluster-cache file or opts.clusterCache while it is fresh.
+// With --cluster-tag only the clusters with the tags are kept
+func listClusters(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) (map[string][]string, map[string]error) {
+	var clustersByRegion map[string][]string
+	var errs map[string]error
+	switch {
+	case len(opts.ClusterNames) > 0:
+		clustersByRegion = RegionClusterNames(checkers, opts.ClusterNames)
+	case opts.ClusterCacheFile != "":
+		clustersByRegion, errs = ListCachedRegionClusters(ctx, checkers, opts, time.Now())
+	default:
+		clustersByRegion, errs = opts.clusterCache.List(ctx, checkers, opts.ClusterPatterns, opts.Exclude, opts.Match)
+	}
+	if len(opts.ClusterTags) == 0 {
+		return clustersByRegion, errs
+	}
+	tagged := make(map[string][]string)
+	for region, clusters := range clustersByRegion {
+		clusters, err := checkers[region].FilterClustersByTags(ctx, clusters, opts.ClusterTags)
+		if err != nil {
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[region] = err
+			continue
+		}
+		if len(clusters) > 0 {
+			tagged[region] = clusters
+		}
+	}
+	return tagged, errs
+}
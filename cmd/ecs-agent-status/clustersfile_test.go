@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestReadClusterNames(t *testing.T) {
+	names, err := ReadClusterNames(strings.NewReader("# production\nprod-web\n\n  prod-api  \narn:aws:ecs:eu-west-1:123456789012:cluster/prod-eu\n"))
+	want := []string{"prod-web", "prod-api", "arn:aws:ecs:eu-west-1:123456789012:cluster/prod-eu"}
+	if err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadClusterNames() = %v, %v, want %v", names, err, want)
+	}
+	if _, err := ReadClusterNames(strings.NewReader("# nothing\n")); !errors.Is(err, agentstatus.ErrNoClustersMatched) {
+		t.Errorf("ReadClusterNames() of an empty list error = %v, want %v", err, agentstatus.ErrNoClustersMatched)
+	}
+}
+
+func TestRegionClusterNames(t *testing.T) {
+	checkers := map[string]*agentstatus.StatusChecker{
+		"us-east-1": {Region: "us-east-1"},
+		"eu-west-1": {Region: "eu-west-1"},
+	}
+	got := RegionClusterNames(checkers, []string{
+		"prod-web",
+		"arn:aws:ecs:eu-west-1:123456789012:cluster/prod-eu",
+		"arn:aws:ecs:ap-south-1:123456789012:cluster/prod-ap",
+	})
+	want := map[string][]string{
+		"us-east-1": {"prod-web"},
+		"eu-west-1": {"prod-web", "prod-eu"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RegionClusterNames() = %v, want %v", got, want)
+	}
+
+	accounts := map[string]*agentstatus.StatusChecker{
+		"111111111111/us-east-1": {Region: "us-east-1"},
+		"222222222222/us-east-1": {Region: "us-east-1"},
+	}
+	got = RegionClusterNames(accounts, []string{"arn:aws:ecs:us-east-1:222222222222:cluster/prod"})
+	if want := map[string][]string{"222222222222/us-east-1": {"prod"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RegionClusterNames() with accounts = %v, want %v", got, want)
+	}
+}
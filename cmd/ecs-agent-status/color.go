@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// ANSI escape sequences used to highlight agent status in text output
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+)
+
+// UseColor reports whether text output should be colorized: stdout must be a terminal, and neither
+// --no-color nor the NO_COLOR environment variable (https://no-color.org) may be set
+func UseColor(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+}
+
+// colorizeStatus wraps an agent status in green when it is ACTIVE, yellow when it is DRAINING and red
+// otherwise
+func colorizeStatus(status string) string {
+	switch status {
+	case "ACTIVE":
+		return ansiGreen + status + ansiReset
+	case "DRAINING":
+		return ansiYellow + status + ansiReset
+	}
+	return ansiRed + status + ansiReset
+}
+
+// colorizeConnected returns the agent connectivity as text, in red when the agent is disconnected
+func colorizeConnected(connected bool) string {
+	if connected {
+		return "true"
+	}
+	return ansiRed + "false" + ansiReset
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestColorizeStatus(t *testing.T) {
+	tests := map[string]string{
+		"ACTIVE":   ansiGreen + "ACTIVE" + ansiReset,
+		"DRAINING": ansiYellow + "DRAINING" + ansiReset,
+		"UNKNOWN":  ansiRed + "UNKNOWN" + ansiReset,
+	}
+	for status, want := range tests {
+		if got := colorizeStatus(status); got != want {
+			t.Errorf("colorizeStatus(%v) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestFormatAgentColor(t *testing.T) {
+	agent := agentstatus.Agent{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "DRAINING"}
+	line := FormatAgent(agent, Options{Color: true})
+	for _, want := range []string{"AgentStatus: " + ansiYellow + "DRAINING" + ansiReset, "AgentConnected: " + ansiRed + "false" + ansiReset} {
+		if !strings.Contains(line, want) {
+			t.Errorf("FormatAgent() = %q, want it to contain %q", line, want)
+		}
+	}
+	if line := FormatAgent(agent, Options{}); strings.Contains(line, "\033[") {
+		t.Errorf("FormatAgent() without color = %q, want no escape codes", line)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteCompletion writes a completion script for shell (bash, zsh or fish) that completes the commands and
+// the flags of each command
+func WriteCompletion(w io.Writer, shell string) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion(false)
+	case "zsh":
+		script = bashCompletion(true)
+	case "fish":
+		script = fishCompletion()
+	default:
+		return fmt.Errorf("unsupported shell %q: must be one of %v", shell, strings.Join(completionShells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// commandFlags returns the flags of command in --name form, separated by spaces
+func commandFlags(command string) string {
+	names := flagNames(command)
+	for i, name := range names {
+		names[i] = "--" + name
+	}
+	return strings.Join(names, " ")
+}
+
+// bashCompletion returns a bash completion script. zsh loads the same script through bashcompinit
+func bashCompletion(zsh bool) string {
+	var b strings.Builder
+	if zsh {
+		b.WriteString("#compdef ecs-agent-status\nautoload -U +X bashcompinit && bashcompinit\n\n")
+	}
+	b.WriteString("_ecs_agent_status() {\n")
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" command=check\n")
+	fmt.Fprintf(&b, "\tif [[ ${COMP_CWORD} -eq 1 && ${cur} != -* ]]; then\n\t\tCOMPREPLY=($(compgen -W \"%v\" -- \"${cur}\"))\n\t\treturn\n\tfi\n", strings.Join(commands, " "))
+	b.WriteString("\tcase \"${COMP_WORDS[1]}\" in\n")
+	fmt.Fprintf(&b, "\t%v) command=\"${COMP_WORDS[1]}\" ;;\n", strings.Join(commands, "|"))
+	b.WriteString("\tesac\n")
+	b.WriteString("\tcase \"${command}\" in\n")
+	for _, command := range scanCommands {
+		fmt.Fprintf(&b, "\t%v) COMPREPLY=($(compgen -W \"%v\" -- \"${cur}\")) ;;\n", command, commandFlags(command))
+	}
+	fmt.Fprintf(&b, "\tcompletion) COMPREPLY=($(compgen -W \"%v\" -- \"${cur}\")) ;;\n", strings.Join(completionShells, " "))
+	b.WriteString("\tesac\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -F _ecs_agent_status ecs-agent-status\n")
+	return b.String()
+}
+
+// fishCompletion returns a fish completion script
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("complete -c ecs-agent-status -f\n")
+	fmt.Fprintf(&b, "complete -c ecs-agent-status -n '__fish_use_subcommand' -a '%v'\n", strings.Join(commands, " "))
+	for _, command := range scanCommands {
+		for _, name := range flagNames(command) {
+			fmt.Fprintf(&b, "complete -c ecs-agent-status -n '__fish_seen_subcommand_from %v' -l %v\n", command, name)
+		}
+	}
+	fmt.Fprintf(&b, "complete -c ecs-agent-status -n '__fish_seen_subcommand_from completion' -a '%v'\n", strings.Join(completionShells, " "))
+	return b.String()
+}
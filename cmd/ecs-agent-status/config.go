@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigPath returns ~/.ecs-agent-status.yaml, or an empty string if the home directory is unknown
+func DefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ecs-agent-status.yaml")
+}
+
+// ConfigFile is a YAML (or JSON) file of default flag values keyed by flag name, with an optional presets
+// section of named sets of flag values and cluster name patterns, an optional accounts section for
+// --all-accounts and an optional notifiers section of notification targets
+type ConfigFile struct {
+	Path      string
+	Values    map[string]interface{}
+	Presets   map[string]map[string]interface{}
+	Accounts  []AccountConfig
+	Notifiers []NotifierConfig
+}
+
+// presetPatternsKey is the preset key that holds cluster name patterns rather than a flag value
+const presetPatternsKey = "patterns"
+
+// LoadConfigFile reads the config file at path. A missing file is only an error when required is true, and
+// otherwise returns an empty ConfigFile
+func LoadConfigFile(path string, required bool) (*ConfigFile, error) {
+	config := &ConfigFile{Path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return config, nil
+		}
+		return nil, err
+	}
+	var file struct {
+		Presets   map[string]map[string]interface{} `yaml:"presets"`
+		Accounts  []AccountConfig                   `yaml:"accounts"`
+		Notifiers []NotifierConfig                  `yaml:"notifiers"`
+	}
+	if err := yaml.Unmarshal(data, &config.Values); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse presets, accounts and notifiers in config file %s: %w", path, err)
+	}
+	for _, account := range file.Accounts {
+		if err := account.Validate(); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	for _, notifier := range file.Notifiers {
+		if err := notifier.Validate(); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	delete(config.Values, "presets")
+	delete(config.Values, "accounts")
+	delete(config.Values, "notifiers")
+	config.Presets, config.Accounts, config.Notifiers = file.Presets, file.Accounts, file.Notifiers
+	return config, nil
+}
+
+// Apply sets every flag in fs that was not given on the command line, first from the named preset (if
+// preset is not empty) and then from the top-level values, so command-line flags override the preset and
+// the preset overrides the defaults. It returns the preset's cluster name patterns. Keys in known that are
+// not flags of fs, such as the flags of other subcommands, are skipped; the returned warnings name the keys
+// that match neither
+func (c *ConfigFile) Apply(fs *flag.FlagSet, preset string, known map[string]bool) ([]string, []string, error) {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var patterns, warnings []string
+	if preset != "" {
+		values, ok := c.Presets[preset]
+		if !ok {
+			return nil, nil, fmt.Errorf("preset %q not found in config file %s", preset, c.Path)
+		}
+		switch list := values[presetPatternsKey].(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range list {
+				patterns = append(patterns, fmt.Sprint(item))
+			}
+		default:
+			patterns = []string{fmt.Sprint(list)}
+		}
+		presetValues := make(map[string]interface{}, len(values))
+		for key, value := range values {
+			if key != presetPatternsKey {
+				presetValues[key] = value
+			}
+		}
+		presetWarnings, err := c.apply(fs, presetValues, set, known, fmt.Sprintf("preset %q in config file %s", preset, c.Path))
+		warnings = append(warnings, presetWarnings...)
+		if err != nil {
+			return nil, warnings, err
+		}
+	}
+	fileWarnings, err := c.apply(fs, c.Values, set, known, "config file "+c.Path)
+	return patterns, append(warnings, fileWarnings...), err
+}
+
+// apply sets the flags of fs named by the keys of values that are not in set, adding them to set. source
+// names where the values came from in warnings and errors
+func (c *ConfigFile) apply(fs *flag.FlagSet, values map[string]interface{}, set, known map[string]bool, source string) ([]string, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings []string
+	for _, key := range keys {
+		if key == "config" || key == "preset" || fs.Lookup(key) == nil {
+			if key != "config" && key != "preset" && known[key] {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("unknown key %q in %s", key, source))
+			continue
+		}
+		if set[key] {
+			continue
+		}
+		if err := fs.Set(key, configValueString(values[key])); err != nil {
+			return warnings, fmt.Errorf("%s: invalid value for %s: %w", source, key, err)
+		}
+		set[key] = true
+	}
+	return warnings, nil
+}
+
+// configValueString converts a YAML value to its flag string form. Lists become comma-separated values
+func configValueString(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigFileApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "regions: [us-east-1, eu-west-1]\nprofile: ops\noutput: jsonl\nlog-level: debug\ncolour: red\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	regions := fs.String("regions", "", "")
+	profile := fs.String("profile", "", "")
+	output := fs.String("output", "text", "")
+	logLevel := fs.String("log-level", "info", "")
+	if err := fs.Parse([]string{"--profile", "cli"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfigFile(path, true)
+	if err != nil {
+		t.Fatalf("LoadConfigFile() error = %v", err)
+	}
+	_, warnings, err := config.Apply(fs, "", nil)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Apply() warnings = %v, want one warning for the unknown key", warnings)
+	}
+	if *regions != "us-east-1,eu-west-1" {
+		t.Errorf("regions = %q, want us-east-1,eu-west-1", *regions)
+	}
+	if *profile != "cli" {
+		t.Errorf("profile = %q, want the command-line value cli", *profile)
+	}
+	if *output != "jsonl" || *logLevel != "debug" {
+		t.Errorf("output, log-level = %q, %q, want jsonl, debug", *output, *logLevel)
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	config, err := LoadConfigFile(missing, false)
+	if err != nil {
+		t.Errorf("LoadConfigFile() with optional missing file error = %v", err)
+	} else if _, _, err := config.Apply(fs, "", nil); err != nil {
+		t.Errorf("Apply() with optional missing file error = %v", err)
+	}
+	if _, err := LoadConfigFile(missing, true); err == nil {
+		t.Error("LoadConfigFile() with required missing file returned no error")
+	}
+}
+
+func TestConfigFileApplyPreset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `output: json
+presets:
+  prod:
+    patterns: [prod-a, "^prod-[0-9]{1,2}$"]
+    regions: us-east-1
+    output: table
+    listen: ":9100"
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfigFile(path, true)
+	if err != nil {
+		t.Fatalf("LoadConfigFile() error = %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	regions := fs.String("regions", "", "")
+	output := fs.String("output", "text", "")
+	patterns, warnings, err := config.Apply(fs, "prod", map[string]bool{"listen": true})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Apply() warnings = %v, want none", warnings)
+	}
+	if len(patterns) != 2 || patterns[1] != "^prod-[0-9]{1,2}$" {
+		t.Errorf("Apply() patterns = %q, want [prod-a ^prod-[0-9]{1,2}$]", patterns)
+	}
+	if *regions != "us-east-1" || *output != "table" {
+		t.Errorf("regions, output = %q, %q, want us-east-1 and the preset's table", *regions, *output)
+	}
+
+	if _, _, err := config.Apply(flag.NewFlagSet("test", flag.ContinueOnError), "staging", nil); err == nil {
+		t.Error("Apply() with an unknown preset returned no error")
+	}
+}
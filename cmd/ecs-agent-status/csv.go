@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// csvHeader names the CSV columns after the JSON fields of agentstatus.Agent
+var csvHeader = []string{
+	"region", "cluster", "containerInstanceArn", "ec2InstanceId", "agentStatus", "agentConnected", "agentUpdateStatus",
+	"registeredCpu", "registeredMemory", "remainingCpu", "remainingMemory", "runningTasks", "pendingTasks",
+	"failureReason", "registeredAt", "ageSeconds", "agentVersion", "versionDrift", "dockerVersion", "dockerVersionDrift", "outdated",
+	"instanceType", "availabilityZone", "launchTime", "privateIp", "autoScalingGroup", "accountId", "launchType", "managedInstanceId",
+	"capacityProvider", "systemStatus", "instanceStatus", "scheduledEvents", "ssmPingStatus",
+	"osType", "osFamily", "disconnectedSince", "disconnectedForSeconds",
+	"imageId", "launchTemplateId", "launchTemplateVersion", "launchTemplateDrift", "clusterArn", "duplicateRegistrations",
+	"lifecycleState", "warmPool",
+}
+
+// csvRecord returns the CSV fields of an agent in csvHeader order
+func csvRecord(agent agentstatus.Agent) []string {
+	var registeredAt, ageSeconds, launchTime, disconnectedSince, disconnectedFor string
+	if agent.RegisteredAt != nil {
+		registeredAt = agent.RegisteredAt.UTC().Format(time.RFC3339)
+		ageSeconds = strconv.FormatInt(agent.AgeSeconds, 10)
+	}
+	if agent.LaunchTime != nil {
+		launchTime = agent.LaunchTime.UTC().Format(time.RFC3339)
+	}
+	if agent.DisconnectedSince != nil {
+		disconnectedSince = agent.DisconnectedSince.UTC().Format(time.RFC3339)
+		disconnectedFor = strconv.FormatInt(agent.DisconnectedForSeconds, 10)
+	}
+	return []string{
+		agent.Region,
+		agent.Cluster,
+		agent.ContainerInstanceARN,
+		agent.EC2InstanceID,
+		agent.AgentStatus,
+		strconv.FormatBool(agent.AgentConnected),
+		agent.AgentUpdateStatus,
+		strconv.Itoa(int(agent.RegisteredCPU)),
+		strconv.Itoa(int(agent.RegisteredMemory)),
+		strconv.Itoa(int(agent.RemainingCPU)),
+		strconv.Itoa(int(agent.RemainingMemory)),
+		strconv.Itoa(agent.RunningTasks),
+		strconv.Itoa(agent.PendingTasks),
+		agent.FailureReason,
+		registeredAt,
+		ageSeconds,
+		agent.AgentVersion,
+		strconv.FormatBool(agent.VersionDrift),
+		agent.DockerVersion,
+		strconv.FormatBool(agent.DockerVersionDrift),
+		strconv.FormatBool(agent.Outdated),
+		agent.InstanceType,
+		agent.AvailabilityZone,
+		launchTime,
+		agent.PrivateIP,
+		agent.AutoScalingGroup,
+		agent.AccountID,
+		agent.LaunchType,
+		agent.ManagedInstanceID,
+		agent.CapacityProvider,
+		agent.SystemStatus,
+		agent.InstanceStatus,
+		strings.Join(eventCodes(agent.ScheduledEvents), " "),
+		agent.SSMPingStatus,
+		agent.OSType,
+		agent.OSFamily,
+		disconnectedSince,
+		disconnectedFor,
+		agent.ImageID,
+		agent.LaunchTemplateID,
+		agent.LaunchTemplateVersion,
+		strconv.FormatBool(agent.LaunchTemplateDrift),
+		agent.ClusterARN,
+		strings.Join(agent.DuplicateRegistrations, " "),
+		agent.LifecycleState,
+		strconv.FormatBool(agent.WarmPool),
+	}
+}
+
+// WriteCSV writes a header row and one row per agent to w
+func WriteCSV(w io.Writer, agents []agentstatus.Agent) error {
+	return WriteCSVFields(w, agents, nil)
+}
+
+// WriteCSVFields writes a header row and one row per agent to w with the columns of fields, or every column
+// when fields is empty
+func WriteCSVFields(w io.Writer, agents []agentstatus.Agent, fields []string) error {
+	cw := csv.NewWriter(w)
+	header := csvHeader
+	if len(fields) > 0 {
+		header = fields
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, agent := range agents {
+		record := csvRecord(agent)
+		if len(fields) > 0 {
+			var err error
+			if record, err = fieldValues(agent, fields); err != nil {
+				return err
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// eventCodes returns the codes of scheduled events, with the date each is scheduled to start, e.g.
+// instance-retirement@2024-05-10
+func eventCodes(events []agentstatus.ScheduledEvent) []string {
+	codes := make([]string, len(events))
+	for i, event := range events {
+		codes[i] = event.Code
+		if event.NotBefore != nil {
+			codes[i] += "@" + event.NotBefore.UTC().Format(time.DateOnly)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteCSV(t *testing.T) {
+	registeredAt := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	agents := []agentstatus.Agent{{
+		Region: "us-east-1", Cluster: "web,api", ClusterARN: "arn:aws:ecs:us-east-1:123456789012:cluster/web,api", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa",
+		EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, RegisteredCPU: 2048, RunningTasks: 3, PendingTasks: 1,
+		RegisteredAt: &registeredAt, AgentVersion: "1.75.0",
+	}}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, agents); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || !reflect.DeepEqual(records[0], csvHeader) {
+		t.Fatalf("WriteCSV() = %v, want a header and one row", records)
+	}
+	want := []string{
+		"us-east-1", "web,api", "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", "i-aaaa", "ACTIVE", "true", "",
+		"2048", "0", "0", "0", "3", "1", "", "2023-12-01T12:00:00Z", "0", "1.75.0", "false", "", "false", "false",
+		"", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "",
+		"", "", "", "false", "arn:aws:ecs:us-east-1:123456789012:cluster/web,api", "",
+		"", "false",
+	}
+	if !reflect.DeepEqual(records[1], want) {
+		t.Errorf("WriteCSV() row = %v, want %v", records[1], want)
+	}
+}
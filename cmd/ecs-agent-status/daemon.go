@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// DefaultPromFile returns the --prom-file of a daemon writing its results to outputFile: the same path with
+// a .prom extension, e.g. /var/lib/ecs-agent-status/latest.prom
+func DefaultPromFile(outputFile string) string {
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".prom"
+}
+
+// writeFileAtomically writes a file with write, replacing path only once write succeeds, so that readers
+// never see a partial file
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	f, err := CreateAtomicFile(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// WriteFiles rewrites statusFile with the /status JSON of the exporter and promFile with its metrics, in
+// the Prometheus text format read by the node exporter's textfile collector
+func (e *Exporter) WriteFiles(statusFile, promFile string) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	err := writeFileAtomically(statusFile, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(e.status())
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(promFile, func(w io.Writer) error { return WriteMetrics(w, e.agents, e.scrape) })
+}
+
+// RunDaemon scans the clusters every opts.Interval, or on --schedule, until ctx is cancelled, rewriting
+// --output-file and --prom-file after each scan. Like serve, a failed scan keeps the agents of the previous
+// one and only updates the scrape metrics, and a failure to write the files is logged and retried after the
+// next scan
+func RunDaemon(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) {
+	exporter := &Exporter{}
+	event := logger.Info().Str("outputFile", opts.OutputFile).Str("promFile", opts.PromFile)
+	switch {
+	case opts.DeepSchedule != nil:
+		event.Msgf("writing results on schedule %v, with full scans on schedule %v", opts.Schedule, opts.DeepSchedule)
+	case opts.Schedule != nil:
+		event.Msgf("writing results on schedule %v", opts.Schedule)
+	default:
+		event.Msgf("writing results every %v", opts.Interval)
+	}
+	// The files are written after each poll and, with --events-queue, after each batch of state changes
+	var writing sync.Mutex
+	writeFiles := func() {
+		writing.Lock()
+		defer writing.Unlock()
+		if err := exporter.WriteFiles(opts.OutputFile, opts.PromFile); err != nil {
+			logger.Error().Err(err).Msgf("error writing results: %v", err)
+		}
+	}
+	if opts.eventsClient != nil {
+		go exporter.ConsumeEvents(ctx, opts.eventsClient, opts.EventsQueue, opts, writeFiles)
+	}
+	runPolls(ctx, opts, func(deep bool) {
+		exporter.poll(ctx, checkers, opts, deep)
+		if ctx.Err() != nil {
+			return
+		}
+		writeFiles()
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestDefaultPromFile(t *testing.T) {
+	for outputFile, want := range map[string]string{
+		"/var/lib/ecs-agent-status/latest.json": "/var/lib/ecs-agent-status/latest.prom",
+		"results":                               "results.prom",
+	} {
+		if got := DefaultPromFile(outputFile); got != want {
+			t.Errorf("DefaultPromFile(%q) = %q, want %q", outputFile, got, want)
+		}
+	}
+}
+
+func TestExporterWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	statusFile, promFile := filepath.Join(dir, "out", "latest.json"), filepath.Join(dir, "out", "latest.prom")
+	exporter := &Exporter{
+		agents: []agentstatus.Agent{{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true}},
+		policy: agentstatus.DefaultHealthPolicy,
+		scrape: ScrapeInfo{Time: time.Unix(1700000000, 0), Success: true},
+	}
+	exporter.updated = exporter.scrape.Time
+	if err := exporter.WriteFiles(statusFile, promFile); err != nil {
+		t.Fatalf("WriteFiles() error = %v", err)
+	}
+	data, err := os.ReadFile(statusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status ServeStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		t.Fatalf("status file is not JSON: %v", err)
+	}
+	if !status.Ready || len(status.Agents) != 1 || status.Summary.Agents != 1 {
+		t.Errorf("status file = %+v, want the exporter's agent", status)
+	}
+	data, err = os.ReadFile(promFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `ecs_agent_connected{region="us-east-1",cluster="web",container_instance="",ec2_instance_id="i-aaaa"} 1`) {
+		t.Errorf("prom file is missing the agent:\n%s", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(statusFile))
+	if len(entries) != 2 {
+		t.Errorf("output directory has %d entries, want only the two files", len(entries))
+	}
+}
+
+func TestParseScanArgsDaemon(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	opts, err := ParseScanArgs("check", []string{"--daemon", "--out", "/var/lib/ecs-agent-status/latest.json", "prod"})
+	if err != nil {
+		t.Fatalf("ParseScanArgs(--daemon) error = %v", err)
+	}
+	if !opts.Daemon || opts.PromFile != "/var/lib/ecs-agent-status/latest.prom" {
+		t.Errorf("ParseScanArgs(--daemon) = daemon %v, prom file %q", opts.Daemon, opts.PromFile)
+	}
+	if _, err := ParseScanArgs("check", []string{"--daemon", "prod"}); err == nil {
+		t.Error("ParseScanArgs(--daemon) without --out succeeded, want an error")
+	}
+	if _, err := ParseScanArgs("check", []string{"--daemon", "--out", "latest.json", "--output", "csv", "prod"}); err == nil {
+		t.Error("ParseScanArgs(--daemon --output csv) succeeded, want an error")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Change types reported by the diff command
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// FieldChange is a field of a container instance whose value differs between two snapshots
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// AgentChange is a container instance added, removed or changed between two snapshots
+type AgentChange struct {
+	Type                 string        `json:"type"`
+	Region               string        `json:"region"`
+	Cluster              string        `json:"cluster"`
+	ContainerInstanceARN string        `json:"containerInstanceArn"`
+	InstanceID           string        `json:"instanceId"`
+	Fields               []FieldChange `json:"fields,omitempty"`
+}
+
+// LoadSnapshot reads agents from a file written by --output json, either an array of agents or an object
+// mapping group names to agents as written with --group-by, optionally under agents as written with --summary,
+// scan errors or --report
+func LoadSnapshot(path string) ([]agentstatus.Agent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report struct {
+		Agents    json.RawMessage `json:"agents"`
+		Summaries json.RawMessage `json:"summaries"`
+		Errors    json.RawMessage `json:"errors"`
+		// SchemaVersion is set in the --report output
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if json.Unmarshal(data, &report) == nil && report.Agents != nil && (report.Summaries != nil || report.Errors != nil || report.SchemaVersion > 0) {
+		data = report.Agents
+	}
+	var agents []agentstatus.Agent
+	if err := json.Unmarshal(data, &agents); err == nil {
+		return agents, nil
+	}
+	var groups map[string][]agentstatus.Agent
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("parse %s: not the JSON output of ecs-agent-status: %w", path, err)
+	}
+	for _, group := range groups {
+		agents = append(agents, group...)
+	}
+	return agents, nil
+}
+
+// changedFields returns the status, connectivity and agent version changes of a container instance
+func changedFields(before, after agentstatus.Agent) []FieldChange {
+	var fields []FieldChange
+	if before.AgentStatus != after.AgentStatus {
+		fields = append(fields, FieldChange{"agentStatus", before.AgentStatus, after.AgentStatus})
+	}
+	if before.AgentConnected != after.AgentConnected {
+		fields = append(fields, FieldChange{"agentConnected", fmt.Sprint(before.AgentConnected), fmt.Sprint(after.AgentConnected)})
+	}
+	if before.AgentVersion != after.AgentVersion {
+		fields = append(fields, FieldChange{"agentVersion", before.AgentVersion, after.AgentVersion})
+	}
+	return fields
+}
+
+// DiffAgents compares two snapshots by container instance ARN and returns the instances added, removed or
+// whose status, connectivity or agent version changed, sorted by region, cluster and ARN
+func DiffAgents(before, after []agentstatus.Agent) []AgentChange {
+	previous := make(map[string]agentstatus.Agent)
+	for _, agent := range before {
+		previous[agent.ContainerInstanceARN] = agent
+	}
+	newChange := func(kind string, agent agentstatus.Agent) AgentChange {
+		return AgentChange{Type: kind, Region: agent.Region, Cluster: agent.Cluster, ContainerInstanceARN: agent.ContainerInstanceARN, InstanceID: agent.InstanceID()}
+	}
+	var changes []AgentChange
+	current := make(map[string]bool)
+	for _, agent := range after {
+		current[agent.ContainerInstanceARN] = true
+		old, ok := previous[agent.ContainerInstanceARN]
+		if !ok {
+			changes = append(changes, newChange(ChangeAdded, agent))
+			continue
+		}
+		if fields := changedFields(old, agent); len(fields) > 0 {
+			change := newChange(ChangeChanged, agent)
+			change.Fields = fields
+			changes = append(changes, change)
+		}
+	}
+	for _, agent := range before {
+		if !current[agent.ContainerInstanceARN] {
+			changes = append(changes, newChange(ChangeRemoved, agent))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.ContainerInstanceARN < b.ContainerInstanceARN
+	})
+	return changes
+}
+
+// WriteChanges writes the changes as text, one line per container instance, or as a JSON array
+func WriteChanges(w io.Writer, changes []AgentChange, output string) error {
+	if output == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if changes == nil {
+			changes = []AgentChange{}
+		}
+		return encoder.Encode(changes)
+	}
+	for _, change := range changes {
+		line := fmt.Sprintf("%v: Region: %v, Cluster: %v, ContainerInstanceARN: %v, InstanceID: %v",
+			change.Type, change.Region, change.Cluster, shortArn(change.ContainerInstanceARN), change.InstanceID)
+		for _, field := range change.Fields {
+			line += fmt.Sprintf(", %v: %v -> %v", field.Field, field.Old, field.New)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunDiff runs the diff command with args and returns its exit code: ExitHealthy when the snapshots match,
+// ExitUnhealthy when they differ and ExitError when they cannot be read
+func RunDiff(w io.Writer, args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	output := fs.String("output", "text", "output format: text or json (an array of changes)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status diff [flags] <old.json> <new.json>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return ExitError
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "invalid --output %q: must be text or json\n", *output)
+		return ExitError
+	}
+	before, err := LoadSnapshot(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	after, err := LoadSnapshot(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	changes := DiffAgents(before, after)
+	if err := WriteChanges(w, changes, *output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	if len(changes) > 0 {
+		return ExitUnhealthy
+	}
+	return ExitHealthy
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestDiffAgents(t *testing.T) {
+	before := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.75.0"},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.75.0"},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/cccc", EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.75.0"},
+	}
+	after := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.75.0"},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING", AgentConnected: true, AgentVersion: "1.76.0"},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/dddd", EC2InstanceID: "i-dddd", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.76.0"},
+	}
+	var buf bytes.Buffer
+	if err := WriteChanges(&buf, DiffAgents(before, after), "text"); err != nil {
+		t.Fatal(err)
+	}
+	want := "changed: Region: us-east-1, Cluster: web, ContainerInstanceARN: bbbb, InstanceID: i-bbbb, agentStatus: ACTIVE -> DRAINING, agentVersion: 1.75.0 -> 1.76.0\n" +
+		"removed: Region: us-east-1, Cluster: web, ContainerInstanceARN: cccc, InstanceID: i-cccc\n" +
+		"added: Region: us-east-1, Cluster: web, ContainerInstanceARN: dddd, InstanceID: i-dddd\n"
+	if got := buf.String(); got != want {
+		t.Errorf("DiffAgents() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	agents := []agentstatus.Agent{{Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", AgentStatus: "ACTIVE"}}
+	flat := write("flat.json", agents)
+	grouped := write("grouped.json", map[string][]agentstatus.Agent{"web": agents})
+	summarized := write("summarized.json", jsonReport{Agents: agents, Summaries: agentstatus.SummarizeClusters(agents)})
+
+	if code := RunDiff(&bytes.Buffer{}, []string{flat, grouped}); code != ExitHealthy {
+		t.Errorf("RunDiff() of matching snapshots = %v, want %v", code, ExitHealthy)
+	}
+	if code := RunDiff(&bytes.Buffer{}, []string{flat, summarized}); code != ExitHealthy {
+		t.Errorf("RunDiff() of a snapshot with summaries = %v, want %v", code, ExitHealthy)
+	}
+	report := write("report.json", newReportOutput(agents, Options{}, time.Now()))
+	if code := RunDiff(&bytes.Buffer{}, []string{flat, report}); code != ExitHealthy {
+		t.Errorf("RunDiff() of a --report snapshot = %v, want %v", code, ExitHealthy)
+	}
+	var buf bytes.Buffer
+	if code := RunDiff(&buf, []string{"--output", "json", flat, write("empty.json", []agentstatus.Agent{})}); code != ExitUnhealthy {
+		t.Errorf("RunDiff() of differing snapshots = %v, want %v", code, ExitUnhealthy)
+	}
+	var changes []AgentChange
+	if err := json.Unmarshal(buf.Bytes(), &changes); err != nil || len(changes) != 1 || changes[0].Type != ChangeRemoved {
+		t.Errorf("RunDiff() json output = %v, %v", changes, err)
+	}
+	if code := RunDiff(&bytes.Buffer{}, []string{flat}); code != ExitError {
+		t.Errorf("RunDiff() with one file = %v, want %v", code, ExitError)
+	}
+}
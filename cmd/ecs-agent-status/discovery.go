@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// DiscoveryCache is the --cluster-cache file: the ARNs of every cluster of each region, so that runs within
+// --cluster-cache-ttl of a listing match the cluster name patterns without calling ListClusters
+type DiscoveryCache struct {
+	// Regions is keyed by the ScopeKey of each region, prefixed with the --profile and --role-arn it was
+	// listed with, so that a cache shared by several accounts does not mix up their clusters
+	Regions map[string]DiscoveredClusters `json:"regions"`
+}
+
+// DiscoveredClusters are the clusters of a region and when they were listed
+type DiscoveredClusters struct {
+	ListedAt    time.Time `json:"listedAt"`
+	ClusterArns []string  `json:"clusterArns"`
+}
+
+// LoadDiscoveryCache reads the cluster cache file at path. A missing file is an empty cache
+func LoadDiscoveryCache(path string) (DiscoveryCache, error) {
+	cache := DiscoveryCache{Regions: make(map[string]DiscoveredClusters)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return DiscoveryCache{Regions: make(map[string]DiscoveredClusters)}, fmt.Errorf("parse cluster cache %s: %w", path, err)
+	}
+	if cache.Regions == nil {
+		cache.Regions = make(map[string]DiscoveredClusters)
+	}
+	return cache, nil
+}
+
+// SaveDiscoveryCache replaces the cluster cache file at path with cache
+func SaveDiscoveryCache(path string, cache DiscoveryCache) error {
+	f, err := CreateAtomicFile(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(cache); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// discoveryKey returns the key of a region in the cluster cache
+func discoveryKey(opts Options, scope string) string {
+	key := scope
+	if opts.AssumeRole.RoleARN != "" {
+		key = opts.AssumeRole.RoleARN + " " + key
+	}
+	if opts.Profile != "" {
+		key = "profile " + opts.Profile + " " + key
+	}
+	return key
+}
+
+// ListCachedRegionClusters is ListRegionClusters through the --cluster-cache file: the clusters of each
+// region listed less than --cluster-cache-ttl before now are read from the cache, unless --refresh-clusters
+// is given, and the others are listed and written back to it. A cache that cannot be read or written is
+// logged and the clusters are listed as without one
+func ListCachedRegionClusters(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options, now time.Time) (map[string][]string, map[string]error) {
+	cache, err := LoadDiscoveryCache(opts.ClusterCacheFile)
+	if err != nil {
+		logger.Warn().Err(err).Msgf("error reading the cluster cache %v, listing every cluster", opts.ClusterCacheFile)
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	clustersByRegion := make(map[string][]string)
+	errs := make(map[string]error)
+	updated := false
+	for region, checker := range checkers {
+		wg.Add(1)
+		go func(region string, checker *agentstatus.StatusChecker) {
+			defer wg.Done()
+			key := discoveryKey(opts, region)
+			mu.Lock()
+			cached, ok := cache.Regions[key]
+			mu.Unlock()
+			arns := cached.ClusterArns
+			if !ok || opts.RefreshClusters || now.Sub(cached.ListedAt) >= opts.ClusterCacheTTL {
+				var err error
+				arns, err = checker.ListClusterArns(ctx)
+				if err != nil {
+					mu.Lock()
+					errs[region] = err
+					mu.Unlock()
+					return
+				}
+				mu.Lock()
+				cache.Regions[key] = DiscoveredClusters{ListedAt: now, ClusterArns: arns}
+				updated = true
+				mu.Unlock()
+			} else {
+				logger.Debug().Str("region", checker.Region).Time("listedAt", cached.ListedAt).Int("clusters", len(arns)).
+					Msg("using the cached clusters of the region")
+			}
+			refs, err := agentstatus.MatchClusters(arns, opts.ClusterPatterns, opts.Match)
+			if err == nil {
+				refs, err = agentstatus.ExcludeClusters(refs, opts.Exclude, opts.Match)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, agentstatus.ErrNoClustersMatched):
+			case err != nil:
+				errs[region] = err
+			default:
+				for _, ref := range refs {
+					clustersByRegion[region] = append(clustersByRegion[region], ref.Name)
+				}
+			}
+		}(region, checker)
+	}
+	wg.Wait()
+	if updated && ctx.Err() == nil {
+		if err := SaveDiscoveryCache(opts.ClusterCacheFile, cache); err != nil {
+			logger.Warn().Err(err).Msgf("error writing the cluster cache %v", opts.ClusterCacheFile)
+		}
+	}
+	return clustersByRegion, errs
+}
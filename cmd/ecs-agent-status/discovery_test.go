@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// listingECS answers ListClusters with its cluster ARNs, counting the calls
+type listingECS struct {
+	agentstatus.ECSClient
+	arns  []string
+	calls int
+}
+
+func (m *listingECS) ListClusters(context.Context, *ecs.ListClustersInput, ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+	m.calls++
+	return &ecs.ListClustersOutput{ClusterArns: m.arns}, nil
+}
+
+func TestListCachedRegionClusters(t *testing.T) {
+	client := &listingECS{arns: []string{
+		"arn:aws:ecs:us-east-1:123456789012:cluster/prod-web",
+		"arn:aws:ecs:us-east-1:123456789012:cluster/prod-api",
+		"arn:aws:ecs:us-east-1:123456789012:cluster/staging-web",
+	}}
+	checkers := map[string]*agentstatus.StatusChecker{"us-east-1": agentstatus.NewStatusChecker(client, "us-east-1")}
+	opts := Options{
+		ClusterPatterns:  []string{"prod"},
+		Exclude:          []string{"api"},
+		ClusterCacheFile: filepath.Join(t.TempDir(), "cache", "clusters.json"),
+		ClusterCacheTTL:  time.Hour,
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	list := func(opts Options, now time.Time) map[string][]string {
+		t.Helper()
+		clusters, errs := ListCachedRegionClusters(context.Background(), checkers, opts, now)
+		if len(errs) > 0 {
+			t.Fatalf("ListCachedRegionClusters() errors = %v", errs)
+		}
+		return clusters
+	}
+
+	want := map[string][]string{"us-east-1": {"prod-web"}}
+	if got := list(opts, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListCachedRegionClusters() = %v, want %v", got, want)
+	}
+	opts.ClusterPatterns = []string{"web"}
+	want = map[string][]string{"us-east-1": {"prod-web", "staging-web"}}
+	if got := list(opts, now.Add(30*time.Minute)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListCachedRegionClusters() from the cache = %v, want %v", got, want)
+	}
+	if client.calls != 1 {
+		t.Errorf("ListClusters called %v times within the TTL, want 1", client.calls)
+	}
+
+	list(opts, now.Add(2*time.Hour))
+	opts.RefreshClusters = true
+	list(opts, now.Add(2*time.Hour))
+	if client.calls != 3 {
+		t.Errorf("ListClusters called %v times after the TTL and with --refresh-clusters, want 3", client.calls)
+	}
+
+	opts.RefreshClusters = false
+	opts.Profile = "other"
+	list(opts, now.Add(2*time.Hour))
+	if client.calls != 4 {
+		t.Errorf("ListClusters called %v times for another profile, want 4", client.calls)
+	}
+	cache, err := LoadDiscoveryCache(opts.ClusterCacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.Regions) != 2 || len(cache.Regions["profile other us-east-1"].ClusterArns) != 3 {
+		t.Errorf("LoadDiscoveryCache() = %+v, want the clusters of both profiles", cache)
+	}
+
+	if err := os.WriteFile(opts.ClusterCacheFile, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := list(opts, now.Add(2*time.Hour)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListCachedRegionClusters() with a corrupt cache = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// drainWaitPollInterval is how often drain --wait re-checks the running tasks of the draining instances
+const drainWaitPollInterval = 15 * time.Second
+
+// ResolveDrainTargets looks up each container instance of the cluster, by ARN, ID or EC2 instance ID, and
+// returns them grouped by ScopeKey. Any instance that cannot be found fails the lookup, so that nothing is
+// drained when an ID is mistyped
+func ResolveDrainTargets(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, cluster string, ids []string) (map[string][]agentstatus.Agent, error) {
+	targets := make(map[string][]agentstatus.Agent)
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		agent, err := findAgent(ctx, checkers, cluster, id)
+		if err != nil {
+			return nil, err
+		}
+		if seen[agent.ContainerInstanceARN] {
+			continue
+		}
+		seen[agent.ContainerInstanceARN] = true
+		scope := scopeIn(checkers, agent.AccountID, agent.Region)
+		targets[scope] = append(targets[scope], agent)
+	}
+	return targets, nil
+}
+
+// drainLabel returns how a draining instance is named in the progress: its EC2 instance ID, or the ID of
+// its container instance
+func drainLabel(agent agentstatus.Agent) string {
+	if agent.EC2InstanceID != "" {
+		return agent.EC2InstanceID
+	}
+	return shortArn(agent.ContainerInstanceARN)
+}
+
+// WaitForTasks polls the container instances of a cluster every interval until none of them has running
+// tasks, writing a progress line to w after each poll. If ctx ends first, its error is returned
+func WaitForTasks(ctx context.Context, w io.Writer, checker *agentstatus.StatusChecker, cluster string, targets []agentstatus.Agent, interval time.Duration) error {
+	arns := make([]string, len(targets))
+	labels := make(map[string]string)
+	for i, agent := range targets {
+		arns[i] = agent.ContainerInstanceARN
+		labels[agent.ContainerInstanceARN] = drainLabel(agent)
+	}
+	for {
+		output, err := checker.DescribeContainerInstances(ctx, cluster, arns)
+		if err != nil {
+			return err
+		}
+		var busy []string
+		var running int32
+		for _, instance := range output.ContainerInstances {
+			if instance.RunningTasksCount > 0 {
+				busy = append(busy, fmt.Sprintf("%v (%v)", labels[aws.ToString(instance.ContainerInstanceArn)], instance.RunningTasksCount))
+				running += instance.RunningTasksCount
+			}
+		}
+		sort.Strings(busy)
+		line := fmt.Sprintf("%v Cluster: %v, %v of %v container instances drained", time.Now().UTC().Format(time.RFC3339), cluster, len(arns)-len(busy), len(arns))
+		if len(busy) > 0 {
+			line += fmt.Sprintf(", %v running tasks: %v", running, strings.Join(busy, ", "))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if len(busy) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runDrain sets the container instances given to drain to DRAINING and, with --wait, waits up to
+// --wait-timeout for their tasks to stop. It returns the exit code: ExitUnhealthy when tasks are still
+// running at the timeout
+func runDrain(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	cluster := opts.ClusterPatterns[0]
+	targets, err := ResolveDrainTargets(ctx, checkers, cluster, opts.DrainInstances)
+	switch {
+	case ctx.Err() != nil:
+		return cancelledExitCode(ctx, opts, "while getting the container instances")
+	case err != nil:
+		logger.Error().Err(err).Msgf("error getting the container instances to drain: %v", err)
+		return ExitError
+	}
+	for _, scope := range SortedRegions(checkers) {
+		if len(targets[scope]) == 0 {
+			continue
+		}
+		arns := make([]string, len(targets[scope]))
+		for i, agent := range targets[scope] {
+			arns[i] = agent.ContainerInstanceARN
+			logger.Info().Str("region", agent.Region).Str("cluster", cluster).Str("containerInstanceArn", agent.ContainerInstanceARN).
+				Str("ec2InstanceId", agent.EC2InstanceID).Int("runningTasks", agent.RunningTasks).Msgf("draining %v", drainLabel(agent))
+		}
+		err := checkers[scope].DrainContainerInstances(ctx, cluster, arns)
+		for _, agent := range targets[scope] {
+			auditLog.Record(ctx, NewAuditRecord(AuditDrain, agent, &AuditState{AgentStatus: "DRAINING"}, err))
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("region", checkers[scope].Region).Msgf("error draining container instances in cluster %v: %v", cluster, err)
+			return ExitError
+		}
+	}
+	if !opts.Wait {
+		return ExitHealthy
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.WaitTimeout)
+	defer cancel()
+	for _, scope := range SortedRegions(checkers) {
+		if len(targets[scope]) == 0 {
+			continue
+		}
+		err := WaitForTasks(waitCtx, os.Stdout, checkers[scope], cluster, targets[scope], drainWaitPollInterval)
+		switch {
+		case ctx.Err() != nil:
+			return cancelledExitCode(ctx, opts, "while waiting for the container instances to drain")
+		case waitCtx.Err() != nil:
+			logger.Error().Dur("waitTimeout", opts.WaitTimeout).Msgf("tasks were still running on the draining container instances after %v", opts.WaitTimeout)
+			return ExitUnhealthy
+		case err != nil:
+			logger.Error().Err(err).Msgf("error checking the draining container instances: %v", err)
+			return ExitError
+		}
+	}
+	return ExitHealthy
+}
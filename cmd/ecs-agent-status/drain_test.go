@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// drainingECS answers DescribeContainerInstances with the next of its polls of running task counts per ARN
+type drainingECS struct {
+	agentstatus.ECSClient
+	polls []map[string]int32
+}
+
+func (m *drainingECS) DescribeContainerInstances(_ context.Context, params *ecs.DescribeContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+	poll := m.polls[0]
+	if len(m.polls) > 1 {
+		m.polls = m.polls[1:]
+	}
+	output := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range params.ContainerInstances {
+		output.ContainerInstances = append(output.ContainerInstances, types.ContainerInstance{ContainerInstanceArn: aws.String(arn), RunningTasksCount: poll[arn]})
+	}
+	return output, nil
+}
+
+func TestWaitForTasks(t *testing.T) {
+	a, b := "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb"
+	client := &drainingECS{polls: []map[string]int32{{a: 3, b: 1}, {a: 2}, {}}}
+	targets := []agentstatus.Agent{{ContainerInstanceARN: a, EC2InstanceID: "i-aaaa"}, {ContainerInstanceARN: b}}
+	var buf bytes.Buffer
+	if err := WaitForTasks(context.Background(), &buf, agentstatus.NewStatusChecker(client, "us-east-1"), "web", targets, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"Cluster: web, 0 of 2 container instances drained, 4 running tasks: bbbb (1), i-aaaa (3)",
+		"Cluster: web, 1 of 2 container instances drained, 2 running tasks: i-aaaa (2)",
+		"Cluster: web, 2 of 2 container instances drained",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("WaitForTasks() wrote %v lines, want %v:\n%v", len(lines), len(want), buf.String())
+	}
+	for i := range want {
+		// Each line starts with the time of the poll
+		if _, progress, _ := strings.Cut(lines[i], " "); progress != want[i] {
+			t.Errorf("WaitForTasks() line %v = %q, want %q", i, progress, want[i])
+		}
+	}
+
+	client.polls = []map[string]int32{{a: 1}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitForTasks(ctx, &bytes.Buffer{}, agentstatus.NewStatusChecker(client, "us-east-1"), "web", targets, time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("WaitForTasks() with tasks left at the timeout = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// LogDuplicateRegistrations logs each instance registered as more than one container instance, once, with
+// the clusters it is registered in
+func LogDuplicateRegistrations(agents []agentstatus.Agent) {
+	logged := make(map[string]bool)
+	for _, agent := range agents {
+		id := agent.InstanceID()
+		if len(agent.DuplicateRegistrations) == 0 || logged[id] {
+			continue
+		}
+		logged[id] = true
+		registrations := append([]string{agent.ContainerInstanceARN}, agent.DuplicateRegistrations...)
+		labels := make([]string, len(registrations))
+		for i, arn := range registrations {
+			labels[i] = registrationLabel(arn)
+		}
+		logger.Warn().Str("ec2InstanceId", id).Strs("containerInstanceArns", registrations).
+			Msgf("instance %v is registered as %v container instances: %v", id, len(registrations), strings.Join(labels, ", "))
+	}
+}
+
+// registrationLabel returns the cluster and ID of a container instance ARN, e.g. web/0123abcd, or the ID
+// alone for ARNs in the old format without the cluster
+func registrationLabel(arn string) string {
+	_, resource, found := strings.Cut(arn, ":container-instance/")
+	if !found {
+		return shortArn(arn)
+	}
+	return resource
+}
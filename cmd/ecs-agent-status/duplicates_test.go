@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestRegistrationLabel(t *testing.T) {
+	for arn, want := range map[string]string{
+		"arn:aws:ecs:us-east-1:123456789012:container-instance/web/0123abcd": "web/0123abcd",
+		"arn:aws:ecs:us-east-1:123456789012:container-instance/0123abcd":     "0123abcd",
+	} {
+		if got := registrationLabel(arn); got != want {
+			t.Errorf("registrationLabel(%q) = %q, want %q", arn, got, want)
+		}
+	}
+}
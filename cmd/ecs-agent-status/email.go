@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// emailAttachmentName is the file name of the HTML report attached by --email-attach-html
+const emailAttachmentName = "ecs-agent-status.html"
+
+// SESSender is the subset of the SES v2 API used to send the report email
+type SESSender interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// EmailSubject returns the subject of the report email, summarizing the health of the agents
+func EmailSubject(summary agentstatus.Summary) string {
+	if summary.Unhealthy > 0 {
+		return fmt.Sprintf("ecs-agent-status: %v of %v agents unhealthy in %v clusters", summary.Unhealthy, summary.Agents, summary.Clusters)
+	}
+	return fmt.Sprintf("ecs-agent-status: all %v agents healthy in %v clusters", summary.Agents, summary.Clusters)
+}
+
+// EmailBody returns the plain text body of the report email: the run summary followed by a line per
+// unhealthy agent
+func EmailBody(agents []agentstatus.Agent, opts Options, now time.Time) string {
+	summary := agentstatus.Summarize(agents, opts.HealthPolicy)
+	var body strings.Builder
+	fmt.Fprintf(&body, "ecs-agent-status report for %v\n\n%v\n", now.UTC().Format(time.RFC3339), summary)
+	unhealthy := opts.HealthPolicy.UnhealthyAgents(agents)
+	if len(unhealthy) > 0 {
+		fmt.Fprintf(&body, "\nUnhealthy agents:\n")
+	}
+	opts.Color = false
+	for _, agent := range unhealthy {
+		fmt.Fprintf(&body, "%v\n", FormatAgent(agent, opts))
+	}
+	return body.String()
+}
+
+// NewEmailMessage returns the raw MIME message of the report email, with the HTML report as an attachment
+// when html is not empty
+func NewEmailMessage(from string, to []string, subject, body string, html []byte) ([]byte, error) {
+	var msg bytes.Buffer
+	// The multipart writer only writes once the first part is created, so the headers go first
+	writer := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "From: %v\r\nTo: %v\r\nSubject: %v\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%v\r\n\r\n",
+		from, strings.Join(to, ", "), mime.QEncoding.Encode("utf-8", subject), writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	if len(html) > 0 {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/html; charset=utf-8"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", emailAttachmentName)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Wrap the base64 text at 76 characters, the longest line MIME allows
+		encoded := base64.StdEncoding.EncodeToString(html)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%v\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%v\r\n", encoded)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// SendEmailReport sends the run summary to --email-to from --ses-from through SES, attaching the HTML
+// report with --email-attach-html
+func SendEmailReport(ctx context.Context, client SESSender, agents []agentstatus.Agent, opts Options, now time.Time) error {
+	var html bytes.Buffer
+	if opts.EmailAttachHTML {
+		if err := WriteHTML(&html, agents, opts, now); err != nil {
+			return err
+		}
+	}
+	subject := EmailSubject(agentstatus.Summarize(agents, opts.HealthPolicy))
+	message, err := NewEmailMessage(opts.SESFrom, opts.EmailTo, subject, EmailBody(agents, opts, now), html.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: &opts.SESFrom,
+		Destination:      &types.Destination{ToAddresses: opts.EmailTo},
+		Content:          &types.EmailContent{Raw: &types.RawMessage{Data: message}},
+	})
+	if err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	return nil
+}
+
+// NotifyEmail sends the report email with the --profile credentials in --ses-region, or the region of the
+// AWS config when it is not set
+func NotifyEmail(ctx context.Context, agents []agentstatus.Agent, opts Options) error {
+	var regions []string
+	if opts.SESRegion != "" {
+		regions = []string{opts.SESRegion}
+	}
+	cfgs, err := agentstatus.LoadAWSConfigs(ctx, regions, opts.Profile)
+	if err != nil {
+		return err
+	}
+	var cfg aws.Config
+	for _, loaded := range cfgs {
+		cfg = agentstatus.WithRetries(agentstatus.WithEndpoint(loaded, opts.EndpointURL), opts.Retry)
+	}
+	return SendEmailReport(ctx, sesv2.NewFromConfig(cfg), agents, opts, time.Now())
+}
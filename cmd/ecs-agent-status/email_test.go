@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+type mockSES struct {
+	input *sesv2.SendEmailInput
+}
+
+func (m *mockSES) SendEmail(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	m.input = params
+	return &sesv2.SendEmailOutput{}, nil
+}
+
+func TestEmailSubject(t *testing.T) {
+	tests := []struct {
+		summary agentstatus.Summary
+		want    string
+	}{
+		{agentstatus.Summary{Clusters: 2, Agents: 5}, "ecs-agent-status: all 5 agents healthy in 2 clusters"},
+		{agentstatus.Summary{Clusters: 2, Agents: 5, Unhealthy: 1}, "ecs-agent-status: 1 of 5 agents unhealthy in 2 clusters"},
+	}
+	for _, tt := range tests {
+		if got := EmailSubject(tt.summary); got != tt.want {
+			t.Errorf("EmailSubject(%+v) = %q, want %q", tt.summary, got, tt.want)
+		}
+	}
+}
+
+func TestSendEmailReport(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", AgentConnected: true, AgentStatus: "ACTIVE"},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-bbbb", AgentConnected: true, AgentStatus: "DRAINING"},
+	}
+	opts := Options{EmailTo: []string{"ops@example.com", "oncall@example.com"}, SESFrom: "noreply@example.com", HealthPolicy: agentstatus.DefaultHealthPolicy}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	client := &mockSES{}
+	if err := SendEmailReport(context.Background(), client, agents, opts, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.ToString(client.input.FromEmailAddress); got != "noreply@example.com" {
+		t.Errorf("SendEmailReport() from = %v", got)
+	}
+	if got := client.input.Destination.ToAddresses; len(got) != 2 {
+		t.Errorf("SendEmailReport() to = %v", got)
+	}
+	header, parts := readEmailMessage(t, client.input.Content.Raw.Data)
+	if got := header.Get("To"); got != "ops@example.com, oncall@example.com" {
+		t.Errorf("SendEmailReport() To = %q", got)
+	}
+	if got := header.Get("Subject"); got != "ecs-agent-status: 1 of 2 agents unhealthy in 1 clusters" {
+		t.Errorf("SendEmailReport() Subject = %q", got)
+	}
+	if len(parts) != 1 {
+		t.Fatalf("SendEmailReport() message has %v parts, want 1", len(parts))
+	}
+	if body := parts[0]; !strings.Contains(body, "Unhealthy agents:\r\n") || !strings.Contains(body, "i-bbbb") || strings.Contains(body, "i-aaaa") {
+		t.Errorf("SendEmailReport() body = %q", body)
+	}
+
+	opts.EmailAttachHTML = true
+	if err := SendEmailReport(context.Background(), client, agents, opts, now); err != nil {
+		t.Fatal(err)
+	}
+	_, parts = readEmailMessage(t, client.input.Content.Raw.Data)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "<!DOCTYPE html>") {
+		t.Errorf("SendEmailReport() message has no HTML attachment: %q", parts)
+	}
+}
+
+// readEmailMessage parses a raw report email and returns its header and the decoded content of its parts
+func readEmailMessage(t *testing.T, data []byte) (mail.Header, []string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []string
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var content io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			content = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		decoded, err := io.ReadAll(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, string(decoded))
+	}
+	return msg.Header, parts
+}
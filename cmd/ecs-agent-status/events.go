@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// containerInstanceStateChange is the detail type of the events ECS sends when a container instance
+// changes, e.g. when its agent disconnects or reconnects or it starts draining
+const containerInstanceStateChange = "ECS Container Instance State Change"
+
+// containerInstanceEventPattern is the pattern of the EventBridge rule created by install-events. It matches
+// every state change, so that reconnections reach the consumers as well as disconnections
+const containerInstanceEventPattern = `{"source":["aws.ecs"],"detail-type":["` + containerInstanceStateChange + `"]}`
+
+// DefaultEventRuleName is the name of the EventBridge rule created by install-events
+const DefaultEventRuleName = "ecs-agent-status-container-instance-state"
+
+// eventTargetID is the ID of the target install-events adds to the rule
+const eventTargetID = "ecs-agent-status"
+
+// eventsRetryDelay is how long ConsumeEvents waits after failing to receive messages before trying again
+var eventsRetryDelay = 5 * time.Second
+
+// EventRule is an EventBridge rule as PutRule takes it, and as install-events --dry-run prints it
+type EventRule struct {
+	Name         string `json:"Name"`
+	EventBusName string `json:"EventBusName,omitempty"`
+	EventPattern string `json:"EventPattern"`
+	Description  string `json:"Description,omitempty"`
+	State        string `json:"State"`
+}
+
+// EventTarget is a target of an EventBridge rule as PutTargets takes it
+type EventTarget struct {
+	ID  string `json:"Id"`
+	Arn string `json:"Arn"`
+}
+
+// EventRuleInstaller is the subset of the EventBridge API used by install-events. It is satisfied by
+// *eventbridge.Client
+type EventRuleInstaller interface {
+	PutRule(ctx context.Context, params *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error)
+	PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error)
+}
+
+// NewEventRule returns the rule of install-events on the bus, matching the container instance state
+// changes
+func NewEventRule(name, bus string) EventRule {
+	return EventRule{
+		Name:         name,
+		EventBusName: bus,
+		EventPattern: containerInstanceEventPattern,
+		Description:  "ECS container instance state changes, e.g. agent disconnects, sent by ecs-agent-status install-events",
+		State:        "ENABLED",
+	}
+}
+
+// InstallEvents creates or updates the rule sending the container instance state changes of the bus to
+// target, e.g. an SNS topic or SQS queue, and returns the ARN of the rule
+func InstallEvents(ctx context.Context, client EventRuleInstaller, rule EventRule, target string) (string, error) {
+	output, err := client.PutRule(ctx, &eventbridge.PutRuleInput{
+		Name:         aws.String(rule.Name),
+		EventBusName: aws.String(rule.EventBusName),
+		EventPattern: aws.String(rule.EventPattern),
+		Description:  aws.String(rule.Description),
+		State:        eventbridgetypes.RuleState(rule.State),
+	})
+	if err != nil {
+		return "", fmt.Errorf("put rule %v: %w", rule.Name, err)
+	}
+	ruleArn := aws.ToString(output.RuleArn)
+	targets, err := client.PutTargets(ctx, &eventbridge.PutTargetsInput{
+		Rule:         aws.String(rule.Name),
+		EventBusName: aws.String(rule.EventBusName),
+		Targets:      []eventbridgetypes.Target{{Id: aws.String(eventTargetID), Arn: aws.String(target)}},
+	})
+	if err != nil {
+		return ruleArn, fmt.Errorf("put targets of rule %v: %w", rule.Name, err)
+	}
+	if targets.FailedEntryCount > 0 && len(targets.FailedEntries) > 0 {
+		failed := targets.FailedEntries[0]
+		return ruleArn, fmt.Errorf("put target %v of rule %v: %v: %v", aws.ToString(failed.TargetId), rule.Name,
+			aws.ToString(failed.ErrorCode), aws.ToString(failed.ErrorMessage))
+	}
+	return ruleArn, nil
+}
+
+// runInstallEvents creates the EventBridge rule of install-events in the region of the AWS config, or with
+// --dry-run prints it. It returns the exit code
+func runInstallEvents(ctx context.Context, cfgs map[string]aws.Config, opts Options) int {
+	if len(cfgs) != 1 {
+		logger.Error().Msg("install-events creates the rule in one region: pass a single --region, without --regions, --all-regions or --all-accounts")
+		return ExitError
+	}
+	var cfg aws.Config
+	for _, c := range cfgs {
+		cfg = c
+	}
+	rule := NewEventRule(opts.EventRuleName, opts.EventBus)
+	if target, err := arn.Parse(opts.EventTarget); err == nil && target.Region != "" && target.Region != cfg.Region {
+		logger.Error().Str("region", cfg.Region).Str("target", opts.EventTarget).
+			Msgf("the target of the rule must be in its region %v, not %v", cfg.Region, target.Region)
+		return ExitError
+	}
+	if opts.DryRun {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(struct {
+			Region  string        `json:"region"`
+			Rule    EventRule     `json:"rule"`
+			Targets []EventTarget `json:"targets"`
+		}{cfg.Region, rule, []EventTarget{{ID: eventTargetID, Arn: opts.EventTarget}}})
+		if err != nil {
+			logger.Error().Err(err).Msg("error writing output")
+			return ExitError
+		}
+		return ExitHealthy
+	}
+	ruleArn, err := InstallEvents(ctx, eventbridge.NewFromConfig(cfg), rule, opts.EventTarget)
+	if err != nil {
+		logger.Error().Err(err).Str("rule", rule.Name).Msgf("error installing the EventBridge rule %v: %v", rule.Name, err)
+		return ExitError
+	}
+	logger.Info().Str("ruleArn", ruleArn).Str("target", opts.EventTarget).
+		Msgf("rule %v sends the container instance state changes of bus %v to %v. Its resource policy must allow events.amazonaws.com to deliver them", rule.Name, rule.EventBusName, opts.EventTarget)
+	return ExitHealthy
+}
+
+// containerInstanceDetail is the detail of a container instance state change: the container instance, as
+// DescribeContainerInstances returns it
+type containerInstanceDetail struct {
+	ContainerInstanceARN string `json:"containerInstanceArn"`
+	ClusterARN           string `json:"clusterArn"`
+	EC2InstanceID        string `json:"ec2InstanceId"`
+	AgentConnected       bool   `json:"agentConnected"`
+	Status               string `json:"status"`
+	AgentUpdateStatus    string `json:"agentUpdateStatus"`
+	RunningTasksCount    int    `json:"runningTasksCount"`
+	PendingTasksCount    int    `json:"pendingTasksCount"`
+	VersionInfo          struct {
+		AgentVersion string `json:"agentVersion"`
+	} `json:"versionInfo"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ContainerInstanceEvent is an ECS container instance state change as EventBridge delivers it
+type ContainerInstanceEvent struct {
+	DetailType string                  `json:"detail-type"`
+	Source     string                  `json:"source"`
+	Time       time.Time               `json:"time"`
+	Detail     containerInstanceDetail `json:"detail"`
+}
+
+// ParseContainerInstanceEvent parses the body of an SQS message holding a container instance state change:
+// the event itself, sent by the rule to the queue, or an SNS notification of it, sent by the topic the rule
+// targets to a queue subscribed without raw message delivery
+func ParseContainerInstanceEvent(body string) (ContainerInstanceEvent, error) {
+	var notification struct {
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+	if json.Unmarshal([]byte(body), &notification) == nil && notification.Type == "Notification" {
+		body = notification.Message
+	}
+	var event ContainerInstanceEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return event, fmt.Errorf("invalid event: %w", err)
+	}
+	if event.DetailType != containerInstanceStateChange || event.Detail.ContainerInstanceARN == "" {
+		return event, fmt.Errorf("not an %v event: %q", containerInstanceStateChange, event.DetailType)
+	}
+	return event, nil
+}
+
+// ApplyEvent updates the exported agent of the container instance of the event with its new state, or
+// removes it once it is deregistered, and reports whether it did. Events older than the last scan and
+// container instances the last scan did not find, which the next one adds, are ignored
+func (e *Exporter) ApplyEvent(event ContainerInstanceEvent, opts Options) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	detail := event.Detail
+	if e.updated.IsZero() || detail.UpdatedAt.Before(e.updated) {
+		return false
+	}
+	i := slices.IndexFunc(e.agents, func(agent agentstatus.Agent) bool { return agent.ContainerInstanceARN == detail.ContainerInstanceARN })
+	if i < 0 {
+		return false
+	}
+	// The agents may still be read by RefreshState, so they are copied rather than changed in place
+	if detail.Status == "INACTIVE" {
+		e.agents = slices.Delete(slices.Clone(e.agents), i, i+1)
+		return true
+	}
+	agents := slices.Clone(e.agents)
+	updateAgentState(&agents[i], agentstatus.Agent{AgentConnected: detail.AgentConnected, AgentStatus: detail.Status,
+		AgentUpdateStatus: detail.AgentUpdateStatus, AgentVersion: detail.VersionInfo.AgentVersion,
+		RunningTasks: detail.RunningTasksCount, PendingTasks: detail.PendingTasksCount})
+	if opts.MinAgentVersion != "" {
+		agents[i].Outdated = false
+		agentstatus.MarkOutdated(agents[i:i+1], opts.MinAgentVersion)
+	}
+	e.agents = agents
+	return true
+}
+
+// SQSReceiver is the part of the SQS API that ConsumeEvents uses
+type SQSReceiver interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// ConsumeEvents receives the container instance state changes sent to the SQS queue and applies them to the
+// exported agents between scans, until ctx is cancelled, calling changed after each batch of messages that
+// changed an agent. Every message is deleted once read, including those that are not such events
+func (e *Exporter) ConsumeEvents(ctx context.Context, client SQSReceiver, queueURL string, opts Options, changed func()) {
+	logger.Info().Str("queue", queueURL).Msgf("applying the container instance state changes of queue %v", queueURL)
+	for ctx.Err() == nil {
+		output, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), MaxNumberOfMessages: 10, WaitTimeSeconds: 20})
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error().Err(err).Str("queue", queueURL).Msgf("error receiving events: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(eventsRetryDelay):
+				}
+			}
+			continue
+		}
+		applied := false
+		for _, message := range output.Messages {
+			event, err := ParseContainerInstanceEvent(aws.ToString(message.Body))
+			switch {
+			case err != nil:
+				logger.Warn().Err(err).Str("messageId", aws.ToString(message.MessageId)).Msgf("skipping message %v: %v", aws.ToString(message.MessageId), err)
+			case e.ApplyEvent(event, opts):
+				applied = true
+				logger.Debug().Str("containerInstanceArn", event.Detail.ContainerInstanceARN).Str("agentStatus", event.Detail.Status).
+					Bool("agentConnected", event.Detail.AgentConnected).Msgf("applied the state change of %v", shortArn(event.Detail.ContainerInstanceARN))
+			}
+			if _, err := client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: message.ReceiptHandle}); err != nil && ctx.Err() == nil {
+				logger.Warn().Err(err).Str("messageId", aws.ToString(message.MessageId)).Msg("error deleting message")
+			}
+		}
+		if applied && changed != nil {
+			changed()
+		}
+	}
+}
+
+// queueRegion returns the region of an SQS queue URL, e.g. https://sqs.us-east-1.amazonaws.com/123456789012/events,
+// or "" if it has none, e.g. for a local endpoint
+func queueRegion(queueURL string) string {
+	parsed, err := url.Parse(queueURL)
+	if err != nil {
+		return ""
+	}
+	labels := strings.Split(parsed.Hostname(), ".")
+	switch {
+	case len(labels) >= 4 && labels[0] == "sqs":
+		return labels[1]
+	case len(labels) >= 4 && labels[1] == "queue":
+		return labels[0]
+	}
+	return ""
+}
+
+// NewEventsQueueClient returns an SQS client for --events-queue, using the AWS config of the queue's region,
+// loading it if that region was not scanned
+func NewEventsQueueClient(ctx context.Context, cfgs map[string]aws.Config, opts Options) (*sqs.Client, error) {
+	region := queueRegion(opts.EventsQueue)
+	cfg, ok := cfgs[region]
+	switch {
+	case ok:
+	case region == "":
+		if scopes := slices.Sorted(maps.Keys(cfgs)); len(scopes) > 0 {
+			cfg = cfgs[scopes[0]]
+		}
+	default:
+		loaded, err := LoadAWSConfigs(ctx, []string{region}, opts)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded[region]
+	}
+	return sqs.NewFromConfig(cfg), nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+const testContainerInstanceARN = "arn:aws:ecs:us-east-1:123456789012:container-instance/web/0123abcd"
+
+// testEvent returns a container instance state change of the test container instance, as EventBridge
+// sends it
+func testEvent(connected bool, status string, updatedAt time.Time) string {
+	event := map[string]any{
+		"version":     "0",
+		"detail-type": containerInstanceStateChange,
+		"source":      "aws.ecs",
+		"time":        updatedAt.Format(time.RFC3339),
+		"region":      "us-east-1",
+		"detail": map[string]any{
+			"containerInstanceArn": testContainerInstanceARN,
+			"clusterArn":           "arn:aws:ecs:us-east-1:123456789012:cluster/web",
+			"ec2InstanceId":        "i-aaaa",
+			"agentConnected":       connected,
+			"status":               status,
+			"runningTasksCount":    2,
+			"versionInfo":          map[string]any{"agentVersion": "1.80.0"},
+			"updatedAt":            updatedAt.Format(time.RFC3339Nano),
+		},
+	}
+	data, _ := json.Marshal(event)
+	return string(data)
+}
+
+func TestParseContainerInstanceEvent(t *testing.T) {
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	body := testEvent(false, "ACTIVE", updatedAt)
+	notification, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": body})
+	for name, body := range map[string]string{"event": body, "SNS notification": string(notification)} {
+		event, err := ParseContainerInstanceEvent(body)
+		if err != nil {
+			t.Fatalf("ParseContainerInstanceEvent() of the %v error = %v", name, err)
+		}
+		detail := event.Detail
+		if detail.ContainerInstanceARN != testContainerInstanceARN || detail.AgentConnected || detail.Status != "ACTIVE" ||
+			detail.RunningTasksCount != 2 || detail.VersionInfo.AgentVersion != "1.80.0" || !detail.UpdatedAt.Equal(updatedAt) {
+			t.Errorf("ParseContainerInstanceEvent() of the %v = %+v", name, event)
+		}
+	}
+	for _, body := range []string{"not json", `{"detail-type":"ECS Task State Change","detail":{}}`} {
+		if _, err := ParseContainerInstanceEvent(body); err == nil {
+			t.Errorf("ParseContainerInstanceEvent(%q) succeeded, want an error", body)
+		}
+	}
+}
+
+func TestExporterApplyEvent(t *testing.T) {
+	scanned := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	agents := []agentstatus.Agent{
+		{Cluster: "web", ContainerInstanceARN: testContainerInstanceARN, EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.70.0"},
+		{Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/4567efab", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE", AgentConnected: true},
+	}
+	exporter := &Exporter{agents: agents, updated: scanned}
+	parse := func(body string) ContainerInstanceEvent {
+		event, err := ParseContainerInstanceEvent(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+
+	if exporter.ApplyEvent(parse(testEvent(false, "ACTIVE", scanned.Add(-time.Minute))), Options{}) {
+		t.Error("ApplyEvent() applied an event older than the scan")
+	}
+	if !exporter.ApplyEvent(parse(testEvent(false, "ACTIVE", scanned.Add(time.Minute))), Options{MinAgentVersion: "1.75.0"}) {
+		t.Fatal("ApplyEvent() did not apply the disconnect")
+	}
+	if got := exporter.agents[0]; got.AgentConnected || got.AgentVersion != "1.80.0" || got.RunningTasks != 2 || got.Outdated {
+		t.Errorf("agent after the disconnect = %+v", got)
+	}
+	if !agents[0].AgentConnected {
+		t.Error("ApplyEvent() changed the agents of the scan in place")
+	}
+	if !exporter.ApplyEvent(parse(testEvent(false, "INACTIVE", scanned.Add(2*time.Minute))), Options{}) {
+		t.Fatal("ApplyEvent() did not apply the deregistration")
+	}
+	if len(exporter.agents) != 1 || exporter.agents[0].EC2InstanceID != "i-bbbb" {
+		t.Errorf("agents after the deregistration = %+v", exporter.agents)
+	}
+	if exporter.ApplyEvent(parse(testEvent(true, "ACTIVE", scanned.Add(3*time.Minute))), Options{}) {
+		t.Error("ApplyEvent() applied an event of a container instance the scan did not find")
+	}
+	if (&Exporter{}).ApplyEvent(parse(testEvent(true, "ACTIVE", scanned)), Options{}) {
+		t.Error("ApplyEvent() applied an event before the first scan")
+	}
+}
+
+// fakeSQS returns its messages on the first ReceiveMessage, then blocks until ctx is cancelled
+type fakeSQS struct {
+	messages []sqstypes.Message
+	received bool
+	deleted  []string
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	if !f.received {
+		f.received = true
+		return &sqs.ReceiveMessageOutput{Messages: f.messages}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (f *fakeSQS) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestExporterConsumeEvents(t *testing.T) {
+	scanned := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	exporter := &Exporter{
+		agents:  []agentstatus.Agent{{Cluster: "web", ContainerInstanceARN: testContainerInstanceARN, AgentStatus: "ACTIVE", AgentConnected: true}},
+		updated: scanned,
+	}
+	client := &fakeSQS{messages: []sqstypes.Message{
+		{MessageId: aws.String("1"), ReceiptHandle: aws.String("r1"), Body: aws.String("not an event")},
+		{MessageId: aws.String("2"), ReceiptHandle: aws.String("r2"), Body: aws.String(testEvent(false, "ACTIVE", scanned.Add(time.Minute)))},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := 0
+	exporter.ConsumeEvents(ctx, client, "https://sqs.us-east-1.amazonaws.com/123456789012/events", Options{}, func() {
+		changes++
+		cancel()
+	})
+	if changes != 1 || exporter.agents[0].AgentConnected {
+		t.Errorf("ConsumeEvents() made %d changes, agent = %+v, want the disconnect applied once", changes, exporter.agents[0])
+	}
+	if strings.Join(client.deleted, ",") != "r1,r2" {
+		t.Errorf("deleted messages = %v, want r1,r2", client.deleted)
+	}
+}
+
+func TestQueueRegion(t *testing.T) {
+	for queueURL, want := range map[string]string{
+		"https://sqs.eu-west-1.amazonaws.com/123456789012/events":                  "eu-west-1",
+		"https://us-east-2.queue.amazonaws.com/123456789012/events":                "us-east-2",
+		"http://localhost:4566/000000000000/events":                                "",
+		"http://sqs.us-east-1.localhost.localstack.cloud:4566/000000000000/events": "us-east-1",
+	} {
+		if got := queueRegion(queueURL); got != want {
+			t.Errorf("queueRegion(%q) = %q, want %q", queueURL, got, want)
+		}
+	}
+}
+
+// mockEventBridge records the rules and targets put, failing the targets with failedTarget if set
+type mockEventBridge struct {
+	rules        []*eventbridge.PutRuleInput
+	targets      []*eventbridge.PutTargetsInput
+	failedTarget *eventbridgetypes.PutTargetsResultEntry
+}
+
+func (m *mockEventBridge) PutRule(_ context.Context, params *eventbridge.PutRuleInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error) {
+	m.rules = append(m.rules, params)
+	return &eventbridge.PutRuleOutput{RuleArn: aws.String("arn:aws:events:us-east-1:123456789012:rule/" + aws.ToString(params.Name))}, nil
+}
+
+func (m *mockEventBridge) PutTargets(_ context.Context, params *eventbridge.PutTargetsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error) {
+	m.targets = append(m.targets, params)
+	if m.failedTarget != nil {
+		return &eventbridge.PutTargetsOutput{FailedEntryCount: 1, FailedEntries: []eventbridgetypes.PutTargetsResultEntry{*m.failedTarget}}, nil
+	}
+	return &eventbridge.PutTargetsOutput{}, nil
+}
+
+func TestInstallEvents(t *testing.T) {
+	client := &mockEventBridge{}
+	target := "arn:aws:sns:us-east-1:123456789012:ecs-agent-events"
+	ruleArn, err := InstallEvents(context.Background(), client, NewEventRule(DefaultEventRuleName, "default"), target)
+	if err != nil {
+		t.Fatalf("InstallEvents() error = %v", err)
+	}
+	if ruleArn != "arn:aws:events:us-east-1:123456789012:rule/"+DefaultEventRuleName {
+		t.Errorf("InstallEvents() = %q", ruleArn)
+	}
+	if len(client.rules) != 1 || aws.ToString(client.rules[0].EventPattern) != containerInstanceEventPattern ||
+		aws.ToString(client.rules[0].EventBusName) != "default" || client.rules[0].State != eventbridgetypes.RuleStateEnabled {
+		t.Errorf("PutRule input = %+v", client.rules)
+	}
+	if len(client.targets) != 1 || aws.ToString(client.targets[0].Rule) != DefaultEventRuleName ||
+		len(client.targets[0].Targets) != 1 || aws.ToString(client.targets[0].Targets[0].Arn) != target {
+		t.Errorf("PutTargets input = %+v", client.targets)
+	}
+
+	client.failedTarget = &eventbridgetypes.PutTargetsResultEntry{TargetId: aws.String(eventTargetID), ErrorCode: aws.String("AccessDenied"), ErrorMessage: aws.String("denied")}
+	if _, err := InstallEvents(context.Background(), client, NewEventRule(DefaultEventRuleName, "default"), target); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("InstallEvents() error = %v, want the failed target", err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// ExpectedCounts is the least number of ACTIVE container instances each checked cluster should have, set
+// with --expect-count. A zero value expects nothing
+type ExpectedCounts struct {
+	// Default applies to every cluster without its own count
+	Default  int
+	Clusters map[string]int
+}
+
+// ParseExpectedCounts parses --expect-count values: a count for every cluster, e.g. 3, or the count of one
+// cluster, e.g. web=6
+func ParseExpectedCounts(values []string) (ExpectedCounts, error) {
+	var expect ExpectedCounts
+	for _, value := range values {
+		cluster, count, named := strings.Cut(value, "=")
+		if !named {
+			cluster, count = "", value
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 0 || (named && cluster == "") {
+			return ExpectedCounts{}, fmt.Errorf("invalid expected count %q: must be a count or cluster=count", value)
+		}
+		if !named {
+			expect.Default = n
+			continue
+		}
+		if expect.Clusters == nil {
+			expect.Clusters = make(map[string]int)
+		}
+		expect.Clusters[cluster] = n
+	}
+	return expect, nil
+}
+
+// failOnBelowCapacity is the --fail-on condition failing the run on the shortfalls of --expect-count
+const failOnBelowCapacity = "below-capacity"
+
+// ParseFailOn parses --fail-on: the conditions of agentstatus.ParseHealthPolicy, and below-capacity, which
+// is not a condition of an agent but of a cluster and is returned separately
+func ParseFailOn(value string) (agentstatus.HealthPolicy, bool, error) {
+	var conditions []string
+	belowCapacity := false
+	for _, condition := range strings.Split(value, ",") {
+		if strings.TrimSpace(condition) == failOnBelowCapacity {
+			belowCapacity = true
+			continue
+		}
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) == 0 {
+		return agentstatus.HealthPolicy{}, belowCapacity, nil
+	}
+	policy, err := agentstatus.ParseHealthPolicy(strings.Join(conditions, ","))
+	if err != nil {
+		return agentstatus.HealthPolicy{}, false, err
+	}
+	return policy, belowCapacity, nil
+}
+
+// For returns the expected count of a cluster
+func (e ExpectedCounts) For(cluster string) int {
+	if n, ok := e.Clusters[cluster]; ok {
+		return n
+	}
+	return e.Default
+}
+
+// CapacityShortfall is a checked cluster with fewer ACTIVE container instances than expected
+type CapacityShortfall struct {
+	ClusterRef
+	Active   int `json:"active"`
+	Expected int `json:"expected"`
+}
+
+// CapacityShortfalls returns the checked clusters with fewer ACTIVE agents than expected, in the order of
+// checked. Clusters without container instances count as having none
+func CapacityShortfalls(agents []agentstatus.Agent, checked []ClusterRef, expect ExpectedCounts) []CapacityShortfall {
+	active := make(map[ClusterRef]int)
+	for _, agent := range agents {
+		if agent.AgentStatus == "ACTIVE" {
+			active[ClusterRef{AccountID: agent.AccountID, Region: agent.Region, Cluster: agent.Cluster}]++
+		}
+	}
+	var shortfalls []CapacityShortfall
+	for _, cluster := range checked {
+		if expected := expect.For(cluster.Cluster); active[cluster] < expected {
+			shortfalls = append(shortfalls, CapacityShortfall{ClusterRef: cluster, Active: active[cluster], Expected: expected})
+		}
+	}
+	return shortfalls
+}
+
+// UncheckedExpectations returns the sorted names of the clusters given their own expected count that were
+// not checked, which may mean the cluster is gone or the patterns no longer match it
+func UncheckedExpectations(checked []ClusterRef, expect ExpectedCounts) []string {
+	var unchecked []string
+	for cluster := range expect.Clusters {
+		if !slices.ContainsFunc(checked, func(ref ClusterRef) bool { return ref.Cluster == cluster }) {
+			unchecked = append(unchecked, cluster)
+		}
+	}
+	slices.Sort(unchecked)
+	return unchecked
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestParseExpectedCounts(t *testing.T) {
+	expect, err := ParseExpectedCounts([]string{"3", "web=6", "batch=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ExpectedCounts{Default: 3, Clusters: map[string]int{"web": 6, "batch": 0}}
+	if !reflect.DeepEqual(expect, want) {
+		t.Errorf("ParseExpectedCounts() = %+v, want %+v", expect, want)
+	}
+	if got := expect.For("api"); got != 3 {
+		t.Errorf("For(api) = %v, want the default 3", got)
+	}
+	for _, invalid := range []string{"many", "-1", "=2", "web=x"} {
+		if _, err := ParseExpectedCounts([]string{invalid}); err == nil {
+			t.Errorf("ParseExpectedCounts(%q) returned no error", invalid)
+		}
+	}
+}
+
+func TestParseFailOn(t *testing.T) {
+	policy, belowCapacity, err := ParseFailOn("disconnected,below-capacity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (agentstatus.HealthPolicy{FailOnDisconnected: true}); policy != want || !belowCapacity {
+		t.Errorf("ParseFailOn() = %+v, %v, want %+v, true", policy, belowCapacity, want)
+	}
+	if policy, belowCapacity, err = ParseFailOn("below-capacity"); err != nil || policy != (agentstatus.HealthPolicy{}) || !belowCapacity {
+		t.Errorf("ParseFailOn(below-capacity) = %+v, %v, %v, want no agent conditions", policy, belowCapacity, err)
+	}
+	if _, _, err := ParseFailOn("status,capacity"); err == nil {
+		t.Error("ParseFailOn(status,capacity) returned no error")
+	}
+}
+
+func TestParseScanArgsFailOn(t *testing.T) {
+	opts, err := ParseScanArgs("check", []string{"prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.HealthPolicy != agentstatus.DefaultHealthPolicy || !opts.FailOnOutdated || !opts.FailOnBelowCapacity {
+		t.Errorf("without --fail-on: %+v, outdated %v, below capacity %v, want the default policy failing on both", opts.HealthPolicy, opts.FailOnOutdated, opts.FailOnBelowCapacity)
+	}
+	opts, err = ParseScanArgs("check", []string{"--fail-on", "disconnected", "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.FailOnOutdated || opts.FailOnBelowCapacity {
+		t.Errorf("--fail-on disconnected: outdated %v, below capacity %v, want neither to fail the run", opts.FailOnOutdated, opts.FailOnBelowCapacity)
+	}
+}
+
+func TestCapacityShortfalls(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE"},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE"},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "DRAINING"},
+		{Region: "us-east-1", Cluster: "api", AgentStatus: "ACTIVE"},
+	}
+	checked := []ClusterRef{
+		{Region: "us-east-1", Cluster: "api"},
+		{Region: "us-east-1", Cluster: "empty"},
+		{Region: "us-east-1", Cluster: "web"},
+	}
+	expect := ExpectedCounts{Default: 1, Clusters: map[string]int{"web": 3, "gone": 2}}
+	want := []CapacityShortfall{
+		{ClusterRef: ClusterRef{Region: "us-east-1", Cluster: "empty"}, Active: 0, Expected: 1},
+		{ClusterRef: ClusterRef{Region: "us-east-1", Cluster: "web"}, Active: 2, Expected: 3},
+	}
+	if got := CapacityShortfalls(agents, checked, expect); !reflect.DeepEqual(got, want) {
+		t.Errorf("CapacityShortfalls() = %+v, want %+v", got, want)
+	}
+	if got := CapacityShortfalls(agents, checked, ExpectedCounts{}); got != nil {
+		t.Errorf("CapacityShortfalls() without expected counts = %+v, want none", got)
+	}
+	if got := UncheckedExpectations(checked, expect); !reflect.DeepEqual(got, []string{"gone"}) {
+		t.Errorf("UncheckedExpectations() = %v, want [gone]", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// agentFields are the JSON field names of agentstatus.Agent, in struct order, which --fields selects from
+var agentFields = jsonFieldNames(reflect.TypeOf(agentstatus.Agent{}))
+
+// jsonFieldNames returns the names the fields of a struct type are encoded with by encoding/json
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		names = append(names, valueOr(name, field.Name))
+	}
+	return names
+}
+
+// ValidateFields checks that every --fields name is a field of the agents, e.g. ec2InstanceId
+func ValidateFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(agentFields, field) {
+			return fmt.Errorf("unknown field %q in --fields: must be one of %v", field, strings.Join(agentFields, ", "))
+		}
+	}
+	return nil
+}
+
+// SelectedAgent is an agent encoded as a JSON object with only the --fields fields, in their order. Fields
+// the agent has no value for are null, so every object has the same keys
+type SelectedAgent struct {
+	Agent  agentstatus.Agent
+	Fields []string
+}
+
+func (s SelectedAgent) MarshalJSON() ([]byte, error) {
+	values, err := agentJSONFields(s.Agent)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, field := range s.Fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		b.Write(key)
+		b.WriteByte(':')
+		if value, ok := values[field]; ok {
+			b.Write(value)
+		} else {
+			b.WriteString("null")
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// agentJSONFields returns the JSON encoding of each field of an agent that has a value, by field name
+func agentJSONFields(agent agentstatus.Agent) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(agent)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	err = json.Unmarshal(data, &values)
+	return values, err
+}
+
+// selectFields returns the value encoding the agents in JSON and YAML output: the agents themselves, or
+// with --fields the SelectedAgent of each
+func (opts Options) selectFields(agents []agentstatus.Agent) any {
+	if len(opts.Fields) == 0 {
+		if agents == nil {
+			return []agentstatus.Agent{}
+		}
+		return agents
+	}
+	selected := make([]SelectedAgent, len(agents))
+	for i, agent := range agents {
+		selected[i] = SelectedAgent{Agent: agent, Fields: opts.Fields}
+	}
+	return selected
+}
+
+// fieldValues returns the values of the fields of an agent as text: as in the CSV output for its columns,
+// and otherwise the JSON encoding of the value, without quotes for strings and empty for no value
+func fieldValues(agent agentstatus.Agent, fields []string) ([]string, error) {
+	record := csvRecord(agent)
+	var values map[string]json.RawMessage
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		if column := slices.Index(csvHeader, field); column >= 0 {
+			row[i] = record[column]
+			continue
+		}
+		if values == nil {
+			var err error
+			if values, err = agentJSONFields(agent); err != nil {
+				return nil, err
+			}
+		}
+		value, ok := values[field]
+		switch {
+		case !ok || string(value) == "null":
+		case len(value) > 0 && value[0] == '"':
+			var text string
+			if err := json.Unmarshal(value, &text); err != nil {
+				return nil, err
+			}
+			row[i] = text
+		default:
+			row[i] = string(value)
+		}
+	}
+	return row, nil
+}
+
+// fieldTitle returns the table column header of a field, its words in upper case, e.g. EC2 INSTANCE ID for
+// ec2InstanceId
+func fieldTitle(field string) string {
+	var title strings.Builder
+	for i, r := range field {
+		if unicode.IsUpper(r) && i > 0 {
+			title.WriteByte(' ')
+		}
+		title.WriteRune(unicode.ToUpper(r))
+	}
+	return title.String()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestValidateFields(t *testing.T) {
+	if err := ValidateFields([]string{"cluster", "ec2InstanceId", "agentStatus", "tags", "clusterArn"}); err != nil {
+		t.Errorf("ValidateFields() error = %v", err)
+	}
+	if err := ValidateFields([]string{"cluster", "instanceId"}); err == nil {
+		t.Error("ValidateFields() accepted an unknown field")
+	}
+}
+
+func TestFieldTitle(t *testing.T) {
+	for field, want := range map[string]string{"cluster": "CLUSTER", "ec2InstanceId": "EC2 INSTANCE ID", "privateIp": "PRIVATE IP"} {
+		if got := fieldTitle(field); got != want {
+			t.Errorf("fieldTitle(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestSelectedAgentJSON(t *testing.T) {
+	agent := agentstatus.Agent{Cluster: "web", EC2InstanceID: "i-aaaa", AgentConnected: true, Tags: map[string]string{"team": "payments"}}
+	got, err := json.Marshal(SelectedAgent{Agent: agent, Fields: []string{"ec2InstanceId", "cluster", "agentVersion", "agentConnected", "tags"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ec2InstanceId":"i-aaaa","cluster":"web","agentVersion":null,"agentConnected":true,"tags":{"team":"payments"}}`
+	if string(got) != want {
+		t.Errorf("SelectedAgent JSON = %s, want %s", got, want)
+	}
+}
+
+func TestWriteFields(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentVersion: "1.75.0", AgentConnected: true},
+		{Cluster: "batch", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING", Tags: map[string]string{"team": "data"}},
+	}
+	fields := []string{"cluster", "ec2InstanceId", "agentStatus", "agentVersion", "tags"}
+	var buf bytes.Buffer
+	if err := WriteCSVFields(&buf, agents, fields); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "cluster,ec2InstanceId,agentStatus,agentVersion,tags\nweb,i-aaaa,ACTIVE,1.75.0,\nbatch,i-bbbb,DRAINING,,\"{\"\"team\"\":\"\"data\"\"}\"\n"
+	if buf.String() != wantCSV {
+		t.Errorf("WriteCSVFields() =\n%v\nwant\n%v", buf.String(), wantCSV)
+	}
+
+	buf.Reset()
+	if err := WriteTable(&buf, agents, Options{Fields: fields[:4]}); err != nil {
+		t.Fatal(err)
+	}
+	wantTable := "CLUSTER  EC2 INSTANCE ID  AGENT STATUS  AGENT VERSION\n" +
+		"web      i-aaaa           ACTIVE        1.75.0\n" +
+		"batch    i-bbbb           DRAINING      \n"
+	if buf.String() != wantTable {
+		t.Errorf("WriteTable() with fields =\n%q\nwant\n%q", buf.String(), wantTable)
+	}
+}
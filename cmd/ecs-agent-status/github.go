@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// githubEscaper escapes the message of a GitHub Actions workflow command
+var githubEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// githubPropertyEscaper escapes a property value of a GitHub Actions workflow command
+var githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// githubAnnotation returns the workflow command annotating level (error or warning) with title and message
+func githubAnnotation(level, title, message string) string {
+	return fmt.Sprintf("::%v title=%v::%v", level, githubPropertyEscaper.Replace(title), githubEscaper.Replace(message))
+}
+
+// githubAgentProblems returns what is wrong with an agent, if anything: its status, connectivity, version
+// drift and age
+func githubAgentProblems(agent agentstatus.Agent) []string {
+	var problems []string
+	if agent.AgentStatus != "ACTIVE" {
+		problems = append(problems, "status "+agent.AgentStatus)
+	}
+	if !agent.AgentConnected {
+		problems = append(problems, "agent disconnected")
+	}
+	if agent.Outdated {
+		problems = append(problems, "agent "+agent.AgentVersion+" outdated")
+	}
+	if agent.VersionDrift {
+		problems = append(problems, "agent "+agent.AgentVersion+" differs from the fleet")
+	}
+	if agent.DockerVersionDrift {
+		problems = append(problems, agent.DockerVersion+" differs from the fleet")
+	}
+	if len(agent.DuplicateRegistrations) > 0 {
+		problems = append(problems, fmt.Sprintf("instance registered %v more times", len(agent.DuplicateRegistrations)))
+	}
+	return problems
+}
+
+// WriteGitHubAnnotations writes an error annotation for each agent that is unhealthy under
+// opts.HealthPolicy, and a warning annotation for each other agent that is not ACTIVE, not connected,
+// outdated or drifting, followed by the summary of the run
+func WriteGitHubAnnotations(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	for _, agent := range agents {
+		problems := githubAgentProblems(agent)
+		if len(problems) == 0 {
+			continue
+		}
+		level := "warning"
+		if opts.HealthPolicy.Unhealthy(agent) {
+			level = "error"
+		}
+		title := fmt.Sprintf("ECS agent %v in %v", agent.InstanceID(), agent.Cluster)
+		message := fmt.Sprintf("%v in cluster %v (%v, container instance %v): %v", agent.InstanceID(), agent.Cluster,
+			ScopeKey(agent.AccountID, agent.Region), shortArn(agent.ContainerInstanceARN), strings.Join(problems, ", "))
+		if _, err := fmt.Fprintln(w, githubAnnotation(level, title, message)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, agentstatus.Summarize(agents, opts.HealthPolicy))
+	return err
+}
+
+// markdownEscaper escapes the characters that would break a cell of a markdown table
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+// WriteGitHubSummary writes a markdown job summary: the summary of the run, a table of the clusters and a
+// table of the agents with problems
+func WriteGitHubSummary(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## ECS agent status\n\n%v\n\n", agentstatus.Summarize(agents, opts.HealthPolicy))
+	b.WriteString("| Region | Cluster | Instances | Active | Draining | Disconnected | Agent versions |\n")
+	b.WriteString("| --- | --- | ---: | ---: | ---: | ---: | --- |\n")
+	for _, summary := range agentstatus.SummarizeClusters(agents) {
+		fmt.Fprintf(&b, "| %v | %v | %v | %v | %v | %v | %v |\n", ScopeKey(summary.AccountID, summary.Region), markdownEscaper.Replace(summary.Cluster),
+			summary.Instances, summary.Active, summary.Draining, summary.Disconnected, strings.Join(summary.AgentVersions, ", "))
+	}
+	header := false
+	for _, agent := range agents {
+		problems := githubAgentProblems(agent)
+		if len(problems) == 0 {
+			continue
+		}
+		if !header {
+			b.WriteString("\n### Agents with problems\n\n| | Region | Cluster | Instance | Container instance | Problems |\n| --- | --- | --- | --- | --- | --- |\n")
+			header = true
+		}
+		icon := ":warning:"
+		if opts.HealthPolicy.Unhealthy(agent) {
+			icon = ":x:"
+		}
+		fmt.Fprintf(&b, "| %v | %v | %v | %v | %v | %v |\n", icon, ScopeKey(agent.AccountID, agent.Region), markdownEscaper.Replace(agent.Cluster),
+			agent.InstanceID(), shortArn(agent.ContainerInstanceARN), strings.Join(problems, ", "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteGitHub writes the annotations to w and appends the job summary to the file named by
+// GITHUB_STEP_SUMMARY, if set
+func WriteGitHub(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	if err := WriteGitHubAnnotations(w, agents, opts); err != nil {
+		return err
+	}
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	if err := WriteGitHubSummary(f, agents, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+var githubAgents = []agentstatus.Agent{
+	{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+	{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING", AgentConnected: true},
+	{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/cccc", EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE"},
+}
+
+func TestWriteGitHubAnnotations(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGitHubAnnotations(&buf, githubAgents, Options{HealthPolicy: agentstatus.DefaultHealthPolicy}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"::error title=ECS agent i-bbbb in web::i-bbbb in cluster web (us-east-1, container instance bbbb): status DRAINING",
+		"::warning title=ECS agent i-cccc in web::i-cccc in cluster web (us-east-1, container instance cccc): agent disconnected",
+	}
+	if len(lines) != 3 || lines[0] != want[0] || lines[1] != want[1] || !strings.HasPrefix(lines[2], "3 agents in 1 clusters") {
+		t.Errorf("WriteGitHubAnnotations() =\n%v\nwant\n%v\nand the summary", buf.String(), strings.Join(want, "\n"))
+	}
+	if got := githubAnnotation("error", "a:b,c", "50%\nfull"); got != "::error title=a%3Ab%2Cc::50%25%0Afull" {
+		t.Errorf("githubAnnotation() = %q", got)
+	}
+}
+
+func TestWriteGitHubSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", path)
+	if err := WriteGitHub(&bytes.Buffer{}, githubAgents, Options{HealthPolicy: agentstatus.DefaultHealthPolicy}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := string(data)
+	for _, want := range []string{"## ECS agent status", "| us-east-1 | web | 3 | 2 | 1 | 1 |", "| :x: | us-east-1 | web | i-bbbb | bbbb | status DRAINING |", "| :warning: | us-east-1 | web | i-cccc | cccc | agent disconnected |"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("job summary does not contain %q:\n%v", want, summary)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// htmlReportTemplate renders a standalone fleet report: a summary, a table per cluster and a table of every
+// agent. Clicking a column header sorts the table by that column
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ECS agent status report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f0f0f0; cursor: pointer; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+tr.unhealthy td { background: #fbe3e3; color: #a00; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>ECS agent status report</h1>
+<p class="meta">Generated {{.Generated}}</p>
+<p>{{.Summary}}</p>
+
+<h2>Clusters</h2>
+<table class="sortable">
+<thead><tr><th>Account</th><th>Region</th><th>Cluster</th><th>Agents</th><th>Active</th><th>Draining</th><th>Disconnected</th><th>Unhealthy</th></tr></thead>
+<tbody>
+{{- range .Clusters}}
+<tr{{if .Summary.Unhealthy}} class="unhealthy"{{end}}><td>{{.AccountID}}</td><td>{{.Region}}</td><td{{with .ClusterARN}} title="{{.}}"{{end}}>{{.Cluster}}</td><td>{{.Summary.Agents}}</td><td>{{index .Summary.ByStatus "ACTIVE"}}</td><td>{{index .Summary.ByStatus "DRAINING"}}</td><td>{{.Summary.Disconnected}}</td><td>{{.Summary.Unhealthy}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+
+<h2>Agents</h2>
+<table class="sortable">
+<thead><tr><th>Account</th><th>Region</th><th>Cluster</th><th>Container instance</th><th>Instance</th><th>Instance type</th><th>AZ</th><th>ASG</th><th>Status</th><th>Connected</th><th>Agent version</th><th>Docker version</th><th>Running</th><th>Pending</th></tr></thead>
+<tbody>
+{{- range .Agents}}
+<tr{{if .Unhealthy}} class="unhealthy"{{end}}><td>{{.AccountID}}</td><td>{{.Region}}</td><td{{with .ClusterARN}} title="{{.}}"{{end}}>{{.Cluster}}</td><td>{{.ContainerInstance}}</td><td>{{.InstanceID}}</td><td>{{.InstanceType}}</td><td>{{.AvailabilityZone}}</td><td>{{.AutoScalingGroup}}</td><td>{{.AgentStatus}}</td><td>{{.AgentConnected}}</td><td>{{.AgentVersion}}</td><td>{{.DockerVersion}}</td><td>{{.RunningTasks}}</td><td>{{.PendingTasks}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+
+<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (th, column) {
+    th.addEventListener("click", function () {
+      var ascending = !th.classList.contains("asc");
+      table.querySelectorAll("th").forEach(function (other) { other.classList.remove("asc", "desc"); });
+      th.classList.add(ascending ? "asc" : "desc");
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[column].textContent, y = b.cells[column].textContent;
+        var order = (x !== "" && y !== "" && !isNaN(x) && !isNaN(y)) ? x - y : x.localeCompare(y);
+        return ascending ? order : -order;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// htmlAgent is an agent as shown in the HTML report
+type htmlAgent struct {
+	agentstatus.Agent
+	ContainerInstance string
+	Unhealthy         bool
+}
+
+// htmlCluster is a row of the per-cluster summary of the HTML report
+type htmlCluster struct {
+	AccountID  string
+	Region     string
+	Cluster    string
+	ClusterARN string
+	Summary    agentstatus.Summary
+}
+
+// htmlReport is the data rendered by htmlReportTemplate
+type htmlReport struct {
+	Generated string
+	Summary   agentstatus.Summary
+	Clusters  []htmlCluster
+	Agents    []htmlAgent
+}
+
+// WriteHTML writes the agents to w as a standalone HTML report generated at now, with a summary per
+// cluster and the agents that are unhealthy under opts.HealthPolicy highlighted in red
+func WriteHTML(w io.Writer, agents []agentstatus.Agent, opts Options, now time.Time) error {
+	report := htmlReport{
+		Generated: now.UTC().Format(time.RFC3339),
+		Summary:   agentstatus.Summarize(agents, opts.HealthPolicy),
+	}
+	keys, groups := agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string {
+		return ScopeKey(agent.AccountID, agent.Region) + "/" + agent.Cluster
+	})
+	for _, key := range keys {
+		first := groups[key][0]
+		report.Clusters = append(report.Clusters, htmlCluster{
+			AccountID:  first.AccountID,
+			Region:     first.Region,
+			Cluster:    first.Cluster,
+			ClusterARN: first.ClusterARN,
+			Summary:    agentstatus.Summarize(groups[key], opts.HealthPolicy),
+		})
+	}
+	for _, agent := range agents {
+		arn := agent.ContainerInstanceARN
+		if opts.FormatArn == "short" {
+			arn = shortArn(arn)
+		}
+		report.Agents = append(report.Agents, htmlAgent{Agent: agent, ContainerInstance: arn, Unhealthy: opts.HealthPolicy.Unhealthy(agent)})
+	}
+	return htmlReportTemplate.Execute(w, report)
+}
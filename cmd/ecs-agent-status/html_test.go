@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteHTML(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ClusterARN: "arn:aws:ecs:us-east-1:123456789012:cluster/web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING"},
+		{Region: "us-east-1", Cluster: "<batch>", EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE", AgentConnected: true},
+	}
+	var buf bytes.Buffer
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := WriteHTML(&buf, agents, Options{FormatArn: "short", HealthPolicy: agentstatus.DefaultHealthPolicy}, now); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"Generated 2024-03-01T12:00:00Z",
+		"3 agents in 2 clusters",
+		`<tr class="unhealthy"><td></td><td>us-east-1</td><td title="arn:aws:ecs:us-east-1:123456789012:cluster/web">web</td><td>2</td><td>1</td><td>1</td><td>1</td><td>1</td></tr>`,
+		`<tr class="unhealthy"><td></td><td>us-east-1</td><td>web</td><td>bbbb</td><td>i-bbbb</td>`,
+		`<tr><td></td><td>us-east-1</td><td title="arn:aws:ecs:us-east-1:123456789012:cluster/web">web</td><td>aaaa</td>`,
+		"&lt;batch&gt;",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteHTML() does not contain %q:\n%v", want, got)
+		}
+	}
+}
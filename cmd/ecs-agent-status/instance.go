@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// WriteAgentDetail writes every known field of an agent to w on its own line, with aligned values. now is
+// used to show the age of the registration and launch times
+func WriteAgentDetail(w io.Writer, agent agentstatus.Agent, opts Options, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	field := func(name string, value any) {
+		if s := fmt.Sprint(value); s != "" {
+			fmt.Fprintf(tw, "%v:\t%v\n", name, s)
+		}
+	}
+	age := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return fmt.Sprintf("%v (%v ago)", t.UTC().Format(time.RFC3339), now.Sub(*t).Truncate(time.Second))
+	}
+	status, connected := agent.AgentStatus, fmt.Sprint(agent.AgentConnected)
+	if opts.Color {
+		status, connected = colorizeStatus(status), colorizeConnected(agent.AgentConnected)
+	}
+	field("Account", agent.AccountID)
+	field("Region", agent.Region)
+	field("Cluster", agent.Cluster)
+	field("ClusterARN", agent.ClusterARN)
+	field("ContainerInstanceARN", agent.ContainerInstanceARN)
+	field("EC2InstanceID", agent.EC2InstanceID)
+	field("ManagedInstanceID", agent.ManagedInstanceID)
+	field("LaunchType", agent.LaunchType)
+	field("OSType", agent.OSType)
+	field("OSFamily", agent.OSFamily)
+	field("AgentStatus", status)
+	field("AgentConnected", connected)
+	field("AgentVersion", agent.AgentVersion)
+	field("AgentUpdateStatus", agent.AgentUpdateStatus)
+	field("DockerVersion", agent.DockerVersion)
+	field("DockerAPIVersion", agent.DockerAPIVersion)
+	field("ContainerdVersion", agent.ContainerdVersion)
+	field("RegisteredAt", age(agent.RegisteredAt))
+	field("RunningTasks", agent.RunningTasks)
+	field("PendingTasks", agent.PendingTasks)
+	field("CPU", fmt.Sprintf("%v free of %v", agent.RemainingCPU, agent.RegisteredCPU))
+	field("Memory", fmt.Sprintf("%v free of %v", agent.RemainingMemory, agent.RegisteredMemory))
+	field("InstanceType", agent.InstanceType)
+	field("AvailabilityZone", agent.AvailabilityZone)
+	field("PrivateIP", agent.PrivateIP)
+	field("ImageID", agent.ImageID)
+	field("LaunchTemplateID", agent.LaunchTemplateID)
+	field("LaunchTemplateVersion", agent.LaunchTemplateVersion)
+	field("SystemStatus", agent.SystemStatus)
+	field("InstanceStatus", agent.InstanceStatus)
+	field("SSMPingStatus", agent.SSMPingStatus)
+	for _, event := range agent.ScheduledEvents {
+		field("ScheduledEvent", fmt.Sprintf("%v %v %v", event.Code, age(event.NotBefore), event.Description))
+	}
+	field("LaunchTime", age(agent.LaunchTime))
+	field("AutoScalingGroup", agent.AutoScalingGroup)
+	field("CapacityProvider", agent.CapacityProvider)
+	field("FailureReason", agent.FailureReason)
+	keys := make([]string, 0, len(agent.Tags))
+	for key := range agent.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field("Tag "+key, agent.Tags[key])
+	}
+	return tw.Flush()
+}
+
+// findAgent looks for the container instance in the cluster in each region, skipping the regions without
+// the cluster, and returns the first match
+func findAgent(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, cluster, id string) (agentstatus.Agent, error) {
+	err := fmt.Errorf("%v in cluster %v: %w", id, cluster, agentstatus.ErrContainerInstanceNotFound)
+	for _, region := range SortedRegions(checkers) {
+		agent, getErr := checkers[region].GetAgent(ctx, cluster, id)
+		var clusterNotFound *types.ClusterNotFoundException
+		switch {
+		case getErr == nil:
+			return agent, nil
+		case errors.As(getErr, &clusterNotFound), errors.Is(getErr, agentstatus.ErrContainerInstanceNotFound):
+			logger.Debug().Err(getErr).Str("region", region).Msgf("%v not found in region %v", id, region)
+			if errors.As(getErr, &clusterNotFound) && len(checkers) == 1 {
+				err = getErr
+			}
+		default:
+			return agentstatus.Agent{}, fmt.Errorf("region %v: %w", region, getErr)
+		}
+	}
+	return agentstatus.Agent{}, err
+}
+
+// runInstance prints the details of one container instance and returns the exit code: ExitUnhealthy when
+// its agent is not ACTIVE or not connected
+func runInstance(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	agent, err := findAgent(ctx, checkers, opts.ClusterPatterns[0], opts.ContainerInstance)
+	switch {
+	case ctx.Err() != nil:
+		return cancelledExitCode(ctx, opts, "while getting the container instance")
+	case err != nil:
+		logger.Error().Err(err).Msgf("error getting container instance %v: %v", opts.ContainerInstance, err)
+		return ExitError
+	}
+	if opts.Output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(agent)
+	} else {
+		err = WriteAgentDetail(os.Stdout, agent, opts, time.Now())
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("error writing output")
+		return ExitError
+	}
+	if outputHealthPolicy.Unhealthy(agent) {
+		return ExitUnhealthy
+	}
+	return ExitHealthy
+}
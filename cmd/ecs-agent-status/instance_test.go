@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteAgentDetail(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	registered := now.Add(-90 * time.Minute)
+	agent := agentstatus.Agent{
+		Region: "us-east-1", Cluster: "prod", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/prod/abc",
+		EC2InstanceID: "i-0abc", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.80.0", RunningTasks: 3,
+		RegisteredAt: &registered, Tags: map[string]string{"team": "payments"},
+	}
+	var buf bytes.Buffer
+	if err := WriteAgentDetail(&buf, agent, Options{}, now); err != nil {
+		t.Fatalf("WriteAgentDetail() error = %v", err)
+	}
+	for _, want := range []string{"EC2InstanceID:", "i-0abc", "AgentVersion:", "1.80.0", "2024-05-02T10:30:00Z (1h30m0s ago)", "Tag team:", "payments"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteAgentDetail() does not contain %q:\n%v", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "ManagedInstanceID") || strings.Contains(buf.String(), "LaunchTime") {
+		t.Errorf("WriteAgentDetail() printed empty fields:\n%v", buf.String())
+	}
+}
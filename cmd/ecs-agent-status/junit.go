@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the test cases of one cluster, with its account, region and ARN as properties
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+// junitProperty is a name and value describing a test suite
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is the result of one container instance
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure marks a test case of an agent that is not ACTIVE or not connected
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the agents to w as a JUnit XML report for CI test report views: a test suite per
+// cluster and a test case per container instance, failing when the agent is not ACTIVE or not connected
+func WriteJUnit(w io.Writer, agents []agentstatus.Agent) error {
+	report := junitTestSuites{Name: "ecs-agent-status"}
+	keys, groups := agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string {
+		return ScopeKey(agent.AccountID, agent.Region) + "/" + agent.Cluster
+	})
+	for _, key := range keys {
+		suite := junitTestSuite{Name: key}
+		first := groups[key][0]
+		for _, property := range []junitProperty{{"accountId", first.AccountID}, {"region", first.Region}, {"clusterArn", first.ClusterARN}} {
+			if property.Value != "" {
+				suite.Properties = append(suite.Properties, property)
+			}
+		}
+		for _, agent := range groups[key] {
+			testCase := junitTestCase{
+				Name:      agent.InstanceID(),
+				ClassName: fmt.Sprintf("ecs-agent-status.%v.%v", agent.Region, agent.Cluster),
+			}
+			if testCase.Name == "" {
+				testCase.Name = shortArn(agent.ContainerInstanceARN)
+			}
+			if outputHealthPolicy.Unhealthy(agent) {
+				problems := strings.Join(githubAgentProblems(agent), ", ")
+				testCase.Failure = &junitFailure{Message: problems, Type: "UnhealthyAgent", Text: agent.String()}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
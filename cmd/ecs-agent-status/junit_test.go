@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ClusterARN: "arn:aws:ecs:us-east-1:123456789012:cluster/web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE"},
+		{Region: "us-east-1", Cluster: "batch", EC2InstanceID: "i-cccc", AgentStatus: "DRAINING", AgentConnected: true},
+	}
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, agents); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("WriteJUnit() does not start with the XML header:\n%v", buf.String())
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("WriteJUnit() is not valid XML: %v", err)
+	}
+	if report.Tests != 3 || report.Failures != 2 || len(report.Suites) != 2 {
+		t.Fatalf("WriteJUnit() = %v tests, %v failures, %v suites, want 3, 2 and 2", report.Tests, report.Failures, len(report.Suites))
+	}
+	web := report.Suites[0]
+	if web.Name != "us-east-1/web" || web.Cases[0].Failure != nil || web.Cases[1].Failure == nil || web.Cases[1].Failure.Message != "agent disconnected" {
+		t.Errorf("WriteJUnit() web suite = %+v", web)
+	}
+	wantProperties := []junitProperty{{"region", "us-east-1"}, {"clusterArn", "arn:aws:ecs:us-east-1:123456789012:cluster/web"}}
+	if !reflect.DeepEqual(web.Properties, wantProperties) {
+		t.Errorf("WriteJUnit() web suite properties = %+v, want %+v", web.Properties, wantProperties)
+	}
+}
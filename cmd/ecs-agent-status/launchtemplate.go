@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// DetectLaunchTemplateDrift marks the agents whose instance was not launched from the current launch template
+// version of its Auto Scaling group, calling the Auto Scaling and EC2 APIs in the region, and account, of
+// each agent, and logs each of them. It returns the number of drifting agents; agents in a region whose
+// groups could not be described are left unmarked and the first error is returned
+func DetectLaunchTemplateDrift(ctx context.Context, cfgs map[string]aws.Config, agents []agentstatus.Agent) (int, error) {
+	indexesByScope := make(map[string][]int)
+	for i, agent := range agents {
+		if agent.AutoScalingGroup != "" {
+			scope := scopeIn(cfgs, agent.AccountID, agent.Region)
+			indexesByScope[scope] = append(indexesByScope[scope], i)
+		}
+	}
+	drifting := 0
+	var firstErr error
+	for scope, indexes := range indexesByScope {
+		scoped := make([]agentstatus.Agent, len(indexes))
+		for j, i := range indexes {
+			scoped[j] = agents[i]
+		}
+		count, err := agentstatus.MarkLaunchTemplateDrift(ctx, autoscaling.NewFromConfig(cfgs[scope]), ec2.NewFromConfig(cfgs[scope]), scoped)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("region %v: %w", scope, err)
+		}
+		drifting += count
+		for j, i := range indexes {
+			agents[i] = scoped[j]
+		}
+	}
+	for _, agent := range agents {
+		if agent.LaunchTemplateDrift {
+			logger.Warn().Str("cluster", agent.Cluster).Str("ec2InstanceId", agent.EC2InstanceID).Str("autoScalingGroup", agent.AutoScalingGroup).
+				Str("launchTemplateVersion", agent.LaunchTemplateVersion).Str("currentLaunchTemplateVersion", agent.CurrentLaunchTemplateVersion).
+				Msgf("instance %v runs launch template version %v, not version %v of Auto Scaling group %v", agent.EC2InstanceID,
+					valueOr(agent.LaunchTemplateVersion, "none"), agent.CurrentLaunchTemplateVersion, agent.AutoScalingGroup)
+		}
+	}
+	return drifting, firstErr
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestFormatAgentLaunchTemplate(t *testing.T) {
+	agent := agentstatus.Agent{EC2InstanceID: "i-old", AgentStatus: "ACTIVE", AgentConnected: true, ImageID: "ami-0abc",
+		LaunchTemplateID: "lt-web", LaunchTemplateVersion: "6", CurrentLaunchTemplateVersion: "7", LaunchTemplateDrift: true}
+	line := FormatAgent(agent, Options{})
+	if !strings.Contains(line, ", AMI: ami-0abc, LaunchTemplate: lt-web:6 (stale, current 7)") {
+		t.Errorf("FormatAgent() = %q, want the AMI and the stale launch template", line)
+	}
+	agent.LaunchTemplateDrift = false
+	if line := FormatAgent(agent, Options{}); strings.Contains(line, "stale") {
+		t.Errorf("FormatAgent() = %q, want no stale marker", line)
+	}
+}
@@ -2,224 +2,1168 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
 	"github.com/natemarks/ecs-agent-status/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/rs/zerolog"
 )
 
-// Agent is a struct that contains information about an ECS agent
-type Agent struct {
-	Cluster              string `json:"cluster"`
-	ContainerInstanceARN string `json:"containerInstanceArn"`
-	EC2InstanceID        string `json:"ec2InstanceId"`
-	AgentStatus          string `json:"agentStatus"`
-}
+// Exit codes of a run
+const (
+	// ExitHealthy means every agent passed the health checks
+	ExitHealthy = 0
+	// ExitUnhealthy means unhealthy, drifting or outdated agents, or services below their desired count,
+	// failed the run
+	ExitUnhealthy = 1
+	// ExitError means the run could not complete because of an AWS API, configuration or output error
+	ExitError = 2
+	// ExitNoClusters means no cluster matched the patterns
+	ExitNoClusters = 3
+	// ExitPartial means every agent that could be checked is healthy, but some regions or clusters could
+	// not be checked
+	ExitPartial = 4
+	// ExitInterrupted means the run was cancelled by SIGINT or SIGTERM
+	ExitInterrupted = 130
+)
 
-func (a Agent) String() string {
-	return fmt.Sprintf("Cluster: %v, ContainerInstanceARN: %v, EC2InstanceID: %v, AgentStatus: %v", a.Cluster, a.ContainerInstanceARN, a.EC2InstanceID, a.AgentStatus)
+// logger is the application logger. It is configured in main
+var logger zerolog.Logger
+
+// Options contains the command-line settings for a run
+type Options struct {
+	ClusterPatterns  []string
+	ClusterNames     []string
+	Exclude          []string
+	Match            agentstatus.MatchMode
+	MaxClusters      int
+	IncludeInactive  bool
+	IncludeRaw       bool
+	FailOnEmpty      bool
+	SuppressWindows  []SuppressWindow
+	ClusterTags      map[string]string
+	ClusterCacheFile string
+	ClusterCacheTTL  time.Duration
+	RefreshClusters  bool
+	IncludeResources bool
+	FormatArn        string
+	Regions          []string
+	Output           string
+	Since            time.Duration
+	MinAge           time.Duration
+	AllowEmpty       bool
+	Color            bool
+	LogFormat        string
+	FailThreshold    float64
+	MaxUnhealthy     int
+	ExpectCount      ExpectedCounts
+	HealthPolicy     agentstatus.HealthPolicy
+	// FailOnBelowCapacity fails the run when a cluster has fewer ACTIVE instances than --expect-count, and
+	// FailOnOutdated when any agent is older than --min-agent-version, however many are unhealthy. Both
+	// are set without --fail-on
+	FailOnBelowCapacity bool
+	FailOnOutdated      bool
+	MinAgentVersion     string
+	Instances           []string
+	Platform            string
+	WebhookURL          string
+	Profile             string
+	EndpointURL         string
+	LogLevel            zerolog.Level
+	Quiet               bool
+	Verbose             bool
+	ProfileAPIs         bool
+	Preflight           bool
+	GroupBy             string
+	// ShowAttributes are the container instance attributes printed with each agent
+	ShowAttributes     []string
+	Sort               string
+	DetectVersionDrift bool
+	FailOnVersionDrift bool
+	FailOnDockerDrift  bool
+	// DetectLaunchTemplateDrift marks the instances not running the current launch template version of
+	// their Auto Scaling group, which FailOnLaunchTemplateDrift fails the run on
+	DetectLaunchTemplateDrift bool
+	FailOnLaunchTemplateDrift bool
+	// DetectDuplicates marks the instances registered as several container instances, which FailOnDuplicates
+	// fails the run on
+	DetectDuplicates  bool
+	FailOnDuplicates  bool
+	OutputFile        string
+	Concurrency       int
+	AllRegions        bool
+	Watch             bool
+	Services          bool
+	UpdateAgents      bool
+	ListClusters      bool
+	Capacity          bool
+	TUI               bool
+	MinHeadroom       float64
+	BatchSize         int
+	UpdateTimeout     time.Duration
+	ContainerInstance string
+	DrainInstances    []string
+	Prune             bool
+	Interval          time.Duration
+	Serve             string
+	Daemon            bool
+	PromFile          string
+	PublishCloudWatch bool
+	Sinks             []string
+	Namespace         string
+	SNSTopicArn       string
+	SlackWebhookURL   string
+	NotifyAlways      bool
+	NotifyOnChange    bool
+	Jitter            float64
+	MaxPollBackoff    time.Duration
+	Recheck           int
+	RecheckInterval   time.Duration
+	// Schedule and DeepSchedule are the --schedule and --deep-schedule of the daemon and serve polls
+	Schedule     *CronSchedule
+	DeepSchedule *CronSchedule
+	// InstallEvents creates the EventBridge rule sending the container instance state changes of EventBus to
+	// EventTarget
+	InstallEvents bool
+	EventBus      string
+	EventTarget   string
+	EventRuleName string
+	// EventsQueue is the SQS queue whose container instance state changes serve and the daemon apply between
+	// polls
+	EventsQueue string
+	// Policy holds the rules of --policy, evaluated after the scan
+	Policy          Policy
+	Remediate       string
+	Yes             bool
+	DryRun          bool
+	DrainTimeout    time.Duration
+	RestartAgent    bool
+	AuditLog        string
+	AuditLogGroup   string
+	CheckSSM        bool
+	FetchAgentLogs  bool
+	AgentLogGroup   string
+	AgentLogLines   int
+	Wait            bool
+	WaitTimeout     time.Duration
+	EC2Details      bool
+	ExcludeExternal bool
+	OnlyUnhealthy   bool
+	ShowTasks       bool
+	Summary         bool
+	Report          bool
+	// Fields are the agent fields of the table, csv, json, yaml and jsonl output, all of them when empty
+	Fields              []string
+	LogAgents           bool
+	Progress            bool
+	Filter              string
+	Tags                map[string]string
+	StateFile           string
+	PagerDutyRoutingKey string
+	EmailTo             []string
+	SESFrom             string
+	SESRegion           string
+	EmailAttachHTML     bool
+	Retry               agentstatus.RetryOptions
+	MaxAPIRate          float64
+	// MaxInFlight bounds the Describe calls in progress at once in each region, ClusterWorkers the
+	// DescribeContainerInstances batches of a cluster described at once and MaxAPICalls the API calls of a run,
+	// or of each poll of watch, serve, tui and the daemon
+	MaxInFlight    int
+	ClusterWorkers int
+	MaxAPICalls    int64
+	RecordFixtures string
+	ReplayFixtures string
+	Timeout        time.Duration
+	AssumeRole     agentstatus.AssumeRole
+	AllAccounts    bool
+	Accounts       []AccountConfig
+	// Notifiers are the notification targets of the notifiers section of the config file
+	Notifiers              []NotifierConfig
+	ClusterRefreshInterval time.Duration
+	// clusterCache, when set, keeps the matched clusters between the polls of watch and serve
+	clusterCache *ClusterCache
+	// scanErrors are the regions and clusters the run could not check, written to JSON output
+	scanErrors []ScanError
+	// policyResults are the results of the --policy rules, written to JSON and YAML output
+	policyResults []PolicyResult
+	// Redactor, set by --redact, redacts the identifiers of the output
+	Redactor *Redactor
+	// eventsClient receives the messages of EventsQueue
+	eventsClient SQSReceiver
 }
 
-// GetInput returns the value of the first positional argument to be used as the substring
-// to match cluster names
-func GetInput() string {
-	args := os.Args[1:] // Retrieve all command-line arguments except the program name (index 0)
+// streamJSONL reports whether jsonl output can be written per cluster as the scan progresses, which is not
+// possible when the output depends on the whole fleet, on the agents being re-checked or waited for or on
+// their tasks, or when it is sorted or grouped by something other than cluster
+func (opts Options) streamJSONL() bool {
+	return opts.Output == "jsonl" && !opts.DetectVersionDrift && !opts.DetectLaunchTemplateDrift && !opts.DetectDuplicates && !opts.RestartAgent && opts.Recheck == 0 && !opts.ShowTasks && !opts.CheckSSM && !opts.FetchAgentLogs && !opts.Wait &&
+		opts.Sort == "" && (opts.GroupBy == "" || opts.GroupBy == "cluster")
+}
 
-	// Check if at least one argument is provided
-	if len(args) < 1 {
-		fmt.Println("Usage: ecs-agent-status <cluster name substring>")
-		os.Exit(1)
-	}
+// shortArn returns the last slash-separated segment of an ARN, which for a container instance is its ID
+func shortArn(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
 
-	// Return the value of the first positional argument
-	return args[0]
+// groupByLabels are the --group-by values and the labels of their group headers in text output
+var groupByLabels = map[string]string{
+	"cluster":           "Cluster",
+	"capacity-provider": "CapacityProvider",
+	"asg":               "ASG",
+	"az":                "AZ",
+	"os":                "OS",
 }
 
-// GetECSClustersWithSubstring returns a list of ECS cluster names that contain the specified substring
-func GetECSClustersWithSubstring(substring string) ([]string, error) {
-	var clusters []string
+// groupByAttribute is the prefix of the --group-by values grouping by a container instance attribute, e.g.
+// attribute:stack
+const groupByAttribute = "attribute:"
 
-	// Load AWS SDK configuration
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		return nil, err
+// groupByLabel returns the label of the group headers of a --group-by value in text output, the name of the
+// attribute for attribute:<name>, or "" if the value is invalid
+func groupByLabel(groupBy string) string {
+	if name, ok := strings.CutPrefix(groupBy, groupByAttribute); ok {
+		return name
 	}
+	return groupByLabels[groupBy]
+}
 
-	// Create an ECS client
-	client := ecs.NewFromConfig(cfg)
+// noGroup is the group of agents without a capacity provider, Auto Scaling group, availability zone,
+// operating system or the attribute grouped by
+const noGroup = "none"
 
-	// Initialize paginator for ListClusters API
-	paginator := ecs.NewListClustersPaginator(client, &ecs.ListClustersInput{})
+// groupAgents groups the agents by the --group-by field, or by cluster when output is not grouped
+func (opts Options) groupAgents(agents []agentstatus.Agent) ([]string, map[string][]agentstatus.Agent) {
+	if name, ok := strings.CutPrefix(opts.GroupBy, groupByAttribute); ok {
+		return agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string { return valueOr(agent.Attributes[name], noGroup) })
+	}
+	switch opts.GroupBy {
+	case "capacity-provider":
+		return agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string { return valueOr(agent.CapacityProvider, noGroup) })
+	case "asg":
+		return agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string { return valueOr(agent.AutoScalingGroup, noGroup) })
+	case "az":
+		return agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string { return valueOr(agent.AvailabilityZone, noGroup) })
+	case "os":
+		return agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string { return valueOr(agent.OSFamily, valueOr(agent.OSType, noGroup)) })
+	}
+	return agentstatus.GroupByCluster(agents)
+}
 
-	// Iterate through pages of clusters
-	for paginator.HasMorePages() {
-		output, err := paginator.NextPage(context.Background())
-		if err != nil {
-			return nil, err
-		}
+// valueOr returns value, or fallback if value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
 
-		// Check if cluster names contain the specified substring
-		for _, clusterArn := range output.ClusterArns {
-			clusterName := strings.Split(clusterArn, "/")[1] // Extract cluster name from ARN
-			if strings.Contains(clusterName, substring) {
-				clusters = append(clusters, clusterName)
+// writeJSONLResult writes one group's agents in jsonl mode: one line per agent, or a single line holding a
+// map of the group name to its agents when grouping with --group-by
+func writeJSONLResult(w io.Writer, group string, agents []agentstatus.Agent, opts Options) error {
+	if opts.GroupBy == "" && len(opts.Fields) == 0 {
+		return WriteJSONL(w, agents)
+	}
+	if opts.GroupBy == "" {
+		encoder := json.NewEncoder(w)
+		for _, agent := range agents {
+			if err := encoder.Encode(SelectedAgent{Agent: agent, Fields: opts.Fields}); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
-	if len(clusters) == 0 {
-		return nil, errors.New("no clusters found")
+	if len(agents) == 0 {
+		return nil
 	}
-	return clusters, nil
+	return json.NewEncoder(w).Encode(map[string]any{group: opts.selectFields(agents)})
 }
 
-// GetContainerInstancesForCluster returns a list of container instance ARNs for the specified ECS cluster
-func GetContainerInstancesForCluster(clusterName string) ([]string, error) {
-	var containerInstances []string
+// jsonReport is the JSON output with --summary or --policy, or when some regions or clusters could not be
+// checked: the agents, as written otherwise, with the cluster summaries, the scan errors and the results of
+// the policy rules
+type jsonReport struct {
+	Agents    any            `json:"agents"`
+	Summaries any            `json:"summaries,omitempty"`
+	Errors    []ScanError    `json:"errors,omitempty"`
+	Policy    []PolicyResult `json:"policy,omitempty"`
+}
 
-	// Load AWS SDK configuration
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		return nil, err
+// WriteJSON writes the agents to w as an indented JSON array, or as an object mapping each group name to
+// its agents when grouping with --group-by. With --summary, or when some regions or clusters could not be
+// checked, they are written under agents, next to the cluster summaries under summaries and the regions and
+// clusters that could not be checked under errors. With --policy, the result of each rule is under policy
+func WriteJSON(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reportValue(agents, opts))
+}
+
+// reportOutput is the JSON and YAML output with --report: the versioned agentstatus.Report, with the agents
+// also grouped under groups when grouping with --group-by and the results of the --policy rules under policy
+type reportOutput struct {
+	agentstatus.Report
+	Groups map[string][]agentstatus.Agent `json:"groups,omitempty"`
+	Policy []PolicyResult                 `json:"policy,omitempty"`
+}
+
+// newReportOutput returns the --report output of the agents and the scan errors of opts, made at now
+func newReportOutput(agents []agentstatus.Agent, opts Options, now time.Time) reportOutput {
+	scanErrors := opts.outputScanErrors()
+	errs := make([]*agentstatus.ClusterError, len(scanErrors))
+	for i, scanErr := range scanErrors {
+		errs[i] = &agentstatus.ClusterError{AccountID: scanErr.AccountID, Region: scanErr.Region, Cluster: scanErr.Cluster, Err: errors.New(scanErr.Error)}
+	}
+	if len(errs) == 0 {
+		errs = nil
 	}
+	output := reportOutput{Report: agentstatus.NewReport(agents, errs, opts.HealthPolicy, now), Policy: opts.policyResults}
+	if opts.GroupBy != "" {
+		_, output.Groups = opts.groupAgents(agents)
+	}
+	return output
+}
 
-	// Create an ECS client
-	client := ecs.NewFromConfig(cfg)
+// reportValue returns the value written by --output json and yaml: the agents, grouped with --group-by,
+// inside a report object when there are cluster summaries, scan errors or policy results, or the versioned
+// report with --report
+func reportValue(agents []agentstatus.Agent, opts Options) any {
+	if opts.Report {
+		return newReportOutput(agents, opts, time.Now())
+	}
+	value := opts.selectFields(agents)
+	if opts.GroupBy != "" {
+		keys, groups := opts.groupAgents(agents)
+		grouped := make(map[string]any, len(keys))
+		for _, key := range keys {
+			grouped[key] = opts.selectFields(groups[key])
+		}
+		value = grouped
+	}
+	if opts.Summary || len(opts.scanErrors) > 0 || len(opts.policyResults) > 0 {
+		report := jsonReport{Agents: value, Errors: opts.outputScanErrors(), Policy: opts.policyResults}
+		if opts.Summary {
+			summaries := agentstatus.SummarizeClusters(agents)
+			if summaries == nil {
+				summaries = []agentstatus.ClusterSummary{}
+			}
+			report.Summaries = summaries
+			if opts.groupSummaries() {
+				keys, groups := opts.groupAgents(agents)
+				grouped := make(map[string][]agentstatus.ClusterSummary, len(keys))
+				for _, key := range keys {
+					grouped[key] = agentstatus.SummarizeClusters(groups[key])
+				}
+				report.Summaries = grouped
+			}
+		}
+		value = report
+	}
+	return value
+}
 
-	// Initialize the input parameters for ListContainerInstances API
-	input := &ecs.ListContainerInstancesInput{
-		Cluster: &clusterName,
+// WriteJSONL writes each agent to w as a compact single-line JSON object followed by a newline
+func WriteJSONL(w io.Writer, agents []agentstatus.Agent) error {
+	encoder := json.NewEncoder(w)
+	for _, agent := range agents {
+		if err := encoder.Encode(agent); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Retrieve the list of container instances for the specified ECS cluster
-	output, err := client.ListContainerInstances(context.Background(), input)
-	if err != nil {
-		return nil, err
+// NewLogger returns a logger writing to stderr in the given format: json, or console for a human-readable
+// colored log
+func NewLogger(format string) zerolog.Logger {
+	var w io.Writer = os.Stderr
+	if format == "console" {
+		w = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
 	}
-	if len(output.ContainerInstanceArns) == 0 {
-		return nil, errors.New("no container instances found")
+	return zerolog.New(w).With().Str("version", version.Version).Timestamp().Logger()
+}
+
+// LogAgents logs each agent as a structured event, at warn level for agents that are unhealthy under
+// policy and info level otherwise, so log pipelines ingesting stderr see the results as well as stdout
+func LogAgents(log zerolog.Logger, agents []agentstatus.Agent, policy agentstatus.HealthPolicy) {
+	for _, agent := range agents {
+		event := log.Info()
+		if policy.Unhealthy(agent) {
+			event = log.Warn()
+		}
+		if agent.AccountID != "" {
+			event = event.Str("accountId", agent.AccountID)
+		}
+		event.Str("region", agent.Region).Str("cluster", agent.Cluster).Str("containerInstanceArn", agent.ContainerInstanceARN).
+			Str("instanceId", agent.InstanceID()).Str("agentStatus", agent.AgentStatus).Bool("agentConnected", agent.AgentConnected).
+			Str("agentVersion", agent.AgentVersion).Int("runningTasks", agent.RunningTasks).Bool("healthy", !policy.Unhealthy(agent)).
+			Msg("agent")
 	}
-	// Describe container instances to get their ARNs
-	describeInput := &ecs.DescribeContainerInstancesInput{
-		Cluster:            &clusterName,
-		ContainerInstances: output.ContainerInstanceArns,
+}
+
+// WriteText writes one text line per agent to w. When grouping by cluster each cluster gets a header line
+// with its agents indented underneath
+func WriteText(w io.Writer, agents []agentstatus.Agent, opts Options) {
+	if opts.GroupBy == "" {
+		for _, agent := range agents {
+			writeTextAgent(w, agent, "", opts)
+		}
+		return
 	}
+	keys, groups := opts.groupAgents(agents)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%v: %v (%v agents)\n", groupByLabel(opts.GroupBy), key, len(groups[key]))
+		for _, agent := range groups[key] {
+			writeTextAgent(w, agent, "  ", opts)
+		}
+	}
+}
 
-	describeOutput, err := client.DescribeContainerInstances(context.Background(), describeInput)
-	if err != nil {
-		return nil, err
+// writeTextAgent writes the text output line of an agent, followed by an indented line per task found by
+// --show-tasks
+func writeTextAgent(w io.Writer, agent agentstatus.Agent, indent string, opts Options) {
+	fmt.Fprintln(w, indent+FormatAgent(agent, opts))
+	for _, task := range agent.Tasks {
+		fmt.Fprintln(w, indent+"    "+FormatTask(task, opts))
+	}
+	for _, line := range agent.AgentLog {
+		fmt.Fprintln(w, indent+"    | "+line)
 	}
+}
 
-	// Extract the ARNs of container instances
-	for _, instance := range describeOutput.ContainerInstances {
-		containerInstances = append(containerInstances, *instance.ContainerInstanceArn)
+// FormatAgent returns the text output line for an agent
+func FormatAgent(agent agentstatus.Agent, opts Options) string {
+	if opts.FormatArn == "short" {
+		agent.ContainerInstanceARN = shortArn(agent.ContainerInstanceARN)
 	}
+	if opts.Color {
+		agent.AgentStatus = colorizeStatus(agent.AgentStatus)
+	}
+	line := agent.String()
+	if opts.Color && !agent.AgentConnected {
+		line = strings.Replace(line, "AgentConnected: false", "AgentConnected: "+colorizeConnected(false), 1)
+	}
+	line += fmt.Sprintf(", AgentVersion: %v", agent.AgentVersion)
+	if agent.VersionDrift {
+		line += " (drift)"
+	}
+	if agent.Outdated {
+		line += " (outdated)"
+	}
+	line += fmt.Sprintf(", DockerVersion: %v", agent.DockerVersion)
+	if agent.DockerVersionDrift {
+		line += " (drift)"
+	}
+	if agent.ContainerdVersion != "" {
+		line += fmt.Sprintf(", Containerd: %v", agent.ContainerdVersion)
+	}
+	if agent.OSType != "" {
+		line += fmt.Sprintf(", OS: %v", valueOr(agent.OSFamily, agent.OSType))
+	}
+	if agent.SSMPingStatus != "" {
+		line += fmt.Sprintf(", SSM: %v", agent.SSMPingStatus)
+	}
+	if agent.RegisteredAt != nil {
+		line += fmt.Sprintf(", Age: %v", FormatAge(agent.AgeSeconds))
+	}
+	if agent.DisconnectedSince != nil {
+		line += fmt.Sprintf(", DisconnectedFor: %v", FormatAge(agent.DisconnectedForSeconds))
+	}
+	if agent.LaunchType == agentstatus.LaunchTypeExternal {
+		line += fmt.Sprintf(", LaunchType: external, ManagedInstanceID: %v", agent.ManagedInstanceID)
+	}
+	if agent.AccountID != "" {
+		line += fmt.Sprintf(", Account: %v", agent.AccountID)
+	}
+	if agent.AvailabilityZone != "" {
+		line += fmt.Sprintf(", InstanceType: %v, AZ: %v, PrivateIP: %v, ASG: %v", agent.InstanceType, agent.AvailabilityZone, agent.PrivateIP, agent.AutoScalingGroup)
+	} else if agent.AutoScalingGroup != "" {
+		line += fmt.Sprintf(", ASG: %v", agent.AutoScalingGroup)
+	}
+	if agent.CapacityProvider != "" {
+		line += fmt.Sprintf(", CapacityProvider: %v", agent.CapacityProvider)
+	}
+	if agent.LifecycleState != "" && agent.LifecycleState != "InService" {
+		line += fmt.Sprintf(", Lifecycle: %v", agent.LifecycleState)
+	}
+	if agent.ImageID != "" {
+		line += fmt.Sprintf(", AMI: %v", agent.ImageID)
+	}
+	if agent.LaunchTemplateID != "" {
+		line += fmt.Sprintf(", LaunchTemplate: %v:%v", agent.LaunchTemplateID, agent.LaunchTemplateVersion)
+	}
+	if agent.LaunchTemplateDrift {
+		line += fmt.Sprintf(" (stale, current %v)", agent.CurrentLaunchTemplateVersion)
+	}
+	if len(agent.DuplicateRegistrations) > 0 {
+		labels := make([]string, len(agent.DuplicateRegistrations))
+		for i, arn := range agent.DuplicateRegistrations {
+			labels[i] = registrationLabel(arn)
+		}
+		line += fmt.Sprintf(", AlsoRegisteredAs: %v", strings.Join(labels, " "))
+	}
+	if agent.StatusCheckFailed() {
+		line += fmt.Sprintf(", StatusChecks: system %v, instance %v", agent.SystemStatus, agent.InstanceStatus)
+	}
+	if len(agent.ScheduledEvents) > 0 {
+		line += fmt.Sprintf(", ScheduledEvents: %v", strings.Join(eventCodes(agent.ScheduledEvents), " "))
+	}
+	if opts.IncludeResources {
+		line += fmt.Sprintf(", CPU: %v/%v, Memory: %v/%v", agent.RemainingCPU, agent.RegisteredCPU, agent.RemainingMemory, agent.RegisteredMemory)
+	}
+	if len(opts.ShowAttributes) > 0 {
+		var attributes []string
+		for _, name := range opts.ShowAttributes {
+			if value, ok := agent.Attributes[name]; ok {
+				attributes = append(attributes, name+"="+value)
+			}
+		}
+		line += fmt.Sprintf(", Attributes: %v", strings.Join(attributes, " "))
+	}
+	return line
+}
+
+// outputHealthPolicy selects the agents printed by --only-unhealthy: those that are not ACTIVE or not
+// connected, whatever --fail-on is
+var outputHealthPolicy = agentstatus.HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}
 
-	return containerInstances, nil
+// outputAgents returns the agents to print, in --sort order and redacted with --redact: all of them, or only
+// the unhealthy ones with --only-unhealthy
+func (opts Options) outputAgents(agents []agentstatus.Agent) []agentstatus.Agent {
+	if opts.OnlyUnhealthy {
+		agents = outputHealthPolicy.UnhealthyAgents(agents)
+	}
+	if opts.Sort != "" {
+		agents = SortAgents(agents, opts.Sort, opts.HealthPolicy)
+	}
+	return opts.redactAgents(agents)
 }
 
-// GetEC2InstanceIDAndECSAgentStatus returns the EC2 instance ID and ECS agent status for the specified
-// container instance
-func GetEC2InstanceIDAndECSAgentStatus(clusterName, containerInstanceArn string) (string, string, error) {
-	var ec2InstanceID, ecsAgentStatus string
+// redactAgents returns the agents with their identifiers redacted with --redact, or the agents themselves
+func (opts Options) redactAgents(agents []agentstatus.Agent) []agentstatus.Agent {
+	if opts.Redactor == nil {
+		return agents
+	}
+	return opts.Redactor.Agents(agents)
+}
 
-	// Load AWS SDK configuration
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		return "", "", err
+// outputScanErrors returns the scan errors to print, redacted with --redact
+func (opts Options) outputScanErrors() []ScanError {
+	if opts.Redactor == nil {
+		return opts.scanErrors
 	}
+	return opts.Redactor.ScanErrors(opts.scanErrors)
+}
 
-	// Create an ECS client
-	client := ecs.NewFromConfig(cfg)
+// outputPolicyViolations returns the policy violations to print, redacted with --redact
+func (opts Options) outputPolicyViolations(violations []PolicyViolation) []PolicyViolation {
+	if opts.Redactor == nil {
+		return violations
+	}
+	return opts.Redactor.PolicyViolations(violations)
+}
 
-	// Describe the container instance to retrieve ECS agent status
-	describeInput := &ecs.DescribeContainerInstancesInput{
-		Cluster:            aws.String(clusterName),
-		ContainerInstances: []string{containerInstanceArn},
+// WriteOutput writes the agents to w with the Renderer of the format selected by opts.Output, or the
+// cluster summaries with --summary
+func WriteOutput(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	if opts.Summary && opts.Output != "json" && opts.Output != "yaml" {
+		if opts.groupSummaries() {
+			return WriteGroupSummaries(w, agents, opts)
+		}
+		return WriteClusterSummaries(w, agentstatus.SummarizeClusters(agents), opts)
 	}
+	renderer, ok := lookupRenderer(opts.Output)
+	if !ok {
+		return fmt.Errorf("unknown output format %q", opts.Output)
+	}
+	return renderer.Render(w, agents, opts)
+}
 
-	describeOutput, err := client.DescribeContainerInstances(context.Background(), describeInput)
-	if err != nil {
-		return "", "", err
+// WithTimeout returns a context that is cancelled after timeout, or ctx itself when timeout is 0
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
 	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-	// Check if the container instance information exists
-	if len(describeOutput.ContainerInstances) == 0 {
-		return "", "", fmt.Errorf("container instance not found")
+// cancelledExitCode logs why the run stopped early and returns its exit code: ExitError when the --timeout
+// deadline passed and ExitInterrupted on SIGINT or SIGTERM
+func cancelledExitCode(ctx context.Context, opts Options, msg string) int {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.Error().Err(ctx.Err()).Dur("timeout", opts.Timeout).Msgf("timed out after %v %v", opts.Timeout, msg)
+		return ExitError
 	}
+	logger.Warn().Msgf("interrupted %v", msg)
+	return ExitInterrupted
+}
 
-	// Extract EC2 instance ID and ECS agent status
-	ec2InstanceID = *describeOutput.ContainerInstances[0].Ec2InstanceId
-	ecsAgentStatus = *describeOutput.ContainerInstances[0].Status
+// scanErrorExitCode logs why the clusters could not be scanned and returns the exit code: ExitHealthy when
+// none match and --allow-empty is set, ExitNoClusters when none match and ExitError otherwise
+func scanErrorExitCode(ctx context.Context, err error, opts Options) int {
+	switch {
+	case ctx.Err() != nil:
+		return cancelledExitCode(ctx, opts, "while listing clusters")
+	case errors.Is(err, agentstatus.ErrNoClustersMatched) && opts.AllowEmpty:
+		logger.Warn().Err(err).Msgf("no clusters matching %q, exiting successfully because --allow-empty is set", opts.ClusterPatterns)
+		return ExitHealthy
+	case errors.Is(err, agentstatus.ErrNoClustersMatched):
+		logger.Error().Err(err).Msgf("no clusters matching %q", opts.ClusterPatterns)
+		return ExitNoClusters
+	}
+	logger.Error().Err(err).Msgf("error getting clusters: %v", err)
+	return ExitError
+}
 
-	return ec2InstanceID, ecsAgentStatus, nil
+// LoadRegionConfigs resolves the regions to scan and loads the AWS config once per region, or once per
+// region of every configured account with --all-accounts
+func LoadRegionConfigs(ctx context.Context, opts Options) (map[string]aws.Config, error) {
+	if opts.AllAccounts {
+		return LoadAccountConfigs(ctx, opts)
+	}
+	regions, err := ResolveRegions(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("list enabled regions: %w", err)
+	}
+	return LoadAWSConfigs(ctx, regions, opts)
 }
 
-// GetAgentStatusForCluster returns a list of Agent structs for the specified ECS cluster
-func GetAgentStatusForCluster(clusterName string) ([]Agent, error) {
-	var agents []Agent
+// apiStats counts the AWS API call attempts and throttling errors of the run
+var apiStats agentstatus.APIStats
+
+// apiBudget, set by --max-api-calls, is shared by the AWS configs of every region
+var apiBudget *agentstatus.APIBudget
 
-	// Get the list of container instances for the specified ECS cluster
-	containerInstances, err := GetContainerInstancesForCluster(clusterName)
+// LoadAWSConfigs loads the AWS config of each region with the --profile credentials, assuming --role-arn
+// with them if it is set, and calling --endpoint-url if it is set. Each region's clients retry as set by
+// --max-attempts and --max-backoff, share a --max-api-rate limit for Describe calls and a --max-in-flight
+// limit of those in progress, take their calls from apiBudget, count their calls in apiStats and with
+// --verbose log them. With --record-fixtures they record the ECS, EC2 and Auto Scaling responses, and with
+// --replay-fixtures they answer from the recorded ones without calling AWS
+func LoadAWSConfigs(ctx context.Context, regions []string, opts Options) (map[string]aws.Config, error) {
+	cfgs, err := agentstatus.LoadAWSConfigs(ctx, regions, opts.Profile)
 	if err != nil {
 		return nil, err
 	}
-
-	// Get the EC2 instance ID and ECS agent status for each container instance
-	for _, containerInstance := range containerInstances {
-		ec2InstanceID, ecsAgentStatus, err := GetEC2InstanceIDAndECSAgentStatus(clusterName, containerInstance)
-		if err != nil {
-			return nil, err
+	for region, cfg := range cfgs {
+		cfg = agentstatus.WithRetries(agentstatus.WithEndpoint(cfg, opts.EndpointURL), opts.Retry)
+		cfg = agentstatus.WithAPIControls(cfg, agentstatus.NewRateLimiter(opts.MaxAPIRate), &apiStats)
+		cfg = agentstatus.WithAPILimits(cfg, agentstatus.NewInFlightLimiter(opts.MaxInFlight), apiBudget)
+		if opts.Verbose {
+			cfg = agentstatus.WithAPILogging(cfg)
+		}
+		if opts.RecordFixtures != "" {
+			cfg = agentstatus.WithFixtureRecording(cfg, opts.RecordFixtures)
+		}
+		cfg = withTelemetry(agentstatus.WithAssumeRole(cfg, opts.AssumeRole))
+		// Replayed calls need no credentials, so the role is not assumed
+		if opts.ReplayFixtures != "" {
+			cfg = agentstatus.WithFixtureReplay(cfg, opts.ReplayFixtures)
 		}
+		cfgs[region] = cfg
+	}
+	return cfgs, nil
+}
 
-		// Create an Agent struct for the container instance
-		agent := Agent{
-			Cluster:              clusterName,
-			ContainerInstanceARN: containerInstance,
-			EC2InstanceID:        ec2InstanceID,
-			AgentStatus:          ecsAgentStatus,
+// NewCheckers returns a StatusChecker for each AWS config, with the same ScopeKey
+func NewCheckers(cfgs map[string]aws.Config, opts Options) map[string]*agentstatus.StatusChecker {
+	checkers := make(map[string]*agentstatus.StatusChecker)
+	for key, cfg := range cfgs {
+		checkers[key] = agentstatus.NewStatusCheckerFromConfig(cfg)
+		checkers[key].AccountID = scopeAccount(key)
+		checkers[key].Filter = opts.Filter
+		checkers[key].IncludeInactive = opts.IncludeInactive
+		checkers[key].IncludeRaw = opts.IncludeRaw
+		checkers[key].Attributes = opts.ShowAttributes
+		checkers[key].DescribeWorkers = opts.ClusterWorkers
+		if !opts.EC2Details {
+			checkers[key].EC2, checkers[key].AutoScaling = nil, nil
 		}
+	}
+	return checkers
+}
 
-		// Append the Agent struct to the list of agents
-		agents = append(agents, agent)
+// Scan lists the clusters matching the patterns in every region, checks them and returns their agents after
+// filtering, sorted by account, region, cluster and instance, with the clusters that were checked, including those
+// without container instances. If stream is not nil it is called with each cluster's agents as soon as that
+// cluster completes. With opts.Recheck the disconnected agents are described again before they are returned.
+// The regions whose clusters could not be listed and the clusters that could not be checked are logged, left
+// out and returned as ScanErrors. ErrNoClustersMatched is returned when nothing matches
+func Scan(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options, stream func(cluster string, agents []agentstatus.Agent)) ([]agentstatus.Agent, []ClusterRef, []ScanError, error) {
+	var agents []agentstatus.Agent
+	var checked []ClusterRef
+	var scanErrs []ScanError
+	clustersByRegion, listErrs := listClusters(ctx, checkers, opts)
+	if ctx.Err() != nil {
+		return nil, nil, nil, ctx.Err()
+	}
+	var matched []string
+	for _, region := range SortedRegions(checkers) {
+		if err, ok := listErrs[region]; ok {
+			if len(checkers) == 1 {
+				return nil, nil, nil, err
+			}
+			logger.Warn().Err(err).Str("region", region).Msgf("error getting clusters in region %v: %v", region, err)
+			scanErrs = append(scanErrs, ScanError{AccountID: scopeAccount(region), Region: checkers[region].Region, Error: err.Error()})
+		}
+		matched = append(matched, clustersByRegion[region]...)
 	}
+	if len(matched) == 0 {
+		return nil, nil, scanErrs, agentstatus.ErrNoClustersMatched
+	}
+	if err := agentstatus.CheckMaxClusters(matched, opts.MaxClusters); err != nil {
+		return nil, nil, scanErrs, err
+	}
+	logger.Info().Msgf("found %v matching clusters", len(matched))
 
-	return agents, nil
+	progress := newProgressReporter(len(matched), opts)
+	for scanned := range ScanRegions(ctx, checkers, clustersByRegion, opts.Concurrency) {
+		progress.clusterDone(len(scanned.Agents))
+		switch {
+		case errors.Is(scanned.Err, agentstatus.ErrNoContainerInstances) && opts.FailOnEmpty:
+			logger.Error().Str("region", scanned.Region).Msgf("cluster %v has no container instances", scanned.Cluster)
+			scanErrs = append(scanErrs, ScanError{AccountID: scanned.AccountID, Region: scanned.Region, Cluster: scanned.Cluster, Error: scanned.Err.Error()})
+			continue
+		case errors.Is(scanned.Err, agentstatus.ErrFargateOnly):
+			logger.Info().Str("region", scanned.Region).Msgf("cluster %v runs on Fargate: N/A – no EC2 capacity", scanned.Cluster)
+			checked = append(checked, ClusterRef{AccountID: scanned.AccountID, Region: scanned.Region, Cluster: scanned.Cluster})
+			continue
+		case errors.Is(scanned.Err, agentstatus.ErrNoContainerInstances):
+			logger.Info().Str("region", scanned.Region).Msgf("cluster %v has no container instances", scanned.Cluster)
+			checked = append(checked, ClusterRef{AccountID: scanned.AccountID, Region: scanned.Region, Cluster: scanned.Cluster})
+			continue
+		case scanned.Err != nil:
+			if ctx.Err() == nil {
+				logger.Error().Err(scanned.Err).Str("region", scanned.Region).Msgf("error getting agents for cluster %v: %v", scanned.Cluster, scanned.Err)
+				scanErrs = append(scanErrs, ScanError{AccountID: scanned.AccountID, Region: scanned.Region, Cluster: scanned.Cluster, Error: scanned.Err.Error()})
+			}
+			continue
+		}
+		now := time.Now()
+		agentstatus.SetAges(scanned.Agents, now)
+		result := agentstatus.FilterSince(scanned.Agents, opts.Since, now)
+		result = agentstatus.FilterMinAge(result, opts.MinAge, now)
+		result = agentstatus.FilterInstances(result, opts.Instances)
+		result = agentstatus.FilterTags(result, opts.Tags)
+		result = agentstatus.FilterPlatform(result, opts.Platform)
+		if opts.ExcludeExternal {
+			result = agentstatus.FilterExternal(result)
+		}
+		if opts.MinAgentVersion != "" {
+			agentstatus.MarkOutdated(result, opts.MinAgentVersion)
+		}
+		agents = append(agents, result...)
+		checked = append(checked, ClusterRef{AccountID: scanned.AccountID, Region: scanned.Region, Cluster: scanned.Cluster})
+		if stream != nil {
+			stream(scanned.Cluster, result)
+		}
+	}
+	progress.finish()
+	if opts.Recheck > 0 {
+		agents = RecheckDisconnected(ctx, checkers, agents, opts.Recheck, opts.RecheckInterval)
+	}
+	// Clusters, regions and accounts complete in any order, so sort for stable output
+	agentstatus.SortByLocation(agents)
+	sort.Slice(checked, func(i, j int) bool {
+		a, b := checked[i], checked[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Cluster < b.Cluster
+	})
+	sortScanErrors(scanErrs)
+	RecordScanMetrics(ctx, agents, opts.HealthPolicy)
+	return agents, checked, scanErrs, nil
 }
+
 func main() {
-	failed := false
-	var agents []Agent
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	logger := zerolog.New(os.Stderr).With().Str("version", version.Version).Timestamp().Logger()
-	clusterNameSubstring := GetInput()
-	clusters, err := GetECSClustersWithSubstring(clusterNameSubstring)
+	os.Exit(run())
+}
+
+// run checks the agents and returns the process exit code
+func run() (code int) {
+	opts := GetInput()
+	zerolog.SetGlobalLevel(opts.LogLevel)
+	logger = NewLogger(opts.LogFormat)
+	agentstatus.SetLogger(logger)
+	shutdownTelemetry, err := SetupTelemetry(context.Background())
+	if err != nil {
+		logger.Warn().Err(err).Msgf("error setting up OpenTelemetry export, continuing without it: %v", err)
+		shutdownTelemetry = func(context.Context) error { return nil }
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+		defer cancel()
+		if err := shutdownTelemetry(ctx); err != nil {
+			logger.Warn().Err(err).Msg("error exporting OpenTelemetry data")
+		}
+	}()
+
+	if opts.ProfileAPIs {
+		defer func() {
+			if err := WriteAPIProfile(os.Stderr, apiStats.Operations()); err != nil {
+				logger.Error().Err(err).Msg("error writing the API profile")
+			}
+		}()
+	}
+
+	// Nagios output always has a status line, including for runs that end before the agents are reported
+	nagiosState := -1
+	if opts.Output == "nagios" {
+		defer func() {
+			switch {
+			case nagiosState >= 0:
+				code = nagiosState
+			case code == ExitHealthy:
+				fmt.Printf("%v %v - no clusters matching %q\n", nagiosPrefix, nagiosStateNames[NagiosOK], opts.ClusterPatterns)
+			default:
+				WriteNagiosUnknown(os.Stdout, "the agents could not be checked, see the logs")
+				code = NagiosUnknown
+			}
+		}()
+	}
+
+	// Cancel outstanding API calls on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Watch, serve, the daemon and the dashboard run until stopped, so their timeout applies to each poll instead
+	if !opts.Watch && opts.Serve == "" && !opts.Daemon && !opts.TUI {
+		var cancel context.CancelFunc
+		ctx, cancel = WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+		var span trace.Span
+		ctx, span = tracer.Start(ctx, "ecs-agent-status", trace.WithAttributes(attribute.StringSlice("patterns", opts.ClusterPatterns)))
+		defer span.End()
+	}
+	apiBudget = agentstatus.NewAPIBudget(opts.MaxAPICalls)
+	cfgs, err := LoadRegionConfigs(ctx, opts)
+	if err != nil {
+		logger.Error().Err(err).Msgf("error loading AWS config: %v", err)
+		return ExitError
+	}
+	checkers := NewCheckers(cfgs, opts)
+	if opts.Preflight {
+		if code := runPreflight(ctx, cfgs, checkers, opts); code != ExitHealthy {
+			return code
+		}
+	}
+	if auditLog, err = OpenAuditLog(ctx, cfgs, opts); err != nil {
+		logger.Error().Err(err).Msgf("error opening the audit log: %v", err)
+		return ExitError
+	}
+	defer func() {
+		if err := auditLog.Close(); err != nil {
+			logger.Error().Err(err).Msg("error closing the audit log")
+		}
+	}()
+	if opts.Watch || opts.Serve != "" || opts.Daemon || opts.TUI {
+		opts.clusterCache = NewClusterCache(opts.ClusterRefreshInterval)
+	}
+	if opts.EventsQueue != "" {
+		if opts.eventsClient, err = NewEventsQueueClient(ctx, cfgs, opts); err != nil {
+			logger.Error().Err(err).Msgf("error loading AWS config for the events queue: %v", err)
+			return ExitError
+		}
+	}
+	if opts.Watch {
+		if err := Watch(ctx, cfgs, checkers, opts); err != nil {
+			logger.Error().Err(err).Msg("error writing output")
+			return ExitError
+		}
+		return ExitHealthy
+	}
+	if opts.Services {
+		return runServices(ctx, checkers, opts)
+	}
+	if opts.UpdateAgents {
+		return runUpdateAgents(ctx, checkers, opts)
+	}
+	if opts.ContainerInstance != "" {
+		return runInstance(ctx, checkers, opts)
+	}
+	if opts.ListClusters {
+		return runClusters(ctx, checkers, opts)
+	}
+	if opts.Capacity {
+		return runCapacity(ctx, checkers, opts)
+	}
+	if len(opts.DrainInstances) > 0 {
+		return runDrain(ctx, checkers, opts)
+	}
+	if opts.Prune {
+		return runPrune(ctx, checkers, opts)
+	}
+	if opts.InstallEvents {
+		return runInstallEvents(ctx, cfgs, opts)
+	}
+	if opts.Serve != "" {
+		if err := Serve(ctx, opts.Serve, checkers, opts); err != nil {
+			logger.Error().Err(err).Msgf("error serving metrics: %v", err)
+			return ExitError
+		}
+		return ExitHealthy
+	}
+	if opts.TUI {
+		return runTUI(ctx, checkers, opts)
+	}
+	if opts.Daemon {
+		RunDaemon(ctx, checkers, opts)
+		return ExitHealthy
+	}
+	// Without --remediate, --dry-run only plans the check
+	if opts.DryRun && opts.Remediate == "" {
+		return runPlan(ctx, checkers, opts)
+	}
+
+	// Results go to stdout, or to a temporary file that replaces --output-file once the report is complete
+	var out io.Writer = os.Stdout
+	var outputFile *AtomicFile
+	if opts.OutputFile != "" {
+		outputFile, err = CreateAtomicFile(opts.OutputFile)
+		if err != nil {
+			logger.Error().Err(err).Msgf("error creating output file %v", opts.OutputFile)
+			return ExitError
+		}
+		out = outputFile
+	}
+	var stream func(string, []agentstatus.Agent)
+	var writeErr error
+	// Stream each cluster's agents as soon as it completes, unless the output needs the whole fleet
+	if opts.streamJSONL() {
+		stream = func(cluster string, agents []agentstatus.Agent) {
+			if writeErr == nil {
+				writeErr = writeJSONLResult(out, cluster, opts.outputAgents(agents), opts)
+			}
+		}
+	}
+	var agents []agentstatus.Agent
+	var checked []ClusterRef
+	waitFailed := false
+	if opts.Wait {
+		var healthy bool
+		agents, healthy, err = WaitForHealthy(ctx, opts.WaitTimeout, waitPollInterval, func(ctx context.Context) ([]agentstatus.Agent, error) {
+			var scanErr error
+			agents, checked, opts.scanErrors, scanErr = Scan(ctx, checkers, opts, nil)
+			return agents, scanErr
+		})
+		waitFailed = !healthy
+	} else {
+		agents, checked, opts.scanErrors, err = Scan(ctx, checkers, opts, stream)
+	}
 	if err != nil {
-		logger.Fatal().Err(err).Msgf("error getting clusters: %v", err)
+		if outputFile != nil {
+			outputFile.Abort()
+		}
+		return scanErrorExitCode(ctx, err, opts)
 	}
-	logger.Info().Msgf("found %v matching clusters", len(clusters))
-	for _, cluster := range clusters {
-		result, err := GetAgentStatusForCluster(cluster)
+	if opts.RestartAgent {
+		agents, err = RestartAgents(ctx, cfgs, checkers, agents, opts.HealthPolicy.IncludeLifecycleTransitions)
 		if err != nil {
-			logger.Error().Err(err).Msgf("error getting agents for cluster %v: %v", cluster, err)
-			continue
+			logger.Error().Err(err).Msgf("error restarting disconnected agents: %v", err)
+		}
+		if opts.MinAgentVersion != "" {
+			agentstatus.MarkOutdated(agents, opts.MinAgentVersion)
+		}
+	}
+	if opts.ShowTasks {
+		ShowTasks(ctx, checkers, agents, opts.Concurrency)
+	}
+	if opts.CheckSSM {
+		if err := CheckSSM(ctx, cfgs, agents); err != nil {
+			logger.Error().Err(err).Msgf("error checking the instances in SSM: %v", err)
 		}
-		for _, agent := range result {
-			agents = append(agents, agent)
+		LogSSMTriage(agents)
+	}
+	if opts.FetchAgentLogs {
+		FetchAgentLogs(ctx, cfgs, agents, opts)
+	}
+	for _, id := range agentstatus.MissingInstances(agents, opts.Instances) {
+		logger.Warn().Str("ec2InstanceId", id).Msgf("instance %v was not found in any scanned cluster", id)
+	}
+	// The previous state is read before the output, which shows how long the agents have been disconnected
+	var previous State
+	if opts.StateFile != "" {
+		if previous, err = LoadState(opts.StateFile); err != nil {
+			logger.Error().Err(err).Msgf("error reading state file %v, reporting no transitions", opts.StateFile)
+		}
+		SetDisconnectDurations(agents, previous, time.Now())
+	}
+	var majorityVersion string
+	drifting, dockerDrifting := 0, 0
+	if opts.DetectVersionDrift {
+		majorityVersion, drifting = agentstatus.MarkVersionDrift(agents)
+		logger.Info().Str("majorityVersion", majorityVersion).Int("drifting", drifting).
+			Msgf("majority agent version is %v, %v instances differ", majorityVersion, drifting)
+		var majorityDocker string
+		majorityDocker, dockerDrifting = agentstatus.MarkDockerVersionDrift(agents)
+		logger.Info().Str("majorityDockerVersion", majorityDocker).Int("drifting", dockerDrifting).
+			Msgf("majority Docker version is %v, %v instances differ", majorityDocker, dockerDrifting)
+	}
+	staleTemplates := 0
+	if opts.DetectLaunchTemplateDrift {
+		if staleTemplates, err = DetectLaunchTemplateDrift(ctx, cfgs, agents); err != nil {
+			logger.Error().Err(err).Msgf("error checking the launch templates of the Auto Scaling groups: %v", err)
 		}
+		logger.Info().Int("launchTemplateDrifting", staleTemplates).
+			Msgf("%v instances do not run the current launch template version of their Auto Scaling group", staleTemplates)
+	}
+	duplicated := 0
+	if opts.DetectDuplicates {
+		duplicated = agentstatus.MarkDuplicateRegistrations(agents)
+		LogDuplicateRegistrations(agents)
+		logger.Info().Int("duplicated", duplicated).Msgf("%v instances are registered as more than one container instance", duplicated)
 	}
+	outdated := 0
 	for _, agent := range agents {
-		if agent.AgentStatus != "ACTIVE" {
-			failed = true
+		if agent.Outdated {
+			outdated++
+			logger.Warn().Str("ec2InstanceId", agent.EC2InstanceID).Str("agentVersion", agent.AgentVersion).
+				Msgf("instance %v runs ECS agent %v, older than %v", agent.EC2InstanceID, agent.AgentVersion, opts.MinAgentVersion)
 		}
-		fmt.Println(agent)
 	}
-	if failed {
-		os.Exit(1)
+	var violations []PolicyViolation
+	if len(opts.Policy.Rules) > 0 {
+		violations = opts.Policy.Evaluate(agents)
+		LogPolicyViolations(opts.Policy, violations)
+		opts.policyResults = opts.Policy.Results(opts.outputPolicyViolations(violations))
+	}
+	if opts.LogAgents {
+		LogAgents(logger, agents, opts.HealthPolicy)
+	}
+	switch {
+	case writeErr != nil:
+	case opts.Output == "nagios":
+		nagiosState, writeErr = WriteNagios(out, opts.redactAgents(agents), opts)
+		if writeErr != nil {
+			nagiosState = -1
+		}
+	default:
+		writeErr = WriteOutput(out, opts.outputAgents(agents), opts)
+	}
+	var state State
+	var transitions []Transition
+	if opts.StateFile != "" {
+		state = NewState(agents, time.Now())
+		transitions = Transitions(previous, state)
+		for _, transition := range transitions {
+			logger.Warn().Str("transition", transition.Type).Str("cluster", transition.Cluster).Str("containerInstanceArn", transition.ContainerInstanceARN).
+				Msgf("container instance %v in cluster %v %v", transition.InstanceID, transition.Cluster, transition.Type)
+		}
+		if writeErr == nil && len(previous.Agents) > 0 && (opts.Output == "text" || opts.Output == "table") {
+			printed := transitions
+			if opts.Redactor != nil {
+				printed = opts.Redactor.Transitions(transitions)
+			}
+			writeErr = WriteTransitions(out, printed, previous.Time, opts)
+		}
+	}
+	if writeErr == nil && len(opts.Policy.Rules) > 0 && (opts.Output == "text" || opts.Output == "table") {
+		writeErr = WritePolicyResults(out, opts.Policy, opts.outputPolicyViolations(violations))
+	}
+	if writeErr != nil {
+		if outputFile != nil {
+			outputFile.Abort()
+		}
+		logger.Error().Err(writeErr).Msg("error writing output")
+		return ExitError
+	}
+	if outputFile != nil {
+		if err := outputFile.Commit(); err != nil {
+			logger.Error().Err(err).Msgf("error writing output file %v", opts.OutputFile)
+			return ExitError
+		}
+		logger.Info().Msgf("wrote results to %v", opts.OutputFile)
+	}
+	if ctx.Err() != nil {
+		return cancelledExitCode(ctx, opts, fmt.Sprintf("after reporting %v agents gathered before cancellation", len(agents)))
+	}
+	if opts.StateFile != "" {
+		// Only complete runs are saved, so the next run compares against every instance
+		if err := SaveState(opts.StateFile, state); err != nil {
+			logger.Error().Err(err).Msgf("error writing state file %v", opts.StateFile)
+		}
+	}
+	if opts.Remediate != "" {
+		if err := Remediate(ctx, cfgs, checkers, agents, opts); err != nil {
+			logger.Error().Err(err).Msgf("error remediating disconnected agents: %v", err)
+		}
+	}
+	if len(opts.Sinks) > 0 {
+		// Sinks are best-effort and never change the result of the run
+		if err := WriteSinks(ctx, opts, agents, time.Now()); err != nil {
+			logger.Error().Err(err).Msgf("error writing results to --sink: %v", err)
+		}
+	}
+	if opts.PublishCloudWatch {
+		// Publishing is best-effort and never changes the result of the run
+		if err := PublishCloudWatch(ctx, cfgs, opts.Namespace, agents); err != nil {
+			logger.Error().Err(err).Msg("error publishing CloudWatch metrics")
+		}
+	}
+	summary := agentstatus.Summarize(agents, opts.HealthPolicy)
+	window, suppressed := activeSuppressWindow(opts.SuppressWindows, time.Now())
+	Notify(ctx, cfgs, agents, transitions, opts, opts.NotifyAlways)
+	if len(opts.EmailTo) > 0 && !suppressed {
+		if err := NotifyEmail(ctx, agents, opts); err != nil {
+			logger.Error().Err(err).Msg("error sending the email report")
+		}
+	}
+	logger.Info().Interface("summary", summary).Float64("failThreshold", opts.FailThreshold).Int("maxUnhealthy", opts.MaxUnhealthy).
+		Int64("apiCalls", apiStats.Attempts()).Int64("throttles", apiStats.Throttles()).
+		Msgf("summary: %v (fail threshold %.1f%%, max unhealthy %v); %v API calls, %v throttled", summary, opts.FailThreshold, opts.MaxUnhealthy, apiStats.Attempts(), apiStats.Throttles())
+	if apiBudget.Exhausted() {
+		logger.Warn().Int64("maxAPICalls", opts.MaxAPICalls).
+			Msgf("the --max-api-calls budget of %v calls ran out: the clusters it left unchecked are reported as errors", opts.MaxAPICalls)
+	}
+	shortfalls := CapacityShortfalls(agents, checked, opts.ExpectCount)
+	for _, shortfall := range shortfalls {
+		logger.Error().Str("region", shortfall.Region).Str("cluster", shortfall.Cluster).Int("active", shortfall.Active).Int("expected", shortfall.Expected).
+			Msgf("cluster %v has %v ACTIVE container instances, expected at least %v", shortfall.Cluster, shortfall.Active, shortfall.Expected)
+	}
+	for _, cluster := range UncheckedExpectations(checked, opts.ExpectCount) {
+		logger.Warn().Str("cluster", cluster).Msgf("--expect-count names cluster %v, which was not checked", cluster)
+	}
+	if waitFailed || (opts.FailOnBelowCapacity && len(shortfalls) > 0) || (opts.FailOnLaunchTemplateDrift && staleTemplates > 0) ||
+		(opts.FailOnDuplicates && duplicated > 0) || (opts.FailOnDockerDrift && dockerDrifting > 0) || len(violations) > 0 ||
+		Failed(summary, opts, drifting, outdated) {
+		if !suppressed {
+			return ExitUnhealthy
+		}
+		// The window only suppresses the unhealthy result: clusters that could not be checked still exit 4
+		logger.Warn().Str("suppressWindow", window.String()).Msgf("the run failed, but is not reported as unhealthy during the maintenance window %v", window)
+	}
+	if len(opts.scanErrors) > 0 {
+		logger.Error().Int("errors", len(opts.scanErrors)).Msgf("%v regions or clusters could not be checked", len(opts.scanErrors))
+		return ExitPartial
+	}
+	return ExitHealthy
+}
+
+// FormatAge returns an instance age in seconds rounded down to a compact duration: days and hours, hours
+// and minutes, or minutes
+func FormatAge(seconds int64) string {
+	age := time.Duration(seconds) * time.Second
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%vd%vh", int(age/(24*time.Hour)), int(age%(24*time.Hour)/time.Hour))
+	case age >= time.Hour:
+		return fmt.Sprintf("%vh%vm", int(age/time.Hour), int(age%time.Hour/time.Minute))
 	}
+	return fmt.Sprintf("%vm", int(age/time.Minute))
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+	"github.com/rs/zerolog"
+)
+
+func TestShortArn(t *testing.T) {
+	tests := []struct {
+		arn  string
+		want string
+	}{
+		{arn: "arn:aws:ecs:us-east-1:123456789012:container-instance/production/0a1b2c3d4e5f67890a1b2c3d4e5f6789", want: "0a1b2c3d4e5f67890a1b2c3d4e5f6789"},
+		{arn: "arn:aws:ecs:us-east-1:123456789012:container-instance/8f4a3c0e-1b2d-4e5f-9a8b-7c6d5e4f3a2b", want: "8f4a3c0e-1b2d-4e5f-9a8b-7c6d5e4f3a2b"},
+		{arn: "0a1b2c3d4e5f67890a1b2c3d4e5f6789", want: "0a1b2c3d4e5f67890a1b2c3d4e5f6789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			if got := shortArn(tt.arn); got != tt.want {
+				t.Errorf("shortArn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "[]" {
+		t.Errorf("WriteJSON() with no agents = %q, want []", got)
+	}
+
+	buf.Reset()
+	agents := []agentstatus.Agent{{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE"}}
+	if err := WriteJSON(&buf, agents, Options{GroupBy: "cluster"}); err != nil {
+		t.Fatal(err)
+	}
+	var grouped map[string][]agentstatus.Agent
+	if err := json.Unmarshal(buf.Bytes(), &grouped); err != nil {
+		t.Fatalf("WriteJSON() grouped output is not a cluster map: %v", err)
+	}
+	if !reflect.DeepEqual(grouped["web"], agents) {
+		t.Errorf("WriteJSON() grouped = %v, want %v", grouped, agents)
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, agents, Options{Summary: true}); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Agents    []agentstatus.Agent          `json:"agents"`
+		Summaries []agentstatus.ClusterSummary `json:"summaries"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("WriteJSON() with --summary is not a report: %v", err)
+	}
+	if !reflect.DeepEqual(report.Agents, agents) || len(report.Summaries) != 1 || report.Summaries[0].Active != 1 {
+		t.Errorf("WriteJSON() with --summary = %+v", report)
+	}
+
+	buf.Reset()
+	scanErrors := []ScanError{{Region: "us-east-1", Cluster: "batch", Error: "AccessDeniedException"}}
+	if err := WriteJSON(&buf, agents, Options{scanErrors: scanErrors}); err != nil {
+		t.Fatal(err)
+	}
+	var partial map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &partial); err != nil {
+		t.Fatalf("WriteJSON() with scan errors is not an object: %v", err)
+	}
+	var gotErrors []ScanError
+	if err := json.Unmarshal(partial["errors"], &gotErrors); err != nil || !reflect.DeepEqual(gotErrors, scanErrors) {
+		t.Errorf("WriteJSON() errors = %v, %v, want %v", gotErrors, err, scanErrors)
+	}
+	if _, ok := partial["summaries"]; ok {
+		t.Error("WriteJSON() without --summary wrote summaries")
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, agents, Options{Report: true, GroupBy: "cluster", scanErrors: scanErrors}); err != nil {
+		t.Fatal(err)
+	}
+	var versioned reportOutput
+	if err := json.Unmarshal(buf.Bytes(), &versioned); err != nil {
+		t.Fatalf("WriteJSON() with --report is not a report: %v", err)
+	}
+	if versioned.SchemaVersion != agentstatus.ReportSchemaVersion || !reflect.DeepEqual(versioned.Agents, agents) || len(versioned.Clusters) != 1 || len(versioned.Groups["web"]) != 1 {
+		t.Errorf("WriteJSON() with --report = %+v", versioned)
+	}
+	if !strings.Contains(buf.String(), `"error": "AccessDeniedException"`) {
+		t.Errorf("WriteJSON() with --report left out the error message:\n%s", buf.String())
+	}
+}
+
+func TestOutputAgentsOnlyUnhealthy(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING", AgentConnected: true},
+		{EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE", AgentConnected: false},
+	}
+	if got := (Options{}).outputAgents(agents); len(got) != 3 {
+		t.Errorf("outputAgents() = %v, want every agent", got)
+	}
+	got := Options{OnlyUnhealthy: true, HealthPolicy: agentstatus.DefaultHealthPolicy}.outputAgents(agents)
+	if len(got) != 2 || got[0].EC2InstanceID != "i-bbbb" || got[1].EC2InstanceID != "i-cccc" {
+		t.Errorf("outputAgents() with --only-unhealthy = %v, want i-bbbb and i-cccc", got)
+	}
+}
+
+func TestWriteJSONTaskCounts(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, []agentstatus.Agent{{Cluster: "web", RunningTasks: 3, PendingTasks: 1}}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var agents []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &agents); err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0]["runningTasks"] != 3.0 || agents[0]["pendingTasks"] != 1.0 {
+		t.Errorf("WriteJSON() = %v, want runningTasks 3 and pendingTasks 1", agents)
+	}
+}
+
+func TestWriteTextTasks(t *testing.T) {
+	agents := []agentstatus.Agent{{
+		Region:               "us-east-1",
+		Cluster:              "production",
+		ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/production/aaaa",
+		AgentStatus:          "DRAINING",
+		Tasks: []agentstatus.Task{
+			{TaskARN: "arn:aws:ecs:us-east-1:123456789012:task/production/1111", Family: "web", LastStatus: "RUNNING", HealthStatus: "HEALTHY"},
+		},
+	}}
+	var buf bytes.Buffer
+	WriteText(&buf, agents, Options{FormatArn: "short"})
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := "    Task: 1111, Family: web, LastStatus: RUNNING, HealthStatus: HEALTHY"
+	if len(lines) != 2 || lines[1] != want {
+		t.Errorf("WriteText() =\n%v\nwant the agent line followed by\n%v", buf.String(), want)
+	}
+}
+
+func TestWriteTextGroupByCapacityProvider(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Cluster: "web", EC2InstanceID: "i-aaaa", CapacityProvider: "web-cp", AutoScalingGroup: "web-asg"},
+		{Cluster: "web", EC2InstanceID: "i-bbbb"},
+		{Cluster: "batch", EC2InstanceID: "i-cccc", CapacityProvider: "web-cp"},
+	}
+	var buf bytes.Buffer
+	WriteText(&buf, agents, Options{GroupBy: "capacity-provider"})
+	var headers []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "CapacityProvider: ") {
+			headers = append(headers, line)
+		}
+	}
+	want := []string{"CapacityProvider: web-cp (2 agents)", "CapacityProvider: none (1 agents)"}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("WriteText() grouped by capacity provider headers = %q, want %q\n%v", headers, want, buf.String())
+	}
+	if !strings.Contains(buf.String(), "ASG: web-asg, CapacityProvider: web-cp") {
+		t.Errorf("WriteText() does not show the ASG and capacity provider:\n%v", buf.String())
+	}
+}
+
+func TestFormatAgentAttributes(t *testing.T) {
+	agent := agentstatus.Agent{Cluster: "web", EC2InstanceID: "i-aaaa", Attributes: map[string]string{"stack": "blue", "ecs.ami-id": "ami-0123"}}
+	line := FormatAgent(agent, Options{ShowAttributes: []string{"stack", "cohort", "ecs.ami-id"}})
+	if !strings.HasSuffix(line, ", Attributes: stack=blue ecs.ami-id=ami-0123") {
+		t.Errorf("FormatAgent() with --show-attributes = %q", line)
+	}
+}
+
+func TestLogAgents(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING"},
+	}
+	var buf bytes.Buffer
+	LogAgents(zerolog.New(&buf), agents, agentstatus.DefaultHealthPolicy)
+	var events []map[string]any
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var event map[string]any
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 {
+		t.Fatalf("LogAgents() logged %v events, want 2", len(events))
+	}
+	if events[0]["level"] != "info" || events[0]["instanceId"] != "i-aaaa" || events[0]["healthy"] != true {
+		t.Errorf("LogAgents() healthy agent event = %v", events[0])
+	}
+	if events[1]["level"] != "warn" || events[1]["agentStatus"] != "DRAINING" || events[1]["cluster"] != "web" || events[1]["healthy"] != false {
+		t.Errorf("LogAgents() unhealthy agent event = %v", events[1])
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	for seconds, want := range map[int64]string{0: "0m", 59: "0m", 754: "12m", 11520: "3h12m", 183600: "2d3h"} {
+		if got := FormatAge(seconds); got != want {
+			t.Errorf("FormatAge(%v) = %q, want %q", seconds, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Nagios plugin states, which are also the exit codes of --output nagios
+const (
+	NagiosOK       = 0
+	NagiosWarning  = 1
+	NagiosCritical = 2
+	NagiosUnknown  = 3
+)
+
+// nagiosStateNames are the names of the Nagios plugin states, indexed by state
+var nagiosStateNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosPrefix starts the first line of the Nagios plugin output
+const nagiosPrefix = "ECS AGENTS"
+
+// Failed reports whether the run fails: more unhealthy agents than both --max-unhealthy and
+// --fail-threshold tolerate, version drift with --fail-on-version-drift or, without --fail-on, agents
+// older than --min-agent-version
+func Failed(summary agentstatus.Summary, opts Options, drifting, outdated int) bool {
+	return (summary.Unhealthy > opts.MaxUnhealthy && summary.UnhealthyPercent > opts.FailThreshold) ||
+		(opts.FailOnVersionDrift && drifting > 0) || (opts.FailOnOutdated && outdated > 0)
+}
+
+// NagiosState returns CRITICAL when the run fails, WARNING when there are unhealthy or drifting agents that
+// do not fail it, and OK otherwise
+func NagiosState(summary agentstatus.Summary, opts Options, drifting, outdated int) int {
+	switch {
+	case Failed(summary, opts, drifting, outdated):
+		return NagiosCritical
+	case summary.Unhealthy > 0 || drifting > 0:
+		return NagiosWarning
+	}
+	return NagiosOK
+}
+
+// countMarked returns the number of agents with agent version drift and the number that are outdated.
+// Docker version drift is left out: it only fails the run with --fail-on-docker-drift
+func countMarked(agents []agentstatus.Agent) (int, int) {
+	drifting, outdated := 0, 0
+	for _, agent := range agents {
+		if agent.VersionDrift {
+			drifting++
+		}
+		if agent.Outdated {
+			outdated++
+		}
+	}
+	return drifting, outdated
+}
+
+// WriteNagios writes the agents as Nagios plugin output: a status line with performance data counting the
+// active, draining and disconnected agents, followed by a line per unhealthy agent. It returns the state
+func WriteNagios(w io.Writer, agents []agentstatus.Agent, opts Options) (int, error) {
+	summary := agentstatus.Summarize(agents, opts.HealthPolicy)
+	drifting, outdated := countMarked(agents)
+	state := NagiosState(summary, opts, drifting, outdated)
+
+	message := fmt.Sprintf("%v agents healthy in %v clusters", summary.Agents, summary.Clusters)
+	if summary.Unhealthy > 0 {
+		message = fmt.Sprintf("%v of %v agents unhealthy (%.1f%%) in %v clusters", summary.Unhealthy, summary.Agents, summary.UnhealthyPercent, summary.Clusters)
+	}
+	if drifting > 0 {
+		message += fmt.Sprintf(", %v with version drift", drifting)
+	}
+	if outdated > 0 {
+		message += fmt.Sprintf(", %v outdated", outdated)
+	}
+	_, err := fmt.Fprintf(w, "%v %v - %v | active=%v draining=%v disconnected=%v unhealthy=%v total=%v\n",
+		nagiosPrefix, nagiosStateNames[state], message, summary.ByStatus["ACTIVE"], summary.ByStatus["DRAINING"],
+		summary.Disconnected, summary.Unhealthy, summary.Agents)
+	if err != nil {
+		return state, err
+	}
+	for _, agent := range opts.HealthPolicy.UnhealthyAgents(agents) {
+		if _, err := fmt.Fprintln(w, FormatAgent(agent, opts)); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// WriteNagiosUnknown writes the Nagios plugin output of a run that could not check the agents
+func WriteNagiosUnknown(w io.Writer, reason string) {
+	fmt.Fprintf(w, "%v %v - %v\n", nagiosPrefix, nagiosStateNames[NagiosUnknown], reason)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteNagios(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Cluster: "web", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Cluster: "web", EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Cluster: "api", EC2InstanceID: "i-dddd", AgentStatus: "DRAINING", AgentConnected: false},
+	}
+	tests := []struct {
+		name      string
+		agents    []agentstatus.Agent
+		threshold float64
+		wantState int
+		wantLine  string
+	}{
+		{
+			name:      "healthy",
+			agents:    agents[:3],
+			wantState: NagiosOK,
+			wantLine:  "ECS AGENTS OK - 3 agents healthy in 1 clusters | active=3 draining=0 disconnected=0 unhealthy=0 total=3",
+		},
+		{
+			name:      "unhealthy",
+			agents:    agents,
+			wantState: NagiosCritical,
+			wantLine:  "ECS AGENTS CRITICAL - 1 of 4 agents unhealthy (25.0%) in 2 clusters | active=3 draining=1 disconnected=1 unhealthy=1 total=4",
+		},
+		{
+			name:      "agent version drift",
+			agents:    []agentstatus.Agent{{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, VersionDrift: true}},
+			wantState: NagiosWarning,
+			wantLine:  "ECS AGENTS WARNING - 1 agents healthy in 1 clusters, 1 with version drift | active=1 draining=0 disconnected=0 unhealthy=0 total=1",
+		},
+		{
+			name:      "Docker version drift",
+			agents:    []agentstatus.Agent{{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, DockerVersionDrift: true}},
+			wantState: NagiosOK,
+			wantLine:  "ECS AGENTS OK - 1 agents healthy in 1 clusters | active=1 draining=0 disconnected=0 unhealthy=0 total=1",
+		},
+		{
+			name:      "unhealthy within the fail threshold",
+			agents:    agents,
+			threshold: 50,
+			wantState: NagiosWarning,
+			wantLine:  "ECS AGENTS WARNING - 1 of 4 agents unhealthy (25.0%) in 2 clusters | active=3 draining=1 disconnected=1 unhealthy=1 total=4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := Options{HealthPolicy: agentstatus.DefaultHealthPolicy, FailThreshold: tt.threshold, FormatArn: "short"}
+			state, err := WriteNagios(&buf, tt.agents, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if state != tt.wantState || lines[0] != tt.wantLine {
+				t.Errorf("WriteNagios() = %v, %q, want %v, %q", state, lines[0], tt.wantState, tt.wantLine)
+			}
+			if strings.Contains(tt.wantLine, "unhealthy=1") && (len(lines) != 2 || !strings.Contains(lines[1], "i-dddd")) {
+				t.Errorf("WriteNagios() unhealthy agent lines = %q, want one for i-dddd", lines[1:])
+			}
+		})
+	}
+}
+
+func TestFailed(t *testing.T) {
+	tests := []struct {
+		name      string
+		unhealthy int
+		percent   float64
+		opts      Options
+		want      bool
+	}{
+		{"any unhealthy agent fails by default", 1, 1, Options{}, true},
+		{"healthy", 0, 0, Options{}, false},
+		{"within --max-unhealthy", 1, 20, Options{MaxUnhealthy: 1}, false},
+		{"above --max-unhealthy", 2, 2, Options{MaxUnhealthy: 1}, true},
+		{"within --fail-threshold", 2, 2, Options{FailThreshold: 10}, false},
+		{"above both", 11, 11, Options{MaxUnhealthy: 1, FailThreshold: 10}, true},
+		{"above the count only", 2, 2, Options{MaxUnhealthy: 1, FailThreshold: 10}, false},
+	}
+	for _, tt := range tests {
+		summary := agentstatus.Summary{Unhealthy: tt.unhealthy, UnhealthyPercent: tt.percent}
+		if got := Failed(summary, tt.opts, 0, 0); got != tt.want {
+			t.Errorf("%v: Failed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Types of the notifiers section of the config file
+const (
+	NotifierWebhook   = "webhook"
+	NotifierSlack     = "slack"
+	NotifierSNS       = "sns"
+	NotifierPagerDuty = "pagerduty"
+)
+
+// NotificationReport is the result of a run or watch poll sent to every Notifier: the versioned report of
+// --report with the agents that are unhealthy under --fail-on and the --state-file transitions of the run
+type NotificationReport struct {
+	agentstatus.Report
+	Unhealthy   []agentstatus.Agent `json:"unhealthy"`
+	Transitions []Transition        `json:"transitions,omitempty"`
+}
+
+// NewNotificationReport returns the notification of the agents of a run made at now
+func NewNotificationReport(agents []agentstatus.Agent, transitions []Transition, opts Options, now time.Time) NotificationReport {
+	unhealthy := opts.HealthPolicy.UnhealthyAgents(agents)
+	if unhealthy == nil {
+		unhealthy = []agentstatus.Agent{}
+	}
+	return NotificationReport{Report: newReportOutput(agents, opts, now).Report, Unhealthy: unhealthy, Transitions: transitions}
+}
+
+// Notifier sends the result of a run or watch poll to a notification target
+type Notifier interface {
+	Notify(ctx context.Context, report NotificationReport) error
+}
+
+// healthyNotifier is implemented by notifiers that are also sent the runs without unhealthy agents, e.g. to
+// resolve the alerts of earlier runs. Other notifiers are only sent those with --notify-always
+type healthyNotifier interface {
+	NotifyHealthy() bool
+}
+
+// WebhookNotifier POSTs JSON to URL with Headers: the whole NotificationReport, or with Summary the
+// WebhookPayload summary of the unhealthy agents that --webhook-url sends
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Summary bool
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, report NotificationReport) error {
+	var payload any = report
+	if n.Summary {
+		payload = NewWebhookPayload(report.Unhealthy)
+	}
+	return postJSON(ctx, n.URL, n.Headers, payload)
+}
+
+// SlackNotifier posts a message listing the unhealthy agents to a Slack incoming webhook
+type SlackNotifier struct {
+	URL string
+}
+
+func (n SlackNotifier) Notify(ctx context.Context, report NotificationReport) error {
+	return PostWebhook(ctx, n.URL, NewSlackMessage(report.Agents, report.Unhealthy))
+}
+
+// SNSNotifier publishes the WebhookPayload summary of the unhealthy agents to an SNS topic, using the AWS
+// config of the topic's region from cfgs, or loaded with opts when that region was not scanned
+type SNSNotifier struct {
+	TopicARN string
+	cfgs     map[string]aws.Config
+	opts     Options
+}
+
+func (n SNSNotifier) Notify(ctx context.Context, report NotificationReport) error {
+	opts := n.opts
+	opts.SNSTopicArn = n.TopicARN
+	return NotifySNS(ctx, n.cfgs, opts, report.Unhealthy)
+}
+
+// PagerDutyNotifier triggers a PagerDuty alert per disconnected agent and resolves those of the agents that
+// recovered. It is sent every run, so that the alerts are resolved
+type PagerDutyNotifier struct {
+	RoutingKey string
+}
+
+func (n PagerDutyNotifier) Notify(ctx context.Context, report NotificationReport) error {
+	return NotifyPagerDuty(ctx, PagerDutyEvents(n.RoutingKey, report.Agents, report.Transitions))
+}
+
+func (PagerDutyNotifier) NotifyHealthy() bool {
+	return true
+}
+
+// NotifierConfig is an entry of the notifiers section of the config file: a notification target of type
+// webhook, slack, sns or pagerduty and its settings
+type NotifierConfig struct {
+	Type string `yaml:"type"`
+	// Name identifies the notifier in logs (default: its type)
+	Name string `yaml:"name"`
+	// URL is the endpoint of webhook and slack notifiers
+	URL string `yaml:"url"`
+	// Headers are sent with the requests of webhook notifiers, e.g. Authorization. $VAR and ${VAR} in
+	// their values are replaced with environment variables, so secrets can stay out of the file
+	Headers map[string]string `yaml:"headers"`
+	// TopicARN is the topic of sns notifiers
+	TopicARN string `yaml:"topic-arn"`
+	// RoutingKey is the Events API v2 integration key of pagerduty notifiers
+	RoutingKey string `yaml:"routing-key"`
+}
+
+// Validate checks that the notifier has a known type and the settings that type needs
+func (c NotifierConfig) Validate() error {
+	switch c.Type {
+	case NotifierWebhook, NotifierSlack:
+		if c.URL == "" {
+			return fmt.Errorf("%v notifier %v has no url", c.Type, c.name())
+		}
+	case NotifierSNS:
+		if _, err := arn.Parse(c.TopicARN); err != nil {
+			return fmt.Errorf("sns notifier %v has no valid topic-arn: %w", c.name(), err)
+		}
+	case NotifierPagerDuty:
+		if c.RoutingKey == "" {
+			return fmt.Errorf("pagerduty notifier %v has no routing-key", c.name())
+		}
+	case "":
+		return errors.New("notifier without a type: must be webhook, slack, sns or pagerduty")
+	default:
+		return fmt.Errorf("notifier %v has unknown type %q: must be webhook, slack, sns or pagerduty", c.name(), c.Type)
+	}
+	if len(c.Headers) > 0 && c.Type != NotifierWebhook {
+		return fmt.Errorf("%v notifier %v cannot have headers, only webhook notifiers can", c.Type, c.name())
+	}
+	return nil
+}
+
+// name returns the name of the notifier in logs
+func (c NotifierConfig) name() string {
+	return valueOr(c.Name, c.Type)
+}
+
+// NewNotifier returns the notifier of the config, with the scanned AWS configs for sns notifiers
+func (c NotifierConfig) NewNotifier(cfgs map[string]aws.Config, opts Options) Notifier {
+	switch c.Type {
+	case NotifierSlack:
+		return SlackNotifier{URL: c.URL}
+	case NotifierSNS:
+		return SNSNotifier{TopicARN: c.TopicARN, cfgs: cfgs, opts: opts}
+	case NotifierPagerDuty:
+		return PagerDutyNotifier{RoutingKey: c.RoutingKey}
+	}
+	headers := make(map[string]string, len(c.Headers))
+	for key, value := range c.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+	return WebhookNotifier{URL: c.URL, Headers: headers}
+}
+
+// NamedNotifier is a Notifier with the name it is logged with
+type NamedNotifier struct {
+	Name string
+	Notifier
+}
+
+// Notifiers returns the notifiers of a run: those of --webhook-url, --slack-webhook-url, --sns-topic-arn
+// and --pagerduty-routing-key, followed by those of the notifiers section of the config file
+func Notifiers(cfgs map[string]aws.Config, opts Options) []NamedNotifier {
+	var notifiers []NamedNotifier
+	if opts.WebhookURL != "" {
+		notifiers = append(notifiers, NamedNotifier{Name: "webhook-url", Notifier: WebhookNotifier{URL: opts.WebhookURL, Summary: true}})
+	}
+	if opts.SlackWebhookURL != "" {
+		notifiers = append(notifiers, NamedNotifier{Name: "slack-webhook-url", Notifier: SlackNotifier{URL: opts.SlackWebhookURL}})
+	}
+	if opts.SNSTopicArn != "" {
+		notifiers = append(notifiers, NamedNotifier{Name: "sns-topic-arn", Notifier: SNSNotifier{TopicARN: opts.SNSTopicArn, cfgs: cfgs, opts: opts}})
+	}
+	if opts.PagerDutyRoutingKey != "" {
+		notifiers = append(notifiers, NamedNotifier{Name: "pagerduty-routing-key", Notifier: PagerDutyNotifier{RoutingKey: opts.PagerDutyRoutingKey}})
+	}
+	for _, config := range opts.Notifiers {
+		notifiers = append(notifiers, NamedNotifier{Name: config.name(), Notifier: config.NewNotifier(cfgs, opts)})
+	}
+	return notifiers
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestNotifierConfigValidate(t *testing.T) {
+	tests := []struct {
+		config  NotifierConfig
+		wantErr bool
+	}{
+		{config: NotifierConfig{Type: NotifierWebhook, URL: "https://incidents.example.com/ecs", Headers: map[string]string{"Authorization": "Bearer x"}}},
+		{config: NotifierConfig{Type: NotifierSlack, URL: "https://hooks.slack.com/services/x"}},
+		{config: NotifierConfig{Type: NotifierSNS, TopicARN: "arn:aws:sns:us-east-1:123456789012:ecs-alerts"}},
+		{config: NotifierConfig{Type: NotifierPagerDuty, RoutingKey: "key"}},
+		{config: NotifierConfig{Type: NotifierWebhook}, wantErr: true},
+		{config: NotifierConfig{Type: NotifierSNS, TopicARN: "ecs-alerts"}, wantErr: true},
+		{config: NotifierConfig{Type: NotifierSlack, URL: "https://hooks.slack.com/services/x", Headers: map[string]string{"X": "y"}}, wantErr: true},
+		{config: NotifierConfig{Type: "teams", URL: "https://example.com"}, wantErr: true},
+		{config: NotifierConfig{URL: "https://example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadConfigFileNotifiers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "output: json\nnotifiers:\n  - type: webhook\n    name: incidents\n    url: https://incidents.example.com/ecs\n    headers:\n      Authorization: Bearer ${INCIDENT_TOKEN}\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfigFile(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Notifiers) != 1 || config.Notifiers[0].Name != "incidents" || config.Notifiers[0].Headers["Authorization"] != "Bearer ${INCIDENT_TOKEN}" {
+		t.Errorf("LoadConfigFile() notifiers = %+v", config.Notifiers)
+	}
+	if _, ok := config.Values["notifiers"]; ok {
+		t.Error("LoadConfigFile() kept notifiers as a flag value")
+	}
+	if err := os.WriteFile(path, []byte("notifiers:\n  - type: webhook\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFile(path, true); err == nil {
+		t.Error("LoadConfigFile() with a webhook notifier without a url returned no error")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string][]*http.Request)
+	bodies := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var body json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		requests[r.URL.Path] = append(requests[r.URL.Path], r)
+		bodies[r.URL.Path] = body
+	}))
+	defer server.Close()
+	defer func(url string) { pagerDutyEventsURL = url }(pagerDutyEventsURL)
+	pagerDutyEventsURL = server.URL + "/pagerduty"
+	t.Setenv("INCIDENT_TOKEN", "secret")
+
+	opts := Options{
+		HealthPolicy:        agentstatus.DefaultHealthPolicy,
+		WebhookURL:          server.URL + "/summary",
+		PagerDutyRoutingKey: "key",
+		Notifiers: []NotifierConfig{{Type: NotifierWebhook, URL: server.URL + "/incidents",
+			Headers: map[string]string{"Authorization": "Bearer ${INCIDENT_TOKEN}"}}},
+	}
+	healthy := []agentstatus.Agent{{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true}}
+	transitions := []Transition{{Type: TransitionRecovered, ContainerInstanceARN: "arn:web/aaaa"}}
+	Notify(context.Background(), nil, healthy, transitions, opts, false)
+	if len(requests["/incidents"]) != 0 || len(requests["/summary"]) != 0 || len(requests["/pagerduty"]) != 1 {
+		t.Fatalf("Notify() of a healthy run sent %v", requests)
+	}
+
+	unhealthy := append(healthy, agentstatus.Agent{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING", AgentConnected: true})
+	Notify(context.Background(), nil, unhealthy, nil, opts, false)
+	if len(requests["/incidents"]) != 1 || len(requests["/summary"]) != 1 {
+		t.Fatalf("Notify() of an unhealthy run sent %v", requests)
+	}
+	if got := requests["/incidents"][0].Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("webhook Authorization = %q, want the expanded environment variable", got)
+	}
+	var report NotificationReport
+	if err := json.Unmarshal(bodies["/incidents"], &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.SchemaVersion != agentstatus.ReportSchemaVersion || len(report.Agents) != 2 || len(report.Unhealthy) != 1 || report.Summary.Unhealthy != 1 {
+		t.Errorf("webhook report = %+v", report)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(bodies["/summary"], &payload); err != nil || len(payload.Unhealthy) != 1 {
+		t.Errorf("--webhook-url payload = %s, %v", bodies["/summary"], err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// webhookTimeout bounds the webhook POST so a slow endpoint cannot hang the run
+const webhookTimeout = 10 * time.Second
+
+// WebhookPayload is the JSON document posted to --webhook-url. Text makes it render as a message in a
+// Slack incoming webhook; the remaining fields are for generic consumers
+type WebhookPayload struct {
+	Text      string              `json:"text"`
+	Clusters  []string            `json:"clusters"`
+	Unhealthy []agentstatus.Agent `json:"unhealthy"`
+}
+
+// NewWebhookPayload summarizes the unhealthy agents and the clusters they belong to
+func NewWebhookPayload(unhealthy []agentstatus.Agent) WebhookPayload {
+	seen := make(map[string]bool)
+	var clusters []string
+	var lines []string
+	for _, agent := range unhealthy {
+		if !seen[agent.Cluster] {
+			seen[agent.Cluster] = true
+			clusters = append(clusters, agent.Cluster)
+		}
+		lines = append(lines, fmt.Sprintf("%v %v %v connected=%v", agent.Cluster, agent.EC2InstanceID, agent.AgentStatus, agent.AgentConnected))
+	}
+	sort.Strings(clusters)
+	return WebhookPayload{
+		Text:      fmt.Sprintf("ecs-agent-status: %d unhealthy agents in %d clusters\n%s", len(unhealthy), len(clusters), strings.Join(lines, "\n")),
+		Clusters:  clusters,
+		Unhealthy: unhealthy,
+	}
+}
+
+// Notify sends the notifications of a run or watch poll to every notifier of Notifiers. Only PagerDuty
+// notifiers are sent runs without unhealthy agents, unless always is set, and none are sent during a
+// --suppress-window. Notifications are best-effort: failures are logged and never change the result of the
+// run
+func Notify(ctx context.Context, cfgs map[string]aws.Config, agents []agentstatus.Agent, transitions []Transition, opts Options, always bool) {
+	if window, ok := activeSuppressWindow(opts.SuppressWindows, time.Now()); ok {
+		logger.Info().Str("suppressWindow", window.String()).Msgf("not sending notifications during the maintenance window %v", window)
+		return
+	}
+	notifiers := Notifiers(cfgs, opts)
+	if len(notifiers) == 0 {
+		return
+	}
+	report := NewNotificationReport(agents, transitions, opts, time.Now())
+	for _, notifier := range notifiers {
+		if healthy, ok := notifier.Notifier.(healthyNotifier); len(report.Unhealthy) == 0 && !always && !(ok && healthy.NotifyHealthy()) {
+			continue
+		}
+		if err := notifier.Notify(ctx, report); err != nil {
+			logger.Error().Err(err).Str("notifier", notifier.Name).Msgf("error sending notification %v: %v", notifier.Name, err)
+		}
+	}
+}
+
+// PostWebhook sends the payload to url as JSON
+func PostWebhook(ctx context.Context, url string, payload any) error {
+	return postJSON(ctx, url, nil, payload)
+}
+
+// postJSON sends the payload to url as JSON with the headers
+func postJSON(ctx context.Context, url string, headers map[string]string, payload any) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
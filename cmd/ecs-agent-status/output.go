@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is written to a temporary file next to its destination and renamed into place on Commit,
+// so readers never see a partially written report
+type AtomicFile struct {
+	*os.File
+	path string
+}
+
+// CreateAtomicFile creates the parent directories of path and a temporary file in the same directory
+func CreateAtomicFile(path string) (*AtomicFile, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: f, path: path}, nil
+}
+
+// Commit flushes and closes the temporary file and renames it to the destination path
+func (f *AtomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+// Abort closes and removes the temporary file, leaving any existing destination untouched
+func (f *AtomicFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
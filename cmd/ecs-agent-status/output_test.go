@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "run.txt")
+	f, err := CreateAtomicFile(path)
+	if err != nil {
+		t.Fatalf("CreateAtomicFile() error = %v", err)
+	}
+	if _, err := f.WriteString("report\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("destination exists before Commit(): %v", err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "report\n" {
+		t.Errorf("destination = %q, %v, want report", data, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries after Commit(), want 1", len(entries))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint. Tests point it at a local server
+var pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyEvent is a PagerDuty Events API v2 event
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+// PagerDutyPayload describes the alert of a trigger event
+type PagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Component     string `json:"component"`
+	Group         string `json:"group"`
+	CustomDetails any    `json:"custom_details,omitempty"`
+}
+
+// pagerDutyDedupKey returns the dedup key of the alert of a container instance, so that every run
+// triggering it updates the same alert and a later run can resolve it
+func pagerDutyDedupKey(containerInstanceARN string) string {
+	return "ecs-agent-status/" + containerInstanceARN
+}
+
+// PagerDutyEvents returns a trigger event for each agent that is not connected and, from the state file
+// transitions, a resolve event for each instance that recovered or deregistered while disconnected
+func PagerDutyEvents(routingKey string, agents []agentstatus.Agent, transitions []Transition) []PagerDutyEvent {
+	var events []PagerDutyEvent
+	for _, agent := range agents {
+		if agent.AgentConnected {
+			continue
+		}
+		events = append(events, PagerDutyEvent{
+			RoutingKey:  routingKey,
+			EventAction: "trigger",
+			DedupKey:    pagerDutyDedupKey(agent.ContainerInstanceARN),
+			Payload: &PagerDutyPayload{
+				Summary:       fmt.Sprintf("ECS agent on %v in cluster %v is disconnected (%v)", agent.InstanceID(), agent.Cluster, agent.AgentStatus),
+				Source:        agent.InstanceID(),
+				Severity:      "error",
+				Component:     agent.Cluster,
+				Group:         agent.Region,
+				CustomDetails: agent,
+			},
+		})
+	}
+	for _, transition := range transitions {
+		recovered := transition.Type == TransitionRecovered
+		deregistered := transition.Type == TransitionDeregistered && !transition.AgentConnected
+		if recovered || deregistered {
+			events = append(events, PagerDutyEvent{
+				RoutingKey:  routingKey,
+				EventAction: "resolve",
+				DedupKey:    pagerDutyDedupKey(transition.ContainerInstanceARN),
+			})
+		}
+	}
+	return events
+}
+
+// NotifyPagerDuty sends the events to the PagerDuty Events API, returning the errors of the events that
+// could not be sent
+func NotifyPagerDuty(ctx context.Context, events []PagerDutyEvent) error {
+	var errs []error
+	for _, event := range events {
+		if err := PostWebhook(ctx, pagerDutyEventsURL, event); err != nil {
+			errs = append(errs, fmt.Errorf("%v %v: %w", event.EventAction, event.DedupKey, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestPagerDutyEvents(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE"},
+	}
+	transitions := []Transition{
+		{Type: TransitionRecovered, ContainerInstanceARN: "arn/web/aaaa", AgentState: AgentState{AgentConnected: true}},
+		{Type: TransitionDeregistered, ContainerInstanceARN: "arn/web/cccc"},
+		{Type: TransitionDeregistered, ContainerInstanceARN: "arn/web/dddd", AgentState: AgentState{AgentConnected: true}},
+		{Type: TransitionRegistered, ContainerInstanceARN: "arn/web/eeee", AgentState: AgentState{AgentConnected: true}},
+	}
+	events := PagerDutyEvents("key", agents, transitions)
+	var got []string
+	for _, event := range events {
+		got = append(got, event.EventAction+" "+event.DedupKey)
+	}
+	want := []string{"trigger ecs-agent-status/arn/web/bbbb", "resolve ecs-agent-status/arn/web/aaaa", "resolve ecs-agent-status/arn/web/cccc"}
+	if len(got) != len(want) {
+		t.Fatalf("PagerDutyEvents() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("PagerDutyEvents()[%v] = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if events[0].Payload == nil || events[0].Payload.Source != "i-bbbb" || events[0].Payload.Component != "web" || events[1].Payload != nil {
+		t.Errorf("PagerDutyEvents() payloads = %+v, %+v", events[0].Payload, events[1].Payload)
+	}
+}
+
+func TestNotifyPagerDuty(t *testing.T) {
+	var received []PagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event PagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decoding event: %v", err)
+		}
+		received = append(received, event)
+		if event.DedupKey == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer func(url string) { pagerDutyEventsURL = url }(pagerDutyEventsURL)
+	pagerDutyEventsURL = server.URL
+
+	events := []PagerDutyEvent{{RoutingKey: "key", EventAction: "resolve", DedupKey: "good"}, {RoutingKey: "key", EventAction: "resolve", DedupKey: "bad"}}
+	if err := NotifyPagerDuty(context.Background(), events); err == nil {
+		t.Error("NotifyPagerDuty() with a rejected event returned no error")
+	}
+	if len(received) != 2 || received[0].RoutingKey != "key" {
+		t.Errorf("NotifyPagerDuty() sent %+v", received)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Plan is what a check would do, printed by --dry-run: the clusters it would scan and the AWS API
+// operations it would call
+type Plan struct {
+	Clusters []ClusterRef `json:"clusters"`
+	// ClusterOperations are called for each cluster, AfterScanOperations once the agents are gathered
+	ClusterOperations   []string `json:"clusterOperations"`
+	AfterScanOperations []string `json:"afterScanOperations"`
+}
+
+// NewPlan lists the clusters matching the patterns in every region, like Scan, and returns the plan of a
+// check of them. Only the calls listing the clusters are made. ErrNoClustersMatched is returned when nothing
+// matches, and an error when more than --max-clusters do
+func NewPlan(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) (Plan, error) {
+	clustersByRegion, listErrs := listClusters(ctx, checkers, opts)
+	if ctx.Err() != nil {
+		return Plan{}, ctx.Err()
+	}
+	var matched []string
+	plan := Plan{ClusterOperations: ClusterOperations(opts), AfterScanOperations: AfterScanOperations(opts)}
+	for _, region := range SortedRegions(checkers) {
+		if err, ok := listErrs[region]; ok {
+			if len(checkers) == 1 {
+				return Plan{}, err
+			}
+			logger.Warn().Err(err).Str("region", region).Msgf("error getting clusters in region %v: %v", region, err)
+		}
+		clusters := append([]string(nil), clustersByRegion[region]...)
+		sort.Strings(clusters)
+		for _, cluster := range clusters {
+			plan.Clusters = append(plan.Clusters, ClusterRef{AccountID: scopeAccount(region), Region: checkers[region].Region, Cluster: cluster})
+		}
+		matched = append(matched, clusters...)
+	}
+	if len(matched) == 0 {
+		return Plan{}, agentstatus.ErrNoClustersMatched
+	}
+	if err := agentstatus.CheckMaxClusters(matched, opts.MaxClusters); err != nil {
+		return Plan{}, err
+	}
+	return plan, nil
+}
+
+// ClusterOperations returns the AWS API operations a check calls for each cluster with these options
+func ClusterOperations(opts Options) []string {
+	operations := []string{"ecs:ListContainerInstances", "ecs:DescribeContainerInstances"}
+	if opts.EC2Details {
+		operations = append(operations, "ec2:DescribeInstances", "ec2:DescribeInstanceStatus", "autoscaling:DescribeAutoScalingInstances")
+	}
+	// Only called for instances launched by a capacity provider whose Auto Scaling group is not known
+	operations = append(operations, "ecs:DescribeCapacityProviders")
+	if opts.ShowTasks {
+		operations = append(operations, "ecs:ListTasks", "ecs:DescribeTasks")
+	}
+	return operations
+}
+
+// AfterScanOperations returns the AWS API operations a check calls once the agents are gathered with these
+// options, to act on them or deliver the results. Webhook, Slack and PagerDuty notifications are not AWS
+// calls and are left out
+func AfterScanOperations(opts Options) []string {
+	operations := []string{}
+	if opts.CheckSSM {
+		operations = append(operations, "ssm:DescribeInstanceInformation")
+	}
+	if opts.DetectLaunchTemplateDrift {
+		operations = append(operations, "autoscaling:DescribeAutoScalingGroups", "ec2:DescribeLaunchTemplates")
+	}
+	if opts.RestartAgent {
+		operations = append(operations, "ssm:SendCommand", "ssm:GetCommandInvocation")
+	}
+	if opts.FetchAgentLogs {
+		operations = append(operations, "logs:GetLogEvents")
+	}
+	switch opts.Remediate {
+	case "drain":
+		operations = append(operations, "ecs:UpdateContainerInstancesState")
+	case "terminate":
+		operations = append(operations, "ecs:UpdateContainerInstancesState", "ec2:TerminateInstances")
+	case "asg-replace":
+		operations = append(operations, "ecs:UpdateContainerInstancesState", "autoscaling:SetInstanceHealth")
+	}
+	if (opts.AuditLog != "" || opts.AuditLogGroup != "") && (opts.Remediate != "" || opts.RestartAgent) {
+		operations = append(operations, "sts:GetCallerIdentity")
+		if opts.AuditLogGroup != "" {
+			operations = append(operations, "logs:CreateLogStream", "logs:PutLogEvents")
+		}
+	}
+	if opts.SNSTopicArn != "" || slices.ContainsFunc(opts.Notifiers, func(n NotifierConfig) bool { return n.Type == NotifierSNS }) {
+		operations = append(operations, "sns:Publish")
+	}
+	if len(opts.EmailTo) > 0 {
+		operations = append(operations, "ses:SendEmail")
+	}
+	for _, sink := range opts.Sinks {
+		operation := "dynamodb:PutItem"
+		if strings.HasPrefix(sink, "s3://") {
+			operation = "s3:PutObject"
+		}
+		if !slices.Contains(operations, operation) {
+			operations = append(operations, operation)
+		}
+	}
+	if opts.PublishCloudWatch {
+		operations = append(operations, "cloudwatch:PutMetricData")
+	}
+	return operations
+}
+
+// WritePlan writes the plan to w as text, or as a JSON object with --output json
+func WritePlan(w io.Writer, plan Plan, opts Options) error {
+	if opts.Output == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "Would scan %v clusters:\n", len(plan.Clusters))
+	for _, cluster := range plan.Clusters {
+		fmt.Fprintf(&text, "  Region: %v, Cluster: %v", cluster.Region, cluster.Cluster)
+		if cluster.AccountID != "" {
+			fmt.Fprintf(&text, ", Account: %v", cluster.AccountID)
+		}
+		text.WriteString("\n")
+	}
+	fmt.Fprintf(&text, "API operations per cluster: %v\n", strings.Join(plan.ClusterOperations, ", "))
+	if len(plan.AfterScanOperations) > 0 {
+		fmt.Fprintf(&text, "API operations after the scan: %v\n", strings.Join(plan.AfterScanOperations, ", "))
+	}
+	_, err := io.WriteString(w, text.String())
+	return err
+}
+
+// runPlan prints the plan of a check without describing any cluster, exiting ExitHealthy when there are
+// clusters to scan
+func runPlan(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	plan, err := NewPlan(ctx, checkers, opts)
+	if err != nil {
+		return scanErrorExitCode(ctx, err, opts)
+	}
+	if err := WritePlan(os.Stdout, plan, opts); err != nil {
+		logger.Error().Err(err).Msg("error writing output")
+		return ExitError
+	}
+	return ExitHealthy
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestNewPlan(t *testing.T) {
+	checkers := map[string]*agentstatus.StatusChecker{
+		"us-east-1": {Region: "us-east-1"},
+		"eu-west-1": {Region: "eu-west-1"},
+	}
+	opts := Options{ClusterNames: []string{"web", "arn:aws:ecs:eu-west-1:123456789012:cluster/batch"}, EC2Details: true,
+		Remediate: "drain", SNSTopicArn: "arn:aws:sns:us-east-1:123456789012:alerts", Sinks: []string{"s3://a/", "s3://b/"}}
+	plan, err := NewPlan(context.Background(), checkers, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Plan{
+		Clusters: []ClusterRef{
+			{Region: "eu-west-1", Cluster: "batch"},
+			{Region: "eu-west-1", Cluster: "web"},
+			{Region: "us-east-1", Cluster: "web"},
+		},
+		ClusterOperations: []string{"ecs:ListContainerInstances", "ecs:DescribeContainerInstances", "ec2:DescribeInstances",
+			"ec2:DescribeInstanceStatus", "autoscaling:DescribeAutoScalingInstances", "ecs:DescribeCapacityProviders"},
+		AfterScanOperations: []string{"ecs:UpdateContainerInstancesState", "sns:Publish", "s3:PutObject"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("NewPlan() = %+v, want %+v", plan, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePlan(&buf, plan, Options{Output: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	wantText := `Would scan 3 clusters:
+  Region: eu-west-1, Cluster: batch
+  Region: eu-west-1, Cluster: web
+  Region: us-east-1, Cluster: web
+API operations per cluster: ecs:ListContainerInstances, ecs:DescribeContainerInstances, ec2:DescribeInstances, ec2:DescribeInstanceStatus, autoscaling:DescribeAutoScalingInstances, ecs:DescribeCapacityProviders
+API operations after the scan: ecs:UpdateContainerInstancesState, sns:Publish, s3:PutObject
+`
+	if buf.String() != wantText {
+		t.Errorf("WritePlan(text) =\n%v\nwant\n%v", buf.String(), wantText)
+	}
+
+	opts.MaxClusters = 2
+	if _, err := NewPlan(context.Background(), checkers, opts); err == nil {
+		t.Errorf("NewPlan() with more clusters than --max-clusters did not fail")
+	}
+	if _, err := NewPlan(context.Background(), map[string]*agentstatus.StatusChecker{"ap-south-1": {Region: "ap-south-1"}},
+		Options{ClusterNames: []string{"arn:aws:ecs:eu-west-1:123456789012:cluster/batch"}}); !errors.Is(err, agentstatus.ErrNoClustersMatched) {
+		t.Errorf("NewPlan() with no clusters = %v, want ErrNoClustersMatched", err)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is a set of health rules read from the --policy file, so that what a healthy fleet is can be
+// defined per team without changing the --fail-on conditions every run shares, e.g.
+//
+//	rules:
+//	  - name: current-agents
+//	    clusters: [prod-*]
+//	    min-agent-version: 1.80.0
+//	  - name: short-disconnects
+//	    max-disconnect-duration: 10m
+//	  - name: capacity
+//	    max-draining-percent: 20
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule is a rule of a Policy: every limit it sets must hold for the agents of the clusters it applies to
+type PolicyRule struct {
+	Name string `yaml:"name"`
+	// Clusters are the name patterns, e.g. prod-*, of the clusters the rule applies to (default: every cluster)
+	Clusters []string `yaml:"clusters"`
+	// MinAgentVersion fails the agents running an older ECS agent
+	MinAgentVersion string `yaml:"min-agent-version"`
+	// MaxDisconnectDuration fails the agents disconnected for longer, going by their DisconnectedSince.
+	// Disconnected agents whose disconnection time is not known fail it
+	MaxDisconnectDuration time.Duration `yaml:"max-disconnect-duration"`
+	// MaxDrainingPercent fails the clusters with a larger percentage of DRAINING container instances
+	MaxDrainingPercent *float64 `yaml:"max-draining-percent"`
+}
+
+// PolicyViolation is a cluster, or a container instance of one, failing a rule of the policy
+type PolicyViolation struct {
+	Rule string `json:"rule"`
+	ClusterRef
+	ContainerInstanceARN string `json:"containerInstanceArn,omitempty"`
+	EC2InstanceID        string `json:"ec2InstanceId,omitempty"`
+	Message              string `json:"message"`
+}
+
+// PolicyResult is the result of a rule of the policy in json and yaml output: whether it passed, and its
+// violations if it did not
+type PolicyResult struct {
+	Rule       string            `json:"rule"`
+	Passed     bool              `json:"passed"`
+	Violations []PolicyViolation `json:"violations"`
+}
+
+// LoadPolicy reads and checks the policy file at path
+func LoadPolicy(path string) (Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Policy{}, err
+	}
+	defer f.Close()
+	return ReadPolicy(f)
+}
+
+// ReadPolicy parses and checks a policy. Unknown keys are rejected so that a mistyped limit is not ignored
+func ReadPolicy(r io.Reader) (Policy, error) {
+	var policy Policy
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return Policy{}, err
+	}
+	if len(policy.Rules) == 0 {
+		return Policy{}, errors.New("the policy has no rules")
+	}
+	names := make(map[string]bool)
+	for i, rule := range policy.Rules {
+		switch {
+		case rule.Name == "":
+			return Policy{}, fmt.Errorf("rule %v has no name", i+1)
+		case names[rule.Name]:
+			return Policy{}, fmt.Errorf("rule %v: duplicate name", rule.Name)
+		case rule.MinAgentVersion == "" && rule.MaxDisconnectDuration == 0 && rule.MaxDrainingPercent == nil:
+			return Policy{}, fmt.Errorf("rule %v sets no min-agent-version, max-disconnect-duration or max-draining-percent", rule.Name)
+		case rule.MaxDisconnectDuration < 0:
+			return Policy{}, fmt.Errorf("rule %v: invalid max-disconnect-duration %v: must not be negative", rule.Name, rule.MaxDisconnectDuration)
+		case rule.MaxDrainingPercent != nil && (*rule.MaxDrainingPercent < 0 || *rule.MaxDrainingPercent > 100):
+			return Policy{}, fmt.Errorf("rule %v: invalid max-draining-percent %v: must be from 0 to 100", rule.Name, *rule.MaxDrainingPercent)
+		}
+		for _, pattern := range rule.Clusters {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return Policy{}, fmt.Errorf("rule %v: invalid cluster pattern %q: %w", rule.Name, pattern, err)
+			}
+		}
+		names[rule.Name] = true
+	}
+	return policy, nil
+}
+
+// DisconnectDurations reports whether a rule of the policy needs to know how long agents have been disconnected
+func (p Policy) DisconnectDurations() bool {
+	for _, rule := range p.Rules {
+		if rule.MaxDisconnectDuration > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo reports whether the rule applies to the agents of cluster
+func (r PolicyRule) appliesTo(cluster string) bool {
+	if len(r.Clusters) == 0 {
+		return true
+	}
+	for _, pattern := range r.Clusters {
+		if matched, _ := path.Match(pattern, cluster); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns the violations of the rules of the policy by the agents, rule by rule
+func (p Policy) Evaluate(agents []agentstatus.Agent) []PolicyViolation {
+	var violations []PolicyViolation
+	for _, rule := range p.Rules {
+		violations = append(violations, rule.evaluate(agents)...)
+	}
+	return violations
+}
+
+// evaluate returns the violations of the rule by the agents: those of each agent, then those of each cluster
+func (r PolicyRule) evaluate(agents []agentstatus.Agent) []PolicyViolation {
+	var violations []PolicyViolation
+	type counts struct{ draining, total int }
+	var clusters []ClusterRef
+	byCluster := make(map[ClusterRef]*counts)
+	for _, agent := range agents {
+		if !r.appliesTo(agent.Cluster) {
+			continue
+		}
+		violation := func(format string, args ...any) PolicyViolation {
+			return PolicyViolation{
+				Rule:                 r.Name,
+				ClusterRef:           ClusterRef{AccountID: agent.AccountID, Region: agent.Region, Cluster: agent.Cluster},
+				ContainerInstanceARN: agent.ContainerInstanceARN,
+				EC2InstanceID:        agent.EC2InstanceID,
+				Message:              fmt.Sprintf(format, args...),
+			}
+		}
+		if r.MinAgentVersion != "" && agent.AgentVersion != "" && agentstatus.CompareVersions(agent.AgentVersion, r.MinAgentVersion) < 0 {
+			violations = append(violations, violation("ECS agent %v is older than %v", agent.AgentVersion, r.MinAgentVersion))
+		}
+		if r.MaxDisconnectDuration > 0 && !agent.AgentConnected && agent.AgentStatus != "UNKNOWN" {
+			disconnected := time.Duration(agent.DisconnectedForSeconds) * time.Second
+			switch {
+			case agent.DisconnectedSince == nil:
+				violations = append(violations, violation("the agent is disconnected and it is not known since when"))
+			case disconnected > r.MaxDisconnectDuration:
+				violations = append(violations, violation("the agent has been disconnected for %v, longer than %v", disconnected, r.MaxDisconnectDuration))
+			}
+		}
+		ref := ClusterRef{AccountID: agent.AccountID, Region: agent.Region, Cluster: agent.Cluster}
+		if byCluster[ref] == nil {
+			byCluster[ref] = &counts{}
+			clusters = append(clusters, ref)
+		}
+		byCluster[ref].total++
+		if agent.AgentStatus == "DRAINING" {
+			byCluster[ref].draining++
+		}
+	}
+	if r.MaxDrainingPercent == nil {
+		return violations
+	}
+	for _, ref := range clusters {
+		c := byCluster[ref]
+		if percent := float64(c.draining) * 100 / float64(c.total); percent > *r.MaxDrainingPercent {
+			violations = append(violations, PolicyViolation{Rule: r.Name, ClusterRef: ref,
+				Message: fmt.Sprintf("%v of %v container instances (%.1f%%) are DRAINING, more than %v%%", c.draining, c.total, percent, *r.MaxDrainingPercent)})
+		}
+	}
+	return violations
+}
+
+// Results returns the result of each rule of the policy, in the order of the rules, given the violations
+// returned by Evaluate
+func (p Policy) Results(violations []PolicyViolation) []PolicyResult {
+	results := make([]PolicyResult, len(p.Rules))
+	for i, rule := range p.Rules {
+		results[i] = PolicyResult{Rule: rule.Name, Violations: []PolicyViolation{}}
+		for _, violation := range violations {
+			if violation.Rule == rule.Name {
+				results[i].Violations = append(results[i].Violations, violation)
+			}
+		}
+		results[i].Passed = len(results[i].Violations) == 0
+	}
+	return results
+}
+
+// LogPolicyViolations logs each violation of the policy and a line per rule that passed or failed
+func LogPolicyViolations(policy Policy, violations []PolicyViolation) {
+	failed := make(map[string]int)
+	for _, violation := range violations {
+		failed[violation.Rule]++
+		event := logger.Error().Str("rule", violation.Rule).Str("region", violation.Region).Str("cluster", violation.Cluster)
+		label := violation.Cluster
+		if violation.EC2InstanceID != "" {
+			event = event.Str("ec2InstanceId", violation.EC2InstanceID)
+			label = violation.EC2InstanceID + " in " + violation.Cluster
+		}
+		event.Msgf("policy rule %v failed for %v: %v", violation.Rule, label, violation.Message)
+	}
+	for _, rule := range policy.Rules {
+		if failed[rule.Name] > 0 {
+			logger.Error().Str("rule", rule.Name).Int("violations", failed[rule.Name]).Msgf("policy rule %v failed %v times", rule.Name, failed[rule.Name])
+			continue
+		}
+		logger.Info().Str("rule", rule.Name).Msgf("policy rule %v passed", rule.Name)
+	}
+}
+
+// WritePolicyResults writes a section after text and table output with each rule of the policy, whether it
+// passed, and the violations of those that failed
+func WritePolicyResults(w io.Writer, policy Policy, violations []PolicyViolation) error {
+	if _, err := fmt.Fprintln(w, "\nPolicy:"); err != nil {
+		return err
+	}
+	for _, result := range policy.Results(violations) {
+		label := "PASS"
+		if !result.Passed {
+			label = "FAIL"
+		}
+		if _, err := fmt.Fprintf(w, "  %v: %v\n", label, result.Rule); err != nil {
+			return err
+		}
+		for _, violation := range result.Violations {
+			label := "Cluster: " + violation.Cluster
+			if violation.EC2InstanceID != "" {
+				label += ", InstanceID: " + violation.EC2InstanceID
+			}
+			if _, err := fmt.Fprintf(w, "    Region: %v, %v: %v\n", violation.Region, label, violation.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
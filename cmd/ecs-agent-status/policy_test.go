@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+const testPolicy = `rules:
+  - name: current-agents
+    clusters: [prod-*]
+    min-agent-version: 1.80.0
+  - name: short-disconnects
+    max-disconnect-duration: 10m
+  - name: capacity
+    max-draining-percent: 25
+`
+
+func TestReadPolicy(t *testing.T) {
+	policy, err := ReadPolicy(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Rules) != 3 || policy.Rules[1].MaxDisconnectDuration != 10*time.Minute || *policy.Rules[2].MaxDrainingPercent != 25 {
+		t.Errorf("ReadPolicy() = %+v", policy)
+	}
+	if !policy.DisconnectDurations() {
+		t.Error("DisconnectDurations() = false with a max-disconnect-duration rule")
+	}
+	for _, invalid := range []string{
+		"",
+		"rules:\n  - name: a\n",
+		"rules:\n  - min-agent-version: 1.80.0\n",
+		"rules:\n  - name: a\n    max-draining-percent: 120\n",
+		"rules:\n  - name: a\n    min-agent-versoin: 1.80.0\n",
+		"rules:\n  - name: a\n    min-agent-version: 1.80.0\n  - name: a\n    max-draining-percent: 5\n",
+	} {
+		if _, err := ReadPolicy(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ReadPolicy(%q) accepted an invalid policy", invalid)
+		}
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := ReadPolicy(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now()
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "prod-web", EC2InstanceID: "i-old", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.75.0"},
+		{Region: "us-east-1", Cluster: "prod-web", EC2InstanceID: "i-long", AgentStatus: "ACTIVE", AgentVersion: "1.82.0", DisconnectedSince: &since, DisconnectedForSeconds: 900},
+		{Region: "us-east-1", Cluster: "prod-web", EC2InstanceID: "i-blip", AgentStatus: "ACTIVE", AgentVersion: "1.82.0", DisconnectedSince: &since, DisconnectedForSeconds: 60},
+		{Region: "us-east-1", Cluster: "batch", EC2InstanceID: "i-batch-old", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.70.0"},
+		{Region: "us-east-1", Cluster: "batch", EC2InstanceID: "i-draining", AgentStatus: "DRAINING", AgentConnected: true, AgentVersion: "1.82.0"},
+	}
+	violations := policy.Evaluate(agents)
+	var got []string
+	for _, violation := range violations {
+		got = append(got, violation.Rule+" "+violation.Cluster+" "+violation.EC2InstanceID)
+	}
+	want := []string{"current-agents prod-web i-old", "short-disconnects prod-web i-long", "capacity batch "}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Evaluate() = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePolicyResults(&buf, policy, violations[:1]); err != nil {
+		t.Fatal(err)
+	}
+	wantText := "\nPolicy:\n  FAIL: current-agents\n    Region: us-east-1, Cluster: prod-web, InstanceID: i-old: ECS agent 1.75.0 is older than 1.80.0\n" +
+		"  PASS: short-disconnects\n  PASS: capacity\n"
+	if buf.String() != wantText {
+		t.Errorf("WritePolicyResults() =\n%q\nwant\n%q", buf.String(), wantText)
+	}
+}
+
+func TestWriteJSONPolicyResults(t *testing.T) {
+	policy, err := ReadPolicy(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agents := []agentstatus.Agent{{Region: "us-east-1", Cluster: "prod-web", EC2InstanceID: "i-old", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.75.0"}}
+	opts := Options{policyResults: policy.Results(policy.Evaluate(agents))}
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, agents, opts); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Policy []PolicyResult `json:"policy"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("WriteJSON() output is not a report object: %v", err)
+	}
+	if len(report.Policy) != 3 || report.Policy[0].Passed || !report.Policy[1].Passed ||
+		len(report.Policy[0].Violations) != 1 || report.Policy[0].Violations[0].EC2InstanceID != "i-old" {
+		t.Errorf("WriteJSON() policy = %+v", report.Policy)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// PolicySimulator is the subset of the IAM API used to check the permissions of the caller without calling
+// the operations themselves. It is satisfied by *iam.Client
+type PolicySimulator interface {
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
+}
+
+// MissingPermission is an operation the caller is not allowed to call, with the decision of the IAM policy
+// simulator, e.g. implicitDeny when no policy allows it or explicitDeny when one denies it
+type MissingPermission struct {
+	Action   string
+	Decision string
+}
+
+func (p MissingPermission) String() string {
+	return fmt.Sprintf("%v (%v)", p.Action, p.Decision)
+}
+
+// PreflightOperations returns the AWS API operations the command of opts needs, sorted: those listing the
+// clusters, those it calls for each cluster and those it calls after the scan
+func PreflightOperations(opts Options) []string {
+	operations := []string{"ecs:ListClusters", "ecs:DescribeClusters"}
+	switch {
+	case opts.ListClusters:
+	case opts.Services:
+		operations = append(operations, "ecs:ListServices", "ecs:DescribeServices")
+	case opts.UpdateAgents:
+		operations = append(operations, ClusterOperations(opts)...)
+		operations = append(operations, "ecs:UpdateContainerAgent")
+	case len(opts.DrainInstances) > 0, opts.TUI:
+		operations = append(operations, ClusterOperations(opts)...)
+		operations = append(operations, "ecs:UpdateContainerInstancesState")
+	case opts.Prune:
+		operations = append(operations, ClusterOperations(opts)...)
+		operations = append(operations, "ec2:DescribeInstances", "ecs:DeregisterContainerInstance")
+	case opts.InstallEvents:
+		// The rule covers every cluster, so none are listed
+		operations = []string{"events:PutRule", "events:PutTargets"}
+	default:
+		operations = append(operations, ClusterOperations(opts)...)
+		operations = append(operations, AfterScanOperations(opts)...)
+		if opts.EventsQueue != "" {
+			operations = append(operations, "sqs:ReceiveMessage", "sqs:DeleteMessage")
+		}
+	}
+	// GetCallerIdentity is allowed to every caller, whatever its policies say
+	operations = slices.DeleteFunc(operations, func(operation string) bool { return operation == "sts:GetCallerIdentity" })
+	slices.Sort(operations)
+	return slices.Compact(operations)
+}
+
+// PrincipalARN returns the ARN of the IAM user or role of a caller identity ARN, which the policy simulator
+// takes. The role of an assumed-role session is looked up to get its path, or built without one when it
+// cannot be. The root user and federated users cannot be simulated and return an empty ARN
+func PrincipalARN(ctx context.Context, client PolicySimulator, callerARN string) (string, error) {
+	parsed, err := arn.Parse(callerARN)
+	if err != nil {
+		return "", fmt.Errorf("invalid caller ARN %q: %w", callerARN, err)
+	}
+	kind, rest, _ := strings.Cut(parsed.Resource, "/")
+	switch {
+	case parsed.Service == "iam" && kind == "user":
+		return callerARN, nil
+	case parsed.Service == "sts" && kind == "assumed-role":
+		role, _, _ := strings.Cut(rest, "/")
+		output, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(role)})
+		if err != nil {
+			logger.Debug().Err(err).Str("role", role).Msgf("error looking up role %v, simulating it without a path: %v", role, err)
+			return arn.ARN{Partition: parsed.Partition, Service: "iam", AccountID: parsed.AccountID, Resource: "role/" + role}.String(), nil
+		}
+		return aws.ToString(output.Role.Arn), nil
+	}
+	return "", nil
+}
+
+// SimulatePermissions returns the operations that principal is not allowed to call on any resource, as
+// judged by its identity policies and permissions boundary. Service control policies and resource policies
+// are not evaluated
+func SimulatePermissions(ctx context.Context, client PolicySimulator, principal string, operations []string) ([]MissingPermission, error) {
+	var missing []MissingPermission
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(client, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principal),
+		ActionNames:     operations,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("simulate the policies of %v: %w", principal, err)
+		}
+		for _, result := range output.EvaluationResults {
+			if result.EvalDecision != "allowed" {
+				missing = append(missing, MissingPermission{Action: aws.ToString(result.EvalActionName), Decision: string(result.EvalDecision)})
+			}
+		}
+	}
+	return missing, nil
+}
+
+// isAccessDenied reports whether err is an AWS error denying the call
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorCode(), "AccessDenied")
+}
+
+// preflightScope checks the permissions of the caller in one scope and returns the missing ones. When the
+// policies cannot be simulated, only ecs:ListClusters is checked, by calling it
+func preflightScope(ctx context.Context, identity CallerIdentifier, simulator PolicySimulator, lister agentstatus.ECSLister, scope string, operations []string) ([]MissingPermission, error) {
+	output, err := identity.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("get caller identity: %w", err)
+	}
+	callerARN := aws.ToString(output.Arn)
+	logger.Info().Str("scope", scope).Str("arn", callerARN).Str("accountId", aws.ToString(output.Account)).
+		Msgf("preflight: calling AWS as %v", callerARN)
+	principal, err := PrincipalARN(ctx, simulator, callerARN)
+	if err != nil {
+		return nil, err
+	}
+	if principal != "" {
+		missing, err := SimulatePermissions(ctx, simulator, principal, operations)
+		if err == nil {
+			return missing, nil
+		}
+		logger.Warn().Err(err).Str("scope", scope).Msgf("preflight: cannot simulate the permissions of %v, only checking ecs:ListClusters: %v", principal, err)
+	} else {
+		logger.Warn().Str("scope", scope).Msgf("preflight: the permissions of %v cannot be simulated, only checking ecs:ListClusters", callerARN)
+	}
+	_, err = lister.ListClusters(ctx, &ecs.ListClustersInput{MaxResults: aws.Int32(1)})
+	switch {
+	case isAccessDenied(err):
+		return []MissingPermission{{Action: "ecs:ListClusters", Decision: "AccessDenied"}}, nil
+	case err != nil:
+		return nil, fmt.Errorf("list clusters: %w", err)
+	}
+	return nil, nil
+}
+
+// runPreflight checks, in every scanned region and account, who the AWS calls are made as and whether they
+// may call the operations the command needs, logging each missing permission. It returns ExitHealthy when
+// nothing is missing, so the command can go on, and ExitError otherwise
+func runPreflight(ctx context.Context, cfgs map[string]aws.Config, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	operations := PreflightOperations(opts)
+	missingCount := 0
+	// The policies of a principal are the same in every region, so they are simulated once per account
+	checked := make(map[string]bool)
+	for _, scope := range SortedRegions(checkers) {
+		account := scopeAccount(scope)
+		if checked[account] {
+			continue
+		}
+		checked[account] = true
+		missing, err := preflightScope(ctx, sts.NewFromConfig(cfgs[scope]), iam.NewFromConfig(cfgs[scope]), checkers[scope].Client, scope, operations)
+		if err != nil {
+			logger.Error().Err(err).Str("scope", scope).Msgf("preflight failed in %v: %v", scope, err)
+			return ExitError
+		}
+		for _, permission := range missing {
+			logger.Error().Str("scope", scope).Str("action", permission.Action).Str("decision", permission.Decision).
+				Msgf("preflight: missing permission %v", permission)
+		}
+		missingCount += len(missing)
+	}
+	if missingCount > 0 {
+		logger.Error().Int("missing", missingCount).Msgf("preflight: %v permissions are missing, not scanning", missingCount)
+		return ExitError
+	}
+	logger.Info().Strs("operations", operations).Msgf("preflight: all %v permissions are allowed", len(operations))
+	return ExitHealthy
+}
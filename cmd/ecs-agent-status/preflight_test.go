@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+)
+
+type fakePolicySimulator struct {
+	roleARN     string
+	denied      []string
+	simulateErr error
+	principal   string
+}
+
+func (f *fakePolicySimulator) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if f.roleARN == "" {
+		return nil, errors.New("access denied")
+	}
+	return &iam.GetRoleOutput{Role: &iamtypes.Role{Arn: aws.String(f.roleARN)}}, nil
+}
+
+func (f *fakePolicySimulator) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	if f.simulateErr != nil {
+		return nil, f.simulateErr
+	}
+	f.principal = aws.ToString(params.PolicySourceArn)
+	output := &iam.SimulatePrincipalPolicyOutput{}
+	for _, action := range params.ActionNames {
+		decision := iamtypes.PolicyEvaluationDecisionTypeAllowed
+		if slices.Contains(f.denied, action) {
+			decision = iamtypes.PolicyEvaluationDecisionTypeImplicitDeny
+		}
+		output.EvaluationResults = append(output.EvaluationResults, iamtypes.EvaluationResult{EvalActionName: aws.String(action), EvalDecision: decision})
+	}
+	return output, nil
+}
+
+type fakeClusterLister struct {
+	err error
+}
+
+func (f fakeClusterLister) ListClusters(ctx context.Context, params *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+	return &ecs.ListClustersOutput{}, f.err
+}
+
+func TestPreflightOperations(t *testing.T) {
+	got := PreflightOperations(Options{Remediate: "drain", AuditLog: "audit.jsonl", CheckSSM: true})
+	want := []string{"ecs:DescribeCapacityProviders", "ecs:DescribeClusters", "ecs:DescribeContainerInstances", "ecs:ListClusters",
+		"ecs:ListContainerInstances", "ecs:UpdateContainerInstancesState", "ssm:DescribeInstanceInformation"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PreflightOperations() = %v, want %v", got, want)
+	}
+	if got := PreflightOperations(Options{ListClusters: true}); !reflect.DeepEqual(got, []string{"ecs:DescribeClusters", "ecs:ListClusters"}) {
+		t.Errorf("PreflightOperations() of clusters = %v", got)
+	}
+	if got := PreflightOperations(Options{InstallEvents: true}); !reflect.DeepEqual(got, []string{"events:PutRule", "events:PutTargets"}) {
+		t.Errorf("PreflightOperations() of install-events = %v", got)
+	}
+}
+
+func TestPrincipalARN(t *testing.T) {
+	tests := []struct {
+		callerARN string
+		roleARN   string
+		want      string
+	}{
+		{callerARN: "arn:aws:iam::123456789012:user/ops/jane", want: "arn:aws:iam::123456789012:user/ops/jane"},
+		{callerARN: "arn:aws:sts::123456789012:assumed-role/ecs-audit/session", roleARN: "arn:aws:iam::123456789012:role/service/ecs-audit",
+			want: "arn:aws:iam::123456789012:role/service/ecs-audit"},
+		{callerARN: "arn:aws:sts::123456789012:assumed-role/ecs-audit/session", want: "arn:aws:iam::123456789012:role/ecs-audit"},
+		{callerARN: "arn:aws:iam::123456789012:root", want: ""},
+		{callerARN: "arn:aws:sts::123456789012:federated-user/jane", want: ""},
+	}
+	for _, tt := range tests {
+		got, err := PrincipalARN(context.Background(), &fakePolicySimulator{roleARN: tt.roleARN}, tt.callerARN)
+		if err != nil || got != tt.want {
+			t.Errorf("PrincipalARN(%q) = %q, %v, want %q", tt.callerARN, got, err, tt.want)
+		}
+	}
+}
+
+func TestPreflightScope(t *testing.T) {
+	operations := []string{"ecs:DescribeContainerInstances", "ecs:ListClusters", "ecs:ListContainerInstances"}
+	simulator := &fakePolicySimulator{denied: []string{"ecs:DescribeContainerInstances"}}
+	missing, err := preflightScope(context.Background(), &fakeCallerIdentifier{}, simulator, fakeClusterLister{}, "us-east-1", operations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []MissingPermission{{Action: "ecs:DescribeContainerInstances", Decision: "implicitDeny"}}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("preflightScope() = %v, want %v", missing, want)
+	}
+	if simulator.principal != "arn:aws:iam::123456789012:role/ops" {
+		t.Errorf("simulated principal = %q", simulator.principal)
+	}
+
+	// Without iam:SimulatePrincipalPolicy, only ListClusters is checked, by calling it
+	simulator = &fakePolicySimulator{simulateErr: errors.New("not authorized to perform iam:SimulatePrincipalPolicy")}
+	denied := fakeClusterLister{err: &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized"}}
+	missing, err = preflightScope(context.Background(), &fakeCallerIdentifier{}, simulator, denied, "us-east-1", operations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []MissingPermission{{Action: "ecs:ListClusters", Decision: "AccessDenied"}}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("preflightScope() without simulation = %v, want %v", missing, want)
+	}
+	missing, err = preflightScope(context.Background(), &fakeCallerIdentifier{}, simulator, fakeClusterLister{}, "us-east-1", operations)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("preflightScope() without simulation = %v, %v, want nothing missing", missing, err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// WriteAPIProfile writes a table of the AWS API operations called by the run to w, the slowest in total
+// first, with their number of calls, throttling errors and average, 95th percentile, maximum and total
+// durations
+func WriteAPIProfile(w io.Writer, operations []agentstatus.OperationStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "SERVICE\tOPERATION\tCALLS\tTHROTTLED\tAVG\tP95\tMAX\tTOTAL\t")
+	for _, op := range operations {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n", op.Service, op.Operation, op.Calls, op.Throttles,
+			roundDuration(op.Average), roundDuration(op.P95), roundDuration(op.Max), roundDuration(op.Total))
+	}
+	return tw.Flush()
+}
+
+// roundDuration rounds an API call duration to the millisecond, or to the second from a minute on
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Minute {
+		return d.Round(time.Second)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteAPIProfile(t *testing.T) {
+	var buf bytes.Buffer
+	operations := []agentstatus.OperationStats{
+		{Service: "ECS", Operation: "DescribeContainerInstances", Calls: 400, Throttles: 12, Total: 3*time.Minute + 200*time.Millisecond,
+			Average: 450400 * time.Microsecond, P95: 1200300 * time.Microsecond, Max: 4 * time.Second},
+	}
+	if err := WriteAPIProfile(&buf, operations); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "OPERATION") {
+		t.Fatalf("WriteAPIProfile() = %q, want a header and a row", buf.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "ECS DescribeContainerInstances 400 12 450ms 1.2s 4s 3m0s" {
+		t.Errorf("WriteAPIProfile() row = %q", lines[1])
+	}
+}
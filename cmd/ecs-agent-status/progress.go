@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// progressLogInterval is how often a scan logs its progress, so scans finishing sooner log none
+const progressLogInterval = 10 * time.Second
+
+// progressBarWidth is the number of characters between the brackets of the --progress bar
+const progressBarWidth = 30
+
+// ScanProgress counts the clusters a scan has checked and the container instances it has described
+type ScanProgress struct {
+	Clusters  int
+	Done      int
+	Instances int
+	Started   time.Time
+}
+
+// ETA estimates the time left from the average time per cluster so far. It is 0 until a cluster is done
+func (p ScanProgress) ETA(now time.Time) time.Duration {
+	if p.Done == 0 || p.Done >= p.Clusters {
+		return 0
+	}
+	perCluster := now.Sub(p.Started) / time.Duration(p.Done)
+	return (perCluster * time.Duration(p.Clusters-p.Done)).Round(time.Second)
+}
+
+// Format returns the progress as a line, e.g. 12/40 clusters, 3400 instances, ETA 1m20s
+func (p ScanProgress) Format(now time.Time) string {
+	line := fmt.Sprintf("%v/%v clusters, %v instances", p.Done, p.Clusters, p.Instances)
+	if eta := p.ETA(now); eta > 0 {
+		line += fmt.Sprintf(", ETA %v", eta)
+	}
+	return line
+}
+
+// ProgressBar returns the progress as a bar of width characters followed by its Format
+func ProgressBar(p ScanProgress, width int, now time.Time) string {
+	filled := width
+	if p.Clusters > 0 {
+		filled = width * p.Done / p.Clusters
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+	return fmt.Sprintf("[%v] %v", bar, p.Format(now))
+}
+
+// progressReporter reports the progress of a scan after each cluster: by redrawing a progress bar on a
+// terminal with --progress, or otherwise as a log event every progressLogInterval
+type progressReporter struct {
+	progress ScanProgress
+	// bar is the terminal the bar is drawn on, nil to log the progress
+	bar     io.Writer
+	lastLog time.Time
+}
+
+// newProgressReporter returns a reporter of the scan of clusters clusters. The bar is only drawn when
+// stderr is a terminal, so that redirected runs log the progress instead
+func newProgressReporter(clusters int, opts Options) *progressReporter {
+	now := time.Now()
+	r := &progressReporter{progress: ScanProgress{Clusters: clusters, Started: now}, lastLog: now}
+	if opts.Progress && isatty.IsTerminal(os.Stderr.Fd()) {
+		r.bar = os.Stderr
+		r.draw(now)
+	}
+	return r
+}
+
+// clusterDone counts a checked cluster, whether or not its check succeeded, with the container instances
+// it described
+func (r *progressReporter) clusterDone(instances int) {
+	r.progress.Done++
+	r.progress.Instances += instances
+	now := time.Now()
+	if r.bar != nil {
+		r.draw(now)
+		return
+	}
+	if now.Sub(r.lastLog) < progressLogInterval || r.progress.Done == r.progress.Clusters {
+		return
+	}
+	r.lastLog = now
+	logger.Info().Int("clustersDone", r.progress.Done).Int("clusters", r.progress.Clusters).Int("instances", r.progress.Instances).
+		Dur("eta", r.progress.ETA(now)).Msgf("progress: %v", r.progress.Format(now))
+}
+
+// draw redraws the bar over the current terminal line
+func (r *progressReporter) draw(now time.Time) {
+	fmt.Fprintf(r.bar, "\r%v\033[K", ProgressBar(r.progress, progressBarWidth, now))
+}
+
+// finish clears the bar, so that the output and logs after the scan start on an empty line
+func (r *progressReporter) finish() {
+	if r.bar != nil {
+		fmt.Fprint(r.bar, "\r\033[K")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanProgress(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := started.Add(30 * time.Second)
+	progress := ScanProgress{Clusters: 40, Done: 10, Instances: 850, Started: started}
+	if got, want := progress.ETA(now), 90*time.Second; got != want {
+		t.Errorf("ETA() = %v, want %v", got, want)
+	}
+	if got, want := progress.Format(now), "10/40 clusters, 850 instances, ETA 1m30s"; got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+	if got, want := ProgressBar(progress, 8, now), "[==>     ] 10/40 clusters, 850 instances, ETA 1m30s"; got != want {
+		t.Errorf("ProgressBar() = %q, want %q", got, want)
+	}
+	start := ScanProgress{Clusters: 40, Started: started}
+	if got, want := start.Format(now), "0/40 clusters, 0 instances"; got != want {
+		t.Errorf("Format() before the first cluster = %q, want %q", got, want)
+	}
+	done := ScanProgress{Clusters: 2, Done: 2, Instances: 5, Started: started}
+	if got, want := ProgressBar(done, 4, now), "[====] 2/2 clusters, 5 instances"; got != want {
+		t.Errorf("ProgressBar() when done = %q, want %q", got, want)
+	}
+}
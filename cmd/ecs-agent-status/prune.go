@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/mattn/go-isatty"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// FindStaleAgents returns the container instances of the cluster whose EC2 instance no longer exists,
+// grouped by ScopeKey. Regions without the cluster or without container instances have none
+func FindStaleAgents(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, cluster string) (map[string][]agentstatus.Agent, error) {
+	stale := make(map[string][]agentstatus.Agent)
+	for _, scope := range SortedRegions(checkers) {
+		checker := checkers[scope]
+		agents, err := checker.GetAgentStatusForCluster(ctx, cluster)
+		var clusterNotFound *types.ClusterNotFoundException
+		switch {
+		case errors.As(err, &clusterNotFound), errors.Is(err, agentstatus.ErrNoContainerInstances):
+			logger.Debug().Err(err).Str("region", checker.Region).Msgf("no container instances of %v in region %v", cluster, checker.Region)
+			if errors.As(err, &clusterNotFound) && len(checkers) == 1 {
+				return nil, err
+			}
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("region %v: %w", checker.Region, err)
+		}
+		if checker.EC2 == nil {
+			return nil, errors.New("the EC2 instances of the container instances cannot be looked up without an EC2 client")
+		}
+		if stale[scope], err = agentstatus.StaleAgents(ctx, checker.EC2, agents); err != nil {
+			return nil, fmt.Errorf("region %v: %w", checker.Region, err)
+		}
+	}
+	return stale, nil
+}
+
+// DeregisterAgents deregisters the container instances of the cluster, recording each in the audit log, and
+// returns how many could not be deregistered. Failures are logged and the other instances still deregistered
+func DeregisterAgents(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, cluster string, targets map[string][]agentstatus.Agent) int {
+	failed := 0
+	for _, scope := range SortedRegions(checkers) {
+		for _, agent := range targets[scope] {
+			err := checkers[scope].DeregisterContainerInstance(ctx, cluster, agent.ContainerInstanceARN)
+			auditLog.Record(ctx, NewAuditRecord(AuditDeregister, agent, &AuditState{AgentStatus: "INACTIVE"}, err))
+			if err != nil {
+				logger.Error().Err(err).Str("region", agent.Region).Str("cluster", cluster).Str("containerInstanceArn", agent.ContainerInstanceARN).
+					Msgf("error deregistering %v: %v", shortArn(agent.ContainerInstanceARN), err)
+				failed++
+				continue
+			}
+			logger.Info().Str("region", agent.Region).Str("cluster", cluster).Str("containerInstanceArn", agent.ContainerInstanceARN).
+				Str("ec2InstanceId", agent.EC2InstanceID).Msgf("deregistered %v of %v", shortArn(agent.ContainerInstanceARN), agent.EC2InstanceID)
+		}
+	}
+	return failed
+}
+
+// runPrune deregisters the container instances of a cluster whose EC2 instance no longer exists, after a
+// confirmation unless --yes is given. With --dry-run they are only logged. It returns the exit code:
+// ExitError when an instance could not be deregistered
+func runPrune(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	cluster := opts.ClusterPatterns[0]
+	targets, err := FindStaleAgents(ctx, checkers, cluster)
+	switch {
+	case ctx.Err() != nil:
+		return cancelledExitCode(ctx, opts, "while getting the container instances")
+	case err != nil:
+		logger.Error().Err(err).Msgf("error finding the stale container instances of cluster %v: %v", cluster, err)
+		return ExitError
+	}
+	count := 0
+	for _, scope := range SortedRegions(checkers) {
+		for _, agent := range targets[scope] {
+			count++
+			logger.Info().Str("region", agent.Region).Str("cluster", cluster).Str("containerInstanceArn", agent.ContainerInstanceARN).
+				Str("ec2InstanceId", agent.EC2InstanceID).Int("runningTasks", agent.RunningTasks).
+				Msgf("%v is registered but its EC2 instance %v no longer exists", shortArn(agent.ContainerInstanceARN), agent.EC2InstanceID)
+		}
+	}
+	switch {
+	case count == 0:
+		logger.Info().Str("cluster", cluster).Msgf("cluster %v has no stale container instances", cluster)
+		return ExitHealthy
+	case opts.DryRun:
+		logger.Info().Str("cluster", cluster).Int("stale", count).Msgf("would deregister %v container instances of cluster %v", count, cluster)
+		return ExitHealthy
+	case !opts.Yes && !isatty.IsTerminal(os.Stdin.Fd()):
+		logger.Error().Msg("prune asks for confirmation on a terminal: pass --yes to deregister the container instances without asking")
+		return ExitError
+	case !opts.Yes && !Confirm(os.Stdin, os.Stderr, fmt.Sprintf("Deregister %v container instances of cluster %v?", count, cluster)):
+		logger.Error().Msg("deregistering the container instances was not confirmed")
+		return ExitError
+	}
+	if failed := DeregisterAgents(ctx, checkers, cluster, targets); failed > 0 {
+		logger.Error().Str("cluster", cluster).Int("failed", failed).Msgf("%v of %v container instances could not be deregistered", failed, count)
+		return ExitError
+	}
+	return ExitHealthy
+}
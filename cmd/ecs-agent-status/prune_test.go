@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// deregisteringECS records the container instances deregistered, failing those in fail
+type deregisteringECS struct {
+	agentstatus.ECSClient
+	fail         map[string]bool
+	deregistered []string
+}
+
+func (m *deregisteringECS) DeregisterContainerInstance(_ context.Context, params *ecs.DeregisterContainerInstanceInput, _ ...func(*ecs.Options)) (*ecs.DeregisterContainerInstanceOutput, error) {
+	arn := aws.ToString(params.ContainerInstance)
+	if m.fail[arn] {
+		return nil, errors.New("access denied")
+	}
+	m.deregistered = append(m.deregistered, arn)
+	return &ecs.DeregisterContainerInstanceOutput{}, nil
+}
+
+func TestDeregisterAgents(t *testing.T) {
+	a, b, c := "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb", "arn:aws:ecs:us-west-2:123456789012:container-instance/web/cccc"
+	east, west := &deregisteringECS{fail: map[string]bool{b: true}}, &deregisteringECS{}
+	checkers := map[string]*agentstatus.StatusChecker{
+		"us-east-1": agentstatus.NewStatusChecker(east, "us-east-1"),
+		"us-west-2": agentstatus.NewStatusChecker(west, "us-west-2"),
+	}
+	targets := map[string][]agentstatus.Agent{
+		"us-east-1": {{ContainerInstanceARN: a, EC2InstanceID: "i-aaaa"}, {ContainerInstanceARN: b, EC2InstanceID: "i-bbbb"}},
+		"us-west-2": {{ContainerInstanceARN: c, EC2InstanceID: "i-cccc"}},
+	}
+	if failed := DeregisterAgents(context.Background(), checkers, "web", targets); failed != 1 {
+		t.Errorf("DeregisterAgents() = %v failed, want 1", failed)
+	}
+	if !slices.Equal(east.deregistered, []string{a}) || !slices.Equal(west.deregistered, []string{c}) {
+		t.Errorf("DeregisterAgents() deregistered %v and %v, want [%v] and [%v]", east.deregistered, west.deregistered, a, c)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Statuses of the status parameter of /v1/agents that are not container instance statuses
+const (
+	queryStatusConnected    = "CONNECTED"
+	queryStatusDisconnected = "DISCONNECTED"
+	queryStatusHealthy      = "HEALTHY"
+	queryStatusUnhealthy    = "UNHEALTHY"
+)
+
+// AgentQuery selects agents by the query parameters of /v1/agents. Each field holds the values of a
+// parameter, given repeated or separated by commas: an agent matches when it matches one value of every
+// parameter given
+type AgentQuery struct {
+	// Clusters are cluster names, matched exactly
+	Clusters []string
+	Regions  []string
+	Accounts []string
+	// Statuses are container instance statuses, e.g. ACTIVE or DRAINING, or CONNECTED, DISCONNECTED,
+	// HEALTHY and UNHEALTHY, the last two as judged by the --fail-on policy of serve
+	Statuses []string
+	// Instances are EC2 or SSM managed instance IDs, or container instance ARNs or IDs
+	Instances []string
+}
+
+// ParseAgentQuery returns the query of the parameters of a /v1/agents request, failing on unknown
+// parameters so that a misspelt one does not silently return every agent
+func ParseAgentQuery(values url.Values) (AgentQuery, error) {
+	var query AgentQuery
+	fields := map[string]*[]string{
+		"cluster":  &query.Clusters,
+		"region":   &query.Regions,
+		"account":  &query.Accounts,
+		"status":   &query.Statuses,
+		"instance": &query.Instances,
+	}
+	for name, list := range values {
+		field, ok := fields[name]
+		if !ok {
+			return AgentQuery{}, fmt.Errorf("unknown parameter %q: must be one of cluster, region, account, status or instance", name)
+		}
+		for _, value := range list {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*field = append(*field, item)
+				}
+			}
+		}
+	}
+	for i, status := range query.Statuses {
+		query.Statuses[i] = strings.ToUpper(status)
+	}
+	return query, nil
+}
+
+// matchesStatus reports whether the agent has the status, judging HEALTHY and UNHEALTHY by policy
+func matchesStatus(agent agentstatus.Agent, status string, policy agentstatus.HealthPolicy) bool {
+	switch status {
+	case queryStatusConnected:
+		return agent.AgentConnected
+	case queryStatusDisconnected:
+		return !agent.AgentConnected
+	case queryStatusHealthy:
+		return !policy.Unhealthy(agent)
+	case queryStatusUnhealthy:
+		return policy.Unhealthy(agent)
+	}
+	return agent.AgentStatus == status
+}
+
+// Matches reports whether the agent matches the query
+func (q AgentQuery) Matches(agent agentstatus.Agent, policy agentstatus.HealthPolicy) bool {
+	if len(q.Clusters) > 0 && !slices.Contains(q.Clusters, agent.Cluster) {
+		return false
+	}
+	if len(q.Regions) > 0 && !slices.Contains(q.Regions, agent.Region) {
+		return false
+	}
+	if len(q.Accounts) > 0 && !slices.Contains(q.Accounts, agent.AccountID) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !slices.ContainsFunc(q.Statuses, func(status string) bool { return matchesStatus(agent, status, policy) }) {
+		return false
+	}
+	if len(q.Instances) > 0 && !slices.ContainsFunc(q.Instances, agent.HasInstanceID) {
+		return false
+	}
+	return true
+}
+
+// AgentsResponse is the /v1/agents response of serve
+type AgentsResponse struct {
+	// UpdatedAt is when the scan of the agents started
+	UpdatedAt time.Time           `json:"updatedAt"`
+	Count     int                 `json:"count"`
+	Agents    []agentstatus.Agent `json:"agents"`
+}
+
+// writeJSONError answers a request with code and a JSON object holding the error message
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// ServeAgents answers GET /v1/agents with the agents of the most recent successful scan that match the query
+// parameters, e.g. /v1/agents?cluster=prod-web&status=DISCONNECTED, as JSON. It answers 400 for an invalid
+// query and 503 until a scan has succeeded
+func (e *Exporter) ServeAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	query, err := ParseAgentQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.updated.IsZero() {
+		writeJSONError(w, http.StatusServiceUnavailable, "not ready: no scan has succeeded yet")
+		return
+	}
+	response := AgentsResponse{UpdatedAt: e.updated.UTC(), Agents: []agentstatus.Agent{}}
+	for _, agent := range e.agents {
+		if query.Matches(agent, e.policy) {
+			response.Agents = append(response.Agents, agent)
+		}
+	}
+	response.Count = len(response.Agents)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error().Err(err).Msg("error writing agents")
+	}
+}
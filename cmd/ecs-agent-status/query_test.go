@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestParseAgentQuery(t *testing.T) {
+	query, err := ParseAgentQuery(url.Values{"cluster": {"web,api", "batch"}, "status": {"disconnected"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(query.Clusters) != 3 || query.Clusters[2] != "batch" || len(query.Statuses) != 1 || query.Statuses[0] != "DISCONNECTED" {
+		t.Errorf("ParseAgentQuery() = %+v", query)
+	}
+	if _, err := ParseAgentQuery(url.Values{"clusters": {"web"}}); err == nil {
+		t.Error("ParseAgentQuery() with an unknown parameter returned no error")
+	}
+}
+
+func TestExporterServeAgents(t *testing.T) {
+	exporter := &Exporter{}
+	recorder := httptest.NewRecorder()
+	exporter.ServeAgents(recorder, httptest.NewRequest(http.MethodGet, "/v1/agents", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeAgents() before a scan = %v, want %v", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	exporter.agents = []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "prod-web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "prod-web", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE"},
+		{Region: "us-west-2", Cluster: "prod-api", EC2InstanceID: "i-cccc", AgentStatus: "DRAINING", AgentConnected: true},
+	}
+	exporter.policy = agentstatus.DefaultHealthPolicy
+	exporter.updated = time.Unix(1700000000, 0)
+	tests := []struct {
+		target string
+		code   int
+		want   []string
+	}{
+		{target: "/v1/agents", code: http.StatusOK, want: []string{"i-aaaa", "i-bbbb", "i-cccc"}},
+		{target: "/v1/agents?cluster=prod-web&status=DISCONNECTED", code: http.StatusOK, want: []string{"i-bbbb"}},
+		{target: "/v1/agents?status=draining,disconnected", code: http.StatusOK, want: []string{"i-bbbb", "i-cccc"}},
+		{target: "/v1/agents?status=unhealthy&region=us-west-2", code: http.StatusOK, want: []string{"i-cccc"}},
+		{target: "/v1/agents?instance=i-aaaa", code: http.StatusOK, want: []string{"i-aaaa"}},
+		{target: "/v1/agents?cluster=prod", code: http.StatusOK, want: []string{}},
+		{target: "/v1/agents?state=ACTIVE", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		exporter.ServeAgents(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if recorder.Code != tt.code {
+			t.Errorf("ServeAgents(%v) = %v, want %v", tt.target, recorder.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var response AgentsResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, agent := range response.Agents {
+			got = append(got, agent.EC2InstanceID)
+		}
+		if response.Count != len(tt.want) || len(got) != len(tt.want) || !response.UpdatedAt.Equal(exporter.updated) {
+			t.Errorf("ServeAgents(%v) = %+v, want %v", tt.target, response, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ServeAgents(%v) = %v, want %v", tt.target, got, tt.want)
+				break
+			}
+		}
+	}
+	recorder = httptest.NewRecorder()
+	exporter.ServeAgents(recorder, httptest.NewRequest(http.MethodPost, "/v1/agents", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("ServeAgents() with POST = %v, want %v", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
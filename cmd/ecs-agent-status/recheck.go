@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// RecheckDisconnected describes the container instances of the disconnected agents again, up to attempts
+// times, waiting interval before the first recheck and twice as long before each one after it. The agents
+// that reconnected take their new state, so that an agent seen disconnected once, e.g. while it restarts,
+// is not reported unhealthy; the others are kept as scanned. Errors are logged and retried at the next recheck
+func RecheckDisconnected(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent, attempts int, interval time.Duration) []agentstatus.Agent {
+	// The indexes of the agents still disconnected, by scope and cluster
+	pending := make(map[string]map[string][]int)
+	remaining := 0
+	for i, agent := range agents {
+		// UNKNOWN agents could not be described, so describing them again would not tell more
+		if agent.AgentConnected || agent.AgentStatus == "UNKNOWN" || agent.ContainerInstanceARN == "" {
+			continue
+		}
+		scope := scopeIn(checkers, agent.AccountID, agent.Region)
+		if pending[scope] == nil {
+			pending[scope] = make(map[string][]int)
+		}
+		pending[scope][agent.Cluster] = append(pending[scope][agent.Cluster], i)
+		remaining++
+	}
+	wait := interval
+	for attempt := 1; attempt <= attempts && remaining > 0; attempt++ {
+		logger.Info().Int("disconnected", remaining).Int("attempt", attempt).
+			Msgf("rechecking %v disconnected agents in %v (%v of %v)", remaining, wait, attempt, attempts)
+		select {
+		case <-ctx.Done():
+			return agents
+		case <-time.After(wait):
+		}
+		wait *= 2
+		for scope, clusters := range pending {
+			checker := checkers[scope]
+			if checker == nil {
+				continue
+			}
+			for cluster, indexes := range clusters {
+				arns := make([]string, len(indexes))
+				for j, i := range indexes {
+					arns[j] = agents[i].ContainerInstanceARN
+				}
+				output, err := checker.DescribeContainerInstances(ctx, cluster, arns)
+				if err != nil {
+					logger.Warn().Err(err).Str("cluster", cluster).Msgf("error rechecking the agents of cluster %v: %v", cluster, err)
+					continue
+				}
+				rechecked := make(map[string]agentstatus.Agent)
+				for _, agent := range agentstatus.AgentsFromDescribeOutput(cluster, output) {
+					rechecked[agent.ContainerInstanceARN] = agent
+				}
+				var still []int
+				for _, i := range indexes {
+					after, ok := rechecked[agents[i].ContainerInstanceARN]
+					if !ok || !after.AgentConnected {
+						still = append(still, i)
+						continue
+					}
+					updateAgentState(&agents[i], after)
+					remaining--
+					logger.Info().Str("cluster", cluster).Str("containerInstanceArn", agents[i].ContainerInstanceARN).Int("attempt", attempt).
+						Msgf("the agent on %v reconnected on recheck %v", agents[i].InstanceID(), attempt)
+				}
+				if len(still) == 0 {
+					delete(clusters, cluster)
+				} else {
+					clusters[cluster] = still
+				}
+			}
+		}
+	}
+	if remaining > 0 {
+		logger.Warn().Int("disconnected", remaining).Msgf("%v agents are still disconnected after %v rechecks", remaining, attempts)
+	}
+	return agents
+}
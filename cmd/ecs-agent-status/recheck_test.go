@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// reconnectingECS describes its container instances as connected from the given call on, counting the calls
+type reconnectingECS struct {
+	agentstatus.ECSClient
+	connectedFrom int
+	calls         int
+}
+
+func (m *reconnectingECS) DescribeContainerInstances(ctx context.Context, params *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+	m.calls++
+	output := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range params.ContainerInstances {
+		output.ContainerInstances = append(output.ContainerInstances, types.ContainerInstance{
+			ContainerInstanceArn: aws.String(arn),
+			Ec2InstanceId:        aws.String("i-flap"),
+			Status:               aws.String("ACTIVE"),
+			AgentConnected:       m.calls >= m.connectedFrom,
+			RunningTasksCount:    2,
+		})
+	}
+	return output, nil
+}
+
+func TestRecheckDisconnected(t *testing.T) {
+	arn := "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa"
+	scanned := func() []agentstatus.Agent {
+		return []agentstatus.Agent{
+			{AccountID: "123456789012", Region: "us-east-1", Cluster: "web", ContainerInstanceARN: arn, EC2InstanceID: "i-flap", AgentStatus: "ACTIVE", InstanceType: "m5.large"},
+			{AccountID: "123456789012", Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:other", EC2InstanceID: "i-ok", AgentStatus: "ACTIVE", AgentConnected: true},
+		}
+	}
+
+	client := &reconnectingECS{connectedFrom: 2}
+	checkers := map[string]*agentstatus.StatusChecker{"us-east-1": agentstatus.NewStatusChecker(client, "us-east-1")}
+	agents := RecheckDisconnected(context.Background(), checkers, scanned(), 3, time.Millisecond)
+	if !agents[0].AgentConnected || agents[0].RunningTasks != 2 || agents[0].InstanceType != "m5.large" {
+		t.Errorf("RecheckDisconnected() = %+v, want the agent reconnected with its EC2 details kept", agents[0])
+	}
+	if client.calls != 2 {
+		t.Errorf("DescribeContainerInstances called %v times, want 2: rechecks stop once the agent reconnects", client.calls)
+	}
+
+	client = &reconnectingECS{connectedFrom: 10}
+	checkers = map[string]*agentstatus.StatusChecker{"us-east-1": agentstatus.NewStatusChecker(client, "us-east-1")}
+	agents = RecheckDisconnected(context.Background(), checkers, scanned(), 3, time.Millisecond)
+	if agents[0].AgentConnected || client.calls != 3 {
+		t.Errorf("RecheckDisconnected() of an agent that stays disconnected = %+v after %v calls, want it disconnected after 3", agents[0], client.calls)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Redactor replaces account IDs, EC2 and managed instance IDs, launch template IDs and the account and ID
+// parts of ARNs with a keyed hash of them. A value is replaced by the same hash everywhere it appears, and
+// in every run using the same key, so redacted output can be shared and still be compared and diffed
+type Redactor struct {
+	key []byte
+}
+
+// NewRedactor returns a Redactor hashing with key, or with a random key when it is empty, so that its hashes
+// are only consistent within the run
+func NewRedactor(key string) *Redactor {
+	if key != "" {
+		return &Redactor{key: []byte(key)}
+	}
+	random := make([]byte, 32)
+	rand.Read(random)
+	return &Redactor{key: random}
+}
+
+// sum returns the HMAC of the value
+func (r *Redactor) sum(value string) []byte {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// AccountID returns the redacted account ID: 12 digits, like an account ID
+func (r *Redactor) AccountID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%012d", binary.BigEndian.Uint64(r.sum("account:"+id))%1_000_000_000_000)
+}
+
+// ID returns the redacted form of an ID such as i-0123456789abcdef0, mi-0123456789abcdef0 or
+// lt-0123456789abcdef0: the same prefix followed by 17 hex digits
+func (r *Redactor) ID(id string) string {
+	if id == "" {
+		return ""
+	}
+	prefix, _, found := strings.Cut(id, "-")
+	if !found {
+		prefix = "id"
+	}
+	return prefix + "-" + hex.EncodeToString(r.sum("id:" + id))[:17]
+}
+
+// ARN returns the redacted ARN: its account is redacted and, for container instances and tasks, the ID at
+// the end of the resource, e.g. arn:aws:ecs:us-east-1:123456789012:container-instance/web/0123abcd. Cluster
+// names, regions and the other resources are kept
+func (r *Redactor) ARN(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return arn
+	}
+	parts[4] = r.AccountID(parts[4])
+	resource := parts[5]
+	if strings.HasPrefix(resource, "container-instance/") || strings.HasPrefix(resource, "task/") {
+		i := strings.LastIndex(resource, "/")
+		parts[5] = resource[:i+1] + hex.EncodeToString(r.sum("resource:" + resource[i+1:]))[:32]
+	}
+	return strings.Join(parts, ":")
+}
+
+// identifiers matches the ARNs, IDs and account IDs that Text redacts
+var identifiers = regexp.MustCompile(`arn:[a-z-]+:[a-z0-9-]+:[a-z0-9-]*:\d{12}:[A-Za-z0-9/_.:-]+|\b(?:i|mi|lt)-[0-9a-f]{8,17}\b|\b\d{12}\b`)
+
+// Text redacts the ARNs, IDs and account IDs found in free text, such as error messages and agent logs
+func (r *Redactor) Text(text string) string {
+	return identifiers.ReplaceAllStringFunc(text, func(match string) string {
+		switch {
+		case strings.HasPrefix(match, "arn:"):
+			return r.ARN(match)
+		case strings.Contains(match, "-"):
+			return r.ID(match)
+		}
+		return r.AccountID(match)
+	})
+}
+
+// Agents returns copies of the agents with their identifiers redacted. Their private IP and the raw
+// container instance are left out, and their tags and agent log redacted as text
+func (r *Redactor) Agents(agents []agentstatus.Agent) []agentstatus.Agent {
+	redacted := make([]agentstatus.Agent, len(agents))
+	for i, agent := range agents {
+		agent.AccountID = r.AccountID(agent.AccountID)
+		agent.ClusterARN = r.ARN(agent.ClusterARN)
+		agent.ContainerInstanceARN = r.ARN(agent.ContainerInstanceARN)
+		agent.EC2InstanceID = r.ID(agent.EC2InstanceID)
+		agent.ManagedInstanceID = r.ID(agent.ManagedInstanceID)
+		agent.LaunchTemplateID = r.ID(agent.LaunchTemplateID)
+		agent.PrivateIP, agent.Raw = "", nil
+		if agent.DuplicateRegistrations != nil {
+			agent.DuplicateRegistrations = make([]string, len(agents[i].DuplicateRegistrations))
+			for j, arn := range agents[i].DuplicateRegistrations {
+				agent.DuplicateRegistrations[j] = r.ARN(arn)
+			}
+		}
+		if agent.Tasks != nil {
+			agent.Tasks = slices.Clone(agent.Tasks)
+			for j := range agent.Tasks {
+				agent.Tasks[j].TaskARN = r.ARN(agent.Tasks[j].TaskARN)
+			}
+		}
+		if agent.Tags != nil {
+			agent.Tags = make(map[string]string, len(agents[i].Tags))
+			for key, value := range agents[i].Tags {
+				agent.Tags[key] = r.Text(value)
+			}
+		}
+		if agent.Attributes != nil {
+			agent.Attributes = make(map[string]string, len(agents[i].Attributes))
+			for name, value := range agents[i].Attributes {
+				agent.Attributes[name] = r.Text(value)
+			}
+		}
+		if agent.AgentLog != nil {
+			agent.AgentLog = make([]string, len(agents[i].AgentLog))
+			for j, line := range agents[i].AgentLog {
+				agent.AgentLog[j] = r.Text(line)
+			}
+		}
+		redacted[i] = agent
+	}
+	return redacted
+}
+
+// ScanErrors returns copies of the scan errors with their account and the identifiers in their message
+// redacted
+func (r *Redactor) ScanErrors(errs []ScanError) []ScanError {
+	redacted := slices.Clone(errs)
+	for i := range redacted {
+		redacted[i].AccountID = r.AccountID(redacted[i].AccountID)
+		redacted[i].Error = r.Text(redacted[i].Error)
+	}
+	return redacted
+}
+
+// Transitions returns copies of the transitions with their container instance and instance IDs redacted
+func (r *Redactor) Transitions(transitions []Transition) []Transition {
+	redacted := slices.Clone(transitions)
+	for i := range redacted {
+		redacted[i].ContainerInstanceARN = r.ARN(redacted[i].ContainerInstanceARN)
+		redacted[i].InstanceID = r.ID(redacted[i].InstanceID)
+	}
+	return redacted
+}
+
+// PolicyViolations returns copies of the policy violations with their account, container instance and
+// instance IDs redacted
+func (r *Redactor) PolicyViolations(violations []PolicyViolation) []PolicyViolation {
+	redacted := slices.Clone(violations)
+	for i := range redacted {
+		redacted[i].AccountID = r.AccountID(redacted[i].AccountID)
+		redacted[i].ContainerInstanceARN = r.ARN(redacted[i].ContainerInstanceARN)
+		redacted[i].EC2InstanceID = r.ID(redacted[i].EC2InstanceID)
+		redacted[i].Message = r.Text(redacted[i].Message)
+	}
+	return redacted
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor("secret")
+	agents := []agentstatus.Agent{{
+		AccountID:            "123456789012",
+		Cluster:              "web",
+		ClusterARN:           "arn:aws:ecs:us-east-1:123456789012:cluster/web",
+		ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/0123456789abcdef0123456789abcdef",
+		EC2InstanceID:        "i-0123456789abcdef0",
+		PrivateIP:            "10.0.0.1",
+		AgentLog:             []string{"registered instance i-0123456789abcdef0"},
+	}}
+	redacted := r.Agents(agents)[0]
+	if agents[0].EC2InstanceID != "i-0123456789abcdef0" {
+		t.Errorf("Agents() changed the agents: %v", agents[0].EC2InstanceID)
+	}
+	if !regexp.MustCompile(`^\d{12}$`).MatchString(redacted.AccountID) || redacted.AccountID == agents[0].AccountID {
+		t.Errorf("redacted AccountID = %q", redacted.AccountID)
+	}
+	if !regexp.MustCompile(`^i-[0-9a-f]{17}$`).MatchString(redacted.EC2InstanceID) || redacted.EC2InstanceID == agents[0].EC2InstanceID {
+		t.Errorf("redacted EC2InstanceID = %q", redacted.EC2InstanceID)
+	}
+	if want := "arn:aws:ecs:us-east-1:" + redacted.AccountID + ":cluster/web"; redacted.ClusterARN != want {
+		t.Errorf("redacted ClusterARN = %q, want %q", redacted.ClusterARN, want)
+	}
+	if strings.Contains(redacted.ContainerInstanceARN, "0123456789abcdef0123456789abcdef") || !strings.Contains(redacted.ContainerInstanceARN, ":container-instance/web/") {
+		t.Errorf("redacted ContainerInstanceARN = %q", redacted.ContainerInstanceARN)
+	}
+	if redacted.PrivateIP != "" {
+		t.Errorf("redacted PrivateIP = %q, want none", redacted.PrivateIP)
+	}
+	if want := "registered instance " + redacted.EC2InstanceID; redacted.AgentLog[0] != want {
+		t.Errorf("redacted AgentLog = %q, want %q", redacted.AgentLog[0], want)
+	}
+	if again := NewRedactor("secret").Agents(agents)[0]; again.ContainerInstanceARN != redacted.ContainerInstanceARN {
+		t.Errorf("redacting with the same key = %q, want %q", again.ContainerInstanceARN, redacted.ContainerInstanceARN)
+	}
+	if other := NewRedactor("").ID(agents[0].EC2InstanceID); other == redacted.EC2InstanceID {
+		t.Errorf("redacting with a random key = %q, the same as with the key", other)
+	}
+}
+
+func TestRedactPolicyViolations(t *testing.T) {
+	opts := Options{Redactor: NewRedactor("secret")}
+	violations := []PolicyViolation{{Rule: "current-agents", ClusterRef: ClusterRef{AccountID: "123456789012", Region: "us-east-1", Cluster: "web"},
+		EC2InstanceID: "i-0123456789abcdef0", Message: "ECS agent 1.75.0 is older than 1.80.0"}}
+	redacted := opts.outputPolicyViolations(violations)
+	agent := opts.redactAgents([]agentstatus.Agent{{AccountID: "123456789012", EC2InstanceID: "i-0123456789abcdef0"}})[0]
+	if redacted[0].EC2InstanceID != agent.EC2InstanceID || redacted[0].AccountID != agent.AccountID || violations[0].EC2InstanceID != "i-0123456789abcdef0" {
+		t.Errorf("outputPolicyViolations() = %+v, want the IDs redacted as in the agents", redacted[0])
+	}
+	var buf strings.Builder
+	policy := Policy{Rules: []PolicyRule{{Name: "current-agents", MinAgentVersion: "1.80.0"}}}
+	if err := WritePolicyResults(&buf, policy, redacted); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "i-0123456789abcdef0") {
+		t.Errorf("WritePolicyResults() of redacted violations = %q, has the instance ID", buf.String())
+	}
+}
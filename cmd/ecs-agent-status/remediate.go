@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/mattn/go-isatty"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// drainPollInterval is how often drained instances are checked for running tasks before termination
+const drainPollInterval = 15 * time.Second
+
+// EC2Terminator is the subset of the EC2 API used to terminate instances
+type EC2Terminator interface {
+	TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error)
+}
+
+// ASGHealthSetter is the subset of the Auto Scaling API used to mark instances unhealthy
+type ASGHealthSetter interface {
+	SetInstanceHealth(ctx context.Context, params *autoscaling.SetInstanceHealthInput, optFns ...func(*autoscaling.Options)) (*autoscaling.SetInstanceHealthOutput, error)
+}
+
+// RemediationTargets returns the agents to remediate: container instances backed by an EC2 instance whose
+// agent is disconnected, grouped by their key in checkers (the region, qualified by the account when
+// scanning several) and then cluster. Instances in a warm pool or waiting in a lifecycle hook are left
+// alone unless includeTransitions is set, as by --include-lifecycle-transitions
+func RemediationTargets(checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent, includeTransitions bool) map[string]map[string][]agentstatus.Agent {
+	targets := make(map[string]map[string][]agentstatus.Agent)
+	for _, agent := range agents {
+		// UNKNOWN agents could not be described, so their connectivity is not known
+		if agent.AgentConnected || agent.AgentStatus == "UNKNOWN" || agent.EC2InstanceID == "" {
+			continue
+		}
+		if agent.LifecycleTransition() && !includeTransitions {
+			continue
+		}
+		scope := scopeIn(checkers, agent.AccountID, agent.Region)
+		if targets[scope] == nil {
+			targets[scope] = make(map[string][]agentstatus.Agent)
+		}
+		targets[scope][agent.Cluster] = append(targets[scope][agent.Cluster], agent)
+	}
+	return targets
+}
+
+// Confirm writes prompt to w and reports whether the answer read from r is yes
+func Confirm(r io.Reader, w io.Writer, prompt string) bool {
+	fmt.Fprintf(w, "%v [y/N] ", prompt)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// confirmASGReplace asks on the terminal before marking the instances of targets unhealthy in their Auto
+// Scaling groups, unless --yes or --dry-run is given. Without a terminal to ask on, --yes is required
+func confirmASGReplace(targets map[string]map[string][]agentstatus.Agent, opts Options) error {
+	if opts.Yes || opts.DryRun {
+		return nil
+	}
+	count := 0
+	for _, clusters := range targets {
+		for _, agents := range clusters {
+			for _, agent := range agents {
+				if agent.AutoScalingGroup != "" {
+					count++
+				}
+			}
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return errors.New("--remediate asg-replace asks for confirmation on a terminal: pass --yes to replace the instances without asking")
+	}
+	if !Confirm(os.Stdin, os.Stderr, fmt.Sprintf("Drain %v instances with disconnected agents and have their Auto Scaling groups replace them?", count)) {
+		return errors.New("replacing the instances was not confirmed")
+	}
+	return nil
+}
+
+// Remediate drains the container instances with disconnected agents and, in terminate mode, terminates
+// their EC2 instances once they have no running tasks, waiting at most opts.DrainTimeout per cluster. In
+// asg-replace mode the instances are marked unhealthy in their Auto Scaling groups once drained, after a
+// confirmation. With opts.DryRun the actions are only logged
+func Remediate(ctx context.Context, cfgs map[string]aws.Config, checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent, opts Options) error {
+	remediationTargets := RemediationTargets(checkers, agents, opts.HealthPolicy.IncludeLifecycleTransitions)
+	if opts.Remediate == "asg-replace" {
+		if err := confirmASGReplace(remediationTargets, opts); err != nil {
+			return err
+		}
+	}
+	for region, clusters := range remediationTargets {
+		checker := checkers[region]
+		terminator := ec2.NewFromConfig(cfgs[region])
+		asg := autoscaling.NewFromConfig(cfgs[region])
+		for cluster, targets := range clusters {
+			if err := remediateCluster(ctx, checker, terminator, asg, cluster, targets, opts); err != nil {
+				return fmt.Errorf("region %v: %w", region, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ReplaceInstances marks the EC2 instances of targets unhealthy in their Auto Scaling groups, so the groups
+// replace them, respecting the health check grace period of each group. It returns the errors of the
+// instances that could not be marked
+func ReplaceInstances(ctx context.Context, asg ASGHealthSetter, cluster string, targets []agentstatus.Agent) error {
+	var errs []error
+	for _, agent := range targets {
+		_, err := asg.SetInstanceHealth(ctx, &autoscaling.SetInstanceHealthInput{
+			InstanceId:               aws.String(agent.EC2InstanceID),
+			HealthStatus:             aws.String("Unhealthy"),
+			ShouldRespectGracePeriod: aws.Bool(true),
+		})
+		auditLog.Record(ctx, NewAuditRecord(AuditASGReplace, agent, &AuditState{HealthStatus: "Unhealthy"}, err))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("set instance %v unhealthy in Auto Scaling group %v: %w", agent.EC2InstanceID, agent.AutoScalingGroup, err))
+			continue
+		}
+		logger.Warn().Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).Str("autoScalingGroup", agent.AutoScalingGroup).
+			Msgf("marked %v unhealthy for Auto Scaling group %v to replace it", agent.EC2InstanceID, agent.AutoScalingGroup)
+	}
+	return errors.Join(errs...)
+}
+
+// remediateCluster drains the targets in one cluster and optionally terminates them or has their Auto
+// Scaling groups replace them
+func remediateCluster(ctx context.Context, checker *agentstatus.StatusChecker, terminator EC2Terminator, asg ASGHealthSetter, cluster string, targets []agentstatus.Agent, opts Options) error {
+	if opts.Remediate == "asg-replace" {
+		var inGroup []agentstatus.Agent
+		for _, agent := range targets {
+			if agent.AutoScalingGroup == "" {
+				logger.Warn().Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).
+					Msgf("not replacing %v, which is not in an Auto Scaling group", agent.EC2InstanceID)
+				continue
+			}
+			inGroup = append(inGroup, agent)
+		}
+		targets = inGroup
+		if len(targets) == 0 {
+			return nil
+		}
+	}
+	var toDrain []string
+	var draining []agentstatus.Agent
+	arns := make([]string, 0, len(targets))
+	byARN := make(map[string]agentstatus.Agent)
+	for _, agent := range targets {
+		arns = append(arns, agent.ContainerInstanceARN)
+		byARN[agent.ContainerInstanceARN] = agent
+		if agent.AgentStatus == "ACTIVE" {
+			toDrain = append(toDrain, agent.ContainerInstanceARN)
+			draining = append(draining, agent)
+		}
+		action := "drain"
+		if agent.AgentStatus != "ACTIVE" {
+			action = "leave as " + agent.AgentStatus
+		}
+		switch opts.Remediate {
+		case "terminate":
+			action += " and terminate"
+		case "asg-replace":
+			action += " and have Auto Scaling group " + agent.AutoScalingGroup + " replace"
+		}
+		if opts.DryRun {
+			logger.Warn().Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).Bool("dryRun", true).
+				Msgf("dry run: would %v %v", action, agent.EC2InstanceID)
+		}
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	if len(toDrain) > 0 {
+		err := checker.DrainContainerInstances(ctx, cluster, toDrain)
+		for _, agent := range draining {
+			auditLog.Record(ctx, NewAuditRecord(AuditDrain, agent, &AuditState{AgentStatus: "DRAINING"}, err))
+		}
+		if err != nil {
+			return err
+		}
+		logger.Warn().Str("cluster", cluster).Msgf("set %v container instances with disconnected agents to DRAINING", len(toDrain))
+	}
+	if opts.Remediate == "asg-replace" {
+		return ReplaceInstances(ctx, asg, cluster, targets)
+	}
+	if opts.Remediate != "terminate" {
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.DrainTimeout)
+	defer cancel()
+	drained, err := checker.WaitForDrain(waitCtx, cluster, arns, drainPollInterval)
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+	if len(drained) < len(arns) {
+		logger.Warn().Str("cluster", cluster).Msgf("%v container instances still have running tasks after %v and will not be terminated", len(arns)-len(drained), opts.DrainTimeout)
+	}
+	if len(drained) == 0 {
+		return nil
+	}
+	var ids []string
+	for _, arn := range drained {
+		ids = append(ids, byARN[arn].EC2InstanceID)
+	}
+	output, err := terminator.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: ids})
+	instanceStates := make(map[string]string)
+	if output != nil {
+		for _, change := range output.TerminatingInstances {
+			if change.CurrentState != nil {
+				instanceStates[aws.ToString(change.InstanceId)] = string(change.CurrentState.Name)
+			}
+		}
+	}
+	for _, arn := range drained {
+		agent := byARN[arn]
+		auditLog.Record(ctx, NewAuditRecord(AuditTerminate, agent, &AuditState{InstanceState: instanceStates[agent.EC2InstanceID]}, err))
+	}
+	if err != nil {
+		return fmt.Errorf("terminate instances in cluster %v: %w", cluster, err)
+	}
+	logger.Warn().Str("cluster", cluster).Strs("ec2InstanceIds", ids).Msgf("terminated %v drained instances", len(ids))
+	return nil
+}
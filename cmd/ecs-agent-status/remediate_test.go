@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestRemediationTargets(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-connected", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-disconnected", AgentStatus: "ACTIVE"},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-draining", AgentStatus: "DRAINING"},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "UNKNOWN"},
+		{Region: "eu-west-1", Cluster: "batch", EC2InstanceID: "i-batch", AgentStatus: "ACTIVE"},
+	}
+	targets := RemediationTargets(nil, agents, false)
+	if got := targets["us-east-1"]["web"]; len(got) != 2 || got[0].EC2InstanceID != "i-disconnected" || got[1].EC2InstanceID != "i-draining" {
+		t.Errorf("RemediationTargets() us-east-1/web = %v", got)
+	}
+	if got := targets["eu-west-1"]["batch"]; len(got) != 1 {
+		t.Errorf("RemediationTargets() eu-west-1/batch = %v", got)
+	}
+}
+
+func TestRemediationTargetsLifecycleTransitions(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-warm", AgentStatus: "ACTIVE", LifecycleState: "Warmed:Running", WarmPool: true},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-pending", AgentStatus: "ACTIVE", LifecycleState: agentstatus.LifecycleStatePendingWait},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-terminating", AgentStatus: "ACTIVE", LifecycleState: agentstatus.LifecycleStateTerminatingWait},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-in-service", AgentStatus: "ACTIVE", LifecycleState: "InService"},
+	}
+	if got := RemediationTargets(nil, agents, false)["us-east-1"]["web"]; len(got) != 1 || got[0].EC2InstanceID != "i-in-service" {
+		t.Errorf("RemediationTargets() = %v, want only the InService instance", got)
+	}
+	if got := RemediationTargets(nil, agents, true)["us-east-1"]["web"]; len(got) != 4 {
+		t.Errorf("RemediationTargets() with transitions included = %v, want every instance", got)
+	}
+}
+
+// instanceHealthRecorder records the instances marked unhealthy and fails for i-fail
+type instanceHealthRecorder struct {
+	unhealthy []string
+}
+
+func (r *instanceHealthRecorder) SetInstanceHealth(_ context.Context, params *autoscaling.SetInstanceHealthInput, _ ...func(*autoscaling.Options)) (*autoscaling.SetInstanceHealthOutput, error) {
+	if aws.ToString(params.InstanceId) == "i-fail" {
+		return nil, errors.New("access denied")
+	}
+	if aws.ToString(params.HealthStatus) != "Unhealthy" || !aws.ToBool(params.ShouldRespectGracePeriod) {
+		return nil, fmt.Errorf("unexpected input %+v", params)
+	}
+	r.unhealthy = append(r.unhealthy, aws.ToString(params.InstanceId))
+	return &autoscaling.SetInstanceHealthOutput{}, nil
+}
+
+func TestReplaceInstances(t *testing.T) {
+	var asg instanceHealthRecorder
+	targets := []agentstatus.Agent{
+		{EC2InstanceID: "i-aaaa", AutoScalingGroup: "web-asg"},
+		{EC2InstanceID: "i-fail", AutoScalingGroup: "web-asg"},
+		{EC2InstanceID: "i-bbbb", AutoScalingGroup: "web-asg"},
+	}
+	err := ReplaceInstances(context.Background(), &asg, "web", targets)
+	if err == nil || !strings.Contains(err.Error(), "i-fail") {
+		t.Errorf("ReplaceInstances() error = %v, want the error of i-fail", err)
+	}
+	if want := []string{"i-aaaa", "i-bbbb"}; !reflect.DeepEqual(asg.unhealthy, want) {
+		t.Errorf("ReplaceInstances() marked %v unhealthy, want %v", asg.unhealthy, want)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	for answer, want := range map[string]bool{"y\n": true, "Yes\n": true, "n\n": false, "\n": false, "": false} {
+		var prompt bytes.Buffer
+		if got := Confirm(strings.NewReader(answer), &prompt, "Replace?"); got != want {
+			t.Errorf("Confirm() with answer %q = %v, want %v", answer, got, want)
+		}
+		if prompt.String() != "Replace? [y/N] " {
+			t.Errorf("Confirm() prompt = %q", prompt.String())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Renderer writes the agents of a check in an --output format
+type Renderer interface {
+	Render(w io.Writer, agents []agentstatus.Agent, opts Options) error
+}
+
+// rendererFunc is a function used as a Renderer
+type rendererFunc func(w io.Writer, agents []agentstatus.Agent, opts Options) error
+
+func (f rendererFunc) Render(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	return f(w, agents, opts)
+}
+
+// builtinFormats are the --output formats of check, in the order they are listed
+var builtinFormats = []string{"text", "table", "csv", "tsv", "json", "jsonl", "nagios", "html", "github", "yaml", "junit"}
+
+// renderers are the Renderers of builtinFormats
+var renderers = map[string]Renderer{
+	"text": rendererFunc(func(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+		WriteText(w, agents, opts)
+		return nil
+	}),
+	"table": rendererFunc(WriteTable),
+	"csv": rendererFunc(func(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+		return WriteCSVFields(w, agents, opts.Fields)
+	}),
+	"tsv":  rendererFunc(WriteTSV),
+	"json": rendererFunc(WriteJSON),
+	// Streamed jsonl output has already been written while scanning, so nothing is written for it here
+	"jsonl": rendererFunc(func(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+		if opts.streamJSONL() {
+			return nil
+		}
+		keys, groups := opts.groupAgents(agents)
+		for _, key := range keys {
+			if err := writeJSONLResult(w, key, groups[key], opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}),
+	// The run takes its exit code from the Nagios state, so it calls WriteNagios itself
+	"nagios": rendererFunc(func(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+		_, err := WriteNagios(w, agents, opts)
+		return err
+	}),
+	"html": rendererFunc(func(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+		return WriteHTML(w, agents, opts, time.Now())
+	}),
+	"github": rendererFunc(WriteGitHub),
+	"yaml":   rendererFunc(WriteYAML),
+	"junit": rendererFunc(func(w io.Writer, agents []agentstatus.Agent, _ Options) error {
+		return WriteJUnit(w, agents)
+	}),
+}
+
+// outputFormats returns the --output formats of check: the built-in ones, then those registered with
+// agentstatus.RegisterRenderer, sorted. A registered renderer named like a built-in format is not used
+func outputFormats() []string {
+	formats := slices.Clone(builtinFormats)
+	for _, name := range agentstatus.Renderers() {
+		if !slices.Contains(formats, name) {
+			formats = append(formats, name)
+		}
+	}
+	return formats
+}
+
+// lookupRenderer returns the Renderer of an --output format: a built-in one, or a registered
+// agentstatus.Renderer, which is given the --report of the agents
+func lookupRenderer(format string) (Renderer, bool) {
+	if renderer, ok := renderers[format]; ok {
+		return renderer, true
+	}
+	registered, ok := agentstatus.LookupRenderer(format)
+	if !ok {
+		return nil, false
+	}
+	return rendererFunc(func(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+		return registered.Render(w, newReportOutput(agents, opts, time.Now()).Report)
+	}), true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestOutputFormats(t *testing.T) {
+	for _, format := range builtinFormats {
+		if _, ok := lookupRenderer(format); !ok {
+			t.Errorf("lookupRenderer(%q) found no renderer for a built-in format", format)
+		}
+	}
+
+	agentstatus.RegisterRenderer("test-clusters", agentstatus.RendererFunc(func(w io.Writer, report agentstatus.Report) error {
+		for _, cluster := range report.Clusters {
+			if _, err := fmt.Fprintf(w, "%v=%v\n", cluster.Cluster, cluster.Instances); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	if formats := outputFormats(); !slices.Contains(formats, "test-clusters") || !slices.Equal(formats[:len(builtinFormats)], builtinFormats) {
+		t.Errorf("outputFormats() = %v, want the built-in formats and test-clusters", formats)
+	}
+	if err := ValidateOptions(Options{Output: "test-clusters", FormatArn: "short", LogFormat: "json", Retry: agentstatus.RetryOptions{MaxAttempts: 1}}); err != nil {
+		t.Errorf("ValidateOptions() of a registered output format = %v", err)
+	}
+	agents := []agentstatus.Agent{{Region: "us-east-1", Cluster: "web"}, {Region: "us-east-1", Cluster: "web"}, {Region: "us-east-1", Cluster: "batch"}}
+	var buf bytes.Buffer
+	if err := WriteOutput(&buf, agents, Options{Output: "test-clusters"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "batch=1\nweb=2\n"; buf.String() != want {
+		t.Errorf("WriteOutput() with a registered renderer = %q, want %q", buf.String(), want)
+	}
+	if err := WriteOutput(&buf, agents, Options{Output: "test-missing"}); err == nil {
+		t.Error("WriteOutput() of an unknown format returned no error")
+	}
+}
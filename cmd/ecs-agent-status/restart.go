@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+const (
+	// restartAgentCommand restarts the ECS agent on Amazon Linux 2 and 2023 hosts
+	restartAgentCommand = "systemctl restart ecs"
+	// restartWindowsAgentCommand restarts the ECS agent service on the ECS-optimized Windows Server hosts
+	restartWindowsAgentCommand = "Restart-Service AmazonECS"
+	// sendCommandBatchSize is the maximum number of instances SendCommand accepts per call
+	sendCommandBatchSize = 50
+	// restartCommandTimeout bounds how long to wait for the restart command on each instance
+	restartCommandTimeout = 5 * time.Minute
+	// reconnectPollInterval is how often restarted agents are re-checked
+	reconnectPollInterval = 10 * time.Second
+	// reconnectTimeout bounds how long to wait for restarted agents to reconnect
+	reconnectTimeout = 2 * time.Minute
+)
+
+// SSMCommander is the subset of the SSM API used to run the restart command
+type SSMCommander interface {
+	ssm.GetCommandInvocationAPIClient
+	SendCommand(ctx context.Context, params *ssm.SendCommandInput, optFns ...func(*ssm.Options)) (*ssm.SendCommandOutput, error)
+}
+
+// restartDocument returns the SSM document and command that restart the ECS agent on instances of osType:
+// a PowerShell script on Windows and a shell script otherwise
+func restartDocument(osType string) (string, string) {
+	if osType == agentstatus.OSTypeWindows {
+		return "AWS-RunPowerShellScript", restartWindowsAgentCommand
+	}
+	return "AWS-RunShellScript", restartAgentCommand
+}
+
+// RunRestartCommand restarts the ECS agent on the EC2 instances, all of osType, with SSM Run Command and
+// waits for the command to finish on each. It returns the instances where the command succeeded; failures
+// are logged
+func RunRestartCommand(ctx context.Context, client SSMCommander, instanceIDs []string, osType string) ([]string, error) {
+	document, command := restartDocument(osType)
+	var succeeded []string
+	waiter := ssm.NewCommandExecutedWaiter(client)
+	for start := 0; start < len(instanceIDs); start += sendCommandBatchSize {
+		batch := instanceIDs[start:min(start+sendCommandBatchSize, len(instanceIDs))]
+		output, err := client.SendCommand(ctx, &ssm.SendCommandInput{
+			DocumentName: aws.String(document),
+			InstanceIds:  batch,
+			Parameters:   map[string][]string{"commands": {command}},
+			Comment:      aws.String("ecs-agent-status: restart disconnected ECS agent"),
+		})
+		if err != nil {
+			return succeeded, fmt.Errorf("send restart command: %w", err)
+		}
+		for _, id := range batch {
+			err := waiter.Wait(ctx, &ssm.GetCommandInvocationInput{CommandId: output.Command.CommandId, InstanceId: aws.String(id)}, restartCommandTimeout)
+			if err != nil {
+				logger.Error().Err(err).Str("ec2InstanceId", id).Msgf("restarting the ECS agent on %v failed: %v", id, err)
+				continue
+			}
+			succeeded = append(succeeded, id)
+		}
+	}
+	return succeeded, nil
+}
+
+// RestartAgents restarts the disconnected agents with SSM Run Command, then re-checks them until they
+// reconnect or reconnectTimeout passes. It returns agents with the restarted ones replaced by their state
+// after the re-check. Agents in lifecycle transitions are only restarted with includeTransitions
+func RestartAgents(ctx context.Context, cfgs map[string]aws.Config, checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent, includeTransitions bool) ([]agentstatus.Agent, error) {
+	rechecked := make(map[string]agentstatus.Agent)
+	for region, clusters := range RemediationTargets(checkers, agents, includeTransitions) {
+		client := ssm.NewFromConfig(cfgs[region])
+		for cluster, targets := range clusters {
+			// Windows and Linux agents are restarted with different documents
+			idsByOS := make(map[string][]string)
+			arnByID := make(map[string]string)
+			byID := make(map[string]agentstatus.Agent)
+			for _, agent := range targets {
+				byID[agent.EC2InstanceID] = agent
+				osType := agent.OSType
+				if osType != agentstatus.OSTypeWindows {
+					osType = agentstatus.OSTypeLinux
+				}
+				idsByOS[osType] = append(idsByOS[osType], agent.EC2InstanceID)
+				arnByID[agent.EC2InstanceID] = agent.ContainerInstanceARN
+			}
+			var restarted []string
+			for _, osType := range []string{agentstatus.OSTypeLinux, agentstatus.OSTypeWindows} {
+				ids := idsByOS[osType]
+				if len(ids) == 0 {
+					continue
+				}
+				logger.Warn().Str("cluster", cluster).Strs("ec2InstanceIds", ids).Msgf("restarting %v disconnected %v ECS agents", len(ids), osType)
+				succeeded, err := RunRestartCommand(ctx, client, ids, osType)
+				restarted = append(restarted, succeeded...)
+				for _, id := range ids {
+					if slices.Contains(succeeded, id) {
+						continue
+					}
+					failure := err
+					if failure == nil {
+						failure = errors.New("the restart command failed")
+					}
+					auditLog.Record(ctx, NewAuditRecord(AuditRestartAgent, byID[id], nil, failure))
+				}
+				if err != nil {
+					return agents, fmt.Errorf("region %v: %w", region, err)
+				}
+			}
+			var arns []string
+			for _, id := range restarted {
+				arns = append(arns, arnByID[id])
+			}
+			after, err := waitForReconnect(ctx, checkers[region], cluster, arns)
+			if err != nil {
+				for _, id := range restarted {
+					auditLog.Record(ctx, NewAuditRecord(AuditRestartAgent, byID[id], nil, nil))
+				}
+				return agents, fmt.Errorf("region %v: %w", region, err)
+			}
+			for _, agent := range after {
+				auditLog.Record(ctx, NewAuditRecord(AuditRestartAgent, byID[agent.EC2InstanceID], agentAuditState(agent), nil))
+				rechecked[agent.ContainerInstanceARN] = agent
+				logger.Info().Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).Bool("agentConnected", agent.AgentConnected).
+					Msgf("after restart the agent on %v is %v (connected: %v)", agent.EC2InstanceID, agent.AgentStatus, agent.AgentConnected)
+			}
+		}
+	}
+	updated := make([]agentstatus.Agent, len(agents))
+	for i, agent := range agents {
+		updated[i] = agent
+		if after, ok := rechecked[agent.ContainerInstanceARN]; ok {
+			// The EC2 details do not change with a restart, so keep them rather than describing again
+			after.InstanceType, after.AvailabilityZone, after.LaunchTime = agent.InstanceType, agent.AvailabilityZone, agent.LaunchTime
+			after.PrivateIP, after.AutoScalingGroup = agent.PrivateIP, agent.AutoScalingGroup
+			updated[i] = after
+		}
+	}
+	return updated, nil
+}
+
+// waitForReconnect describes the container instances every reconnectPollInterval until all their agents are
+// connected or reconnectTimeout passes, and returns their last state
+func waitForReconnect(ctx context.Context, checker *agentstatus.StatusChecker, cluster string, arns []string) ([]agentstatus.Agent, error) {
+	if len(arns) == 0 {
+		return nil, nil
+	}
+	deadline := time.Now().Add(reconnectTimeout)
+	for {
+		output, err := checker.DescribeContainerInstances(ctx, cluster, arns)
+		if err != nil {
+			return nil, err
+		}
+		agents := agentstatus.AgentsFromDescribeOutput(cluster, output)
+		connected := 0
+		for i := range agents {
+			agents[i].Region = checker.Region
+			agents[i].AccountID = checker.AccountID
+			if agents[i].AgentConnected {
+				connected++
+			}
+		}
+		if connected == len(agents) || time.Now().After(deadline) {
+			return agents, nil
+		}
+		select {
+		case <-ctx.Done():
+			return agents, nil
+		case <-time.After(reconnectPollInterval):
+		}
+	}
+}
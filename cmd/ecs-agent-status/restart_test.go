@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+type mockSSM struct {
+	status   map[string]types.CommandInvocationStatus
+	commands []*ssm.SendCommandInput
+}
+
+func (m *mockSSM) SendCommand(_ context.Context, params *ssm.SendCommandInput, _ ...func(*ssm.Options)) (*ssm.SendCommandOutput, error) {
+	m.commands = append(m.commands, params)
+	return &ssm.SendCommandOutput{Command: &types.Command{CommandId: aws.String("command-1")}}, nil
+}
+
+func (m *mockSSM) GetCommandInvocation(_ context.Context, params *ssm.GetCommandInvocationInput, _ ...func(*ssm.Options)) (*ssm.GetCommandInvocationOutput, error) {
+	return &ssm.GetCommandInvocationOutput{Status: m.status[aws.ToString(params.InstanceId)]}, nil
+}
+
+func TestRunRestartCommand(t *testing.T) {
+	client := &mockSSM{status: map[string]types.CommandInvocationStatus{
+		"i-aaaa": types.CommandInvocationStatusSuccess,
+		"i-bbbb": types.CommandInvocationStatusFailed,
+	}}
+	succeeded, err := RunRestartCommand(context.Background(), client, []string{"i-aaaa", "i-bbbb"}, agentstatus.OSTypeLinux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(succeeded, []string{"i-aaaa"}) {
+		t.Errorf("RunRestartCommand() = %v, want [i-aaaa]", succeeded)
+	}
+	if len(client.commands) != 1 || !reflect.DeepEqual(client.commands[0].Parameters["commands"], []string{restartAgentCommand}) {
+		t.Errorf("RunRestartCommand() sent %v", client.commands)
+	}
+
+	client.commands = nil
+	if _, err := RunRestartCommand(context.Background(), client, []string{"i-aaaa"}, agentstatus.OSTypeWindows); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.commands) != 1 || aws.ToString(client.commands[0].DocumentName) != "AWS-RunPowerShellScript" ||
+		!reflect.DeepEqual(client.commands[0].Parameters["commands"], []string{restartWindowsAgentCommand}) {
+		t.Errorf("RunRestartCommand() on Windows sent %v", client.commands)
+	}
+}
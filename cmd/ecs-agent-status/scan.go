@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// defaultDiscoveryRegion is used to call DescribeRegions when the AWS config has no region
+const defaultDiscoveryRegion = "us-east-1"
+
+// ResolveRegions returns the regions to scan: every enabled region for --all-regions, otherwise the
+// regions given on the command line (which may be empty to use the AWS config's region)
+func ResolveRegions(ctx context.Context, opts Options) ([]string, error) {
+	if !opts.AllRegions {
+		return opts.Regions, nil
+	}
+	cfgs, err := LoadAWSConfigs(ctx, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, cfg := range cfgs {
+		if cfg.Region == "" {
+			cfg.Region = defaultDiscoveryRegion
+		}
+		return agentstatus.EnabledRegions(ctx, ec2.NewFromConfig(cfg))
+	}
+	return nil, nil
+}
+
+// SortedRegions returns the regions of the checkers in sorted order
+func SortedRegions(checkers map[string]*agentstatus.StatusChecker) []string {
+	regions := make([]string, 0, len(checkers))
+	for region := range checkers {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// ListRegionClusters lists the clusters matching any of patterns and none of exclude using mode in every
+// region concurrently. Regions without a match are left out of the returned map; other errors are returned
+// per region
+func ListRegionClusters(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, patterns, exclude []string, mode agentstatus.MatchMode) (map[string][]string, map[string]error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	clustersByRegion := make(map[string][]string)
+	errs := make(map[string]error)
+	for region, checker := range checkers {
+		wg.Add(1)
+		go func(region string, checker *agentstatus.StatusChecker) {
+			defer wg.Done()
+			refs, err := checker.ListClustersMatchingAny(ctx, patterns, mode)
+			if err == nil {
+				refs, err = agentstatus.ExcludeClusters(refs, exclude, mode)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, agentstatus.ErrNoClustersMatched):
+			case err != nil:
+				errs[region] = err
+			default:
+				for _, ref := range refs {
+					clustersByRegion[region] = append(clustersByRegion[region], ref.Name)
+				}
+			}
+		}(region, checker)
+	}
+	wg.Wait()
+	return clustersByRegion, errs
+}
+
+// ClusterCache keeps the clusters matched by ListRegionClusters for a refresh interval, so that the polls of
+// watch and serve do not list every cluster of every region each time. It is safe for concurrent use
+type ClusterCache struct {
+	refresh time.Duration
+	// list lists the matching clusters, ListRegionClusters outside of tests
+	list             func(context.Context, map[string]*agentstatus.StatusChecker, []string, []string, agentstatus.MatchMode) (map[string][]string, map[string]error)
+	mu               sync.Mutex
+	listed           time.Time
+	clustersByRegion map[string][]string
+}
+
+// NewClusterCache returns a ClusterCache listing the clusters again once refresh has passed, or nil (no
+// caching) if refresh is not positive
+func NewClusterCache(refresh time.Duration) *ClusterCache {
+	if refresh <= 0 {
+		return nil
+	}
+	return &ClusterCache{refresh: refresh, list: ListRegionClusters}
+}
+
+// List returns the clusters matching any of patterns and none of exclude in every region, from the cache
+// while it is fresh.
+// Only listings without errors are cached, so a region that failed is listed again on the next call. A nil
+// ClusterCache always lists
+func (c *ClusterCache) List(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, patterns, exclude []string, mode agentstatus.MatchMode) (map[string][]string, map[string]error) {
+	if c == nil {
+		return ListRegionClusters(ctx, checkers, patterns, exclude, mode)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clustersByRegion != nil && time.Since(c.listed) < c.refresh {
+		return c.clustersByRegion, nil
+	}
+	clustersByRegion, errs := c.list(ctx, checkers, patterns, exclude, mode)
+	if len(errs) == 0 && ctx.Err() == nil {
+		c.clustersByRegion, c.listed = clustersByRegion, time.Now()
+		logger.Debug().Dur("refresh", c.refresh).Msg("listed clusters, reusing the list until the next refresh")
+	}
+	return clustersByRegion, errs
+}
+
+// ScanRegions pre-checks the matched clusters of every region concurrently, then scans them with a single
+// pool of concurrency workers (1 if concurrency is less than 1) shared by all regions, so that --concurrency
+// bounds the clusters checked at once however many regions are scanned. The results are merged into one
+// channel that is closed when all regions are done. Clusters the pre-check finds without container
+// instances are sent with ErrNoContainerInstances, or ErrFargateOnly for those running on Fargate, without
+// being scanned, and clusters it skips are left out
+func ScanRegions(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, clustersByRegion map[string][]string, concurrency int) <-chan agentstatus.ClusterResult {
+	type job struct {
+		checker *agentstatus.StatusChecker
+		cluster string
+	}
+	merged := make(chan agentstatus.ClusterResult)
+	jobs := make(chan job)
+	var prechecks sync.WaitGroup
+	for region, clusters := range clustersByRegion {
+		prechecks.Add(1)
+		go func(checker *agentstatus.StatusChecker, clusters []string) {
+			defer prechecks.Done()
+			active, empty, err := checker.PrecheckClusterStatus(ctx, clusters)
+			if err != nil {
+				logger.Warn().Err(err).Str("region", checker.Region).Msg("cluster pre-check failed, scanning all matched clusters")
+				active = clusters
+			}
+			for _, cluster := range empty {
+				err := agentstatus.ErrNoContainerInstances
+				if cluster.FargateOnly {
+					err = agentstatus.ErrFargateOnly
+				}
+				merged <- agentstatus.ClusterResult{Region: checker.Region, AccountID: checker.AccountID, Cluster: cluster.Name, Err: err}
+			}
+			for _, cluster := range active {
+				select {
+				case jobs <- job{checker, cluster}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(checkers[region], clusters)
+	}
+	go func() {
+		prechecks.Wait()
+		close(jobs)
+	}()
+
+	var workers sync.WaitGroup
+	for range max(concurrency, 1) {
+		workers.Go(func() {
+			for job := range jobs {
+				agents, err := job.checker.GetAgentStatusForCluster(ctx, job.cluster)
+				merged <- agentstatus.ClusterResult{Region: job.checker.Region, AccountID: job.checker.AccountID, Cluster: job.cluster, Agents: agents, Err: err}
+			}
+		})
+	}
+	go func() {
+		// The workers only finish once jobs is closed, after every pre-check has sent its results
+		workers.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// ClusterRef identifies a cluster by its account, when scanning several, region and name
+type ClusterRef struct {
+	AccountID string `json:"accountId,omitempty"`
+	Region    string `json:"region"`
+	Cluster   string `json:"cluster"`
+}
+
+// ScanError is a region whose clusters could not be listed, or a cluster whose agents could not be checked
+type ScanError struct {
+	AccountID string `json:"accountId,omitempty"`
+	Region    string `json:"region"`
+	// Cluster is empty when the clusters of the region could not be listed
+	Cluster string `json:"cluster,omitempty"`
+	Error   string `json:"error"`
+}
+
+// sortScanErrors sorts errors by account, region and cluster
+func sortScanErrors(errs []ScanError) {
+	sort.Slice(errs, func(i, j int) bool {
+		a, b := errs[i], errs[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Cluster < b.Cluster
+	})
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestClusterCache(t *testing.T) {
+	calls := 0
+	var listErr error
+	cache := NewClusterCache(time.Hour)
+	cache.list = func(context.Context, map[string]*agentstatus.StatusChecker, []string, []string, agentstatus.MatchMode) (map[string][]string, map[string]error) {
+		calls++
+		if listErr != nil {
+			return nil, map[string]error{"us-east-1": listErr}
+		}
+		return map[string][]string{"us-east-1": {"web"}}, nil
+	}
+
+	listErr = errors.New("throttled")
+	if _, errs := cache.List(context.Background(), nil, []string{"web"}, nil, agentstatus.MatchSubstring); len(errs) != 1 {
+		t.Fatalf("List() errors = %v, want the listing error", errs)
+	}
+	listErr = nil
+	for i := 0; i < 3; i++ {
+		clusters, errs := cache.List(context.Background(), nil, []string{"web"}, nil, agentstatus.MatchSubstring)
+		if len(errs) != 0 || len(clusters["us-east-1"]) != 1 {
+			t.Fatalf("List() = %v, %v", clusters, errs)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("List() listed the clusters %v times, want 2: a failed listing is not cached, a successful one is", calls)
+	}
+
+	cache.listed = time.Now().Add(-2 * time.Hour)
+	cache.List(context.Background(), nil, []string{"web"}, nil, agentstatus.MatchSubstring)
+	if calls != 3 {
+		t.Errorf("List() after the refresh interval listed %v times in total, want 3", calls)
+	}
+	if NewClusterCache(0) != nil {
+		t.Error("NewClusterCache(0) is not nil")
+	}
+}
+
+// fleetECS is a fake ECS backend of generated clusters and container instances, answering every call after
+// a simulated API latency, for the benchmarks of the scan
+type fleetECS struct {
+	agentstatus.ECSClient
+	latency     time.Duration
+	clusterArns []string
+	// instances are the container instances of each cluster, by cluster name
+	instances map[string][]types.ContainerInstance
+	byArn     map[string]types.ContainerInstance
+	// describeCalls counts the DescribeContainerInstances calls
+	describeCalls atomic.Int64
+}
+
+// newFleetECS returns a fleetECS of the given number of clusters with instancesPerCluster container
+// instances each, one in twenty of them disconnected
+func newFleetECS(clusters, instancesPerCluster int, latency time.Duration) *fleetECS {
+	fleet := &fleetECS{latency: latency, instances: make(map[string][]types.ContainerInstance), byArn: make(map[string]types.ContainerInstance)}
+	n := 0
+	for c := 0; c < clusters; c++ {
+		name := fmt.Sprintf("cluster-%03d", c)
+		fleet.clusterArns = append(fleet.clusterArns, "arn:aws:ecs:us-east-1:123456789012:cluster/"+name)
+		for i := 0; i < instancesPerCluster; i++ {
+			n++
+			instance := types.ContainerInstance{
+				ContainerInstanceArn: aws.String(fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:container-instance/%v/%032x", name, n)),
+				Ec2InstanceId:        aws.String(fmt.Sprintf("i-%017x", n)),
+				Status:               aws.String("ACTIVE"),
+				AgentConnected:       n%20 != 0,
+				VersionInfo:          &types.VersionInfo{AgentVersion: aws.String(fmt.Sprintf("1.%v.0", 80+n%3)), DockerVersion: aws.String("25.0.8")},
+				RunningTasksCount:    int32(n % 7),
+				Attributes:           []types.Attribute{{Name: aws.String(agentstatus.OSTypeAttribute), Value: aws.String("linux")}},
+			}
+			fleet.instances[name] = append(fleet.instances[name], instance)
+			fleet.byArn[aws.ToString(instance.ContainerInstanceArn)] = instance
+		}
+	}
+	return fleet
+}
+
+// page returns the items of a page of at most 100 starting at the index in token, and the token of the next
+func page[T any](items []T, token *string) ([]T, *string) {
+	start, _ := strconv.Atoi(aws.ToString(token))
+	end := min(start+100, len(items))
+	if end == len(items) {
+		return items[start:end], nil
+	}
+	return items[start:end], aws.String(strconv.Itoa(end))
+}
+
+func (f *fleetECS) ListClusters(_ context.Context, params *ecs.ListClustersInput, _ ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+	time.Sleep(f.latency)
+	arns, next := page(f.clusterArns, params.NextToken)
+	return &ecs.ListClustersOutput{ClusterArns: arns, NextToken: next}, nil
+}
+
+func (f *fleetECS) DescribeClusters(_ context.Context, params *ecs.DescribeClustersInput, _ ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+	time.Sleep(f.latency)
+	output := &ecs.DescribeClustersOutput{}
+	for _, cluster := range params.Clusters {
+		name := agentstatus.ClusterNameFromArn(cluster)
+		output.Clusters = append(output.Clusters, types.Cluster{ClusterName: aws.String(name), Status: aws.String("ACTIVE"),
+			RegisteredContainerInstancesCount: int32(len(f.instances[name]))})
+	}
+	return output, nil
+}
+
+func (f *fleetECS) ListContainerInstances(_ context.Context, params *ecs.ListContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+	time.Sleep(f.latency)
+	instances, next := page(f.instances[agentstatus.ClusterNameFromArn(aws.ToString(params.Cluster))], params.NextToken)
+	output := &ecs.ListContainerInstancesOutput{NextToken: next}
+	for _, instance := range instances {
+		output.ContainerInstanceArns = append(output.ContainerInstanceArns, aws.ToString(instance.ContainerInstanceArn))
+	}
+	return output, nil
+}
+
+func (f *fleetECS) DescribeContainerInstances(_ context.Context, params *ecs.DescribeContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+	time.Sleep(f.latency)
+	if len(params.ContainerInstances) > 100 {
+		return nil, fmt.Errorf("DescribeContainerInstances of %v container instances, more than 100", len(params.ContainerInstances))
+	}
+	f.describeCalls.Add(1)
+	output := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range params.ContainerInstances {
+		output.ContainerInstances = append(output.ContainerInstances, f.byArn[arn])
+	}
+	return output, nil
+}
+
+// benchmarkScan scans a fleet of 10,000 container instances in clusters clusters, checking concurrency
+// clusters at a time and describing workers batches of container instances of a cluster at a time, against
+// fake APIs taking latency to answer
+func benchmarkScan(b *testing.B, clusters int, latency time.Duration, concurrency, workers int) {
+	fleet := newFleetECS(clusters, 10000/clusters, latency)
+	checker := agentstatus.NewStatusChecker(fleet, "us-east-1")
+	checker.DescribeWorkers = workers
+	checkers := map[string]*agentstatus.StatusChecker{"us-east-1": checker}
+	opts := Options{ClusterPatterns: []string{"cluster-"}, Concurrency: concurrency}
+	wantCalls := int64(clusters * ((10000/clusters + 99) / 100))
+	b.ReportAllocs()
+	for b.Loop() {
+		fleet.describeCalls.Store(0)
+		agents, _, _, err := Scan(context.Background(), checkers, opts, nil)
+		if err != nil || len(agents) != 10000 {
+			b.Fatalf("Scan() = %v agents, error %v, want 10000", len(agents), err)
+		}
+		if calls := fleet.describeCalls.Load(); calls != wantCalls {
+			b.Fatalf("Scan() made %v DescribeContainerInstances calls, want %v", calls, wantCalls)
+		}
+	}
+}
+
+// BenchmarkScan measures the CPU time and allocations of a scan of 500 clusters, with APIs answering at once
+func BenchmarkScan(b *testing.B) {
+	benchmarkScan(b, 500, 0, 4, 1)
+}
+
+// BenchmarkScanConcurrency measures how the time of a scan falls as more clusters are checked in parallel,
+// with APIs taking a millisecond to answer
+func BenchmarkScanConcurrency(b *testing.B) {
+	for _, concurrency := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("concurrency=%v", concurrency), func(b *testing.B) {
+			benchmarkScan(b, 500, time.Millisecond, concurrency, 1)
+		})
+	}
+}
+
+// BenchmarkScanLargeClusters scans 20 clusters of 500 container instances, each described in 5 batches,
+// with APIs taking a millisecond to answer, showing how the time falls as more batches of a cluster are
+// described in parallel
+func BenchmarkScanLargeClusters(b *testing.B) {
+	for _, workers := range []int{1, 2, 5} {
+		b.Run(fmt.Sprintf("workers=%v", workers), func(b *testing.B) {
+			benchmarkScan(b, 20, time.Millisecond, 4, workers)
+		})
+	}
+}
+
+// concurrencyECS is a fleetECS recording the most ListContainerInstances calls in progress at once, in
+// inFlight and maxInFlight shared between the fleets of several regions
+type concurrencyECS struct {
+	*fleetECS
+	inFlight, maxInFlight *atomic.Int64
+}
+
+func (c concurrencyECS) ListContainerInstances(ctx context.Context, params *ecs.ListContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for current := c.maxInFlight.Load(); n > current && !c.maxInFlight.CompareAndSwap(current, n); current = c.maxInFlight.Load() {
+	}
+	return c.fleetECS.ListContainerInstances(ctx, params, optFns...)
+}
+
+func TestScanRegionsSharedConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int64
+	checkers := make(map[string]*agentstatus.StatusChecker)
+	clustersByRegion := make(map[string][]string)
+	for _, region := range []string{"us-east-1", "eu-west-1", "ap-south-1"} {
+		fleet := newFleetECS(4, 1, 5*time.Millisecond)
+		checkers[region] = agentstatus.NewStatusChecker(concurrencyECS{fleet, &inFlight, &maxInFlight}, region)
+		for _, arn := range fleet.clusterArns {
+			clustersByRegion[region] = append(clustersByRegion[region], agentstatus.ClusterNameFromArn(arn))
+		}
+	}
+	results := 0
+	for result := range ScanRegions(context.Background(), checkers, clustersByRegion, 2) {
+		if result.Err != nil {
+			t.Errorf("ScanRegions() %v/%v error = %v", result.Region, result.Cluster, result.Err)
+		}
+		results++
+	}
+	if results != 12 {
+		t.Errorf("ScanRegions() = %v results, want 12", results)
+	}
+	if got := maxInFlight.Load(); got > 2 {
+		t.Errorf("ScanRegions() checked %v clusters at once across regions, want at most 2", got)
+	}
+}
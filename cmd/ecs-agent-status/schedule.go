@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// cronField is a field of a cron expression: the values it allows and their names, if any
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}},
+	// 7 is Sunday as well as 0, as in most crons
+	{name: "day of week", min: 0, max: 7, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}},
+}
+
+// cronDescriptors are the @ shorthands of common schedules
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// CronSchedule is a five-field cron expression, minute hour day-of-month month day-of-week, e.g. */5 * * * *,
+// in a time zone. As in cron, a day matches when either day field does if both are restricted
+type CronSchedule struct {
+	// fields has a bit set per value allowed by each field, in the order of cronFields
+	fields [5]uint64
+	// anyDayOfMonth and anyDayOfWeek record whether the day fields are *
+	anyDayOfMonth, anyDayOfWeek bool
+	Location                    *time.Location
+	text                        string
+}
+
+// ParseCronSchedule parses a cron expression of five fields, each *, a value, a range a-b, a step */n or
+// a-b/n, or a list of these separated by commas, or an @ shorthand such as @hourly. Months and days of the
+// week may be given by their three-letter names. Times are in UTC unless the expression starts with
+// CRON_TZ= and a time zone, e.g. CRON_TZ=Europe/Berlin 0 6 * * mon-fri
+func ParseCronSchedule(value string) (*CronSchedule, error) {
+	schedule := &CronSchedule{Location: time.UTC, text: value}
+	spec := strings.TrimSpace(value)
+	if rest, found := strings.CutPrefix(spec, "CRON_TZ="); found {
+		zone, expression, _ := strings.Cut(rest, " ")
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: unknown time zone %q", value, zone)
+		}
+		schedule.Location, spec = location, strings.TrimSpace(expression)
+	}
+	if expression, ok := cronDescriptors[spec]; ok {
+		spec = expression
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: must have 5 fields, minute hour day-of-month month day-of-week, e.g. */5 * * * *", value)
+	}
+	for i, field := range fields {
+		bits, err := cronFields[i].parse(strings.ToLower(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v: %w", value, cronFields[i].name, err)
+		}
+		schedule.fields[i] = bits
+	}
+	// Sunday is 0 and 7
+	if schedule.fields[4]&(1<<7) != 0 {
+		schedule.fields[4] |= 1
+	}
+	schedule.anyDayOfMonth, schedule.anyDayOfWeek = fields[2] == "*", fields[4] == "*"
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q: it never matches", value)
+	}
+	return schedule, nil
+}
+
+// parse returns the bits of the values a field of a cron expression allows
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		span, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+		low, high := f.min, f.max
+		switch first, last, isRange := strings.Cut(span, "-"); {
+		case span == "*":
+		case isRange:
+			var err error
+			if low, err = f.value(first); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(last); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q: %v is after %v", span, first, last)
+			}
+		default:
+			value, err := f.value(span)
+			if err != nil {
+				return 0, err
+			}
+			low, high = value, value
+			if hasStep {
+				high = f.max
+			}
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value returns a value of the field given as a number or a name
+func (f cronField) value(text string) (int, error) {
+	if value, ok := f.names[text]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("invalid value %q: must be from %v to %v", text, f.min, f.max)
+	}
+	return value, nil
+}
+
+func (s *CronSchedule) String() string {
+	return s.text
+}
+
+// matchesDay reports whether t is on a day of the schedule
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.fields[2]&(1<<t.Day()) != 0
+	dayOfWeek := s.fields[4]&(1<<int(t.Weekday())) != 0
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// Next returns the first time of the schedule after t, or the zero time if there is none in the next five
+// years, e.g. for February 30
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.Location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case s.fields[3]&(1<<int(month)) == 0:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, s.Location)
+		case !s.matchesDay(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, s.Location)
+		case s.fields[1]&(1<<t.Hour()) == 0:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, s.Location)
+		case s.fields[0]&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// nextPoll returns when the next scan of a daemon or serve polling on --schedule is due after now, and
+// whether it is a full scan: every scan is, unless --deep-schedule sets when they are and the others only
+// describe the container instances found by the last one again
+func nextPoll(now time.Time, opts Options) (time.Time, bool) {
+	next := opts.Schedule.Next(now)
+	if opts.DeepSchedule == nil {
+		return next, true
+	}
+	if deep := opts.DeepSchedule.Next(now); !deep.After(next) {
+		return deep, true
+	}
+	return next, false
+}
+
+// runPolls calls poll at once with a full scan, then every opts.Interval or, with --schedule, at each time
+// of the schedule, until ctx is cancelled
+func runPolls(ctx context.Context, opts Options, poll func(deep bool)) {
+	// --max-api-calls applies to each poll
+	budgeted := func(deep bool) {
+		apiBudget.Reset()
+		poll(deep)
+	}
+	budgeted(true)
+	if opts.Schedule == nil {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			budgeted(true)
+		}
+	}
+	for {
+		next, deep := nextPoll(time.Now(), opts)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		budgeted(deep)
+	}
+}
+
+// Redescribe describes the container instances of the agents again, without listing the clusters or their
+// container instances or looking up their EC2 instances, and returns the agents with their new state and
+// the EC2 details they had. Container instances that are no longer registered are left out
+func Redescribe(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent) ([]agentstatus.Agent, error) {
+	type clusterKey struct{ scope, cluster string }
+	var keys []clusterKey
+	byCluster := make(map[clusterKey][]agentstatus.Agent)
+	for _, agent := range agents {
+		if agent.ContainerInstanceARN == "" {
+			continue
+		}
+		key := clusterKey{scopeIn(checkers, agent.AccountID, agent.Region), agent.Cluster}
+		if byCluster[key] == nil {
+			keys = append(keys, key)
+		}
+		byCluster[key] = append(byCluster[key], agent)
+	}
+	var result []agentstatus.Agent
+	for _, key := range keys {
+		checker := checkers[key.scope]
+		if checker == nil {
+			result = append(result, byCluster[key]...)
+			continue
+		}
+		arns := make([]string, len(byCluster[key]))
+		for i, agent := range byCluster[key] {
+			arns[i] = agent.ContainerInstanceARN
+		}
+		output, err := checker.DescribeContainerInstances(ctx, key.cluster, arns)
+		if err != nil {
+			return nil, err
+		}
+		described := make(map[string]agentstatus.Agent)
+		for _, agent := range agentstatus.AgentsFromDescribeOutput(key.cluster, output) {
+			described[agent.ContainerInstanceARN] = agent
+		}
+		for _, agent := range byCluster[key] {
+			after, ok := described[agent.ContainerInstanceARN]
+			if !ok || after.AgentStatus == "UNKNOWN" || after.AgentStatus == "INACTIVE" {
+				continue
+			}
+			updateAgentState(&agent, after)
+			result = append(result, agent)
+		}
+	}
+	agentstatus.SetAges(result, time.Now())
+	agentstatus.SortByLocation(result)
+	return result, nil
+}
+
+// updateAgentState sets the state of the agent, its status, connection, agent version and tasks, to that of
+// after, a description of its container instance taken later, keeping the details found by the scan
+func updateAgentState(agent *agentstatus.Agent, after agentstatus.Agent) {
+	agent.AgentConnected, agent.AgentStatus = after.AgentConnected, after.AgentStatus
+	agent.AgentUpdateStatus, agent.AgentVersion = after.AgentUpdateStatus, valueOr(after.AgentVersion, agent.AgentVersion)
+	agent.RunningTasks, agent.PendingTasks = after.RunningTasks, after.PendingTasks
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, 5, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/5 * * * *", time.Date(2024, 5, 15, 10, 10, 0, 0, time.UTC)},
+		{"7 * * * *", time.Date(2024, 5, 15, 11, 7, 0, 0, time.UTC)},
+		{"0 6 * * mon-fri", time.Date(2024, 5, 16, 6, 0, 0, 0, time.UTC)},
+		{"30 2 * * 7", time.Date(2024, 5, 19, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either restricted day field matches
+		{"0 12 1 * fri", time.Date(2024, 5, 17, 12, 0, 0, 0, time.UTC)},
+		{"10-20/5 10 * * *", time.Date(2024, 5, 15, 10, 10, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=Europe/Berlin 0 13 * * *", time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCronSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCronSchedule(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(now); !got.Equal(tt.want) {
+			t.Errorf("ParseCronSchedule(%q).Next() = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 feb *", "CRON_TZ=Nowhere/Else * * * * *", "0 0 * foo *"} {
+		if _, err := ParseCronSchedule(spec); err == nil {
+			t.Errorf("ParseCronSchedule(%q) returned no error", spec)
+		}
+	}
+}
+
+func TestNextPoll(t *testing.T) {
+	schedule, _ := ParseCronSchedule("*/5 * * * *")
+	deep, _ := ParseCronSchedule("0 * * * *")
+	now := time.Date(2024, 5, 15, 10, 52, 0, 0, time.UTC)
+	if next, full := nextPoll(now, Options{Schedule: schedule}); !next.Equal(now.Add(3*time.Minute)) || !full {
+		t.Errorf("nextPoll() without --deep-schedule = %v, %v, want 10:55 full", next, full)
+	}
+	if next, full := nextPoll(now, Options{Schedule: schedule, DeepSchedule: deep}); !next.Equal(now.Add(3*time.Minute)) || full {
+		t.Errorf("nextPoll() before a full scan = %v, %v, want 10:55 shallow", next, full)
+	}
+	if next, full := nextPoll(now.Add(5*time.Minute), Options{Schedule: schedule, DeepSchedule: deep}); !next.Equal(now.Add(8*time.Minute)) || !full {
+		t.Errorf("nextPoll() at a full scan = %v, %v, want 11:00 full", next, full)
+	}
+}
+
+// stateECS describes its container instances with the status and connection given per ARN, and the ARNs
+// it does not know as MISSING failures
+type stateECS struct {
+	agentstatus.ECSClient
+	connected map[string]bool
+}
+
+func (m *stateECS) DescribeContainerInstances(_ context.Context, params *ecs.DescribeContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+	output := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range params.ContainerInstances {
+		connected, ok := m.connected[arn]
+		if !ok {
+			output.Failures = append(output.Failures, types.Failure{Arn: aws.String(arn), Reason: aws.String("MISSING")})
+			continue
+		}
+		output.ContainerInstances = append(output.ContainerInstances, types.ContainerInstance{
+			ContainerInstanceArn: aws.String(arn),
+			Status:               aws.String("ACTIVE"),
+			AgentConnected:       connected,
+			VersionInfo:          &types.VersionInfo{AgentVersion: aws.String("1.82.0")},
+		})
+	}
+	return output, nil
+}
+
+func TestRedescribe(t *testing.T) {
+	a, b := "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb"
+	client := &stateECS{connected: map[string]bool{a: false}}
+	checkers := map[string]*agentstatus.StatusChecker{"us-east-1": agentstatus.NewStatusChecker(client, "us-east-1")}
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: a, EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.80.0", InstanceType: "m5.large"},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: b, EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE", AgentConnected: true},
+	}
+	got, err := Redescribe(context.Background(), checkers, agents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Redescribe() = %v agents, want the registered one", len(got))
+	}
+	if got[0].AgentConnected || got[0].AgentVersion != "1.82.0" || got[0].InstanceType != "m5.large" || got[0].EC2InstanceID != "i-aaaa" {
+		t.Errorf("Redescribe() = %+v, want the new state with the EC2 details of the scan", got[0])
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// serverShutdownTimeout bounds how long in-flight scrapes may take to finish when the exporter stops
+const serverShutdownTimeout = 5 * time.Second
+
+// ScrapeInfo describes the most recent refresh of the exporter
+type ScrapeInfo struct {
+	Duration time.Duration
+	Time     time.Time
+	Success  bool
+	Errors   int
+	// ClusterErrors are the regions and clusters the last full scan could not check
+	ClusterErrors []ScanError
+}
+
+// Exporter holds the agents from the most recent scan and serves them in the Prometheus text format, and
+// as JSON on /status and /v1/agents
+type Exporter struct {
+	mu     sync.RWMutex
+	agents []agentstatus.Agent
+	scrape ScrapeInfo
+	policy agentstatus.HealthPolicy
+	// updated is when the scan of the exported agents started; it is zero until a scan succeeds
+	updated time.Time
+}
+
+// ServeStatus is the /status response of serve
+type ServeStatus struct {
+	Ready bool `json:"ready"`
+	// UpdatedAt is when the scan of the agents started, unset until a scan succeeds
+	UpdatedAt         *time.Time          `json:"updatedAt,omitempty"`
+	LastScrapeSuccess bool                `json:"lastScrapeSuccess"`
+	ScrapeErrors      int                 `json:"scrapeErrors"`
+	Summary           agentstatus.Summary `json:"summary"`
+	Agents            []agentstatus.Agent `json:"agents"`
+}
+
+// Refresh scans the clusters and replaces the exported agents. On failure the previous agents are kept and
+// the error counter is incremented. When only some regions or clusters fail, their previous agents are kept,
+// the others are replaced and the scan counts as failed
+func (e *Exporter) Refresh(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) {
+	start := time.Now()
+	pollCtx, cancel := WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	agents, _, scanErrs, err := Scan(pollCtx, checkers, opts, nil)
+	if err == nil {
+		// Keep the previous agents rather than export a scan cut short by its timeout
+		err = pollCtx.Err()
+	}
+	if errors.Is(err, agentstatus.ErrNoClustersMatched) {
+		logger.Warn().Err(err).Msgf("no clusters matching %q", opts.ClusterPatterns)
+		err = nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scrape.Duration = time.Since(start)
+	e.scrape.Time = start
+	e.scrape.Success = err == nil && len(scanErrs) == 0
+	if err != nil {
+		e.scrape.Errors++
+		logger.Error().Err(err).Msgf("error refreshing metrics: %v", err)
+		return
+	}
+	e.scrape.ClusterErrors = scanErrs
+	if len(scanErrs) > 0 {
+		e.scrape.Errors++
+		previous := make(map[string]agentstatus.Agent, len(e.agents))
+		for _, agent := range e.agents {
+			previous[agent.ContainerInstanceARN] = agent
+		}
+		agents = CarryOverFailed(previous, agents, scanErrs)
+		logger.Warn().Int("errors", len(scanErrs)).Msgf("keeping the previous agents of %v regions or clusters that could not be checked", len(scanErrs))
+	}
+	e.agents = agents
+	e.policy = opts.HealthPolicy
+	e.updated = start
+}
+
+// RefreshState describes the container instances of the exported agents again with Redescribe, a cheaper
+// poll than Refresh between its full scans, which keeps the EC2 details of the last one. Until a scan has
+// succeeded, it runs a full scan instead
+func (e *Exporter) RefreshState(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) {
+	e.mu.RLock()
+	previous, updated := e.agents, e.updated
+	e.mu.RUnlock()
+	if updated.IsZero() {
+		e.Refresh(ctx, checkers, opts)
+		return
+	}
+	start := time.Now()
+	pollCtx, cancel := WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	agents, err := Redescribe(pollCtx, checkers, slices.Clone(previous))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scrape.Duration = time.Since(start)
+	e.scrape.Time = start
+	e.scrape.Success = err == nil
+	if err != nil {
+		e.scrape.Errors++
+		logger.Error().Err(err).Msgf("error refreshing the state of the agents: %v", err)
+		return
+	}
+	if opts.MinAgentVersion != "" {
+		// Agents may have been updated since the full scan
+		for i := range agents {
+			agents[i].Outdated = false
+		}
+		agentstatus.MarkOutdated(agents, opts.MinAgentVersion)
+	}
+	e.agents = agents
+	e.updated = start
+}
+
+// poll refreshes the exported agents with a full scan when deep is set, and their state only otherwise
+func (e *Exporter) poll(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options, deep bool) {
+	if deep {
+		e.Refresh(ctx, checkers, opts)
+		return
+	}
+	e.RefreshState(ctx, checkers, opts)
+}
+
+// ServeHTTP writes the metrics for the most recent scan
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WriteMetrics(w, e.agents, e.scrape); err != nil {
+		logger.Error().Err(err).Msg("error writing metrics")
+	}
+}
+
+// ServeReady answers /readyz: 200 once a scan has succeeded, so there are results to serve, and 503 before
+func (e *Exporter) ServeReady(w http.ResponseWriter, _ *http.Request) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.updated.IsZero() {
+		http.Error(w, "not ready: no scan has succeeded yet", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// ServeStatus answers /status with the agents of the most recent successful scan and their summary as JSON
+func (e *Exporter) ServeStatus(w http.ResponseWriter, _ *http.Request) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(e.status()); err != nil {
+		logger.Error().Err(err).Msg("error writing status")
+	}
+}
+
+// status returns the /status response. The caller holds e.mu
+func (e *Exporter) status() ServeStatus {
+	status := ServeStatus{
+		Ready:             !e.updated.IsZero(),
+		LastScrapeSuccess: e.scrape.Success,
+		ScrapeErrors:      e.scrape.Errors,
+		Summary:           agentstatus.Summarize(e.agents, e.policy),
+		Agents:            e.agents,
+	}
+	if status.Ready {
+		updated := e.updated.UTC()
+		status.UpdatedAt = &updated
+	}
+	if status.Agents == nil {
+		status.Agents = []agentstatus.Agent{}
+	}
+	return status
+}
+
+// serveHealthz answers /healthz: 200 while the process is serving
+func serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// labelEscaper escapes backslashes, double quotes and newlines in Prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// agentLabels returns the Prometheus label set identifying an agent
+func agentLabels(agent agentstatus.Agent) string {
+	return fmt.Sprintf(`region="%v",cluster="%v",container_instance="%v",ec2_instance_id="%v"`,
+		escapeLabel(agent.Region), escapeLabel(agent.Cluster), escapeLabel(shortArn(agent.ContainerInstanceARN)), escapeLabel(agent.EC2InstanceID))
+}
+
+// boolGauge returns 1 for true and 0 for false
+func boolGauge(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// WriteMetrics writes the agents and scrape information to w in the Prometheus text exposition format
+func WriteMetrics(w io.Writer, agents []agentstatus.Agent, scrape ScrapeInfo) error {
+	var b strings.Builder
+	b.WriteString("# HELP ecs_agent_connected Whether the ECS agent on the container instance is connected (1) or not (0).\n")
+	b.WriteString("# TYPE ecs_agent_connected gauge\n")
+	for _, agent := range agents {
+		fmt.Fprintf(&b, "ecs_agent_connected{%v} %v\n", agentLabels(agent), boolGauge(agent.AgentConnected))
+	}
+	b.WriteString("# HELP ecs_agent_status The status of the container instance, 1 for the current status.\n")
+	b.WriteString("# TYPE ecs_agent_status gauge\n")
+	for _, agent := range agents {
+		fmt.Fprintf(&b, "ecs_agent_status{%v,status=\"%v\"} 1\n", agentLabels(agent), escapeLabel(agent.AgentStatus))
+	}
+	b.WriteString("# HELP ecs_agent_running_tasks The number of tasks running on the container instance.\n")
+	b.WriteString("# TYPE ecs_agent_running_tasks gauge\n")
+	for _, agent := range agents {
+		fmt.Fprintf(&b, "ecs_agent_running_tasks{%v} %v\n", agentLabels(agent), agent.RunningTasks)
+	}
+	b.WriteString("# HELP ecs_agent_status_scrape_duration_seconds How long the last scan of the clusters took.\n")
+	b.WriteString("# TYPE ecs_agent_status_scrape_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "ecs_agent_status_scrape_duration_seconds %v\n", scrape.Duration.Seconds())
+	b.WriteString("# HELP ecs_agent_status_last_scrape_timestamp_seconds When the last scan of the clusters started.\n")
+	b.WriteString("# TYPE ecs_agent_status_last_scrape_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "ecs_agent_status_last_scrape_timestamp_seconds %v\n", float64(scrape.Time.UnixMilli())/1000)
+	b.WriteString("# HELP ecs_agent_status_last_scrape_success Whether the last scan of the clusters succeeded.\n")
+	b.WriteString("# TYPE ecs_agent_status_last_scrape_success gauge\n")
+	fmt.Fprintf(&b, "ecs_agent_status_last_scrape_success %v\n", boolGauge(scrape.Success))
+	b.WriteString("# HELP ecs_agent_status_scrape_errors_total The number of scans of the clusters that failed.\n")
+	b.WriteString("# TYPE ecs_agent_status_scrape_errors_total counter\n")
+	fmt.Fprintf(&b, "ecs_agent_status_scrape_errors_total %v\n", scrape.Errors)
+	b.WriteString("# HELP ecs_agent_status_cluster_scrape_error Whether the last scan could not check the cluster, or the region when cluster is empty.\n")
+	b.WriteString("# TYPE ecs_agent_status_cluster_scrape_error gauge\n")
+	for _, scanErr := range scrape.ClusterErrors {
+		fmt.Fprintf(&b, "ecs_agent_status_cluster_scrape_error{region=\"%v\",cluster=\"%v\"} 1\n", escapeLabel(scanErr.Region), escapeLabel(scanErr.Cluster))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Serve exposes /metrics, /status, /v1/agents, /healthz and /readyz on addr, refreshing the exported agents every
+// opts.Interval or on --schedule, until ctx is cancelled
+func Serve(ctx context.Context, addr string, checkers map[string]*agentstatus.StatusChecker, opts Options) error {
+	exporter := &Exporter{}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	mux.HandleFunc("/status", exporter.ServeStatus)
+	mux.HandleFunc("/v1/agents", exporter.ServeAgents)
+	mux.HandleFunc("/healthz", serveHealthz)
+	mux.HandleFunc("/readyz", exporter.ServeReady)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go runPolls(ctx, opts, func(deep bool) { exporter.poll(ctx, checkers, opts, deep) })
+	if opts.eventsClient != nil {
+		go exporter.ConsumeEvents(ctx, opts.eventsClient, opts.EventsQueue, opts, nil)
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("error shutting down metrics server")
+		}
+	}()
+
+	logger.Info().Str("addr", addr).Msgf("serving metrics on %v/metrics", addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
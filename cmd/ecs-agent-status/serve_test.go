@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, RunningTasks: 3},
+		{Region: "us-east-1", Cluster: `we"b`, ContainerInstanceARN: "bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING"},
+	}
+	var buf bytes.Buffer
+	scrape := ScrapeInfo{Duration: 1500 * time.Millisecond, Time: time.Unix(1700000000, 0), Success: true, Errors: 2,
+		ClusterErrors: []ScanError{{Region: "eu-west-1", Cluster: "batch", Error: "ThrottlingException"}}}
+	if err := WriteMetrics(&buf, agents, scrape); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`ecs_agent_connected{region="us-east-1",cluster="web",container_instance="aaaa",ec2_instance_id="i-aaaa"} 1`,
+		`ecs_agent_connected{region="us-east-1",cluster="we\"b",container_instance="bbbb",ec2_instance_id="i-bbbb"} 0`,
+		`ecs_agent_status{region="us-east-1",cluster="web",container_instance="aaaa",ec2_instance_id="i-aaaa",status="ACTIVE"} 1`,
+		`ecs_agent_running_tasks{region="us-east-1",cluster="web",container_instance="aaaa",ec2_instance_id="i-aaaa"} 3`,
+		"ecs_agent_status_scrape_duration_seconds 1.5",
+		"ecs_agent_status_last_scrape_timestamp_seconds 1.7e+09",
+		"ecs_agent_status_last_scrape_success 1",
+		"ecs_agent_status_scrape_errors_total 2",
+		`ecs_agent_status_cluster_scrape_error{region="eu-west-1",cluster="batch"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("WriteMetrics() output is missing %q:\n%v", want, buf.String())
+		}
+	}
+}
+
+func TestExporterStatus(t *testing.T) {
+	exporter := &Exporter{}
+	recorder := httptest.NewRecorder()
+	exporter.ServeReady(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeReady() before a scan = %v, want %v", recorder.Code, http.StatusServiceUnavailable)
+	}
+	recorder = httptest.NewRecorder()
+	exporter.ServeStatus(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if body := recorder.Body.String(); !strings.Contains(body, `"ready":false`) || !strings.Contains(body, `"agents":[]`) {
+		t.Errorf("ServeStatus() before a scan = %v", body)
+	}
+
+	exporter.agents = []agentstatus.Agent{{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "DRAINING"}}
+	exporter.policy = agentstatus.DefaultHealthPolicy
+	exporter.updated = time.Unix(1700000000, 0)
+	recorder = httptest.NewRecorder()
+	exporter.ServeReady(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("ServeReady() after a scan = %v, want %v", recorder.Code, http.StatusOK)
+	}
+	recorder = httptest.NewRecorder()
+	exporter.ServeStatus(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status ServeStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Ready || status.UpdatedAt == nil || !status.UpdatedAt.Equal(exporter.updated) || status.Summary.Unhealthy != 1 || len(status.Agents) != 1 {
+		t.Errorf("ServeStatus() after a scan = %+v", status)
+	}
+}
+
+// failingECS is a fleetECS failing to list the container instances of cluster
+type failingECS struct {
+	*fleetECS
+	cluster string
+}
+
+func (f *failingECS) ListContainerInstances(ctx context.Context, params *ecs.ListContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+	if agentstatus.ClusterNameFromArn(aws.ToString(params.Cluster)) == f.cluster {
+		return nil, errors.New("ThrottlingException")
+	}
+	return f.fleetECS.ListContainerInstances(ctx, params, optFns...)
+}
+
+func TestExporterRefreshPartial(t *testing.T) {
+	client := &failingECS{fleetECS: newFleetECS(2, 2, 0)}
+	checkers := map[string]*agentstatus.StatusChecker{"us-east-1": agentstatus.NewStatusChecker(client, "us-east-1")}
+	opts := Options{ClusterPatterns: []string{"cluster-"}, Concurrency: 1}
+	exporter := &Exporter{}
+	exporter.Refresh(context.Background(), checkers, opts)
+	if len(exporter.agents) != 4 || !exporter.scrape.Success {
+		t.Fatalf("Refresh() = %v agents, success %v, want 4 and true", len(exporter.agents), exporter.scrape.Success)
+	}
+
+	// cluster-001 fails on the second scan: its agents are kept and the scan counts as failed
+	client.cluster = "cluster-001"
+	exporter.Refresh(context.Background(), checkers, opts)
+	if len(exporter.agents) != 4 {
+		t.Errorf("Refresh() with cluster-001 failing = %v agents, want 4", len(exporter.agents))
+	}
+	if exporter.scrape.Success || exporter.scrape.Errors != 1 {
+		t.Errorf("Refresh() with cluster-001 failing = success %v, %v errors, want false and 1", exporter.scrape.Success, exporter.scrape.Errors)
+	}
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf, exporter.agents, exporter.scrape); err != nil {
+		t.Fatal(err)
+	}
+	if want := `ecs_agent_status_cluster_scrape_error{region="us-east-1",cluster="cluster-001"} 1`; !strings.Contains(buf.String(), want+"\n") {
+		t.Errorf("WriteMetrics() output is missing %q:\n%v", want, buf.String())
+	}
+	if got := strings.Count(buf.String(), `ecs_agent_connected{region="us-east-1",cluster="cluster-001",`); got != 2 {
+		t.Errorf("WriteMetrics() has %v ecs_agent_connected series of cluster-001, want 2", got)
+	}
+}
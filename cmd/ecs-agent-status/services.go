@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// ScanServices lists the clusters matching the patterns in every region and returns their services, sorted
+// by account, region, cluster and name. Clusters are described opts.Concurrency at a time in each region. A
+// cluster whose services cannot be listed is logged and left out. ErrNoClustersMatched is returned when
+// nothing matches
+func ScanServices(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) ([]agentstatus.Service, error) {
+	clustersByRegion, listErrs := listClusters(ctx, checkers, opts)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var matched []string
+	for _, region := range SortedRegions(checkers) {
+		if err, ok := listErrs[region]; ok {
+			if len(checkers) == 1 {
+				return nil, err
+			}
+			logger.Warn().Err(err).Str("region", region).Msgf("error getting clusters in region %v: %v", region, err)
+		}
+		matched = append(matched, clustersByRegion[region]...)
+	}
+	if len(matched) == 0 {
+		return nil, agentstatus.ErrNoClustersMatched
+	}
+	if err := agentstatus.CheckMaxClusters(matched, opts.MaxClusters); err != nil {
+		return nil, err
+	}
+	logger.Info().Msgf("found %v matching clusters", len(matched))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var services []agentstatus.Service
+	for region, clusters := range clustersByRegion {
+		checker := checkers[region]
+		sem := make(chan struct{}, max(opts.Concurrency, 1))
+		for _, cluster := range clusters {
+			wg.Add(1)
+			go func(cluster string) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				result, err := checker.GetServicesForCluster(ctx, cluster)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Error().Err(err).Str("region", checker.Region).Msgf("error getting services for cluster %v: %v", cluster, err)
+					}
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				services = append(services, result...)
+			}(cluster)
+		}
+	}
+	wg.Wait()
+	sort.Slice(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.Name < b.Name
+	})
+	return services, nil
+}
+
+// BelowDesired returns the services running fewer tasks than they want
+func BelowDesired(services []agentstatus.Service) []agentstatus.Service {
+	var below []agentstatus.Service
+	for _, service := range services {
+		if service.BelowDesired() {
+			below = append(below, service)
+		}
+	}
+	return below
+}
+
+// FormatService returns the text output line of a service. With opts.Color set, the task counts of a
+// service below its desired count are printed in red
+func FormatService(service agentstatus.Service, opts Options) string {
+	counts := fmt.Sprintf("Desired: %v, Running: %v, Pending: %v", service.DesiredCount, service.RunningCount, service.PendingCount)
+	if opts.Color && service.BelowDesired() {
+		counts = ansiRed + counts + ansiReset
+	}
+	line := fmt.Sprintf("Region: %v, Cluster: %v, Service: %v, Status: %v, %v, Deployments: %v",
+		service.Region, service.Cluster, service.Name, service.Status, counts, len(service.Deployments))
+	if service.RolloutState != "" {
+		line += fmt.Sprintf(", RolloutState: %v", service.RolloutState)
+	}
+	if service.AccountID != "" {
+		line += fmt.Sprintf(", Account: %v", service.AccountID)
+	}
+	return line
+}
+
+// WriteServicesTable writes the services to w as a table with aligned columns. With opts.Color set, rows of
+// services below their desired count are printed in red
+func WriteServicesTable(w io.Writer, services []agentstatus.Service, opts Options) error {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tCLUSTER\tSERVICE\tSTATUS\tDESIRED\tRUNNING\tPENDING\tDEPLOYMENTS\tROLLOUT")
+	for _, service := range services {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", service.Region, service.Cluster, service.Name, service.Status,
+			service.DesiredCount, service.RunningCount, service.PendingCount, len(service.Deployments), service.RolloutState)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Color whole lines after alignment, since tabwriter would count the escape codes as cell width
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		if opts.Color && i > 0 && i <= len(services) && services[i-1].BelowDesired() {
+			line = ansiRed + strings.TrimSuffix(line, "\n") + ansiReset + "\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteServices writes the services to w in the --output format: text, table or json
+func WriteServices(w io.Writer, services []agentstatus.Service, opts Options) error {
+	switch opts.Output {
+	case "table":
+		return WriteServicesTable(w, services, opts)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if services == nil {
+			services = []agentstatus.Service{}
+		}
+		return encoder.Encode(services)
+	}
+	for _, service := range services {
+		if _, err := fmt.Fprintln(w, FormatService(service, opts)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runServices checks the services of the matching clusters and returns the exit code: ExitUnhealthy when any
+// service runs fewer tasks than it wants
+func runServices(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	services, err := ScanServices(ctx, checkers, opts)
+	if err != nil {
+		return scanErrorExitCode(ctx, err, opts)
+	}
+	if ctx.Err() != nil {
+		return cancelledExitCode(ctx, opts, "while getting services")
+	}
+
+	// Results go to stdout, or to a temporary file that replaces --output-file once the report is complete
+	var out io.Writer = os.Stdout
+	var outputFile *AtomicFile
+	if opts.OutputFile != "" {
+		if outputFile, err = CreateAtomicFile(opts.OutputFile); err != nil {
+			logger.Error().Err(err).Msgf("error creating output file %v", opts.OutputFile)
+			return ExitError
+		}
+		out = outputFile
+	}
+	if err := WriteServices(out, services, opts); err != nil {
+		if outputFile != nil {
+			outputFile.Abort()
+		}
+		logger.Error().Err(err).Msg("error writing output")
+		return ExitError
+	}
+	if outputFile != nil {
+		if err := outputFile.Commit(); err != nil {
+			logger.Error().Err(err).Msgf("error writing output file %v", opts.OutputFile)
+			return ExitError
+		}
+	}
+
+	below := BelowDesired(services)
+	for _, service := range below {
+		logger.Warn().Str("region", service.Region).Str("cluster", service.Cluster).Str("service", service.Name).
+			Msgf("service %v runs %v of %v desired tasks", service.Name, service.RunningCount, service.DesiredCount)
+	}
+	logger.Info().Int("services", len(services)).Int("belowDesired", len(below)).Int64("apiCalls", apiStats.Attempts()).
+		Int64("throttles", apiStats.Throttles()).Msgf("%v of %v services below desired count", len(below), len(services))
+	if len(below) > 0 {
+		return ExitUnhealthy
+	}
+	return ExitHealthy
+}
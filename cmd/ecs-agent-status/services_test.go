@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteServices(t *testing.T) {
+	services := []agentstatus.Service{
+		{Region: "us-east-1", Cluster: "production", Name: "api", Status: "ACTIVE", DesiredCount: 2, RunningCount: 2, RolloutState: "COMPLETED"},
+		{Region: "us-east-1", Cluster: "production", Name: "worker", Status: "ACTIVE", DesiredCount: 3, RunningCount: 1, PendingCount: 2, RolloutState: "IN_PROGRESS"},
+	}
+	if below := BelowDesired(services); len(below) != 1 || below[0].Name != "worker" {
+		t.Errorf("BelowDesired() = %v, want [worker]", below)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteServices(&buf, services, Options{Output: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Region: us-east-1, Cluster: production, Service: worker, Status: ACTIVE, Desired: 3, Running: 1, Pending: 2, Deployments: 0, RolloutState: IN_PROGRESS\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("WriteServices(text) =\n%v\nwant it to end with\n%v", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteServices(&buf, services, Options{Output: "table"}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], "REGION") {
+		t.Errorf("WriteServices(table) =\n%v", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteServices(&buf, nil, Options{Output: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []agentstatus.Service
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded == nil {
+		t.Errorf("WriteServices(json) without services = %q, want an empty array", buf.String())
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// sinkTimeFormat is the timestamp of a run in S3 object keys, sorting in time order
+const sinkTimeFormat = "20060102T150405Z"
+
+// dynamoDBAgentsMaxBytes is the most agent JSON written to one DynamoDB item, leaving room for the other
+// attributes under the 400 KB item limit
+const dynamoDBAgentsMaxBytes = 350 * 1024
+
+// SinkRecord is the result of a run for one cluster, as written to a --sink
+type SinkRecord struct {
+	// Key identifies the cluster as account/region/cluster, or region/cluster when the account is not known
+	Key       string                     `json:"key"`
+	Timestamp time.Time                  `json:"timestamp"`
+	AccountID string                     `json:"accountId,omitempty"`
+	Region    string                     `json:"region"`
+	Cluster   string                     `json:"cluster"`
+	Summary   agentstatus.ClusterSummary `json:"summary"`
+	Agents    []agentstatus.Agent        `json:"agents,omitempty"`
+}
+
+// SinkRecords returns a record per cluster of the agents, for a run at timestamp
+func SinkRecords(agents []agentstatus.Agent, timestamp time.Time) []SinkRecord {
+	keys, groups := agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string {
+		return ScopeKey(agent.AccountID, agent.Region) + "/" + agent.Cluster
+	})
+	records := make([]SinkRecord, 0, len(keys))
+	for _, key := range keys {
+		first := groups[key][0]
+		records = append(records, SinkRecord{
+			Key:       key,
+			Timestamp: timestamp.UTC(),
+			AccountID: first.AccountID,
+			Region:    first.Region,
+			Cluster:   first.Cluster,
+			Summary:   agentstatus.SummarizeClusters(groups[key])[0],
+			Agents:    groups[key],
+		})
+	}
+	return records
+}
+
+// Sink stores the results of each run
+type Sink interface {
+	Write(ctx context.Context, records []SinkRecord) error
+}
+
+// S3Putter is the subset of the S3 API used by S3Sink
+type S3Putter interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Sink writes each record as a JSON object named <prefix><key>/<timestamp>.json
+type S3Sink struct {
+	Client S3Putter
+	Bucket string
+	Prefix string
+}
+
+// Write puts an object per record
+func (s S3Sink) Write(ctx context.Context, records []SinkRecord) error {
+	for _, record := range records {
+		body, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		key := s.Prefix + record.Key + "/" + record.Timestamp.Format(sinkTimeFormat) + ".json"
+		_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.Bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return fmt.Errorf("put s3://%v/%v: %w", s.Bucket, key, err)
+		}
+	}
+	return nil
+}
+
+// DynamoDBPutter is the subset of the DynamoDB API used by DynamoDBSink
+type DynamoDBPutter interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBSink writes each record to a table whose partition key is key and sort key is timestamp, both
+// strings. The item at the timestamp of the run holds the counts of the cluster as top-level attributes, the
+// record without its agents as the JSON string attribute result and the number of parts. The agents are
+// split into that many items at <timestamp>#<part>, each with a JSON array of agents as the string attribute
+// agents, so that large clusters stay under the item size limit
+type DynamoDBSink struct {
+	Client DynamoDBPutter
+	Table  string
+}
+
+// Write puts the agent items and then the summary item of each record, so that a summary is only written
+// once all of its parts are
+func (s DynamoDBSink) Write(ctx context.Context, records []SinkRecord) error {
+	number := func(n int) dynamodbtypes.AttributeValue {
+		return &dynamodbtypes.AttributeValueMemberN{Value: strconv.Itoa(n)}
+	}
+	str := func(value string) dynamodbtypes.AttributeValue {
+		return &dynamodbtypes.AttributeValueMemberS{Value: value}
+	}
+	for _, record := range records {
+		timestamp := record.Timestamp.Format(time.RFC3339)
+		parts, err := splitAgentsJSON(record.Agents, dynamoDBAgentsMaxBytes)
+		if err != nil {
+			return err
+		}
+		for i, part := range parts {
+			err := s.put(ctx, record.Key, map[string]dynamodbtypes.AttributeValue{
+				"key":       str(record.Key),
+				"timestamp": str(fmt.Sprintf("%v#%04d", timestamp, i+1)),
+				"agents":    str(part),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		summary := record
+		summary.Agents = nil
+		result, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+		err = s.put(ctx, record.Key, map[string]dynamodbtypes.AttributeValue{
+			"key":          str(record.Key),
+			"timestamp":    str(timestamp),
+			"region":       str(record.Region),
+			"cluster":      str(record.Cluster),
+			"instances":    number(record.Summary.Instances),
+			"active":       number(record.Summary.Active),
+			"draining":     number(record.Summary.Draining),
+			"disconnected": number(record.Summary.Disconnected),
+			"parts":        number(len(parts)),
+			"result":       str(string(result)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put puts an item of the record with key into the table
+func (s DynamoDBSink) put(ctx context.Context, key string, item map[string]dynamodbtypes.AttributeValue) error {
+	_, err := s.Client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(s.Table), Item: item})
+	if err != nil {
+		return fmt.Errorf("put item %v into DynamoDB table %v: %w", key, s.Table, err)
+	}
+	return nil
+}
+
+// splitAgentsJSON encodes the agents as JSON arrays of at most maxBytes each. An agent larger than maxBytes
+// gets an array of its own
+func splitAgentsJSON(agents []agentstatus.Agent, maxBytes int) ([]string, error) {
+	var parts []string
+	var part bytes.Buffer
+	for _, agent := range agents {
+		encoded, err := json.Marshal(agent)
+		if err != nil {
+			return nil, err
+		}
+		if part.Len() > 0 && part.Len()+len(encoded)+2 > maxBytes {
+			parts = append(parts, part.String()+"]")
+			part.Reset()
+		}
+		if part.Len() == 0 {
+			part.WriteByte('[')
+		} else {
+			part.WriteByte(',')
+		}
+		part.Write(encoded)
+	}
+	if part.Len() > 0 {
+		parts = append(parts, part.String()+"]")
+	}
+	return parts, nil
+}
+
+// SinkTarget is a parsed --sink URL: s3://bucket/prefix/ or dynamodb://table, with an optional ?region=
+// query selecting the region of the bucket or table
+type SinkTarget struct {
+	Scheme string
+	// Name is the bucket or table
+	Name   string
+	Prefix string
+	Region string
+}
+
+// ParseSink parses a --sink URL
+func ParseSink(value string) (SinkTarget, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return SinkTarget{}, err
+	}
+	target := SinkTarget{Scheme: u.Scheme, Name: u.Host, Region: u.Query().Get("region")}
+	if target.Name == "" {
+		return target, fmt.Errorf("missing bucket or table name in %q", value)
+	}
+	switch u.Scheme {
+	case "s3":
+		target.Prefix = strings.TrimPrefix(u.Path, "/")
+		if target.Prefix != "" && !strings.HasSuffix(target.Prefix, "/") {
+			target.Prefix += "/"
+		}
+	case "dynamodb":
+		if strings.Trim(u.Path, "/") != "" {
+			return target, fmt.Errorf("unexpected path in %q: use dynamodb://table", value)
+		}
+	default:
+		return target, fmt.Errorf("unsupported sink %q: must be s3://bucket/prefix/ or dynamodb://table", value)
+	}
+	return target, nil
+}
+
+// WriteSinks writes the results of the run to every --sink. The sinks are written with the --profile
+// credentials rather than --role-arn, in the region of the sink URL or the default region. Every sink is
+// tried, and their errors are returned together
+func WriteSinks(ctx context.Context, opts Options, agents []agentstatus.Agent, now time.Time) error {
+	records := SinkRecords(agents, now)
+	var errs []error
+	for _, value := range opts.Sinks {
+		target, err := ParseSink(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var regions []string
+		if target.Region != "" {
+			regions = []string{target.Region}
+		}
+		cfgs, err := agentstatus.LoadAWSConfigs(ctx, regions, opts.Profile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var cfg aws.Config
+		for _, loaded := range cfgs {
+			cfg = agentstatus.WithRetries(agentstatus.WithEndpoint(loaded, opts.EndpointURL), opts.Retry)
+		}
+		var sink Sink = DynamoDBSink{Client: dynamodb.NewFromConfig(cfg), Table: target.Name}
+		if target.Scheme == "s3" {
+			sink = S3Sink{Client: s3.NewFromConfig(cfg), Bucket: target.Name, Prefix: target.Prefix}
+		}
+		if err := sink.Write(ctx, records); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info().Str("sink", value).Msgf("wrote %v cluster results to %v", len(records), value)
+	}
+	return errors.Join(errs...)
+}
+
+// firstSinkError returns the error of the first --sink URL that cannot be parsed
+func firstSinkError(sinks []string) error {
+	for _, value := range sinks {
+		if _, err := ParseSink(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
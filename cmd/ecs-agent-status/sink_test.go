@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+type mockS3 struct {
+	keys   []string
+	bodies [][]byte
+}
+
+func (m *mockS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.keys = append(m.keys, aws.ToString(params.Key))
+	m.bodies = append(m.bodies, body)
+	return &s3.PutObjectOutput{}, nil
+}
+
+type mockDynamoDB struct {
+	items []map[string]dynamodbtypes.AttributeValue
+}
+
+func (m *mockDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.items = append(m.items, params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+var sinkAgents = []agentstatus.Agent{
+	{AccountID: "123456789012", Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+	{AccountID: "123456789012", Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING"},
+	{Region: "eu-west-1", Cluster: "batch", EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE", AgentConnected: true},
+}
+
+func TestS3Sink(t *testing.T) {
+	client := &mockS3{}
+	now := time.Date(2024, 3, 1, 6, 30, 0, 0, time.UTC)
+	if err := (S3Sink{Client: client, Bucket: "fleet", Prefix: "ecs/"}).Write(context.Background(), SinkRecords(sinkAgents, now)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ecs/123456789012/us-east-1/web/20240301T063000Z.json", "ecs/eu-west-1/batch/20240301T063000Z.json"}
+	if len(client.keys) != 2 || client.keys[0] != want[0] || client.keys[1] != want[1] {
+		t.Errorf("S3Sink keys = %v, want %v", client.keys, want)
+	}
+	var record SinkRecord
+	if err := json.Unmarshal(client.bodies[0], &record); err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Agents) != 2 || record.Summary.Draining != 1 || !record.Timestamp.Equal(now) {
+		t.Errorf("S3Sink record = %+v", record)
+	}
+}
+
+func TestDynamoDBSink(t *testing.T) {
+	client := &mockDynamoDB{}
+	now := time.Date(2024, 3, 1, 6, 30, 0, 0, time.UTC)
+	if err := (DynamoDBSink{Client: client, Table: "fleet"}).Write(context.Background(), SinkRecords(sinkAgents, now)); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.items) != 4 {
+		t.Fatalf("DynamoDBSink wrote %v items, want an agents and a summary item per cluster", len(client.items))
+	}
+	if ts := client.items[0]["timestamp"].(*dynamodbtypes.AttributeValueMemberS).Value; ts != "2024-03-01T06:30:00Z#0001" {
+		t.Errorf("DynamoDBSink agents timestamp = %v", ts)
+	}
+	item := client.items[1]
+	if key := item["key"].(*dynamodbtypes.AttributeValueMemberS).Value; key != "123456789012/us-east-1/web" {
+		t.Errorf("DynamoDBSink key = %v", key)
+	}
+	if ts := item["timestamp"].(*dynamodbtypes.AttributeValueMemberS).Value; ts != "2024-03-01T06:30:00Z" {
+		t.Errorf("DynamoDBSink timestamp = %v", ts)
+	}
+	if n := item["instances"].(*dynamodbtypes.AttributeValueMemberN).Value; n != "2" {
+		t.Errorf("DynamoDBSink instances = %v, want 2", n)
+	}
+}
+
+func TestSplitAgentsJSON(t *testing.T) {
+	agents := make([]agentstatus.Agent, 50)
+	for i := range agents {
+		agents[i] = agentstatus.Agent{Cluster: "web", EC2InstanceID: fmt.Sprintf("i-%04d", i), AgentStatus: "ACTIVE"}
+	}
+	parts, err := splitAgentsJSON(agents, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	for _, part := range parts {
+		if len(part) > 1024 {
+			t.Errorf("splitAgentsJSON() part of %v bytes, want at most 1024", len(part))
+		}
+		var decoded []agentstatus.Agent
+		if err := json.Unmarshal([]byte(part), &decoded); err != nil {
+			t.Fatalf("splitAgentsJSON() part is not a JSON array: %v", err)
+		}
+		total += len(decoded)
+	}
+	if len(parts) < 2 || total != len(agents) {
+		t.Errorf("splitAgentsJSON() = %v parts of %v agents, want several parts of %v", len(parts), total, len(agents))
+	}
+}
+
+func TestParseSink(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SinkTarget
+		wantErr bool
+	}{
+		{value: "s3://fleet/ecs/agents", want: SinkTarget{Scheme: "s3", Name: "fleet", Prefix: "ecs/agents/"}},
+		{value: "s3://fleet", want: SinkTarget{Scheme: "s3", Name: "fleet"}},
+		{value: "dynamodb://fleet-health?region=eu-west-1", want: SinkTarget{Scheme: "dynamodb", Name: "fleet-health", Region: "eu-west-1"}},
+		{value: "dynamodb://fleet/extra", wantErr: true},
+		{value: "gs://fleet/", wantErr: true},
+		{value: "s3:///prefix", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSink(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseSink() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
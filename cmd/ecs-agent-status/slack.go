@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// slackMaxAgents caps the number of agents listed in a Slack message so large outages stay readable
+const slackMaxAgents = 50
+
+// SlackMessage is the JSON document posted to a Slack incoming webhook
+type SlackMessage struct {
+	Text string `json:"text"`
+}
+
+// NewSlackMessage summarizes a run for Slack: a headline with the number of unhealthy agents out of all
+// agents, followed by a code block listing the cluster, EC2 instance ID and status of each unhealthy agent
+func NewSlackMessage(agents, unhealthy []agentstatus.Agent) SlackMessage {
+	clusters, _ := agentstatus.GroupByCluster(agents)
+	if len(unhealthy) == 0 {
+		return SlackMessage{Text: fmt.Sprintf(":white_check_mark: *ecs-agent-status*: all %v agents in %v clusters are healthy", len(agents), len(clusters))}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, ":rotating_light: *ecs-agent-status*: %v of %v agents in %v clusters are unhealthy\n```\n", len(unhealthy), len(agents), len(clusters))
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tEC2 INSTANCE\tSTATUS\tCONNECTED")
+	for i, agent := range unhealthy {
+		if i == slackMaxAgents {
+			fmt.Fprintf(tw, "... and %v more\n", len(unhealthy)-slackMaxAgents)
+			break
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", agent.Cluster, agent.EC2InstanceID, agent.AgentStatus, agent.AgentConnected)
+	}
+	tw.Flush()
+	buf.WriteString("```")
+	return SlackMessage{Text: buf.String()}
+}
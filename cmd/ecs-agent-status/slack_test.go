@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestNewSlackMessage(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Cluster: "batch", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING", AgentConnected: true},
+	}
+	want := ":rotating_light: *ecs-agent-status*: 1 of 2 agents in 2 clusters are unhealthy\n```\n" +
+		"CLUSTER  EC2 INSTANCE  STATUS    CONNECTED\n" +
+		"batch    i-bbbb        DRAINING  true\n```"
+	if got := NewSlackMessage(agents, agents[1:]).Text; got != want {
+		t.Errorf("NewSlackMessage() =\n%v\nwant\n%v", got, want)
+	}
+	want = ":white_check_mark: *ecs-agent-status*: all 2 agents in 2 clusters are healthy"
+	if got := NewSlackMessage(agents, nil).Text; got != want {
+		t.Errorf("NewSlackMessage() healthy = %q, want %q", got, want)
+	}
+}
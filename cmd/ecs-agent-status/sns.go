@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// PublishSNS publishes the payload to the topic as a JSON message, with the first line of its text as the
+// subject
+func PublishSNS(ctx context.Context, client agentstatus.SNSPublisher, topicArn string, payload WebhookPayload) error {
+	subject, _, _ := strings.Cut(payload.Text, "\n")
+	return agentstatus.PublishSNS(ctx, client, topicArn, subject, payload)
+}
+
+// NotifySNS publishes a summary of the unhealthy agents to the topic, using the AWS config of the topic's
+// region, loading it if that region was not scanned
+func NotifySNS(ctx context.Context, cfgs map[string]aws.Config, opts Options, unhealthy []agentstatus.Agent) error {
+	topic, err := arn.Parse(opts.SNSTopicArn)
+	if err != nil {
+		return fmt.Errorf("invalid SNS topic ARN: %w", err)
+	}
+	cfg, ok := cfgs[topic.Region]
+	if !ok {
+		loaded, err := LoadAWSConfigs(ctx, []string{topic.Region}, opts)
+		if err != nil {
+			return err
+		}
+		cfg = loaded[topic.Region]
+	}
+	return PublishSNS(ctx, sns.NewFromConfig(cfg), opts.SNSTopicArn, NewWebhookPayload(unhealthy))
+}
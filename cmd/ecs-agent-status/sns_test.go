@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+type mockSNS struct {
+	input *sns.PublishInput
+}
+
+func (m *mockSNS) Publish(_ context.Context, params *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.input = params
+	return &sns.PublishOutput{}, nil
+}
+
+func TestPublishSNS(t *testing.T) {
+	client := &mockSNS{}
+	unhealthy := []agentstatus.Agent{{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "DRAINING"}}
+	topic := "arn:aws:sns:us-east-1:123456789012:ecs-alerts"
+	if err := PublishSNS(context.Background(), client, topic, NewWebhookPayload(unhealthy)); err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(client.input.TopicArn) != topic {
+		t.Errorf("PublishSNS() topic = %v, want %v", aws.ToString(client.input.TopicArn), topic)
+	}
+	if got := aws.ToString(client.input.Subject); got != "ecs-agent-status: 1 unhealthy agents in 1 clusters" {
+		t.Errorf("PublishSNS() subject = %q", got)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(aws.ToString(client.input.Message)), &payload); err != nil {
+		t.Fatalf("PublishSNS() message is not JSON: %v", err)
+	}
+	if len(payload.Unhealthy) != 1 || payload.Unhealthy[0].EC2InstanceID != "i-aaaa" {
+		t.Errorf("PublishSNS() message = %+v", payload)
+	}
+}
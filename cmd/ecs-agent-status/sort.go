@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// sortKeys are the --sort values
+var sortKeys = []string{"status", "cluster", "instance-id", "agent-version"}
+
+// SortAgents returns a copy of the agents ordered by a --sort key: status puts the agents that are unhealthy
+// under policy first, then the other agents that are not ACTIVE or not connected; cluster orders by account,
+// region, cluster and instance; instance-id by EC2 or managed instance ID; and agent-version from the oldest
+// ECS agent version. Agents that compare equal keep their order, and an empty key keeps every agent in place
+func SortAgents(agents []agentstatus.Agent, key string, policy agentstatus.HealthPolicy) []agentstatus.Agent {
+	sorted := slices.Clone(agents)
+	var less func(a, b agentstatus.Agent) bool
+	switch key {
+	case "status":
+		rank := func(agent agentstatus.Agent) int {
+			switch {
+			case policy.Unhealthy(agent):
+				return 0
+			case outputHealthPolicy.Unhealthy(agent):
+				return 1
+			}
+			return 2
+		}
+		less = func(a, b agentstatus.Agent) bool { return rank(a) < rank(b) }
+	case "cluster":
+		less = func(a, b agentstatus.Agent) bool { return agentstatus.CompareLocation(a, b) < 0 }
+	case "instance-id":
+		less = func(a, b agentstatus.Agent) bool { return a.InstanceID() < b.InstanceID() }
+	case "agent-version":
+		less = func(a, b agentstatus.Agent) bool {
+			return agentstatus.CompareVersions(a.AgentVersion, b.AgentVersion) < 0
+		}
+	default:
+		return sorted
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
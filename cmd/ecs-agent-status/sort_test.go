@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestSortAgents(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Cluster: "web", EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.79.0"},
+		{Cluster: "api", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE", AgentConnected: false, AgentVersion: "1.9.0"},
+		{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "DRAINING", AgentConnected: true, AgentVersion: "1.80.0"},
+		{Cluster: "api", EC2InstanceID: "i-dddd", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.79.0"},
+	}
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"", []string{"i-cccc", "i-bbbb", "i-aaaa", "i-dddd"}},
+		{"status", []string{"i-aaaa", "i-bbbb", "i-cccc", "i-dddd"}},
+		{"cluster", []string{"i-bbbb", "i-dddd", "i-aaaa", "i-cccc"}},
+		{"instance-id", []string{"i-aaaa", "i-bbbb", "i-cccc", "i-dddd"}},
+		{"agent-version", []string{"i-bbbb", "i-cccc", "i-dddd", "i-aaaa"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, agent := range SortAgents(agents, tt.key, agentstatus.DefaultHealthPolicy) {
+			got = append(got, agent.EC2InstanceID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SortAgents(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if agents[0].EC2InstanceID != "i-cccc" {
+		t.Errorf("SortAgents() reordered its argument: %v", agents)
+	}
+}
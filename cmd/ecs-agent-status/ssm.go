@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// describeInstanceInformationBatchSize is the maximum number of instance IDs an InstanceIds filter of
+// DescribeInstanceInformation accepts
+const describeInstanceInformationBatchSize = 50
+
+// SSMNotRegistered is the SSM ping status of instances that SSM does not know, e.g. because the SSM agent
+// is not installed or the instance profile does not allow it
+const SSMNotRegistered = "NotRegistered"
+
+// SSMOnline is the SSM ping status of instances whose SSM agent is connected
+const SSMOnline = string(types.PingStatusOnline)
+
+// SSMPingStatuses returns the SSM ping status (Online, ConnectionLost or Inactive) of each of the EC2 or
+// managed instances, or SSMNotRegistered for those SSM does not know
+func SSMPingStatuses(ctx context.Context, client ssm.DescribeInstanceInformationAPIClient, instanceIDs []string) (map[string]string, error) {
+	statuses := make(map[string]string, len(instanceIDs))
+	for _, id := range instanceIDs {
+		statuses[id] = SSMNotRegistered
+	}
+	for start := 0; start < len(instanceIDs); start += describeInstanceInformationBatchSize {
+		batch := instanceIDs[start:min(start+describeInstanceInformationBatchSize, len(instanceIDs))]
+		paginator := ssm.NewDescribeInstanceInformationPaginator(client, &ssm.DescribeInstanceInformationInput{
+			Filters: []types.InstanceInformationStringFilter{{Key: aws.String("InstanceIds"), Values: batch}},
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("describe instance information: %w", err)
+			}
+			for _, info := range output.InstanceInformationList {
+				statuses[aws.ToString(info.InstanceId)] = string(info.PingStatus)
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// CheckSSM sets the SSMPingStatus of every agent with an instance ID to the ping status of its instance in
+// SSM, calling DescribeInstanceInformation in the region, and account, of each agent. Agents in a region
+// whose statuses could not be read are left without one and the first error is returned
+func CheckSSM(ctx context.Context, cfgs map[string]aws.Config, agents []agentstatus.Agent) error {
+	idsByScope := make(map[string][]string)
+	for _, agent := range agents {
+		if id := agent.InstanceID(); id != "" {
+			scope := scopeIn(cfgs, agent.AccountID, agent.Region)
+			idsByScope[scope] = append(idsByScope[scope], id)
+		}
+	}
+	var firstErr error
+	for scope, ids := range idsByScope {
+		statuses, err := SSMPingStatuses(ctx, ssm.NewFromConfig(cfgs[scope]), ids)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("region %v: %w", scope, err)
+			}
+			continue
+		}
+		for i := range agents {
+			if status, ok := statuses[agents[i].InstanceID()]; ok && scopeIn(cfgs, agents[i].AccountID, agents[i].Region) == scope {
+				agents[i].SSMPingStatus = status
+			}
+		}
+	}
+	return firstErr
+}
+
+// LogSSMTriage logs how many disconnected agents are on instances that are still online in SSM, whose ECS
+// agent is likely at fault, and how many are on instances SSM cannot reach either, which are likely down
+func LogSSMTriage(agents []agentstatus.Agent) {
+	online, unreachable := 0, 0
+	for _, agent := range agents {
+		if agent.AgentConnected || agent.SSMPingStatus == "" {
+			continue
+		}
+		if agent.SSMPingStatus == SSMOnline {
+			online++
+		} else {
+			unreachable++
+		}
+	}
+	logger.Info().Int("disconnectedOnlineInSSM", online).Int("disconnectedUnreachable", unreachable).
+		Msgf("%v disconnected agents are on instances online in SSM, %v on instances SSM cannot reach", online, unreachable)
+}
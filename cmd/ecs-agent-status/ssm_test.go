@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// mockSSMInformation answers DescribeInstanceInformation with the instances of its filter it knows
+type mockSSMInformation struct {
+	pingStatus map[string]types.PingStatus
+	calls      int
+}
+
+func (m *mockSSMInformation) DescribeInstanceInformation(_ context.Context, params *ssm.DescribeInstanceInformationInput, _ ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	m.calls++
+	output := &ssm.DescribeInstanceInformationOutput{}
+	for _, id := range params.Filters[0].Values {
+		if status, ok := m.pingStatus[id]; ok {
+			output.InstanceInformationList = append(output.InstanceInformationList, types.InstanceInformation{InstanceId: aws.String(id), PingStatus: status})
+		}
+	}
+	return output, nil
+}
+
+func TestSSMPingStatuses(t *testing.T) {
+	client := &mockSSMInformation{pingStatus: map[string]types.PingStatus{
+		"i-aaaa":  types.PingStatusOnline,
+		"i-bbbb":  types.PingStatusConnectionLost,
+		"mi-cccc": types.PingStatusOnline,
+	}}
+	ids := []string{"i-aaaa", "i-bbbb", "mi-cccc", "i-dddd"}
+	for i := 0; i < describeInstanceInformationBatchSize; i++ {
+		ids = append(ids, "i-filler")
+	}
+	got, err := SSMPingStatuses(context.Background(), client, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"i-aaaa": "Online", "i-bbbb": "ConnectionLost", "mi-cccc": "Online", "i-dddd": SSMNotRegistered, "i-filler": SSMNotRegistered}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SSMPingStatuses() = %v, want %v", got, want)
+	}
+	if client.calls != 2 {
+		t.Errorf("SSMPingStatuses() made %v calls for %v instances, want 2", client.calls, len(ids))
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// Transition types reported by --state-file
+const (
+	TransitionDisconnected = "disconnected"
+	TransitionRecovered    = "recovered"
+	TransitionRegistered   = "registered"
+	TransitionDeregistered = "deregistered"
+)
+
+// AgentState is the last observed state of a container instance, as kept in the state file
+type AgentState struct {
+	Region         string `json:"region"`
+	Cluster        string `json:"cluster"`
+	InstanceID     string `json:"instanceId"`
+	AgentStatus    string `json:"agentStatus"`
+	AgentConnected bool   `json:"agentConnected"`
+	// DisconnectedSince is when the agent was first seen disconnected, while it is
+	DisconnectedSince *time.Time `json:"disconnectedSince,omitempty"`
+}
+
+// State is the content of the state file: the agents observed by the previous run, keyed by container
+// instance ARN
+type State struct {
+	Time   time.Time             `json:"time"`
+	Agents map[string]AgentState `json:"agents"`
+}
+
+// Transition is a change of a container instance between two runs
+type Transition struct {
+	Type                 string `json:"type"`
+	ContainerInstanceARN string `json:"containerInstanceArn"`
+	AgentState
+}
+
+// NewState returns the state of the agents at now
+func NewState(agents []agentstatus.Agent, now time.Time) State {
+	state := State{Time: now, Agents: make(map[string]AgentState)}
+	for _, agent := range agents {
+		state.Agents[agent.ContainerInstanceARN] = AgentState{
+			Region:            agent.Region,
+			Cluster:           agent.Cluster,
+			InstanceID:        agent.InstanceID(),
+			AgentStatus:       agent.AgentStatus,
+			AgentConnected:    agent.AgentConnected,
+			DisconnectedSince: agent.DisconnectedSince,
+		}
+	}
+	return state
+}
+
+// SetDisconnectDurations sets the DisconnectedSince and DisconnectedForSeconds of the disconnected agents
+// at now: an agent already disconnected in the previous state keeps its time, or gets the time of the
+// previous run if that state did not record it. An agent first seen disconnected now gets now
+func SetDisconnectDurations(agents []agentstatus.Agent, previous State, now time.Time) {
+	for i, agent := range agents {
+		if agent.AgentConnected {
+			continue
+		}
+		since := now
+		if before, ok := previous.Agents[agent.ContainerInstanceARN]; ok && !before.AgentConnected {
+			switch {
+			case before.DisconnectedSince != nil:
+				since = *before.DisconnectedSince
+			case !previous.Time.IsZero():
+				since = previous.Time
+			}
+		}
+		agents[i].DisconnectedSince = &since
+		agents[i].DisconnectedForSeconds = int64(now.Sub(since) / time.Second)
+	}
+}
+
+// LoadState reads the state file at path. A missing file returns an empty state, as on the first run
+func LoadState(path string) (State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// SaveState replaces the state file at path with state
+func SaveState(path string, state State) error {
+	f, err := CreateAtomicFile(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(state); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// Transitions compares the previous state with the current one and returns the agents that disconnected,
+// recovered (reconnected), registered or deregistered, sorted by region, cluster and ARN. Deregistrations
+// are only reported in clusters present in current, so a cluster that failed to scan is not reported as
+// having lost its instances. A previous state without agents, as on the first run, has no transitions
+func Transitions(previous, current State) []Transition {
+	if len(previous.Agents) == 0 {
+		return nil
+	}
+	var transitions []Transition
+	scanned := make(map[string]bool)
+	for arn, now := range current.Agents {
+		scanned[now.Region+"/"+now.Cluster] = true
+		before, ok := previous.Agents[arn]
+		switch {
+		case !ok:
+			transitions = append(transitions, Transition{TransitionRegistered, arn, now})
+		case before.AgentConnected && !now.AgentConnected:
+			transitions = append(transitions, Transition{TransitionDisconnected, arn, now})
+		case !before.AgentConnected && now.AgentConnected:
+			transitions = append(transitions, Transition{TransitionRecovered, arn, now})
+		}
+	}
+	for arn, before := range previous.Agents {
+		if _, ok := current.Agents[arn]; !ok && scanned[before.Region+"/"+before.Cluster] {
+			transitions = append(transitions, Transition{TransitionDeregistered, arn, before})
+		}
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		a, b := transitions[i], transitions[j]
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.ContainerInstanceARN < b.ContainerInstanceARN
+	})
+	return transitions
+}
+
+// WriteTransitions writes the transitions as a text section headed with the time of the previous run
+func WriteTransitions(w io.Writer, transitions []Transition, since time.Time, opts Options) error {
+	if _, err := fmt.Fprintf(w, "\nTransitions since %v:\n", since.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	if len(transitions) == 0 {
+		_, err := fmt.Fprintln(w, "  none")
+		return err
+	}
+	for _, transition := range transitions {
+		arn := transition.ContainerInstanceARN
+		if opts.FormatArn == "short" {
+			arn = shortArn(arn)
+		}
+		if _, err := fmt.Fprintf(w, "  %v: Region: %v, Cluster: %v, ContainerInstanceARN: %v, InstanceID: %v, AgentStatus: %v, AgentConnected: %v\n",
+			transition.Type, transition.Region, transition.Cluster, arn, transition.InstanceID, transition.AgentStatus, transition.AgentConnected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
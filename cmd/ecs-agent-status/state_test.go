@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestTransitions(t *testing.T) {
+	then := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	previous := NewState([]agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE", AgentConnected: false},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/cccc", EC2InstanceID: "i-cccc", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "api", ContainerInstanceARN: "arn/api/eeee", EC2InstanceID: "i-eeee", AgentStatus: "ACTIVE", AgentConnected: true},
+	}, then)
+	current := NewState([]agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: false},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/dddd", EC2InstanceID: "i-dddd", AgentStatus: "ACTIVE", AgentConnected: true},
+	}, then.Add(time.Hour))
+
+	var got []string
+	for _, transition := range Transitions(previous, current) {
+		got = append(got, transition.Type+" "+transition.InstanceID)
+	}
+	// The api cluster was not scanned, so its instance is not reported as deregistered
+	want := []string{"disconnected i-aaaa", "recovered i-bbbb", "deregistered i-cccc", "registered i-dddd"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Transitions() = %v, want %v", got, want)
+	}
+	if got := Transitions(State{}, current); got != nil {
+		t.Errorf("Transitions() without a previous state = %v, want none", got)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTransitions(&buf, Transitions(previous, current), then, Options{FormatArn: "long"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "\nTransitions since 2023-12-01T12:00:00Z:\n  disconnected: ") {
+		t.Errorf("WriteTransitions() = %q", buf.String())
+	}
+}
+
+func TestSaveLoadState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "agents.json")
+	if state, err := LoadState(path); err != nil || len(state.Agents) != 0 {
+		t.Fatalf("LoadState() of a missing file = %v, %v, want an empty state", state, err)
+	}
+	state := NewState([]agentstatus.Agent{{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn/web/aaaa", AgentStatus: "ACTIVE"}},
+		time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC))
+	if err := SaveState(path, state); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("LoadState() = %+v, want %+v", loaded, state)
+	}
+}
+
+func TestSetDisconnectDurations(t *testing.T) {
+	then := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	now := then.Add(10 * time.Minute)
+	earlier := then.Add(-time.Hour)
+	previous := State{Time: then, Agents: map[string]AgentState{
+		"arn:still":  {AgentConnected: false, DisconnectedSince: &earlier},
+		"arn:legacy": {AgentConnected: false},
+		"arn:new":    {AgentConnected: true},
+	}}
+	agents := []agentstatus.Agent{
+		{ContainerInstanceARN: "arn:still"},
+		{ContainerInstanceARN: "arn:legacy"},
+		{ContainerInstanceARN: "arn:new"},
+		{ContainerInstanceARN: "arn:ok", AgentConnected: true},
+	}
+	SetDisconnectDurations(agents, previous, now)
+	want := []struct {
+		since   *time.Time
+		seconds int64
+	}{{&earlier, 4200}, {&then, 600}, {&now, 0}, {nil, 0}}
+	for i, agent := range agents {
+		if !reflect.DeepEqual(agent.DisconnectedSince, want[i].since) || agent.DisconnectedForSeconds != want[i].seconds {
+			t.Errorf("%v: DisconnectedSince = %v, DisconnectedForSeconds = %v, want %v, %v", agent.ContainerInstanceARN,
+				agent.DisconnectedSince, agent.DisconnectedForSeconds, want[i].since, want[i].seconds)
+		}
+	}
+	if state := NewState(agents, now); !reflect.DeepEqual(state.Agents["arn:still"].DisconnectedSince, &earlier) {
+		t.Errorf("NewState() kept DisconnectedSince %v, want %v", state.Agents["arn:still"].DisconnectedSince, earlier)
+	}
+}
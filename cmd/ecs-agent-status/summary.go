@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// clusterSummaryUnhealthy reports whether a cluster has agents that are not ACTIVE or not connected
+func clusterSummaryUnhealthy(summary agentstatus.ClusterSummary) bool {
+	return summary.Active < summary.Instances || summary.Disconnected > 0
+}
+
+// FormatClusterSummary returns the text output line of a cluster summary. With opts.Color set, the counts of
+// a cluster with agents that are not ACTIVE or not connected are printed in red
+func FormatClusterSummary(summary agentstatus.ClusterSummary, opts Options) string {
+	counts := fmt.Sprintf("Instances: %v, Active: %v, Draining: %v, Disconnected: %v", summary.Instances, summary.Active, summary.Draining, summary.Disconnected)
+	if opts.Color && clusterSummaryUnhealthy(summary) {
+		counts = ansiRed + counts + ansiReset
+	}
+	line := fmt.Sprintf("Region: %v, Cluster: %v, %v, AgentVersions: %v", summary.Region, summary.Cluster, counts, strings.Join(summary.AgentVersions, " "))
+	if summary.AccountID != "" {
+		line += fmt.Sprintf(", Account: %v", summary.AccountID)
+	}
+	return line
+}
+
+// groupSummaries reports whether --summary summarizes the clusters of each --group-by group apart, e.g. of
+// each value of an attribute, rather than of the whole fleet
+func (opts Options) groupSummaries() bool {
+	return opts.GroupBy != "" && opts.GroupBy != "cluster"
+}
+
+// WriteGroupSummaries writes a header line per --group-by group of the agents, followed by the summaries of
+// the clusters of its agents, indented
+func WriteGroupSummaries(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	keys, groups := opts.groupAgents(agents)
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%v: %v (%v agents)\n", groupByLabel(opts.GroupBy), key, len(groups[key])); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := WriteClusterSummaries(&buf, agentstatus.SummarizeClusters(groups[key]), opts); err != nil {
+			return err
+		}
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if line == "" {
+				continue
+			}
+			if _, err := io.WriteString(w, "  "+line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteClusterSummaries writes a line per cluster summary to w, or a table with aligned columns when
+// opts.Output is table
+func WriteClusterSummaries(w io.Writer, summaries []agentstatus.ClusterSummary, opts Options) error {
+	if opts.Output != "table" {
+		for _, summary := range summaries {
+			if _, err := fmt.Fprintln(w, FormatClusterSummary(summary, opts)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tCLUSTER\tINSTANCES\tACTIVE\tDRAINING\tDISCONNECTED\tAGENT VERSIONS")
+	for _, summary := range summaries {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", summary.Region, summary.Cluster, summary.Instances, summary.Active,
+			summary.Draining, summary.Disconnected, strings.Join(summary.AgentVersions, " "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Color whole lines after alignment, since tabwriter would count the escape codes as cell width
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		if opts.Color && i > 0 && i <= len(summaries) && clusterSummaryUnhealthy(summaries[i-1]) {
+			line = ansiRed + strings.TrimSuffix(line, "\n") + ansiReset + "\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
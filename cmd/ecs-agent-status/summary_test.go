@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteClusterSummaries(t *testing.T) {
+	summaries := []agentstatus.ClusterSummary{
+		{Region: "us-east-1", Cluster: "web", Instances: 3, Active: 2, Draining: 1, Disconnected: 0, AgentVersions: []string{"1.79.0", "1.80.0"}},
+	}
+	var buf bytes.Buffer
+	if err := WriteClusterSummaries(&buf, summaries, Options{Output: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Region: us-east-1, Cluster: web, Instances: 3, Active: 2, Draining: 1, Disconnected: 0, AgentVersions: 1.79.0 1.80.0\n"
+	if buf.String() != want {
+		t.Errorf("WriteClusterSummaries(text) = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteClusterSummaries(&buf, summaries, Options{Output: "table", Color: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "REGION") || !strings.HasPrefix(lines[1], ansiRed) {
+		t.Errorf("WriteClusterSummaries(table) = %q, want a header and a red row", buf.String())
+	}
+}
+
+func TestWriteGroupSummariesByAttribute(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true, Attributes: map[string]string{"cohort": "canary"}},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE", Attributes: map[string]string{"cohort": "stable"}},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true},
+	}
+	var buf bytes.Buffer
+	if err := WriteOutput(&buf, agents, Options{Output: "text", Summary: true, GroupBy: "attribute:cohort"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "cohort: canary (1 agents)\n" +
+		"  Region: us-east-1, Cluster: web, Instances: 1, Active: 1, Draining: 0, Disconnected: 0, AgentVersions: \n" +
+		"cohort: stable (1 agents)\n" +
+		"  Region: us-east-1, Cluster: web, Instances: 1, Active: 1, Draining: 0, Disconnected: 1, AgentVersions: \n" +
+		"cohort: none (1 agents)\n" +
+		"  Region: us-east-1, Cluster: web, Instances: 1, Active: 1, Draining: 0, Disconnected: 0, AgentVersions: \n"
+	if buf.String() != want {
+		t.Errorf("WriteOutput() with --summary grouped by attribute = %q, want %q", buf.String(), want)
+	}
+}
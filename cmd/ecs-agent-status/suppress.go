@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdays maps the lowercase names and abbreviations of the days of the week to their time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// SuppressWindow is a recurring maintenance window, e.g. Sat 02:00-04:00 UTC, during which unhealthy agents
+// are reported but neither fail the run nor send notifications
+type SuppressWindow struct {
+	// Weekday is the day the window starts on, nil for a window every day
+	Weekday *time.Weekday
+	// Start and End are the times of day the window starts and ends. A window whose End is not after its
+	// Start ends on the next day
+	Start, End time.Duration
+	Location   *time.Location
+	text       string
+}
+
+// ParseSuppressWindow parses a window as [day] HH:MM-HH:MM [time zone], e.g. Sat 02:00-04:00 UTC or
+// 22:00-01:00 Europe/Berlin. Without a day the window recurs daily, and without a time zone it is in UTC
+func ParseSuppressWindow(value string) (SuppressWindow, error) {
+	window := SuppressWindow{Location: time.UTC, text: value}
+	fields := strings.Fields(value)
+	if len(fields) > 0 {
+		if day, ok := weekdays[strings.ToLower(fields[0])]; ok {
+			window.Weekday = &day
+			fields = fields[1:]
+		}
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return SuppressWindow{}, fmt.Errorf("invalid window %q: must be [day] HH:MM-HH:MM [time zone], e.g. Sat 02:00-04:00 UTC", value)
+	}
+	start, end, found := strings.Cut(fields[0], "-")
+	if !found {
+		return SuppressWindow{}, fmt.Errorf("invalid window %q: the times must be given as HH:MM-HH:MM", value)
+	}
+	var err error
+	if window.Start, err = parseTimeOfDay(start); err != nil {
+		return SuppressWindow{}, fmt.Errorf("invalid window %q: %w", value, err)
+	}
+	if window.End, err = parseTimeOfDay(end); err != nil {
+		return SuppressWindow{}, fmt.Errorf("invalid window %q: %w", value, err)
+	}
+	if window.Start == window.End {
+		return SuppressWindow{}, fmt.Errorf("invalid window %q: it starts and ends at the same time", value)
+	}
+	if len(fields) == 2 {
+		if window.Location, err = time.LoadLocation(fields[1]); err != nil {
+			return SuppressWindow{}, fmt.Errorf("invalid window %q: unknown time zone %q", value, fields[1])
+		}
+	}
+	return window, nil
+}
+
+// parseTimeOfDay parses HH:MM as the time since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: must be HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls within an occurrence of the window, including one that started the day
+// before and runs past midnight
+func (w SuppressWindow) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	for daysAgo := 0; daysAgo <= 1; daysAgo++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()-daysAgo, 0, 0, 0, 0, w.Location)
+		if w.Weekday != nil && day.Weekday() != *w.Weekday {
+			continue
+		}
+		start := day.Add(w.Start)
+		end := day.Add(w.End)
+		if w.End <= w.Start {
+			end = end.Add(24 * time.Hour)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w SuppressWindow) String() string {
+	return w.text
+}
+
+// ParseSuppressWindows parses the values of --suppress-window
+func ParseSuppressWindows(values []string) ([]SuppressWindow, error) {
+	var windows []SuppressWindow
+	for _, value := range values {
+		window, err := ParseSuppressWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// activeSuppressWindow returns the window of windows that t falls within, if any
+func activeSuppressWindow(windows []SuppressWindow, t time.Time) (SuppressWindow, bool) {
+	for _, window := range windows {
+		if window.Contains(t) {
+			return window, true
+		}
+	}
+	return SuppressWindow{}, false
+}
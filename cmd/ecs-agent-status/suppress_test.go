@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSuppressWindow(t *testing.T) {
+	for _, value := range []string{"", "Sat", "Sat 02:00", "Sat 2am-4am UTC", "Sat 02:00-02:00", "02:00-04:00 Mars/Olympus", "Sat 02:00-04:00 UTC extra"} {
+		if _, err := ParseSuppressWindow(value); err == nil {
+			t.Errorf("ParseSuppressWindow(%q) succeeded, want an error", value)
+		}
+	}
+	window, err := ParseSuppressWindow("Sat 02:00-04:30 UTC")
+	if err != nil {
+		t.Fatalf("ParseSuppressWindow() error = %v", err)
+	}
+	if window.Weekday == nil || *window.Weekday != time.Saturday || window.Start != 2*time.Hour || window.End != 4*time.Hour+30*time.Minute {
+		t.Errorf("ParseSuppressWindow() = %+v", window)
+	}
+}
+
+func TestSuppressWindowContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	tests := []struct {
+		window string
+		t      time.Time
+		want   bool
+	}{
+		// 2026-10-17 is a Saturday
+		{"Sat 02:00-04:00 UTC", time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC), true},
+		{"Sat 02:00-04:00 UTC", time.Date(2026, 10, 17, 3, 59, 0, 0, time.UTC), true},
+		{"Sat 02:00-04:00 UTC", time.Date(2026, 10, 17, 4, 0, 0, 0, time.UTC), false},
+		{"Sat 02:00-04:00 UTC", time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC), false},
+		{"sat 02:00-04:00", time.Date(2026, 10, 17, 4, 30, 0, 0, berlin), true},
+		{"Sat 23:00-01:00 UTC", time.Date(2026, 10, 18, 0, 30, 0, 0, time.UTC), true},
+		{"Sat 23:00-01:00 UTC", time.Date(2026, 10, 17, 0, 30, 0, 0, time.UTC), false},
+		{"02:00-04:00 Europe/Berlin", time.Date(2026, 10, 14, 1, 0, 0, 0, time.UTC), true},
+		{"02:00-04:00 Europe/Berlin", time.Date(2026, 10, 14, 3, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		window, err := ParseSuppressWindow(tt.window)
+		if err != nil {
+			t.Fatalf("ParseSuppressWindow(%q) error = %v", tt.window, err)
+		}
+		if got := window.Contains(tt.t); got != tt.want {
+			t.Errorf("%q.Contains(%v) = %v, want %v", tt.window, tt.t, got, tt.want)
+		}
+	}
+}
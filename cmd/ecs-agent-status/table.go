@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// WriteTable writes the agents to w as a table with aligned columns, or with opts.Fields the columns of those
+// fields. With opts.Color set, rows of agents that are unhealthy under opts.HealthPolicy are printed in red
+func WriteTable(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if len(opts.Fields) > 0 {
+		titles := make([]string, len(opts.Fields))
+		for i, field := range opts.Fields {
+			titles[i] = fieldTitle(field)
+		}
+		fmt.Fprintln(tw, strings.Join(titles, "\t"))
+		for _, agent := range agents {
+			values, err := fieldValues(agent, opts.Fields)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(tw, strings.Join(values, "\t"))
+		}
+		return writeTableLines(w, tw, &buf, agents, opts)
+	}
+	header := "ACCOUNT\tREGION\tCLUSTER\tCONTAINER INSTANCE\tEC2 INSTANCE\tAZ\tASG\tSTATUS\tCONNECTED\tAGENT VERSION\tRUNNING\tPENDING"
+	if opts.IncludeResources {
+		header += "\tCPU FREE/TOTAL\tMEMORY FREE/TOTAL"
+	}
+	for _, name := range opts.ShowAttributes {
+		header += "\t" + strings.ToUpper(name)
+	}
+	fmt.Fprintln(tw, header)
+	for _, agent := range agents {
+		arn := agent.ContainerInstanceARN
+		if opts.FormatArn == "short" {
+			arn = shortArn(arn)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v", agent.AccountID, agent.Region, agent.Cluster, arn, agent.InstanceID(),
+			agent.AvailabilityZone, agent.AutoScalingGroup, agent.AgentStatus, agent.AgentConnected, agent.AgentVersion, agent.RunningTasks, agent.PendingTasks)
+		if opts.IncludeResources {
+			fmt.Fprintf(tw, "\t%v/%v\t%v/%v", agent.RemainingCPU, agent.RegisteredCPU, agent.RemainingMemory, agent.RegisteredMemory)
+		}
+		for _, name := range opts.ShowAttributes {
+			fmt.Fprintf(tw, "\t%v", agent.Attributes[name])
+		}
+		fmt.Fprintln(tw)
+	}
+	return writeTableLines(w, tw, &buf, agents, opts)
+}
+
+// writeTableLines aligns the rows written to tw, one per agent after the header, and copies them from buf
+// to w, coloring those of unhealthy agents with opts.Color
+func writeTableLines(w io.Writer, tw *tabwriter.Writer, buf *bytes.Buffer, agents []agentstatus.Agent, opts Options) error {
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Color whole lines after alignment, since tabwriter would count the escape codes as cell width
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		if opts.Color && i > 0 && i <= len(agents) && opts.HealthPolicy.Unhealthy(agents[i-1]) {
+			line = ansiRed + strings.TrimSuffix(line, "\n") + ansiReset + "\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteTable(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{AccountID: "123456789012", Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa", EC2InstanceID: "i-aaaa", AvailabilityZone: "us-east-1a", AutoScalingGroup: "web-asg", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.75.0", RunningTasks: 3, PendingTasks: 1},
+		{Region: "us-east-1", Cluster: "batch-workers", ContainerInstanceARN: "bbbb", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING", AgentVersion: "1.68.2"},
+	}
+	opts := Options{FormatArn: "short", Color: true, HealthPolicy: agentstatus.DefaultHealthPolicy}
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, agents, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := "ACCOUNT       REGION     CLUSTER        CONTAINER INSTANCE  EC2 INSTANCE  AZ          ASG      STATUS    CONNECTED  AGENT VERSION  RUNNING  PENDING\n" +
+		"123456789012  us-east-1  web            aaaa                i-aaaa        us-east-1a  web-asg  ACTIVE    true       1.75.0         3        1\n" +
+		ansiRed + "              us-east-1  batch-workers  bbbb                i-bbbb                             DRAINING  false      1.68.2         0        0" + ansiReset + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteTable() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestWriteTableIncludeResources(t *testing.T) {
+	agents := []agentstatus.Agent{{Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "DRAINING", RunningTasks: 2, RegisteredCPU: 2048, RemainingCPU: 512, RegisteredMemory: 3904, RemainingMemory: 1024}}
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, agents, Options{IncludeResources: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "CPU FREE/TOTAL  MEMORY FREE/TOTAL") || !strings.HasSuffix(lines[1], "512/2048        1024/3904") {
+		t.Errorf("WriteTable() with resources =\n%v", buf.String())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// ShowTasks adds the tasks placed on each agent that is not ACTIVE or not connected, looking up
+// concurrency instances at a time. Instances whose tasks cannot be listed are logged and left without tasks
+func ShowTasks(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent, concurrency int) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(concurrency, 1))
+	for i := range agents {
+		if !outputHealthPolicy.Unhealthy(agents[i]) {
+			continue
+		}
+		checker := checkers[scopeIn(checkers, agents[i].AccountID, agents[i].Region)]
+		if checker == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(agent *agentstatus.Agent) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tasks, err := checker.GetTasksForInstance(ctx, agent.Cluster, agent.ContainerInstanceARN)
+			if err != nil {
+				logger.Warn().Err(err).Str("cluster", agent.Cluster).Str("containerInstanceArn", agent.ContainerInstanceARN).
+					Msgf("could not list the tasks on %v", agent.InstanceID())
+				return
+			}
+			agent.Tasks = tasks
+		}(&agents[i])
+	}
+	wg.Wait()
+}
+
+// FormatTask returns the text output line for a task placed on an agent
+func FormatTask(task agentstatus.Task, opts Options) string {
+	arn := task.TaskARN
+	if opts.FormatArn == "short" {
+		arn = shortArn(arn)
+	}
+	line := fmt.Sprintf("Task: %v, Family: %v, LastStatus: %v", arn, task.Family, task.LastStatus)
+	if task.HealthStatus != "" {
+		line += fmt.Sprintf(", HealthStatus: %v", task.HealthStatus)
+	}
+	return line
+}
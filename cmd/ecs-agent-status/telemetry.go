@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+	"github.com/natemarks/ecs-agent-status/version"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// telemetryShutdownTimeout bounds how long exporting the remaining spans and metrics can delay the exit
+const telemetryShutdownTimeout = 5 * time.Second
+
+// telemetryScope names the tracer and meter of the command
+const telemetryScope = "github.com/natemarks/ecs-agent-status"
+
+// telemetryEnabled is set by SetupTelemetry when traces and metrics are exported, so the AWS clients add a
+// span per API call
+var telemetryEnabled bool
+
+var tracer = otel.Tracer(telemetryScope)
+
+// SetupTelemetry installs OTLP/HTTP trace and metric exporters as the global OpenTelemetry providers when
+// OTEL_EXPORTER_OTLP_ENDPOINT is set. The exporters are configured by the standard OTEL_EXPORTER_OTLP_*
+// environment variables. The returned function flushes and stops them
+func SetupTelemetry(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("ecs-agent-status"), semconv.ServiceVersion(version.Version)))
+	if err != nil {
+		return nil, err
+	}
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExporter), sdktrace.WithResource(res))
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)), sdkmetric.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	telemetryEnabled = true
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+	}, nil
+}
+
+// withTelemetry adds a span per AWS API call to cfg when telemetry is exported
+func withTelemetry(cfg aws.Config) aws.Config {
+	if telemetryEnabled {
+		otelaws.AppendMiddlewares(&cfg.APIOptions)
+	}
+	return cfg
+}
+
+// RecordScanMetrics adds the agents of a scan to the instances scanned and unhealthy agents counters, with
+// the region and cluster of each as attributes
+func RecordScanMetrics(ctx context.Context, agents []agentstatus.Agent, policy agentstatus.HealthPolicy) {
+	meter := otel.Meter(telemetryScope)
+	scanned, err := meter.Int64Counter("ecs_agent_status.instances_scanned", metric.WithDescription("Container instances scanned"))
+	if err != nil {
+		return
+	}
+	unhealthy, err := meter.Int64Counter("ecs_agent_status.unhealthy_agents", metric.WithDescription("Agents found unhealthy under --fail-on"))
+	if err != nil {
+		return
+	}
+	keys, groups := agentstatus.GroupBy(agents, func(agent agentstatus.Agent) string {
+		return ScopeKey(agent.AccountID, agent.Region) + "/" + agent.Cluster
+	})
+	for _, key := range keys {
+		first := groups[key][0]
+		attrs := metric.WithAttributes(attribute.String("aws.region", first.Region), attribute.String("aws.ecs.cluster", first.Cluster))
+		scanned.Add(ctx, int64(len(groups[key])), attrs)
+		unhealthy.Add(ctx, int64(len(policy.UnhealthyAgents(groups[key]))), attrs)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRecordScanMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer otel.SetMeterProvider(previous)
+
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE"},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "DRAINING"},
+		{Region: "eu-west-1", Cluster: "web", AgentStatus: "ACTIVE"},
+	}
+	RecordScanMetrics(context.Background(), agents, agentstatus.DefaultHealthPolicy)
+
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatal(err)
+	}
+	totals := make(map[string]int64)
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				totals[m.Name] += point.Value
+			}
+		}
+	}
+	if totals["ecs_agent_status.instances_scanned"] != 3 || totals["ecs_agent_status.unhealthy_agents"] != 1 {
+		t.Errorf("RecordScanMetrics() counters = %v, want 3 scanned and 1 unhealthy", totals)
+	}
+}
+
+func TestSetupTelemetryDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	shutdown, err := SetupTelemetry(context.Background())
+	if err != nil || telemetryEnabled {
+		t.Fatalf("SetupTelemetry() without an endpoint = enabled %v, error %v", telemetryEnabled, err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// tsvHeader names the columns of --output tsv. The columns are a contract with the scripts reading them: they
+// are never renamed, removed or reordered, and new ones are only added at the end
+var tsvHeader = []string{
+	"region", "accountId", "cluster", "containerInstanceArn", "instanceId", "agentStatus", "agentConnected", "unhealthy",
+	"agentVersion", "agentUpdateStatus", "runningTasks", "pendingTasks", "registeredAt", "launchType", "instanceType",
+	"availabilityZone", "autoScalingGroup", "lifecycleState", "outdated",
+}
+
+// tsvValue replaces the tabs, carriage returns and newlines of a value with spaces, so that it stays in its
+// column and line
+var tsvValue = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// tsvRecord returns the --output tsv columns of an agent in tsvHeader order. Booleans are true or false,
+// times RFC 3339 in UTC and numbers plain decimals, whatever the locale, and unknown values are empty
+func tsvRecord(agent agentstatus.Agent, policy agentstatus.HealthPolicy) []string {
+	var registeredAt string
+	if agent.RegisteredAt != nil {
+		registeredAt = agent.RegisteredAt.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		agent.Region,
+		agent.AccountID,
+		agent.Cluster,
+		agent.ContainerInstanceARN,
+		agent.InstanceID(),
+		agent.AgentStatus,
+		strconv.FormatBool(agent.AgentConnected),
+		strconv.FormatBool(policy.Unhealthy(agent)),
+		agent.AgentVersion,
+		agent.AgentUpdateStatus,
+		strconv.Itoa(agent.RunningTasks),
+		strconv.Itoa(agent.PendingTasks),
+		registeredAt,
+		agent.LaunchType,
+		agent.InstanceType,
+		agent.AvailabilityZone,
+		agent.AutoScalingGroup,
+		agent.LifecycleState,
+		strconv.FormatBool(agent.Outdated),
+	}
+}
+
+// WriteTSV writes a header line and one tab-separated line per agent to w, with the columns of tsvHeader.
+// Unlike the text output, it does not depend on --format-arn, colors or the terminal
+func WriteTSV(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(strings.Join(tsvHeader, "\t") + "\n")
+	for _, agent := range agents {
+		record := tsvRecord(agent, opts.HealthPolicy)
+		for i, value := range record {
+			record[i] = tsvValue.Replace(value)
+		}
+		bw.WriteString(strings.Join(record, "\t") + "\n")
+	}
+	return bw.Flush()
+}
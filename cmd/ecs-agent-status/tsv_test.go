@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteTSV(t *testing.T) {
+	registeredAt := time.Date(2023, 12, 1, 13, 0, 0, 0, time.FixedZone("CET", 3600))
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", AccountID: "123456789012", Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa",
+			EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: false, AgentVersion: "1.75.0", RunningTasks: 3, RegisteredAt: &registeredAt,
+			LaunchType: "EC2", InstanceType: "m5.large", AvailabilityZone: "us-east-1a", AutoScalingGroup: "web\tasg", LifecycleState: "InService"},
+		{Region: "us-east-1", Cluster: "edge", ManagedInstanceID: "mi-bbbb", EC2InstanceID: "", AgentStatus: "DRAINING", AgentConnected: true, LaunchType: agentstatus.LaunchTypeExternal},
+	}
+	var buf bytes.Buffer
+	opts := Options{HealthPolicy: agentstatus.HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}, FormatArn: "short"}
+	if err := WriteTSV(&buf, agents, opts); err != nil {
+		t.Fatalf("WriteTSV() error = %v", err)
+	}
+	want := "region\taccountId\tcluster\tcontainerInstanceArn\tinstanceId\tagentStatus\tagentConnected\tunhealthy\tagentVersion\tagentUpdateStatus\t" +
+		"runningTasks\tpendingTasks\tregisteredAt\tlaunchType\tinstanceType\tavailabilityZone\tautoScalingGroup\tlifecycleState\toutdated\n" +
+		"us-east-1\t123456789012\tweb\tarn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa\ti-aaaa\tACTIVE\tfalse\ttrue\t1.75.0\t\t" +
+		"3\t0\t2023-12-01T12:00:00Z\tEC2\tm5.large\tus-east-1a\tweb asg\tInService\tfalse\n" +
+		"us-east-1\t\tedge\t\tmi-bbbb\tDRAINING\ttrue\ttrue\t\t\t0\t0\t\texternal\t\t\t\t\tfalse\n"
+	if buf.String() != want {
+		t.Errorf("WriteTSV() =\n%q\nwant\n%q", buf.String(), want)
+	}
+}
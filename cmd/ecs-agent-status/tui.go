@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// tuiChromeLines is the number of screen lines the dashboard uses besides the rows of the table: the title,
+// the table header, the status line and the key help
+const tuiChromeLines = 5
+
+// tuiScanMsg carries the result of a scan to the dashboard
+type tuiScanMsg struct {
+	agents  []agentstatus.Agent
+	checked []ClusterRef
+	errors  int
+	err     error
+	at      time.Time
+}
+
+// tuiTickMsg starts the scan due every --interval
+type tuiTickMsg struct{}
+
+// tuiDrainMsg carries the result of draining a container instance to the dashboard
+type tuiDrainMsg struct {
+	label string
+	err   error
+}
+
+// tuiRow is a line of the dashboard table: a cluster header, or the agent at index agent
+type tuiRow struct {
+	cluster ClusterRef
+	agent   int
+}
+
+// tuiModel is the state of the dashboard of the tui command
+type tuiModel struct {
+	ctx      context.Context
+	checkers map[string]*agentstatus.StatusChecker
+	opts     Options
+	// clipboard receives the OSC 52 sequences copying instance IDs, the terminal running the dashboard
+	clipboard io.Writer
+
+	agents     []agentstatus.Agent
+	checked    []ClusterRef
+	scanErrors int
+	updated    time.Time
+	scanning   bool
+	// cursor is the index of the selected agent, top the first table row on screen
+	cursor int
+	top    int
+	height int
+	detail bool
+	// confirmDrain asks for confirmation before draining the selected instance
+	confirmDrain bool
+	status       string
+}
+
+// newTUIModel returns the dashboard of the clusters checked by checkers, scanning on start
+func newTUIModel(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) tuiModel {
+	return tuiModel{ctx: ctx, checkers: checkers, opts: opts, clipboard: os.Stdout, scanning: true, height: 24}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return m.scan()
+}
+
+// scan returns a command scanning the clusters, bounded by --timeout
+func (m tuiModel) scan() tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := WithTimeout(m.ctx, m.opts.Timeout)
+		defer cancel()
+		apiBudget.Reset()
+		agents, checked, scanErrs, err := Scan(ctx, m.checkers, m.opts, nil)
+		if err == nil {
+			err = ctx.Err()
+		}
+		return tuiScanMsg{agents: agents, checked: checked, errors: len(scanErrs), err: err, at: time.Now()}
+	}
+}
+
+// drain returns a command setting the container instance of agent to DRAINING
+func (m tuiModel) drain(agent agentstatus.Agent) tea.Cmd {
+	return func() tea.Msg {
+		checker, ok := m.checkers[scopeIn(m.checkers, agent.AccountID, agent.Region)]
+		if !ok {
+			return tuiDrainMsg{label: drainLabel(agent), err: fmt.Errorf("no checker for region %v", agent.Region)}
+		}
+		err := checker.DrainContainerInstances(m.ctx, agent.Cluster, []string{agent.ContainerInstanceARN})
+		auditLog.Record(m.ctx, NewAuditRecord(AuditDrain, agent, &AuditState{AgentStatus: "DRAINING"}, err))
+		return tuiDrainMsg{label: drainLabel(agent), err: err}
+	}
+}
+
+// OSC52 returns the terminal escape sequence copying text to the clipboard, which most terminals and tmux
+// support, including over SSH
+func OSC52(text string) string {
+	return "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		m.scrollToCursor()
+	case tuiScanMsg:
+		m.scanning = false
+		if msg.err != nil {
+			m.status = fmt.Sprintf("scan failed: %v", msg.err)
+		} else {
+			m.agents, m.checked, m.scanErrors, m.updated = msg.agents, msg.checked, msg.errors, msg.at
+			m.cursor = min(m.cursor, max(len(m.agents)-1, 0))
+			m.scrollToCursor()
+		}
+		return m, tea.Tick(m.opts.Interval, func(time.Time) tea.Msg { return tuiTickMsg{} })
+	case tuiTickMsg:
+		if m.scanning {
+			return m, nil
+		}
+		m.scanning = true
+		return m, m.scan()
+	case tuiDrainMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("error draining %v: %v", msg.label, msg.err)
+			return m, nil
+		}
+		m.status = fmt.Sprintf("set %v to DRAINING", msg.label)
+		if m.scanning {
+			return m, nil
+		}
+		m.scanning = true
+		return m, m.scan()
+	case tea.KeyMsg:
+		return m.handleKey(msg.String())
+	}
+	return m, nil
+}
+
+// handleKey applies a key press to the dashboard
+func (m tuiModel) handleKey(key string) (tea.Model, tea.Cmd) {
+	if m.confirmDrain {
+		m.confirmDrain = false
+		if key != "y" || len(m.agents) == 0 {
+			m.status = "drain cancelled"
+			return m, nil
+		}
+		agent := m.agents[m.cursor]
+		m.status = fmt.Sprintf("draining %v...", drainLabel(agent))
+		return m, m.drain(agent)
+	}
+	switch key {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.detail = false
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = max(min(m.cursor+1, len(m.agents)-1), 0)
+	case "pgup":
+		m.cursor = max(m.cursor-m.pageSize(), 0)
+	case "pgdown":
+		m.cursor = max(min(m.cursor+m.pageSize(), len(m.agents)-1), 0)
+	case "enter":
+		m.detail = len(m.agents) > 0 && !m.detail
+	case "r":
+		if !m.scanning {
+			m.scanning = true
+			return m, m.scan()
+		}
+	case "d":
+		if len(m.agents) > 0 {
+			m.confirmDrain = true
+			m.status = fmt.Sprintf("drain %v in cluster %v? (y/n)", drainLabel(m.agents[m.cursor]), m.agents[m.cursor].Cluster)
+		}
+	case "c":
+		if len(m.agents) > 0 {
+			id := m.agents[m.cursor].InstanceID()
+			if id == "" {
+				id = m.agents[m.cursor].ContainerInstanceARN
+			}
+			fmt.Fprint(m.clipboard, OSC52(id))
+			m.status = fmt.Sprintf("copied %v", id)
+		}
+	}
+	m.scrollToCursor()
+	return m, nil
+}
+
+// pageSize returns the number of table rows on screen
+func (m tuiModel) pageSize() int {
+	return max(m.height-tuiChromeLines, 1)
+}
+
+// rows returns the table rows: each checked cluster followed by its agents, which Scan sorts by cluster
+func (m tuiModel) rows() []tuiRow {
+	var rows []tuiRow
+	next := 0
+	for _, ref := range m.checked {
+		rows = append(rows, tuiRow{cluster: ref, agent: -1})
+		for ; next < len(m.agents) && agentClusterRef(m.agents[next]) == ref; next++ {
+			rows = append(rows, tuiRow{agent: next})
+		}
+	}
+	// Agents of clusters missing from checked, which should not happen, are still listed
+	for ; next < len(m.agents); next++ {
+		rows = append(rows, tuiRow{agent: next})
+	}
+	return rows
+}
+
+// agentClusterRef returns the cluster of an agent
+func agentClusterRef(agent agentstatus.Agent) ClusterRef {
+	return ClusterRef{AccountID: agent.AccountID, Region: agent.Region, Cluster: agent.Cluster}
+}
+
+// scrollToCursor moves the table window so that the selected agent is on screen
+func (m *tuiModel) scrollToCursor() {
+	line := 0
+	for i, row := range m.rows() {
+		if row.agent == m.cursor {
+			line = i
+			break
+		}
+	}
+	page := m.pageSize()
+	switch {
+	case line < m.top:
+		m.top = line
+		// Show the header of the first cluster when its first agent is selected
+		if line == 1 {
+			m.top = 0
+		}
+	case line >= m.top+page:
+		m.top = line - page + 1
+	}
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+	unhealthy := len(m.opts.HealthPolicy.UnhealthyAgents(m.agents))
+	fmt.Fprintf(&b, "ecs-agent-status: %v clusters, %v instances, %v unhealthy", len(m.checked), len(m.agents), unhealthy)
+	if m.scanErrors > 0 {
+		fmt.Fprintf(&b, ", %v errors", m.scanErrors)
+	}
+	switch {
+	case m.scanning:
+		b.WriteString(" (scanning...)")
+	case !m.updated.IsZero():
+		fmt.Fprintf(&b, " (updated %v)", m.updated.Format(time.TimeOnly))
+	}
+	b.WriteString("\n\n")
+	if m.detail && len(m.agents) > 0 {
+		WriteAgentDetail(&b, m.agents[m.cursor], m.opts, time.Now())
+	} else {
+		b.WriteString(m.table())
+	}
+	fmt.Fprintf(&b, "\n%v\n", m.status)
+	if m.detail {
+		b.WriteString("esc/enter: back  d: drain  c: copy instance ID  r: refresh  q: quit")
+	} else {
+		b.WriteString("up/down: select  enter: details  d: drain  c: copy instance ID  r: refresh  q: quit")
+	}
+	return b.String()
+}
+
+// table returns the on-screen rows of the table of clusters and agents, the selected agent highlighted
+func (m tuiModel) table() string {
+	var table strings.Builder
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  INSTANCE\tSTATUS\tCONNECTED\tAGENT VERSION\tRUNNING\tPENDING\tAZ")
+	rows := m.rows()
+	selected := -1
+	end := min(m.top+m.pageSize(), len(rows))
+	for i := m.top; i < end; i++ {
+		row := rows[i]
+		if row.agent < 0 {
+			fmt.Fprintf(tw, "%v/%v\t\t\t\t\t\t\n", row.cluster.Region, row.cluster.Cluster)
+			continue
+		}
+		agent := m.agents[row.agent]
+		if row.agent == m.cursor {
+			selected = i - m.top
+		}
+		fmt.Fprintf(tw, "  %v\t%v\t%v\t%v\t%v\t%v\t%v\n", drainLabel(agent), agent.AgentStatus, agent.AgentConnected,
+			agent.AgentVersion, agent.RunningTasks, agent.PendingTasks, agent.AvailabilityZone)
+	}
+	tw.Flush()
+	lines := strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")
+	if selected >= 0 {
+		// The first line is the table header
+		lines[selected+1] = "\033[7m" + lines[selected+1] + "\033[0m"
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// runTUI shows the dashboard until it is quit. The logs would garble the screen, so they are discarded while
+// it runs; scan errors are shown on its status line
+func runTUI(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	previous := logger
+	logger = logger.Output(io.Discard)
+	agentstatus.SetLogger(logger)
+	program := tea.NewProgram(newTUIModel(ctx, checkers, opts), tea.WithAltScreen(), tea.WithContext(ctx))
+	_, err := program.Run()
+	logger = previous
+	agentstatus.SetLogger(logger)
+	if err != nil && ctx.Err() == nil {
+		logger.Error().Err(err).Msgf("error running the dashboard: %v", err)
+		return ExitError
+	}
+	return ExitHealthy
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestOSC52(t *testing.T) {
+	if got, want := OSC52("i-aaaa"), "\033]52;c;aS1hYWFh\a"; got != want {
+		t.Errorf("OSC52() = %q, want %q", got, want)
+	}
+}
+
+func TestTUIModel(t *testing.T) {
+	var clipboard bytes.Buffer
+	m := newTUIModel(context.Background(), nil, Options{Interval: time.Minute, HealthPolicy: agentstatus.DefaultHealthPolicy})
+	m.clipboard = &clipboard
+	checked := []ClusterRef{{Region: "us-east-1", Cluster: "api"}, {Region: "us-east-1", Cluster: "web"}}
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "api", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-bbbb", AgentStatus: "DRAINING"},
+	}
+	model, cmd := m.Update(tuiScanMsg{agents: agents, checked: checked, at: time.Now()})
+	m = model.(tuiModel)
+	if m.scanning || cmd == nil {
+		t.Errorf("after a scan, scanning = %v and the next refresh is not scheduled", m.scanning)
+	}
+	view := m.View()
+	for _, want := range []string{"2 clusters, 2 instances, 1 unhealthy", "us-east-1/api", "us-east-1/web", "i-bbbb"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() is missing %q:\n%v", want, view)
+		}
+	}
+
+	model, _ = m.handleKey("down")
+	m = model.(tuiModel)
+	if m.cursor != 1 {
+		t.Fatalf("cursor after down = %v, want 1", m.cursor)
+	}
+	model, _ = m.handleKey("c")
+	m = model.(tuiModel)
+	if clipboard.String() != OSC52("i-bbbb") {
+		t.Errorf("copied %q, want the OSC 52 sequence of i-bbbb", clipboard.String())
+	}
+	model, _ = m.handleKey("enter")
+	m = model.(tuiModel)
+	if !m.detail || !strings.Contains(m.View(), "i-bbbb") {
+		t.Errorf("enter did not show the details of i-bbbb:\n%v", m.View())
+	}
+
+	model, cmd = m.handleKey("d")
+	m = model.(tuiModel)
+	if !m.confirmDrain || cmd != nil {
+		t.Fatal("d drained without asking for confirmation")
+	}
+	model, cmd = m.handleKey("n")
+	m = model.(tuiModel)
+	if m.confirmDrain || cmd != nil || m.status != "drain cancelled" {
+		t.Errorf("n did not cancel the drain: status %q", m.status)
+	}
+
+	if _, cmd = m.handleKey("q"); cmd == nil {
+		t.Fatal("q did not quit")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("q did not quit")
+	}
+}
+
+func TestTUIModelScroll(t *testing.T) {
+	m := newTUIModel(context.Background(), nil, Options{Interval: time.Minute})
+	m.checked = []ClusterRef{{Region: "us-east-1", Cluster: "web"}}
+	for i := 0; i < 20; i++ {
+		m.agents = append(m.agents, agentstatus.Agent{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-" + strings.Repeat("a", i+1)})
+	}
+	model, _ := m.Update(tea.WindowSizeMsg{Height: 10})
+	m = model.(tuiModel)
+	for i := 0; i < 10; i++ {
+		model, _ = m.handleKey("down")
+		m = model.(tuiModel)
+	}
+	if !strings.Contains(m.View(), "i-"+strings.Repeat("a", 11)+" ") {
+		t.Errorf("the selected agent is not on screen:\n%v", m.View())
+	}
+	if strings.Count(m.View(), "\n") > 10 {
+		t.Errorf("View() has more lines than the window:\n%v", m.View())
+	}
+}
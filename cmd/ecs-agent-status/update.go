@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// agentUpdatePollInterval is how often the agent update status of a batch is checked
+const agentUpdatePollInterval = 15 * time.Second
+
+// UpdateTargets returns the agents to update, grouped by the ScopeKey of checkers and then cluster: ACTIVE and connected
+// agents on EC2 instances, since ECS cannot update agents that are disconnected or external. With
+// --min-agent-version only the agents older than it are updated; otherwise ECS decides which are outdated
+func UpdateTargets(checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent, opts Options) map[string]map[string][]agentstatus.Agent {
+	targets := make(map[string]map[string][]agentstatus.Agent)
+	for _, agent := range agents {
+		if agent.AgentStatus != "ACTIVE" || !agent.AgentConnected || agent.LaunchType == agentstatus.LaunchTypeExternal {
+			continue
+		}
+		if opts.MinAgentVersion != "" && !agent.Outdated {
+			continue
+		}
+		scope := scopeIn(checkers, agent.AccountID, agent.Region)
+		if targets[scope] == nil {
+			targets[scope] = make(map[string][]agentstatus.Agent)
+		}
+		targets[scope][agent.Cluster] = append(targets[scope][agent.Cluster], agent)
+	}
+	return targets
+}
+
+// updateBatches splits agents into batches of size agents, or a single batch if size is 0
+func updateBatches(agents []agentstatus.Agent, size int) [][]agentstatus.Agent {
+	if size <= 0 {
+		size = len(agents)
+	}
+	var batches [][]agentstatus.Agent
+	for start := 0; start < len(agents); start += size {
+		batches = append(batches, agents[start:min(start+size, len(agents))])
+	}
+	return batches
+}
+
+// UpdateResult counts the agents UpdateAgents updated, found already up to date and failed to update
+type UpdateResult struct {
+	Updated  int
+	UpToDate int
+	Failed   int
+}
+
+// UpdateAgents updates the agents of the targets cluster by cluster, opts.BatchSize at a time (0 = a whole
+// cluster at once), waiting up to opts.UpdateTimeout for each batch to be UPDATED before starting the next.
+// The rollout stops at the first batch with a failed or unfinished update. With opts.DryRun the updates are
+// only logged
+func UpdateAgents(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, agents []agentstatus.Agent, opts Options) (UpdateResult, error) {
+	var result UpdateResult
+	targets := UpdateTargets(checkers, agents, opts)
+	scopes := make([]string, 0, len(targets))
+	for scope := range targets {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		checker := checkers[scope]
+		clusters := make([]string, 0, len(targets[scope]))
+		for cluster := range targets[scope] {
+			clusters = append(clusters, cluster)
+		}
+		sort.Strings(clusters)
+		for _, cluster := range clusters {
+			for _, batch := range updateBatches(targets[scope][cluster], opts.BatchSize) {
+				if err := updateBatch(ctx, checker, cluster, batch, opts, &result); err != nil {
+					return result, fmt.Errorf("region %v: %w", scope, err)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// updateBatch starts the agent updates of one batch and waits for them to finish
+func updateBatch(ctx context.Context, checker *agentstatus.StatusChecker, cluster string, batch []agentstatus.Agent, opts Options, result *UpdateResult) error {
+	var started []string
+	byARN := make(map[string]agentstatus.Agent)
+	failed := 0
+	for _, agent := range batch {
+		if opts.DryRun {
+			logger.Warn().Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).Str("agentVersion", agent.AgentVersion).Bool("dryRun", true).
+				Msgf("dry run: would update the ECS agent %v on %v", agent.AgentVersion, agent.EC2InstanceID)
+			continue
+		}
+		err := checker.UpdateContainerAgent(ctx, cluster, agent.ContainerInstanceARN)
+		switch {
+		case errors.Is(err, agentstatus.ErrNoAgentUpdate):
+			logger.Info().Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).Msgf("the ECS agent %v on %v is up to date", agent.AgentVersion, agent.EC2InstanceID)
+			result.UpToDate++
+		case err != nil:
+			logger.Error().Err(err).Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).Msgf("error updating the ECS agent on %v: %v", agent.EC2InstanceID, err)
+			auditLog.Record(ctx, NewAuditRecord(AuditUpdateAgent, agent, nil, err))
+			failed++
+		default:
+			logger.Warn().Str("cluster", cluster).Str("ec2InstanceId", agent.EC2InstanceID).Msgf("updating the ECS agent %v on %v", agent.AgentVersion, agent.EC2InstanceID)
+			started = append(started, agent.ContainerInstanceARN)
+			byARN[agent.ContainerInstanceARN] = agent
+		}
+	}
+	if len(started) > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, opts.UpdateTimeout)
+		defer cancel()
+		statuses, err := checker.WaitForAgentUpdate(waitCtx, cluster, started, agentUpdatePollInterval)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		for _, arn := range started {
+			auditLog.Record(ctx, NewAuditRecord(AuditUpdateAgent, byARN[arn], &AuditState{AgentUpdateStatus: valueOr(statuses[arn], "unknown")}, nil))
+			if statuses[arn] == "UPDATED" {
+				result.Updated++
+				continue
+			}
+			failed++
+			logger.Error().Str("cluster", cluster).Str("containerInstanceArn", arn).Str("agentUpdateStatus", statuses[arn]).
+				Msgf("the agent update of %v is %v after %v", shortArn(arn), valueOr(statuses[arn], "unknown"), opts.UpdateTimeout)
+		}
+	}
+	result.Failed += failed
+	if failed > 0 {
+		return fmt.Errorf("stopping the rollout: %v agent updates failed in cluster %v", failed, cluster)
+	}
+	return nil
+}
+
+// runUpdateAgents updates the agents of the matching clusters and returns the exit code: ExitUnhealthy when
+// an update failed
+func runUpdateAgents(ctx context.Context, checkers map[string]*agentstatus.StatusChecker, opts Options) int {
+	agents, _, _, err := Scan(ctx, checkers, opts, nil)
+	if err != nil {
+		return scanErrorExitCode(ctx, err, opts)
+	}
+	result, err := UpdateAgents(ctx, checkers, agents, opts)
+	logger.Info().Int("updated", result.Updated).Int("upToDate", result.UpToDate).Int("failed", result.Failed).
+		Msgf("%v agents updated, %v up to date, %v failed", result.Updated, result.UpToDate, result.Failed)
+	switch {
+	case ctx.Err() != nil:
+		return cancelledExitCode(ctx, opts, "while updating agents")
+	case err != nil:
+		logger.Error().Err(err).Msgf("error updating agents: %v", err)
+		return ExitUnhealthy
+	}
+	return ExitHealthy
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestUpdateTargets(t *testing.T) {
+	agents := []agentstatus.Agent{
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-old", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.70.0", Outdated: true},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-new", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.80.0"},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-disconnected", AgentStatus: "ACTIVE", Outdated: true},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-draining", AgentStatus: "DRAINING", AgentConnected: true, Outdated: true},
+		{Region: "us-east-1", Cluster: "web", ManagedInstanceID: "mi-external", AgentStatus: "ACTIVE", AgentConnected: true, LaunchType: agentstatus.LaunchTypeExternal, Outdated: true},
+	}
+	targets := UpdateTargets(nil, agents, Options{})
+	if got := targets["us-east-1"]["web"]; len(got) != 2 || got[0].EC2InstanceID != "i-old" || got[1].EC2InstanceID != "i-new" {
+		t.Errorf("UpdateTargets() = %v, want i-old and i-new", got)
+	}
+	targets = UpdateTargets(nil, agents, Options{MinAgentVersion: "1.75.0"})
+	if got := targets["us-east-1"]["web"]; len(got) != 1 || got[0].EC2InstanceID != "i-old" {
+		t.Errorf("UpdateTargets() with --min-agent-version = %v, want i-old", got)
+	}
+}
+
+func TestUpdateBatches(t *testing.T) {
+	agents := make([]agentstatus.Agent, 5)
+	for _, tc := range []struct {
+		size int
+		want []int
+	}{
+		{0, []int{5}},
+		{2, []int{2, 2, 1}},
+		{10, []int{5}},
+	} {
+		batches := updateBatches(agents, tc.size)
+		var sizes []int
+		for _, batch := range batches {
+			sizes = append(sizes, len(batch))
+		}
+		if !reflect.DeepEqual(sizes, tc.want) {
+			t.Errorf("updateBatches(5 agents, %v) sizes = %v, want %v", tc.size, sizes, tc.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/natemarks/ecs-agent-status/version"
+)
+
+// WriteVersion writes the build metadata to w as text, the first line being the version, or as a JSON
+// object with --output json
+func WriteVersion(w io.Writer, info version.Info, output string) error {
+	if output == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "ecs-agent-status %v\n", info.Version)
+	if info.Commit != "" {
+		fmt.Fprintf(&text, "commit: %v\n", info.Commit)
+	}
+	if info.BuildDate != "" {
+		fmt.Fprintf(&text, "build date: %v\n", info.BuildDate)
+	}
+	fmt.Fprintf(&text, "go: %v %v\n", info.GoVersion, info.Platform)
+	modules := make([]string, 0, len(info.SDKVersions))
+	for module := range info.SDKVersions {
+		modules = append(modules, module)
+	}
+	slices.Sort(modules)
+	for _, module := range modules {
+		fmt.Fprintf(&text, "%v: %v\n", module, info.SDKVersions[module])
+	}
+	_, err := io.WriteString(w, text.String())
+	return err
+}
+
+// RunVersion runs the version command, printing the build metadata to w, and returns the exit code
+func RunVersion(w io.Writer, args []string) int {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	output := fs.String("output", "text", "output format: text or json (an object with the version, commit, build date and Go and AWS SDK versions)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecs-agent-status version [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return ExitError
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "invalid --output %q: must be text or json\n", *output)
+		return ExitError
+	}
+	if err := WriteVersion(w, version.Get(), *output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	return ExitHealthy
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/natemarks/ecs-agent-status/version"
+)
+
+func TestWriteVersion(t *testing.T) {
+	info := version.Info{Version: "v1.4.0", Commit: "0a1b2c3", BuildDate: "2024-05-01T12:00:00Z", GoVersion: "go1.25.0", Platform: "linux/amd64",
+		SDKVersions: map[string]string{"ecs": "v1.57.0", "aws-sdk-go-v2": "v1.36.0"}}
+	var text bytes.Buffer
+	if err := WriteVersion(&text, info, "text"); err != nil {
+		t.Fatal(err)
+	}
+	want := "ecs-agent-status v1.4.0\ncommit: 0a1b2c3\nbuild date: 2024-05-01T12:00:00Z\ngo: go1.25.0 linux/amd64\naws-sdk-go-v2: v1.36.0\necs: v1.57.0\n"
+	if got := text.String(); got != want {
+		t.Errorf("WriteVersion(text) = %q, want %q", got, want)
+	}
+	var out bytes.Buffer
+	if err := WriteVersion(&out, info, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var got version.Info
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, info) {
+		t.Errorf("WriteVersion(json) = %+v, want %+v", got, info)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// waitPollInterval is how often --wait re-checks the agents
+const waitPollInterval = 15 * time.Second
+
+// waitPolicy is what --wait waits for: every agent ACTIVE and connected
+var waitPolicy = agentstatus.HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}
+
+// WaitForHealthy calls scan every interval until it finds at least one agent and every agent is ACTIVE and
+// connected, or until timeout passes, logging the progress of each poll. It returns the agents of the last
+// poll, and whether they were all healthy. Errors other than ErrNoClustersMatched are logged and retried at
+// the next poll; the last one is returned if the timeout passes without a successful poll
+func WaitForHealthy(ctx context.Context, timeout, interval time.Duration, scan func(context.Context) ([]agentstatus.Agent, error)) ([]agentstatus.Agent, bool, error) {
+	deadline := time.Now().Add(timeout)
+	var agents []agentstatus.Agent
+	var lastErr error
+	for {
+		result, err := scan(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return agents, false, ctx.Err()
+		case errors.Is(err, agentstatus.ErrNoClustersMatched):
+			return nil, false, err
+		case err != nil:
+			logger.Warn().Err(err).Msgf("error checking agents, retrying in %v: %v", interval, err)
+			lastErr = err
+		default:
+			agents, lastErr = result, nil
+			unhealthy := len(waitPolicy.UnhealthyAgents(agents))
+			if len(agents) > 0 && unhealthy == 0 {
+				logger.Info().Int("agents", len(agents)).Msgf("all %v agents are ACTIVE and connected", len(agents))
+				return agents, true, nil
+			}
+			logger.Info().Int("agents", len(agents)).Int("unhealthy", unhealthy).Time("deadline", deadline).
+				Msgf("%v of %v agents are ACTIVE and connected, waiting", len(agents)-unhealthy, len(agents))
+		}
+		if time.Now().Add(interval).After(deadline) {
+			if lastErr != nil && agents == nil {
+				return nil, false, lastErr
+			}
+			logger.Error().Dur("waitTimeout", timeout).Msgf("not every agent was ACTIVE and connected after %v", timeout)
+			return agents, false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return agents, false, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWaitForHealthy(t *testing.T) {
+	polls := [][]agentstatus.Agent{
+		nil,
+		{{EC2InstanceID: "i-new", AgentStatus: "ACTIVE"}},
+		{{EC2InstanceID: "i-new", AgentStatus: "ACTIVE", AgentConnected: true}},
+	}
+	calls := 0
+	scan := func(context.Context) ([]agentstatus.Agent, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("throttled")
+		}
+		return polls[min(calls-1, len(polls)-1)], nil
+	}
+	agents, healthy, err := WaitForHealthy(context.Background(), time.Minute, time.Millisecond, scan)
+	if err != nil || !healthy || len(agents) != 1 || calls != 3 {
+		t.Errorf("WaitForHealthy() = %v, %v, %v after %v polls, want the connected agent after 3 polls", agents, healthy, err, calls)
+	}
+
+	agents, healthy, err = WaitForHealthy(context.Background(), 20*time.Millisecond, 5*time.Millisecond, func(context.Context) ([]agentstatus.Agent, error) {
+		return polls[1], nil
+	})
+	if err != nil || healthy || len(agents) != 1 {
+		t.Errorf("WaitForHealthy() of a disconnected agent = %v, %v, %v, want the agent, unhealthy", agents, healthy, err)
+	}
+
+	_, _, err = WaitForHealthy(context.Background(), time.Minute, time.Millisecond, func(context.Context) ([]agentstatus.Agent, error) {
+		return nil, agentstatus.ErrNoClustersMatched
+	})
+	if !errors.Is(err, agentstatus.ErrNoClustersMatched) {
+		t.Errorf("WaitForHealthy() with no clusters error = %v, want %v", err, agentstatus.ErrNoClustersMatched)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+// agentState is the part of an agent whose changes are reported in watch mode
+func agentState(agent agentstatus.Agent) string {
+	return fmt.Sprintf("%v/%v", agent.AgentStatus, agent.AgentConnected)
+}
+
+// ChangedAgents returns the agents that are new or whose state differs from previous, keyed by container
+// instance ARN, and the ARNs in previous that are no longer present
+func ChangedAgents(previous map[string]agentstatus.Agent, current []agentstatus.Agent) ([]agentstatus.Agent, []string) {
+	var changed []agentstatus.Agent
+	seen := make(map[string]bool)
+	for _, agent := range current {
+		seen[agent.ContainerInstanceARN] = true
+		if before, ok := previous[agent.ContainerInstanceARN]; !ok || agentState(before) != agentState(agent) {
+			changed = append(changed, agent)
+		}
+	}
+	var gone []string
+	for arn := range previous {
+		if !seen[arn] {
+			gone = append(gone, arn)
+		}
+	}
+	return changed, gone
+}
+
+// CarryOverFailed returns agents with the agents in previous of the clusters that failed to scan added, so
+// that a cluster failing for one poll is neither reported as gone nor as new again once it recovers. A scan
+// error without a cluster carries over every agent of its region, and one without an account, from a scan
+// of the credentials' own account, matches agents of any account
+func CarryOverFailed(previous map[string]agentstatus.Agent, agents []agentstatus.Agent, scanErrs []ScanError) []agentstatus.Agent {
+	if len(previous) == 0 || len(scanErrs) == 0 {
+		return agents
+	}
+	carried := agents
+	for _, before := range previous {
+		for _, scanErr := range scanErrs {
+			if (scanErr.AccountID == "" || scanErr.AccountID == before.AccountID) && scanErr.Region == before.Region && (scanErr.Cluster == "" || scanErr.Cluster == before.Cluster) {
+				carried = append(carried, before)
+				break
+			}
+		}
+	}
+	return carried
+}
+
+// writeChanges prints agents in the watch output format: a text line or a JSON line per agent
+func writeChanges(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	if opts.Output == "jsonl" {
+		return WriteJSONL(w, agents)
+	}
+	for _, agent := range agents {
+		if _, err := fmt.Fprintln(w, FormatAgent(agent, opts)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnhealthyChanged reports whether an agent became unhealthy under policy or recovered between the previous
+// poll and the current one, including unhealthy agents that appeared and ones that disappeared. The first
+// poll, without previous agents, counts as a change when any agent is unhealthy
+func UnhealthyChanged(previous map[string]agentstatus.Agent, current []agentstatus.Agent, policy agentstatus.HealthPolicy) bool {
+	seen := make(map[string]bool)
+	for _, agent := range current {
+		seen[agent.ContainerInstanceARN] = true
+		before, ok := previous[agent.ContainerInstanceARN]
+		if policy.Unhealthy(agent) != (ok && policy.Unhealthy(before)) {
+			return true
+		}
+	}
+	for arn, before := range previous {
+		if !seen[arn] && policy.Unhealthy(before) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextPollDelay returns how long Watch waits before the next poll: the interval, doubled for each of the
+// consecutive failed polls up to maxBackoff, plus up to jitter times the interval chosen by random, which
+// returns a number in [0, 1)
+func NextPollDelay(interval time.Duration, failures int, maxBackoff time.Duration, jitter float64, random func() float64) time.Duration {
+	delay := interval
+	for i := 0; i < failures && delay < maxBackoff; i++ {
+		delay = min(2*delay, maxBackoff)
+	}
+	return delay + time.Duration(random()*jitter*float64(interval))
+}
+
+// Watch polls the clusters every opts.Interval, plus up to --jitter of it, until ctx is cancelled. The
+// first poll prints every agent, later polls print only agents that appeared or changed status or
+// connectivity and log those that disappeared. The agents of clusters that fail to scan keep their state
+// from the previous poll. Polls that fail are logged and retried with exponential backoff up to
+// --max-poll-backoff; an error writing the output stops the watch. Notifications are sent after every poll
+// finding unhealthy agents, or with --notify-on-change only when one became unhealthy or recovered
+func Watch(ctx context.Context, cfgs map[string]aws.Config, checkers map[string]*agentstatus.StatusChecker, opts Options) error {
+	var previous map[string]agentstatus.Agent
+	failures := 0
+	for {
+		pollCtx, cancel := WithTimeout(ctx, opts.Timeout)
+		apiBudget.Reset()
+		agents, _, scanErrs, err := Scan(pollCtx, checkers, opts, nil)
+		if err == nil {
+			// A poll cut short by its timeout is incomplete, and diffing it would report missing agents as gone
+			err = pollCtx.Err()
+		}
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			logger.Info().Msg("stopping watch")
+			return nil
+		case err != nil && !errors.Is(err, agentstatus.ErrNoClustersMatched):
+			failures++
+			logger.Error().Err(err).Int("failures", failures).Msgf("error polling clusters: %v", err)
+		default:
+			failures = 0
+			agents = CarryOverFailed(previous, agents, scanErrs)
+			changed, gone := ChangedAgents(previous, agents)
+			if err := writeChanges(os.Stdout, changed, opts); err != nil {
+				return err
+			}
+			if opts.LogAgents {
+				LogAgents(logger, changed, opts.HealthPolicy)
+			}
+			for _, arn := range gone {
+				before := previous[arn]
+				logger.Warn().Str("cluster", before.Cluster).Str("containerInstanceArn", arn).
+					Msgf("container instance %v is no longer registered in cluster %v", arn, before.Cluster)
+			}
+			if previous != nil {
+				for _, agent := range changed {
+					logger.Info().Str("cluster", agent.Cluster).Str("containerInstanceArn", agent.ContainerInstanceARN).
+						Str("agentStatus", agent.AgentStatus).Bool("agentConnected", agent.AgentConnected).
+						Msgf("agent on %v is now %v (connected: %v)", agent.EC2InstanceID, agent.AgentStatus, agent.AgentConnected)
+				}
+			}
+			if !opts.NotifyOnChange || UnhealthyChanged(previous, agents, opts.HealthPolicy) {
+				previousAgents := make([]agentstatus.Agent, 0, len(previous))
+				for _, agent := range previous {
+					previousAgents = append(previousAgents, agent)
+				}
+				now := time.Now()
+				transitions := Transitions(NewState(previousAgents, now), NewState(agents, now))
+				Notify(ctx, cfgs, agents, transitions, opts, opts.NotifyOnChange)
+			}
+			previous = make(map[string]agentstatus.Agent)
+			for _, agent := range agents {
+				previous[agent.ContainerInstanceARN] = agent
+			}
+		}
+		delay := NextPollDelay(opts.Interval, failures, opts.MaxPollBackoff, opts.Jitter, rand.Float64)
+		if failures > 0 {
+			logger.Warn().Int("failures", failures).Dur("delay", delay).Msgf("polling again in %v after %v failed polls", delay.Round(time.Second), failures)
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info().Msg("stopping watch")
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
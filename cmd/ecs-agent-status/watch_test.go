@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestChangedAgents(t *testing.T) {
+	previous := map[string]agentstatus.Agent{
+		"arn/a": {ContainerInstanceARN: "arn/a", AgentStatus: "ACTIVE"},
+		"arn/b": {ContainerInstanceARN: "arn/b", AgentStatus: "ACTIVE"},
+		"arn/c": {ContainerInstanceARN: "arn/c", AgentStatus: "ACTIVE"},
+	}
+	current := []agentstatus.Agent{
+		{ContainerInstanceARN: "arn/a", AgentStatus: "ACTIVE"},
+		{ContainerInstanceARN: "arn/b", AgentStatus: "DRAINING"},
+		{ContainerInstanceARN: "arn/d", AgentStatus: "ACTIVE"},
+	}
+	changed, gone := ChangedAgents(previous, current)
+	if want := current[1:]; !reflect.DeepEqual(changed, want) {
+		t.Errorf("ChangedAgents() changed = %v, want %v", changed, want)
+	}
+	if want := []string{"arn/c"}; !reflect.DeepEqual(gone, want) {
+		t.Errorf("ChangedAgents() gone = %v, want %v", gone, want)
+	}
+
+	// Every agent is new on the first poll
+	changed, gone = ChangedAgents(nil, current)
+	if !reflect.DeepEqual(changed, current) || gone != nil {
+		t.Errorf("ChangedAgents(nil) = %v, %v, want all agents and nothing gone", changed, gone)
+	}
+}
+
+func TestUnhealthyChanged(t *testing.T) {
+	policy := agentstatus.HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}
+	healthy := agentstatus.Agent{ContainerInstanceARN: "arn/a", AgentStatus: "ACTIVE", AgentConnected: true}
+	disconnected := agentstatus.Agent{ContainerInstanceARN: "arn/a", AgentStatus: "ACTIVE"}
+	for _, tc := range []struct {
+		name     string
+		previous map[string]agentstatus.Agent
+		current  []agentstatus.Agent
+		want     bool
+	}{
+		{"first poll healthy", nil, []agentstatus.Agent{healthy}, false},
+		{"first poll unhealthy", nil, []agentstatus.Agent{disconnected}, true},
+		{"still unhealthy", map[string]agentstatus.Agent{"arn/a": disconnected}, []agentstatus.Agent{disconnected}, false},
+		{"disconnected", map[string]agentstatus.Agent{"arn/a": healthy}, []agentstatus.Agent{disconnected}, true},
+		{"recovered", map[string]agentstatus.Agent{"arn/a": disconnected}, []agentstatus.Agent{healthy}, true},
+		{"unhealthy deregistered", map[string]agentstatus.Agent{"arn/a": disconnected}, nil, true},
+		{"healthy deregistered", map[string]agentstatus.Agent{"arn/a": healthy}, nil, false},
+	} {
+		if got := UnhealthyChanged(tc.previous, tc.current, policy); got != tc.want {
+			t.Errorf("UnhealthyChanged() %v = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNextPollDelay(t *testing.T) {
+	none := func() float64 { return 0 }
+	for _, tc := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{3, 4 * time.Minute},
+		{10, 10 * time.Minute},
+	} {
+		if got := NextPollDelay(30*time.Second, tc.failures, 10*time.Minute, 0.1, none); got != tc.want {
+			t.Errorf("NextPollDelay() after %v failures = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+	if got := NextPollDelay(30*time.Second, 2, 0, 0.1, func() float64 { return 0.5 }); got != 31500*time.Millisecond {
+		t.Errorf("NextPollDelay() without backoff and half the jitter = %v, want 31.5s", got)
+	}
+}
+
+func TestCarryOverFailed(t *testing.T) {
+	policy := agentstatus.HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}
+	web := agentstatus.Agent{Region: "us-east-1", AccountID: "123456789012", Cluster: "web", ContainerInstanceARN: "arn/a", AgentStatus: "ACTIVE"}
+	batch := agentstatus.Agent{Region: "us-east-1", Cluster: "batch", ContainerInstanceARN: "arn/b", AgentStatus: "ACTIVE", AgentConnected: true}
+	other := agentstatus.Agent{Region: "eu-west-1", Cluster: "web", ContainerInstanceARN: "arn/c", AgentStatus: "ACTIVE", AgentConnected: true}
+	previous := map[string]agentstatus.Agent{"arn/a": web, "arn/b": batch, "arn/c": other}
+
+	// web fails on the second poll: its disconnected agent is neither gone nor recovered
+	current := CarryOverFailed(previous, []agentstatus.Agent{batch, other}, []ScanError{{Region: "us-east-1", Cluster: "web", Error: "ThrottlingException"}})
+	changed, gone := ChangedAgents(previous, current)
+	if changed != nil || gone != nil {
+		t.Errorf("ChangedAgents() after web failed = %v, %v, want no changes", changed, gone)
+	}
+	if UnhealthyChanged(previous, current, policy) {
+		t.Error("UnhealthyChanged() after web failed = true, want false")
+	}
+
+	// Listing the clusters of us-east-1 fails: only its agents are carried over
+	current = CarryOverFailed(previous, nil, []ScanError{{Region: "us-east-1", Error: "AccessDeniedException"}})
+	if changed, gone = ChangedAgents(previous, current); changed != nil || !reflect.DeepEqual(gone, []string{"arn/c"}) {
+		t.Errorf("ChangedAgents() after us-east-1 failed = %v, %v, want only arn/c gone", changed, gone)
+	}
+
+	// Nothing is carried over on the first poll
+	if got := CarryOverFailed(nil, []agentstatus.Agent{batch}, []ScanError{{Region: "us-east-1", Cluster: "web"}}); !reflect.DeepEqual(got, []agentstatus.Agent{batch}) {
+		t.Errorf("CarryOverFailed(nil) = %v, want only the scanned agents", got)
+	}
+}
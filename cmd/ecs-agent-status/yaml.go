@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+	"gopkg.in/yaml.v3"
+)
+
+// WriteYAML writes the agents to w as YAML with the same structure and field names as --output json
+func WriteYAML(w io.Writer, agents []agentstatus.Agent, opts Options) error {
+	return encodeYAML(w, reportValue(agents, opts))
+}
+
+// encodeYAML writes value to w as YAML. The value is converted through its JSON encoding, which YAML is a
+// superset of, so the json struct tags, omitempty and the key order of the JSON output carry over
+func encodeYAML(w io.Writer, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	// Drop the flow style and quoting of the JSON source so the output is block-style YAML
+	var clearStyle func(*yaml.Node)
+	clearStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			clearStyle(child)
+		}
+	}
+	clearStyle(&node)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/pkg/agentstatus"
+)
+
+func TestWriteYAML(t *testing.T) {
+	registered := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	agents := []agentstatus.Agent{{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE",
+		AgentConnected: true, RunningTasks: 2, RegisteredAt: &registered}}
+	var buf bytes.Buffer
+	if err := WriteYAML(&buf, agents, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	want := `- region: us-east-1
+  cluster: web
+  containerInstanceArn: ""
+  ec2InstanceId: i-aaaa
+  agentStatus: ACTIVE
+  agentConnected: true
+  launchType: ""
+  registeredCpu: 0
+  registeredMemory: 0
+  remainingCpu: 0
+  remainingMemory: 0
+  runningTasks: 2
+  pendingTasks: 0
+  registeredAt: "2024-05-02T10:00:00Z"
+`
+	if buf.String() != want {
+		t.Errorf("WriteYAML() =\n%v\nwant\n%v", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteYAML(&buf, agents, Options{Summary: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "agents:\n") || !strings.Contains(buf.String(), "summaries:\n") {
+		t.Errorf("WriteYAML() with --summary is not a report object:\n%v", buf.String())
+	}
+}
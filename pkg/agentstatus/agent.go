@@ -0,0 +1,546 @@
+// Package agentstatus checks the status of the ECS agents on the container instances of ECS clusters
+package agentstatus
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Agent is a struct that contains information about an ECS agent
+type Agent struct {
+	Region  string `json:"region"`
+	Cluster string `json:"cluster"`
+	// ClusterARN identifies the cluster across accounts and regions, unlike its name
+	ClusterARN           string `json:"clusterArn,omitempty"`
+	ContainerInstanceARN string `json:"containerInstanceArn"`
+	EC2InstanceID        string `json:"ec2InstanceId"`
+	ManagedInstanceID    string `json:"managedInstanceId,omitempty"`
+	AgentStatus          string `json:"agentStatus"`
+	AgentConnected       bool   `json:"agentConnected"`
+	// DisconnectedSince is when the agent was first seen disconnected, and DisconnectedForSeconds how long
+	// ago that was. They are only known to programs keeping the state of earlier checks
+	DisconnectedSince      *time.Time `json:"disconnectedSince,omitempty"`
+	DisconnectedForSeconds int64      `json:"disconnectedForSeconds,omitempty"`
+	LaunchType             string     `json:"launchType"`
+	AgentUpdateStatus      string     `json:"agentUpdateStatus,omitempty"`
+	RegisteredCPU          int32      `json:"registeredCpu"`
+	RegisteredMemory       int32      `json:"registeredMemory"`
+	RemainingCPU           int32      `json:"remainingCpu"`
+	RemainingMemory        int32      `json:"remainingMemory"`
+	RunningTasks           int        `json:"runningTasks"`
+	PendingTasks           int        `json:"pendingTasks"`
+	Tasks                  []Task     `json:"tasks,omitempty"`
+	FailureReason          string     `json:"failureReason,omitempty"`
+	RegisteredAt           *time.Time `json:"registeredAt,omitempty"`
+	AgeSeconds             int64      `json:"ageSeconds,omitempty"`
+	AgentVersion           string     `json:"agentVersion,omitempty"`
+	VersionDrift           bool       `json:"versionDrift,omitempty"`
+	DockerVersion          string     `json:"dockerVersion,omitempty"`
+	DockerVersionDrift     bool       `json:"dockerVersionDrift,omitempty"`
+	DockerAPIVersion       string     `json:"dockerApiVersion,omitempty"`
+	ContainerdVersion      string     `json:"containerdVersion,omitempty"`
+	OSType                 string     `json:"osType,omitempty"`
+	OSFamily               string     `json:"osFamily,omitempty"`
+	SSMPingStatus          string     `json:"ssmPingStatus,omitempty"`
+	AgentLog               []string   `json:"agentLog,omitempty"`
+	Outdated               bool       `json:"outdated,omitempty"`
+	// DuplicateRegistrations, only set by MarkDuplicateRegistrations, are the ARNs of the other container
+	// instances registered for the same instance
+	DuplicateRegistrations []string   `json:"duplicateRegistrations,omitempty"`
+	InstanceType           string     `json:"instanceType,omitempty"`
+	AvailabilityZone       string     `json:"availabilityZone,omitempty"`
+	LaunchTime             *time.Time `json:"launchTime,omitempty"`
+	PrivateIP              string     `json:"privateIp,omitempty"`
+	ImageID                string     `json:"imageId,omitempty"`
+	// LaunchTemplateID and LaunchTemplateVersion are the launch template the instance was launched from.
+	// CurrentLaunchTemplateVersion and LaunchTemplateDrift are only set by MarkLaunchTemplateDrift
+	LaunchTemplateID             string           `json:"launchTemplateId,omitempty"`
+	LaunchTemplateVersion        string           `json:"launchTemplateVersion,omitempty"`
+	CurrentLaunchTemplateVersion string           `json:"currentLaunchTemplateVersion,omitempty"`
+	LaunchTemplateDrift          bool             `json:"launchTemplateDrift,omitempty"`
+	SystemStatus                 string           `json:"systemStatus,omitempty"`
+	InstanceStatus               string           `json:"instanceStatus,omitempty"`
+	ScheduledEvents              []ScheduledEvent `json:"scheduledEvents,omitempty"`
+	AutoScalingGroup             string           `json:"autoScalingGroup,omitempty"`
+	// LifecycleState is the Auto Scaling lifecycle state of the instance, e.g. InService, Pending:Wait or
+	// Warmed:Stopped, and WarmPool whether it is in the warm pool of its group. Both are only set by
+	// EnrichWithLifecycleState
+	LifecycleState   string            `json:"lifecycleState,omitempty"`
+	WarmPool         bool              `json:"warmPool,omitempty"`
+	CapacityProvider string            `json:"capacityProvider,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	// Attributes are the container instance attributes named by the Attributes of the checker, e.g. a
+	// custom attribute such as stack or ecs.ami-id, that the instance has
+	Attributes map[string]string `json:"attributes,omitempty"`
+	AccountID  string            `json:"accountId,omitempty"`
+	// Raw is the container instance as described by ECS, kept only by checkers with IncludeRaw. Its fields
+	// are named as in the ECS API, e.g. Attributes and RegisteredResources
+	Raw *types.ContainerInstance `json:"raw,omitempty"`
+}
+
+// InstanceID returns the EC2 instance ID of the agent, or the SSM managed instance ID of an external agent
+func (a Agent) InstanceID() string {
+	if a.ManagedInstanceID != "" {
+		return a.ManagedInstanceID
+	}
+	return a.EC2InstanceID
+}
+
+func (a Agent) String() string {
+	return fmt.Sprintf("Cluster: %v, ContainerInstanceARN: %v, EC2InstanceID: %v, AgentStatus: %v, AgentConnected: %v, RunningTasks: %v, PendingTasks: %v, Region: %v", a.Cluster, a.ContainerInstanceARN, a.EC2InstanceID, a.AgentStatus, a.AgentConnected, a.RunningTasks, a.PendingTasks, a.Region)
+}
+
+// resourceValue returns the integer value of the named resource (CPU, MEMORY) or 0 if it is absent
+func resourceValue(resources []types.Resource, name string) int32 {
+	for _, resource := range resources {
+		if aws.ToString(resource.Name) == name {
+			return resource.IntegerValue
+		}
+	}
+	return 0
+}
+
+// dockerRemoteAPIAttribute starts the attributes the ECS agent registers for each Docker remote API version
+// the Docker daemon of the instance supports, e.g. com.amazonaws.ecs.capability.docker-remote-api.1.44
+const dockerRemoteAPIAttribute = "com.amazonaws.ecs.capability.docker-remote-api."
+
+// ContainerdVersionAttribute is the custom attribute read as the containerd version of a container instance.
+// ECS does not report containerd, so it is only known when the instance registers it, e.g. with
+// ECS_INSTANCE_ATTRIBUTES={"containerd.version":"1.7.11"} in its ECS agent config
+const ContainerdVersionAttribute = "containerd.version"
+
+// Attributes ECS sets on every container instance with its operating system
+const (
+	// OSTypeAttribute is linux or windows
+	OSTypeAttribute = "ecs.os-type"
+	// OSFamilyAttribute is e.g. LINUX or WINDOWS_SERVER_2022_CORE
+	OSFamilyAttribute = "ecs.os-family"
+)
+
+// Operating system types of container instances, the values of OSTypeAttribute
+const (
+	OSTypeLinux   = "linux"
+	OSTypeWindows = "windows"
+)
+
+// attributeValue returns the value of the named attribute, or "" if the container instance does not have it
+func attributeValue(attributes []types.Attribute, name string) string {
+	for _, attribute := range attributes {
+		if aws.ToString(attribute.Name) == name {
+			return aws.ToString(attribute.Value)
+		}
+	}
+	return ""
+}
+
+// AttributeValues returns the values of the named attributes that the container instance has, or nil if it
+// has none of them
+func AttributeValues(attributes []types.Attribute, names []string) map[string]string {
+	var values map[string]string
+	for _, attribute := range attributes {
+		if name := aws.ToString(attribute.Name); slices.Contains(names, name) {
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = aws.ToString(attribute.Value)
+		}
+	}
+	return values
+}
+
+// runtimeAttributes returns the highest Docker remote API version and the containerd version found in the
+// attributes of a container instance
+func runtimeAttributes(attributes []types.Attribute) (string, string) {
+	var apiVersion, containerdVersion string
+	for _, attribute := range attributes {
+		name := aws.ToString(attribute.Name)
+		switch {
+		case strings.HasPrefix(name, dockerRemoteAPIAttribute):
+			version := strings.TrimPrefix(name, dockerRemoteAPIAttribute)
+			if apiVersion == "" || CompareVersions(version, apiVersion) > 0 {
+				apiVersion = version
+			}
+		case name == ContainerdVersionAttribute:
+			containerdVersion = aws.ToString(attribute.Value)
+		}
+	}
+	return apiVersion, containerdVersion
+}
+
+// Launch types of container instances
+const (
+	// LaunchTypeEC2 is a container instance running on an EC2 instance
+	LaunchTypeEC2 = "ec2"
+	// LaunchTypeExternal is an ECS Anywhere container instance on an on-premises server or VM
+	LaunchTypeExternal = "external"
+)
+
+// externalInstanceIDPrefix starts the SSM managed instance IDs that ECS reports as the instance ID of ECS
+// Anywhere container instances
+const externalInstanceIDPrefix = "mi-"
+
+// launchType returns LaunchTypeExternal for container instances without an EC2 instance ID or with an SSM
+// managed instance ID, and LaunchTypeEC2 otherwise
+func launchType(instance types.ContainerInstance) string {
+	id := aws.ToString(instance.Ec2InstanceId)
+	if id == "" || strings.HasPrefix(id, externalInstanceIDPrefix) {
+		return LaunchTypeExternal
+	}
+	return LaunchTypeEC2
+}
+
+// NewAgent builds an Agent from the ECS description of a container instance. ECS reports the SSM managed
+// instance ID of external instances as their EC2 instance ID, so it is moved to ManagedInstanceID
+func NewAgent(clusterName string, instance types.ContainerInstance) Agent {
+	var agentVersion, dockerVersion string
+	if instance.VersionInfo != nil {
+		agentVersion = aws.ToString(instance.VersionInfo.AgentVersion)
+		dockerVersion = aws.ToString(instance.VersionInfo.DockerVersion)
+	}
+	dockerAPIVersion, containerdVersion := runtimeAttributes(instance.Attributes)
+	agent := Agent{
+		Cluster:              clusterName,
+		ContainerInstanceARN: aws.ToString(instance.ContainerInstanceArn),
+		EC2InstanceID:        aws.ToString(instance.Ec2InstanceId),
+		AgentStatus:          aws.ToString(instance.Status),
+		AgentConnected:       instance.AgentConnected,
+		LaunchType:           launchType(instance),
+		AgentUpdateStatus:    string(instance.AgentUpdateStatus),
+		RegisteredCPU:        resourceValue(instance.RegisteredResources, "CPU"),
+		RegisteredMemory:     resourceValue(instance.RegisteredResources, "MEMORY"),
+		RemainingCPU:         resourceValue(instance.RemainingResources, "CPU"),
+		RemainingMemory:      resourceValue(instance.RemainingResources, "MEMORY"),
+		RunningTasks:         int(instance.RunningTasksCount),
+		PendingTasks:         int(instance.PendingTasksCount),
+		RegisteredAt:         instance.RegisteredAt,
+		AgentVersion:         agentVersion,
+		DockerVersion:        dockerVersion,
+		DockerAPIVersion:     dockerAPIVersion,
+		ContainerdVersion:    containerdVersion,
+		OSType:               attributeValue(instance.Attributes, OSTypeAttribute),
+		OSFamily:             attributeValue(instance.Attributes, OSFamilyAttribute),
+		CapacityProvider:     aws.ToString(instance.CapacityProviderName),
+	}
+	agent.setScope()
+	if strings.HasPrefix(agent.EC2InstanceID, externalInstanceIDPrefix) {
+		agent.ManagedInstanceID, agent.EC2InstanceID = agent.EC2InstanceID, ""
+	}
+	return agent
+}
+
+// AgentsFromDescribeOutput builds Agent structs from a DescribeContainerInstances response. Each entry in
+// Failures (e.g. an instance that deregistered mid-scan) is logged and reported as an Agent with status UNKNOWN
+func AgentsFromDescribeOutput(clusterName string, output *ecs.DescribeContainerInstancesOutput) []Agent {
+	var agents []Agent
+	for _, instance := range output.ContainerInstances {
+		agents = append(agents, NewAgent(clusterName, instance))
+	}
+	for _, failure := range output.Failures {
+		logger.Warn().Str("cluster", clusterName).Str("arn", aws.ToString(failure.Arn)).Str("reason", aws.ToString(failure.Reason)).Msg("failed to describe container instance")
+		agent := Agent{
+			Cluster:              clusterName,
+			ContainerInstanceARN: aws.ToString(failure.Arn),
+			AgentStatus:          "UNKNOWN",
+			FailureReason:        aws.ToString(failure.Reason),
+		}
+		agent.setScope()
+		agents = append(agents, agent)
+	}
+	return agents
+}
+
+// setScope sets the region, account and cluster ARN of the agent from the ARN of its container instance,
+// arn:aws:ecs:region:account:container-instance/cluster/id, and its cluster name, which may itself be an
+// ARN. Agents whose container instance ARN cannot be parsed are left unchanged
+func (a *Agent) setScope() {
+	parsed, err := arn.Parse(a.ContainerInstanceARN)
+	if err != nil {
+		return
+	}
+	a.Region, a.AccountID = parsed.Region, parsed.AccountID
+	if arn.IsARN(a.Cluster) {
+		a.ClusterARN = a.Cluster
+		a.Cluster = ClusterNameFromArn(a.Cluster)
+		return
+	}
+	a.ClusterARN = arn.ARN{Partition: parsed.Partition, Service: parsed.Service, Region: parsed.Region, AccountID: parsed.AccountID,
+		Resource: "cluster/" + a.Cluster}.String()
+}
+
+// SetAges sets the AgeSeconds of each agent with a registration time to how long before now it registered
+func SetAges(agents []Agent, now time.Time) {
+	for i := range agents {
+		if agents[i].RegisteredAt != nil {
+			agents[i].AgeSeconds = int64(now.Sub(*agents[i].RegisteredAt) / time.Second)
+		}
+	}
+}
+
+// FilterMinAge returns the agents registered at least minAge before now, leaving out instances that may
+// still be bootstrapping. Agents without a registration time are kept. A zero minAge returns all agents
+func FilterMinAge(agents []Agent, minAge time.Duration, now time.Time) []Agent {
+	if minAge == 0 {
+		return agents
+	}
+	var filtered []Agent
+	for _, agent := range agents {
+		if agent.RegisteredAt == nil || now.Sub(*agent.RegisteredAt) >= minAge {
+			filtered = append(filtered, agent)
+		}
+	}
+	return filtered
+}
+
+// FilterSince returns the agents registered within since of now. Agents without a registration time are
+// kept. A zero since returns all agents
+func FilterSince(agents []Agent, since time.Duration, now time.Time) []Agent {
+	if since == 0 {
+		return agents
+	}
+	var filtered []Agent
+	for _, agent := range agents {
+		if agent.RegisteredAt == nil || now.Sub(*agent.RegisteredAt) <= since {
+			filtered = append(filtered, agent)
+		}
+	}
+	return filtered
+}
+
+// HasInstanceID reports whether id is the EC2 or SSM managed instance ID of the agent, or the ARN or ID of
+// its container instance
+func (a Agent) HasInstanceID(id string) bool {
+	if id == "" {
+		return false
+	}
+	return a.InstanceID() == id || a.ContainerInstanceARN == id || strings.HasSuffix(a.ContainerInstanceARN, "/"+id)
+}
+
+// FilterInstances returns the agents whose EC2 or SSM managed instance ID, or container instance ARN or
+// ID, is in instanceIDs. An empty instanceIDs returns all agents
+func FilterInstances(agents []Agent, instanceIDs []string) []Agent {
+	if len(instanceIDs) == 0 {
+		return agents
+	}
+	var filtered []Agent
+	for _, agent := range agents {
+		for _, id := range instanceIDs {
+			if agent.HasInstanceID(id) {
+				filtered = append(filtered, agent)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// FilterPlatform returns the agents whose OSType is platform, e.g. OSTypeWindows. An empty platform or all
+// returns all agents
+func FilterPlatform(agents []Agent, platform string) []Agent {
+	if platform == "" || platform == "all" {
+		return agents
+	}
+	var filtered []Agent
+	for _, agent := range agents {
+		if agent.OSType == platform {
+			filtered = append(filtered, agent)
+		}
+	}
+	return filtered
+}
+
+// FilterTags returns the agents whose EC2 instance has every tag in tags with the same value. An empty tags
+// returns all agents
+func FilterTags(agents []Agent, tags map[string]string) []Agent {
+	if len(tags) == 0 {
+		return agents
+	}
+	var filtered []Agent
+	for _, agent := range agents {
+		matches := true
+		for key, value := range tags {
+			if actual, ok := agent.Tags[key]; !ok || actual != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			filtered = append(filtered, agent)
+		}
+	}
+	return filtered
+}
+
+// FilterExternal returns the agents that are not external (ECS Anywhere) container instances
+func FilterExternal(agents []Agent) []Agent {
+	var filtered []Agent
+	for _, agent := range agents {
+		if agent.LaunchType != LaunchTypeExternal {
+			filtered = append(filtered, agent)
+		}
+	}
+	return filtered
+}
+
+// MissingInstances returns the instance IDs, or container instance ARNs or IDs, in instanceIDs that do not
+// belong to any agent
+func MissingInstances(agents []Agent, instanceIDs []string) []string {
+	var missing []string
+	for _, id := range instanceIDs {
+		if !slices.ContainsFunc(agents, func(agent Agent) bool { return agent.HasInstanceID(id) }) {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// MarkVersionDrift finds the most common agent version across agents (ties go to the greater version
+// string) and sets VersionDrift on every agent running a different version. Agents without a version, such
+// as UNKNOWN ones, are ignored. It returns the majority version and the number of drifting agents
+func MarkVersionDrift(agents []Agent) (string, int) {
+	return markDrift(agents, func(agent Agent) string { return agent.AgentVersion }, func(agent *Agent) { agent.VersionDrift = true })
+}
+
+// MarkDockerVersionDrift is MarkVersionDrift for the Docker version: it sets DockerVersionDrift on every
+// agent whose Docker version differs from the most common one, and returns that version and the number of
+// drifting agents
+func MarkDockerVersionDrift(agents []Agent) (string, int) {
+	return markDrift(agents, func(agent Agent) string { return agent.DockerVersion }, func(agent *Agent) { agent.DockerVersionDrift = true })
+}
+
+// markDrift finds the most common non-empty version of the agents of each OSType, ties going to the greater
+// version string, and calls mark on every agent with a different one than its OSType, so Windows and Linux
+// instances, which run different agent and Docker builds, are each compared with their own platform. It
+// returns the majority version of the OSType with the most versioned agents
+func markDrift(agents []Agent, version func(Agent) string, mark func(*Agent)) (string, int) {
+	counts := make(map[string]map[string]int)
+	totals := make(map[string]int)
+	for _, agent := range agents {
+		if v := version(agent); v != "" {
+			if counts[agent.OSType] == nil {
+				counts[agent.OSType] = make(map[string]int)
+			}
+			counts[agent.OSType][v]++
+			totals[agent.OSType]++
+		}
+	}
+	majorities := make(map[string]string)
+	var largest string
+	for osType, versions := range counts {
+		var majority string
+		for v, count := range versions {
+			if count > versions[majority] || (count == versions[majority] && v > majority) {
+				majority = v
+			}
+		}
+		majorities[osType] = majority
+		if totals[osType] > totals[largest] || (totals[osType] == totals[largest] && osType < largest) {
+			largest = osType
+		}
+	}
+	drifting := 0
+	for i := range agents {
+		if v := version(agents[i]); v != "" && v != majorities[agents[i].OSType] {
+			mark(&agents[i])
+			drifting++
+		}
+	}
+	return majorities[largest], drifting
+}
+
+// MarkDuplicateRegistrations sets DuplicateRegistrations on every agent whose EC2 or managed instance is
+// registered as other container instances too, in the same cluster or in others, e.g. a stale registration
+// left behind when user data registered the instance again or to another cluster. The agents should cover
+// every scanned cluster. It returns the number of instances registered more than once
+func MarkDuplicateRegistrations(agents []Agent) int {
+	byInstance := make(map[string][]int)
+	for i, agent := range agents {
+		if id := agent.InstanceID(); id != "" && agent.ContainerInstanceARN != "" {
+			byInstance[id] = append(byInstance[id], i)
+		}
+	}
+	duplicated := 0
+	for _, indexes := range byInstance {
+		if len(indexes) < 2 {
+			continue
+		}
+		duplicated++
+		for _, i := range indexes {
+			agents[i].DuplicateRegistrations = nil
+			for _, j := range indexes {
+				if j != i {
+					agents[i].DuplicateRegistrations = append(agents[i].DuplicateRegistrations, agents[j].ContainerInstanceARN)
+				}
+			}
+		}
+	}
+	return duplicated
+}
+
+// MarkOutdated sets Outdated on every agent whose version is older than minVersion and returns how many
+// were marked. Agents without a version are ignored
+func MarkOutdated(agents []Agent, minVersion string) int {
+	outdated := 0
+	for i := range agents {
+		if agents[i].AgentVersion != "" && CompareVersions(agents[i].AgentVersion, minVersion) < 0 {
+			agents[i].Outdated = true
+			outdated++
+		}
+	}
+	return outdated
+}
+
+// UnhealthyAgents returns the agents that are not ACTIVE
+func UnhealthyAgents(agents []Agent) []Agent {
+	return DefaultHealthPolicy.UnhealthyAgents(agents)
+}
+
+// UnhealthyPercent returns the number of non-ACTIVE agents and their percentage of all agents
+func UnhealthyPercent(agents []Agent) (int, float64) {
+	return DefaultHealthPolicy.UnhealthyPercent(agents)
+}
+
+// GroupByCluster groups agents by cluster name. The cluster names are returned in the order they first appear
+func GroupByCluster(agents []Agent) ([]string, map[string][]Agent) {
+	return GroupBy(agents, func(agent Agent) string { return agent.Cluster })
+}
+
+// GroupBy groups agents by the value key returns for each. The keys are returned in the order they first
+// appear
+func GroupBy(agents []Agent, key func(Agent) string) ([]string, map[string][]Agent) {
+	var keys []string
+	groups := make(map[string][]Agent)
+	for _, agent := range agents {
+		k := key(agent)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], agent)
+	}
+	return keys, groups
+}
+
+// CompareLocation orders agents by account, region, cluster and instance ID, then by container instance ARN
+// to break ties between registrations of the same instance, returning a negative number when a comes first
+func CompareLocation(a, b Agent) int {
+	return cmp.Or(
+		cmp.Compare(a.AccountID, b.AccountID),
+		cmp.Compare(a.Region, b.Region),
+		cmp.Compare(a.Cluster, b.Cluster),
+		cmp.Compare(a.InstanceID(), b.InstanceID()),
+		cmp.Compare(a.ContainerInstanceARN, b.ContainerInstanceARN),
+	)
+}
+
+// SortByLocation sorts agents in place by CompareLocation, so that the agents of clusters scanned in
+// parallel, in any number of accounts and regions, are always in the same order
+func SortByLocation(agents []Agent) {
+	slices.SortStableFunc(agents, CompareLocation)
+}
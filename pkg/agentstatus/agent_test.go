@@ -0,0 +1,394 @@
+package agentstatus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestAgentsFromDescribeOutput(t *testing.T) {
+	output := &ecs.DescribeContainerInstancesOutput{
+		ContainerInstances: []types.ContainerInstance{
+			{
+				ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/aaaa"),
+				Ec2InstanceId:        aws.String("i-0123456789abcdef0"),
+				Status:               aws.String("ACTIVE"),
+				AgentConnected:       true,
+			},
+		},
+		Failures: []types.Failure{
+			{
+				Arn:    aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/bbbb"),
+				Reason: aws.String("MISSING"),
+			},
+		},
+	}
+	want := []Agent{
+		{
+			Region:               "us-east-1",
+			AccountID:            "123456789012",
+			Cluster:              "production",
+			ClusterARN:           "arn:aws:ecs:us-east-1:123456789012:cluster/production",
+			ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/production/aaaa",
+			EC2InstanceID:        "i-0123456789abcdef0",
+			AgentStatus:          "ACTIVE",
+			AgentConnected:       true,
+			LaunchType:           LaunchTypeEC2,
+		},
+		{
+			Region:               "us-east-1",
+			AccountID:            "123456789012",
+			Cluster:              "production",
+			ClusterARN:           "arn:aws:ecs:us-east-1:123456789012:cluster/production",
+			ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/production/bbbb",
+			AgentStatus:          "UNKNOWN",
+			FailureReason:        "MISSING",
+		},
+	}
+	if got := AgentsFromDescribeOutput("production", output); !reflect.DeepEqual(got, want) {
+		t.Errorf("AgentsFromDescribeOutput() = %v, want %v", got, want)
+	}
+}
+
+func TestNewAgentTaskCounts(t *testing.T) {
+	tests := []struct {
+		running, pending int32
+	}{{0, 0}, {3, 0}, {0, 2}, {12, 5}}
+	for _, tt := range tests {
+		instance := types.ContainerInstance{
+			ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa"),
+			RunningTasksCount:    tt.running,
+			PendingTasksCount:    tt.pending,
+		}
+		if agent := NewAgent("web", instance); agent.RunningTasks != int(tt.running) || agent.PendingTasks != int(tt.pending) {
+			t.Errorf("NewAgent() with %v running and %v pending tasks = %v running, %v pending", tt.running, tt.pending, agent.RunningTasks, agent.PendingTasks)
+		}
+	}
+}
+
+func TestAgentString(t *testing.T) {
+	agent := Agent{Region: "us-east-1", Cluster: "web", ContainerInstanceARN: "arn:1", EC2InstanceID: "i-aaaa", AgentStatus: "ACTIVE", AgentConnected: true, RunningTasks: 3, PendingTasks: 1}
+	want := "Cluster: web, ContainerInstanceARN: arn:1, EC2InstanceID: i-aaaa, AgentStatus: ACTIVE, AgentConnected: true, RunningTasks: 3, PendingTasks: 1, Region: us-east-1"
+	if got := agent.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestNewAgentClusterARN(t *testing.T) {
+	instance := types.ContainerInstance{ContainerInstanceArn: aws.String("arn:aws-cn:ecs:cn-north-1:123456789012:container-instance/web/aaaa")}
+	agent := NewAgent("arn:aws-cn:ecs:cn-north-1:123456789012:cluster/web", instance)
+	if agent.Cluster != "web" || agent.ClusterARN != "arn:aws-cn:ecs:cn-north-1:123456789012:cluster/web" || agent.Region != "cn-north-1" || agent.AccountID != "123456789012" {
+		t.Errorf("NewAgent() with a cluster ARN = %+v", agent)
+	}
+}
+
+func TestAttributeValues(t *testing.T) {
+	attributes := []types.Attribute{
+		{Name: aws.String("stack"), Value: aws.String("blue")},
+		{Name: aws.String("ecs.ami-id"), Value: aws.String("ami-0123")},
+		{Name: aws.String("com.amazonaws.ecs.capability.docker-remote-api.1.44")},
+	}
+	got := AttributeValues(attributes, []string{"stack", "cohort", "com.amazonaws.ecs.capability.docker-remote-api.1.44"})
+	want := map[string]string{"stack": "blue", "com.amazonaws.ecs.capability.docker-remote-api.1.44": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AttributeValues() = %v, want %v", got, want)
+	}
+	if got := AttributeValues(attributes, []string{"cohort"}); got != nil {
+		t.Errorf("AttributeValues() of a missing attribute = %v, want nil", got)
+	}
+}
+
+func TestNewAgentNilFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance types.ContainerInstance
+		want     Agent
+	}{
+		{
+			name:     "no fields",
+			instance: types.ContainerInstance{},
+			want:     Agent{Cluster: "production", LaunchType: LaunchTypeExternal},
+		},
+		{
+			name:     "version info without versions",
+			instance: types.ContainerInstance{Status: aws.String("ACTIVE"), VersionInfo: &types.VersionInfo{}},
+			want:     Agent{Cluster: "production", AgentStatus: "ACTIVE", LaunchType: LaunchTypeExternal},
+		},
+		{
+			name: "resources without names",
+			instance: types.ContainerInstance{
+				RegisteredResources: []types.Resource{{IntegerValue: 2048}, {Name: aws.String("MEMORY"), IntegerValue: 4096}},
+			},
+			want: Agent{Cluster: "production", LaunchType: LaunchTypeExternal, RegisteredMemory: 4096},
+		},
+		{
+			name:     "external instance",
+			instance: types.ContainerInstance{Ec2InstanceId: aws.String("mi-0123456789abcdef0"), Status: aws.String("ACTIVE")},
+			want:     Agent{Cluster: "production", ManagedInstanceID: "mi-0123456789abcdef0", AgentStatus: "ACTIVE", LaunchType: LaunchTypeExternal},
+		},
+		{
+			name: "runtime attributes",
+			instance: types.ContainerInstance{Attributes: []types.Attribute{
+				{Name: aws.String("com.amazonaws.ecs.capability.docker-remote-api.1.9")},
+				{Name: aws.String("com.amazonaws.ecs.capability.docker-remote-api.1.44")},
+				{Name: aws.String("com.amazonaws.ecs.capability.docker-remote-api.1.32")},
+				{Name: aws.String(ContainerdVersionAttribute), Value: aws.String("1.7.11")},
+				{Name: aws.String("ecs.os-type"), Value: aws.String("linux")},
+			}},
+			want: Agent{Cluster: "production", LaunchType: LaunchTypeExternal, DockerAPIVersion: "1.44", ContainerdVersion: "1.7.11", OSType: OSTypeLinux},
+		},
+		{
+			name: "windows instance",
+			instance: types.ContainerInstance{Ec2InstanceId: aws.String("i-0123456789abcdef0"), Attributes: []types.Attribute{
+				{Name: aws.String("ecs.os-type"), Value: aws.String("windows")},
+				{Name: aws.String("ecs.os-family"), Value: aws.String("WINDOWS_SERVER_2022_CORE")},
+			}},
+			want: Agent{Cluster: "production", EC2InstanceID: "i-0123456789abcdef0", LaunchType: LaunchTypeEC2, OSType: OSTypeWindows, OSFamily: "WINDOWS_SERVER_2022_CORE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewAgent("production", tt.instance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewAgent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterSince(t *testing.T) {
+	now := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-30 * time.Minute)
+	old := now.Add(-48 * time.Hour)
+	agents := []Agent{
+		{EC2InstanceID: "i-recent", RegisteredAt: &recent},
+		{EC2InstanceID: "i-old", RegisteredAt: &old},
+		{EC2InstanceID: "i-unknown"},
+	}
+	got := FilterSince(agents, time.Hour, now)
+	want := []Agent{agents[0], agents[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterSince() = %v, want %v", got, want)
+	}
+	if got := FilterSince(agents, 0, now); len(got) != len(agents) {
+		t.Errorf("FilterSince() with zero duration returned %d agents, want %d", len(got), len(agents))
+	}
+}
+
+func TestFilterMinAge(t *testing.T) {
+	now := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-5 * time.Minute)
+	old := now.Add(-48 * time.Hour)
+	agents := []Agent{
+		{EC2InstanceID: "i-recent", RegisteredAt: &recent},
+		{EC2InstanceID: "i-old", RegisteredAt: &old},
+		{EC2InstanceID: "i-unknown"},
+	}
+	SetAges(agents, now)
+	if agents[0].AgeSeconds != 300 || agents[1].AgeSeconds != 48*3600 || agents[2].AgeSeconds != 0 {
+		t.Errorf("SetAges() = %v, %v, %v", agents[0].AgeSeconds, agents[1].AgeSeconds, agents[2].AgeSeconds)
+	}
+	got := FilterMinAge(agents, 10*time.Minute, now)
+	want := []Agent{agents[1], agents[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterMinAge() = %v, want %v", got, want)
+	}
+	if got := FilterMinAge(agents, 0, now); len(got) != len(agents) {
+		t.Errorf("FilterMinAge() with zero duration returned %d agents, want %d", len(got), len(agents))
+	}
+}
+
+func TestUnhealthyPercent(t *testing.T) {
+	agents := []Agent{
+		{AgentStatus: "ACTIVE"},
+		{AgentStatus: "ACTIVE"},
+		{AgentStatus: "ACTIVE"},
+		{AgentStatus: "DRAINING"},
+	}
+	unhealthy, percent := UnhealthyPercent(agents)
+	if unhealthy != 1 || percent != 25 {
+		t.Errorf("UnhealthyPercent() = %v, %v, want 1, 25", unhealthy, percent)
+	}
+	if unhealthy, percent := UnhealthyPercent(nil); unhealthy != 0 || percent != 0 {
+		t.Errorf("UnhealthyPercent(nil) = %v, %v, want 0, 0", unhealthy, percent)
+	}
+}
+
+func TestFilterInstances(t *testing.T) {
+	agents := []Agent{{EC2InstanceID: "i-aaaa"}, {EC2InstanceID: "i-bbbb"}, {EC2InstanceID: "i-cccc"}}
+	got := FilterInstances(agents, []string{"i-cccc", "i-aaaa", "i-dddd"})
+	if want := []Agent{agents[0], agents[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterInstances() = %v, want %v", got, want)
+	}
+	if missing := MissingInstances(got, []string{"i-cccc", "i-aaaa", "i-dddd"}); !reflect.DeepEqual(missing, []string{"i-dddd"}) {
+		t.Errorf("MissingInstances() = %v, want [i-dddd]", missing)
+	}
+
+	agents[1].ContainerInstanceARN = "arn:aws:ecs:us-east-1:111111111111:container-instance/web/0123456789abcdef"
+	for _, id := range []string{agents[1].ContainerInstanceARN, "0123456789abcdef"} {
+		if got := FilterInstances(agents, []string{id}); len(got) != 1 || got[0].EC2InstanceID != "i-bbbb" {
+			t.Errorf("FilterInstances() by container instance %v = %v, want i-bbbb", id, got)
+		}
+	}
+	if missing := MissingInstances(agents, []string{"0123456789abcdef", "fedcba9876543210"}); !reflect.DeepEqual(missing, []string{"fedcba9876543210"}) {
+		t.Errorf("MissingInstances() of container instance IDs = %v, want [fedcba9876543210]", missing)
+	}
+}
+
+func TestFilterTags(t *testing.T) {
+	agents := []Agent{
+		{EC2InstanceID: "i-aaaa", Tags: map[string]string{"team": "payments", "env": "prod"}},
+		{EC2InstanceID: "i-bbbb", Tags: map[string]string{"team": "search", "env": "prod"}},
+		{EC2InstanceID: "i-cccc"},
+	}
+	if got := FilterTags(agents, nil); len(got) != 3 {
+		t.Errorf("FilterTags() without tags = %v, want every agent", got)
+	}
+	got := FilterTags(agents, map[string]string{"team": "payments", "env": "prod"})
+	if len(got) != 1 || got[0].EC2InstanceID != "i-aaaa" {
+		t.Errorf("FilterTags() = %v, want only i-aaaa", got)
+	}
+}
+
+func TestFilterExternal(t *testing.T) {
+	agents := []Agent{
+		{EC2InstanceID: "i-aaaa", LaunchType: LaunchTypeEC2},
+		{ManagedInstanceID: "mi-bbbb", LaunchType: LaunchTypeExternal},
+	}
+	got := FilterExternal(agents)
+	if len(got) != 1 || got[0].InstanceID() != "i-aaaa" {
+		t.Errorf("FilterExternal() = %v, want only i-aaaa", got)
+	}
+	if got := FilterInstances(agents, []string{"mi-bbbb"}); len(got) != 1 || got[0].InstanceID() != "mi-bbbb" {
+		t.Errorf("FilterInstances() by managed instance ID = %v, want mi-bbbb", got)
+	}
+}
+
+func TestGroupByCluster(t *testing.T) {
+	agents := []Agent{
+		{Cluster: "web", EC2InstanceID: "i-aaaa"},
+		{Cluster: "worker", EC2InstanceID: "i-bbbb"},
+		{Cluster: "web", EC2InstanceID: "i-cccc"},
+	}
+	clusters, groups := GroupByCluster(agents)
+	if want := []string{"web", "worker"}; !reflect.DeepEqual(clusters, want) {
+		t.Errorf("GroupByCluster() clusters = %v, want %v", clusters, want)
+	}
+	if want := []Agent{agents[0], agents[2]}; !reflect.DeepEqual(groups["web"], want) {
+		t.Errorf("GroupByCluster() web = %v, want %v", groups["web"], want)
+	}
+}
+
+func TestMarkVersionDrift(t *testing.T) {
+	agents := []Agent{
+		{EC2InstanceID: "i-aaaa", AgentVersion: "1.79.0"},
+		{EC2InstanceID: "i-bbbb", AgentVersion: "1.79.0"},
+		{EC2InstanceID: "i-cccc", AgentVersion: "1.51.0"},
+		{EC2InstanceID: "i-dddd", AgentStatus: "UNKNOWN"},
+	}
+	majority, drifting := MarkVersionDrift(agents)
+	if majority != "1.79.0" || drifting != 1 {
+		t.Errorf("MarkVersionDrift() = %v, %v, want 1.79.0, 1", majority, drifting)
+	}
+	for _, agent := range agents {
+		if want := agent.EC2InstanceID == "i-cccc"; agent.VersionDrift != want {
+			t.Errorf("%v VersionDrift = %v, want %v", agent.EC2InstanceID, agent.VersionDrift, want)
+		}
+	}
+}
+
+func TestMarkDuplicateRegistrations(t *testing.T) {
+	agents := []Agent{
+		{Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/stale", EC2InstanceID: "i-aaaa"},
+		{Cluster: "web", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb", EC2InstanceID: "i-bbbb"},
+		{Cluster: "batch", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/batch/fresh", EC2InstanceID: "i-aaaa"},
+		{Cluster: "web", EC2InstanceID: "i-cccc", AgentStatus: "UNKNOWN"},
+	}
+	if got := MarkDuplicateRegistrations(agents); got != 1 {
+		t.Errorf("MarkDuplicateRegistrations() = %v, want 1", got)
+	}
+	if want := []string{agents[2].ContainerInstanceARN}; !reflect.DeepEqual(agents[0].DuplicateRegistrations, want) {
+		t.Errorf("stale DuplicateRegistrations = %v, want %v", agents[0].DuplicateRegistrations, want)
+	}
+	if want := []string{agents[0].ContainerInstanceARN}; !reflect.DeepEqual(agents[2].DuplicateRegistrations, want) {
+		t.Errorf("fresh DuplicateRegistrations = %v, want %v", agents[2].DuplicateRegistrations, want)
+	}
+	if agents[1].DuplicateRegistrations != nil || agents[3].DuplicateRegistrations != nil {
+		t.Errorf("DuplicateRegistrations set on instances registered once: %v", agents)
+	}
+}
+
+func TestMarkDockerVersionDrift(t *testing.T) {
+	agents := []Agent{
+		{EC2InstanceID: "i-aaaa", AgentVersion: "1.79.0", DockerVersion: "DockerVersion: 20.10.25"},
+		{EC2InstanceID: "i-bbbb", AgentVersion: "1.51.0", DockerVersion: "DockerVersion: 20.10.25"},
+		{EC2InstanceID: "i-cccc", AgentVersion: "1.79.0", DockerVersion: "DockerVersion: 25.0.3"},
+		{EC2InstanceID: "i-dddd", AgentStatus: "UNKNOWN"},
+	}
+	majority, drifting := MarkDockerVersionDrift(agents)
+	if majority != "DockerVersion: 20.10.25" || drifting != 1 {
+		t.Errorf("MarkDockerVersionDrift() = %v, %v, want DockerVersion: 20.10.25, 1", majority, drifting)
+	}
+	for _, agent := range agents {
+		if want := agent.EC2InstanceID == "i-cccc"; agent.DockerVersionDrift != want {
+			t.Errorf("%v DockerVersionDrift = %v, want %v", agent.EC2InstanceID, agent.DockerVersionDrift, want)
+		}
+		if agent.VersionDrift {
+			t.Errorf("%v VersionDrift = true, want only the Docker version marked", agent.EC2InstanceID)
+		}
+	}
+}
+
+func TestMarkDockerVersionDriftByPlatform(t *testing.T) {
+	agents := []Agent{
+		{EC2InstanceID: "i-aaaa", OSType: OSTypeLinux, DockerVersion: "DockerVersion: 25.0.3"},
+		{EC2InstanceID: "i-bbbb", OSType: OSTypeLinux, DockerVersion: "DockerVersion: 25.0.3"},
+		{EC2InstanceID: "i-cccc", OSType: OSTypeLinux, DockerVersion: "DockerVersion: 20.10.25"},
+		{EC2InstanceID: "i-dddd", OSType: OSTypeWindows, DockerVersion: "DockerVersion: 20.10.9"},
+	}
+	majority, drifting := MarkDockerVersionDrift(agents)
+	if majority != "DockerVersion: 25.0.3" || drifting != 1 {
+		t.Errorf("MarkDockerVersionDrift() = %v, %v, want DockerVersion: 25.0.3, 1", majority, drifting)
+	}
+	for _, agent := range agents {
+		if want := agent.EC2InstanceID == "i-cccc"; agent.DockerVersionDrift != want {
+			t.Errorf("%v DockerVersionDrift = %v, want %v: Windows is compared with Windows", agent.EC2InstanceID, agent.DockerVersionDrift, want)
+		}
+	}
+}
+
+func TestFilterPlatform(t *testing.T) {
+	agents := []Agent{{EC2InstanceID: "i-aaaa", OSType: OSTypeLinux}, {EC2InstanceID: "i-bbbb", OSType: OSTypeWindows}, {EC2InstanceID: "i-cccc"}}
+	if got := FilterPlatform(agents, "all"); len(got) != 3 {
+		t.Errorf("FilterPlatform(all) = %v, want every agent", got)
+	}
+	if got := FilterPlatform(agents, OSTypeWindows); len(got) != 1 || got[0].EC2InstanceID != "i-bbbb" {
+		t.Errorf("FilterPlatform(windows) = %v, want only i-bbbb", got)
+	}
+}
+
+func TestSortByLocation(t *testing.T) {
+	agents := []Agent{
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb"},
+		{Region: "us-east-1", Cluster: "web", ManagedInstanceID: "mi-0abc"},
+		{Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa", ContainerInstanceARN: "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa"},
+		{AccountID: "111111111111", Region: "eu-west-1", Cluster: "web", EC2InstanceID: "i-zzzz"},
+	}
+	SortByLocation(agents)
+	var got []string
+	for _, agent := range agents {
+		got = append(got, agent.InstanceID()+" "+agent.ContainerInstanceARN)
+	}
+	want := []string{
+		"i-aaaa arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa",
+		"i-aaaa arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb",
+		"mi-0abc ",
+		"i-zzzz ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortByLocation() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package agentstatus
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// asgNamePrefix precedes the name in an Auto Scaling group ARN
+const asgNamePrefix = "autoScalingGroupName/"
+
+// asgNameFromARN returns the name of an Auto Scaling group from its ARN, or the ARN itself if it has no name
+// segment
+func asgNameFromARN(arn string) string {
+	if i := strings.Index(arn, asgNamePrefix); i >= 0 {
+		return arn[i+len(asgNamePrefix):]
+	}
+	return arn
+}
+
+// capacityProviderASGs returns the Auto Scaling group of each named capacity provider, describing the ones
+// the checker has not seen before. Capacity providers without an Auto Scaling group (e.g. FARGATE) map to an
+// empty string
+func (c *StatusChecker) capacityProviderASGs(ctx context.Context, names []string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.asgByCapacityProvider == nil {
+		c.asgByCapacityProvider = make(map[string]string)
+	}
+	var missing []string
+	for _, name := range names {
+		if _, ok := c.asgByCapacityProvider[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		output, err := c.Client.DescribeCapacityProviders(ctx, &ecs.DescribeCapacityProvidersInput{CapacityProviders: missing})
+		if err != nil {
+			return nil, c.newAPIError("", "DescribeCapacityProviders", err)
+		}
+		for _, name := range missing {
+			c.asgByCapacityProvider[name] = ""
+		}
+		for _, provider := range output.CapacityProviders {
+			if provider.AutoScalingGroupProvider != nil {
+				c.asgByCapacityProvider[aws.ToString(provider.Name)] = asgNameFromARN(aws.ToString(provider.AutoScalingGroupProvider.AutoScalingGroupArn))
+			}
+		}
+	}
+	asgs := make(map[string]string, len(names))
+	for _, name := range names {
+		asgs[name] = c.asgByCapacityProvider[name]
+	}
+	return asgs, nil
+}
+
+// ResolveAutoScalingGroups sets the Auto Scaling group of agents launched by a capacity provider whose
+// group is not already known from the EC2 instance tags, e.g. with the EC2 details turned off. The
+// capacity providers are described once per checker
+func (c *StatusChecker) ResolveAutoScalingGroups(ctx context.Context, agents []Agent) error {
+	var names []string
+	seen := make(map[string]bool)
+	for _, agent := range agents {
+		if agent.CapacityProvider != "" && agent.AutoScalingGroup == "" && !seen[agent.CapacityProvider] {
+			seen[agent.CapacityProvider] = true
+			names = append(names, agent.CapacityProvider)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	asgs, err := c.capacityProviderASGs(ctx, names)
+	if err != nil {
+		return err
+	}
+	for i := range agents {
+		if agents[i].AutoScalingGroup == "" {
+			agents[i].AutoScalingGroup = asgs[agents[i].CapacityProvider]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package agentstatus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestResolveAutoScalingGroups(t *testing.T) {
+	client := &mockECSClient{providers: []types.CapacityProvider{{
+		Name: aws.String("production-cp"),
+		AutoScalingGroupProvider: &types.AutoScalingGroupProvider{
+			AutoScalingGroupArn: aws.String("arn:aws:autoscaling:us-east-1:123456789012:autoScalingGroup:5f3c7a1e-0b2d-4c6e-8a9f-1d2e3f4a5b6c:autoScalingGroupName/production-asg"),
+		},
+	}}}
+	checker := NewStatusChecker(client, "us-east-1")
+	agents := []Agent{
+		{EC2InstanceID: "i-aaaa", CapacityProvider: "production-cp"},
+		{EC2InstanceID: "i-bbbb", CapacityProvider: "production-cp", AutoScalingGroup: "from-tag"},
+		{EC2InstanceID: "i-cccc", CapacityProvider: "unknown-cp"},
+		{EC2InstanceID: "i-dddd"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := checker.ResolveAutoScalingGroups(context.Background(), agents); err != nil {
+			t.Fatalf("ResolveAutoScalingGroups() error = %v", err)
+		}
+	}
+	want := []string{"production-asg", "from-tag", "", ""}
+	for i, agent := range agents {
+		if agent.AutoScalingGroup != want[i] {
+			t.Errorf("ResolveAutoScalingGroups() %v ASG = %q, want %q", agent.EC2InstanceID, agent.AutoScalingGroup, want[i])
+		}
+	}
+	if client.providerCalls != 1 {
+		t.Errorf("ResolveAutoScalingGroups() made %v DescribeCapacityProviders calls, want 1", client.providerCalls)
+	}
+}
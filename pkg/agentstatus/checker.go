@@ -0,0 +1,57 @@
+package agentstatus
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// StatusChecker checks ECS agent status in one region through a single, reusable ECS client. Create one
+// per region so the AWS config is loaded and the client built only once
+type StatusChecker struct {
+	// Client is used for every ECS API call. Tests can replace it with a mock
+	Client ECSClient
+	// Region is recorded on every Agent the checker returns
+	Region string
+	// AccountID, when set, is recorded on every Agent the checker returns
+	AccountID string
+	// EC2, when set, is used to add EC2 instance details to every Agent the checker returns
+	EC2 EC2InstanceDescriber
+	// AutoScaling, when set, is used to add the Auto Scaling lifecycle state to the agents in a group
+	AutoScaling AutoScalingInstanceDescriber
+	// Filter, when set, is a cluster query language expression that limits the container instances listed,
+	// e.g. attribute:ecs.instance-type == c5.large
+	Filter string
+	// IncludeInactive keeps the clusters that are not ACTIVE, e.g. INACTIVE or DEPROVISIONING ones, which
+	// PrecheckClusters and DescribeClusterInventory skip by default
+	IncludeInactive bool
+	// IncludeRaw keeps the DescribeContainerInstances item of each container instance in the Raw field of
+	// its Agent
+	IncludeRaw bool
+	// Attributes are the names of the container instance attributes kept in the Attributes of each Agent,
+	// e.g. stack or ecs.ami-id
+	Attributes []string
+	// DescribeWorkers is the number of DescribeContainerInstances batches of a cluster described at once (1 if
+	// less than 1)
+	DescribeWorkers int
+
+	mu sync.Mutex
+	// asgByCapacityProvider caches the Auto Scaling group of each capacity provider described so far
+	asgByCapacityProvider map[string]string
+}
+
+// NewStatusChecker returns a StatusChecker using client, tagging agents with region
+func NewStatusChecker(client ECSClient, region string) *StatusChecker {
+	return &StatusChecker{Client: client, Region: region}
+}
+
+// NewStatusCheckerFromConfig returns a StatusChecker with ECS and EC2 clients built from cfg
+func NewStatusCheckerFromConfig(cfg aws.Config) *StatusChecker {
+	checker := NewStatusChecker(ecs.NewFromConfig(cfg), cfg.Region)
+	checker.EC2 = ec2.NewFromConfig(cfg)
+	checker.AutoScaling = autoscaling.NewFromConfig(cfg)
+	return checker
+}
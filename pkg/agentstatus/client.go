@@ -0,0 +1,249 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// ErrClusterNotFound is returned by Client.Agents when no region of the client has the cluster
+var ErrClusterNotFound = errors.New("cluster not found")
+
+// Client is the stable API of the package for programs that embed the checks: it matches clusters and
+// checks their agents in one or more regions of an account. Create one with New and reuse it, since it
+// holds an ECS and an EC2 client per region. Client, its methods and the With options keep their
+// signatures and behavior across minor versions; StatusChecker and the other lower-level functions may
+// change. A Client is safe for concurrent use
+type Client struct {
+	// checkers has one StatusChecker per region, sorted by region
+	checkers    []*StatusChecker
+	concurrency int
+	match       MatchMode
+	policy      HealthPolicy
+}
+
+// Option configures a Client created by New
+type Option func(*clientSettings)
+
+// clientSettings are the values set by the Options of New
+type clientSettings struct {
+	regions     []string
+	concurrency int
+	filter      string
+	match       MatchMode
+	policy      HealthPolicy
+	ec2Details  bool
+}
+
+// WithRegions checks the clusters of these regions instead of the region of the AWS config
+func WithRegions(regions ...string) Option {
+	return func(s *clientSettings) { s.regions = regions }
+}
+
+// WithConcurrency sets how many clusters of each region Scan checks in parallel (default 4)
+func WithConcurrency(concurrency int) Option {
+	return func(s *clientSettings) { s.concurrency = concurrency }
+}
+
+// WithFilter only checks the container instances selected by a cluster query language expression, e.g.
+// attribute:ecs.instance-type == c5.large
+func WithFilter(expression string) Option {
+	return func(s *clientSettings) { s.filter = expression }
+}
+
+// WithMatchMode sets how the patterns of Clusters and Scan are compared with cluster names (default
+// MatchSubstring)
+func WithMatchMode(mode MatchMode) Option {
+	return func(s *clientSettings) { s.match = mode }
+}
+
+// WithHealthPolicy sets which agents the Summary of a Report counts as unhealthy (default
+// DefaultHealthPolicy)
+func WithHealthPolicy(policy HealthPolicy) Option {
+	return func(s *clientSettings) { s.policy = policy }
+}
+
+// WithoutEC2Details leaves out the EC2 instance details, status checks and tags of the agents, saving the
+// EC2 API calls
+func WithoutEC2Details() Option {
+	return func(s *clientSettings) { s.ec2Details = false }
+}
+
+// New returns a Client calling AWS with cfg in the region of cfg, or in the regions of WithRegions
+func New(cfg aws.Config, opts ...Option) (*Client, error) {
+	settings := newClientSettings(opts)
+	regions := settings.regions
+	if len(regions) == 0 {
+		regions = []string{cfg.Region}
+	}
+	var checkers []*StatusChecker
+	seen := make(map[string]bool)
+	for _, region := range regions {
+		if region == "" {
+			return nil, errors.New("no region: set one in the AWS config or with WithRegions")
+		}
+		if seen[region] {
+			continue
+		}
+		seen[region] = true
+		regionCfg := cfg.Copy()
+		regionCfg.Region = region
+		checkers = append(checkers, NewStatusCheckerFromConfig(regionCfg))
+	}
+	return newClient(checkers, settings), nil
+}
+
+// newClientSettings applies opts to the defaults
+func newClientSettings(opts []Option) clientSettings {
+	settings := clientSettings{concurrency: 4, match: MatchSubstring, policy: DefaultHealthPolicy, ec2Details: true}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	return settings
+}
+
+// newClient returns a Client using checkers, one per region, configured by settings. Tests pass checkers
+// with mock clients
+func newClient(checkers []*StatusChecker, settings clientSettings) *Client {
+	for _, checker := range checkers {
+		checker.Filter = settings.filter
+		if !settings.ec2Details {
+			checker.EC2 = nil
+		}
+	}
+	sort.Slice(checkers, func(i, j int) bool { return checkers[i].Region < checkers[j].Region })
+	return &Client{checkers: checkers, concurrency: settings.concurrency, match: settings.match, policy: settings.policy}
+}
+
+// Regions returns the regions the client checks, sorted
+func (c *Client) Regions() []string {
+	regions := make([]string, len(c.checkers))
+	for i, checker := range c.checkers {
+		regions[i] = checker.Region
+	}
+	return regions
+}
+
+// Clusters returns the clusters of every region whose names match pattern, ordered by region and then as
+// listed by ECS. ErrNoClustersMatched is returned when none do
+func (c *Client) Clusters(ctx context.Context, pattern string) ([]ClusterRef, error) {
+	var clusters []ClusterRef
+	for _, checker := range c.checkers {
+		refs, err := checker.ListMatchingClusters(ctx, pattern, c.match)
+		switch {
+		case errors.Is(err, ErrNoClustersMatched):
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("region %s: %w", checker.Region, err)
+		}
+		clusters = append(clusters, refs...)
+	}
+	if len(clusters) == 0 {
+		return nil, ErrNoClustersMatched
+	}
+	return clusters, nil
+}
+
+// Agents returns the agents of a cluster, given by name or ARN. A name is looked up in every region of the
+// client, so clusters of the same name in several regions are all returned; an ARN only in its region. A
+// cluster without container instances has no agents and is not an error. ErrClusterNotFound is returned
+// when no region has the cluster
+func (c *Client) Agents(ctx context.Context, cluster string) ([]Agent, error) {
+	checkers := c.checkers
+	name := cluster
+	if parsed, err := arn.Parse(cluster); err == nil {
+		checkers = nil
+		for _, checker := range c.checkers {
+			if checker.Region == parsed.Region {
+				checkers = append(checkers, checker)
+			}
+		}
+		name = ClusterNameFromArn(cluster)
+	}
+	var agents []Agent
+	found := false
+	for _, checker := range checkers {
+		result, err := checker.GetAgentStatusForCluster(ctx, name)
+		var notFound *types.ClusterNotFoundException
+		switch {
+		case errors.As(err, &notFound):
+			continue
+		case errors.Is(err, ErrNoContainerInstances):
+		case err != nil:
+			return nil, fmt.Errorf("region %s: %w", checker.Region, err)
+		}
+		found = true
+		agents = append(agents, result...)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: %w", cluster, ErrClusterNotFound)
+	}
+	return agents, nil
+}
+
+// Scan checks the agents of every cluster whose name matches pattern in every region, the regions in
+// parallel and the clusters of each region WithConcurrency at a time. Clusters and regions that fail are
+// reported in the Errors of the Report rather than failing the scan. ErrNoClustersMatched is returned when
+// no cluster matches, and the context's error if it ends before the scan completes
+func (c *Client) Scan(ctx context.Context, pattern string) (Report, error) {
+	var report Report
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	matched := 0
+	for _, checker := range c.checkers {
+		wg.Add(1)
+		go func(checker *StatusChecker) {
+			defer wg.Done()
+			refs, err := checker.ListMatchingClusters(ctx, pattern, c.match)
+			if errors.Is(err, ErrNoClustersMatched) {
+				return
+			}
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				report.Errors = append(report.Errors, &ClusterError{Region: checker.Region, Err: err})
+				return
+			}
+			names := make([]string, len(refs))
+			for i, ref := range refs {
+				names[i] = ref.Name
+			}
+			mu.Lock()
+			matched += len(names)
+			mu.Unlock()
+			for result := range checker.ScanClusters(ctx, names, c.concurrency) {
+				mu.Lock()
+				switch {
+				case errors.Is(result.Err, ErrNoContainerInstances):
+				case result.Err != nil:
+					report.Errors = append(report.Errors, &ClusterError{Region: result.Region, Cluster: result.Cluster, Err: result.Err})
+				default:
+					report.Agents = append(report.Agents, result.Agents...)
+				}
+				mu.Unlock()
+			}
+		}(checker)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return Report{}, ctx.Err()
+	}
+	if matched == 0 && len(report.Errors) == 0 {
+		return Report{}, ErrNoClustersMatched
+	}
+	sort.Slice(report.Errors, func(i, j int) bool {
+		a, b := report.Errors[i], report.Errors[j]
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Cluster < b.Cluster
+	})
+	return NewReport(report.Agents, report.Errors, c.policy, time.Now()), nil
+}
@@ -0,0 +1,104 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// newTestClient returns a Client over an east region with two matching clusters of one instance each and a
+// west region with an empty matching cluster
+func newTestClient(opts ...Option) *Client {
+	east := &mockECSClient{
+		mockECSLister: mockECSLister{pages: [][]string{{
+			"arn:aws:ecs:us-east-1:123456789012:cluster/prod-web",
+			"arn:aws:ecs:us-east-1:123456789012:cluster/prod-api",
+			"arn:aws:ecs:us-east-1:123456789012:cluster/staging",
+		}}},
+		instances: []types.ContainerInstance{
+			{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/aaaa"), Status: aws.String("DRAINING")},
+		},
+	}
+	west := &mockECSClient{mockECSLister: mockECSLister{pages: [][]string{{"arn:aws:ecs:us-west-2:123456789012:cluster/prod-web"}}}}
+	return newClient([]*StatusChecker{NewStatusChecker(west, "us-west-2"), NewStatusChecker(east, "us-east-1")}, newClientSettings(opts))
+}
+
+func TestClientClusters(t *testing.T) {
+	client := newTestClient()
+	if got := client.Regions(); len(got) != 2 || got[0] != "us-east-1" {
+		t.Errorf("Regions() = %v, want [us-east-1 us-west-2]", got)
+	}
+	clusters, err := client.Clusters(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 3 || clusters[0].Name != "prod-web" || clusters[2].Arn != "arn:aws:ecs:us-west-2:123456789012:cluster/prod-web" {
+		t.Errorf("Clusters(prod) = %+v", clusters)
+	}
+	if _, err := client.Clusters(context.Background(), "dev"); !errors.Is(err, ErrNoClustersMatched) {
+		t.Errorf("Clusters(dev) error = %v, want ErrNoClustersMatched", err)
+	}
+	if _, err := newTestClient(WithMatchMode(MatchExact)).Clusters(context.Background(), "prod"); !errors.Is(err, ErrNoClustersMatched) {
+		t.Errorf("Clusters(prod) with MatchExact error = %v, want ErrNoClustersMatched", err)
+	}
+}
+
+func TestClientAgents(t *testing.T) {
+	client := newTestClient()
+	agents, err := client.Agents(context.Background(), "prod-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Region != "us-east-1" || agents[0].Cluster != "prod-web" {
+		t.Errorf("Agents(prod-web) = %+v", agents)
+	}
+	agents, err = client.Agents(context.Background(), "arn:aws:ecs:us-west-2:123456789012:cluster/prod-web")
+	if err != nil || len(agents) != 0 {
+		t.Errorf("Agents(west ARN) = %+v, %v, want no agents and no error", agents, err)
+	}
+	if _, err := client.Agents(context.Background(), "arn:aws:ecs:eu-west-1:123456789012:cluster/prod-web"); !errors.Is(err, ErrClusterNotFound) {
+		t.Errorf("Agents(ARN of another region) error = %v, want ErrClusterNotFound", err)
+	}
+}
+
+func TestClientScan(t *testing.T) {
+	report, err := newTestClient(WithConcurrency(1)).Scan(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Agents) != 2 || report.Agents[0].Cluster != "prod-api" || report.Agents[1].Cluster != "prod-web" {
+		t.Errorf("Scan(prod) agents = %+v", report.Agents)
+	}
+	if report.Summary.Agents != 2 || report.Summary.Unhealthy != 2 || len(report.Errors) != 0 {
+		t.Errorf("Scan(prod) summary = %+v, errors %v", report.Summary, report.Errors)
+	}
+	if _, err := newTestClient().Scan(context.Background(), "dev"); !errors.Is(err, ErrNoClustersMatched) {
+		t.Errorf("Scan(dev) error = %v, want ErrNoClustersMatched", err)
+	}
+
+	failing := newClient([]*StatusChecker{NewStatusChecker(&mockECSClient{mockECSLister: mockECSLister{err: errors.New("boom")}}, "us-east-1")}, newClientSettings(nil))
+	report, err = failing.Scan(context.Background(), "prod")
+	var clusterErr *ClusterError
+	if err != nil || len(report.Errors) != 1 || !errors.As(report.Errors[0], &clusterErr) || clusterErr.Region != "us-east-1" {
+		t.Errorf("Scan() with a failing region = %+v, %v, want a region error", report, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	client, err := New(aws.Config{Region: "us-east-1"}, WithRegions("eu-west-1", "us-east-1", "eu-west-1"), WithoutEC2Details(), WithFilter("attribute:ecs.os-type == linux"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Regions(); len(got) != 2 || got[0] != "eu-west-1" || got[1] != "us-east-1" {
+		t.Errorf("New() regions = %v, want [eu-west-1 us-east-1]", got)
+	}
+	if client.checkers[0].EC2 != nil || client.checkers[0].Filter != "attribute:ecs.os-type == linux" {
+		t.Errorf("New() did not apply WithoutEC2Details and WithFilter")
+	}
+	if _, err := New(aws.Config{}); err == nil {
+		t.Error("New() without a region returned no error")
+	}
+}
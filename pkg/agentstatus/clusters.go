@@ -0,0 +1,296 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// ErrNoClustersMatched is returned when no cluster name matches the requested patterns
+var ErrNoClustersMatched = errors.New("no clusters matched")
+
+// ErrNoClustersFound is ErrNoClustersMatched under its former name.
+//
+// Deprecated: use ErrNoClustersMatched
+var ErrNoClustersFound = ErrNoClustersMatched
+
+// ECSLister is the subset of the ECS API needed to enumerate clusters. It is satisfied by *ecs.Client
+type ECSLister interface {
+	ListClusters(ctx context.Context, params *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error)
+}
+
+// describeClustersBatchSize is the maximum number of clusters DescribeClusters accepts per call
+const describeClustersBatchSize = 100
+
+// ClusterNameFromArn returns the cluster name portion of a cluster ARN
+// (arn:aws:ecs:region:account:cluster/name). Values without a slash are returned unchanged
+func ClusterNameFromArn(clusterArn string) string {
+	if i := strings.LastIndex(clusterArn, "/"); i >= 0 {
+		return clusterArn[i+1:]
+	}
+	return clusterArn
+}
+
+// MatchMode selects how a pattern is compared against cluster names
+type MatchMode int
+
+const (
+	// MatchSubstring matches cluster names containing the pattern
+	MatchSubstring MatchMode = iota
+	// MatchExact matches the cluster name equal to the pattern
+	MatchExact
+	// MatchRegex matches cluster names against the pattern as a regular expression
+	MatchRegex
+)
+
+// ParseMatchMode parses the name of a match mode: substring, exact or regex
+func ParseMatchMode(name string) (MatchMode, error) {
+	switch name {
+	case "substring":
+		return MatchSubstring, nil
+	case "exact":
+		return MatchExact, nil
+	case "regex":
+		return MatchRegex, nil
+	}
+	return 0, fmt.Errorf("unknown match mode %q: must be substring, exact or regex", name)
+}
+
+// ClusterRef identifies a cluster by both name and ARN
+type ClusterRef struct {
+	Name string `json:"name"`
+	Arn  string `json:"arn"`
+}
+
+// newMatcher returns a function reporting whether a cluster name matches any of patterns using mode
+func newMatcher(patterns []string, mode MatchMode) (func(string) bool, error) {
+	var matchers []func(string) bool
+	for _, pattern := range patterns {
+		pattern := pattern
+		switch mode {
+		case MatchExact:
+			matchers = append(matchers, func(name string) bool { return name == pattern })
+		case MatchRegex:
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cluster pattern: %w", err)
+			}
+			matchers = append(matchers, re.MatchString)
+		default:
+			matchers = append(matchers, func(name string) bool { return strings.Contains(name, pattern) })
+		}
+	}
+	return func(name string) bool {
+		for _, matcher := range matchers {
+			if matcher(name) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// ExcludeClusters returns the clusters whose name matches none of patterns using mode. ErrNoClustersMatched
+// is returned when every cluster is excluded
+func ExcludeClusters(clusters []ClusterRef, patterns []string, mode MatchMode) ([]ClusterRef, error) {
+	if len(patterns) == 0 {
+		return clusters, nil
+	}
+	match, err := newMatcher(patterns, mode)
+	if err != nil {
+		return nil, err
+	}
+	var kept []ClusterRef
+	for _, cluster := range clusters {
+		if !match(cluster.Name) {
+			kept = append(kept, cluster)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, ErrNoClustersMatched
+	}
+	return kept, nil
+}
+
+// ListMatchingClusters pages through every cluster in the account/region and returns the name and ARN of
+// each cluster whose name matches pattern using mode
+func (c *StatusChecker) ListMatchingClusters(ctx context.Context, pattern string, mode MatchMode) ([]ClusterRef, error) {
+	return c.ListClustersMatchingAny(ctx, []string{pattern}, mode)
+}
+
+// ListClustersMatchingAny pages through every cluster in the account/region and returns the name and ARN of
+// each cluster whose name matches at least one of patterns using mode
+func (c *StatusChecker) ListClustersMatchingAny(ctx context.Context, patterns []string, mode MatchMode) ([]ClusterRef, error) {
+	if _, err := newMatcher(patterns, mode); err != nil {
+		return nil, err
+	}
+	arns, err := c.ListClusterArns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return MatchClusters(arns, patterns, mode)
+}
+
+// ListClusterArns pages through every cluster in the account/region and returns their ARNs
+func (c *StatusChecker) ListClusterArns(ctx context.Context) ([]string, error) {
+	var arns []string
+	paginator := ecs.NewListClustersPaginator(c.Client, &ecs.ListClustersInput{})
+	for page := 1; paginator.HasMorePages(); page++ {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, c.newAPIError("", "ListClusters", err)
+		}
+		logger.Debug().Str("region", c.Region).Int("page", page).Int("clusters", len(output.ClusterArns)).
+			Bool("more", output.NextToken != nil).Msg("listed a page of clusters")
+		arns = append(arns, output.ClusterArns...)
+	}
+	return arns, nil
+}
+
+// MatchClusters returns the name and ARN of each cluster ARN whose name matches at least one of patterns
+// using mode. ErrNoClustersMatched is returned when none does
+func MatchClusters(arns []string, patterns []string, mode MatchMode) ([]ClusterRef, error) {
+	match, err := newMatcher(patterns, mode)
+	if err != nil {
+		return nil, err
+	}
+	var clusters []ClusterRef
+	for _, clusterArn := range arns {
+		if name := ClusterNameFromArn(clusterArn); match(name) {
+			clusters = append(clusters, ClusterRef{Name: name, Arn: clusterArn})
+		}
+	}
+	if len(clusters) == 0 {
+		return nil, ErrNoClustersMatched
+	}
+	return clusters, nil
+}
+
+// GetECSClustersWithSubstring returns a list of ECS cluster names that contain the specified substring
+func (c *StatusChecker) GetECSClustersWithSubstring(ctx context.Context, substring string) ([]string, error) {
+	refs, err := c.ListMatchingClusters(ctx, substring, MatchSubstring)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make([]string, len(refs))
+	for i, ref := range refs {
+		clusters[i] = ref.Name
+	}
+	return clusters, nil
+}
+
+// PrecheckClusters describes the named clusters and returns the ones worth scanning. Clusters that are not
+// ACTIVE, unless IncludeInactive is set, or could not be described are skipped with a warning, and clusters
+// with no registered container instances are skipped without calling ListContainerInstances
+func (c *StatusChecker) PrecheckClusters(ctx context.Context, clusters []string) ([]string, error) {
+	scan, _, err := c.PrecheckClusterStatus(ctx, clusters)
+	return scan, err
+}
+
+// EmptyCluster is a cluster without registered container instances
+type EmptyCluster struct {
+	Name string
+	// FargateOnly is set for clusters that need no EC2 capacity, see FargateOnly
+	FargateOnly bool
+}
+
+// fargateCapacityProviders are the capacity providers of Fargate, which need no container instances
+var fargateCapacityProviders = map[string]bool{"FARGATE": true, "FARGATE_SPOT": true}
+
+// FargateOnly reports whether a cluster without registered container instances runs on Fargate: it has
+// running or pending tasks, which can then only be Fargate tasks, or only Fargate capacity providers
+func FargateOnly(cluster types.Cluster) bool {
+	if cluster.RegisteredContainerInstancesCount > 0 {
+		return false
+	}
+	if cluster.RunningTasksCount > 0 || cluster.PendingTasksCount > 0 {
+		return true
+	}
+	for _, provider := range cluster.CapacityProviders {
+		if !fargateCapacityProviders[provider] {
+			return false
+		}
+	}
+	return len(cluster.CapacityProviders) > 0
+}
+
+// PrecheckClusterStatus is PrecheckClusters, also returning the clusters skipped because they have no
+// registered container instances
+func (c *StatusChecker) PrecheckClusterStatus(ctx context.Context, clusters []string) ([]string, []EmptyCluster, error) {
+	var scan []string
+	var empty []EmptyCluster
+	for start := 0; start < len(clusters); start += describeClustersBatchSize {
+		end := start + describeClustersBatchSize
+		if end > len(clusters) {
+			end = len(clusters)
+		}
+		output, err := c.Client.DescribeClusters(ctx, &ecs.DescribeClustersInput{Clusters: clusters[start:end]})
+		if err != nil {
+			return nil, nil, c.newAPIError("", "DescribeClusters", err)
+		}
+		for _, failure := range output.Failures {
+			logger.Warn().Str("arn", aws.ToString(failure.Arn)).Str("reason", aws.ToString(failure.Reason)).Msg("skipping cluster that could not be described")
+		}
+		for _, cluster := range output.Clusters {
+			name := aws.ToString(cluster.ClusterName)
+			switch status := aws.ToString(cluster.Status); {
+			case status != "ACTIVE" && !c.IncludeInactive:
+				logger.Warn().Str("cluster", name).Str("status", status).Msgf("skipping %v cluster %v", status, name)
+			case cluster.RegisteredContainerInstancesCount == 0:
+				logger.Info().Str("cluster", name).Msgf("skipping cluster %v with no registered container instances", name)
+				empty = append(empty, EmptyCluster{Name: name, FargateOnly: FargateOnly(cluster)})
+			default:
+				scan = append(scan, name)
+			}
+		}
+	}
+	return scan, empty, nil
+}
+
+// FilterClustersByTags describes the named clusters with their tags and returns, in the same order, those
+// that have every one of tags with the same value. Clusters that could not be described are left out
+func (c *StatusChecker) FilterClustersByTags(ctx context.Context, clusters []string, tags map[string]string) ([]string, error) {
+	var tagged []string
+	for start := 0; start < len(clusters); start += describeClustersBatchSize {
+		end := min(start+describeClustersBatchSize, len(clusters))
+		output, err := c.Client.DescribeClusters(ctx, &ecs.DescribeClustersInput{Clusters: clusters[start:end], Include: []types.ClusterField{types.ClusterFieldTags}})
+		if err != nil {
+			return nil, c.newAPIError("", "DescribeClusters", err)
+		}
+		for _, cluster := range output.Clusters {
+			if hasTags(cluster.Tags, tags) {
+				tagged = append(tagged, aws.ToString(cluster.ClusterName))
+			}
+		}
+	}
+	return tagged, nil
+}
+
+// hasTags reports whether the ECS tags include every one of want with the same value
+func hasTags(tags []types.Tag, want map[string]string) bool {
+	values := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		values[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for key, value := range want {
+		if got, ok := values[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckMaxClusters returns an error if the number of matched clusters exceeds maxClusters.
+// A maxClusters value of 0 disables the check
+func CheckMaxClusters(clusters []string, maxClusters int) error {
+	if maxClusters > 0 && len(clusters) > maxClusters {
+		return fmt.Errorf("%d clusters matched, which exceeds --max-clusters %d: narrow the substring or raise the limit", len(clusters), maxClusters)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// mockECSLister returns one page of cluster ARNs per ListClusters call
+type mockECSLister struct {
+	pages [][]string
+	err   error
+}
+
+func (m *mockECSLister) ListClusters(_ context.Context, params *ecs.ListClustersInput, _ ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	page := 0
+	if params.NextToken != nil {
+		page, _ = strconv.Atoi(*params.NextToken)
+	}
+	output := &ecs.ListClustersOutput{}
+	if page < len(m.pages) {
+		output.ClusterArns = m.pages[page]
+	}
+	if page+1 < len(m.pages) {
+		output.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return output, nil
+}
+
+func TestClusterNameFromArn(t *testing.T) {
+	tests := []struct {
+		arn  string
+		want string
+	}{
+		{arn: "arn:aws:ecs:us-east-1:123456789012:cluster/production", want: "production"},
+		{arn: "arn:aws-us-gov:ecs:us-gov-west-1:123456789012:cluster/prod-a", want: "prod-a"},
+		{arn: "production", want: "production"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			if got := ClusterNameFromArn(tt.arn); got != tt.want {
+				t.Errorf("ClusterNameFromArn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetECSClustersWithSubstring(t *testing.T) {
+	tests := []struct {
+		name      string
+		pages     [][]string
+		substring string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name: "matches across pages",
+			pages: [][]string{
+				{"arn:aws:ecs:us-east-1:123456789012:cluster/production-web", "arn:aws:ecs:us-east-1:123456789012:cluster/staging-web"},
+				{"arn:aws:ecs:us-east-1:123456789012:cluster/production-worker"},
+			},
+			substring: "production",
+			want:      []string{"production-web", "production-worker"},
+		},
+		{
+			name:      "no match",
+			pages:     [][]string{{"arn:aws:ecs:us-east-1:123456789012:cluster/staging-web"}},
+			substring: "production",
+			wantErr:   true,
+		},
+		{
+			name:      "no clusters",
+			pages:     nil,
+			substring: "production",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewStatusChecker(&mockECSClient{mockECSLister: mockECSLister{pages: tt.pages}}, "").GetECSClustersWithSubstring(context.Background(), tt.substring)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetECSClustersWithSubstring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrNoClustersMatched) {
+				t.Errorf("GetECSClustersWithSubstring() error = %v, want ErrNoClustersMatched", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetECSClustersWithSubstring() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetECSClustersWithSubstringAPIError(t *testing.T) {
+	_, err := NewStatusChecker(&mockECSClient{mockECSLister: mockECSLister{err: errors.New("boom")}}, "").GetECSClustersWithSubstring(context.Background(), "production")
+	if err == nil {
+		t.Fatal("expected error from ListClusters to be returned")
+	}
+}
+
+func TestCheckMaxClusters(t *testing.T) {
+	clusters := []string{"a", "b", "c"}
+	tests := []struct {
+		name        string
+		maxClusters int
+		wantErr     bool
+	}{
+		{name: "unlimited", maxClusters: 0},
+		{name: "under limit", maxClusters: 5},
+		{name: "at limit", maxClusters: 3},
+		{name: "over limit", maxClusters: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckMaxClusters(clusters, tt.maxClusters); (err != nil) != tt.wantErr {
+				t.Errorf("CheckMaxClusters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListMatchingClusters(t *testing.T) {
+	checker := NewStatusChecker(&mockECSClient{mockECSLister: mockECSLister{pages: [][]string{{
+		"arn:aws:ecs:us-east-1:123456789012:cluster/prod",
+		"arn:aws:ecs:us-east-1:123456789012:cluster/prod-a",
+		"arn:aws:ecs:us-east-1:123456789012:cluster/preprod",
+	}}}}, "us-east-1")
+	tests := []struct {
+		name    string
+		pattern string
+		mode    MatchMode
+		want    []string
+		wantErr bool
+	}{
+		{name: "substring", pattern: "prod", mode: MatchSubstring, want: []string{"prod", "prod-a", "preprod"}},
+		{name: "exact", pattern: "prod", mode: MatchExact, want: []string{"prod"}},
+		{name: "regex", pattern: "^prod-", mode: MatchRegex, want: []string{"prod-a"}},
+		{name: "invalid regex", pattern: "(", mode: MatchRegex, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, err := checker.ListMatchingClusters(context.Background(), tt.pattern, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListMatchingClusters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, ref := range refs {
+				names = append(names, ref.Name)
+				if ref.Arn != "arn:aws:ecs:us-east-1:123456789012:cluster/"+ref.Name {
+					t.Errorf("ListMatchingClusters() ARN = %v for %v", ref.Arn, ref.Name)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("ListMatchingClusters() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestListClustersMatchingAny(t *testing.T) {
+	checker := NewStatusChecker(&mockECSClient{mockECSLister: mockECSLister{pages: [][]string{{
+		"arn:aws:ecs:us-east-1:123456789012:cluster/prod-a",
+		"arn:aws:ecs:us-east-1:123456789012:cluster/prod-b",
+		"arn:aws:ecs:us-east-1:123456789012:cluster/prod-c",
+	}}}}, "us-east-1")
+	refs, err := checker.ListClustersMatchingAny(context.Background(), []string{"prod-c", "prod-a", "prod-a"}, MatchExact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	if want := []string{"prod-a", "prod-c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListClustersMatchingAny() = %v, want %v", names, want)
+	}
+}
+
+func TestParseMatchMode(t *testing.T) {
+	for name, want := range map[string]MatchMode{"substring": MatchSubstring, "exact": MatchExact, "regex": MatchRegex} {
+		if got, err := ParseMatchMode(name); err != nil || got != want {
+			t.Errorf("ParseMatchMode(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseMatchMode("glob"); err == nil {
+		t.Error("ParseMatchMode(\"glob\") returned no error")
+	}
+}
+
+func TestPrecheckClusters(t *testing.T) {
+	client := &mockECSClient{clusters: map[string]types.Cluster{
+		"active":   {ClusterName: aws.String("active"), Status: aws.String("ACTIVE"), RegisteredContainerInstancesCount: 3},
+		"empty":    {ClusterName: aws.String("empty"), Status: aws.String("ACTIVE")},
+		"inactive": {ClusterName: aws.String("inactive"), Status: aws.String("INACTIVE")},
+	}}
+	got, err := NewStatusChecker(client, "").PrecheckClusters(context.Background(), []string{"active", "empty", "inactive", "deleted"})
+	if err != nil {
+		t.Fatalf("PrecheckClusters() error = %v", err)
+	}
+	if want := []string{"active"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PrecheckClusters() = %v, want %v", got, want)
+	}
+}
+
+func TestPrecheckClusterStatus(t *testing.T) {
+	client := &mockECSClient{clusters: map[string]types.Cluster{
+		"active":         {ClusterName: aws.String("active"), Status: aws.String("ACTIVE"), RegisteredContainerInstancesCount: 3},
+		"empty":          {ClusterName: aws.String("empty"), Status: aws.String("ACTIVE")},
+		"deprovisioning": {ClusterName: aws.String("deprovisioning"), Status: aws.String("DEPROVISIONING"), RegisteredContainerInstancesCount: 1},
+		"inactive":       {ClusterName: aws.String("inactive"), Status: aws.String("INACTIVE")},
+	}}
+	checker := NewStatusChecker(client, "")
+	names := []string{"active", "empty", "deprovisioning", "inactive"}
+	scan, empty, err := checker.PrecheckClusterStatus(context.Background(), names)
+	if err != nil {
+		t.Fatalf("PrecheckClusterStatus() error = %v", err)
+	}
+	if !reflect.DeepEqual(scan, []string{"active"}) || !reflect.DeepEqual(empty, []EmptyCluster{{Name: "empty"}}) {
+		t.Errorf("PrecheckClusterStatus() = %v, %v, want [active], [empty]", scan, empty)
+	}
+	checker.IncludeInactive = true
+	scan, empty, err = checker.PrecheckClusterStatus(context.Background(), names)
+	if err != nil {
+		t.Fatalf("PrecheckClusterStatus() with IncludeInactive error = %v", err)
+	}
+	if !reflect.DeepEqual(scan, []string{"active", "deprovisioning"}) || !reflect.DeepEqual(empty, []EmptyCluster{{Name: "empty"}, {Name: "inactive"}}) {
+		t.Errorf("PrecheckClusterStatus() with IncludeInactive = %v, %v, want [active deprovisioning], [empty inactive]", scan, empty)
+	}
+}
+
+func TestFargateOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster types.Cluster
+		want    bool
+	}{
+		{"running tasks", types.Cluster{RunningTasksCount: 2}, true},
+		{"Fargate capacity providers", types.Cluster{CapacityProviders: []string{"FARGATE", "FARGATE_SPOT"}}, true},
+		{"EC2 capacity provider", types.Cluster{CapacityProviders: []string{"FARGATE", "web-asg"}}, false},
+		{"nothing", types.Cluster{}, false},
+		{"container instances", types.Cluster{RegisteredContainerInstancesCount: 1, RunningTasksCount: 2}, false},
+	}
+	for _, tt := range tests {
+		if got := FargateOnly(tt.cluster); got != tt.want {
+			t.Errorf("FargateOnly(%v) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if !errors.Is(ErrFargateOnly, ErrNoContainerInstances) {
+		t.Error("ErrFargateOnly does not match ErrNoContainerInstances")
+	}
+}
+
+func TestExcludeClusters(t *testing.T) {
+	clusters := []ClusterRef{{Name: "prod"}, {Name: "prod-sandbox"}, {Name: "prod-canary"}, {Name: "prod-api"}}
+	got, err := ExcludeClusters(clusters, []string{"prod-sandbox", "canary"}, MatchSubstring)
+	if err != nil {
+		t.Fatalf("ExcludeClusters() error = %v", err)
+	}
+	if want := []ClusterRef{{Name: "prod"}, {Name: "prod-api"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExcludeClusters() = %v, want %v", got, want)
+	}
+	if got, _ := ExcludeClusters(clusters, nil, MatchSubstring); len(got) != len(clusters) {
+		t.Errorf("ExcludeClusters() without patterns = %v, want every cluster", got)
+	}
+	if _, err := ExcludeClusters(clusters, []string{"^prod"}, MatchRegex); !errors.Is(err, ErrNoClustersMatched) {
+		t.Errorf("ExcludeClusters() excluding every cluster error = %v, want %v", err, ErrNoClustersMatched)
+	}
+}
+
+func TestFilterClustersByTags(t *testing.T) {
+	tag := func(key, value string) types.Tag { return types.Tag{Key: aws.String(key), Value: aws.String(value)} }
+	client := &mockECSClient{clusters: map[string]types.Cluster{
+		"payments": {ClusterName: aws.String("payments"), Tags: []types.Tag{tag("env", "prod"), tag("team", "payments")}},
+		"search":   {ClusterName: aws.String("search"), Tags: []types.Tag{tag("env", "prod"), tag("team", "search")}},
+		"sandbox":  {ClusterName: aws.String("sandbox"), Tags: []types.Tag{tag("env", "dev")}},
+		"untagged": {ClusterName: aws.String("untagged")},
+	}}
+	checker := NewStatusChecker(client, "")
+	names := []string{"payments", "search", "sandbox", "untagged", "deleted"}
+	got, err := checker.FilterClustersByTags(context.Background(), names, map[string]string{"env": "prod"})
+	if err != nil {
+		t.Fatalf("FilterClustersByTags() error = %v", err)
+	}
+	if want := []string{"payments", "search"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterClustersByTags() = %v, want %v", got, want)
+	}
+	got, _ = checker.FilterClustersByTags(context.Background(), names, map[string]string{"env": "prod", "team": "search"})
+	if want := []string{"search"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterClustersByTags() with two tags = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package agentstatus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// LoadAWSConfigs loads the AWS SDK configuration once per distinct region, using the named shared config
+// profile if one is given. When no regions are given the default configuration is loaded and keyed by its
+// resolved region
+func LoadAWSConfigs(ctx context.Context, regions []string, profile string) (map[string]aws.Config, error) {
+	var loadOptions []func(*config.LoadOptions) error
+	if profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(profile))
+	}
+	cfgs := make(map[string]aws.Config)
+	if len(regions) == 0 {
+		cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS config: %w", err)
+		}
+		cfgs[cfg.Region] = cfg
+		return cfgs, nil
+	}
+	for _, region := range regions {
+		if _, ok := cfgs[region]; ok {
+			continue
+		}
+		cfg, err := config.LoadDefaultConfig(ctx, append(loadOptions, config.WithRegion(region))...)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS config for region %s: %w", region, err)
+		}
+		cfgs[region] = cfg
+	}
+	return cfgs, nil
+}
+
+// WithEndpoint returns a copy of cfg whose clients of every service call endpoint, e.g. LocalStack at
+// http://localhost:4566, instead of the AWS endpoint of the region. The endpoint of a single service set
+// with its AWS_ENDPOINT_URL_<SERVICE> variable, e.g. AWS_ENDPOINT_URL_ECS, still takes precedence. cfg is
+// returned unchanged when endpoint is empty
+func WithEndpoint(cfg aws.Config, endpoint string) aws.Config {
+	if endpoint == "" {
+		return cfg
+	}
+	cfg = cfg.Copy()
+	cfg.BaseEndpoint = aws.String(endpoint)
+	return cfg
+}
+
+// DefaultRoleSessionName is the session name used to assume a role when none is given
+const DefaultRoleSessionName = "ecs-agent-status"
+
+// AssumeRole identifies an IAM role to assume with STS before calling the ECS and EC2 APIs
+type AssumeRole struct {
+	RoleARN     string
+	ExternalID  string
+	SessionName string
+}
+
+// WithAssumeRole returns a copy of cfg whose credentials are those of the role, obtained with STS
+// AssumeRole using the credentials of cfg and refreshed before they expire. cfg is returned unchanged when
+// role has no RoleARN
+func WithAssumeRole(cfg aws.Config, role AssumeRole) aws.Config {
+	if role.RoleARN == "" {
+		return cfg
+	}
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = role.SessionName
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = DefaultRoleSessionName
+		}
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+	})
+	cfg = cfg.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	return cfg
+}
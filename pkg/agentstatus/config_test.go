@@ -0,0 +1,77 @@
+package agentstatus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestWithAssumeRole(t *testing.T) {
+	cfg := aws.Config{Region: "us-east-1", Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")}
+
+	if got := WithAssumeRole(cfg, AssumeRole{}); got.Credentials != cfg.Credentials {
+		t.Error("WithAssumeRole() without a role ARN replaced the credentials")
+	}
+	got := WithAssumeRole(cfg, AssumeRole{RoleARN: "arn:aws:iam::123456789012:role/ecs-agent-status"})
+	if _, ok := got.Credentials.(*aws.CredentialsCache); !ok {
+		t.Errorf("WithAssumeRole() credentials = %T, want a cache of the assumed role's credentials", got.Credentials)
+	}
+	if _, ok := cfg.Credentials.(credentials.StaticCredentialsProvider); !ok {
+		t.Error("WithAssumeRole() modified the original config")
+	}
+}
+
+func TestWithEndpoint(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write([]byte(`{"clusterArns":["arn:aws:ecs:us-east-1:000000000000:cluster/prod"]}`))
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_ECS", "")
+	cfg := aws.Config{Region: "us-east-1", Credentials: credentials.NewStaticCredentialsProvider("test", "test", "")}
+
+	if got := WithEndpoint(cfg, ""); got.BaseEndpoint != nil {
+		t.Errorf("WithEndpoint() without an endpoint set BaseEndpoint to %v", *got.BaseEndpoint)
+	}
+	checker := NewStatusCheckerFromConfig(WithEndpoint(cfg, server.URL))
+	clusters, err := checker.ListClustersMatchingAny(context.Background(), []string{"prod"}, MatchSubstring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called || len(clusters) != 1 {
+		t.Errorf("ListClusters() through the endpoint = %v, called %v, want the cluster of the endpoint", clusters, called)
+	}
+	if cfg.BaseEndpoint != nil {
+		t.Error("WithEndpoint() modified the original config")
+	}
+}
+
+func TestLoadAWSConfigsPerRegion(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", dir+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", dir+"/credentials")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	cfgs, err := LoadAWSConfigs(context.Background(), []string{"us-east-1", "eu-west-1", "us-east-1"}, "")
+	if err != nil {
+		t.Fatalf("LoadAWSConfigs() error = %v", err)
+	}
+	if len(cfgs) != 2 {
+		t.Fatalf("LoadAWSConfigs() loaded %v configs, want one per distinct region", len(cfgs))
+	}
+	for region, cfg := range cfgs {
+		if cfg.Region != region {
+			t.Errorf("LoadAWSConfigs() config of %v has region %v", region, cfg.Region)
+		}
+		if checker := NewStatusCheckerFromConfig(cfg); checker.Region != region {
+			t.Errorf("NewStatusCheckerFromConfig() Region = %v, want %v", checker.Region, region)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// updateContainerInstancesStateBatchSize is the maximum number of container instances
+// UpdateContainerInstancesState accepts per call
+const updateContainerInstancesStateBatchSize = 10
+
+// DrainContainerInstances sets the given container instances to DRAINING in batches of up to 10, the most
+// the API accepts per call. Instances that could not be updated are returned together as an error
+func (c *StatusChecker) DrainContainerInstances(ctx context.Context, clusterName string, arns []string) error {
+	var errs []error
+	for start := 0; start < len(arns); start += updateContainerInstancesStateBatchSize {
+		end := min(start+updateContainerInstancesStateBatchSize, len(arns))
+		output, err := c.Client.UpdateContainerInstancesState(ctx, &ecs.UpdateContainerInstancesStateInput{
+			Cluster:            &clusterName,
+			ContainerInstances: arns[start:end],
+			Status:             types.ContainerInstanceStatusDraining,
+		})
+		if err != nil {
+			return c.newAPIError(clusterName, "UpdateContainerInstancesState", err)
+		}
+		for _, failure := range output.Failures {
+			errs = append(errs, fmt.Errorf("drain %s: %s", aws.ToString(failure.Arn), aws.ToString(failure.Reason)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WaitForDrain polls the given container instances every interval until none of them has running tasks and
+// returns the ARNs of the drained ones. If ctx ends first, the instances drained so far are returned with
+// the context's error
+func (c *StatusChecker) WaitForDrain(ctx context.Context, clusterName string, arns []string, interval time.Duration) ([]string, error) {
+	for {
+		output, err := c.DescribeContainerInstances(ctx, clusterName, arns)
+		if err != nil {
+			return nil, err
+		}
+		var drained []string
+		for _, instance := range output.ContainerInstances {
+			if instance.RunningTasksCount == 0 {
+				drained = append(drained, aws.ToString(instance.ContainerInstanceArn))
+			}
+		}
+		if len(drained) == len(arns) {
+			return drained, nil
+		}
+		logger.Debug().Str("cluster", clusterName).Msgf("%v of %v container instances drained", len(drained), len(arns))
+		select {
+		case <-ctx.Done():
+			return drained, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package agentstatus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestDrainContainerInstances(t *testing.T) {
+	client := &mockECSClient{}
+	var arns []string
+	for i := 0; i < 25; i++ {
+		arn := fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:container-instance/production/%04d", i)
+		arns = append(arns, arn)
+		client.instances = append(client.instances, types.ContainerInstance{ContainerInstanceArn: aws.String(arn), Status: aws.String("ACTIVE")})
+	}
+	checker := NewStatusChecker(client, "us-east-1")
+	if err := checker.DrainContainerInstances(context.Background(), "production", arns); err != nil {
+		t.Fatal(err)
+	}
+	if client.updateCalls != 3 {
+		t.Errorf("DrainContainerInstances() made %v calls, want 3", client.updateCalls)
+	}
+	for _, instance := range client.instances {
+		if aws.ToString(instance.Status) != "DRAINING" {
+			t.Errorf("instance %v status = %v, want DRAINING", aws.ToString(instance.ContainerInstanceArn), aws.ToString(instance.Status))
+		}
+	}
+	if err := checker.DrainContainerInstances(context.Background(), "production", []string{"missing"}); err == nil {
+		t.Error("DrainContainerInstances() of a missing instance returned no error")
+	}
+}
+
+func TestWaitForDrain(t *testing.T) {
+	client := &mockECSClient{instances: []types.ContainerInstance{
+		{ContainerInstanceArn: aws.String("aaaa")},
+		{ContainerInstanceArn: aws.String("bbbb"), RunningTasksCount: 2},
+	}}
+	checker := NewStatusChecker(client, "us-east-1")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	drained, err := checker.WaitForDrain(ctx, "production", []string{"aaaa", "bbbb"}, 10*time.Millisecond)
+	if err == nil || !reflect.DeepEqual(drained, []string{"aaaa"}) {
+		t.Errorf("WaitForDrain() = %v, %v, want [aaaa] and a timeout", drained, err)
+	}
+
+	client.instances[1].RunningTasksCount = 0
+	drained, err = checker.WaitForDrain(context.Background(), "production", []string{"aaaa", "bbbb"}, time.Millisecond)
+	if err != nil || len(drained) != 2 {
+		t.Errorf("WaitForDrain() = %v, %v, want both instances", drained, err)
+	}
+}
@@ -0,0 +1,160 @@
+package agentstatus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// describeInstancesBatchSize is the maximum number of values in a DescribeInstances filter
+const describeInstancesBatchSize = 200
+
+// describeInstanceStatusBatchSize is the maximum number of instance IDs DescribeInstanceStatus accepts per call
+const describeInstanceStatusBatchSize = 100
+
+// autoScalingGroupTag is the tag EC2 Auto Scaling puts on the instances it launches
+const autoScalingGroupTag = "aws:autoscaling:groupName"
+
+// EC2InstanceDescriber is the subset of the EC2 API needed to add instance details and status checks to
+// agents. It is satisfied by *ec2.Client
+type EC2InstanceDescriber interface {
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeInstanceStatus(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error)
+}
+
+// ScheduledEvent is an EC2 scheduled event of an instance, such as a retirement or a system reboot
+type ScheduledEvent struct {
+	Code        string     `json:"code"`
+	Description string     `json:"description,omitempty"`
+	NotBefore   *time.Time `json:"notBefore,omitempty"`
+}
+
+// EnrichWithEC2 describes the EC2 instances behind the agents and sets their instance type, availability
+// zone, launch time, private IP, AMI, launch template, tags and Auto Scaling group. External agents and agents without an EC2 instance
+// ID are left unchanged
+func EnrichWithEC2(ctx context.Context, client EC2InstanceDescriber, agents []Agent) error {
+	instances, err := describeInstances(ctx, client, agents)
+	if err != nil {
+		return err
+	}
+	for i := range agents {
+		instance, ok := instances[agents[i].EC2InstanceID]
+		if !ok {
+			continue
+		}
+		agents[i].InstanceType = string(instance.InstanceType)
+		if instance.Placement != nil {
+			agents[i].AvailabilityZone = aws.ToString(instance.Placement.AvailabilityZone)
+		}
+		agents[i].LaunchTime = instance.LaunchTime
+		agents[i].PrivateIP = aws.ToString(instance.PrivateIpAddress)
+		agents[i].ImageID = aws.ToString(instance.ImageId)
+		for _, tag := range instance.Tags {
+			if agents[i].Tags == nil {
+				agents[i].Tags = make(map[string]string)
+			}
+			agents[i].Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			switch aws.ToString(tag.Key) {
+			case autoScalingGroupTag:
+				agents[i].AutoScalingGroup = aws.ToString(tag.Value)
+			case launchTemplateIDTag:
+				agents[i].LaunchTemplateID = aws.ToString(tag.Value)
+			case launchTemplateVersionTag:
+				agents[i].LaunchTemplateVersion = aws.ToString(tag.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// describeInstances describes the EC2 instances of the agents, leaving out external ones, and returns them by
+// instance ID. Instances that no longer exist are missing from the result
+func describeInstances(ctx context.Context, client EC2InstanceDescriber, agents []Agent) (map[string]types.Instance, error) {
+	var ids []string
+	for _, agent := range agents {
+		if agent.EC2InstanceID != "" && agent.LaunchType != LaunchTypeExternal {
+			ids = append(ids, agent.EC2InstanceID)
+		}
+	}
+	instances := make(map[string]types.Instance)
+	for start := 0; start < len(ids); start += describeInstancesBatchSize {
+		// Filter by instance ID rather than passing InstanceIds, which fails the whole call if any instance
+		// has already been terminated
+		paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{{
+				Name:   aws.String("instance-id"),
+				Values: ids[start:min(start+describeInstancesBatchSize, len(ids))],
+			}},
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("describe instances: %w", err)
+			}
+			for _, reservation := range output.Reservations {
+				for _, instance := range reservation.Instances {
+					instances[aws.ToString(instance.InstanceId)] = instance
+				}
+			}
+		}
+	}
+	return instances, nil
+}
+
+// EnrichWithInstanceStatus sets the EC2 system and instance status check results and the scheduled events of
+// the agents whose instance was found by EnrichWithEC2. Other instances are left out, since
+// DescribeInstanceStatus fails the whole call for an unknown instance ID
+func EnrichWithInstanceStatus(ctx context.Context, client EC2InstanceDescriber, agents []Agent) error {
+	var ids []string
+	for _, agent := range agents {
+		if agent.EC2InstanceID != "" && agent.InstanceType != "" && agent.LaunchType != LaunchTypeExternal {
+			ids = append(ids, agent.EC2InstanceID)
+		}
+	}
+	statuses := make(map[string]types.InstanceStatus)
+	for start := 0; start < len(ids); start += describeInstanceStatusBatchSize {
+		paginator := ec2.NewDescribeInstanceStatusPaginator(client, &ec2.DescribeInstanceStatusInput{
+			InstanceIds:         ids[start:min(start+describeInstanceStatusBatchSize, len(ids))],
+			IncludeAllInstances: aws.Bool(true),
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("describe instance status: %w", err)
+			}
+			for _, status := range output.InstanceStatuses {
+				statuses[aws.ToString(status.InstanceId)] = status
+			}
+		}
+	}
+	for i := range agents {
+		status, ok := statuses[agents[i].EC2InstanceID]
+		if !ok {
+			continue
+		}
+		if status.SystemStatus != nil {
+			agents[i].SystemStatus = string(status.SystemStatus.Status)
+		}
+		if status.InstanceStatus != nil {
+			agents[i].InstanceStatus = string(status.InstanceStatus.Status)
+		}
+		for _, event := range status.Events {
+			agents[i].ScheduledEvents = append(agents[i].ScheduledEvents, ScheduledEvent{
+				Code:        string(event.Code),
+				Description: aws.ToString(event.Description),
+				NotBefore:   event.NotBefore,
+			})
+		}
+	}
+	return nil
+}
+
+// StatusCheckFailed reports whether the EC2 system or instance status check of the agent's instance is
+// impaired
+func (a Agent) StatusCheckFailed() bool {
+	return a.SystemStatus == string(types.SummaryStatusImpaired) || a.InstanceStatus == string(types.SummaryStatusImpaired)
+}
@@ -0,0 +1,94 @@
+package agentstatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type mockEC2InstanceDescriber struct {
+	instances   []ec2types.Instance
+	statuses    []ec2types.InstanceStatus
+	calls       int
+	statusCalls int
+}
+
+func (m *mockEC2InstanceDescriber) DescribeInstanceStatus(_ context.Context, params *ec2.DescribeInstanceStatusInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+	m.statusCalls++
+	output := &ec2.DescribeInstanceStatusOutput{}
+	for _, id := range params.InstanceIds {
+		for _, status := range m.statuses {
+			if aws.ToString(status.InstanceId) == id {
+				output.InstanceStatuses = append(output.InstanceStatuses, status)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (m *mockEC2InstanceDescriber) DescribeInstances(_ context.Context, params *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	m.calls++
+	output := &ec2.DescribeInstancesOutput{}
+	for _, id := range params.Filters[0].Values {
+		for _, instance := range m.instances {
+			if aws.ToString(instance.InstanceId) == id {
+				output.Reservations = append(output.Reservations, ec2types.Reservation{Instances: []ec2types.Instance{instance}})
+			}
+		}
+	}
+	return output, nil
+}
+
+func TestEnrichWithEC2(t *testing.T) {
+	launched := time.Date(2023, 11, 20, 8, 0, 0, 0, time.UTC)
+	client := &mockEC2InstanceDescriber{instances: []ec2types.Instance{{
+		InstanceId:       aws.String("i-aaaa"),
+		InstanceType:     ec2types.InstanceTypeC5Large,
+		Placement:        &ec2types.Placement{AvailabilityZone: aws.String("us-east-1b")},
+		LaunchTime:       &launched,
+		PrivateIpAddress: aws.String("10.0.1.23"),
+		ImageId:          aws.String("ami-0abc"),
+		Tags: []ec2types.Tag{{Key: aws.String("aws:autoscaling:groupName"), Value: aws.String("web-asg")},
+			{Key: aws.String("aws:ec2launchtemplate:id"), Value: aws.String("lt-0123")}, {Key: aws.String("aws:ec2launchtemplate:version"), Value: aws.String("4")}},
+	}}}
+	agents := []Agent{{EC2InstanceID: "i-aaaa"}, {EC2InstanceID: "i-gone"}, {AgentStatus: "UNKNOWN"}}
+	if err := EnrichWithEC2(context.Background(), client, agents); err != nil {
+		t.Fatal(err)
+	}
+	got := agents[0]
+	if got.InstanceType != "c5.large" || got.AvailabilityZone != "us-east-1b" || got.PrivateIP != "10.0.1.23" ||
+		got.AutoScalingGroup != "web-asg" || got.Tags["aws:autoscaling:groupName"] != "web-asg" || got.LaunchTime == nil || !got.LaunchTime.Equal(launched) ||
+		got.ImageID != "ami-0abc" || got.LaunchTemplateID != "lt-0123" || got.LaunchTemplateVersion != "4" {
+		t.Errorf("EnrichWithEC2() = %+v", got)
+	}
+	if agents[1].InstanceType != "" || client.calls != 1 {
+		t.Errorf("EnrichWithEC2() enriched a missing instance or made %v calls", client.calls)
+	}
+}
+
+func TestEnrichWithInstanceStatus(t *testing.T) {
+	retirement := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	client := &mockEC2InstanceDescriber{statuses: []ec2types.InstanceStatus{{
+		InstanceId:     aws.String("i-aaaa"),
+		SystemStatus:   &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusImpaired},
+		InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+		Events: []ec2types.InstanceStatusEvent{{Code: ec2types.EventCodeInstanceRetirement,
+			Description: aws.String("The instance is running on degraded hardware"), NotBefore: &retirement}},
+	}}}
+	agents := []Agent{{EC2InstanceID: "i-aaaa", InstanceType: "c5.large"}, {EC2InstanceID: "i-gone"}}
+	if err := EnrichWithInstanceStatus(context.Background(), client, agents); err != nil {
+		t.Fatal(err)
+	}
+	got := agents[0]
+	if got.SystemStatus != "impaired" || got.InstanceStatus != "ok" || !got.StatusCheckFailed() || len(got.ScheduledEvents) != 1 ||
+		got.ScheduledEvents[0].Code != "instance-retirement" || !got.ScheduledEvents[0].NotBefore.Equal(retirement) {
+		t.Errorf("EnrichWithInstanceStatus() = %+v", got)
+	}
+	if agents[1].SystemStatus != "" || agents[1].StatusCheckFailed() || client.statusCalls != 1 {
+		t.Errorf("EnrichWithInstanceStatus() described an instance not found by DescribeInstances or made %v calls", client.statusCalls)
+	}
+}
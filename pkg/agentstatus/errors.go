@@ -0,0 +1,64 @@
+package agentstatus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// ErrThrottled matches, with errors.Is, the errors of API calls that AWS still throttled after the retries
+var ErrThrottled = errors.New("throttled")
+
+// APIError is an AWS API call of a StatusChecker that failed, with the region and cluster it was made for.
+// Use errors.As to get it from the errors of the package, and errors.Is with ErrThrottled to tell
+// throttling from other failures. The AWS error, e.g. a *types.ClusterNotFoundException, is unwrapped
+type APIError struct {
+	Region string
+	// Cluster is the name of the cluster the call was about, empty for calls such as ListClusters
+	Cluster string
+	// Operation is the name of the API operation, e.g. ListContainerInstances
+	Operation string
+	Err       error
+}
+
+// newAPIError wraps the error of an API call of the checker about cluster, which may be empty
+func (c *StatusChecker) newAPIError(cluster, operation string, err error) error {
+	return &APIError{Region: c.Region, Cluster: cluster, Operation: operation, Err: err}
+}
+
+func (e *APIError) Error() string {
+	if e.Cluster == "" {
+		return fmt.Sprintf("%s: %v", operationWords(e.Operation), e.Err)
+	}
+	return fmt.Sprintf("%s in cluster %s: %v", operationWords(e.Operation), e.Cluster, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the call was throttled when target is ErrThrottled
+func (e *APIError) Is(target error) bool {
+	return target == ErrThrottled && IsThrottle(e.Err)
+}
+
+// IsThrottle reports whether err is a throttling error of an AWS API, such as ThrottlingException
+func IsThrottle(err error) bool {
+	return err != nil && retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
+
+// operationWords returns an operation name as lowercase words, e.g. list container instances
+func operationWords(operation string) string {
+	var words strings.Builder
+	for i, r := range operation {
+		if unicode.IsUpper(r) && i > 0 {
+			words.WriteByte(' ')
+		}
+		words.WriteRune(unicode.ToLower(r))
+	}
+	return words.String()
+}
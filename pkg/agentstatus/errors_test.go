@@ -0,0 +1,58 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go"
+)
+
+// failingListClient fails every ListContainerInstances call with err
+type failingListClient struct {
+	mockECSClient
+	err error
+}
+
+func (m *failingListClient) ListContainerInstances(context.Context, *ecs.ListContainerInstancesInput, ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+	return nil, m.err
+}
+
+func TestAPIError(t *testing.T) {
+	throttling := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	checker := NewStatusChecker(&failingListClient{err: throttling}, "us-east-1")
+	_, err := checker.GetAgentStatusForCluster(context.Background(), "web")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetAgentStatusForCluster() error = %v, want an *APIError", err)
+	}
+	if apiErr.Region != "us-east-1" || apiErr.Cluster != "web" || apiErr.Operation != "ListContainerInstances" {
+		t.Errorf("APIError = %+v, want us-east-1, web and ListContainerInstances", apiErr)
+	}
+	if !errors.Is(err, ErrThrottled) {
+		t.Errorf("errors.Is(%v, ErrThrottled) = false, want true", err)
+	}
+	if want := "list container instances in cluster web: api error ThrottlingException: Rate exceeded"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	wrapped := &ClusterError{Region: "us-east-1", Cluster: "web", Err: err}
+	if !errors.Is(wrapped, ErrThrottled) {
+		t.Error("a ClusterError wrapping a throttled call does not match ErrThrottled")
+	}
+
+	checker = NewStatusChecker(&failingListClient{err: &types.ClusterNotFoundException{}}, "us-east-1")
+	_, err = checker.GetAgentStatusForCluster(context.Background(), "web")
+	var notFound *types.ClusterNotFoundException
+	if !errors.As(err, &notFound) || errors.Is(err, ErrThrottled) {
+		t.Errorf("GetAgentStatusForCluster() error = %v, want a ClusterNotFoundException that is not throttling", err)
+	}
+}
+
+func TestErrNoClustersFoundAlias(t *testing.T) {
+	if !errors.Is(ErrNoClustersMatched, ErrNoClustersFound) {
+		t.Error("ErrNoClustersFound does not match ErrNoClustersMatched")
+	}
+}
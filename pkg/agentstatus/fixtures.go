@@ -0,0 +1,147 @@
+package agentstatus
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// fixtureServices are the services whose responses are recorded. Others, such as STS, whose responses
+// hold credentials, are passed through unrecorded
+var fixtureServices = map[string]bool{"ECS": true, "EC2": true, "Auto Scaling": true}
+
+// Fixture is a raw API response written by WithFixtureRecording and served by WithFixtureReplay
+type Fixture struct {
+	Service   string      `json:"service"`
+	Operation string      `json:"operation"`
+	Region    string      `json:"region"`
+	Request   string      `json:"request"`
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header"`
+	Body      string      `json:"body"`
+}
+
+// fixturePath returns the file of the fixture of a request: dir/region/service.operation.hash.json, the
+// hash covering the path, query and body of the request but not the endpoint, so that each page of a
+// paginated call has its own fixture. The body of req is read and replaced
+func fixturePath(dir string, req *http.Request) (string, string, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return "", "", err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.Path + "?" + req.URL.RawQuery + "\n" + string(body)))
+	ctx := req.Context()
+	name := fmt.Sprintf("%s.%s.%s.json", strings.ToLower(awsmiddleware.GetServiceID(ctx)), awsmiddleware.GetOperationName(ctx), hex.EncodeToString(sum[:8]))
+	return filepath.Join(dir, awsmiddleware.GetRegion(ctx), name), string(body), nil
+}
+
+// fixtureRecorder is an aws.HTTPClient writing the ECS and EC2 responses of client to dir
+type fixtureRecorder struct {
+	client aws.HTTPClient
+	dir    string
+}
+
+func (r fixtureRecorder) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !fixtureServices[awsmiddleware.GetServiceID(ctx)] {
+		return r.client.Do(req)
+	}
+	path, requestBody, err := fixturePath(r.dir, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	fixture := Fixture{Service: awsmiddleware.GetServiceID(ctx), Operation: awsmiddleware.GetOperationName(ctx), Region: awsmiddleware.GetRegion(ctx),
+		Request: requestBody, Status: resp.StatusCode, Header: resp.Header, Body: string(body)}
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("record fixture: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, fmt.Errorf("record fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// fixtureReplayer is an aws.HTTPClient serving the fixtures of dir without calling AWS
+type fixtureReplayer struct {
+	dir string
+}
+
+func (r fixtureReplayer) Do(req *http.Request) (*http.Response, error) {
+	path, _, err := fixturePath(r.dir, req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s: %w", awsmiddleware.GetServiceID(req.Context()), awsmiddleware.GetOperationName(req.Context()), err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fixture.Header,
+		Body:          io.NopCloser(strings.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}, nil
+}
+
+// WithFixtureRecording returns a copy of cfg whose clients write the raw response of every ECS and EC2
+// call to a JSON fixture under dir, for WithFixtureReplay to serve. The responses are recorded as
+// received, including those of errors; those of other services, such as STS, are not recorded
+func WithFixtureRecording(cfg aws.Config, dir string) aws.Config {
+	cfg = cfg.Copy()
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	cfg.HTTPClient = fixtureRecorder{client: client, dir: dir}
+	return cfg
+}
+
+// WithFixtureReplay returns a copy of cfg whose clients answer every call with the fixture recorded under
+// dir by WithFixtureRecording for the same request, failing calls that have none. Nothing is sent to AWS,
+// so the calls are signed with placeholder credentials and not retried
+func WithFixtureReplay(cfg aws.Config, dir string) aws.Config {
+	cfg = cfg.Copy()
+	cfg.HTTPClient = fixtureReplayer{dir: dir}
+	cfg.Credentials = credentials.NewStaticCredentialsProvider("replay", "replay", "")
+	cfg.Retryer = func() aws.Retryer { return aws.NopRetryer{} }
+	return cfg
+}
@@ -0,0 +1,66 @@
+package agentstatus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestFixtureRecordingAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch target := r.Header.Get("X-Amz-Target"); {
+		case strings.HasSuffix(target, ".ListContainerInstances"):
+			w.Write([]byte(`{"containerInstanceArns":["arn:aws:ecs:us-east-1:123456789012:container-instance/prod/abc"]}`))
+		case strings.HasSuffix(target, ".DescribeContainerInstances"):
+			// An external instance without an EC2 instance ID or version info, as ECS Anywhere returns them
+			w.Write([]byte(`{"containerInstances":[{"containerInstanceArn":"arn:aws:ecs:us-east-1:123456789012:container-instance/prod/abc",` +
+				`"ec2InstanceId":"mi-0123456789abcdef0","status":"ACTIVE","agentConnected":true,"attributes":[{"name":"ecs.os-type","value":"linux"}]}],"failures":[]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"UnknownOperationException"}`))
+		}
+	}))
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		BaseEndpoint: aws.String(server.URL),
+		HTTPClient:   server.Client(),
+	}
+	dir := t.TempDir()
+	recorder := NewStatusCheckerFromConfig(WithFixtureRecording(cfg, dir))
+	recorder.EC2 = nil
+	recorded, err := recorder.GetAgentStatusForCluster(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	fixtures, err := filepath.Glob(filepath.Join(dir, "us-east-1", "ecs.*.json"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no fixtures recorded: %v", err)
+	}
+	if data, err := os.ReadFile(fixtures[0]); err != nil || strings.Contains(string(data), "SECRET") {
+		t.Errorf("fixture %v: %v, or holds the credentials", fixtures[0], err)
+	}
+
+	replayer := NewStatusCheckerFromConfig(WithFixtureReplay(cfg, dir))
+	replayer.EC2 = nil
+	replayed, err := replayer.GetAgentStatusForCluster(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed agents = %+v, want the recorded %+v", replayed, recorded)
+	}
+	if _, err := replayer.GetAgentStatusForCluster(context.Background(), "staging"); err == nil {
+		t.Error("replaying a call without a fixture returned no error")
+	}
+}
@@ -0,0 +1,90 @@
+package agentstatus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HealthPolicy selects the conditions that make an agent unhealthy
+type HealthPolicy struct {
+	// FailOnStatus treats container instances whose status is not ACTIVE as unhealthy
+	FailOnStatus bool
+	// FailOnDisconnected treats container instances whose agent is not connected as unhealthy
+	FailOnDisconnected bool
+	// FailOnDraining treats DRAINING container instances as unhealthy. FailOnStatus already does
+	FailOnDraining bool
+	// FailOnStaleAgent treats agents marked Outdated by MarkOutdated or VersionDrift by MarkVersionDrift as
+	// unhealthy
+	FailOnStaleAgent bool
+	// MinDisconnectDuration makes FailOnDisconnected ignore agents disconnected for less than this, going by
+	// their DisconnectedSince. Agents whose disconnection time is not known are not ignored
+	MinDisconnectDuration time.Duration
+	// IncludeLifecycleTransitions applies the conditions to the agents of instances in a warm pool or waiting
+	// in a lifecycle hook, which are otherwise never unhealthy. See Agent.LifecycleTransition
+	IncludeLifecycleTransitions bool
+}
+
+// DefaultHealthPolicy treats only non-ACTIVE container instances as unhealthy
+var DefaultHealthPolicy = HealthPolicy{FailOnStatus: true}
+
+// ParseHealthPolicy parses a comma-separated list of conditions: status (not ACTIVE), disconnected (agent
+// not connected), both, draining (DRAINING) or stale-agent (outdated or drifting agent version)
+func ParseHealthPolicy(value string) (HealthPolicy, error) {
+	var policy HealthPolicy
+	for _, condition := range strings.Split(value, ",") {
+		switch strings.TrimSpace(condition) {
+		case "status":
+			policy.FailOnStatus = true
+		case "disconnected":
+			policy.FailOnDisconnected = true
+		case "both":
+			policy.FailOnStatus = true
+			policy.FailOnDisconnected = true
+		case "draining":
+			policy.FailOnDraining = true
+		case "stale-agent":
+			policy.FailOnStaleAgent = true
+		default:
+			return HealthPolicy{}, fmt.Errorf("unknown condition %q: must be status, disconnected, both, draining or stale-agent", condition)
+		}
+	}
+	return policy, nil
+}
+
+// Unhealthy reports whether the agent meets any of the policy's conditions. Agents of instances in a lifecycle
+// transition are healthy unless the policy has IncludeLifecycleTransitions
+func (p HealthPolicy) Unhealthy(agent Agent) bool {
+	if agent.LifecycleTransition() && !p.IncludeLifecycleTransitions {
+		return false
+	}
+	return (p.FailOnStatus && agent.AgentStatus != "ACTIVE") || (p.FailOnDisconnected && !agent.AgentConnected && p.disconnectedLongEnough(agent)) ||
+		(p.FailOnDraining && agent.AgentStatus == "DRAINING") || (p.FailOnStaleAgent && (agent.Outdated || agent.VersionDrift))
+}
+
+// disconnectedLongEnough reports whether a disconnected agent has been disconnected for at least
+// MinDisconnectDuration
+func (p HealthPolicy) disconnectedLongEnough(agent Agent) bool {
+	return agent.DisconnectedSince == nil || time.Duration(agent.DisconnectedForSeconds)*time.Second >= p.MinDisconnectDuration
+}
+
+// UnhealthyAgents returns the agents that are unhealthy under the policy
+func (p HealthPolicy) UnhealthyAgents(agents []Agent) []Agent {
+	var unhealthy []Agent
+	for _, agent := range agents {
+		if p.Unhealthy(agent) {
+			unhealthy = append(unhealthy, agent)
+		}
+	}
+	return unhealthy
+}
+
+// UnhealthyPercent returns the number of agents that are unhealthy under the policy and their percentage of
+// all agents
+func (p HealthPolicy) UnhealthyPercent(agents []Agent) (int, float64) {
+	if len(agents) == 0 {
+		return 0, 0
+	}
+	unhealthy := len(p.UnhealthyAgents(agents))
+	return unhealthy, float64(unhealthy) * 100 / float64(len(agents))
+}
@@ -0,0 +1,74 @@
+package agentstatus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHealthPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    HealthPolicy
+		wantErr bool
+	}{
+		{value: "status", want: HealthPolicy{FailOnStatus: true}},
+		{value: "disconnected", want: HealthPolicy{FailOnDisconnected: true}},
+		{value: "both", want: HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}},
+		{value: "status, disconnected", want: HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}},
+		{value: "draining", want: HealthPolicy{FailOnDraining: true}},
+		{value: "disconnected,stale-agent", want: HealthPolicy{FailOnDisconnected: true, FailOnStaleAgent: true}},
+		{value: "below-capacity", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseHealthPolicy(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHealthPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHealthPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthPolicyMinDisconnectDuration(t *testing.T) {
+	since := time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC)
+	policy := HealthPolicy{FailOnDisconnected: true, MinDisconnectDuration: 5 * time.Minute}
+	blip := Agent{AgentStatus: "ACTIVE", DisconnectedSince: &since, DisconnectedForSeconds: 60}
+	long := Agent{AgentStatus: "ACTIVE", DisconnectedSince: &since, DisconnectedForSeconds: 300}
+	unknown := Agent{AgentStatus: "ACTIVE"}
+	if policy.Unhealthy(blip) || !policy.Unhealthy(long) || !policy.Unhealthy(unknown) {
+		t.Errorf("Unhealthy() = %v, %v, %v for agents disconnected 1m, 5m and for an unknown time, want false, true, true",
+			policy.Unhealthy(blip), policy.Unhealthy(long), policy.Unhealthy(unknown))
+	}
+}
+
+func TestHealthPolicyUnhealthyAgents(t *testing.T) {
+	agents := []Agent{
+		{EC2InstanceID: "i-ok", AgentStatus: "ACTIVE", AgentConnected: true},
+		{EC2InstanceID: "i-disconnected", AgentStatus: "ACTIVE"},
+		{EC2InstanceID: "i-draining", AgentStatus: "DRAINING", AgentConnected: true},
+		{EC2InstanceID: "i-outdated", AgentStatus: "ACTIVE", AgentConnected: true, Outdated: true},
+		{EC2InstanceID: "i-drifting", AgentStatus: "ACTIVE", AgentConnected: true, VersionDrift: true},
+	}
+	tests := []struct {
+		name   string
+		policy HealthPolicy
+		want   []Agent
+	}{
+		{name: "status", policy: HealthPolicy{FailOnStatus: true}, want: []Agent{agents[2]}},
+		{name: "disconnected", policy: HealthPolicy{FailOnDisconnected: true}, want: []Agent{agents[1]}},
+		{name: "both", policy: HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}, want: agents[1:3]},
+		{name: "draining", policy: HealthPolicy{FailOnDraining: true}, want: []Agent{agents[2]}},
+		{name: "stale-agent", policy: HealthPolicy{FailOnStaleAgent: true}, want: agents[3:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.UnhealthyAgents(agents); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnhealthyAgents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// ErrContainerInstanceNotFound is returned by GetAgent when the cluster has no such container instance
+var ErrContainerInstanceNotFound = errors.New("container instance not found")
+
+// GetAgent returns the agent of one container instance of a cluster, identified by its ARN, its ID (the
+// last segment of the ARN) or the ID of its EC2 instance, with the same details as GetAgentStatusForCluster
+func (c *StatusChecker) GetAgent(ctx context.Context, clusterName string, id string) (Agent, error) {
+	arn := id
+	if strings.HasPrefix(id, "i-") {
+		output, err := c.Client.ListContainerInstances(ctx, &ecs.ListContainerInstancesInput{
+			Cluster: &clusterName,
+			Filter:  aws.String("ec2InstanceId == " + id),
+		})
+		if err != nil {
+			return Agent{}, fmt.Errorf("find the container instance of %s in cluster %s: %w", id, clusterName, err)
+		}
+		if len(output.ContainerInstanceArns) == 0 {
+			return Agent{}, fmt.Errorf("%s in cluster %s: %w", id, clusterName, ErrContainerInstanceNotFound)
+		}
+		arn = output.ContainerInstanceArns[0]
+	}
+	output, err := c.DescribeContainerInstances(ctx, clusterName, []string{arn})
+	if err != nil {
+		return Agent{}, err
+	}
+	if len(output.ContainerInstances) == 0 {
+		return Agent{}, fmt.Errorf("%s in cluster %s: %w", id, clusterName, ErrContainerInstanceNotFound)
+	}
+	agents := AgentsFromDescribeOutput(clusterName, &ecs.DescribeContainerInstancesOutput{ContainerInstances: output.ContainerInstances[:1]})
+	c.enrichAgents(ctx, clusterName, agents)
+	return agents[0], nil
+}
@@ -0,0 +1,41 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestGetAgent(t *testing.T) {
+	client := &mockECSClient{instances: []types.ContainerInstance{
+		{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa"), Ec2InstanceId: aws.String("i-aaaa"), Status: aws.String("ACTIVE"), AgentConnected: true},
+		{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb"), Ec2InstanceId: aws.String("i-bbbb"), Status: aws.String("DRAINING")},
+	}}
+	checker := NewStatusChecker(client, "us-east-1")
+	checker.AccountID = "123456789012"
+
+	agent, err := checker.GetAgent(context.Background(), "web", "i-bbbb")
+	if err != nil || agent.ContainerInstanceARN != "arn:aws:ecs:us-east-1:123456789012:container-instance/web/bbbb" || agent.AgentStatus != "DRAINING" {
+		t.Errorf("GetAgent(i-bbbb) = %+v, %v", agent, err)
+	}
+	if agent.Region != "us-east-1" || agent.AccountID != "123456789012" || agent.Cluster != "web" {
+		t.Errorf("GetAgent(i-bbbb) region, account, cluster = %v, %v, %v", agent.Region, agent.AccountID, agent.Cluster)
+	}
+	if client.lastFilter != "ec2InstanceId == i-bbbb" {
+		t.Errorf("GetAgent(i-bbbb) filter = %q", client.lastFilter)
+	}
+
+	agent, err = checker.GetAgent(context.Background(), "web", "arn:aws:ecs:us-east-1:123456789012:container-instance/web/aaaa")
+	if err != nil || agent.EC2InstanceID != "i-aaaa" || !agent.AgentConnected {
+		t.Errorf("GetAgent(arn) = %+v, %v", agent, err)
+	}
+
+	for _, id := range []string{"i-missing", "arn:aws:ecs:us-east-1:123456789012:container-instance/web/missing"} {
+		if _, err := checker.GetAgent(context.Background(), "web", id); !errors.Is(err, ErrContainerInstanceNotFound) {
+			t.Errorf("GetAgent(%v) error = %v, want %v", id, err, ErrContainerInstanceNotFound)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// describeContainerInstancesBatchSize is the maximum number of container instances DescribeContainerInstances
+// accepts per call
+const describeContainerInstancesBatchSize = 100
+
+// ErrNoContainerInstances is returned when a cluster has no registered container instances
+var ErrNoContainerInstances = errors.New("no container instances found")
+
+// ErrFargateOnly is reported for clusters without container instances that run on Fargate, which need no
+// EC2 capacity. It matches ErrNoContainerInstances with errors.Is
+var ErrFargateOnly = fmt.Errorf("%w: N/A – no EC2 capacity (Fargate only)", ErrNoContainerInstances)
+
+// ECSClient is the subset of the ECS API needed to check agent and service status, list tasks and drain instances. It is satisfied
+// by *ecs.Client and can be replaced with a mock in tests
+type ECSClient interface {
+	ECSLister
+	ListContainerInstances(ctx context.Context, params *ecs.ListContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error)
+	DescribeContainerInstances(ctx context.Context, params *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error)
+	DescribeClusters(ctx context.Context, params *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error)
+	UpdateContainerInstancesState(ctx context.Context, params *ecs.UpdateContainerInstancesStateInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error)
+	UpdateContainerAgent(ctx context.Context, params *ecs.UpdateContainerAgentInput, optFns ...func(*ecs.Options)) (*ecs.UpdateContainerAgentOutput, error)
+	DeregisterContainerInstance(ctx context.Context, params *ecs.DeregisterContainerInstanceInput, optFns ...func(*ecs.Options)) (*ecs.DeregisterContainerInstanceOutput, error)
+	ListServices(ctx context.Context, params *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error)
+	DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
+	ListTasks(ctx context.Context, params *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error)
+	DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
+	DescribeCapacityProviders(ctx context.Context, params *ecs.DescribeCapacityProvidersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeCapacityProvidersOutput, error)
+}
+
+// GetContainerInstancesForCluster returns the description of every container instance in the specified ECS
+// cluster that matches c.Filter, if set. The full DescribeContainerInstances response, including Failures, is returned so it can be used to
+// build Agent structs without describing the instances again
+func (c *StatusChecker) GetContainerInstancesForCluster(ctx context.Context, clusterName string) (*ecs.DescribeContainerInstancesOutput, error) {
+	var arns []string
+
+	// Initialize paginator for ListContainerInstances API
+	input := &ecs.ListContainerInstancesInput{Cluster: &clusterName}
+	if c.Filter != "" {
+		input.Filter = &c.Filter
+	}
+	paginator := ecs.NewListContainerInstancesPaginator(c.Client, input)
+
+	// Retrieve every page of container instances for the specified ECS cluster
+	for page := 1; paginator.HasMorePages(); page++ {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, c.newAPIError(clusterName, "ListContainerInstances", err)
+		}
+		logger.Debug().Str("region", c.Region).Str("cluster", clusterName).Int("page", page).Int("containerInstances", len(output.ContainerInstanceArns)).
+			Bool("more", output.NextToken != nil).Msg("listed a page of container instances")
+		arns = append(arns, output.ContainerInstanceArns...)
+	}
+	if len(arns) == 0 && c.Filter != "" {
+		// A filter selecting none of a cluster's instances is not an error
+		return &ecs.DescribeContainerInstancesOutput{}, nil
+	}
+	if len(arns) == 0 {
+		return nil, fmt.Errorf("cluster %s: %w", clusterName, ErrNoContainerInstances)
+	}
+	return c.DescribeContainerInstances(ctx, clusterName, arns)
+}
+
+// DescribeContainerInstances describes the given container instances in batches of up to 100, the most the
+// API accepts per call, c.DescribeWorkers batches at a time, and merges the responses in the order of arns
+func (c *StatusChecker) DescribeContainerInstances(ctx context.Context, clusterName string, arns []string) (*ecs.DescribeContainerInstancesOutput, error) {
+	batches := (len(arns) + describeContainerInstancesBatchSize - 1) / describeContainerInstancesBatchSize
+	outputs := make([]*ecs.DescribeContainerInstancesOutput, batches)
+	errs := make([]error, batches)
+	describe := func(batch int) {
+		start := batch * describeContainerInstancesBatchSize
+		end := min(start+describeContainerInstancesBatchSize, len(arns))
+		describeInput := &ecs.DescribeContainerInstancesInput{
+			Cluster:            &clusterName,
+			ContainerInstances: arns[start:end],
+		}
+		outputs[batch], errs[batch] = c.Client.DescribeContainerInstances(ctx, describeInput)
+	}
+	if workers := min(max(c.DescribeWorkers, 1), batches); workers <= 1 {
+		for batch := range batches {
+			if describe(batch); errs[batch] != nil {
+				break
+			}
+		}
+	} else {
+		next := make(chan int)
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Go(func() {
+				for batch := range next {
+					describe(batch)
+				}
+			})
+		}
+		for batch := range batches {
+			next <- batch
+		}
+		close(next)
+		wg.Wait()
+	}
+
+	merged := &ecs.DescribeContainerInstancesOutput{}
+	for batch, describeOutput := range outputs {
+		if errs[batch] != nil {
+			return nil, c.newAPIError(clusterName, "DescribeContainerInstances", errs[batch])
+		}
+		merged.ContainerInstances = append(merged.ContainerInstances, describeOutput.ContainerInstances...)
+		merged.Failures = append(merged.Failures, describeOutput.Failures...)
+	}
+	return merged, nil
+}
+
+// GetAgentStatusForCluster returns a list of Agent structs for the specified ECS cluster
+func (c *StatusChecker) GetAgentStatusForCluster(ctx context.Context, clusterName string) (agents []Agent, err error) {
+	ctx, span := tracer.Start(ctx, "GetAgentStatusForCluster", trace.WithAttributes(
+		attribute.String("aws.region", c.Region), attribute.String("aws.ecs.cluster", clusterName)))
+	defer func() {
+		span.SetAttributes(attribute.Int("agents", len(agents)))
+		endSpan(span, err)
+	}()
+
+	// Describe the container instances for the specified ECS cluster
+	describeOutput, err := c.GetContainerInstancesForCluster(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the Agent structs from the same response
+	agents = AgentsFromDescribeOutput(clusterName, describeOutput)
+	if c.IncludeRaw {
+		// AgentsFromDescribeOutput returns the described container instances first, in order
+		for i := range describeOutput.ContainerInstances {
+			agents[i].Raw = &describeOutput.ContainerInstances[i]
+		}
+	}
+	if len(c.Attributes) > 0 {
+		for i, instance := range describeOutput.ContainerInstances {
+			agents[i].Attributes = AttributeValues(instance.Attributes, c.Attributes)
+		}
+	}
+	c.enrichAgents(ctx, clusterName, agents)
+	return agents, nil
+}
+
+// enrichAgents records the checker's region and account, when it has one, on the agents of a cluster and
+// adds their EC2 instance details, status checks, Auto Scaling groups and lifecycle states
+func (c *StatusChecker) enrichAgents(ctx context.Context, clusterName string, agents []Agent) {
+	for i := range agents {
+		agents[i].Region = c.Region
+		agents[i].AccountID = valueOr(c.AccountID, agents[i].AccountID)
+	}
+	if c.EC2 != nil {
+		// The EC2 details are informational, so a failure to fetch them does not fail the cluster
+		if err := EnrichWithEC2(ctx, c.EC2, agents); err != nil {
+			logger.Warn().Err(err).Str("cluster", clusterName).Msg("could not add EC2 instance details")
+		}
+		if err := EnrichWithInstanceStatus(ctx, c.EC2, agents); err != nil {
+			logger.Warn().Err(err).Str("cluster", clusterName).Msg("could not add EC2 status checks and scheduled events")
+		}
+	}
+	// Like the EC2 details, the Auto Scaling groups of capacity providers are informational
+	if err := c.ResolveAutoScalingGroups(ctx, agents); err != nil {
+		logger.Warn().Err(err).Str("cluster", clusterName).Msg("could not resolve the Auto Scaling groups of capacity providers")
+	}
+	if c.AutoScaling != nil {
+		if err := EnrichWithLifecycleState(ctx, c.AutoScaling, agents); err != nil {
+			logger.Warn().Err(err).Str("cluster", clusterName).Msg("could not add the Auto Scaling lifecycle states")
+		}
+	}
+}
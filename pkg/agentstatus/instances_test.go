@@ -0,0 +1,360 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// mockECSClient serves canned container instances for a single cluster and counts API calls
+type mockECSClient struct {
+	mockECSLister
+	instances     []types.ContainerInstance
+	clusters      map[string]types.Cluster
+	pageSize      int
+	listCalls     int
+	describeCalls int
+	updateCalls   int
+	lastFilter    string
+	services      []types.Service
+	tasks         []types.Task
+	providers     []types.CapacityProvider
+	providerCalls int
+	// noAgentUpdate lists the container instances whose agent is already the latest version
+	noAgentUpdate map[string]bool
+	agentUpdates  int
+	deregistered  []string
+}
+
+func (m *mockECSClient) DeregisterContainerInstance(_ context.Context, params *ecs.DeregisterContainerInstanceInput, _ ...func(*ecs.Options)) (*ecs.DeregisterContainerInstanceOutput, error) {
+	m.deregistered = append(m.deregistered, aws.ToString(params.ContainerInstance))
+	return &ecs.DeregisterContainerInstanceOutput{}, nil
+}
+
+func (m *mockECSClient) ListContainerInstances(_ context.Context, params *ecs.ListContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+	m.listCalls++
+	m.lastFilter = aws.ToString(params.Filter)
+	pageSize := m.pageSize
+	if pageSize == 0 {
+		pageSize = len(m.instances)
+	}
+	start := 0
+	if params.NextToken != nil {
+		start, _ = strconv.Atoi(*params.NextToken)
+	}
+	end := start + pageSize
+	if end > len(m.instances) {
+		end = len(m.instances)
+	}
+	output := &ecs.ListContainerInstancesOutput{}
+	for _, instance := range m.instances[start:end] {
+		if id, ok := strings.CutPrefix(m.lastFilter, "ec2InstanceId == "); ok && aws.ToString(instance.Ec2InstanceId) != id {
+			continue
+		}
+		output.ContainerInstanceArns = append(output.ContainerInstanceArns, aws.ToString(instance.ContainerInstanceArn))
+	}
+	if end < len(m.instances) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) DescribeContainerInstances(_ context.Context, params *ecs.DescribeContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+	m.describeCalls++
+	output := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range params.ContainerInstances {
+		for _, instance := range m.instances {
+			if aws.ToString(instance.ContainerInstanceArn) == arn {
+				output.ContainerInstances = append(output.ContainerInstances, instance)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) DescribeClusters(_ context.Context, params *ecs.DescribeClustersInput, _ ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+	output := &ecs.DescribeClustersOutput{}
+	for _, name := range params.Clusters {
+		cluster, ok := m.clusters[name]
+		if !ok {
+			output.Failures = append(output.Failures, types.Failure{Arn: aws.String(name), Reason: aws.String("MISSING")})
+			continue
+		}
+		output.Clusters = append(output.Clusters, cluster)
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) UpdateContainerAgent(_ context.Context, params *ecs.UpdateContainerAgentInput, _ ...func(*ecs.Options)) (*ecs.UpdateContainerAgentOutput, error) {
+	arn := aws.ToString(params.ContainerInstance)
+	if m.noAgentUpdate[arn] {
+		return nil, &types.NoUpdateAvailableException{Message: aws.String("no update available")}
+	}
+	for i := range m.instances {
+		if aws.ToString(m.instances[i].ContainerInstanceArn) == arn {
+			m.agentUpdates++
+			m.instances[i].AgentUpdateStatus = types.AgentUpdateStatusUpdated
+			return &ecs.UpdateContainerAgentOutput{ContainerInstance: &m.instances[i]}, nil
+		}
+	}
+	return nil, &types.InvalidParameterException{Message: aws.String("container instance not found")}
+}
+
+func (m *mockECSClient) UpdateContainerInstancesState(_ context.Context, params *ecs.UpdateContainerInstancesStateInput, _ ...func(*ecs.Options)) (*ecs.UpdateContainerInstancesStateOutput, error) {
+	m.updateCalls++
+	output := &ecs.UpdateContainerInstancesStateOutput{}
+	for _, arn := range params.ContainerInstances {
+		found := false
+		for i := range m.instances {
+			if aws.ToString(m.instances[i].ContainerInstanceArn) == arn {
+				m.instances[i].Status = aws.String(string(params.Status))
+				output.ContainerInstances = append(output.ContainerInstances, m.instances[i])
+				found = true
+			}
+		}
+		if !found {
+			output.Failures = append(output.Failures, types.Failure{Arn: aws.String(arn), Reason: aws.String("MISSING")})
+		}
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) ListServices(_ context.Context, params *ecs.ListServicesInput, _ ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+	output := &ecs.ListServicesOutput{}
+	for _, service := range m.services {
+		output.ServiceArns = append(output.ServiceArns, aws.ToString(service.ServiceArn))
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) DescribeServices(_ context.Context, params *ecs.DescribeServicesInput, _ ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	m.describeCalls++
+	output := &ecs.DescribeServicesOutput{}
+	for _, arn := range params.Services {
+		for _, service := range m.services {
+			if aws.ToString(service.ServiceArn) == arn {
+				output.Services = append(output.Services, service)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) ListTasks(_ context.Context, params *ecs.ListTasksInput, _ ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+	output := &ecs.ListTasksOutput{}
+	for _, task := range m.tasks {
+		if aws.ToString(task.ContainerInstanceArn) == aws.ToString(params.ContainerInstance) {
+			output.TaskArns = append(output.TaskArns, aws.ToString(task.TaskArn))
+		}
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) DescribeTasks(_ context.Context, params *ecs.DescribeTasksInput, _ ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	output := &ecs.DescribeTasksOutput{}
+	for _, arn := range params.Tasks {
+		for _, task := range m.tasks {
+			if aws.ToString(task.TaskArn) == arn {
+				output.Tasks = append(output.Tasks, task)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (m *mockECSClient) DescribeCapacityProviders(_ context.Context, params *ecs.DescribeCapacityProvidersInput, _ ...func(*ecs.Options)) (*ecs.DescribeCapacityProvidersOutput, error) {
+	m.providerCalls++
+	output := &ecs.DescribeCapacityProvidersOutput{}
+	for _, name := range params.CapacityProviders {
+		for _, provider := range m.providers {
+			if aws.ToString(provider.Name) == name {
+				output.CapacityProviders = append(output.CapacityProviders, provider)
+			}
+		}
+	}
+	return output, nil
+}
+
+func TestGetAgentStatusForClusterDescribesOnce(t *testing.T) {
+	client := &mockECSClient{
+		instances: []types.ContainerInstance{
+			{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/aaaa"), Ec2InstanceId: aws.String("i-aaaa"), Status: aws.String("ACTIVE")},
+			{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/bbbb"), Ec2InstanceId: aws.String("i-bbbb"), Status: aws.String("DRAINING")},
+			{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/cccc"), Ec2InstanceId: aws.String("i-cccc"), Status: aws.String("ACTIVE")},
+		},
+	}
+	agents, err := NewStatusChecker(client, "us-east-1").GetAgentStatusForCluster(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("GetAgentStatusForCluster() error = %v", err)
+	}
+	if len(agents) != 3 {
+		t.Errorf("GetAgentStatusForCluster() returned %d agents, want 3", len(agents))
+	}
+	for _, agent := range agents {
+		if agent.Region != "us-east-1" {
+			t.Errorf("agent %v Region = %q, want us-east-1", agent.EC2InstanceID, agent.Region)
+		}
+	}
+	if client.describeCalls != 1 {
+		t.Errorf("DescribeContainerInstances called %d times, want 1", client.describeCalls)
+	}
+}
+
+func TestGetAgentStatusForClusterRegion(t *testing.T) {
+	client := &mockECSClient{instances: []types.ContainerInstance{
+		{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/aaaa"), Ec2InstanceId: aws.String("i-aaaa"), Status: aws.String("ACTIVE")},
+	}}
+	for _, region := range []string{"us-east-1", "eu-west-1"} {
+		agents, err := NewStatusChecker(client, region).GetAgentStatusForCluster(context.Background(), "production")
+		if err != nil {
+			t.Fatalf("GetAgentStatusForCluster() error = %v", err)
+		}
+		if len(agents) != 1 || agents[0].Region != region {
+			t.Errorf("GetAgentStatusForCluster() in %v = %+v, want the agent tagged with the checker's region", region, agents)
+		}
+	}
+}
+
+func TestGetAgentStatusForClusterIncludeRaw(t *testing.T) {
+	client := &mockECSClient{
+		instances: []types.ContainerInstance{
+			{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/aaaa"), Ec2InstanceId: aws.String("i-aaaa"), Status: aws.String("ACTIVE"),
+				Attributes: []types.Attribute{{Name: aws.String("ecs.instance-type"), Value: aws.String("c5.large")}}},
+		},
+	}
+	checker := NewStatusChecker(client, "us-east-1")
+	agents, err := checker.GetAgentStatusForCluster(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("GetAgentStatusForCluster() error = %v", err)
+	}
+	if agents[0].Raw != nil {
+		t.Errorf("Raw = %+v without IncludeRaw, want nil", agents[0].Raw)
+	}
+	checker.IncludeRaw = true
+	if agents, err = checker.GetAgentStatusForCluster(context.Background(), "production"); err != nil {
+		t.Fatalf("GetAgentStatusForCluster() error = %v", err)
+	}
+	if agents[0].Raw == nil || len(agents[0].Raw.Attributes) != 1 || aws.ToString(agents[0].Raw.Ec2InstanceId) != "i-aaaa" {
+		t.Errorf("Raw = %+v, want the described container instance", agents[0].Raw)
+	}
+}
+
+func TestDescribeContainerInstancesBatches(t *testing.T) {
+	client := &mockECSClient{}
+	var arns []string
+	for i := 0; i < 250; i++ {
+		arn := fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:container-instance/production/%04d", i)
+		arns = append(arns, arn)
+		client.instances = append(client.instances, types.ContainerInstance{ContainerInstanceArn: aws.String(arn), Status: aws.String("ACTIVE")})
+	}
+	output, err := NewStatusChecker(client, "").DescribeContainerInstances(context.Background(), "production", arns)
+	if err != nil {
+		t.Fatalf("DescribeContainerInstances() error = %v", err)
+	}
+	if len(output.ContainerInstances) != 250 {
+		t.Errorf("DescribeContainerInstances() returned %d instances, want 250", len(output.ContainerInstances))
+	}
+	if client.describeCalls != 3 {
+		t.Errorf("DescribeContainerInstances called %d times, want 3", client.describeCalls)
+	}
+}
+
+// concurrentDescribeECS describes any container instance as ACTIVE, counting the calls in progress at once
+type concurrentDescribeECS struct {
+	ECSClient
+	inFlight, maxInFlight atomic.Int64
+}
+
+func (c *concurrentDescribeECS) DescribeContainerInstances(_ context.Context, params *ecs.DescribeContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for current := c.maxInFlight.Load(); n > current && !c.maxInFlight.CompareAndSwap(current, n); current = c.maxInFlight.Load() {
+	}
+	time.Sleep(5 * time.Millisecond)
+	output := &ecs.DescribeContainerInstancesOutput{}
+	for _, arn := range params.ContainerInstances {
+		output.ContainerInstances = append(output.ContainerInstances, types.ContainerInstance{ContainerInstanceArn: aws.String(arn), Status: aws.String("ACTIVE")})
+	}
+	return output, nil
+}
+
+func TestDescribeContainerInstancesWorkers(t *testing.T) {
+	client := &concurrentDescribeECS{}
+	var arns []string
+	for i := 0; i < 450; i++ {
+		arns = append(arns, fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:container-instance/production/%04d", i))
+	}
+	checker := NewStatusChecker(client, "")
+	checker.DescribeWorkers = 3
+	output, err := checker.DescribeContainerInstances(context.Background(), "production", arns)
+	if err != nil {
+		t.Fatalf("DescribeContainerInstances() error = %v", err)
+	}
+	for i, instance := range output.ContainerInstances {
+		if aws.ToString(instance.ContainerInstanceArn) != arns[i] {
+			t.Fatalf("DescribeContainerInstances() instance %d = %v, want the order of the ARNs", i, aws.ToString(instance.ContainerInstanceArn))
+		}
+	}
+	if len(output.ContainerInstances) != 450 || client.maxInFlight.Load() != 3 {
+		t.Errorf("DescribeContainerInstances() = %d instances with %d calls at once, want 450 with 3", len(output.ContainerInstances), client.maxInFlight.Load())
+	}
+}
+
+func TestGetContainerInstancesForClusterPagination(t *testing.T) {
+	tests := []struct {
+		name          string
+		instances     int
+		pageSize      int
+		wantListCalls int
+		wantErr       error
+	}{
+		{name: "single page", instances: 3, pageSize: 100, wantListCalls: 1},
+		{name: "multiple pages", instances: 250, pageSize: 100, wantListCalls: 3},
+		{name: "exact page boundary", instances: 200, pageSize: 100, wantListCalls: 2},
+		{name: "empty cluster", instances: 0, pageSize: 100, wantListCalls: 1, wantErr: ErrNoContainerInstances},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockECSClient{pageSize: tt.pageSize}
+			for i := 0; i < tt.instances; i++ {
+				arn := fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:container-instance/production/%04d", i)
+				client.instances = append(client.instances, types.ContainerInstance{ContainerInstanceArn: aws.String(arn), Status: aws.String("ACTIVE")})
+			}
+			output, err := NewStatusChecker(client, "").GetContainerInstancesForCluster(context.Background(), "production")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetContainerInstancesForCluster() error = %v, want %v", err, tt.wantErr)
+			}
+			if client.listCalls != tt.wantListCalls {
+				t.Errorf("ListContainerInstances called %d times, want %d", client.listCalls, tt.wantListCalls)
+			}
+			if err == nil && len(output.ContainerInstances) != tt.instances {
+				t.Errorf("GetContainerInstancesForCluster() returned %d instances, want %d", len(output.ContainerInstances), tt.instances)
+			}
+		})
+	}
+}
+
+func TestGetContainerInstancesForClusterFilter(t *testing.T) {
+	client := &mockECSClient{}
+	checker := NewStatusChecker(client, "us-east-1")
+	checker.Filter = "attribute:ecs.instance-type == c5.large"
+	output, err := checker.GetContainerInstancesForCluster(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("GetContainerInstancesForCluster() with a filter matching nothing error = %v", err)
+	}
+	if len(output.ContainerInstances) != 0 || client.describeCalls != 0 {
+		t.Errorf("GetContainerInstancesForCluster() = %v instances after %v describe calls, want none", len(output.ContainerInstances), client.describeCalls)
+	}
+	if client.lastFilter != checker.Filter {
+		t.Errorf("ListContainerInstances filter = %q, want %q", client.lastFilter, checker.Filter)
+	}
+}
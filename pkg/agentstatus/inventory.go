@@ -0,0 +1,69 @@
+package agentstatus
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// ClusterInfo is the cluster-level inventory of an ECS cluster: its status, the counts ECS keeps for it and
+// its capacity providers
+type ClusterInfo struct {
+	Region             string   `json:"region"`
+	AccountID          string   `json:"accountId,omitempty"`
+	Name               string   `json:"name"`
+	Arn                string   `json:"arn"`
+	Status             string   `json:"status"`
+	ContainerInstances int32    `json:"containerInstances"`
+	RunningTasks       int32    `json:"runningTasks"`
+	PendingTasks       int32    `json:"pendingTasks"`
+	ActiveServices     int32    `json:"activeServices"`
+	CapacityProviders  []string `json:"capacityProviders"`
+}
+
+// NewClusterInfo converts an ECS cluster description to a ClusterInfo
+func NewClusterInfo(cluster types.Cluster) ClusterInfo {
+	providers := cluster.CapacityProviders
+	if providers == nil {
+		providers = []string{}
+	}
+	return ClusterInfo{
+		Name:               aws.ToString(cluster.ClusterName),
+		Arn:                aws.ToString(cluster.ClusterArn),
+		Status:             aws.ToString(cluster.Status),
+		ContainerInstances: cluster.RegisteredContainerInstancesCount,
+		RunningTasks:       cluster.RunningTasksCount,
+		PendingTasks:       cluster.PendingTasksCount,
+		ActiveServices:     cluster.ActiveServicesCount,
+		CapacityProviders:  providers,
+	}
+}
+
+// DescribeClusterInventory describes the named clusters in batches of up to 100 and returns their
+// inventory in the order ECS returns them. Clusters that could not be described are skipped with a warning,
+// and clusters that are not ACTIVE unless IncludeInactive is set
+func (c *StatusChecker) DescribeClusterInventory(ctx context.Context, clusters []string) ([]ClusterInfo, error) {
+	var inventory []ClusterInfo
+	for start := 0; start < len(clusters); start += describeClustersBatchSize {
+		end := min(start+describeClustersBatchSize, len(clusters))
+		output, err := c.Client.DescribeClusters(ctx, &ecs.DescribeClustersInput{Clusters: clusters[start:end]})
+		if err != nil {
+			return nil, c.newAPIError("", "DescribeClusters", err)
+		}
+		for _, failure := range output.Failures {
+			logger.Warn().Str("arn", aws.ToString(failure.Arn)).Str("reason", aws.ToString(failure.Reason)).Msg("skipping cluster that could not be described")
+		}
+		for _, cluster := range output.Clusters {
+			info := NewClusterInfo(cluster)
+			if info.Status != "ACTIVE" && !c.IncludeInactive {
+				logger.Debug().Str("cluster", info.Name).Str("status", info.Status).Msgf("skipping %v cluster %v", info.Status, info.Name)
+				continue
+			}
+			info.Region, info.AccountID = c.Region, c.AccountID
+			inventory = append(inventory, info)
+		}
+	}
+	return inventory, nil
+}
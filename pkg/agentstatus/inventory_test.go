@@ -0,0 +1,28 @@
+package agentstatus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestDescribeClusterInventory(t *testing.T) {
+	client := &mockECSClient{clusters: map[string]types.Cluster{
+		"prod": {ClusterName: aws.String("prod"), ClusterArn: aws.String("arn:aws:ecs:us-east-1:123456789012:cluster/prod"),
+			Status: aws.String("ACTIVE"), RegisteredContainerInstancesCount: 3, RunningTasksCount: 12, PendingTasksCount: 1,
+			ActiveServicesCount: 4, CapacityProviders: []string{"prod-asg"}},
+	}}
+	checker := &StatusChecker{Client: client, Region: "us-east-1", AccountID: "123456789012"}
+	inventory, err := checker.DescribeClusterInventory(context.Background(), []string{"prod", "gone"})
+	if err != nil {
+		t.Fatalf("DescribeClusterInventory() error = %v", err)
+	}
+	want := []ClusterInfo{{Region: "us-east-1", AccountID: "123456789012", Name: "prod", Arn: "arn:aws:ecs:us-east-1:123456789012:cluster/prod",
+		Status: "ACTIVE", ContainerInstances: 3, RunningTasks: 12, PendingTasks: 1, ActiveServices: 4, CapacityProviders: []string{"prod-asg"}}}
+	if !reflect.DeepEqual(inventory, want) {
+		t.Errorf("DescribeClusterInventory() = %+v, want %+v", inventory, want)
+	}
+}
@@ -0,0 +1,161 @@
+package agentstatus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	asgtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// Tags EC2 puts on the instances launched from a launch template
+const (
+	launchTemplateIDTag      = "aws:ec2launchtemplate:id"
+	launchTemplateVersionTag = "aws:ec2launchtemplate:version"
+)
+
+// describeAutoScalingGroupsBatchSize is the number of group names passed to each DescribeAutoScalingGroups call
+const describeAutoScalingGroupsBatchSize = 50
+
+// AutoScalingGroupDescriber is the subset of the Auto Scaling API needed to find the launch template of
+// Auto Scaling groups. It is satisfied by *autoscaling.Client
+type AutoScalingGroupDescriber interface {
+	DescribeAutoScalingGroups(ctx context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error)
+}
+
+// LaunchTemplateDescriber is the subset of the EC2 API needed to resolve the $Latest and $Default versions of
+// launch templates. It is satisfied by *ec2.Client
+type LaunchTemplateDescriber interface {
+	DescribeLaunchTemplates(ctx context.Context, params *ec2.DescribeLaunchTemplatesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeLaunchTemplatesOutput, error)
+}
+
+// groupLaunchTemplate returns the launch template of an Auto Scaling group, set directly or through its mixed
+// instances policy, or nil for groups using a launch configuration
+func groupLaunchTemplate(group asgtypes.AutoScalingGroup) *asgtypes.LaunchTemplateSpecification {
+	if group.LaunchTemplate != nil {
+		return group.LaunchTemplate
+	}
+	if group.MixedInstancesPolicy != nil && group.MixedInstancesPolicy.LaunchTemplate != nil {
+		return group.MixedInstancesPolicy.LaunchTemplate.LaunchTemplateSpecification
+	}
+	return nil
+}
+
+// resolveLaunchTemplateVersion returns the version number of a launch template version, looking up $Latest
+// and $Default, which is also the version of a group that names none. The template is described by ID when
+// the specification has one and by name otherwise, and returned with its ID
+func resolveLaunchTemplateVersion(ctx context.Context, client LaunchTemplateDescriber, spec asgtypes.LaunchTemplateSpecification) (string, string, error) {
+	id, version := aws.ToString(spec.LaunchTemplateId), aws.ToString(spec.Version)
+	if _, err := strconv.Atoi(version); err == nil && id != "" {
+		return id, version, nil
+	}
+	input := &ec2.DescribeLaunchTemplatesInput{}
+	if id != "" {
+		input.LaunchTemplateIds = []string{id}
+	} else {
+		input.LaunchTemplateNames = []string{aws.ToString(spec.LaunchTemplateName)}
+	}
+	output, err := client.DescribeLaunchTemplates(ctx, input)
+	if err != nil {
+		return "", "", fmt.Errorf("describe launch templates: %w", err)
+	}
+	if len(output.LaunchTemplates) == 0 {
+		return "", "", fmt.Errorf("launch template %v not found", valueOr(id, aws.ToString(spec.LaunchTemplateName)))
+	}
+	template := output.LaunchTemplates[0]
+	id = aws.ToString(template.LaunchTemplateId)
+	switch version {
+	case "$Latest":
+		version = strconv.FormatInt(aws.ToInt64(template.LatestVersionNumber), 10)
+	case "$Default", "":
+		version = strconv.FormatInt(aws.ToInt64(template.DefaultVersionNumber), 10)
+	}
+	return id, version, nil
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// MarkLaunchTemplateDrift describes the Auto Scaling groups of the agents and sets LaunchTemplateDrift on
+// every agent whose instance was not launched from the current version of its group's launch template, e.g.
+// one left behind by a failed instance refresh. The launch template and version of each instance are taken
+// from its group, and CurrentLaunchTemplateVersion is set to the group's. Agents outside a group, and groups
+// using a launch configuration, are left unchanged. It returns the number of drifting agents; groups whose
+// template could not be resolved are skipped and the first error is returned
+func MarkLaunchTemplateDrift(ctx context.Context, asg AutoScalingGroupDescriber, templates LaunchTemplateDescriber, agents []Agent) (int, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, agent := range agents {
+		if agent.AutoScalingGroup != "" && agent.EC2InstanceID != "" && !seen[agent.AutoScalingGroup] {
+			seen[agent.AutoScalingGroup] = true
+			names = append(names, agent.AutoScalingGroup)
+		}
+	}
+	groups := make(map[string]asgtypes.AutoScalingGroup)
+	for start := 0; start < len(names); start += describeAutoScalingGroupsBatchSize {
+		paginator := autoscaling.NewDescribeAutoScalingGroupsPaginator(asg, &autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: names[start:min(start+describeAutoScalingGroupsBatchSize, len(names))],
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return 0, fmt.Errorf("describe auto scaling groups: %w", err)
+			}
+			for _, group := range output.AutoScalingGroups {
+				groups[aws.ToString(group.AutoScalingGroupName)] = group
+			}
+		}
+	}
+	// current holds the launch template ID and version number of each group, resolved once per group
+	type templateVersion struct{ id, version string }
+	current := make(map[string]templateVersion)
+	// launched holds the launch template of each instance of the groups
+	launched := make(map[string]*asgtypes.LaunchTemplateSpecification)
+	var firstErr error
+	for _, name := range names {
+		group, ok := groups[name]
+		if !ok {
+			continue
+		}
+		for _, instance := range group.Instances {
+			launched[aws.ToString(instance.InstanceId)] = instance.LaunchTemplate
+		}
+		spec := groupLaunchTemplate(group)
+		if spec == nil {
+			continue
+		}
+		id, version, err := resolveLaunchTemplateVersion(ctx, templates, *spec)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("auto scaling group %v: %w", name, err)
+			}
+			continue
+		}
+		current[name] = templateVersion{id: id, version: version}
+	}
+	drifting := 0
+	for i := range agents {
+		want, ok := current[agents[i].AutoScalingGroup]
+		if !ok {
+			continue
+		}
+		if spec := launched[agents[i].EC2InstanceID]; spec != nil {
+			agents[i].LaunchTemplateID = aws.ToString(spec.LaunchTemplateId)
+			agents[i].LaunchTemplateVersion = aws.ToString(spec.Version)
+		}
+		agents[i].CurrentLaunchTemplateVersion = want.version
+		agents[i].LaunchTemplateDrift = agents[i].LaunchTemplateID != want.id || agents[i].LaunchTemplateVersion != want.version
+		if agents[i].LaunchTemplateDrift {
+			drifting++
+		}
+	}
+	return drifting, firstErr
+}
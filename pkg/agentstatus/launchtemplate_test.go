@@ -0,0 +1,120 @@
+package agentstatus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	asgtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type mockAutoScalingGroupDescriber struct {
+	groups []asgtypes.AutoScalingGroup
+}
+
+func (m *mockAutoScalingGroupDescriber) DescribeAutoScalingGroups(_ context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, _ ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	output := &autoscaling.DescribeAutoScalingGroupsOutput{}
+	for _, name := range params.AutoScalingGroupNames {
+		for _, group := range m.groups {
+			if aws.ToString(group.AutoScalingGroupName) == name {
+				output.AutoScalingGroups = append(output.AutoScalingGroups, group)
+			}
+		}
+	}
+	return output, nil
+}
+
+type mockLaunchTemplateDescriber struct {
+	templates []ec2types.LaunchTemplate
+	calls     int
+}
+
+func (m *mockLaunchTemplateDescriber) DescribeLaunchTemplates(_ context.Context, params *ec2.DescribeLaunchTemplatesInput, _ ...func(*ec2.Options)) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	m.calls++
+	output := &ec2.DescribeLaunchTemplatesOutput{}
+	for _, template := range m.templates {
+		for _, id := range params.LaunchTemplateIds {
+			if aws.ToString(template.LaunchTemplateId) == id {
+				output.LaunchTemplates = append(output.LaunchTemplates, template)
+			}
+		}
+		for _, name := range params.LaunchTemplateNames {
+			if aws.ToString(template.LaunchTemplateName) == name {
+				output.LaunchTemplates = append(output.LaunchTemplates, template)
+			}
+		}
+	}
+	return output, nil
+}
+
+func launchedFrom(instanceID, templateID, version string) asgtypes.Instance {
+	return asgtypes.Instance{InstanceId: aws.String(instanceID),
+		LaunchTemplate: &asgtypes.LaunchTemplateSpecification{LaunchTemplateId: aws.String(templateID), Version: aws.String(version)}}
+}
+
+func TestMarkLaunchTemplateDrift(t *testing.T) {
+	asg := &mockAutoScalingGroupDescriber{groups: []asgtypes.AutoScalingGroup{
+		{
+			AutoScalingGroupName: aws.String("web-asg"),
+			LaunchTemplate:       &asgtypes.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web"), Version: aws.String("$Latest")},
+			Instances:            []asgtypes.Instance{launchedFrom("i-new", "lt-web", "7"), launchedFrom("i-old", "lt-web", "6")},
+		},
+		{
+			AutoScalingGroupName: aws.String("batch-asg"),
+			MixedInstancesPolicy: &asgtypes.MixedInstancesPolicy{LaunchTemplate: &asgtypes.LaunchTemplate{
+				LaunchTemplateSpecification: &asgtypes.LaunchTemplateSpecification{LaunchTemplateId: aws.String("lt-batch"), Version: aws.String("3")}}},
+			Instances: []asgtypes.Instance{launchedFrom("i-batch", "lt-batch", "3")},
+		},
+		{AutoScalingGroupName: aws.String("legacy-asg"), LaunchConfigurationName: aws.String("legacy")},
+	}}
+	templates := &mockLaunchTemplateDescriber{templates: []ec2types.LaunchTemplate{{LaunchTemplateId: aws.String("lt-web"),
+		LaunchTemplateName: aws.String("web"), LatestVersionNumber: aws.Int64(7), DefaultVersionNumber: aws.Int64(5)}}}
+	agents := []Agent{
+		{EC2InstanceID: "i-new", AutoScalingGroup: "web-asg"},
+		{EC2InstanceID: "i-old", AutoScalingGroup: "web-asg"},
+		{EC2InstanceID: "i-batch", AutoScalingGroup: "batch-asg"},
+		{EC2InstanceID: "i-legacy", AutoScalingGroup: "legacy-asg"},
+		{EC2InstanceID: "i-standalone"},
+	}
+	drifting, err := MarkLaunchTemplateDrift(context.Background(), asg, templates, agents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drifting != 1 || !agents[1].LaunchTemplateDrift || agents[0].LaunchTemplateDrift || agents[2].LaunchTemplateDrift {
+		t.Errorf("MarkLaunchTemplateDrift() = %v, agents %+v", drifting, agents)
+	}
+	if agents[1].LaunchTemplateVersion != "6" || agents[1].CurrentLaunchTemplateVersion != "7" || agents[1].LaunchTemplateID != "lt-web" {
+		t.Errorf("MarkLaunchTemplateDrift() set %+v", agents[1])
+	}
+	if agents[3].CurrentLaunchTemplateVersion != "" || agents[3].LaunchTemplateDrift {
+		t.Errorf("MarkLaunchTemplateDrift() marked the instance of a launch configuration group: %+v", agents[3])
+	}
+	// The numbered version of batch-asg needs no lookup
+	if templates.calls != 1 {
+		t.Errorf("MarkLaunchTemplateDrift() described launch templates %v times, want 1", templates.calls)
+	}
+}
+
+func TestResolveLaunchTemplateVersion(t *testing.T) {
+	templates := &mockLaunchTemplateDescriber{templates: []ec2types.LaunchTemplate{{LaunchTemplateId: aws.String("lt-web"),
+		LaunchTemplateName: aws.String("web"), LatestVersionNumber: aws.Int64(7), DefaultVersionNumber: aws.Int64(5)}}}
+	tests := []struct {
+		spec    asgtypes.LaunchTemplateSpecification
+		version string
+		wantErr bool
+	}{
+		{spec: asgtypes.LaunchTemplateSpecification{LaunchTemplateId: aws.String("lt-web"), Version: aws.String("$Default")}, version: "5"},
+		{spec: asgtypes.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web")}, version: "5"},
+		{spec: asgtypes.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web"), Version: aws.String("2")}, version: "2"},
+		{spec: asgtypes.LaunchTemplateSpecification{LaunchTemplateName: aws.String("gone")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		id, version, err := resolveLaunchTemplateVersion(context.Background(), templates, tt.spec)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && (id != "lt-web" || version != tt.version)) {
+			t.Errorf("resolveLaunchTemplateVersion(%+v) = %q, %q, %v", tt.spec, id, version, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package agentstatus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+)
+
+// describeAutoScalingInstancesBatchSize is the maximum number of instance IDs DescribeAutoScalingInstances
+// accepts per call
+const describeAutoScalingInstancesBatchSize = 50
+
+// Auto Scaling lifecycle states of instances waiting in a lifecycle hook
+const (
+	LifecycleStatePendingWait     = "Pending:Wait"
+	LifecycleStateTerminatingWait = "Terminating:Wait"
+)
+
+// warmPoolStatePrefix starts the lifecycle states of the instances of a warm pool, e.g. Warmed:Stopped or
+// Warmed:Pending:Wait
+const warmPoolStatePrefix = "Warmed:"
+
+// AutoScalingInstanceDescriber is the subset of the Auto Scaling API needed to add the lifecycle state of
+// instances to agents. It is satisfied by *autoscaling.Client
+type AutoScalingInstanceDescriber interface {
+	DescribeAutoScalingInstances(ctx context.Context, params *autoscaling.DescribeAutoScalingInstancesInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingInstancesOutput, error)
+}
+
+// EnrichWithLifecycleState describes the Auto Scaling instances behind the agents in an Auto Scaling group and
+// sets their LifecycleState, and WarmPool for those in the group's warm pool. Agents outside a group, and
+// instances no longer in one, are left unchanged
+func EnrichWithLifecycleState(ctx context.Context, client AutoScalingInstanceDescriber, agents []Agent) error {
+	var ids []string
+	for _, agent := range agents {
+		if agent.AutoScalingGroup != "" && agent.EC2InstanceID != "" {
+			ids = append(ids, agent.EC2InstanceID)
+		}
+	}
+	states := make(map[string]string)
+	for start := 0; start < len(ids); start += describeAutoScalingInstancesBatchSize {
+		paginator := autoscaling.NewDescribeAutoScalingInstancesPaginator(client, &autoscaling.DescribeAutoScalingInstancesInput{
+			InstanceIds: ids[start:min(start+describeAutoScalingInstancesBatchSize, len(ids))],
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("describe auto scaling instances: %w", err)
+			}
+			for _, instance := range output.AutoScalingInstances {
+				states[aws.ToString(instance.InstanceId)] = aws.ToString(instance.LifecycleState)
+			}
+		}
+	}
+	for i := range agents {
+		if state, ok := states[agents[i].EC2InstanceID]; ok {
+			agents[i].LifecycleState = state
+			agents[i].WarmPool = strings.HasPrefix(state, warmPoolStatePrefix)
+		}
+	}
+	return nil
+}
+
+// LifecycleTransition reports whether the instance of the agent is in a warm pool or waiting in a Pending:Wait
+// or Terminating:Wait lifecycle hook, where its agent may legitimately be stopped, disconnected or not yet
+// registered properly
+func (a Agent) LifecycleTransition() bool {
+	return a.WarmPool || a.LifecycleState == LifecycleStatePendingWait || a.LifecycleState == LifecycleStateTerminatingWait
+}
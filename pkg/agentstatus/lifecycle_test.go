@@ -0,0 +1,67 @@
+package agentstatus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	asgtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+)
+
+// mockAutoScalingInstances describes the instances of states in Auto Scaling, recording the IDs asked for
+type mockAutoScalingInstances struct {
+	states map[string]string
+	asked  [][]string
+}
+
+func (m *mockAutoScalingInstances) DescribeAutoScalingInstances(_ context.Context, params *autoscaling.DescribeAutoScalingInstancesInput, _ ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	m.asked = append(m.asked, params.InstanceIds)
+	output := &autoscaling.DescribeAutoScalingInstancesOutput{}
+	for _, id := range params.InstanceIds {
+		if state, ok := m.states[id]; ok {
+			output.AutoScalingInstances = append(output.AutoScalingInstances, asgtypes.AutoScalingInstanceDetails{InstanceId: aws.String(id), LifecycleState: aws.String(state)})
+		}
+	}
+	return output, nil
+}
+
+func TestEnrichWithLifecycleState(t *testing.T) {
+	client := &mockAutoScalingInstances{states: map[string]string{
+		"i-aaaa": "InService", "i-bbbb": "Warmed:Running", "i-cccc": "Terminating:Wait",
+	}}
+	agents := []Agent{
+		{EC2InstanceID: "i-aaaa", AutoScalingGroup: "web"},
+		{EC2InstanceID: "i-bbbb", AutoScalingGroup: "web"},
+		{EC2InstanceID: "i-cccc", AutoScalingGroup: "web"},
+		{EC2InstanceID: "i-dddd"},
+	}
+	if err := EnrichWithLifecycleState(context.Background(), client, agents); err != nil {
+		t.Fatalf("EnrichWithLifecycleState() error = %v", err)
+	}
+	if len(client.asked) != 1 || len(client.asked[0]) != 3 {
+		t.Errorf("DescribeAutoScalingInstances asked for %v, want the 3 instances in a group", client.asked)
+	}
+	want := []struct {
+		state      string
+		warmPool   bool
+		transition bool
+	}{{"InService", false, false}, {"Warmed:Running", true, true}, {"Terminating:Wait", false, true}, {"", false, false}}
+	for i, agent := range agents {
+		if agent.LifecycleState != want[i].state || agent.WarmPool != want[i].warmPool || agent.LifecycleTransition() != want[i].transition {
+			t.Errorf("agent %v = state %q, warm pool %v, transition %v, want %+v", agent.EC2InstanceID, agent.LifecycleState, agent.WarmPool, agent.LifecycleTransition(), want[i])
+		}
+	}
+}
+
+func TestHealthPolicyLifecycleTransitions(t *testing.T) {
+	warm := Agent{AgentStatus: "ACTIVE", AgentConnected: false, LifecycleState: "Warmed:Running", WarmPool: true}
+	policy := HealthPolicy{FailOnStatus: true, FailOnDisconnected: true}
+	if policy.Unhealthy(warm) {
+		t.Error("Unhealthy() of a disconnected warm pool agent = true, want it exempt")
+	}
+	policy.IncludeLifecycleTransitions = true
+	if !policy.Unhealthy(warm) {
+		t.Error("Unhealthy() with IncludeLifecycleTransitions = false, want the agent evaluated")
+	}
+}
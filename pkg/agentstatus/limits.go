@@ -0,0 +1,121 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ErrAPIBudgetExhausted matches, with errors.Is, the errors of API calls refused because the APIBudget of
+// their config was used up
+var ErrAPIBudgetExhausted = errors.New("API call budget exhausted")
+
+// InFlightLimiter bounds the number of calls in progress at once. It is safe for concurrent use
+type InFlightLimiter struct {
+	slots chan struct{}
+}
+
+// NewInFlightLimiter returns an InFlightLimiter allowing max calls in progress at once, or nil (no limit) if
+// max is not positive
+func NewInFlightLimiter(max int) *InFlightLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &InFlightLimiter{slots: make(chan struct{}, max)}
+}
+
+// Acquire blocks until a call may start or ctx is done. A nil InFlightLimiter never blocks
+func (l *InFlightLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release ends a call started by Acquire
+func (l *InFlightLimiter) Release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// APIBudget is a number of API call attempts, shared by every config returned by WithAPILimits with it,
+// after which further attempts fail with ErrAPIBudgetExhausted. It is safe for concurrent use
+type APIBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// NewAPIBudget returns an APIBudget of limit attempts, or nil (no limit) if limit is not positive
+func NewAPIBudget(limit int64) *APIBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &APIBudget{limit: limit}
+}
+
+// Take uses an attempt of the budget, or returns ErrAPIBudgetExhausted when none is left. A nil APIBudget
+// never runs out
+func (b *APIBudget) Take() error {
+	if b == nil {
+		return nil
+	}
+	if b.used.Add(1) > b.limit {
+		return fmt.Errorf("%w: all %v calls used", ErrAPIBudgetExhausted, b.limit)
+	}
+	return nil
+}
+
+// Used returns the number of attempts taken from the budget, including refused ones
+func (b *APIBudget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
+
+// Exhausted reports whether an attempt was refused
+func (b *APIBudget) Exhausted() bool {
+	return b != nil && b.used.Load() > b.limit
+}
+
+// Reset makes the whole budget available again, e.g. for the next poll of a long-running process
+func (b *APIBudget) Reset() {
+	if b != nil {
+		b.used.Store(0)
+	}
+}
+
+// WithAPILimits returns a copy of cfg whose clients take every attempt of an API call, including retries,
+// from budget, and hold a slot of inFlight for every attempt of a Describe call. inFlight and budget may be
+// nil
+func WithAPILimits(cfg aws.Config, inFlight *InFlightLimiter, budget *APIBudget) aws.Config {
+	cfg = cfg.Copy()
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("APILimits",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				if err := budget.Take(); err != nil {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+				}
+				if strings.HasPrefix(awsmiddleware.GetOperationName(ctx), "Describe") {
+					if err := inFlight.Acquire(ctx); err != nil {
+						return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+					}
+					defer inFlight.Release()
+				}
+				return next.HandleFinalize(ctx, in)
+			}), "Retry", middleware.After)
+	})
+	return cfg
+}
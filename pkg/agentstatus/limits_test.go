@@ -0,0 +1,88 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+func TestAPIBudget(t *testing.T) {
+	budget := NewAPIBudget(2)
+	for i := 0; i < 2; i++ {
+		if err := budget.Take(); err != nil {
+			t.Fatalf("Take() %d error = %v", i, err)
+		}
+	}
+	if err := budget.Take(); !errors.Is(err, ErrAPIBudgetExhausted) || !budget.Exhausted() {
+		t.Errorf("Take() beyond the budget error = %v, exhausted %v", err, budget.Exhausted())
+	}
+	budget.Reset()
+	if err := budget.Take(); err != nil || budget.Used() != 1 {
+		t.Errorf("Take() after Reset() error = %v, used %v", err, budget.Used())
+	}
+	if NewAPIBudget(0) != nil || NewAPIBudget(0).Take() != nil {
+		t.Error("a zero budget is limited")
+	}
+}
+
+func TestInFlightLimiter(t *testing.T) {
+	limiter := NewInFlightLimiter(1)
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() of a full limiter error = %v, want the context's", err)
+	}
+	limiter.Release()
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Errorf("Acquire() after Release() error = %v", err)
+	}
+	if NewInFlightLimiter(0) != nil {
+		t.Error("NewInFlightLimiter(0) is limited")
+	}
+}
+
+func TestWithAPILimits(t *testing.T) {
+	var inFlight, maxInFlight, requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for current := maxInFlight.Load(); n > current && !maxInFlight.CompareAndSwap(current, n); current = maxInFlight.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write([]byte(`{"clusters":[],"failures":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")}
+	cfg = WithAPILimits(cfg, NewInFlightLimiter(2), NewAPIBudget(6))
+	client := ecs.NewFromConfig(cfg, func(o *ecs.Options) { o.BaseEndpoint = aws.String(server.URL) })
+
+	var wg sync.WaitGroup
+	var exhausted atomic.Int64
+	for range 8 {
+		wg.Go(func() {
+			_, err := client.DescribeClusters(context.Background(), &ecs.DescribeClustersInput{})
+			if errors.Is(err, ErrAPIBudgetExhausted) {
+				exhausted.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	if requests.Load() != 6 || exhausted.Load() != 2 || maxInFlight.Load() > 2 {
+		t.Errorf("requests, refused, max in flight = %v, %v, %v, want 6, 2 and at most 2", requests.Load(), exhausted.Load(), maxInFlight.Load())
+	}
+}
@@ -0,0 +1,12 @@
+package agentstatus
+
+import "github.com/rs/zerolog"
+
+// logger receives the package's warnings, such as skipped clusters and instances that could not be
+// described. It discards everything until SetLogger is called
+var logger = zerolog.Nop()
+
+// SetLogger sets the logger used for the package's warnings
+func SetLogger(l zerolog.Logger) {
+	logger = l
+}
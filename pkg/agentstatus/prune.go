@@ -0,0 +1,51 @@
+package agentstatus
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// StaleAgents returns the agents whose EC2 instance no longer exists: DescribeInstances does not return it,
+// or returns it terminated, as it does for about an hour after termination. Only disconnected agents can be
+// stale, since a connected agent runs on a live instance; external agents and agents without an EC2 instance
+// ID never are
+func StaleAgents(ctx context.Context, client EC2InstanceDescriber, agents []Agent) ([]Agent, error) {
+	var candidates []Agent
+	for _, agent := range agents {
+		if !agent.AgentConnected && agent.EC2InstanceID != "" && agent.LaunchType != LaunchTypeExternal {
+			candidates = append(candidates, agent)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	instances, err := describeInstances(ctx, client, candidates)
+	if err != nil {
+		return nil, err
+	}
+	var stale []Agent
+	for _, agent := range candidates {
+		instance, ok := instances[agent.EC2InstanceID]
+		if !ok || (instance.State != nil && instance.State.Name == types.InstanceStateNameTerminated) {
+			stale = append(stale, agent)
+		}
+	}
+	return stale, nil
+}
+
+// DeregisterContainerInstance deregisters a container instance from its cluster. It is forced, since ECS
+// still records the tasks of a container instance whose EC2 instance is gone
+func (c *StatusChecker) DeregisterContainerInstance(ctx context.Context, clusterName, arn string) error {
+	_, err := c.Client.DeregisterContainerInstance(ctx, &ecs.DeregisterContainerInstanceInput{
+		Cluster:           &clusterName,
+		ContainerInstance: &arn,
+		Force:             aws.Bool(true),
+	})
+	if err != nil {
+		return c.newAPIError(clusterName, "DeregisterContainerInstance", err)
+	}
+	return nil
+}
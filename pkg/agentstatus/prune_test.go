@@ -0,0 +1,39 @@
+package agentstatus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestStaleAgents(t *testing.T) {
+	client := &mockEC2InstanceDescriber{instances: []ec2types.Instance{
+		{InstanceId: aws.String("i-live"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+		{InstanceId: aws.String("i-terminated"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameTerminated}},
+	}}
+	agents := []Agent{
+		{EC2InstanceID: "i-live"},
+		{EC2InstanceID: "i-terminated"},
+		{EC2InstanceID: "i-gone"},
+		{EC2InstanceID: "i-connected", AgentConnected: true},
+		{EC2InstanceID: "mi-external", LaunchType: LaunchTypeExternal},
+	}
+	stale, err := StaleAgents(context.Background(), client, agents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, agent := range stale {
+		got = append(got, agent.EC2InstanceID)
+	}
+	if len(got) != 2 || got[0] != "i-terminated" || got[1] != "i-gone" {
+		t.Errorf("StaleAgents() = %v, want [i-terminated i-gone]", got)
+	}
+
+	client.calls = 0
+	if stale, err := StaleAgents(context.Background(), client, agents[3:]); err != nil || stale != nil || client.calls != 0 {
+		t.Errorf("StaleAgents() of connected and external agents = %v, %v with %v calls, want none without calls", stale, err, client.calls)
+	}
+}
@@ -0,0 +1,29 @@
+package agentstatus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// EC2RegionDescriber is the subset of the EC2 API needed to enumerate regions. It is satisfied by *ec2.Client
+type EC2RegionDescriber interface {
+	DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+}
+
+// EnabledRegions returns the sorted names of the regions enabled for the account
+func EnabledRegions(ctx context.Context, client EC2RegionDescriber) ([]string, error) {
+	output, err := client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{AllRegions: aws.Bool(false)})
+	if err != nil {
+		return nil, fmt.Errorf("describe regions: %w", err)
+	}
+	regions := make([]string, 0, len(output.Regions))
+	for _, region := range output.Regions {
+		regions = append(regions, aws.ToString(region.RegionName))
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
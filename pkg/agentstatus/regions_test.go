@@ -0,0 +1,33 @@
+package agentstatus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type mockEC2RegionDescriber struct {
+	regions []string
+}
+
+func (m *mockEC2RegionDescriber) DescribeRegions(_ context.Context, _ *ec2.DescribeRegionsInput, _ ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	output := &ec2.DescribeRegionsOutput{}
+	for _, region := range m.regions {
+		output.Regions = append(output.Regions, ec2types.Region{RegionName: aws.String(region)})
+	}
+	return output, nil
+}
+
+func TestEnabledRegions(t *testing.T) {
+	got, err := EnabledRegions(context.Background(), &mockEC2RegionDescriber{regions: []string{"us-west-2", "eu-west-1", "us-east-1"}})
+	if err != nil {
+		t.Fatalf("EnabledRegions() error = %v", err)
+	}
+	if want := []string{"eu-west-1", "us-east-1", "us-west-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnabledRegions() = %v, want %v", got, want)
+	}
+}
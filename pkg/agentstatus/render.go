@@ -0,0 +1,63 @@
+package agentstatus
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Renderer writes a Report in an output format. Renderers registered with RegisterRenderer are selected by
+// name with the --output flag of the command, next to its built-in formats
+type Renderer interface {
+	Render(w io.Writer, report Report) error
+}
+
+// RendererFunc is a function used as a Renderer
+type RendererFunc func(w io.Writer, report Report) error
+
+// Render calls f(w, report)
+func (f RendererFunc) Render(w io.Writer, report Report) error {
+	return f(w, report)
+}
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = make(map[string]Renderer)
+)
+
+// RegisterRenderer makes a renderer available by name, e.g. from the init function of a package imported
+// for its side effects. It panics if the name is empty or already registered, or if the renderer is nil
+func RegisterRenderer(name string, renderer Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	switch {
+	case name == "":
+		panic("agentstatus: RegisterRenderer with an empty name")
+	case renderer == nil:
+		panic(fmt.Sprintf("agentstatus: RegisterRenderer %v with a nil renderer", name))
+	case renderers[name] != nil:
+		panic(fmt.Sprintf("agentstatus: RegisterRenderer called twice for %v", name))
+	}
+	renderers[name] = renderer
+}
+
+// LookupRenderer returns the renderer registered with name
+func LookupRenderer(name string) (Renderer, bool) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	renderer, ok := renderers[name]
+	return renderer, ok
+}
+
+// Renderers returns the names of the registered renderers, sorted
+func Renderers() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
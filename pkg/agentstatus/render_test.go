@@ -0,0 +1,41 @@
+package agentstatus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegisterRenderer(t *testing.T) {
+	RegisterRenderer("test-count", RendererFunc(func(w io.Writer, report Report) error {
+		_, err := fmt.Fprintf(w, "%v agents\n", report.Summary.Agents)
+		return err
+	}))
+	renderer, ok := LookupRenderer("test-count")
+	if !ok {
+		t.Fatal("LookupRenderer() did not find the registered renderer")
+	}
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, NewReport([]Agent{{Cluster: "web"}}, nil, DefaultHealthPolicy, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "1 agents\n" {
+		t.Errorf("Render() = %q, want %q", buf.String(), "1 agents\n")
+	}
+	if _, ok := LookupRenderer("test-missing"); ok {
+		t.Error("LookupRenderer() found an unregistered renderer")
+	}
+	if got := Renderers(); !reflect.DeepEqual(got, []string{"test-count"}) {
+		t.Errorf("Renderers() = %v, want [test-count]", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterRenderer() of a registered name did not panic")
+		}
+	}()
+	RegisterRenderer("test-count", RendererFunc(func(io.Writer, Report) error { return nil }))
+}
@@ -0,0 +1,153 @@
+package agentstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/natemarks/ecs-agent-status/version"
+)
+
+// ReportSchemaVersion is the SchemaVersion of the reports written by this version of the package. It is
+// only incremented when a field is removed or changes meaning; new fields are added without a new version
+const ReportSchemaVersion = 1
+
+// Report is the result of a scan: the agents with their summary counts, overall and per cluster, and the
+// clusters or regions that could not be checked. It is returned by Client.Scan and written by the command
+// with --report, and its JSON encoding is versioned by SchemaVersion
+type Report struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// ToolVersion is the version of ecs-agent-status that made the report
+	ToolVersion string    `json:"toolVersion"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Accounts and Regions are those of the agents and errors, sorted. Accounts is empty unless the
+	// accounts are known, e.g. when scanning several
+	Accounts []string `json:"accounts,omitempty"`
+	Regions  []string `json:"regions"`
+	Summary  Summary  `json:"summary"`
+	// Clusters has a section per cluster with agents, sorted by account, region and cluster
+	Clusters []ClusterSummary `json:"clusters"`
+	// Agents are sorted by account, region, cluster and instance
+	Agents []Agent `json:"agents"`
+	// Hierarchy has the same agents nested by account, region and cluster, in the same order
+	Hierarchy []ReportAccount `json:"hierarchy"`
+	// Errors are the clusters, or whole regions, that could not be checked
+	Errors []*ClusterError `json:"errors,omitempty"`
+}
+
+// ReportAccount is the section of a Report with the agents of an account, by region. AccountID is empty
+// when the accounts are not known
+type ReportAccount struct {
+	AccountID string         `json:"accountId,omitempty"`
+	Regions   []ReportRegion `json:"regions"`
+}
+
+// ReportRegion is the section of a ReportAccount with the agents of a region, by cluster
+type ReportRegion struct {
+	Region   string          `json:"region"`
+	Clusters []ReportCluster `json:"clusters"`
+}
+
+// ReportCluster is the section of a ReportRegion with the agents of a cluster
+type ReportCluster struct {
+	Cluster string  `json:"cluster"`
+	Agents  []Agent `json:"agents"`
+}
+
+// NestAgents returns the agents nested by account, region and cluster. The agents must be sorted by
+// SortByLocation, so that each account, region and cluster has one section, in order
+func NestAgents(agents []Agent) []ReportAccount {
+	accounts := []ReportAccount{}
+	for _, agent := range agents {
+		if n := len(accounts); n == 0 || accounts[n-1].AccountID != agent.AccountID {
+			accounts = append(accounts, ReportAccount{AccountID: agent.AccountID})
+		}
+		account := &accounts[len(accounts)-1]
+		if n := len(account.Regions); n == 0 || account.Regions[n-1].Region != agent.Region {
+			account.Regions = append(account.Regions, ReportRegion{Region: agent.Region})
+		}
+		region := &account.Regions[len(account.Regions)-1]
+		if n := len(region.Clusters); n == 0 || region.Clusters[n-1].Cluster != agent.Cluster {
+			region.Clusters = append(region.Clusters, ReportCluster{Cluster: agent.Cluster})
+		}
+		cluster := &region.Clusters[len(region.Clusters)-1]
+		cluster.Agents = append(cluster.Agents, agent)
+	}
+	return accounts
+}
+
+// NewReport returns the report of the agents and errors of a scan made at now, counting the agents that
+// are unhealthy under policy. The agents are sorted by SortByLocation, leaving the slice given unchanged
+func NewReport(agents []Agent, errs []*ClusterError, policy HealthPolicy, now time.Time) Report {
+	agents = slices.Clone(agents)
+	if agents == nil {
+		agents = []Agent{}
+	}
+	SortByLocation(agents)
+	clusters := SummarizeClusters(agents)
+	if clusters == nil {
+		clusters = []ClusterSummary{}
+	}
+	report := Report{
+		SchemaVersion: ReportSchemaVersion,
+		ToolVersion:   version.Version,
+		GeneratedAt:   now.UTC(),
+		Regions:       []string{},
+		Summary:       Summarize(agents, policy),
+		Clusters:      clusters,
+		Agents:        agents,
+		Hierarchy:     NestAgents(agents),
+		Errors:        errs,
+	}
+	add := func(account, region string) {
+		if account != "" && !slices.Contains(report.Accounts, account) {
+			report.Accounts = append(report.Accounts, account)
+		}
+		if region != "" && !slices.Contains(report.Regions, region) {
+			report.Regions = append(report.Regions, region)
+		}
+	}
+	for _, agent := range agents {
+		add(agent.AccountID, agent.Region)
+	}
+	for _, err := range errs {
+		add(err.AccountID, err.Region)
+	}
+	sort.Strings(report.Accounts)
+	sort.Strings(report.Regions)
+	return report
+}
+
+// ClusterError is an error checking a cluster, or listing the clusters of a region when Cluster is empty
+type ClusterError struct {
+	AccountID string `json:"accountId,omitempty"`
+	Region    string `json:"region"`
+	Cluster   string `json:"cluster,omitempty"`
+	Err       error  `json:"-"`
+}
+
+func (e *ClusterError) Error() string {
+	if e.Cluster == "" {
+		return fmt.Sprintf("region %s: %v", e.Region, e.Err)
+	}
+	return fmt.Sprintf("region %s: cluster %s: %v", e.Region, e.Cluster, e.Err)
+}
+
+func (e *ClusterError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON encodes the error with its message under error
+func (e *ClusterError) MarshalJSON() ([]byte, error) {
+	type clusterError ClusterError
+	var message string
+	if e.Err != nil {
+		message = e.Err.Error()
+	}
+	return json.Marshal(struct {
+		*clusterError
+		Error string `json:"error"`
+	}{(*clusterError)(e), message})
+}
@@ -0,0 +1,98 @@
+package agentstatus
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewReport(t *testing.T) {
+	agents := []Agent{
+		{Region: "us-west-2", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true},
+		{AccountID: "111111111111", Region: "us-east-1", Cluster: "web", AgentStatus: "DRAINING", AgentConnected: true},
+	}
+	errs := []*ClusterError{{AccountID: "222222222222", Region: "eu-west-1", Cluster: "batch", Err: errors.New("access denied")}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	report := NewReport(agents, errs, DefaultHealthPolicy, now)
+
+	if report.SchemaVersion != ReportSchemaVersion || !report.GeneratedAt.Equal(now) || report.GeneratedAt.Location() != time.UTC {
+		t.Errorf("NewReport() schema version and time = %v, %v", report.SchemaVersion, report.GeneratedAt)
+	}
+	if want := []string{"111111111111", "222222222222"}; !reflect.DeepEqual(report.Accounts, want) {
+		t.Errorf("NewReport() accounts = %v, want %v", report.Accounts, want)
+	}
+	if want := []string{"eu-west-1", "us-east-1", "us-west-2"}; !reflect.DeepEqual(report.Regions, want) {
+		t.Errorf("NewReport() regions = %v, want %v", report.Regions, want)
+	}
+	if len(report.Clusters) != 2 || report.Summary.Agents != 2 || report.Summary.Unhealthy != 1 {
+		t.Errorf("NewReport() clusters = %+v, summary = %+v", report.Clusters, report.Summary)
+	}
+
+	empty, err := json.Marshal(NewReport(nil, nil, DefaultHealthPolicy, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(empty, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"agents", "clusters", "regions", "hierarchy"} {
+		if string(fields[field]) != "[]" {
+			t.Errorf("NewReport() of no agents has %v = %s, want []", field, fields[field])
+		}
+	}
+}
+
+func TestNestAgents(t *testing.T) {
+	agents := []Agent{
+		{AccountID: "222222222222", Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-cccc"},
+		{AccountID: "111111111111", Region: "us-west-2", Cluster: "web", EC2InstanceID: "i-bbbb"},
+		{AccountID: "111111111111", Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-dddd"},
+		{AccountID: "111111111111", Region: "us-east-1", Cluster: "batch", EC2InstanceID: "i-eeee"},
+		{AccountID: "111111111111", Region: "us-east-1", Cluster: "web", EC2InstanceID: "i-aaaa"},
+	}
+	report := NewReport(agents, nil, DefaultHealthPolicy, time.Now())
+	var got []string
+	for _, account := range report.Hierarchy {
+		for _, region := range account.Regions {
+			for _, cluster := range region.Clusters {
+				for _, agent := range cluster.Agents {
+					got = append(got, account.AccountID+"/"+region.Region+"/"+cluster.Cluster+"/"+agent.EC2InstanceID)
+				}
+			}
+		}
+	}
+	want := []string{
+		"111111111111/us-east-1/batch/i-eeee",
+		"111111111111/us-east-1/web/i-aaaa",
+		"111111111111/us-east-1/web/i-dddd",
+		"111111111111/us-west-2/web/i-bbbb",
+		"222222222222/us-east-1/web/i-cccc",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewReport() hierarchy = %v, want %v", got, want)
+	}
+	if len(report.Hierarchy) != 2 || len(report.Hierarchy[0].Regions) != 2 || len(report.Hierarchy[0].Regions[0].Clusters) != 2 {
+		t.Errorf("NewReport() hierarchy has %v accounts, want each account, region and cluster once", len(report.Hierarchy))
+	}
+	for i, agent := range report.Agents {
+		if agent.EC2InstanceID != want[i][len(want[i])-6:] {
+			t.Errorf("NewReport() agent %v = %v, want the agents in the order of the hierarchy", i, agent.EC2InstanceID)
+		}
+	}
+	if agents[0].EC2InstanceID != "i-cccc" {
+		t.Error("NewReport() reordered the agents given")
+	}
+}
+
+func TestClusterErrorJSON(t *testing.T) {
+	data, err := json.Marshal(&ClusterError{Region: "us-east-1", Cluster: "web", Err: errors.New("access denied")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"region":"us-east-1","cluster":"web","error":"access denied"}`; string(data) != want {
+		t.Errorf("ClusterError JSON = %s, want %s", data, want)
+	}
+}
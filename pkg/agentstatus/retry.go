@@ -0,0 +1,231 @@
+package agentstatus
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// RetryOptions tunes how API calls that fail with throttling or transient errors are retried
+type RetryOptions struct {
+	// MaxAttempts is the number of attempts per call, including the first. Zero uses the SDK default of 3
+	MaxAttempts int
+	// MaxBackoff caps the exponential backoff between attempts. Zero uses the SDK default of 20s
+	MaxBackoff time.Duration
+}
+
+// noRetryQuota is a retry.RateLimiter that never runs out of retry tokens. The SDK's default quota stops
+// retrying after a burst of throttling errors, which is exactly when a large scan needs to keep backing off
+type noRetryQuota struct{}
+
+func (noRetryQuota) GetToken(context.Context, uint) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (noRetryQuota) AddTokens(uint) error { return nil }
+
+// WithRetries returns a copy of cfg whose clients retry with exponential backoff and jitter as set by opts
+func WithRetries(cfg aws.Config, opts RetryOptions) aws.Config {
+	cfg = cfg.Copy()
+	cfg.Retryer = func() aws.Retryer {
+		return retry.NewStandard(func(o *retry.StandardOptions) {
+			if opts.MaxAttempts > 0 {
+				o.MaxAttempts = opts.MaxAttempts
+			}
+			if opts.MaxBackoff > 0 {
+				o.MaxBackoff = opts.MaxBackoff
+				o.Backoff = retry.NewExponentialJitterBackoff(opts.MaxBackoff)
+			}
+			o.RateLimiter = noRetryQuota{}
+		})
+	}
+	return cfg
+}
+
+// APIStats counts the API call attempts made through configs returned by WithAPIControls and those that
+// were throttled, and times them per operation. It is safe for concurrent use
+type APIStats struct {
+	attempts  atomic.Int64
+	throttles atomic.Int64
+
+	mu         sync.Mutex
+	operations map[operationKey]*operationSamples
+}
+
+// operationKey identifies an API operation, e.g. ECS DescribeContainerInstances
+type operationKey struct {
+	service, operation string
+}
+
+// operationSamples are the durations and throttling errors of the attempts of an operation
+type operationSamples struct {
+	durations []time.Duration
+	throttles int
+}
+
+// OperationStats summarizes the attempts of an API operation. The durations are those of the requests,
+// without the time spent waiting for the rate limiter or backing off between retries
+type OperationStats struct {
+	Service   string        `json:"service"`
+	Operation string        `json:"operation"`
+	Calls     int           `json:"calls"`
+	Throttles int           `json:"throttles"`
+	Total     time.Duration `json:"total"`
+	Average   time.Duration `json:"average"`
+	P95       time.Duration `json:"p95"`
+	Max       time.Duration `json:"max"`
+}
+
+// Attempts returns the number of API call attempts, including retries
+func (s *APIStats) Attempts() int64 {
+	return s.attempts.Load()
+}
+
+// Throttles returns the number of API call attempts that failed with a throttling error
+func (s *APIStats) Throttles() int64 {
+	return s.throttles.Load()
+}
+
+// record counts an attempt of an operation that took duration and failed with err
+func (s *APIStats) record(service, operation string, duration time.Duration, err error) {
+	s.attempts.Add(1)
+	throttled := IsThrottle(err)
+	if throttled {
+		s.throttles.Add(1)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.operations == nil {
+		s.operations = make(map[operationKey]*operationSamples)
+	}
+	key := operationKey{service: service, operation: operation}
+	samples, ok := s.operations[key]
+	if !ok {
+		samples = &operationSamples{}
+		s.operations[key] = samples
+	}
+	samples.durations = append(samples.durations, duration)
+	if throttled {
+		samples.throttles++
+	}
+}
+
+// Operations returns the statistics of each operation called, the slowest in total first
+func (s *APIStats) Operations() []OperationStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operations := make([]OperationStats, 0, len(s.operations))
+	for key, samples := range s.operations {
+		durations := slices.Clone(samples.durations)
+		slices.Sort(durations)
+		stats := OperationStats{Service: key.service, Operation: key.operation, Calls: len(durations), Throttles: samples.throttles,
+			Max: durations[len(durations)-1]}
+		for _, duration := range durations {
+			stats.Total += duration
+		}
+		stats.Average = stats.Total / time.Duration(len(durations))
+		// The nearest-rank 95th percentile
+		stats.P95 = durations[(len(durations)*95+99)/100-1]
+		operations = append(operations, stats)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].Total != operations[j].Total {
+			return operations[i].Total > operations[j].Total
+		}
+		return operations[i].Service+operations[i].Operation < operations[j].Service+operations[j].Operation
+	})
+	return operations
+}
+
+// RateLimiter spaces calls evenly so that no more than a given number start per second. It is safe for
+// concurrent use
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing perSecond calls per second, or nil (no limit) if perSecond
+// is not positive
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the next call may start or ctx is done. A nil RateLimiter never blocks
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithAPILogging returns a copy of cfg whose clients log every API call attempt at debug level with its
+// service, operation, region, duration and error
+func WithAPILogging(cfg aws.Config) aws.Config {
+	cfg = cfg.Copy()
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("APILogging",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				start := time.Now()
+				out, metadata, err := next.HandleFinalize(ctx, in)
+				logger.Debug().Err(err).Str("service", awsmiddleware.GetServiceID(ctx)).Str("operation", awsmiddleware.GetOperationName(ctx)).
+					Str("region", awsmiddleware.GetRegion(ctx)).Dur("duration", time.Since(start)).Msg("AWS API call")
+				return out, metadata, err
+			}), "Retry", middleware.After)
+	})
+	return cfg
+}
+
+// WithAPIControls returns a copy of cfg whose clients wait for limiter before every attempt of a Describe
+// call, including retries, and count their attempts, throttling errors and durations in stats. limiter and
+// stats may be nil
+func WithAPIControls(cfg aws.Config, limiter *RateLimiter, stats *APIStats) aws.Config {
+	cfg = cfg.Copy()
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("APIControls",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				if strings.HasPrefix(awsmiddleware.GetOperationName(ctx), "Describe") {
+					if err := limiter.Wait(ctx); err != nil {
+						return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+					}
+				}
+				start := time.Now()
+				out, metadata, err := next.HandleFinalize(ctx, in)
+				if stats != nil {
+					stats.record(awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx), time.Since(start), err)
+				}
+				return out, metadata, err
+			}), "Retry", middleware.After)
+	})
+	return cfg
+}
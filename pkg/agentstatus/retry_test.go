@@ -0,0 +1,86 @@
+package agentstatus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+func TestWithAPIControlsCountsThrottles(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"ThrottlingException","message":"Rate exceeded"}`))
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")}
+	cfg = WithRetries(cfg, RetryOptions{MaxAttempts: 3, MaxBackoff: time.Millisecond})
+	var stats APIStats
+	cfg = WithAPIControls(cfg, NewRateLimiter(1000), &stats)
+	client := ecs.NewFromConfig(cfg, func(o *ecs.Options) { o.BaseEndpoint = aws.String(server.URL) })
+
+	if _, err := client.DescribeClusters(context.Background(), &ecs.DescribeClustersInput{}); err == nil {
+		t.Fatal("DescribeClusters() returned no error")
+	}
+	if requests.Load() != 3 || stats.Attempts() != 3 || stats.Throttles() != 3 {
+		t.Errorf("requests, attempts, throttles = %v, %v, %v, want 3 each", requests.Load(), stats.Attempts(), stats.Throttles())
+	}
+	operations := stats.Operations()
+	if len(operations) != 1 || operations[0].Service != "ECS" || operations[0].Operation != "DescribeClusters" ||
+		operations[0].Calls != 3 || operations[0].Throttles != 3 {
+		t.Errorf("Operations() = %+v, want 3 throttled ECS DescribeClusters calls", operations)
+	}
+}
+
+func TestAPIStatsOperations(t *testing.T) {
+	var stats APIStats
+	for i := 1; i <= 20; i++ {
+		stats.record("ECS", "DescribeContainerInstances", time.Duration(i)*time.Millisecond, nil)
+	}
+	stats.record("ECS", "ListClusters", 500*time.Millisecond, nil)
+	stats.record("EC2", "DescribeInstances", 10*time.Millisecond, nil)
+	operations := stats.Operations()
+	if len(operations) != 3 || operations[0].Operation != "ListClusters" || operations[2].Operation != "DescribeInstances" {
+		t.Fatalf("Operations() = %+v, want them by total time", operations)
+	}
+	got := operations[1]
+	want := OperationStats{Service: "ECS", Operation: "DescribeContainerInstances", Calls: 20, Total: 210 * time.Millisecond,
+		Average: 10500 * time.Microsecond, P95: 19 * time.Millisecond, Max: 20 * time.Millisecond}
+	if got != want {
+		t.Errorf("Operations()[1] = %+v, want %+v", got, want)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if NewRateLimiter(0) != nil {
+		t.Error("NewRateLimiter(0) returned a limiter, want none")
+	}
+	limiter := NewRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first call starts immediately and the next four are spaced 10ms apart
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 calls at 100/s took %v, want at least 40ms", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limiter = NewRateLimiter(0.001)
+	limiter.Wait(ctx)
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("Wait() with a cancelled context returned no error")
+	}
+}
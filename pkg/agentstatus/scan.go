@@ -0,0 +1,55 @@
+package agentstatus
+
+import (
+	"context"
+	"sync"
+)
+
+// ClusterResult is the outcome of checking one cluster
+type ClusterResult struct {
+	Region    string
+	AccountID string
+	Cluster   string
+	Agents    []Agent
+	Err       error
+}
+
+// ScanClusters checks the clusters with a pool of at most concurrency workers (1 if concurrency is less
+// than 1). Each cluster's result is sent on the returned channel as soon as it completes, so results arrive
+// in completion order. The channel is closed once every cluster is done or ctx is cancelled
+func (c *StatusChecker) ScanClusters(ctx context.Context, clusters []string, concurrency int) <-chan ClusterResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobs := make(chan string)
+	results := make(chan ClusterResult, concurrency)
+
+	// Feed the clusters to the workers until they are exhausted or the scan is cancelled
+	go func() {
+		defer close(jobs)
+		for _, cluster := range clusters {
+			select {
+			case jobs <- cluster:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cluster := range jobs {
+				agents, err := c.GetAgentStatusForCluster(ctx, cluster)
+				results <- ClusterResult{Region: c.Region, AccountID: c.AccountID, Cluster: cluster, Agents: agents, Err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
@@ -0,0 +1,41 @@
+package agentstatus
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestScanClusters(t *testing.T) {
+	client := &mockECSClient{instances: []types.ContainerInstance{
+		{ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/aaaa"), Status: aws.String("ACTIVE")},
+	}}
+	checker := NewStatusChecker(client, "us-east-1")
+	clusters := []string{"a", "b", "c", "d", "e"}
+
+	var scanned []string
+	for result := range checker.ScanClusters(context.Background(), clusters, 1) {
+		if result.Err != nil {
+			t.Errorf("ScanClusters() cluster %v error = %v", result.Cluster, result.Err)
+		}
+		if len(result.Agents) != 1 {
+			t.Errorf("ScanClusters() cluster %v returned %d agents, want 1", result.Cluster, len(result.Agents))
+		}
+		scanned = append(scanned, result.Cluster)
+	}
+	sort.Strings(scanned)
+	if len(scanned) != len(clusters) {
+		t.Errorf("ScanClusters() scanned %v, want %v", scanned, clusters)
+	}
+}
+
+func TestScanClustersCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checker := NewStatusChecker(&mockECSClient{}, "us-east-1")
+	for range checker.ScanClusters(ctx, []string{"a", "b", "c"}, 2) {
+	}
+}
@@ -0,0 +1,119 @@
+package agentstatus
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// describeServicesBatchSize is the maximum number of services DescribeServices accepts per call
+const describeServicesBatchSize = 10
+
+// primaryDeployment is the status of the deployment a service is rolling out or running
+const primaryDeployment = "PRIMARY"
+
+// Deployment is a deployment of an ECS service
+type Deployment struct {
+	ID             string    `json:"id"`
+	Status         string    `json:"status"`
+	TaskDefinition string    `json:"taskDefinition"`
+	RolloutState   string    `json:"rolloutState,omitempty"`
+	DesiredCount   int32     `json:"desiredCount"`
+	RunningCount   int32     `json:"runningCount"`
+	PendingCount   int32     `json:"pendingCount"`
+	FailedTasks    int32     `json:"failedTasks"`
+	UpdatedAt      time.Time `json:"updatedAt,omitempty"`
+}
+
+// Service is the task counts and deployment state of an ECS service
+type Service struct {
+	Region       string `json:"region"`
+	AccountID    string `json:"accountId,omitempty"`
+	Cluster      string `json:"cluster"`
+	Name         string `json:"name"`
+	ServiceARN   string `json:"serviceArn"`
+	Status       string `json:"status"`
+	DesiredCount int32  `json:"desiredCount"`
+	RunningCount int32  `json:"runningCount"`
+	PendingCount int32  `json:"pendingCount"`
+	// RolloutState is the rollout state of the PRIMARY deployment: IN_PROGRESS, COMPLETED or FAILED. It is
+	// empty for services not using the ECS deployment controller
+	RolloutState string       `json:"rolloutState,omitempty"`
+	Deployments  []Deployment `json:"deployments"`
+}
+
+// BelowDesired reports whether the service runs fewer tasks than it wants
+func (s Service) BelowDesired() bool {
+	return s.RunningCount < s.DesiredCount
+}
+
+// NewService converts an ECS service description to a Service
+func NewService(clusterName string, service types.Service) Service {
+	result := Service{
+		Cluster:      clusterName,
+		Name:         aws.ToString(service.ServiceName),
+		ServiceARN:   aws.ToString(service.ServiceArn),
+		Status:       aws.ToString(service.Status),
+		DesiredCount: service.DesiredCount,
+		RunningCount: service.RunningCount,
+		PendingCount: service.PendingCount,
+		Deployments:  make([]Deployment, 0, len(service.Deployments)),
+	}
+	for _, deployment := range service.Deployments {
+		d := Deployment{
+			ID:             aws.ToString(deployment.Id),
+			Status:         aws.ToString(deployment.Status),
+			TaskDefinition: aws.ToString(deployment.TaskDefinition),
+			RolloutState:   string(deployment.RolloutState),
+			DesiredCount:   deployment.DesiredCount,
+			RunningCount:   deployment.RunningCount,
+			PendingCount:   deployment.PendingCount,
+			FailedTasks:    deployment.FailedTasks,
+			UpdatedAt:      aws.ToTime(deployment.UpdatedAt),
+		}
+		if d.Status == primaryDeployment {
+			result.RolloutState = d.RolloutState
+		}
+		result.Deployments = append(result.Deployments, d)
+	}
+	return result
+}
+
+// GetServicesForCluster returns every service in the specified ECS cluster, describing them in batches of up
+// to 10, the most the API accepts per call. A cluster without services returns an empty list
+func (c *StatusChecker) GetServicesForCluster(ctx context.Context, clusterName string) ([]Service, error) {
+	var arns []string
+	paginator := ecs.NewListServicesPaginator(c.Client, &ecs.ListServicesInput{Cluster: &clusterName})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, c.newAPIError(clusterName, "ListServices", err)
+		}
+		arns = append(arns, output.ServiceArns...)
+	}
+
+	services := make([]Service, 0, len(arns))
+	for start := 0; start < len(arns); start += describeServicesBatchSize {
+		end := min(start+describeServicesBatchSize, len(arns))
+		output, err := c.Client.DescribeServices(ctx, &ecs.DescribeServicesInput{
+			Cluster:  &clusterName,
+			Services: arns[start:end],
+		})
+		if err != nil {
+			return nil, c.newAPIError(clusterName, "DescribeServices", err)
+		}
+		for _, failure := range output.Failures {
+			logger.Warn().Str("cluster", clusterName).Str("arn", aws.ToString(failure.Arn)).Str("reason", aws.ToString(failure.Reason)).Msg("failed to describe service")
+		}
+		for _, service := range output.Services {
+			s := NewService(clusterName, service)
+			s.Region = c.Region
+			s.AccountID = c.AccountID
+			services = append(services, s)
+		}
+	}
+	return services, nil
+}
@@ -0,0 +1,49 @@
+package agentstatus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestGetServicesForCluster(t *testing.T) {
+	client := &mockECSClient{}
+	for i := 0; i < 12; i++ {
+		client.services = append(client.services, types.Service{
+			ServiceArn:   aws.String(fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:service/production/svc-%d", i)),
+			ServiceName:  aws.String(fmt.Sprintf("svc-%d", i)),
+			Status:       aws.String("ACTIVE"),
+			DesiredCount: 2,
+			RunningCount: 2,
+		})
+	}
+	client.services[3].RunningCount = 1
+	client.services[3].PendingCount = 1
+	client.services[3].Deployments = []types.Deployment{
+		{Id: aws.String("ecs-svc/2"), Status: aws.String("PRIMARY"), RolloutState: types.DeploymentRolloutStateInProgress},
+		{Id: aws.String("ecs-svc/1"), Status: aws.String("ACTIVE"), RolloutState: types.DeploymentRolloutStateCompleted},
+	}
+	checker := NewStatusChecker(client, "us-east-1")
+	checker.AccountID = "123456789012"
+
+	services, err := checker.GetServicesForCluster(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("GetServicesForCluster() error = %v", err)
+	}
+	if len(services) != 12 || client.describeCalls != 2 {
+		t.Fatalf("GetServicesForCluster() = %v services in %v DescribeServices calls, want 12 in 2", len(services), client.describeCalls)
+	}
+	got := services[3]
+	if got.Name != "svc-3" || got.Cluster != "production" || got.Region != "us-east-1" || got.AccountID != "123456789012" {
+		t.Errorf("GetServicesForCluster() service = %+v", got)
+	}
+	if !got.BelowDesired() || got.RolloutState != "IN_PROGRESS" || len(got.Deployments) != 2 {
+		t.Errorf("GetServicesForCluster() service below desired %v, rollout %q, %v deployments", got.BelowDesired(), got.RolloutState, len(got.Deployments))
+	}
+	if services[0].BelowDesired() {
+		t.Errorf("GetServicesForCluster() service %v is below desired", services[0].Name)
+	}
+}
@@ -0,0 +1,38 @@
+package agentstatus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// snsSubjectMaxLength is the longest subject SNS accepts for email subscriptions
+const snsSubjectMaxLength = 100
+
+// SNSPublisher is the subset of the SNS API used to send notifications. It is satisfied by *sns.Client
+type SNSPublisher interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// PublishSNS publishes the message to the topic as JSON, with the subject truncated to the length SNS accepts
+func PublishSNS(ctx context.Context, client SNSPublisher, topicArn, subject string, message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if len(subject) > snsSubjectMaxLength {
+		subject = subject[:snsSubjectMaxLength]
+	}
+	_, err = client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(topicArn),
+		Subject:  aws.String(subject),
+		Message:  aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("publish to %v: %w", topicArn, err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package agentstatus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+type mockSNS struct {
+	input *sns.PublishInput
+}
+
+func (m *mockSNS) Publish(_ context.Context, params *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.input = params
+	return &sns.PublishOutput{}, nil
+}
+
+func TestPublishSNS(t *testing.T) {
+	client := &mockSNS{}
+	topic := "arn:aws:sns:us-east-1:123456789012:ecs-alerts"
+	if err := PublishSNS(context.Background(), client, topic, strings.Repeat("x", 150), map[string]int{"unhealthy": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.ToString(client.input.Subject); len(got) != snsSubjectMaxLength {
+		t.Errorf("PublishSNS() subject length = %v, want %v", len(got), snsSubjectMaxLength)
+	}
+	if got := aws.ToString(client.input.Message); got != `{"unhealthy":2}` {
+		t.Errorf("PublishSNS() message = %v", got)
+	}
+}
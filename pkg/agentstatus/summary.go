@@ -0,0 +1,116 @@
+package agentstatus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Summary counts the agents of a run by state
+type Summary struct {
+	Agents           int            `json:"agents"`
+	Clusters         int            `json:"clusters"`
+	ByStatus         map[string]int `json:"byStatus"`
+	Connected        int            `json:"connected"`
+	Disconnected     int            `json:"disconnected"`
+	Unhealthy        int            `json:"unhealthy"`
+	UnhealthyPercent float64        `json:"unhealthyPercent"`
+}
+
+// Summarize counts the agents by status and connectivity, and those that are unhealthy under policy
+func Summarize(agents []Agent, policy HealthPolicy) Summary {
+	summary := Summary{Agents: len(agents), ByStatus: make(map[string]int)}
+	clusters := make(map[string]bool)
+	for _, agent := range agents {
+		clusters[agent.AccountID+"/"+agent.Region+"/"+agent.Cluster] = true
+		summary.ByStatus[agent.AgentStatus]++
+		if agent.AgentConnected {
+			summary.Connected++
+		} else {
+			summary.Disconnected++
+		}
+	}
+	summary.Clusters = len(clusters)
+	summary.Unhealthy, summary.UnhealthyPercent = policy.UnhealthyPercent(agents)
+	return summary
+}
+
+// String renders the summary on one line, e.g. "40 agents in 3 clusters: 38 ACTIVE, 2 DRAINING; 39
+// connected, 1 disconnected; 2 unhealthy (5.0%)"
+func (s Summary) String() string {
+	statuses := make([]string, 0, len(s.ByStatus))
+	for status := range s.ByStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	counts := make([]string, len(statuses))
+	for i, status := range statuses {
+		counts[i] = fmt.Sprintf("%v %v", s.ByStatus[status], status)
+	}
+	line := fmt.Sprintf("%v agents in %v clusters", s.Agents, s.Clusters)
+	if len(counts) > 0 {
+		line += ": " + strings.Join(counts, ", ")
+	}
+	return line + fmt.Sprintf("; %v connected, %v disconnected; %v unhealthy (%.1f%%)", s.Connected, s.Disconnected, s.Unhealthy, s.UnhealthyPercent)
+}
+
+// ClusterSummary counts the agents of one cluster by state, with the distinct agent versions they run
+type ClusterSummary struct {
+	AccountID     string   `json:"accountId,omitempty"`
+	Region        string   `json:"region"`
+	Cluster       string   `json:"cluster"`
+	Instances     int      `json:"instances"`
+	Active        int      `json:"active"`
+	Draining      int      `json:"draining"`
+	Disconnected  int      `json:"disconnected"`
+	AgentVersions []string `json:"agentVersions"`
+}
+
+// SummarizeClusters returns a summary of each cluster of the agents, sorted by account, region and cluster,
+// with the agent versions of each sorted from oldest to newest
+func SummarizeClusters(agents []Agent) []ClusterSummary {
+	index := make(map[string]int)
+	var summaries []ClusterSummary
+	versions := make(map[string]map[string]bool)
+	for _, agent := range agents {
+		key := agent.AccountID + "/" + agent.Region + "/" + agent.Cluster
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, ClusterSummary{AccountID: agent.AccountID, Region: agent.Region, Cluster: agent.Cluster, AgentVersions: []string{}})
+			versions[key] = make(map[string]bool)
+		}
+		summary := &summaries[i]
+		summary.Instances++
+		switch agent.AgentStatus {
+		case "ACTIVE":
+			summary.Active++
+		case "DRAINING":
+			summary.Draining++
+		}
+		if !agent.AgentConnected {
+			summary.Disconnected++
+		}
+		if agent.AgentVersion != "" && !versions[key][agent.AgentVersion] {
+			versions[key][agent.AgentVersion] = true
+			summary.AgentVersions = append(summary.AgentVersions, agent.AgentVersion)
+		}
+	}
+	for i := range summaries {
+		sort.Slice(summaries[i].AgentVersions, func(a, b int) bool {
+			return CompareVersions(summaries[i].AgentVersions[a], summaries[i].AgentVersions[b]) < 0
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Cluster < b.Cluster
+	})
+	return summaries
+}
@@ -0,0 +1,39 @@
+package agentstatus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	agents := []Agent{
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE"},
+		{Region: "us-east-1", Cluster: "batch", AgentStatus: "DRAINING", AgentConnected: true},
+		{Region: "eu-west-1", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true},
+	}
+	summary := Summarize(agents, DefaultHealthPolicy)
+	want := "4 agents in 3 clusters: 3 ACTIVE, 1 DRAINING; 3 connected, 1 disconnected; 1 unhealthy (25.0%)"
+	if got := summary.String(); got != want {
+		t.Errorf("Summarize() = %q, want %q", got, want)
+	}
+	if got := Summarize(nil, DefaultHealthPolicy).String(); got != "0 agents in 0 clusters; 0 connected, 0 disconnected; 0 unhealthy (0.0%)" {
+		t.Errorf("Summarize(nil) = %q", got)
+	}
+}
+
+func TestSummarizeClusters(t *testing.T) {
+	agents := []Agent{
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE", AgentConnected: true, AgentVersion: "1.9.0"},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "ACTIVE", AgentVersion: "1.10.0"},
+		{Region: "us-east-1", Cluster: "web", AgentStatus: "DRAINING", AgentConnected: true, AgentVersion: "1.9.0"},
+		{Region: "eu-west-1", Cluster: "batch", AgentStatus: "UNKNOWN"},
+	}
+	want := []ClusterSummary{
+		{Region: "eu-west-1", Cluster: "batch", Instances: 1, Disconnected: 1, AgentVersions: []string{}},
+		{Region: "us-east-1", Cluster: "web", Instances: 3, Active: 2, Draining: 1, Disconnected: 1, AgentVersions: []string{"1.9.0", "1.10.0"}},
+	}
+	if got := SummarizeClusters(agents); !reflect.DeepEqual(got, want) {
+		t.Errorf("SummarizeClusters() = %+v, want %+v", got, want)
+	}
+}
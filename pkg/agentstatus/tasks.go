@@ -0,0 +1,77 @@
+package agentstatus
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// describeTasksBatchSize is the maximum number of tasks DescribeTasks accepts per call
+const describeTasksBatchSize = 100
+
+// Task is a task placed on a container instance
+type Task struct {
+	TaskARN      string `json:"taskArn"`
+	Family       string `json:"family"`
+	LastStatus   string `json:"lastStatus"`
+	HealthStatus string `json:"healthStatus,omitempty"`
+}
+
+// taskDefinitionFamily returns the family of a task definition ARN, e.g. web from
+// arn:aws:ecs:us-east-1:123456789012:task-definition/web:42
+func taskDefinitionFamily(arn string) string {
+	family := arn[strings.LastIndex(arn, "/")+1:]
+	if i := strings.LastIndex(family, ":"); i >= 0 {
+		family = family[:i]
+	}
+	return family
+}
+
+// NewTask converts an ECS task description to a Task
+func NewTask(task types.Task) Task {
+	return Task{
+		TaskARN:      aws.ToString(task.TaskArn),
+		Family:       taskDefinitionFamily(aws.ToString(task.TaskDefinitionArn)),
+		LastStatus:   aws.ToString(task.LastStatus),
+		HealthStatus: string(task.HealthStatus),
+	}
+}
+
+// GetTasksForInstance returns the tasks placed on a container instance of the specified ECS cluster,
+// describing them in batches of up to 100, the most the API accepts per call
+func (c *StatusChecker) GetTasksForInstance(ctx context.Context, clusterName, containerInstanceARN string) ([]Task, error) {
+	var arns []string
+	paginator := ecs.NewListTasksPaginator(c.Client, &ecs.ListTasksInput{
+		Cluster:           &clusterName,
+		ContainerInstance: &containerInstanceARN,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, c.newAPIError(clusterName, "ListTasks", err)
+		}
+		arns = append(arns, output.TaskArns...)
+	}
+
+	tasks := make([]Task, 0, len(arns))
+	for start := 0; start < len(arns); start += describeTasksBatchSize {
+		end := min(start+describeTasksBatchSize, len(arns))
+		output, err := c.Client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &clusterName,
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, c.newAPIError(clusterName, "DescribeTasks", err)
+		}
+		for _, failure := range output.Failures {
+			logger.Warn().Str("cluster", clusterName).Str("arn", aws.ToString(failure.Arn)).Str("reason", aws.ToString(failure.Reason)).Msg("failed to describe task")
+		}
+		for _, task := range output.Tasks {
+			tasks = append(tasks, NewTask(task))
+		}
+	}
+	return tasks, nil
+}
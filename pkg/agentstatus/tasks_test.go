@@ -0,0 +1,37 @@
+package agentstatus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestGetTasksForInstance(t *testing.T) {
+	instance := "arn:aws:ecs:us-east-1:123456789012:container-instance/production/aaaa"
+	client := &mockECSClient{tasks: []types.Task{
+		{
+			TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/production/1111"),
+			TaskDefinitionArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/web:42"),
+			ContainerInstanceArn: aws.String(instance),
+			LastStatus:           aws.String("RUNNING"),
+			HealthStatus:         types.HealthStatusUnhealthy,
+		},
+		{
+			TaskArn:              aws.String("arn:aws:ecs:us-east-1:123456789012:task/production/2222"),
+			TaskDefinitionArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/worker:7"),
+			ContainerInstanceArn: aws.String("arn:aws:ecs:us-east-1:123456789012:container-instance/production/bbbb"),
+			LastStatus:           aws.String("RUNNING"),
+		},
+	}}
+
+	tasks, err := NewStatusChecker(client, "us-east-1").GetTasksForInstance(context.Background(), "production", instance)
+	if err != nil {
+		t.Fatalf("GetTasksForInstance() error = %v", err)
+	}
+	want := Task{TaskARN: "arn:aws:ecs:us-east-1:123456789012:task/production/1111", Family: "web", LastStatus: "RUNNING", HealthStatus: "UNHEALTHY"}
+	if len(tasks) != 1 || tasks[0] != want {
+		t.Errorf("GetTasksForInstance() = %+v, want [%+v]", tasks, want)
+	}
+}
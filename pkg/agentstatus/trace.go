@@ -0,0 +1,20 @@
+package agentstatus
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records a span per cluster checked. It does nothing unless the program installs an OpenTelemetry
+// tracer provider
+var tracer = otel.Tracer("github.com/natemarks/ecs-agent-status/pkg/agentstatus")
+
+// endSpan records err, if any, on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
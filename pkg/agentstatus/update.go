@@ -0,0 +1,63 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// ErrNoAgentUpdate is returned by UpdateContainerAgent when the container instance already runs the latest
+// agent version
+var ErrNoAgentUpdate = errors.New("no agent update available")
+
+// UpdateContainerAgent starts an update of the ECS agent on a container instance. ErrNoAgentUpdate is
+// returned when its agent is already the latest version
+func (c *StatusChecker) UpdateContainerAgent(ctx context.Context, clusterName string, arn string) error {
+	_, err := c.Client.UpdateContainerAgent(ctx, &ecs.UpdateContainerAgentInput{Cluster: &clusterName, ContainerInstance: &arn})
+	var noUpdate *types.NoUpdateAvailableException
+	if errors.As(err, &noUpdate) {
+		return ErrNoAgentUpdate
+	}
+	if err != nil {
+		return c.newAPIError(clusterName, "UpdateContainerAgent", err)
+	}
+	return nil
+}
+
+// agentUpdateDone reports whether an agent update status is final
+func agentUpdateDone(status types.AgentUpdateStatus) bool {
+	return status == types.AgentUpdateStatusUpdated || status == types.AgentUpdateStatusFailed
+}
+
+// WaitForAgentUpdate polls the given container instances every interval until the agent update of each is
+// UPDATED or FAILED, and returns the last update status of each by ARN. If ctx ends first, the statuses seen
+// so far are returned with the context's error
+func (c *StatusChecker) WaitForAgentUpdate(ctx context.Context, clusterName string, arns []string, interval time.Duration) (map[string]string, error) {
+	for {
+		output, err := c.DescribeContainerInstances(ctx, clusterName, arns)
+		if err != nil {
+			return nil, err
+		}
+		statuses := make(map[string]string)
+		done := 0
+		for _, instance := range output.ContainerInstances {
+			statuses[aws.ToString(instance.ContainerInstanceArn)] = string(instance.AgentUpdateStatus)
+			if agentUpdateDone(instance.AgentUpdateStatus) {
+				done++
+			}
+		}
+		if done == len(arns) {
+			return statuses, nil
+		}
+		logger.Debug().Str("cluster", clusterName).Msgf("%v of %v agent updates finished", done, len(arns))
+		select {
+		case <-ctx.Done():
+			return statuses, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
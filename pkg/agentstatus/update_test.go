@@ -0,0 +1,49 @@
+package agentstatus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestUpdateContainerAgent(t *testing.T) {
+	client := &mockECSClient{
+		instances:     []types.ContainerInstance{{ContainerInstanceArn: aws.String("aaaa")}, {ContainerInstanceArn: aws.String("bbbb")}},
+		noAgentUpdate: map[string]bool{"bbbb": true},
+	}
+	checker := NewStatusChecker(client, "us-east-1")
+	if err := checker.UpdateContainerAgent(context.Background(), "production", "aaaa"); err != nil {
+		t.Errorf("UpdateContainerAgent(aaaa) error = %v", err)
+	}
+	if err := checker.UpdateContainerAgent(context.Background(), "production", "bbbb"); !errors.Is(err, ErrNoAgentUpdate) {
+		t.Errorf("UpdateContainerAgent(bbbb) error = %v, want %v", err, ErrNoAgentUpdate)
+	}
+	if err := checker.UpdateContainerAgent(context.Background(), "production", "missing"); err == nil || errors.Is(err, ErrNoAgentUpdate) {
+		t.Errorf("UpdateContainerAgent(missing) error = %v, want an API error", err)
+	}
+}
+
+func TestWaitForAgentUpdate(t *testing.T) {
+	client := &mockECSClient{instances: []types.ContainerInstance{
+		{ContainerInstanceArn: aws.String("aaaa"), AgentUpdateStatus: types.AgentUpdateStatusUpdated},
+		{ContainerInstanceArn: aws.String("bbbb"), AgentUpdateStatus: types.AgentUpdateStatusUpdating},
+	}}
+	checker := NewStatusChecker(client, "us-east-1")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	statuses, err := checker.WaitForAgentUpdate(ctx, "production", []string{"aaaa", "bbbb"}, 10*time.Millisecond)
+	if want := map[string]string{"aaaa": "UPDATED", "bbbb": "UPDATING"}; err == nil || !reflect.DeepEqual(statuses, want) {
+		t.Errorf("WaitForAgentUpdate() = %v, %v, want %v and a timeout", statuses, err, want)
+	}
+
+	client.instances[1].AgentUpdateStatus = types.AgentUpdateStatusFailed
+	statuses, err = checker.WaitForAgentUpdate(context.Background(), "production", []string{"aaaa", "bbbb"}, time.Millisecond)
+	if want := map[string]string{"aaaa": "UPDATED", "bbbb": "FAILED"}; err != nil || !reflect.DeepEqual(statuses, want) {
+		t.Errorf("WaitForAgentUpdate() = %v, %v, want %v", statuses, err, want)
+	}
+}
@@ -0,0 +1,49 @@
+package agentstatus
+
+import (
+	"strconv"
+	"strings"
+)
+
+// versionSegments returns the numeric dot-separated segments of a version such as 1.75.0 or v1.75.0.
+// Each segment is parsed up to its first non-digit, so 2-rc1 reads as 2
+func versionSegments(version string) []int {
+	var segments []int
+	for _, part := range strings.Split(strings.TrimPrefix(version, "v"), ".") {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		n, _ := strconv.Atoi(part[:end])
+		segments = append(segments, n)
+	}
+	return segments
+}
+
+// CompareVersions compares two dotted numeric versions and returns -1, 0 or 1 when a is older than, equal to
+// or newer than b. Missing segments count as 0, so 1.75 equals 1.75.0
+func CompareVersions(a, b string) int {
+	as, bs := versionSegments(a), versionSegments(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// ValidVersion reports whether version starts with a number, optionally after a v
+func ValidVersion(version string) bool {
+	version = strings.TrimPrefix(version, "v")
+	return version != "" && version[0] >= '0' && version[0] <= '9'
+}
@@ -0,0 +1,34 @@
+package agentstatus
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.75.0", b: "1.75.0", want: 0},
+		{a: "1.75", b: "1.75.0", want: 0},
+		{a: "1.8.0", b: "1.75.0", want: -1},
+		{a: "1.75.1", b: "1.75.0", want: 1},
+		{a: "v2.0.0", b: "1.99.9", want: 1},
+		{a: "1.70.2-rc1", b: "1.70.2", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := CompareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkOutdated(t *testing.T) {
+	agents := []Agent{{AgentVersion: "1.75.0"}, {AgentVersion: "1.68.2"}, {AgentStatus: "UNKNOWN"}}
+	if got := MarkOutdated(agents, "1.70.0"); got != 1 {
+		t.Errorf("MarkOutdated() = %v, want 1", got)
+	}
+	if agents[0].Outdated || !agents[1].Outdated || agents[2].Outdated {
+		t.Errorf("MarkOutdated() marked %+v, want only the 1.68.2 agent", agents)
+	}
+}
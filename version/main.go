@@ -1,4 +1,68 @@
 package version
 
+import (
+	"runtime"
+	"runtime/debug"
+)
+
 // Version program version variable set by go build -ldflags
 var Version = "undefined"
+
+// Commit and BuildDate are the git commit and the UTC build time, set by go build -ldflags. Without them,
+// Get falls back to the VCS information Go stamps into the binary
+var (
+	Commit    = ""
+	BuildDate = ""
+)
+
+// sdkModulePrefix starts the module paths of the AWS SDK reported in Info.SDKVersions
+const sdkModulePrefix = "github.com/aws/aws-sdk-go-v2"
+
+// sdkModules are the AWS SDK modules whose versions Info reports, by the key used in SDKVersions
+var sdkModules = map[string]string{
+	sdkModulePrefix:                  "aws-sdk-go-v2",
+	sdkModulePrefix + "/service/ecs": "ecs",
+	sdkModulePrefix + "/service/ec2": "ec2",
+}
+
+// Info is the build metadata of the binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion"`
+	// Platform is the GOOS/GOARCH the binary was built for
+	Platform string `json:"platform"`
+	// SDKVersions are the versions of the AWS SDK core and of its ECS and EC2 clients
+	SDKVersions map[string]string `json:"sdkVersions,omitempty"`
+}
+
+// Get returns the build metadata of the running binary
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	// go install module@version stamps the module version
+	if info.Version == "undefined" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildDate == "":
+			info.BuildDate = setting.Value
+		}
+	}
+	for _, dep := range build.Deps {
+		if key, ok := sdkModules[dep.Path]; ok {
+			if info.SDKVersions == nil {
+				info.SDKVersions = make(map[string]string)
+			}
+			info.SDKVersions[key] = dep.Version
+		}
+	}
+	return info
+}